@@ -18,11 +18,17 @@ package app
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
 	ops "github.com/heptio/sonobuoy/pkg/client"
 	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/encryption"
+	"github.com/heptio/sonobuoy/pkg/image"
+	"github.com/heptio/sonobuoy/pkg/plugin"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"k8s.io/api/core/v1"
 )
@@ -61,6 +67,15 @@ func AddKubeconfigFlag(cfg *Kubeconfig, flags *pflag.FlagSet) {
 	flags.Var(cfg, "kubeconfig", "Path to explict kubeconfig file.")
 }
 
+// AddContextsFlag adds a flag for the kubeconfig contexts of a fleet of
+// clusters to act on at once.
+func AddContextsFlag(contexts *[]string, flags *pflag.FlagSet) {
+	flags.StringSliceVar(
+		contexts, "contexts", nil,
+		"Kubeconfig contexts of the clusters to act on at once, instead of the current context.",
+	)
+}
+
 // AddSonobuoyConfigFlag adds a SonobuoyConfig flag to the provided command.
 func AddSonobuoyConfigFlag(cfg *SonobuoyConfig, flags *pflag.FlagSet) {
 	flags.Var(
@@ -70,11 +85,14 @@ func AddSonobuoyConfigFlag(cfg *SonobuoyConfig, flags *pflag.FlagSet) {
 }
 
 const (
-	e2eFocusFlag = "e2e-focus"
-	e2eSkipFlag  = "e2e-skip"
+	e2eFocusFlag    = "e2e-focus"
+	e2eSkipFlag     = "e2e-skip"
+	e2eProviderFlag = "e2e-provider"
+	e2eParallelFlag = "e2e-parallel"
+	e2eRepoListFlag = "e2e-repo-list"
 )
 
-// AddE2EConfigFlags adds two arguments: --e2e-focus and --e2e-skip. These are not taken as pointers, as they are only used by GetE2EConfig. Instead, they are returned as a Flagset which should be passed to GetE2EConfig. The returned flagset will be added to the passed in flag set.
+// AddE2EConfigFlags adds five arguments: --e2e-focus, --e2e-skip, --e2e-provider, --e2e-parallel and --e2e-repo-list. These are not taken as pointers, as they are only used by GetE2EConfig. Instead, they are returned as a Flagset which should be passed to GetE2EConfig. The returned flagset will be added to the passed in flag set.
 func AddE2EConfigFlags(flags *pflag.FlagSet) *pflag.FlagSet {
 	e2eFlags := pflag.NewFlagSet("e2e", pflag.ExitOnError)
 	modeName := ops.Conformance
@@ -87,11 +105,26 @@ func AddE2EConfigFlags(flags *pflag.FlagSet) *pflag.FlagSet {
 		e2eSkipFlag, defaultMode.E2EConfig.Skip,
 		"Specify the E2E_SKIP flag to the conformance tests. Overrides --mode.",
 	)
+	var provider ops.Provider
+	e2eFlags.Var(
+		&provider, e2eProviderFlag,
+		fmt.Sprintf("Skip the conformance tests that can't pass on a managed Kubernetes provider, in addition to those skipped by --mode or --e2e-skip. Valid providers are %s.", strings.Join(ops.GetProviders(), ", ")),
+	)
+	e2eFlags.Int(
+		e2eParallelFlag, defaultMode.E2EConfig.Parallel,
+		"Run the conformance tests on this many Ginkgo nodes at once, skipping the [Serial] tests, which can't run alongside others. "+
+			"Not allowed with --mode Certified-Conformance, since certification needs every conformance test.",
+	)
+	e2eFlags.String(
+		e2eRepoListFlag, "",
+		"A YAML file of the registries the conformance tests pull their own images from, such as e2eRegistry, given to them as KUBE_TEST_REPO_LIST. For air-gapped clusters.",
+	)
 	flags.AddFlagSet(e2eFlags)
 	return e2eFlags
 }
 
 // GetE2EConfig gets the E2EConfig from the mode, then overrides them with e2e-focus and e2e-skip if they are provided.
+// The skips of e2e-provider are added to whichever skip list is used, e2e-parallel sets the number of Ginkgo nodes, and e2e-repo-list the registries the tests pull their images from.
 // We can't rely on the zero value of the flags, as "" is a valid  focus or skip value.
 func GetE2EConfig(mode ops.Mode, flags *pflag.FlagSet) (*ops.E2EConfig, error) {
 	cfg := mode.Get().E2EConfig
@@ -110,6 +143,37 @@ func GetE2EConfig(mode ops.Mode, flags *pflag.FlagSet) (*ops.E2EConfig, error) {
 		}
 		cfg.Skip = skip
 	}
+
+	if provider, ok := flags.Lookup(e2eProviderFlag).Value.(*ops.Provider); ok {
+		cfg.Skip = provider.Skip(cfg.Skip)
+	}
+
+	if flags.Changed(e2eParallelFlag) {
+		parallel, err := flags.GetInt(e2eParallelFlag)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't retrieve parallel flag")
+		}
+		if parallel < 0 {
+			return nil, errors.Errorf("--%v can't be negative", e2eParallelFlag)
+		}
+		if parallel > 1 && mode == ops.CertifiedConformance {
+			return nil, errors.Errorf("--%v can't be used with --mode %v, since parallel runs skip the [Serial] conformance tests", e2eParallelFlag, mode)
+		}
+		cfg.Parallel = parallel
+	}
+
+	if flags.Changed(e2eRepoListFlag) {
+		file, err := flags.GetString(e2eRepoListFlag)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't retrieve repo list flag")
+		}
+		if cfg.RepoList, err = image.LoadRepoList(file); err != nil {
+			return nil, err
+		}
+		for _, name := range cfg.RepoList.Unknown() {
+			logrus.WithField("e2e-repo-list", file).Warningf("registry %v isn't used by the e2e tests of any supported Kubernetes version", name)
+		}
+	}
 	return &cfg, nil
 }
 
@@ -123,6 +187,33 @@ func AddRBACModeFlags(mode *RBACMode, flags *pflag.FlagSet, defaultMode RBACMode
 	)
 }
 
+// AddNamespaceScopedFlag adds a boolean flag for running Sonobuoy in an
+// existing namespace without cluster-wide permissions.
+func AddNamespaceScopedFlag(flag *bool, flags *pflag.FlagSet) {
+	flags.BoolVar(
+		flag, "namespace-scoped", false,
+		"If true, run in the existing namespace with a Role instead of a ClusterRole, skipping cluster-scoped queries and DaemonSet plugins.",
+	)
+}
+
+// AddDeleteOnCompletionFlag adds a boolean flag for having the aggregator
+// delete the run once its results are retrieved.
+func AddDeleteOnCompletionFlag(flag *bool, flags *pflag.FlagSet) {
+	flags.BoolVar(
+		flag, "delete-on-completion", false,
+		"If true, the aggregator deletes the run once its results are stored or retrieved, or after RetrieveTimeout (default 1h) if they're neither.",
+	)
+}
+
+// AddAllowMixedVersionsFlag adds a boolean flag for having the aggregator
+// accept results from workers of a different version.
+func AddAllowMixedVersionsFlag(flag *bool, flags *pflag.FlagSet) {
+	flags.BoolVar(
+		flag, "allow-mixed-versions", false,
+		"If true, the aggregator accepts results from workers built from a different version of Sonobuoy, rather than failing them.",
+	)
+}
+
 // AddSkipPreflightFlag adds a boolean flag to skip preflight checks.
 func AddSkipPreflightFlag(flag *bool, flags *pflag.FlagSet) {
 	flags.BoolVar(
@@ -135,7 +226,7 @@ func AddSkipPreflightFlag(flag *bool, flags *pflag.FlagSet) {
 func AddDeleteAllFlag(flag *bool, flags *pflag.FlagSet) {
 	flags.BoolVar(
 		flag, "all", false,
-		"In addition to deleting Sonobuoy namespaces, also clean up dangling e2e- namespaces.",
+		"Delete every Sonobuoy run in the cluster, not just the one in --namespace, and also clean up dangling e2e- namespaces.",
 	)
 }
 
@@ -147,3 +238,330 @@ func AddImagePullPolicyFlag(policy *ImagePullPolicy, flags *pflag.FlagSet) {
 		fmt.Sprintf("The ImagePullPolicy Sonobuoy should use for the aggregators and workers. Valid options are %s.", strings.Join(ValidPullPolicies(), ", ")),
 	)
 }
+
+// AddImagePullSecretsFlag adds a flag for the secrets used to pull images from private registries.
+func AddImagePullSecretsFlag(secrets *[]string, flags *pflag.FlagSet) {
+	flags.StringSliceVar(
+		secrets, "image-pull-secrets", nil,
+		"The names of secrets in the Sonobuoy namespace used to pull the images of the aggregator and every plugin, such as those hosted in a private registry.",
+	)
+}
+
+// AddScheduleFlags adds the flags for recurring runs: a cron schedule, how many
+// results to keep and how much space to keep them in.
+func AddScheduleFlags(schedule *string, keepResults *int, volumeSize *string, flags *pflag.FlagSet) {
+	flags.StringVar(
+		schedule, "schedule", "",
+		"A cron schedule (such as \"0 2 * * *\") to run Sonobuoy on. If set, Sonobuoy is installed as a CronJob and its results are kept in a persistent volume.",
+	)
+	flags.IntVar(
+		keepResults, "keep-results", 7,
+		"How many results tarballs a scheduled run keeps. Older ones are removed. 0 keeps them all.",
+	)
+	flags.StringVar(
+		volumeSize, "results-volume-size", "10Gi",
+		"The size of the persistent volume a scheduled run keeps its results in.",
+	)
+}
+
+// AddResultsRetentionFlags adds flags for how long results tarballs are kept,
+// and how much space they may take up.
+func AddResultsRetentionFlags(retention *config.SizeOrTimeLimitConfig, flags *pflag.FlagSet) {
+	flags.StringVar(
+		&retention.LimitTime, "results-max-age", "",
+		"How long results tarballs are kept, in the aggregator's results directory and in results storage, such as 720h. Older ones are removed after each run.",
+	)
+	flags.StringVar(
+		&retention.LimitSize, "results-max-size", "",
+		"How much space results tarballs may take up altogether, in the aggregator's results directory and in results storage, such as 5GB. The oldest are removed after each run until they fit.",
+	)
+}
+
+// AddResultsEncryptionFlags adds flags for how results tarballs are encrypted.
+func AddResultsEncryptionFlags(enc *encryption.Config, flags *pflag.FlagSet) {
+	flags.StringVar(
+		&enc.KeyEnv, "results-key-env", "",
+		"Encrypt results tarballs with the base64 encoded 256 bit key in this environment variable of the aggregator, such as one set with --storage-secret.",
+	)
+	flags.StringVar(
+		&enc.KMSKey, "results-kms-key", "",
+		"Encrypt results tarballs with a data key wrapped by this Google Cloud KMS key, such as projects/p/locations/global/keyRings/r/cryptoKeys/k.",
+	)
+}
+
+// AddStorageSecretFlag adds a flag for the secret holding results storage credentials.
+func AddStorageSecretFlag(secret *string, flags *pflag.FlagSet) {
+	flags.StringVar(
+		secret, "storage-secret", "",
+		"The name of a secret in the Sonobuoy namespace whose keys are passed to the aggregator as environment variables, such as credentials for the results storage backend or notification webhook URLs.",
+	)
+}
+
+// PodLogFlags are the flags selecting which pod logs a run collects, and how
+// much of them.
+type PodLogFlags struct {
+	Namespaces    string
+	LabelSelector string
+	Since         string
+	LimitSize     string
+}
+
+// Apply sets the flags which were given on cfg, leaving the rest as they are.
+func (f *PodLogFlags) Apply(cfg *config.Config) {
+	if f.Namespaces != "" {
+		cfg.PodLogs.Namespaces = f.Namespaces
+	}
+	if f.LabelSelector != "" {
+		cfg.PodLogs.LabelSelector = f.LabelSelector
+	}
+	if f.Since != "" {
+		cfg.Limits.PodLogs.LimitTime = f.Since
+	}
+	if f.LimitSize != "" {
+		cfg.Limits.PodLogs.LimitSize = f.LimitSize
+	}
+}
+
+func AddPodLogFlags(podLogs *PodLogFlags, flags *pflag.FlagSet) {
+	flags.StringVar(
+		&podLogs.Namespaces, "pod-log-namespaces", "",
+		"A regex limiting which of the queried namespaces have their pod logs collected.",
+	)
+	flags.StringVar(
+		&podLogs.LabelSelector, "pod-log-selector", "",
+		"A label selector for the pods whose logs are collected, in place of the config's label selector.",
+	)
+	flags.StringVar(
+		&podLogs.Since, "pod-log-since", "",
+		"How far back to collect pod logs from, such as \"1h\".",
+	)
+	flags.StringVar(
+		&podLogs.LimitSize, "pod-log-limit", "",
+		"The most logs to collect from each container, such as \"10 MB\".",
+	)
+}
+
+// NamespaceFilterFlags are the flags selecting which namespaces are queried
+// for namespaced resources.
+type NamespaceFilterFlags struct {
+	Include  []string
+	Exclude  []string
+	Selector string
+}
+
+// Apply sets the flags which were given on cfg, leaving the rest as they are.
+func (f *NamespaceFilterFlags) Apply(cfg *config.Config) {
+	if len(f.Include) > 0 {
+		cfg.Filters.IncludeNamespaces = f.Include
+	}
+	if len(f.Exclude) > 0 {
+		cfg.Filters.ExcludeNamespaces = f.Exclude
+	}
+	if f.Selector != "" {
+		cfg.Filters.NamespaceLabelSelector = f.Selector
+	}
+}
+
+func AddNamespaceFilterFlags(filters *NamespaceFilterFlags, flags *pflag.FlagSet) {
+	flags.StringSliceVar(
+		&filters.Include, "include-namespaces", nil,
+		"The only namespaces whose resources are collected, besides Sonobuoy's own. Can be given more than once.",
+	)
+	flags.StringSliceVar(
+		&filters.Exclude, "exclude-namespaces", nil,
+		"Namespaces whose resources aren't collected. Can be given more than once.",
+	)
+	flags.StringVar(
+		&filters.Selector, "namespace-selector", "",
+		"A label selector for the namespaces whose resources are collected.",
+	)
+}
+
+func AddPluginFlag(plugins *[]string, flags *pflag.FlagSet) {
+	flags.StringSliceVar(
+		plugins, "plugin", nil,
+		"The plugins to run, such as \"e2e\", \"systemd-logs\", \"node-diagnostics\", \"kube-bench\" or \"network-connectivity\", in place of those the mode or config selects. "+
+			"Plugin definitions can also be read from a .yaml file, or fetched from an https:// URL or an oci:// artifact, optionally pinned with #sha256=<checksum>. Can be given more than once.",
+	)
+}
+
+// AddPluginValuesFlag adds a flag for the values plugin definition templates
+// are rendered with.
+func AddPluginValuesFlag(files *[]string, flags *pflag.FlagSet) {
+	flags.StringSliceVar(
+		files, "plugin-values", nil,
+		"A YAML file of values to render the plugin definitions given with --plugin as Go templates with, such as {{ .Values.image.tag }}. "+
+			"Can be given more than once; values in later files override those in earlier ones.",
+	)
+}
+
+// AddPluginCacheFlag adds a flag for the directory fetched plugin definitions are cached in.
+func AddPluginCacheFlag(dir *string, flags *pflag.FlagSet) {
+	flags.StringVar(
+		dir, "plugin-cache", filepath.Join(os.Getenv("HOME"), ".sonobuoy", "plugins"),
+		"The directory plugin definitions fetched with --plugin are cached in.",
+	)
+}
+
+// AddImageMappingFlag adds a flag for a file mapping the images a run uses to others.
+func AddImageMappingFlag(path *string, flags *pflag.FlagSet) {
+	flags.StringVar(
+		path, "image-mapping", "",
+		"A file mapping the images Sonobuoy uses to the ones to use instead, such as the one written by 'sonobuoy images push'.",
+	)
+}
+
+// AddDryRunFlag adds a boolean flag for validating a run without creating anything.
+func AddDryRunFlag(flag *bool, flags *pflag.FlagSet) {
+	flags.BoolVar(
+		flag, "dry-run", false,
+		"Validate the run's objects with the API server without creating them, and print the manifest.",
+	)
+}
+
+// ResourceFlags are the flags setting the resources, scheduling and metadata
+// of the aggregator's and workers' pods.
+type ResourceFlags struct {
+	AggregatorRequests []string
+	AggregatorLimits   []string
+	WorkerRequests     []string
+	WorkerLimits       []string
+	PriorityClass      string
+	RuntimeClass       string
+	// Labels and Annotations are set on every object Sonobuoy creates.
+	Labels      []string
+	Annotations []string
+	// SecurityContextMode is which security contexts the pods are given.
+	SecurityContextMode string
+}
+
+// Apply sets the flags which were given on cfg, leaving the rest as they are.
+// It returns an error if a resource isn't given as name=quantity, or a label
+// or annotation as key=value.
+func (f *ResourceFlags) Apply(cfg *config.Config) error {
+	for _, r := range []struct {
+		flag     string
+		values   []string
+		dest     *map[string]string
+		expected string
+	}{
+		{"aggregator-requests", f.AggregatorRequests, &cfg.AggregatorResources.Requests, "name=quantity"},
+		{"aggregator-limits", f.AggregatorLimits, &cfg.AggregatorResources.Limits, "name=quantity"},
+		{"worker-requests", f.WorkerRequests, &cfg.WorkerResources.Requests, "name=quantity"},
+		{"worker-limits", f.WorkerLimits, &cfg.WorkerResources.Limits, "name=quantity"},
+		{"label", f.Labels, &cfg.Labels, "key=value"},
+		{"annotation", f.Annotations, &cfg.Annotations, "key=value"},
+	} {
+		if len(r.values) == 0 {
+			continue
+		}
+		parsed := make(map[string]string, len(r.values))
+		for _, value := range r.values {
+			parts := strings.SplitN(value, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return errors.Errorf("invalid --%v %q, expected %v", r.flag, value, r.expected)
+			}
+			parsed[parts[0]] = parts[1]
+		}
+		*r.dest = parsed
+	}
+	if f.PriorityClass != "" {
+		cfg.PriorityClassName = f.PriorityClass
+	}
+	if f.RuntimeClass != "" {
+		cfg.RuntimeClassName = f.RuntimeClass
+	}
+	if f.SecurityContextMode != "" {
+		cfg.SecurityContextMode = f.SecurityContextMode
+	}
+	return nil
+}
+
+// AddResourceFlags adds the flags for the resources, scheduling and metadata of
+// the aggregator's and workers' pods.
+func AddResourceFlags(resources *ResourceFlags, flags *pflag.FlagSet) {
+	flags.StringSliceVar(
+		&resources.AggregatorRequests, "aggregator-requests", nil,
+		"The resource requests of the aggregator, as name=quantity (such as cpu=100m,memory=128Mi).",
+	)
+	flags.StringSliceVar(
+		&resources.AggregatorLimits, "aggregator-limits", nil,
+		"The resource limits of the aggregator, as name=quantity (such as cpu=500m,memory=512Mi).",
+	)
+	flags.StringSliceVar(
+		&resources.WorkerRequests, "worker-requests", nil,
+		"The resource requests of the worker container in every plugin pod, as name=quantity.",
+	)
+	flags.StringSliceVar(
+		&resources.WorkerLimits, "worker-limits", nil,
+		"The resource limits of the worker container in every plugin pod, as name=quantity.",
+	)
+	flags.StringVar(
+		&resources.PriorityClass, "priority-class", "",
+		"The name of the priority class of the aggregator's and every plugin's pods.",
+	)
+	flags.StringVar(
+		&resources.RuntimeClass, "runtime-class", "",
+		"The name of the runtime class of the aggregator's pod.",
+	)
+	flags.StringArrayVar(
+		&resources.Labels, "label", nil,
+		"A label to set on every object Sonobuoy creates, including its namespace and every plugin's pods, as key=value. Can be given more than once.",
+	)
+	flags.StringArrayVar(
+		&resources.Annotations, "annotation", nil,
+		"An annotation to set on every object Sonobuoy creates, including its namespace and every plugin's pods, as key=value. Can be given more than once.",
+	)
+	flags.StringVar(
+		&resources.SecurityContextMode, "security-context-mode", "",
+		"The security contexts of the aggregator's and every plugin's pods: none, restricted to pass the restricted PodSecurity profile, "+
+			"or privileged to also run node-level plugins privileged in a namespace labeled to allow them.",
+	)
+}
+
+// AdvertiseFlags are the flags setting how workers reach the aggregator.
+type AdvertiseFlags struct {
+	Address string
+	Family  string
+	Service bool
+}
+
+// Apply sets the flags which were given on cfg, leaving the rest as they are.
+func (f *AdvertiseFlags) Apply(cfg *config.Config) {
+	if f.Address != "" {
+		cfg.Aggregation.AdvertiseAddress = f.Address
+	}
+	if f.Family != "" {
+		cfg.Aggregation.AddressFamily = f.Family
+	}
+	if f.Service {
+		cfg.Aggregation.AdvertiseService = plugin.AggregatorService
+	}
+}
+
+// AddAdvertiseFlags adds the flags for how workers reach the aggregator.
+func AddAdvertiseFlags(advertise *AdvertiseFlags, flags *pflag.FlagSet) {
+	flags.StringVar(
+		&advertise.Address, "advertise-address", "",
+		"The host or IP, and port, workers reach the aggregator at, such as a Service or node address for clusters where pods can't reach each other's IPs. "+
+			"IPv6 literals are bracketed, as in [fd00::1]:8080. Defaults to the aggregator pod's IP.",
+	)
+	flags.StringVar(
+		&advertise.Family, "address-family", "",
+		fmt.Sprintf("Which of a dual-stack aggregator pod's IPs workers reach it at, %v or %v. Defaults to the pod's primary IP.", plugin.IPv4Family, plugin.IPv6Family),
+	)
+	flags.BoolVar(
+		&advertise.Service, "advertise-service", false,
+		fmt.Sprintf("Have workers reach the aggregator through the %v Service's DNS name rather than its pod's IP, so they can still reach it if its pod is restarted. "+
+			"Plugins are launched once the Service has a ready endpoint.", plugin.AggregatorService),
+	)
+}
+
+// AddCertManagerIssuerFlag adds a flag for the cert-manager issuer of the aggregator's serving certificate.
+func AddCertManagerIssuerFlag(issuer *string, flags *pflag.FlagSet) {
+	flags.StringVar(
+		issuer, "cert-manager-issuer", "",
+		"Request the aggregator's serving certificate from this cert-manager issuer, given as Issuer/name, ClusterIssuer/name or the name of an Issuer in the namespace, "+
+			"instead of having the aggregator issue its own.",
+	)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+
+	ops "github.com/heptio/sonobuoy/pkg/client"
+)
+
+func TestGetE2EConfig(t *testing.T) {
+	testCases := []struct {
+		name             string
+		mode             ops.Mode
+		args             []string
+		expectedFocus    string
+		expectedSkip     string
+		expectedParallel int
+		expectErr        bool
+	}{
+		{
+			name:          "mode",
+			mode:          ops.CertifiedConformance,
+			expectedFocus: `\[Conformance\]`,
+			expectedSkip:  "",
+		},
+		{
+			name:          "flags override mode",
+			mode:          ops.NonDisruptive,
+			args:          []string{"--e2e-focus", "foo", "--e2e-skip", "bar"},
+			expectedFocus: "foo",
+			expectedSkip:  "bar",
+		},
+		{
+			name:          "provider adds to mode",
+			mode:          ops.NonDisruptive,
+			args:          []string{"--e2e-provider", "GKE"},
+			expectedFocus: `\[Conformance\]`,
+			expectedSkip:  `\[Disruptive\]|NoExecuteTaintManager|SSH|\[sig-cluster-lifecycle\]`,
+		},
+		{
+			name:          "provider without skips",
+			mode:          ops.CertifiedConformance,
+			args:          []string{"--e2e-provider", "gke"},
+			expectedFocus: `\[Conformance\]`,
+			expectedSkip:  `SSH|\[sig-cluster-lifecycle\]`,
+		},
+		{
+			name:             "parallel",
+			mode:             ops.NonDisruptive,
+			args:             []string{"--e2e-parallel", "8"},
+			expectedFocus:    `\[Conformance\]`,
+			expectedSkip:     `\[Disruptive\]|NoExecuteTaintManager`,
+			expectedParallel: 8,
+		},
+		{
+			name:      "parallel certified conformance",
+			mode:      ops.CertifiedConformance,
+			args:      []string{"--e2e-parallel", "8"},
+			expectErr: true,
+		},
+		{
+			name:      "negative parallel",
+			mode:      ops.Conformance,
+			args:      []string{"--e2e-parallel", "-1"},
+			expectErr: true,
+		},
+		{
+			name:      "missing repo list",
+			mode:      ops.Conformance,
+			args:      []string{"--e2e-repo-list", "testdata/does-not-exist.yaml"},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			e2eflags := AddE2EConfigFlags(flags)
+			if err := flags.Parse(tc.args); err != nil {
+				t.Fatalf("couldn't parse flags: %v", err)
+			}
+
+			cfg, err := GetE2EConfig(tc.mode, e2eflags)
+			if tc.expectErr {
+				if err == nil {
+					t.Error("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.Focus != tc.expectedFocus {
+				t.Errorf("expected focus %q, got %q", tc.expectedFocus, cfg.Focus)
+			}
+			if cfg.Skip != tc.expectedSkip {
+				t.Errorf("expected skip %q, got %q", tc.expectedSkip, cfg.Skip)
+			}
+			if cfg.Parallel != tc.expectedParallel {
+				t.Errorf("expected parallel %d, got %d", tc.expectedParallel, cfg.Parallel)
+			}
+		})
+	}
+}
+
+func TestModeFlag(t *testing.T) {
+	var mode ops.Mode
+	if err := mode.Set("certified-conformance"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mode != ops.CertifiedConformance {
+		t.Errorf("expected mode %v, got %v", ops.CertifiedConformance, mode)
+	}
+	if err := mode.Set("non-disruptive"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mode != ops.NonDisruptive {
+		t.Errorf("expected mode %v, got %v", ops.NonDisruptive, mode)
+	}
+
+	var provider ops.Provider
+	if err := provider.Set("openshift"); err == nil {
+		t.Error("expected an error for an unknown provider")
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/heptio/sonobuoy/pkg/encryption"
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var decryptKeyFile string
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "decrypt encrypted.tar.gz [archive.tar.gz]",
+		Short: "Decrypts an encrypted results tarball, writing it to a path or stdout",
+		Run:   decryptResults,
+		Args:  cobra.RangeArgs(1, 2),
+	}
+	cmd.Flags().StringVar(
+		&decryptKeyFile, "key-file", "",
+		"A file holding the base64 encoded key the results were encrypted with. Not needed for results encrypted with a KMS key, which is used with the application default credentials.",
+	)
+	RootCmd.AddCommand(cmd)
+}
+
+func decryptResults(cmd *cobra.Command, args []string) {
+	if err := decrypt(args); err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+}
+
+func decrypt(args []string) error {
+	var key []byte
+	if decryptKeyFile != "" {
+		encoded, err := ioutil.ReadFile(decryptKeyFile)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't read key file %v", decryptKeyFile)
+		}
+		if key, err = encryption.ParseKey(string(encoded)); err != nil {
+			return errors.Wrapf(err, "invalid key in %v", decryptKeyFile)
+		}
+	}
+
+	in, err := os.Open(args[0])
+	if err != nil {
+		return errors.Wrapf(err, "couldn't open %v", args[0])
+	}
+	defer in.Close()
+
+	if len(args) == 1 {
+		return encryption.Decrypt(os.Stdout, in, key)
+	}
+
+	// Decrypt to a temporary file, so a tarball that fails to authenticate
+	// part way through isn't left behind.
+	partial := args[1] + ".partial"
+	out, err := os.Create(partial)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't create %v", partial)
+	}
+	err = encryption.Decrypt(out, in, key)
+	if closeErr := out.Close(); err == nil {
+		err = errors.WithStack(closeErr)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return errors.WithStack(os.Rename(partial, args[1]))
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package app
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 
 	"github.com/heptio/sonobuoy/pkg/client"
@@ -30,6 +32,7 @@ var deleteopts client.DeleteConfig
 var deleteFlags struct {
 	kubeconfig Kubeconfig
 	rbacMode   RBACMode
+	json       bool
 }
 
 func init() {
@@ -44,6 +47,18 @@ func init() {
 	AddNamespaceFlag(&deleteopts.Namespace, cmd.Flags())
 	AddRBACModeFlags(&deleteFlags.rbacMode, cmd.Flags(), DetectRBACMode)
 	AddDeleteAllFlag(&deleteopts.DeleteAll, cmd.Flags())
+	cmd.Flags().BoolVar(
+		&deleteopts.NamespaceScoped, "namespace-scoped", false,
+		"If true, delete the resources of a namespace-scoped run, leaving the namespace in place.",
+	)
+	cmd.Flags().BoolVar(
+		&deleteopts.Wait, "wait", false,
+		"If true, wait until everything deleted is gone, reporting the finalizers of anything stuck deleting.",
+	)
+	cmd.Flags().BoolVar(
+		&deleteFlags.json, "json", false,
+		"If true, print what was deleted as JSON.",
+	)
 
 	RootCmd.AddCommand(cmd)
 }
@@ -74,9 +89,23 @@ func deleteSonobuoyRun(cmd *cobra.Command, args []string) {
 	}
 	deleteopts.EnableRBAC = rbacEnabled
 
-	if err := sbc.Delete(&deleteopts); err != nil {
+	deleted, err := sbc.Delete(&deleteopts)
+	if err != nil {
 		errlog.LogError(errors.Wrap(err, "failed to delete sonobuoy resources"))
 		os.Exit(1)
 	}
 
+	if deleteFlags.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(deleted); err != nil {
+			errlog.LogError(errors.Wrap(err, "couldn't encode deleted resources"))
+			os.Exit(1)
+		}
+		return
+	}
+	for _, r := range deleted {
+		fmt.Println(r)
+	}
+
 }
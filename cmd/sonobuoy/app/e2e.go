@@ -98,14 +98,24 @@ func e2es(cmd *cobra.Command, args []string) {
 		return
 	}
 
+	if len(testCases) == 0 {
+		fmt.Println("No failed tests to rerun")
+		return
+	}
+
 	cfg, err := e2eflags.Config()
 	if err != nil {
 		errlog.LogError(errors.Wrap(err, "couldn't make a Run config"))
 		os.Exit(1)
 	}
+	// Focus on exactly the failed tests, whatever the mode or flags said.
+	cfg.E2EConfig.Focus = client.Focus(testCases)
 
 	if !e2eflags.skipPreflight {
-		if errs := sonobuoy.PreflightChecks(&client.PreflightConfig{e2eflags.namespace}); len(errs) > 0 {
+		if errs := sonobuoy.PreflightChecks(&client.PreflightConfig{
+			Namespace:       e2eflags.namespace,
+			NamespaceScoped: e2eflags.namespaceScoped,
+		}); len(errs) > 0 {
 			errlog.LogError(errors.New("Preflight checks failed"))
 			for _, err := range errs {
 				errlog.LogError(err)
@@ -115,6 +125,7 @@ func e2es(cmd *cobra.Command, args []string) {
 	}
 
 	fmt.Printf("Rerunning %d tests:\n", len(testCases))
+	fmt.Println(client.PrintableTestCases(testCases))
 	if err := sonobuoy.Run(cfg); err != nil {
 		errlog.LogError(errors.Wrap(err, "error attempting to rerun failed tests"))
 		os.Exit(1)
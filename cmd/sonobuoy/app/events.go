@@ -0,0 +1,128 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	ops "github.com/heptio/sonobuoy/pkg/client"
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+)
+
+var eventsFlags struct {
+	namespace string
+	kubecfg   Kubeconfig
+	follow    bool
+	json      bool
+	port      int
+	since     int64
+}
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Prints what has happened in a sonobuoy run, such as plugins starting and results being received",
+		Run:   getEvents,
+		Args:  cobra.ExactArgs(0),
+	}
+	flags := cmd.Flags()
+
+	AddNamespaceFlag(&eventsFlags.namespace, flags)
+	AddKubeconfigFlag(&eventsFlags.kubecfg, flags)
+	flags.BoolVarP(
+		&eventsFlags.follow, "follow", "f", false,
+		fmt.Sprintf("Keep printing events as they happen until the run is complete. Exits with %d if the run failed.", failedRunExitCode),
+	)
+	flags.BoolVar(
+		&eventsFlags.json, "json", false,
+		"Print each event as a line of JSON",
+	)
+	flags.IntVar(
+		&eventsFlags.port, "port", config.New().Aggregation.MetricsPort,
+		"The aggregator's metrics port, which events are served on",
+	)
+	flags.Int64Var(
+		&eventsFlags.since, "since", 0,
+		"Only print the events after the one with this ID",
+	)
+
+	RootCmd.AddCommand(cmd)
+}
+
+func getEvents(cmd *cobra.Command, args []string) {
+	config, err := eventsFlags.kubecfg.Get()
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "couldn't get kubernetes config"))
+		os.Exit(1)
+	}
+	sbc, err := ops.NewSonobuoyClient(config)
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "could not create sonobuoy client"))
+		os.Exit(1)
+	}
+
+	runStatus := ""
+	err = sbc.StreamEvents(&ops.EventsConfig{
+		Namespace: eventsFlags.namespace,
+		Port:      eventsFlags.port,
+		Follow:    eventsFlags.follow,
+		Since:     eventsFlags.since,
+	}, func(event aggregation.Event) error {
+		if event.Type == aggregation.EventRunComplete {
+			runStatus = event.Status
+		}
+		if eventsFlags.json {
+			return json.NewEncoder(os.Stdout).Encode(event)
+		}
+		printEvent(os.Stdout, event)
+		return nil
+	})
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "couldn't get events"))
+		os.Exit(1)
+	}
+	if eventsFlags.follow && runStatus != "" && runStatus != aggregation.CompleteStatus {
+		os.Exit(failedRunExitCode)
+	}
+}
+
+// printEvent writes an event as a line for people to read.
+func printEvent(w io.Writer, event aggregation.Event) {
+	line := fmt.Sprintf("%v  %-15v", event.Time.Local().Format(time.RFC3339), event.Type)
+	switch {
+	case event.Plugin != "" && event.Node != "":
+		line += fmt.Sprintf("  %v on %v", event.Plugin, event.Node)
+	case event.Plugin != "":
+		line += "  " + event.Plugin
+	}
+	if event.Status != "" {
+		line += "  " + event.Status
+	}
+	if event.Error != "" {
+		line += ": " + event.Error
+	}
+	fmt.Fprintln(w, line)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+)
+
+func TestPrintEvent(t *testing.T) {
+	now := time.Now()
+	stamp := now.Local().Format(time.RFC3339)
+	tests := []struct {
+		event    aggregation.Event
+		expected string
+	}{
+		{
+			event:    aggregation.Event{Type: aggregation.EventPluginStarted, Time: now, Plugin: "e2e"},
+			expected: stamp + "  plugin-started   e2e\n",
+		},
+		{
+			event:    aggregation.Event{Type: aggregation.EventPluginFailed, Time: now, Plugin: "systemd_logs", Node: "node1", Error: "boom"},
+			expected: stamp + "  plugin-failed    systemd_logs on node1: boom\n",
+		},
+		{
+			event:    aggregation.Event{Type: aggregation.EventRunComplete, Time: now, Status: aggregation.CompleteStatus},
+			expected: stamp + "  run-complete     complete\n",
+		},
+	}
+
+	for _, test := range tests {
+		var b bytes.Buffer
+		printEvent(&b, test.event)
+		if b.String() != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, b.String())
+		}
+		if strings.Count(b.String(), "\n") != 1 {
+			t.Errorf("expected one line per event, got %q", b.String())
+		}
+	}
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/rest"
+
+	ops "github.com/heptio/sonobuoy/pkg/client"
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+)
+
+// getFleet creates a client for the cluster of each of the kubeconfig's
+// contexts.
+func getFleet(kubecfg *Kubeconfig, contexts []string) (ops.Fleet, error) {
+	restConfigs := map[string]*rest.Config{}
+	for _, context := range contexts {
+		restConfig, err := kubecfg.ForContext(context).Get()
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't get REST client for context %v", context)
+		}
+		restConfigs[context] = restConfig
+	}
+	return ops.NewFleet(restConfigs)
+}
+
+// submitFleetRun runs Sonobuoy on the cluster of each of the contexts at once,
+// as submitSonobuoyRun does on one. The RBAC mode is detected on the first.
+func submitFleetRun(contexts []string) {
+	fleet, err := getFleet(&runflags.kubecfg, contexts)
+	if err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+	runflags.kubecfg.Context = contexts[0]
+
+	if !runflags.skipPreflight {
+		failed := false
+		for _, name := range fleet.Clusters() {
+			for _, err := range fleet[name].PreflightChecks(&ops.PreflightConfig{
+				Namespace:       runflags.runNamespace(),
+				NamespaceScoped: runflags.namespaceScoped,
+			}) {
+				errlog.LogError(errors.Wrapf(err, "preflight check failed on %v", name))
+				failed = true
+			}
+		}
+		if failed {
+			errlog.LogError(errors.New("Preflight checks failed"))
+			os.Exit(1)
+		}
+	}
+
+	if !runflags.wait {
+		cfg, err := runflags.Config()
+		if err != nil {
+			errlog.LogError(errors.Wrap(err, "could not retrieve E2E config"))
+			os.Exit(1)
+		}
+		failed := false
+		for _, result := range fleet.Run(cfg) {
+			if result.Err != nil {
+				errlog.LogError(errors.Wrapf(result.Err, "error attempting to run sonobuoy on %v", result.Cluster))
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	completionCfg, err := runflags.RunToCompletionConfig()
+	if err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+	run, err := fleet.RunToCompletion(completionCfg)
+	if run != nil {
+		if printErr := printFleetRun(os.Stdout, run); printErr != nil {
+			errlog.LogError(printErr)
+		}
+	}
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "error attempting to run sonobuoy"))
+		os.Exit(1)
+	}
+	if run.Failed() {
+		os.Exit(failedRunExitCode)
+	}
+}
+
+// printFleetRun prints the outcome of the run on each cluster of a fleet, and
+// where their results were retrieved to if they were.
+func printFleetRun(w io.Writer, run *ops.FleetRun) error {
+	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "CLUSTER\tSTATUS\tTESTS\tFAILURES\tERROR\n")
+	for _, result := range run.Clusters {
+		status, tests, failures, errMsg := "", "", "", ""
+		if result.Status != nil {
+			status = result.Status.Status
+		}
+		if result.Run != nil && len(result.Run.Counts) > 0 {
+			total, failed := 0, 0
+			for _, suite := range result.Run.Counts {
+				total += suite.Tests
+				failed += suite.Failures
+			}
+			tests, failures = fmt.Sprintf("%d", total), fmt.Sprintf("%d", failed)
+		}
+		if result.Err != nil {
+			errMsg = result.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", result.Cluster, status, tests, failures, errMsg)
+	}
+	if err := tw.Flush(); err != nil {
+		return errors.Wrap(err, "couldn't write fleet summary")
+	}
+
+	if run.Tarball != "" {
+		fmt.Fprintf(w, "\nResults of every cluster retrieved to %v and extracted into %v\n", run.Tarball, run.ResultsDir)
+	}
+	return nil
+}
+
+// getFleetStatus gets or waits for the status of the run on the cluster of
+// each of the contexts, as getStatus does for one.
+func getFleetStatus(contexts []string) {
+	if statusFlags.showAll || statusFlags.format != statusFormatSummary {
+		errlog.LogError(errors.New("--show-all and --format can't be used with --contexts"))
+		os.Exit(1)
+	}
+	fleet, err := getFleet(&statusFlags.kubecfg, contexts)
+	if err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+
+	var results []ops.ClusterResult
+	if statusFlags.wait {
+		results = fleet.WaitForRun(&ops.WaitConfig{
+			Namespace: statusFlags.namespace,
+			Interval:  statusFlags.interval,
+			Timeout:   statusFlags.timeout,
+		})
+	} else {
+		results = fleet.GetStatus(statusFlags.namespace)
+	}
+
+	if statusFlags.json {
+		err = printFleetJSON(os.Stdout, results)
+	} else {
+		err = printFleetStatus(os.Stdout, results)
+	}
+	if err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			os.Exit(1)
+		}
+	}
+	if statusFlags.wait && ops.FleetStatus(results) == aggregation.FailedStatus {
+		os.Exit(failedRunExitCode)
+	}
+}
+
+// printFleetStatus prints the status of the run on each cluster of a fleet,
+// then what they sum up to.
+func printFleetStatus(w io.Writer, results []ops.ClusterResult) error {
+	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "CLUSTER\tSTATUS\tERROR\n")
+	for _, result := range results {
+		status, errMsg := "", ""
+		if result.Status != nil {
+			status = result.Status.Status
+		}
+		if result.Err != nil {
+			errMsg = result.Err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Cluster, status, errMsg)
+	}
+	if err := tw.Flush(); err != nil {
+		return errors.Wrap(err, "couldn't write status out")
+	}
+
+	fmt.Fprintf(w, "\n%s\n", humanReadableStatus(ops.FleetStatus(results)))
+	return nil
+}
+
+// fleetJSONStatus is the status of one cluster printed by --json.
+type fleetJSONStatus struct {
+	*jsonStatus
+	Error string `json:"error,omitempty"`
+}
+
+// printFleetJSON prints the full status of the run on each cluster of a fleet,
+// by cluster.
+func printFleetJSON(w io.Writer, results []ops.ClusterResult) error {
+	out := map[string]fleetJSONStatus{}
+	for _, result := range results {
+		var status fleetJSONStatus
+		if result.Status != nil {
+			status.jsonStatus = &jsonStatus{Status: result.Status, Nodes: result.Status.NodeBreakdown()}
+		}
+		if result.Err != nil {
+			status.Error = result.Err.Error()
+		}
+		out[result.Cluster] = status
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return errors.Wrap(encoder.Encode(out), "couldn't write status out")
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	ops "github.com/heptio/sonobuoy/pkg/client"
+	"github.com/heptio/sonobuoy/pkg/client/results"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+)
+
+var expectedFleetStatus = `CLUSTER		STATUS		ERROR
+prod-east	complete	
+prod-west	running		
+staging				unreachable
+
+Sonobuoy has failed. You can see what happened with ` + "`sonobuoy logs`" + `.
+`
+
+var expectedFleetRun = `CLUSTER		STATUS		TESTS	FAILURES	ERROR
+prod-east	complete	10	0		
+prod-west	failed		4	1		
+staging							unreachable
+
+Results of every cluster retrieved to results/fleet.tar.gz and extracted into results/fleet
+`
+
+func TestPrintFleetStatus(t *testing.T) {
+	statuses := []ops.ClusterResult{
+		{Cluster: "prod-east", Status: &aggregation.Status{Status: aggregation.CompleteStatus}},
+		{Cluster: "prod-west", Status: &aggregation.Status{Status: aggregation.RunningStatus}},
+		{Cluster: "staging", Err: errors.New("unreachable")},
+	}
+	var b bytes.Buffer
+	if err := printFleetStatus(&b, statuses); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.String() != expectedFleetStatus {
+		t.Errorf("expected:\n%s\ngot:\n%s", expectedFleetStatus, b.String())
+	}
+}
+
+func TestPrintFleetRun(t *testing.T) {
+	run := &ops.FleetRun{
+		Clusters: []ops.ClusterResult{
+			{
+				Cluster: "prod-east",
+				Status:  &aggregation.Status{Status: aggregation.CompleteStatus},
+				Run: &ops.CompletedRun{Counts: []results.SuiteCounts{
+					{Name: "e2e", Tests: 8}, {Name: "systemd_logs", Tests: 2},
+				}},
+			}, {
+				Cluster: "prod-west",
+				Status:  &aggregation.Status{Status: aggregation.FailedStatus},
+				Run:     &ops.CompletedRun{Counts: []results.SuiteCounts{{Name: "e2e", Tests: 4, Failures: 1}}},
+			}, {
+				Cluster: "staging",
+				Err:     errors.New("unreachable"),
+			},
+		},
+		Tarball:    "results/fleet.tar.gz",
+		ResultsDir: "results/fleet",
+	}
+	var b bytes.Buffer
+	if err := printFleetRun(&b, run); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.String() != expectedFleetRun {
+		t.Errorf("expected:\n%s\ngot:\n%s", expectedFleetRun, b.String())
+	}
+}
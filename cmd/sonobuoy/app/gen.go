@@ -18,30 +18,75 @@ package app
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 
 	"github.com/heptio/sonobuoy/pkg/client"
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/encryption"
 	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/image"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/loader"
+	"github.com/heptio/sonobuoy/pkg/plugin/remote"
 )
 
 type genFlags struct {
-	sonobuoyConfig  SonobuoyConfig
-	mode            client.Mode
-	rbacMode        RBACMode
-	kubecfg         Kubeconfig
-	e2eflags        *pflag.FlagSet
-	namespace       string
-	sonobuoyImage   string
-	imagePullPolicy ImagePullPolicy
+	sonobuoyConfig     SonobuoyConfig
+	mode               client.Mode
+	rbacMode           RBACMode
+	kubecfg            Kubeconfig
+	e2eflags           *pflag.FlagSet
+	namespace          string
+	sonobuoyImage      string
+	imagePullPolicy    ImagePullPolicy
+	pullSecrets        []string
+	schedule           string
+	keepResults        int
+	volumeSize         string
+	resultsRetention   config.SizeOrTimeLimitConfig
+	resultsEncryption  encryption.Config
+	storageSecret      string
+	imageMapping       string
+	podLogs            PodLogFlags
+	namespaceFilters   NamespaceFilterFlags
+	resources          ResourceFlags
+	advertise          AdvertiseFlags
+	plugins            []string
+	pluginCache        string
+	pluginValues       []string
+	certManagerIssuer  string
+	namespaceScoped    bool
+	deleteOnCompletion bool
+	allowMixedVersions bool
+	// flags are the flags above, whose changed values are recorded in the
+	// run's provenance.
+	flags *pflag.FlagSet
 }
 
 var genflags genFlags
 
+// Formats gen can write what it generates in.
+const (
+	yamlFormat      = "yaml"
+	kustomizeFormat = "kustomize"
+	helmFormat      = "helm"
+)
+
+// genOutput is how gen writes what it generates: as a single manifest on
+// stdout, or as a Kustomize base or Helm chart in a directory.
+var genOutput struct {
+	format string
+	dir    string
+}
+
 func GenFlagSet(cfg *genFlags, rbac RBACMode) *pflag.FlagSet {
 	genset := pflag.NewFlagSet("generate", pflag.ExitOnError)
 	AddModeFlag(&cfg.mode, genset)
@@ -50,10 +95,28 @@ func GenFlagSet(cfg *genFlags, rbac RBACMode) *pflag.FlagSet {
 	cfg.e2eflags = AddE2EConfigFlags(genset)
 	AddRBACModeFlags(&cfg.rbacMode, genset, rbac)
 	AddImagePullPolicyFlag(&cfg.imagePullPolicy, genset)
+	AddImagePullSecretsFlag(&cfg.pullSecrets, genset)
 
 	AddNamespaceFlag(&cfg.namespace, genset)
+	AddNamespaceScopedFlag(&cfg.namespaceScoped, genset)
 	AddSonobuoyImage(&cfg.sonobuoyImage, genset)
+	AddScheduleFlags(&cfg.schedule, &cfg.keepResults, &cfg.volumeSize, genset)
+	AddResultsRetentionFlags(&cfg.resultsRetention, genset)
+	AddResultsEncryptionFlags(&cfg.resultsEncryption, genset)
+	AddDeleteOnCompletionFlag(&cfg.deleteOnCompletion, genset)
+	AddStorageSecretFlag(&cfg.storageSecret, genset)
+	AddImageMappingFlag(&cfg.imageMapping, genset)
+	AddPodLogFlags(&cfg.podLogs, genset)
+	AddNamespaceFilterFlags(&cfg.namespaceFilters, genset)
+	AddResourceFlags(&cfg.resources, genset)
+	AddAdvertiseFlags(&cfg.advertise, genset)
+	AddPluginFlag(&cfg.plugins, genset)
+	AddPluginCacheFlag(&cfg.pluginCache, genset)
+	AddPluginValuesFlag(&cfg.pluginValues, genset)
+	AddCertManagerIssuerFlag(&cfg.certManagerIssuer, genset)
+	AddAllowMixedVersionsFlag(&cfg.allowMixedVersions, genset)
 
+	cfg.flags = genset
 	return genset
 }
 
@@ -63,16 +126,164 @@ func (g *genFlags) Config() (*client.GenConfig, error) {
 		return nil, errors.Wrap(err, "could not retrieve E2E config")
 	}
 
+	var mapping image.Mapping
+	if g.imageMapping != "" {
+		if mapping, err = image.LoadMapping(g.imageMapping); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg := GetConfigWithMode(&g.sonobuoyConfig, g.mode)
+	g.podLogs.Apply(cfg)
+	g.namespaceFilters.Apply(cfg)
+	if err := g.resources.Apply(cfg); err != nil {
+		return nil, err
+	}
+	g.advertise.Apply(cfg)
+	if g.namespaceScoped {
+		cfg.NamespaceScoped = true
+	}
+	if g.resultsRetention.LimitTime != "" {
+		cfg.ResultsRetention.LimitTime = g.resultsRetention.LimitTime
+	}
+	if g.resultsRetention.LimitSize != "" {
+		cfg.ResultsRetention.LimitSize = g.resultsRetention.LimitSize
+	}
+	if g.resultsEncryption.Enabled() {
+		cfg.Encryption = g.resultsEncryption
+	}
+	if g.deleteOnCompletion {
+		if g.schedule != "" {
+			return nil, errors.New("recurring runs can't be deleted on completion")
+		}
+		cfg.DeleteOnCompletion = true
+	}
+	if g.allowMixedVersions {
+		cfg.Aggregation.AllowMixedVersions = true
+	}
+	cfg.Provenance = config.NewProvenance(g.changedFlags())
+	customPlugins, err := g.customPlugins(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if errs := cfg.Validate(); len(errs) > 0 {
+		return nil, errors.Errorf("invalid configuration: %v", errs)
+	}
+
+	// A supplied config's images are used unless the flags are changed from
+	// their defaults.
+	sonobuoyImage, pullPolicy := g.sonobuoyImage, g.imagePullPolicy.String()
+	if g.sonobuoyConfig.Get() != nil {
+		if sonobuoyImage == config.DefaultImage && cfg.WorkerImage != "" {
+			sonobuoyImage = cfg.WorkerImage
+		}
+		if pullPolicy == string(v1.PullAlways) && cfg.ImagePullPolicy != "" {
+			pullPolicy = cfg.ImagePullPolicy
+		}
+	}
+
 	return &client.GenConfig{
-		E2EConfig:       e2ecfg,
-		Config:          GetConfigWithMode(&g.sonobuoyConfig, g.mode),
-		Image:           g.sonobuoyImage,
-		Namespace:       g.namespace,
-		EnableRBAC:      getRBACOrExit(&g.rbacMode, &g.kubecfg),
-		ImagePullPolicy: g.imagePullPolicy.String(),
+		E2EConfig:         e2ecfg,
+		Config:            cfg,
+		Image:             sonobuoyImage,
+		Namespace:         g.runNamespace(),
+		EnableRBAC:        getRBACOrExit(&g.rbacMode, &g.kubecfg),
+		ImagePullPolicy:   pullPolicy,
+		ImagePullSecrets:  g.pullSecrets,
+		Schedule:          g.schedule,
+		KeepResults:       g.keepResults,
+		ResultsVolumeSize: g.volumeSize,
+		StorageSecret:     g.storageSecret,
+		ImageMapping:      mapping,
+		CustomPlugins:     customPlugins,
+		CertManagerIssuer: g.certManagerIssuer,
 	}, nil
 }
 
+// customPlugins selects the plugins given with --plugin, returning the
+// definitions of those given as files or URLs rather than by name. With
+// --plugin-values, those definitions are rendered as templates first.
+func (g *genFlags) customPlugins(cfg *config.Config) ([][]byte, error) {
+	if len(g.plugins) == 0 && len(g.pluginValues) == 0 {
+		return nil, nil
+	}
+
+	var values loader.Values
+	if len(g.pluginValues) > 0 {
+		var err error
+		if values, err = loader.LoadValues(g.pluginValues); err != nil {
+			return nil, err
+		}
+	}
+
+	var customPlugins [][]byte
+	cfg.PluginSelections = make([]plugin.Selection, len(g.plugins))
+	fetcher := remote.NewFetcher(g.pluginCache)
+	for i, name := range g.plugins {
+		var definition []byte
+		var err error
+		switch {
+		case remote.IsRemote(name):
+			definition, err = fetcher.Fetch(name)
+		case isPluginFile(name):
+			definition, err = ioutil.ReadFile(name)
+			err = errors.Wrapf(err, "couldn't read plugin definition %v", name)
+		default:
+			cfg.PluginSelections[i] = plugin.Selection{Name: name}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if values != nil {
+			if definition, err = loader.RenderDefinition(definition, values); err != nil {
+				return nil, errors.Wrapf(err, "invalid plugin %v", name)
+			}
+		}
+		def, err := loader.LoadDefinition(definition)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid plugin %v", name)
+		}
+		customPlugins = append(customPlugins, definition)
+		cfg.PluginSelections[i] = plugin.Selection{Name: def.SonobuoyConfig.PluginName}
+	}
+	if values != nil && len(customPlugins) == 0 {
+		return nil, errors.New("--plugin-values needs plugin definitions given with --plugin")
+	}
+	return customPlugins, nil
+}
+
+// changedFlags returns the flags that were given, as --name=value, for the
+// run's provenance.
+func (g *genFlags) changedFlags() []string {
+	var changed []string
+	if g.flags == nil {
+		return changed
+	}
+	g.flags.VisitAll(func(f *pflag.Flag) {
+		if f.Changed {
+			changed = append(changed, fmt.Sprintf("--%v=%v", f.Name, f.Value))
+		}
+	})
+	return changed
+}
+
+// isPluginFile returns whether a plugin given with --plugin is a file with its
+// definition, rather than a plugin's name.
+func isPluginFile(name string) bool {
+	ext := filepath.Ext(name)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// runNamespace is the namespace to run in: the --namespace flag, or a supplied
+// config's namespace if the flag is left at its default.
+func (g *genFlags) runNamespace() string {
+	if cfg := g.sonobuoyConfig.Get(); cfg != nil && g.namespace == config.DefaultNamespace && cfg.Namespace != "" {
+		return cfg.Namespace
+	}
+	return g.namespace
+}
+
 // GenCommand is exported so it can be extended.
 var GenCommand = &cobra.Command{
 	Use:   "gen",
@@ -83,6 +294,14 @@ var GenCommand = &cobra.Command{
 
 func init() {
 	GenCommand.Flags().AddFlagSet(GenFlagSet(&genflags, EnabledRBACMode))
+	GenCommand.Flags().StringVar(
+		&genOutput.format, "format", yamlFormat,
+		fmt.Sprintf("What to generate: a single %v manifest on stdout, a %v base or a %v chart, written to --output-dir.", yamlFormat, kustomizeFormat, helmFormat),
+	)
+	GenCommand.Flags().StringVar(
+		&genOutput.dir, "output-dir", client.HelmChartName,
+		fmt.Sprintf("The directory to write a %v base or %v chart to.", kustomizeFormat, helmFormat),
+	)
 	RootCmd.AddCommand(GenCommand)
 }
 
@@ -103,15 +322,46 @@ func genManifest(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	bytes, err := sbc.GenerateManifest(cfg)
+	var files map[string][]byte
+	switch genOutput.format {
+	case yamlFormat:
+		var bytes []byte
+		if bytes, err = sbc.GenerateManifest(cfg); err == nil {
+			fmt.Printf("%s\n", bytes)
+			return
+		}
+	case kustomizeFormat:
+		files, err = sbc.GenerateKustomization(cfg)
+	case helmFormat:
+		files, err = sbc.GenerateHelmChart(cfg)
+	default:
+		err = errors.Errorf("unknown format %q", genOutput.format)
+	}
+	if err == nil {
+		err = writeFiles(genOutput.dir, files)
+	}
 	if err == nil {
-		fmt.Printf("%s\n", bytes)
 		return
 	}
 	errlog.LogError(errors.Wrap(err, "error attempting to generate sonobuoy manifest"))
 	os.Exit(1)
 }
 
+// writeFiles writes files to their paths within dir, creating any directories
+// needed.
+func writeFiles(dir string, files map[string][]byte) error {
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return errors.Wrapf(err, "couldn't create directory for %v", path)
+		}
+		if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+			return errors.Wrapf(err, "couldn't write %v", path)
+		}
+	}
+	return nil
+}
+
 // getRBACOrExit is a helper function for working with RBACMode. RBACMode is a bit of a special case
 // because it only needs a kubeconfig for detect, otherwise errors from kubeconfig can be ignored.
 // This function returns a bool because it os.Exit()s in error cases.
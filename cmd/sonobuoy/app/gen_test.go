@@ -0,0 +1,96 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+)
+
+func TestGenFlags_customPlugins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-plugin-values")
+	if err != nil {
+		t.Fatalf("couldn't make temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, contents string) string {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte(contents), 0644); err != nil {
+			t.Fatalf("couldn't write %v: %v", name, err)
+		}
+		return file
+	}
+	definition := write("plugin.yaml", `sonobuoy-config:
+  driver: Job
+  plugin-name: {{ .Values.name }}
+  result-type: {{ .Values.name }}
+spec:
+  image: example.com/plugin:{{ .Values.tag }}
+  name: plugin
+`)
+	values := write("values.yaml", "name: custom\ntag: v1\n")
+
+	g := &genFlags{plugins: []string{"e2e", definition}, pluginValues: []string{values}}
+	cfg := config.New()
+	plugins, err := g.customPlugins(cfg)
+	if err != nil {
+		t.Fatalf("couldn't get custom plugins: %v", err)
+	}
+	if len(plugins) != 1 || !strings.Contains(string(plugins[0]), "image: example.com/plugin:v1") {
+		t.Errorf("expected the plugin definition to be rendered, got %q", plugins)
+	}
+	if len(cfg.PluginSelections) != 2 || cfg.PluginSelections[0].Name != "e2e" || cfg.PluginSelections[1].Name != "custom" {
+		t.Errorf("expected e2e and the custom plugin to be selected, got %+v", cfg.PluginSelections)
+	}
+
+	// Without values, definitions are used as they are.
+	g = &genFlags{plugins: []string{write("plain.yml", "sonobuoy-config:\n  driver: Job\n  plugin-name: plain\n  result-type: plain\nspec:\n  name: plugin\n")}}
+	cfg = config.New()
+	if _, err := g.customPlugins(cfg); err != nil || cfg.PluginSelections[0].Name != "plain" {
+		t.Errorf("expected the plain plugin to be selected, got %+v: %v", cfg.PluginSelections, err)
+	}
+
+	g = &genFlags{plugins: []string{"e2e"}, pluginValues: []string{values}}
+	if _, err := g.customPlugins(config.New()); err == nil {
+		t.Error("expected values without any plugin definitions to be rejected")
+	}
+
+	g = &genFlags{plugins: []string{definition}, pluginValues: []string{write("partial.yaml", "name: custom\n")}}
+	if _, err := g.customPlugins(config.New()); err == nil || !strings.Contains(err.Error(), "isn't set") {
+		t.Errorf("expected a missing value to be rejected, got %v", err)
+	}
+}
+
+func TestGenFlags_changedFlags(t *testing.T) {
+	var g genFlags
+	flags := GenFlagSet(&g, EnabledRBACMode)
+	if err := flags.Parse([]string{"--namespace=sonobuoy-test", "--allow-mixed-versions"}); err != nil {
+		t.Fatalf("couldn't parse flags: %v", err)
+	}
+
+	expected := []string{"--allow-mixed-versions=true", "--namespace=sonobuoy-test"}
+	if changed := g.changedFlags(); !reflect.DeepEqual(changed, expected) {
+		t.Errorf("expected the given flags %v to be recorded, got %v", expected, changed)
+	}
+}
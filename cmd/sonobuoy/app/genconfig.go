@@ -0,0 +1,209 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/heptio/sonobuoy/pkg/client"
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+type genConfigFlags struct {
+	interactive bool
+	output      string
+}
+
+var genconfigflags genConfigFlags
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Generates a Sonobuoy config file",
+		Run:   genConfig,
+		Args:  cobra.ExactArgs(0),
+	}
+	cmd.Flags().BoolVarP(&genconfigflags.interactive, "interactive", "i", false, "Prompt for the mode, plugins, namespace and images to use instead of writing the defaults.")
+	cmd.Flags().StringVarP(&genconfigflags.output, "output", "o", "", "The file to write the config to. Defaults to stdout.")
+
+	GenCommand.AddCommand(cmd)
+}
+
+func genConfig(cmd *cobra.Command, args []string) {
+	cfg := config.New()
+	if genconfigflags.interactive {
+		// Prompts go to stderr so the config can be redirected from stdout.
+		wizard := &configWizard{out: os.Stderr}
+		if err := wizard.run(&scannedLines{bufio.NewScanner(os.Stdin)}, cfg); err != nil {
+			errlog.LogError(errors.Wrap(err, "couldn't generate config"))
+			os.Exit(1)
+		}
+	}
+
+	if errs := cfg.Validate(); len(errs) > 0 {
+		for _, err := range errs {
+			errlog.LogError(err)
+		}
+		os.Exit(1)
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "couldn't marshal config"))
+		os.Exit(1)
+	}
+	data = append(data, '\n')
+
+	if genconfigflags.output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := ioutil.WriteFile(genconfigflags.output, data, 0644); err != nil {
+		errlog.LogError(errors.Wrapf(err, "couldn't write config to %v", genconfigflags.output))
+		os.Exit(1)
+	}
+}
+
+// scannedLines reads lines from a scanner, returning io.EOF once it's done.
+type scannedLines struct {
+	*bufio.Scanner
+}
+
+func (s *scannedLines) ReadLine() (string, error) {
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return s.Text(), nil
+}
+
+// configWizard prompts for the settings most people change and fills them
+// into a config.
+type configWizard struct {
+	out io.Writer
+}
+
+// run asks each of the wizard's questions in turn, setting the answers on cfg.
+func (w *configWizard) run(in lineReader, cfg *config.Config) error {
+	modes := client.GetModes()
+	sort.Strings(modes)
+	mode := client.Conformance
+	answer, err := w.ask(in, fmt.Sprintf("Mode (%v)", strings.Join(modes, ", ")), string(mode), mode.Set)
+	if err != nil {
+		return err
+	}
+	mode.Set(answer)
+
+	var defaultPlugins []string
+	for _, selection := range mode.Get().Selectors {
+		defaultPlugins = append(defaultPlugins, selection.Name)
+	}
+	answer, err = w.ask(in, "Plugins, separated by commas", strings.Join(defaultPlugins, ","), func(answer string) error {
+		_, err := parsePluginSelections(answer)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	cfg.PluginSelections, _ = parsePluginSelections(answer)
+
+	cfg.Namespace, err = w.ask(in, "Namespace", cfg.Namespace, func(answer string) error {
+		if errs := validation.IsDNS1123Label(answer); len(errs) > 0 {
+			return fmt.Errorf("invalid namespace %q: %v", answer, strings.Join(errs, ", "))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	cfg.WorkerImage, err = w.ask(in, "Sonobuoy image", cfg.WorkerImage, func(answer string) error {
+		if strings.ContainsAny(answer, " \t") {
+			return fmt.Errorf("invalid image %q", answer)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	policies := ValidPullPolicies()
+	sort.Strings(policies)
+	var policy ImagePullPolicy
+	answer, err = w.ask(in, fmt.Sprintf("Image pull policy (%v)", strings.Join(policies, ", ")), cfg.ImagePullPolicy, policy.Set)
+	if err != nil {
+		return err
+	}
+	policy.Set(answer)
+	cfg.ImagePullPolicy = policy.String()
+
+	return nil
+}
+
+// ask prompts with the question until the answer is valid, returning it. An
+// empty answer is the default.
+func (w *configWizard) ask(in lineReader, question, def string, valid func(string) error) (string, error) {
+	for {
+		fmt.Fprintf(w.out, "%v [%v]: ", question, def)
+		answer, err := in.ReadLine()
+		if err == io.EOF {
+			fmt.Fprintln(w.out)
+			return "", errors.New("no answer given")
+		}
+		if err != nil {
+			return "", errors.Wrap(err, "couldn't read answer")
+		}
+
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			answer = def
+		}
+		if err := valid(answer); err != nil {
+			fmt.Fprintf(w.out, "%v\n", err)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+// parsePluginSelections parses a comma separated list of plugin names.
+func parsePluginSelections(list string) ([]plugin.Selection, error) {
+	var selections []plugin.Selection
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid plugin name %q: %v", name, strings.Join(errs, ", "))
+		}
+		selections = append(selections, plugin.Selection{Name: name})
+	}
+	return selections, nil
+}
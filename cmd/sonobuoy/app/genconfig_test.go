@@ -0,0 +1,120 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+func TestConfigWizard(t *testing.T) {
+	testCases := []struct {
+		desc       string
+		answers    []string
+		expectErr  bool
+		plugins    []plugin.Selection
+		namespace  string
+		image      string
+		pullPolicy string
+		prompts    []string
+	}{
+		{
+			desc:       "defaults",
+			answers:    []string{"", "", "", "", ""},
+			plugins:    []plugin.Selection{{Name: "e2e"}, {Name: "systemd-logs"}},
+			namespace:  config.DefaultNamespace,
+			image:      "gcr.io/heptio-images/sonobuoy:latest",
+			pullPolicy: "Always",
+		}, {
+			desc:       "mode picks the default plugins",
+			answers:    []string{"quick", "", "", "", ""},
+			plugins:    []plugin.Selection{{Name: "e2e"}},
+			namespace:  config.DefaultNamespace,
+			image:      "gcr.io/heptio-images/sonobuoy:latest",
+			pullPolicy: "Always",
+			prompts:    []string{"Plugins, separated by commas [e2e]: "},
+		}, {
+			desc:       "overrides",
+			answers:    []string{"Extended", "e2e, my-plugin", "testing", "registry.local/sonobuoy:v1", "IfNotPresent"},
+			plugins:    []plugin.Selection{{Name: "e2e"}, {Name: "my-plugin"}},
+			namespace:  "testing",
+			image:      "registry.local/sonobuoy:v1",
+			pullPolicy: "IfNotPresent",
+		}, {
+			desc:       "invalid answers are asked again",
+			answers:    []string{"slow", "", "e2e,,", "e2e", "Not_A_Namespace", "", "", "sometimes", "never"},
+			plugins:    []plugin.Selection{{Name: "e2e"}},
+			namespace:  config.DefaultNamespace,
+			image:      "gcr.io/heptio-images/sonobuoy:latest",
+			pullPolicy: "Never",
+			prompts: []string{
+				"unknown mode slow",
+				`invalid plugin name ""`,
+				`invalid namespace "Not_A_Namespace"`,
+				`unknown pull policy "sometimes"`,
+			},
+		}, {
+			desc:      "running out of answers",
+			answers:   []string{"quick"},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			var out bytes.Buffer
+			cfg := config.New()
+			answers := scriptedLines(tc.answers)
+			err := (&configWizard{out: &out}).run(&answers, cfg)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(cfg.PluginSelections, tc.plugins) {
+				t.Errorf("expected plugins %v, got %v", tc.plugins, cfg.PluginSelections)
+			}
+			if cfg.Namespace != tc.namespace {
+				t.Errorf("expected namespace %q, got %q", tc.namespace, cfg.Namespace)
+			}
+			if cfg.WorkerImage != tc.image {
+				t.Errorf("expected image %q, got %q", tc.image, cfg.WorkerImage)
+			}
+			if cfg.ImagePullPolicy != tc.pullPolicy {
+				t.Errorf("expected pull policy %q, got %q", tc.pullPolicy, cfg.ImagePullPolicy)
+			}
+			for _, prompt := range tc.prompts {
+				if !strings.Contains(out.String(), prompt) {
+					t.Errorf("expected %q in the output, got\n%v", prompt, out.String())
+				}
+			}
+			if errs := cfg.Validate(); len(errs) > 0 {
+				t.Errorf("expected a valid config, got %v", errs)
+			}
+		})
+	}
+}
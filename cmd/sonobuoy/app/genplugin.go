@@ -0,0 +1,91 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/heptio/sonobuoy/pkg/client"
+	"github.com/heptio/sonobuoy/pkg/errlog"
+)
+
+type genPluginFlags struct {
+	client.GenPluginConfig
+	outputDir string
+}
+
+var genpluginflags genPluginFlags
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "plugin",
+		Short: "Scaffolds a new plugin definition and an example entrypoint for its container",
+		Run:   genPlugin,
+		Args:  cobra.ExactArgs(0),
+	}
+	cmd.Flags().StringVar(&genpluginflags.Name, "name", "", "The name of the plugin, also used as its result type.")
+	cmd.Flags().StringVar(&genpluginflags.Image, "image", "", "The image of the plugin's container.")
+	cmd.Flags().StringVar(&genpluginflags.Driver, "driver", "Job", "How to run the plugin. Valid options are Job (once per run), DaemonSet (once per node) or Deployment (continuously).")
+	cmd.Flags().StringVarP(&genpluginflags.outputDir, "output-dir", "o", ".", "The directory to write the plugin files to.")
+
+	GenCommand.AddCommand(cmd)
+}
+
+func genPlugin(cmd *cobra.Command, args []string) {
+	plugin, err := client.GeneratePlugin(&genpluginflags.GenPluginConfig)
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "couldn't generate plugin"))
+		os.Exit(1)
+	}
+
+	if err := os.MkdirAll(genpluginflags.outputDir, 0755); err != nil {
+		errlog.LogError(errors.Wrapf(err, "couldn't create output directory %v", genpluginflags.outputDir))
+		os.Exit(1)
+	}
+
+	definitionFile := filepath.Join(genpluginflags.outputDir, genpluginflags.Name+".yaml")
+	entrypointFile := filepath.Join(genpluginflags.outputDir, "run.sh")
+	files := []struct {
+		path     string
+		contents []byte
+		mode     os.FileMode
+	}{
+		{definitionFile, plugin.Definition, 0644},
+		{entrypointFile, plugin.Entrypoint, 0755},
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f.path); err == nil {
+			errlog.LogError(fmt.Errorf("%v already exists, not overwriting it", f.path))
+			os.Exit(1)
+		}
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(f.path, f.contents, f.mode); err != nil {
+			errlog.LogError(errors.Wrapf(err, "couldn't write %v", f.path))
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Wrote the plugin definition to %v and an example entrypoint to %v.\n", definitionFile, entrypointFile)
+	fmt.Printf("Build %v into your image as /run.sh, then add %v to a plugins.d directory or the Sonobuoy plugins ConfigMap.\n", entrypointFile, definitionFile)
+}
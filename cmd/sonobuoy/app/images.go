@@ -0,0 +1,204 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/heptio/sonobuoy/pkg/client"
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/image"
+)
+
+type imagesFlags struct {
+	genFlags
+	output           string
+	privateRegistry  string
+	mappingFile      string
+	e2eTestImages    bool
+	conformanceImage string
+	repoListFile     string
+}
+
+var imagesflags imagesFlags
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "images",
+		Short: "Lists the images a sonobuoy run needs, for mirroring them to air-gapped clusters",
+		Run:   listImages,
+		Args:  cobra.ExactArgs(0),
+	}
+	// The images depend on the same options as the manifest itself.
+	cmd.PersistentFlags().AddFlagSet(GenFlagSet(&imagesflags.genFlags, EnabledRBACMode))
+	cmd.PersistentFlags().BoolVar(
+		&imagesflags.e2eTestImages, "e2e-test-images", false,
+		"Also include the images the e2e tests pull, listed by running the conformance image with docker.",
+	)
+	cmd.PersistentFlags().StringVar(
+		&imagesflags.conformanceImage, "conformance-image", defaultConformanceImage,
+		"The conformance image whose e2e tests' images --e2e-test-images includes.",
+	)
+
+	pull := &cobra.Command{
+		Use:   "pull",
+		Short: "Pulls the images a sonobuoy run needs with docker",
+		Run:   pullImages,
+		Args:  cobra.ExactArgs(0),
+	}
+
+	download := &cobra.Command{
+		Use:   "download",
+		Short: "Pulls the images a sonobuoy run needs and saves them to a tarball for 'docker load'",
+		Run:   downloadImages,
+		Args:  cobra.ExactArgs(0),
+	}
+	download.Flags().StringVarP(
+		&imagesflags.output, "output", "o", "sonobuoy-images.tar",
+		"The file to save the images to.",
+	)
+
+	push := &cobra.Command{
+		Use:   "push",
+		Short: "Copies the images a sonobuoy run needs to a private registry and writes a mapping file for 'sonobuoy run --image-mapping'",
+		Run:   pushImages,
+		Args:  cobra.ExactArgs(0),
+	}
+	push.Flags().StringVar(
+		&imagesflags.privateRegistry, "private-registry", "",
+		"The registry to push the images to, such as registry.example.com/sonobuoy.",
+	)
+	push.Flags().StringVar(
+		&imagesflags.mappingFile, "mapping-file", "sonobuoy-image-mapping.yaml",
+		"The file to write the mapping of each image to its copy in the private registry to.",
+	)
+	push.Flags().StringVar(
+		&imagesflags.repoListFile, "e2e-repo-list-file", "sonobuoy-e2e-repo-list.yaml",
+		"With --e2e-test-images, the file to write the e2e tests' repo list for 'sonobuoy run --e2e-repo-list' to.",
+	)
+
+	cmd.AddCommand(pull, download, push)
+	RootCmd.AddCommand(cmd)
+}
+
+// defaultConformanceImage is the image of the e2e plugin Sonobuoy generates.
+const defaultConformanceImage = "gcr.io/heptio-images/kube-conformance:latest"
+
+// getImages lists the images of a run generated with the images flags,
+// followed by those the e2e tests pull with --e2e-test-images, which are also
+// returned on their own.
+func getImages() (images, e2eImages []string) {
+	cfg, err := imagesflags.Config()
+	if err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+	// Listing images doesn't need a cluster, so neither does the client.
+	images, err = (&client.SonobuoyClient{}).GetImages(cfg)
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "couldn't list sonobuoy images"))
+		os.Exit(1)
+	}
+	if !imagesflags.e2eTestImages {
+		return images, nil
+	}
+
+	e2eImages, err = image.E2EImages(image.DockerClient{}, imagesflags.conformanceImage)
+	if err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+	return append(images, e2eImages...), e2eImages
+}
+
+func listImages(cmd *cobra.Command, args []string) {
+	images, _ := getImages()
+	for _, img := range images {
+		fmt.Println(img)
+	}
+}
+
+func pullImages(cmd *cobra.Command, args []string) {
+	images, _ := getImages()
+	if err := image.PullAll(image.DockerClient{}, images); err != nil {
+		errlog.LogError(errors.Wrap(err, "couldn't pull sonobuoy images"))
+		os.Exit(1)
+	}
+}
+
+func downloadImages(cmd *cobra.Command, args []string) {
+	images, _ := getImages()
+	docker := image.DockerClient{}
+	if err := image.PullAll(docker, images); err != nil {
+		errlog.LogError(errors.Wrap(err, "couldn't pull sonobuoy images"))
+		os.Exit(1)
+	}
+	if err := docker.Save(images, imagesflags.output); err != nil {
+		errlog.LogError(errors.Wrap(err, "couldn't save sonobuoy images"))
+		os.Exit(1)
+	}
+	fmt.Printf("Saved %d images to %v\n", len(images), imagesflags.output)
+}
+
+func pushImages(cmd *cobra.Command, args []string) {
+	if imagesflags.privateRegistry == "" {
+		errlog.LogError(errors.New("--private-registry is required"))
+		os.Exit(1)
+	}
+
+	images, e2eImages := getImages()
+	mapping := image.NewMapping(images, imagesflags.privateRegistry)
+	if err := image.Mirror(image.DockerClient{}, mapping); err != nil {
+		errlog.LogError(errors.Wrap(err, "couldn't push sonobuoy images"))
+		os.Exit(1)
+	}
+
+	f, err := os.Create(imagesflags.mappingFile)
+	if err != nil {
+		errlog.LogError(errors.Wrapf(err, "couldn't create image mapping %v", imagesflags.mappingFile))
+		os.Exit(1)
+	}
+	defer f.Close()
+	if err := mapping.Write(f); err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote image mapping to %v, use it with sonobuoy run --image-mapping %v\n", imagesflags.mappingFile, imagesflags.mappingFile)
+
+	if len(e2eImages) > 0 {
+		if err := writeRepoList(image.NewRepoList(e2eImages, imagesflags.privateRegistry), imagesflags.repoListFile); err != nil {
+			errlog.LogError(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote e2e repo list to %v, use it with sonobuoy run --e2e-repo-list %v\n", imagesflags.repoListFile, imagesflags.repoListFile)
+	}
+}
+
+// writeRepoList writes the e2e tests' repo list to file, in the format
+// --e2e-repo-list reads.
+func writeRepoList(l image.RepoList, file string) error {
+	contents, err := l.YAML()
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(ioutil.WriteFile(file, []byte(contents+"\n"), 0644), "couldn't write e2e repo list %v", file)
+}
@@ -27,6 +27,8 @@ import (
 // Kubeconfig represents an explict or implict kubeconfig
 type Kubeconfig struct {
 	*clientcmd.ClientConfigLoadingRules
+	// Context is the context to use instead of the current one, if it's set.
+	Context string
 }
 
 // Make sure Kubeconfig implements Value properly
@@ -60,7 +62,13 @@ func (c *Kubeconfig) Get() (*rest.Config, error) {
 		c.ClientConfigLoadingRules = clientcmd.NewDefaultClientConfigLoadingRules()
 	}
 
-	configOverrides := &clientcmd.ConfigOverrides{}
+	configOverrides := &clientcmd.ConfigOverrides{CurrentContext: c.Context}
 	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(c, configOverrides)
 	return kubeConfig.ClientConfig()
 }
+
+// ForContext returns the kubeconfig with the given context used instead of the
+// current one.
+func (c *Kubeconfig) ForContext(context string) *Kubeconfig {
+	return &Kubeconfig{ClientConfigLoadingRules: c.ClientConfigLoadingRules, Context: context}
+}
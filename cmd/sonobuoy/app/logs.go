@@ -23,6 +23,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/heptio/sonobuoy/pkg/client"
 	"github.com/heptio/sonobuoy/pkg/errlog"
@@ -34,18 +35,23 @@ const (
 
 var logConfig client.LogConfig
 var logsKubecfg Kubeconfig
+var logsNoColor bool
 
 func init() {
 	cmd := &cobra.Command{
 		Use:   "logs",
-		Short: "Dumps the logs of the currently running sonobuoy containers for diagnostics",
+		Short: "Dumps the logs of the sonobuoy aggregator and plugin containers for diagnostics",
 		Run:   getLogs,
 		Args:  cobra.ExactArgs(0),
 	}
 
 	cmd.Flags().BoolVarP(
 		&logConfig.Follow, "follow", "f", false,
-		"Specify if the logs should be streamed.",
+		"Specify if the logs should be streamed, including those of plugin pods started later.",
+	)
+	cmd.Flags().BoolVar(
+		&logsNoColor, "no-color", false,
+		"Don't color the pod and container each line is prefixed with.",
 	)
 	logConfig.Out = os.Stdout
 	AddKubeconfigFlag(&logsKubecfg, cmd.Flags())
@@ -54,6 +60,8 @@ func init() {
 }
 
 func getLogs(cmd *cobra.Command, args []string) {
+	logConfig.Color = !logsNoColor && terminal.IsTerminal(int(os.Stdout.Fd()))
+
 	restConfig, err := logsKubecfg.Get()
 	if err != nil {
 		errlog.LogError(fmt.Errorf("failed to get rest config: %v", err))
@@ -18,7 +18,10 @@ package app
 
 import (
 	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/heptio/sonobuoy/pkg/client"
 	"github.com/heptio/sonobuoy/pkg/config"
 	"github.com/heptio/sonobuoy/pkg/discovery"
 	"github.com/heptio/sonobuoy/pkg/errlog"
@@ -27,11 +30,16 @@ import (
 	"github.com/spf13/cobra"
 
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 var noExit bool
 var kubecfg Kubeconfig
 
+// retrievePollInterval is how often the master checks whether its results
+// have been retrieved.
+var retrievePollInterval = 5 * time.Second
+
 func init() {
 	cmd := &cobra.Command{
 		Use:    "master",
@@ -70,7 +78,14 @@ func runMaster(cmd *cobra.Command, args []string) {
 	}
 
 	// Run Discovery (gather API data, run plugins)
-	errcount := discovery.Run(clientset, cfg)
+	errcount := discovery.Run(clientset, kcfg, cfg)
+
+	if cfg.DeleteOnCompletion {
+		if err := deleteOnCompletion(kcfg, cfg); err != nil {
+			errlog.LogError(errors.Wrap(err, "couldn't delete sonobuoy run"))
+			errcount++
+		}
+	}
 
 	if noExit {
 		logrus.Info("no-exit was specified, sonobuoy is now blocking")
@@ -79,3 +94,39 @@ func runMaster(cmd *cobra.Command, args []string) {
 
 	os.Exit(errcount)
 }
+
+// deleteOnCompletion waits for the run's results to be retrieved, or stored
+// elsewhere, for up to its retrieve timeout, then deletes the run.
+func deleteOnCompletion(kcfg *rest.Config, cfg *config.Config) error {
+	timeout, err := cfg.RetrieveTimeoutDuration()
+	if err != nil {
+		return err
+	}
+
+	marker := filepath.Join(cfg.ResultsDir, config.RetrievedMarker)
+	logrus.WithField("timeout", timeout).Info("Waiting for results to be retrieved before deleting the run")
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, err := os.Stat(marker); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			logrus.Warning("Results weren't retrieved in time, deleting the run anyway")
+			break
+		}
+		time.Sleep(retrievePollInterval)
+	}
+
+	podName, err := os.Hostname()
+	if err != nil {
+		return errors.Wrap(err, "couldn't get the aggregator's pod name")
+	}
+	sbc, err := client.NewSonobuoyClient(kcfg)
+	if err != nil {
+		return err
+	}
+	return sbc.DeleteSelf(&client.DeleteConfig{
+		Namespace:       cfg.Namespace,
+		NamespaceScoped: cfg.NamespaceScoped,
+	}, podName)
+}
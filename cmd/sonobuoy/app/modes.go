@@ -0,0 +1,119 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/heptio/sonobuoy/pkg/client"
+	"github.com/heptio/sonobuoy/pkg/errlog"
+)
+
+var modesFlags struct {
+	json bool
+}
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "modes",
+		Short: "Lists the modes sonobuoy can run in, with the plugins and E2E tests each one runs",
+		Run:   listModes,
+		Args:  cobra.ExactArgs(0),
+	}
+	cmd.Flags().BoolVar(
+		&modesFlags.json, "json", false,
+		"If true, print the modes as JSON.",
+	)
+
+	RootCmd.AddCommand(cmd)
+}
+
+func listModes(cmd *cobra.Command, args []string) {
+	modes := client.ListModes()
+	var err error
+	if modesFlags.json {
+		err = printModesJSON(os.Stdout, modes)
+	} else {
+		err = printModes(os.Stdout, modes)
+	}
+	if err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+}
+
+// printModes prints a table of the modes, followed by each one's E2E focus and
+// skip, which are too long to fit in the table.
+func printModes(w io.Writer, modes []client.ModeInfo) error {
+	tw := tabwriter.NewWriter(w, 1, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "MODE\tPLUGINS\tESTIMATED DURATION\tDESCRIPTION\n")
+	for _, mode := range modes {
+		fmt.Fprintf(tw, "%s\t%s\t~%v\t%s\n", strings.ToLower(string(mode.Name)), strings.Join(mode.Plugins, ","), mode.EstimatedDuration, mode.Description)
+	}
+	if err := tw.Flush(); err != nil {
+		return errors.Wrap(err, "couldn't write modes")
+	}
+
+	for _, mode := range modes {
+		fmt.Fprintf(w, "\n%s:\n", strings.ToLower(string(mode.Name)))
+		fmt.Fprintf(w, "  E2E focus: %s\n", orNone(mode.E2EFocus))
+		fmt.Fprintf(w, "  E2E skip:  %s\n", orNone(mode.E2ESkip))
+	}
+	return nil
+}
+
+// modeJSON is how a mode is printed with --json, with the duration readable.
+type modeJSON struct {
+	Name              string   `json:"name"`
+	Description       string   `json:"description"`
+	Plugins           []string `json:"plugins"`
+	E2EFocus          string   `json:"e2eFocus,omitempty"`
+	E2ESkip           string   `json:"e2eSkip,omitempty"`
+	EstimatedDuration string   `json:"estimatedDuration"`
+}
+
+func printModesJSON(w io.Writer, modes []client.ModeInfo) error {
+	out := make([]modeJSON, 0, len(modes))
+	for _, mode := range modes {
+		out = append(out, modeJSON{
+			Name:              strings.ToLower(string(mode.Name)),
+			Description:       mode.Description,
+			Plugins:           mode.Plugins,
+			E2EFocus:          mode.E2EFocus,
+			E2ESkip:           mode.E2ESkip,
+			EstimatedDuration: mode.EstimatedDuration.String(),
+		})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return errors.Wrap(encoder.Encode(out), "couldn't write modes")
+}
+
+func orNone(regex string) string {
+	if regex == "" {
+		return "(none)"
+	}
+	return regex
+}
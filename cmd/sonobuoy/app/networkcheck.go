@@ -0,0 +1,140 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/netcheck"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// networkCheckFlags default to the environment of the network-connectivity
+// plugin's pods.
+type networkCheckFlags struct {
+	namespace       string
+	node            string
+	image           string
+	imagePullPolicy string
+	resultsDir      string
+	targetsTimeout  time.Duration
+	checkTimeout    time.Duration
+	port            int
+}
+
+var networkCheckCfg networkCheckFlags
+
+func init() {
+	flags := networkCheckCmd.Flags()
+	flags.StringVar(&networkCheckCfg.namespace, "namespace", os.Getenv("NAMESPACE"), "The namespace the targets are created in.")
+	flags.StringVar(&networkCheckCfg.image, "image", os.Getenv("SONOBUOY_IMAGE"), "The Sonobuoy image the target pods run.")
+	flags.StringVar(&networkCheckCfg.imagePullPolicy, "image-pull-policy", os.Getenv("IMAGE_PULL_POLICY"), "The pull policy of the target pods' image.")
+	flags.StringVar(&networkCheckCfg.resultsDir, "results-dir", os.Getenv("RESULTS_DIR"), "The directory results are written to for the Sonobuoy worker.")
+	flags.DurationVar(&networkCheckCfg.targetsTimeout, "targets-timeout", 5*time.Minute, "How long to wait for the target pods to be ready on every node.")
+	flags.DurationVar(&networkCheckCfg.checkTimeout, "check-timeout", 5*time.Second, "How long each request or lookup can take.")
+	networkCheckCmd.PersistentFlags().StringVar(&networkCheckCfg.node, "node", os.Getenv("NODE_NAME"), "The node this runs on.")
+
+	networkServeCmd.Flags().IntVar(&networkCheckCfg.port, "port", netcheck.TargetPort, "The port to serve on.")
+	networkCheckCmd.AddCommand(networkServeCmd)
+
+	RootCmd.AddCommand(networkCheckCmd)
+}
+
+var networkCheckCmd = &cobra.Command{
+	Use:    "network-check",
+	Short:  "Check network connectivity from this node (for the network-connectivity plugin)",
+	Run:    runNetworkCheck,
+	Hidden: true,
+	Args:   cobra.ExactArgs(0),
+}
+
+var networkServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Answer the network connectivity checks of other nodes",
+	Run:   runNetworkServe,
+	Args:  cobra.ExactArgs(0),
+}
+
+func runNetworkCheck(cmd *cobra.Command, args []string) {
+	cfg := networkCheckCfg
+	if cfg.namespace == "" || cfg.node == "" || cfg.image == "" || cfg.resultsDir == "" {
+		errlog.LogError(errors.New("--namespace, --node, --image and --results-dir are required"))
+		os.Exit(1)
+	}
+
+	// Not being able to reach the targets is reported as the result, rather
+	// than leaving the plugin without one.
+	var report netcheck.Report
+	targets, err := networkTargets(cfg)
+	if err != nil {
+		errlog.LogError(err)
+		report = netcheck.Report{Node: cfg.node, Error: err.Error(), Checks: []netcheck.Check{}}
+	} else {
+		report = netcheck.NewChecker(cfg.checkTimeout).Check(cfg.node, targets)
+	}
+	logrus.WithField("failed", report.Failed()).Infof("Made %d network checks", len(report.Checks))
+
+	dir := filepath.Join(cfg.resultsDir, "network-connectivity")
+	if err := netcheck.WriteResults(dir, report); err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+	// Tell the Sonobuoy worker the results are ready.
+	if err := ioutil.WriteFile(filepath.Join(cfg.resultsDir, "done"), []byte(dir), 0644); err != nil {
+		errlog.LogError(errors.Wrap(err, "couldn't write done file"))
+		os.Exit(1)
+	}
+}
+
+// networkTargets creates the targets, if no other node has, and waits for
+// them to be ready.
+func networkTargets(cfg networkCheckFlags) (*netcheck.Targets, error) {
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get in-cluster config")
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't create kubernetes client")
+	}
+
+	err = netcheck.EnsureTargets(client, netcheck.TargetConfig{
+		Namespace:       cfg.namespace,
+		Image:           cfg.image,
+		ImagePullPolicy: corev1.PullPolicy(cfg.imagePullPolicy),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return netcheck.WaitForTargets(client, cfg.namespace, cfg.targetsTimeout)
+}
+
+func runNetworkServe(cmd *cobra.Command, args []string) {
+	if err := netcheck.Serve(networkCheckCfg.port, networkCheckCfg.node); err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+}
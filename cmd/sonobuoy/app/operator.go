@@ -0,0 +1,115 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+
+	ops "github.com/heptio/sonobuoy/pkg/client"
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/operator"
+)
+
+var operatorFlags struct {
+	kubecfg         Kubeconfig
+	interval        time.Duration
+	namespace       string
+	image           string
+	imagePullPolicy ImagePullPolicy
+}
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "operator",
+		Short: "Runs Sonobuoy for each SonobuoyRun custom resource, keeping its status up to date",
+		Run:   runOperator,
+		Args:  cobra.ExactArgs(0),
+	}
+	AddKubeconfigFlag(&operatorFlags.kubecfg, cmd.Flags())
+	cmd.PersistentFlags().DurationVar(
+		&operatorFlags.interval, "interval", 30*time.Second,
+		"How often every SonobuoyRun is reconciled",
+	)
+
+	manifestCmd := &cobra.Command{
+		Use:   "manifest",
+		Short: "Generates the manifest of the SonobuoyRun custom resource definition and the operator",
+		Run:   genOperatorManifest,
+		Args:  cobra.ExactArgs(0),
+	}
+	manifestCmd.Flags().StringVarP(
+		&operatorFlags.namespace, "namespace", "n", operator.DefaultNamespace,
+		"The namespace to deploy the operator in.",
+	)
+	AddSonobuoyImage(&operatorFlags.image, manifestCmd.Flags())
+	AddImagePullPolicyFlag(&operatorFlags.imagePullPolicy, manifestCmd.Flags())
+	cmd.AddCommand(manifestCmd)
+
+	RootCmd.AddCommand(cmd)
+}
+
+func runOperator(cmd *cobra.Command, args []string) {
+	restConfig, err := operatorFlags.kubecfg.Get()
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "couldn't get kubernetes config"))
+		os.Exit(1)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "couldn't create kubernetes client"))
+		os.Exit(1)
+	}
+	sdk, err := ops.NewSDKClient(restConfig)
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "could not create sonobuoy client"))
+		os.Exit(1)
+	}
+
+	stop := make(chan struct{})
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigc
+		logrus.WithField("signal", sig).Info("Got a signal, stopping")
+		close(stop)
+	}()
+
+	logrus.WithField("interval", operatorFlags.interval).Info("Starting the Sonobuoy operator")
+	operator.NewController(sdk, operator.NewRunStore(client), operatorFlags.interval).Run(stop)
+}
+
+func genOperatorManifest(cmd *cobra.Command, args []string) {
+	manifest, err := operator.GenerateManifest(&operator.ManifestConfig{
+		Namespace:       operatorFlags.namespace,
+		Image:           operatorFlags.image,
+		ImagePullPolicy: operatorFlags.imagePullPolicy.String(),
+		Interval:        operatorFlags.interval,
+	})
+	if err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(manifest)
+}
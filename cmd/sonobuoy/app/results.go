@@ -0,0 +1,340 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+	"github.com/heptio/sonobuoy/pkg/discovery"
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	resultsModeSummary = "summary"
+	resultsModeJUnit   = "junit"
+	resultsModeSARIF   = "sarif"
+	resultsModeHTML    = "html"
+	resultsModeQueries = "query-stats"
+	resultsModeBrowse  = "interactive"
+)
+
+var resultsMode string
+
+func init() {
+	cmd := &cobra.Command{
+		Use:   "results archive.tar.gz",
+		Short: "Summarize the plugin results in a Sonobuoy archive",
+		Run:   showResults,
+		Args:  cobra.ExactArgs(1),
+	}
+	cmd.Flags().StringVar(
+		&resultsMode, "mode", resultsModeSummary,
+		fmt.Sprintf(
+			"How to report the results, options are [%v (default), %v, %v, %v, %v or %v]. %v writes a JUnit XML report for CI systems, %v a SARIF log for code scanning tools, %v a self-contained HTML page to share, "+
+				"%v how long the queries of each resource took and how many API calls they made, "+
+				"and %v browses the tests, pod logs and resources in the terminal.",
+			resultsModeSummary, resultsModeJUnit, resultsModeSARIF, resultsModeHTML, resultsModeQueries, resultsModeBrowse,
+			resultsModeJUnit, resultsModeSARIF, resultsModeHTML, resultsModeQueries, resultsModeBrowse,
+		),
+	)
+
+	cmd.AddCommand(newResultsDiffCmd())
+	cmd.AddCommand(newSubmitConformanceCmd())
+
+	RootCmd.AddCommand(cmd)
+}
+
+func showResults(cmd *cobra.Command, args []string) {
+	switch resultsMode {
+	case resultsModeSummary, resultsModeJUnit, resultsModeSARIF, resultsModeHTML, resultsModeQueries, resultsModeBrowse:
+	default:
+		errlog.LogError(fmt.Errorf("unknown mode %q, options are [%v, %v, %v, %v, %v or %v]", resultsMode, resultsModeSummary, resultsModeJUnit, resultsModeSARIF, resultsModeHTML, resultsModeQueries, resultsModeBrowse))
+		os.Exit(1)
+	}
+
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		errlog.LogError(errors.Wrapf(err, "could not read sonobuoy archive: %v", args[0]))
+		os.Exit(1)
+	}
+	reader, err := results.NewReaderFromBytes(data)
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "could not open sonobuoy archive"))
+		os.Exit(1)
+	}
+
+	switch resultsMode {
+	case resultsModeJUnit:
+		err = printJUnitReport(os.Stdout, reader)
+	case resultsModeSARIF:
+		err = printSARIFReport(os.Stdout, reader)
+	case resultsModeHTML:
+		err = reader.HTMLReport(os.Stdout)
+	case resultsModeQueries:
+		err = printQueryStats(os.Stdout, reader)
+	case resultsModeBrowse:
+		err = browseResults(reader)
+	default:
+		err = printClusterSummary(os.Stdout, data)
+		if err == nil {
+			err = printResultsSummary(os.Stdout, reader)
+		}
+		if err == nil {
+			err = printBenchmarkSummary(os.Stdout, data)
+		}
+		if err == nil {
+			err = printConnectivitySummary(os.Stdout, data)
+		}
+	}
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "could not print results"))
+		os.Exit(1)
+	}
+}
+
+func printJUnitReport(w io.Writer, reader *results.Reader) error {
+	report, err := reader.JUnitReport()
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.WithStack(err)
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return errors.Wrap(err, "couldn't encode JUnit report")
+	}
+	_, err = io.WriteString(w, "\n")
+	return errors.WithStack(err)
+}
+
+func printSARIFReport(w io.Writer, reader *results.Reader) error {
+	log, err := reader.SARIFReport()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(log), "couldn't encode SARIF log")
+}
+
+// printClusterSummary prints the versions and platform of the cluster the
+// run was on, with warnings about version skew, if the archive recorded them.
+// The archive is read separately, since a results reader can only be read
+// once.
+func printClusterSummary(w io.Writer, data []byte) error {
+	reader, err := results.NewReaderFromBytes(data)
+	if err != nil {
+		return errors.Wrap(err, "could not open sonobuoy archive")
+	}
+	info, err := reader.ClusterInfo()
+	if err != nil || info == nil {
+		return err
+	}
+
+	var platform []string
+	if v := info.ServerVersion; v != nil {
+		platform = append(platform, fmt.Sprintf("Kubernetes %v (%v)", v.GitVersion, v.Platform))
+	}
+	if info.Provider != "" {
+		platform = append(platform, "on "+info.Provider)
+	}
+	if len(info.Nodes) > 0 {
+		platform = append(platform, fmt.Sprintf("%d nodes", len(info.Nodes)))
+	}
+	fmt.Fprintf(w, "Cluster: %v\n", strings.Join(platform, ", "))
+	for _, field := range []struct {
+		name  string
+		value func(discovery.NodeInfo) string
+	}{
+		{"Kubelets", func(n discovery.NodeInfo) string { return n.KubeletVersion }},
+		{"Container runtimes", func(n discovery.NodeInfo) string { return n.ContainerRuntimeVersion }},
+		{"OS images", func(n discovery.NodeInfo) string { return n.OSImage }},
+		{"Instance types", func(n discovery.NodeInfo) string { return n.InstanceType }},
+	} {
+		if counts := results.NodeValueCounts(info.Nodes, field.value); counts != "" {
+			fmt.Fprintf(w, "%v: %v\n", field.name, counts)
+		}
+	}
+	for _, warning := range results.VersionSkew(info) {
+		fmt.Fprintf(w, "WARNING: %v\n", warning)
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+func printResultsSummary(w io.Writer, reader *results.Reader) error {
+	counts, err := reader.TestCounts()
+	if err != nil {
+		return err
+	}
+	return printTestCounts(w, counts)
+}
+
+func printTestCounts(w io.Writer, counts []results.SuiteCounts) error {
+	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "SUITE\tTESTS\tFAILURES\n")
+	tests, failures := 0, 0
+	for _, suite := range counts {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", suite.Name, suite.Tests, suite.Failures)
+		tests += suite.Tests
+		failures += suite.Failures
+	}
+	if err := tw.Flush(); err != nil {
+		return errors.Wrap(err, "couldn't write results summary")
+	}
+	fmt.Fprintf(w, "\n%d tests, %d failures\n", tests, failures)
+	return nil
+}
+
+// printBenchmarkSummary prints how many checks of each CIS benchmark control
+// passed, warned and failed, if any plugin's results were summarized by the
+// kube-bench-summary result processor. The archive is read again, since a
+// results reader can only be read once.
+func printBenchmarkSummary(w io.Writer, data []byte) error {
+	reader, err := results.NewReaderFromBytes(data)
+	if err != nil {
+		return errors.Wrap(err, "could not open sonobuoy archive")
+	}
+	counts, err := reader.BenchmarkCounts()
+	if err != nil || len(counts) == 0 {
+		return err
+	}
+	return printControlCounts(w, counts)
+}
+
+func printControlCounts(w io.Writer, counts []results.ControlCounts) error {
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "PLUGIN\tCONTROL\tPASS\tWARN\tFAIL\n")
+	pass, warn, fail := 0, 0, 0
+	for _, c := range counts {
+		fmt.Fprintf(tw, "%s\t%s %s\t%d\t%d\t%d\n", c.Plugin, c.ID, c.Text, c.Pass, c.Warn, c.Fail)
+		pass += c.Pass
+		warn += c.Warn
+		fail += c.Fail
+	}
+	if err := tw.Flush(); err != nil {
+		return errors.Wrap(err, "couldn't write benchmark summary")
+	}
+	fmt.Fprintf(w, "\n%d checks passed, %d warned, %d failed\n", pass, warn, fail)
+	return nil
+}
+
+// printConnectivitySummary prints a matrix of how each node's network
+// connectivity checks went, if the archive has any. As for
+// printBenchmarkSummary, the archive is read again.
+func printConnectivitySummary(w io.Writer, data []byte) error {
+	reader, err := results.NewReaderFromBytes(data)
+	if err != nil {
+		return errors.Wrap(err, "could not open sonobuoy archive")
+	}
+	reports, err := reader.ConnectivityReports()
+	if err != nil || len(reports) == 0 {
+		return err
+	}
+	return printConnectivityMatrix(w, results.NewConnectivityMatrix(reports))
+}
+
+// printConnectivityMatrix prints a row for each node checks were made from,
+// with a column for each node they were made of, saying which kinds of check
+// of it failed, followed by how the Service and DNS checks went.
+func printConnectivityMatrix(w io.Writer, matrix *results.ConnectivityMatrix) error {
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 1, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "FROM\t%s\tSERVICE\tDNS\n", strings.Join(matrix.Nodes, "\t"))
+	failedNodes := 0
+	for _, row := range matrix.Rows {
+		if row.Error != "" {
+			fmt.Fprintf(tw, "%s\terror: %s\n", row.Node, row.Error)
+			failedNodes++
+			continue
+		}
+		cells := []string{row.Node}
+		failed := false
+		for _, node := range matrix.Nodes {
+			kinds, ok := row.Nodes[node]
+			switch {
+			case !ok:
+				cells = append(cells, "-")
+			case len(kinds) == 0:
+				cells = append(cells, "ok")
+			default:
+				cells = append(cells, strings.Join(kinds, ","))
+				failed = true
+			}
+		}
+		for _, outcomes := range []results.CheckOutcomes{row.Service, row.DNS} {
+			cells = append(cells, checkOutcomes(outcomes))
+			failed = failed || outcomes.Failed > 0
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		if failed {
+			failedNodes++
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return errors.Wrap(err, "couldn't write connectivity matrix")
+	}
+	fmt.Fprintf(w, "\nNetwork checks failed from %d of %d nodes\n", failedNodes, len(matrix.Rows))
+	return nil
+}
+
+func checkOutcomes(o results.CheckOutcomes) string {
+	switch {
+	case o.Checks == 0:
+		return "-"
+	case o.Failed == 0:
+		return "ok"
+	case o.Failed == o.Checks:
+		return "failed"
+	}
+	return fmt.Sprintf("%d/%d failed", o.Failed, o.Checks)
+}
+
+func printQueryStats(w io.Writer, reader *results.Reader) error {
+	times, err := reader.QueryTimes()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "QUERY\tQUERIES\tTIME\tAPI CALLS\tFAILURES\n")
+	var total time.Duration
+	var calls int64
+	for _, stats := range results.SummarizeQueryTimes(times) {
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%d\t%d\n", stats.Name, stats.Queries, stats.Duration.Round(time.Millisecond), stats.APICalls, stats.Failures)
+		total += stats.Duration
+		calls += stats.APICalls
+	}
+	if err := tw.Flush(); err != nil {
+		return errors.Wrap(err, "couldn't write query stats")
+	}
+	fmt.Fprintf(w, "\n%d queries took %v and made %d API calls\n", len(times), total.Round(time.Millisecond), calls)
+	return nil
+}
@@ -0,0 +1,383 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// clearScreen moves the cursor to the top left of the terminal and clears it.
+const clearScreen = "\x1b[H\x1b[2J"
+
+const resultsBrowserHelp = `Type a number and press Enter to open that item. Then:
+  Enter or n  next page
+  p           previous page
+  b           back to the previous screen
+  /text       search test names and every file for text
+  q           quit (or Ctrl-D)`
+
+// browseScreen is one screen of the results browser. Its lines are items that
+// open other screens if open is set, or just text otherwise.
+type browseScreen struct {
+	title string
+	lines []string
+	// open returns the screen for the item on line i.
+	open func(i int) *browseScreen
+	// offset is the first line shown.
+	offset int
+}
+
+// lineReader reads the commands typed into the results browser.
+type lineReader interface {
+	ReadLine() (string, error)
+}
+
+// resultsBrowser lets the results in an archive be explored a page at a time:
+// each plugin's failed or all tests, the files it stored, and the pod logs and
+// resources collected, with search across all of them.
+type resultsBrowser struct {
+	browser *results.Browser
+	out     io.Writer
+	// width and height are how many columns and lines of a screen are shown
+	// at once.
+	width, height int
+	// clear is written before each screen, if out is a terminal.
+	clear   string
+	screens []*browseScreen
+	// status is a message shown under the current screen.
+	status string
+}
+
+func newResultsBrowser(browser *results.Browser, out io.Writer, width, height int) *resultsBrowser {
+	rb := &resultsBrowser{browser: browser, out: out, width: width, height: height}
+	rb.screens = []*browseScreen{rb.pluginsScreen()}
+	return rb
+}
+
+// browseResults runs the results browser on the terminal until it's quit.
+func browseResults(reader *results.Reader) error {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !terminal.IsTerminal(in) || !terminal.IsTerminal(out) {
+		return errors.New("the interactive mode needs a terminal")
+	}
+	browser, err := reader.Browse()
+	if err != nil {
+		return err
+	}
+	width, height, err := terminal.GetSize(out)
+	if err != nil {
+		return errors.Wrap(err, "couldn't get the terminal's size")
+	}
+
+	state, err := terminal.MakeRaw(in)
+	if err != nil {
+		return errors.Wrap(err, "couldn't set up the terminal")
+	}
+	defer terminal.Restore(in, state)
+
+	term := terminal.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "> ")
+	// Leave room for the title, footer, status and prompt.
+	rb := newResultsBrowser(browser, term, width, height-4)
+	rb.clear = clearScreen
+	return rb.run(term)
+}
+
+// run shows the current screen and handles commands until the browser is quit
+// or in runs out.
+func (rb *resultsBrowser) run(in lineReader) error {
+	for {
+		rb.render()
+		line, err := in.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "couldn't read command")
+		}
+		if !rb.handle(strings.TrimSpace(line)) {
+			return nil
+		}
+	}
+}
+
+// handle carries out a command, returning false if it quits the browser.
+func (rb *resultsBrowser) handle(command string) bool {
+	rb.status = ""
+	screen := rb.screens[len(rb.screens)-1]
+
+	switch {
+	case command == "q":
+		return false
+	case command == "" || command == "n":
+		if screen.offset+rb.height < len(screen.lines) {
+			screen.offset += rb.height
+		}
+	case command == "p":
+		screen.offset -= rb.height
+		if screen.offset < 0 {
+			screen.offset = 0
+		}
+	case command == "b":
+		if len(rb.screens) > 1 {
+			rb.screens = rb.screens[:len(rb.screens)-1]
+		}
+	case command == "?" || command == "h":
+		rb.status = resultsBrowserHelp
+	case strings.HasPrefix(command, "/"):
+		rb.screens = append(rb.screens, rb.searchScreen(strings.TrimSpace(command[1:])))
+	default:
+		n, err := strconv.Atoi(command)
+		if err != nil {
+			rb.status = fmt.Sprintf("Unknown command %q, type ? for help.", command)
+			break
+		}
+		if screen.open == nil || n < 1 || n > len(screen.lines) {
+			rb.status = fmt.Sprintf("There's no item %d here.", n)
+			break
+		}
+		rb.screens = append(rb.screens, screen.open(n-1))
+	}
+	return true
+}
+
+// render shows a page of the current screen.
+func (rb *resultsBrowser) render() {
+	screen := rb.screens[len(rb.screens)-1]
+	fmt.Fprint(rb.out, rb.clear)
+	fmt.Fprintln(rb.out, rb.fit(screen.title))
+
+	end := screen.offset + rb.height
+	if end > len(screen.lines) {
+		end = len(screen.lines)
+	}
+	for i := screen.offset; i < end; i++ {
+		if screen.open != nil {
+			fmt.Fprintln(rb.out, rb.fit(fmt.Sprintf("%4d  %s", i+1, screen.lines[i])))
+		} else {
+			fmt.Fprintln(rb.out, screen.lines[i])
+		}
+	}
+
+	if len(screen.lines) == 0 {
+		fmt.Fprintln(rb.out, "(nothing here)")
+	}
+	fmt.Fprintf(rb.out, "-- %d-%d of %d, ? for help --\n", min(screen.offset+1, end), end, len(screen.lines))
+	if rb.status != "" {
+		fmt.Fprintln(rb.out, rb.status)
+	}
+}
+
+// fit cuts s to the width of the screen.
+func (rb *resultsBrowser) fit(s string) string {
+	runes := []rune(s)
+	if rb.width <= 0 || len(runes) <= rb.width {
+		return s
+	}
+	return string(runes[:rb.width-1]) + "…"
+}
+
+// wrap splits text into lines no wider than the screen, so that each page
+// fits on it.
+func (rb *resultsBrowser) wrap(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		runes := []rune(strings.Replace(line, "\t", "    ", -1))
+		for rb.width > 0 && len(runes) > rb.width {
+			lines = append(lines, string(runes[:rb.width]))
+			runes = runes[rb.width:]
+		}
+		lines = append(lines, string(runes))
+	}
+	return lines
+}
+
+// browsedTest is a test case of a suite in the results browser.
+type browsedTest struct {
+	suite results.JUnitTestSuite
+	index int
+}
+
+// pluginsScreen lists each plugin's tests, then the pod logs and resources.
+func (rb *resultsBrowser) pluginsScreen() *browseScreen {
+	screen := &browseScreen{title: "Sonobuoy results"}
+	plugins := rb.browser.Plugins
+	for _, plugin := range plugins {
+		all, failed := rb.tests(plugin)
+		screen.lines = append(screen.lines, fmt.Sprintf("%v: %d tests, %d failed", plugin, len(all), len(failed)))
+	}
+	logs, resources := rb.browser.PodLogs(), rb.browser.Resources()
+	screen.lines = append(screen.lines,
+		fmt.Sprintf("Pod logs (%d)", len(logs)),
+		fmt.Sprintf("Resources (%d)", len(resources)),
+	)
+
+	screen.open = func(i int) *browseScreen {
+		switch {
+		case i < len(plugins):
+			return rb.pluginScreen(plugins[i])
+		case i == len(plugins):
+			return rb.filesScreen("Pod logs", logs)
+		default:
+			return rb.filesScreen("Resources", resources)
+		}
+	}
+	return screen
+}
+
+// pluginScreen offers a plugin's failed tests, all of its tests, and the files
+// it stored.
+func (rb *resultsBrowser) pluginScreen(plugin string) *browseScreen {
+	all, failed := rb.tests(plugin)
+	files := rb.browser.PluginFiles(plugin)
+	return &browseScreen{
+		title: plugin,
+		lines: []string{
+			fmt.Sprintf("Failed tests (%d)", len(failed)),
+			fmt.Sprintf("All tests (%d)", len(all)),
+			fmt.Sprintf("Stored files (%d)", len(files)),
+		},
+		open: func(i int) *browseScreen {
+			switch i {
+			case 0:
+				return rb.testsScreen(plugin+": failed tests", failed)
+			case 1:
+				return rb.testsScreen(plugin+": all tests", all)
+			default:
+				return rb.filesScreen(plugin+": stored files", files)
+			}
+		},
+	}
+}
+
+// tests returns all of a plugin's tests, and those of them that failed.
+func (rb *resultsBrowser) tests(plugin string) (all, failed []browsedTest) {
+	for _, suite := range rb.browser.Suites(plugin) {
+		for i, testCase := range suite.TestCases {
+			test := browsedTest{suite: suite, index: i}
+			all = append(all, test)
+			if results.Failed(testCase) {
+				failed = append(failed, test)
+			}
+		}
+	}
+	return all, failed
+}
+
+// testsScreen lists tests along with how they went.
+func (rb *resultsBrowser) testsScreen(title string, tests []browsedTest) *browseScreen {
+	screen := &browseScreen{title: title}
+	for _, test := range tests {
+		testCase := test.suite.TestCases[test.index]
+		outcome := "passed"
+		switch {
+		case results.Skipped(testCase):
+			outcome = "skipped"
+		case results.Failed(testCase):
+			outcome = "FAILED"
+		}
+		screen.lines = append(screen.lines, fmt.Sprintf("[%v] %v", outcome, testCase.Name))
+	}
+	screen.open = func(i int) *browseScreen {
+		return rb.testScreen(tests[i])
+	}
+	return screen
+}
+
+// testScreen shows a test's failure message and output.
+func (rb *resultsBrowser) testScreen(test browsedTest) *browseScreen {
+	testCase := test.suite.TestCases[test.index]
+	screen := &browseScreen{title: test.suite.Name + ": " + testCase.Name}
+	if testCase.FailureMessage != nil {
+		screen.lines = append(screen.lines, "Failure:")
+		screen.lines = append(screen.lines, rb.wrap(testCase.FailureMessage.Message)...)
+	}
+	if testCase.SystemOut != "" {
+		screen.lines = append(screen.lines, "", "Output:")
+		screen.lines = append(screen.lines, rb.wrap(testCase.SystemOut)...)
+	}
+	return screen
+}
+
+// filesScreen lists files to open.
+func (rb *resultsBrowser) filesScreen(title string, paths []string) *browseScreen {
+	return &browseScreen{
+		title: title,
+		lines: paths,
+		open: func(i int) *browseScreen {
+			return rb.fileScreen(paths[i], 0)
+		},
+	}
+}
+
+// fileScreen shows a file, starting at the given line of it.
+func (rb *resultsBrowser) fileScreen(path string, line int) *browseScreen {
+	data, _ := rb.browser.File(path)
+	screen := &browseScreen{title: path}
+	for i, text := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if i == line {
+			screen.offset = len(screen.lines)
+		}
+		screen.lines = append(screen.lines, rb.wrap(text)...)
+	}
+	return screen
+}
+
+// searchScreen lists what Search found for query, each opening the test or
+// the file at the line it was found on.
+func (rb *resultsBrowser) searchScreen(query string) *browseScreen {
+	matches := rb.browser.Search(query)
+	screen := &browseScreen{title: fmt.Sprintf("Search for %q: %d matches", query, len(matches))}
+	for _, match := range matches {
+		if match.Path == "" {
+			screen.lines = append(screen.lines, fmt.Sprintf("test %v: %v", match.Suite, match.Test))
+		} else {
+			screen.lines = append(screen.lines, fmt.Sprintf("%v:%d: %v", match.Path, match.Line, strings.TrimSpace(match.Text)))
+		}
+	}
+	screen.open = func(i int) *browseScreen {
+		match := matches[i]
+		if match.Path != "" {
+			return rb.fileScreen(match.Path, match.Line-1)
+		}
+		all, _ := rb.tests(match.Plugin)
+		for _, test := range all {
+			if test.suite.Name == match.Suite && test.suite.TestCases[test.index].Name == match.Test {
+				return rb.testScreen(test)
+			}
+		}
+		return &browseScreen{title: match.Test}
+	}
+	return screen
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
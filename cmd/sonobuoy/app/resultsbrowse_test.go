@@ -0,0 +1,136 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+)
+
+// scriptedLines reads the given lines as commands, then io.EOF.
+type scriptedLines []string
+
+func (s *scriptedLines) ReadLine() (string, error) {
+	if len(*s) == 0 {
+		return "", io.EOF
+	}
+	line := (*s)[0]
+	*s = (*s)[1:]
+	return line, nil
+}
+
+func TestResultsBrowser(t *testing.T) {
+	files := []struct{ name, contents string }{
+		{"plugins/e2e/results/junit_01.xml", `<testsuite name="e2e" tests="2" failures="1">` +
+			`<testcase name="[sig-network] DNS works"><failure message="timed out">lookup of kubernetes.default timed out</failure></testcase>` +
+			`<testcase name="[sig-apps] Job runs"></testcase></testsuite>`},
+		{"podlogs/kube-system/coredns-1/logs/coredns.txt", "line 1\nline 2\nline 3\nline 4\nDNS lookup failed\n"},
+		{"resources/cluster/Nodes.json", "[]"},
+	}
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, f := range files {
+		tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.contents))})
+		tw.Write([]byte(f.contents))
+	}
+	tw.Close()
+	browser, err := results.NewReaderWithVersion(buf, results.VersionTen).Browse()
+	if err != nil {
+		t.Fatalf("couldn't browse archive: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		commands []string
+		// expect is what the last screen shown has, and unexpected what it
+		// doesn't.
+		expect, unexpected []string
+	}{
+		{
+			name:   "plugins",
+			expect: []string{"   1  e2e: 2 tests, 1 failed", "   2  Pod logs (1)", "   3  Resources (1)"},
+		},
+		{
+			name:       "failed tests",
+			commands:   []string{"1", "1"},
+			expect:     []string{"e2e: failed tests", "[FAILED] [sig-network] DNS works"},
+			unexpected: []string{"Job runs"},
+		},
+		{
+			name:     "failure",
+			commands: []string{"1", "1", "1"},
+			expect:   []string{"Failure:", "lookup of kubernetes.default timed out"},
+		},
+		{
+			name:     "back",
+			commands: []string{"1", "2", "b"},
+			expect:   []string{"Failed tests (1)", "All tests (2)", "Stored files (1)"},
+		},
+		{
+			name:       "paging",
+			commands:   []string{"2", "1", "n"},
+			expect:     []string{"line 4", "DNS lookup failed", "-- 4-5 of 5"},
+			unexpected: []string{"line 3"},
+		},
+		{
+			name:     "search",
+			commands: []string{"/dns lookup"},
+			expect:   []string{`Search for "dns lookup": 1 matches`, "podlogs/kube-system/coredns-1/logs/coredns.txt:5: DNS lookup failed"},
+		},
+		{
+			name:       "search result",
+			commands:   []string{"/dns lookup", "1"},
+			expect:     []string{"DNS lookup failed"},
+			unexpected: []string{"line 3"},
+		},
+		{
+			name:     "no such item",
+			commands: []string{"9"},
+			expect:   []string{"There's no item 9 here."},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			rb := newResultsBrowser(browser, out, 80, 3)
+			rb.clear = "CLEAR\n"
+			commands := scriptedLines(tc.commands)
+			if err := rb.run(&commands); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			screens := strings.Split(out.String(), rb.clear)
+			last := screens[len(screens)-1]
+			for _, s := range tc.expect {
+				if !strings.Contains(last, s) {
+					t.Errorf("expected %q on the screen, got\n%v", s, last)
+				}
+			}
+			for _, s := range tc.unexpected {
+				if strings.Contains(last, s) {
+					t.Errorf("didn't expect %q on the screen, got\n%v", s, last)
+				}
+			}
+		})
+	}
+}
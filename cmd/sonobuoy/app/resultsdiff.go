@@ -0,0 +1,131 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var resultsDiffJSON bool
+
+func newResultsDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff old.tar.gz new.tar.gz",
+		Short: "Compare the test results and cluster resources of two Sonobuoy archives",
+		Long: "Compare the test results and cluster resources of two Sonobuoy archives, such as from before and after a cluster upgrade. " +
+			"Lists the tests that started failing, were fixed or no longer run, and the resources that were added, removed or changed.",
+		Run:  diffResults,
+		Args: cobra.ExactArgs(2),
+	}
+	cmd.Flags().BoolVar(
+		&resultsDiffJSON, "json", false,
+		"Print the differences as JSON.",
+	)
+	return cmd
+}
+
+func diffResults(cmd *cobra.Command, args []string) {
+	before, err := summarizeArchive(args[0])
+	if err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+	after, err := summarizeArchive(args[1])
+	if err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+
+	diff := results.DiffSummaries(before, after)
+	if resultsDiffJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = errors.Wrap(enc.Encode(diff), "couldn't encode diff")
+	} else {
+		err = printResultsDiff(os.Stdout, diff)
+	}
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "could not print diff"))
+		os.Exit(1)
+	}
+}
+
+func summarizeArchive(path string) (*results.Summary, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read sonobuoy archive: %v", path)
+	}
+	reader, err := results.NewReaderFromBytes(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open sonobuoy archive: %v", path)
+	}
+	summary, err := reader.Summary()
+	return summary, errors.Wrapf(err, "could not read sonobuoy archive: %v", path)
+}
+
+func printResultsDiff(w io.Writer, diff *results.Diff) error {
+	tests := diff.Tests
+	fmt.Fprintf(w, "Tests: %d passed, %d failed, %d skipped (was %d passed, %d failed, %d skipped)\n",
+		tests.New.Passed, tests.New.Failed, tests.New.Skipped,
+		tests.Old.Passed, tests.Old.Failed, tests.Old.Skipped,
+	)
+	printTestIDs(w, "Newly failing", tests.NewlyFailing)
+	printTestIDs(w, "Fixed", tests.Fixed)
+	printTestIDs(w, "No longer run", tests.NoLongerRun)
+
+	if len(diff.Resources) == 0 {
+		_, err := fmt.Fprintf(w, "\nNo resources changed\n")
+		return errors.WithStack(err)
+	}
+	fmt.Fprintf(w, "\nResources:\n")
+	for _, resource := range diff.Resources {
+		where := resource.Kind
+		if resource.Namespace != "" {
+			where = resource.Namespace + "/" + resource.Kind
+		}
+		fmt.Fprintf(w, "  %s: %d added, %d removed, %d changed\n", where, len(resource.Added), len(resource.Removed), len(resource.Changed))
+		for _, name := range resource.Added {
+			fmt.Fprintf(w, "    + %s\n", name)
+		}
+		for _, name := range resource.Removed {
+			fmt.Fprintf(w, "    - %s\n", name)
+		}
+		for _, name := range resource.Changed {
+			fmt.Fprintf(w, "    ~ %s\n", name)
+		}
+	}
+	return nil
+}
+
+func printTestIDs(w io.Writer, title string, ids []results.TestID) {
+	if len(ids) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n%s (%d):\n", title, len(ids))
+	for _, id := range ids {
+		fmt.Fprintf(w, "  [%s] %s\n", id.Suite, id.Name)
+	}
+}
@@ -35,6 +35,7 @@ var (
 type receiveFlags struct {
 	namespace string
 	kubecfg   Kubeconfig
+	stream    bool
 }
 
 var rcvFlags receiveFlags
@@ -49,6 +50,10 @@ func init() {
 
 	AddKubeconfigFlag(&rcvFlags.kubecfg, cmd.Flags())
 	AddNamespaceFlag(&rcvFlags.namespace, cmd.Flags())
+	cmd.Flags().BoolVar(
+		&rcvFlags.stream, "stream", false,
+		"Write the results tarball to stdout instead of copying the results directory to a path.",
+	)
 
 	RootCmd.AddCommand(cmd)
 }
@@ -56,6 +61,10 @@ func init() {
 func retrieveResults(cmd *cobra.Command, args []string) {
 	outDir := defaultOutDir
 	if len(args) > 0 {
+		if rcvFlags.stream {
+			errlog.LogError(errors.New("a path can't be given with --stream"))
+			os.Exit(1)
+		}
 		outDir = args[0]
 	}
 
@@ -70,6 +79,15 @@ func retrieveResults(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
+	if rcvFlags.stream {
+		err := sbc.StreamResults(&client.RetrieveConfig{Namespace: rcvFlags.namespace}, os.Stdout)
+		if err != nil {
+			errlog.LogError(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Get a reader that contains the tar output of the results directory.
 	reader, err := sbc.RetrieveResults(&client.RetrieveConfig{Namespace: rcvFlags.namespace})
 	if err != nil {
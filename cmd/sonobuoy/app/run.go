@@ -18,8 +18,10 @@ package app
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -32,6 +34,13 @@ import (
 type runFlags struct {
 	genFlags
 	skipPreflight bool
+	dryRun        bool
+	wait          bool
+	waitInterval  time.Duration
+	waitTimeout   time.Duration
+	retrieve      bool
+	resultsDir    string
+	contexts      []string
 }
 
 var runflags runFlags
@@ -41,6 +50,27 @@ func RunFlagSet(cfg *runFlags) *pflag.FlagSet {
 	// Default to detect since we need kubeconfig regardless
 	runset.AddFlagSet(GenFlagSet(&cfg.genFlags, DetectRBACMode))
 	AddSkipPreflightFlag(&cfg.skipPreflight, runset)
+	AddDryRunFlag(&cfg.dryRun, runset)
+	runset.BoolVar(
+		&cfg.wait, "wait", false,
+		fmt.Sprintf("Wait until the run has completed or failed, then print its status. Exits with %d if the run, or with --retrieve any test, failed.", failedRunExitCode),
+	)
+	runset.DurationVar(
+		&cfg.waitInterval, "wait-interval", 10*time.Second,
+		"How long to wait with --wait before trying again when the status of the run can't be watched",
+	)
+	runset.DurationVar(
+		&cfg.waitTimeout, "wait-timeout", 0,
+		"How long to wait for the run with --wait before giving up. Zero means there's no limit.",
+	)
+	runset.BoolVar(
+		&cfg.retrieve, "retrieve", false,
+		"With --wait, retrieve the results tarball once the run has finished, extract it and summarize the tests.",
+	)
+	runset.StringVar(
+		&cfg.resultsDir, "results-dir", ".",
+		"The directory --retrieve writes the results tarball to and extracts it in.",
+	)
 	return runset
 }
 
@@ -51,9 +81,32 @@ func (r *runFlags) Config() (*ops.RunConfig, error) {
 	}
 	return &ops.RunConfig{
 		GenConfig: *gencfg,
+		DryRun:    r.dryRun,
+		Out:       os.Stdout,
 	}, nil
 }
 
+// RunToCompletionConfig is the config for a run that's waited for, and whose
+// results are retrieved if asked for.
+func (r *runFlags) RunToCompletionConfig() (*ops.RunToCompletionConfig, error) {
+	if r.retrieve && !r.wait {
+		return nil, errors.New("--retrieve needs --wait")
+	}
+	runCfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &ops.RunToCompletionConfig{
+		RunConfig:    *runCfg,
+		WaitInterval: r.waitInterval,
+		WaitTimeout:  r.waitTimeout,
+	}
+	if r.retrieve {
+		cfg.ResultsDir = r.resultsDir
+	}
+	return cfg, nil
+}
+
 func init() {
 	cmd := &cobra.Command{
 		Use:   "run",
@@ -63,10 +116,16 @@ func init() {
 	}
 
 	cmd.Flags().AddFlagSet(RunFlagSet(&runflags))
+	AddContextsFlag(&runflags.contexts, cmd.Flags())
 	RootCmd.AddCommand(cmd)
 }
 
 func submitSonobuoyRun(cmd *cobra.Command, args []string) {
+	if len(runflags.contexts) > 0 {
+		submitFleetRun(runflags.contexts)
+		return
+	}
+
 	restConfig, err := runflags.kubecfg.Get()
 	if err != nil {
 		errlog.LogError(errors.Wrap(err, "couldn't get REST client"))
@@ -90,12 +149,16 @@ func submitSonobuoyRun(cmd *cobra.Command, args []string) {
 	for _, plugin := range m.Selectors {
 		plugins = append(plugins, plugin.Name)
 	}
-	if len(plugins) > 0 {
+	// The manifest is all a dry run prints.
+	if len(plugins) > 0 && !runflags.dryRun {
 		fmt.Printf("Running plugins: %v\n", strings.Join(plugins, ", "))
 	}
 
 	if !runflags.skipPreflight {
-		if errs := sbc.PreflightChecks(&ops.PreflightConfig{runflags.namespace}); len(errs) > 0 {
+		if errs := sbc.PreflightChecks(&ops.PreflightConfig{
+			Namespace:       runflags.runNamespace(),
+			NamespaceScoped: runflags.namespaceScoped,
+		}); len(errs) > 0 {
 			errlog.LogError(errors.New("Preflight checks failed"))
 			for _, err := range errs {
 				errlog.LogError(err)
@@ -104,8 +167,43 @@ func submitSonobuoyRun(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	if err := sbc.Run(cfg); err != nil {
+	if !runflags.wait {
+		if err := sbc.Run(cfg); err != nil {
+			errlog.LogError(errors.Wrap(err, "error attempting to run sonobuoy"))
+			os.Exit(1)
+		}
+		return
+	}
+
+	completionCfg, err := runflags.RunToCompletionConfig()
+	if err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+	run, err := sbc.RunToCompletion(completionCfg)
+	if run != nil {
+		if printErr := printCompletedRun(os.Stdout, run); printErr != nil {
+			errlog.LogError(printErr)
+		}
+	}
+	if err != nil {
 		errlog.LogError(errors.Wrap(err, "error attempting to run sonobuoy"))
 		os.Exit(1)
 	}
+	if run.Failed() {
+		os.Exit(failedRunExitCode)
+	}
+}
+
+// printCompletedRun prints the final status of a run, and where its results
+// were retrieved to and a summary of its tests if they were.
+func printCompletedRun(w io.Writer, run *ops.CompletedRun) error {
+	if err := printSummary(w, run.Status); err != nil {
+		return err
+	}
+	if run.Tarball == "" {
+		return nil
+	}
+	fmt.Fprintf(w, "\nResults retrieved to %v and extracted into %v\n\n", run.Tarball, run.ResultsDir)
+	return printTestCounts(w, run.Counts)
 }
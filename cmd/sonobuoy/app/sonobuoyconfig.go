@@ -17,12 +17,12 @@ limitations under the License.
 package app
 
 import (
-	"encoding/json"
 	"io/ioutil"
 
 	"github.com/heptio/sonobuoy/pkg/client"
 	"github.com/heptio/sonobuoy/pkg/config"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 )
 
@@ -42,16 +42,21 @@ func (c *SonobuoyConfig) String() string {
 // Type is needed for pflag.Value.
 func (c *SonobuoyConfig) Type() string { return "Sonobuoy config" }
 
-// Set attempts to read a file, then deserialise the json into a config.Config struct.
+// Set attempts to read a file, then deserialise the json into a config.Config
+// struct, converted to the current config.APIVersion.
 func (c *SonobuoyConfig) Set(str string) error {
 	bytes, err := ioutil.ReadFile(str)
 	if err != nil {
 		return errors.Wrap(err, "cloudn't open config file")
 	}
 
-	if err := json.Unmarshal(bytes, &c.Config); err != nil {
+	warnings, err := config.Decode(bytes, &c.Config)
+	if err != nil {
 		return errors.Wrap(err, "couldn't Unmarshal sonobuoy config")
 	}
+	for _, warning := range warnings {
+		logrus.WithField("config", str).Warning(warning)
+	}
 
 	c.raw = string(bytes)
 	return nil
@@ -17,11 +17,13 @@ limitations under the License.
 package app
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"sort"
 	"text/tabwriter"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -35,8 +37,25 @@ var statusFlags struct {
 	namespace string
 	kubecfg   Kubeconfig
 	showAll   bool
+	json      bool
+	format    string
+	wait      bool
+	interval  time.Duration
+	timeout   time.Duration
+	contexts  []string
 }
 
+// Formats status can print the status in, besides JSON.
+const (
+	statusFormatSummary = "summary"
+	statusFormatWide    = "wide"
+)
+
+// failedRunExitCode is what `sonobuoy status --wait` and `sonobuoy run --wait`
+// exit with when the run failed, or for the latter any tests did, to tell it
+// apart from not being able to run or get the status at all.
+const failedRunExitCode = 2
+
 func init() {
 	cmd := &cobra.Command{
 		Use:   "status",
@@ -48,10 +67,34 @@ func init() {
 
 	AddNamespaceFlag(&statusFlags.namespace, flags)
 	AddKubeconfigFlag(&statusFlags.kubecfg, flags)
+	AddContextsFlag(&statusFlags.contexts, flags)
 	flags.BoolVar(
 		&statusFlags.showAll, "show-all", false,
 		"Don't summarize plugin statuses, show all individually",
 	)
+	flags.BoolVar(
+		&statusFlags.json, "json", false,
+		"Print the full status, including progress, heartbeats and which nodes have reported, as JSON",
+	)
+	flags.StringVar(
+		&statusFlags.format, "format", statusFormatSummary,
+		fmt.Sprintf(
+			"How to print the status, options are [%v (default) or %v]. %v shows every plugin individually with the pod running it, its node, when it started and when its status last changed.",
+			statusFormatSummary, statusFormatWide, statusFormatWide,
+		),
+	)
+	flags.BoolVar(
+		&statusFlags.wait, "wait", false,
+		fmt.Sprintf("Wait until the run has completed or failed, then print its status. Exits with %d if the run failed.", failedRunExitCode),
+	)
+	flags.DurationVar(
+		&statusFlags.interval, "wait-interval", 10*time.Second,
+		"How long to wait with --wait before trying again when the status of the run can't be watched",
+	)
+	flags.DurationVar(
+		&statusFlags.timeout, "wait-timeout", 0,
+		"How long to wait for the run with --wait before giving up. Zero means there's no limit.",
+	)
 
 	RootCmd.AddCommand(cmd)
 }
@@ -59,6 +102,17 @@ func init() {
 // TODO (timothysc) summarize and aggregate daemonset-plugins by status done (24) running (24)
 // also --show-all
 func getStatus(cmd *cobra.Command, args []string) {
+	switch statusFlags.format {
+	case statusFormatSummary, statusFormatWide:
+	default:
+		errlog.LogError(fmt.Errorf("unknown format %q, options are [%v or %v]", statusFlags.format, statusFormatSummary, statusFormatWide))
+		os.Exit(1)
+	}
+	if len(statusFlags.contexts) > 0 {
+		getFleetStatus(statusFlags.contexts)
+		return
+	}
+
 	config, err := statusFlags.kubecfg.Get()
 	if err != nil {
 		errlog.LogError(errors.Wrap(err, "couldn't get kubernetes config"))
@@ -70,21 +124,51 @@ func getStatus(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	status, err := sbc.GetStatus(statusFlags.namespace)
+	var status *aggregation.Status
+	if statusFlags.wait {
+		status, err = sbc.WaitForRun(&ops.WaitConfig{
+			Namespace: statusFlags.namespace,
+			Interval:  statusFlags.interval,
+			Timeout:   statusFlags.timeout,
+		})
+	} else {
+		status, err = sbc.GetStatus(statusFlags.namespace)
+	}
 	if err != nil {
 		errlog.LogError(errors.Wrap(err, "error attempting to run sonobuoy"))
 		os.Exit(1)
 	}
 
-	if statusFlags.showAll {
+	switch {
+	case statusFlags.json:
+		err = printJSON(os.Stdout, status)
+	case statusFlags.showAll:
 		err = printAll(os.Stdout, status)
-	} else {
+	case statusFlags.format == statusFormatWide:
+		err = printWide(os.Stdout, status)
+	default:
 		err = printSummary(os.Stdout, status)
 	}
 	if err != nil {
 		errlog.LogError(err)
 		os.Exit(1)
 	}
+
+	if statusFlags.wait && status.Status == aggregation.FailedStatus {
+		os.Exit(failedRunExitCode)
+	}
+}
+
+// printRunStatus prints the status of the run as a whole, warning if the
+// aggregator is holding back results for lack of space.
+func printRunStatus(w io.Writer, status *aggregation.Status) {
+	fmt.Fprintf(w, "\n%s\n", humanReadableStatus(status.Status))
+	if status.Disk != nil && status.Disk.Low {
+		fmt.Fprintf(
+			w, "WARNING: the aggregator is low on space, with %v of %v bytes free. Results are held back until there's more.\n",
+			status.Disk.FreeBytes, status.Disk.TotalBytes,
+		)
+	}
 }
 
 func humanReadableStatus(str string) string {
@@ -100,30 +184,97 @@ func humanReadableStatus(str string) string {
 	}
 }
 
+// humanReadableProgress describes how far along a running plugin is, if it
+// has said.
+func humanReadableProgress(status aggregation.PluginStatus) string {
+	if status.Status != aggregation.RunningStatus || status.Progress == nil {
+		return ""
+	}
+	if status.Progress.Total <= 0 {
+		return fmt.Sprintf("%d", status.Progress.Completed)
+	}
+	return fmt.Sprintf("%d/%d (%d%%)", status.Progress.Completed, status.Progress.Total, status.Progress.Percent())
+}
+
+// jsonStatus is the status printed by --json, with a per-node breakdown of
+// plugins that run on every node.
+type jsonStatus struct {
+	*aggregation.Status
+	Nodes []aggregation.PluginNodes `json:"nodes,omitempty"`
+}
+
+func printJSON(w io.Writer, status *aggregation.Status) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	out := jsonStatus{Status: status, Nodes: status.NodeBreakdown()}
+	return errors.Wrap(encoder.Encode(out), "couldn't write status out")
+}
+
 func printAll(w io.Writer, status *aggregation.Status) error {
 	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', tabwriter.AlignRight)
 
-	fmt.Fprintf(tw, "PLUGIN\tNODE\tSTATUS\n")
+	fmt.Fprintf(tw, "PLUGIN\tNODE\tSTATUS\tPROGRESS\n")
 	for _, pluginStatus := range status.Plugins {
-		fmt.Fprintf(tw, "%s\t%s\t%s\n", pluginStatus.Plugin, pluginStatus.Node, pluginStatus.Status)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", pluginStatus.Plugin, pluginStatus.Node, pluginStatus.Status, humanReadableProgress(pluginStatus))
 	}
 
 	if err := tw.Flush(); err != nil {
 		return errors.Wrap(err, "couldn't write status out")
 	}
 
-	fmt.Fprintf(w, "\n%s\n", humanReadableStatus(status.Status))
+	printRunStatus(w, status)
+	return nil
+}
+
+// printWide prints every plugin individually, like printAll, along with the
+// pod running it and when it started and last changed status, so its pod can
+// be found without looking it up by its labels.
+func printWide(w io.Writer, status *aggregation.Status) error {
+	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', tabwriter.AlignRight)
+
+	fmt.Fprintf(tw, "PLUGIN\tNODE\tSTATUS\tPOD\tPOD NODE\tSTARTED\tLAST TRANSITION\tPROGRESS\n")
+	for _, pluginStatus := range status.Plugins {
+		fmt.Fprintf(
+			tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			pluginStatus.Plugin, pluginStatus.Node, pluginStatus.Status, pluginStatus.Pod, pluginStatus.PodNode,
+			formatStatusTime(pluginStatus.StartTime), formatStatusTime(pluginStatus.LastTransition), humanReadableProgress(pluginStatus),
+		)
+	}
+
+	if err := tw.Flush(); err != nil {
+		return errors.Wrap(err, "couldn't write status out")
+	}
+
+	printRunStatus(w, status)
 	return nil
 }
 
+// formatStatusTime formats a time in the status, if it's set.
+func formatStatusTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
 func printSummary(w io.Writer, status *aggregation.Status) error {
 	tw := tabwriter.NewWriter(w, 1, 8, 1, '\t', tabwriter.AlignRight)
 	totals := map[string]map[string]int{}
+	// progress sums up the progress of each plugin's running instances
+	progress := map[string]*aggregation.ProgressUpdate{}
 	for _, plugin := range status.Plugins {
 		if _, ok := totals[plugin.Plugin]; !ok {
 			totals[plugin.Plugin] = make(map[string]int)
 		}
 		totals[plugin.Plugin][plugin.Status]++
+
+		if plugin.Status == aggregation.RunningStatus && plugin.Progress != nil {
+			if _, ok := progress[plugin.Plugin]; !ok {
+				progress[plugin.Plugin] = &aggregation.ProgressUpdate{}
+			}
+			progress[plugin.Plugin].Completed += plugin.Progress.Completed
+			progress[plugin.Plugin].Total += plugin.Progress.Total
+		}
 	}
 
 	// sort everything nicely
@@ -138,16 +289,20 @@ func printSummary(w io.Writer, status *aggregation.Status) error {
 		}
 	}
 	sort.Sort(summaries)
-	fmt.Fprintf(tw, "PLUGIN\tSTATUS\tCOUNT\n")
+	fmt.Fprintf(tw, "PLUGIN\tSTATUS\tCOUNT\tPROGRESS\n")
 	for _, summary := range summaries {
-		fmt.Fprintf(tw, "%s\t%s\t%d\n", summary.plugin, summary.status, summary.count)
+		summaryProgress := ""
+		if p, ok := progress[summary.plugin]; ok && summary.status == aggregation.RunningStatus {
+			summaryProgress = fmt.Sprintf("%d%%", p.Percent())
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", summary.plugin, summary.status, summary.count, summaryProgress)
 	}
 
 	if err := tw.Flush(); err != nil {
 		return errors.Wrap(err, "couldn't write status out")
 	}
 
-	fmt.Fprintf(w, "\n%s\n", humanReadableStatus(status.Status))
+	printRunStatus(w, status)
 	return nil
 }
 
@@ -18,25 +18,29 @@ package app
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
 )
 
-var expectedSummary = `PLUGIN		STATUS		COUNT
-e2e		complete	1
-systemd_logs	complete	1
-systemd_logs	running		2
+var expectedSummary = `PLUGIN		STATUS		COUNT	PROGRESS
+e2e		complete	1	
+systemd_logs	complete	1	
+systemd_logs	running		2	75%
 
 Sonobuoy is still running. Runs can take up to 60 minutes.
 `
 
-var expectedShowAll = `PLUGIN		NODE	STATUS
-e2e			complete
-systemd_logs	node01	running
-systemd_logs	node02	complete
-systemd_logs	node03	running
+var expectedShowAll = `PLUGIN		NODE	STATUS		PROGRESS
+e2e			complete	
+systemd_logs	node01	running		30/40 (75%)
+systemd_logs	node02	complete	
+systemd_logs	node03	running		
 
 Sonobuoy is still running. Runs can take up to 60 minutes.
 `
@@ -53,6 +57,10 @@ var exampleStatus = aggregation.Status{
 			Plugin: "systemd_logs",
 			Node:   "node01",
 			Status: "running",
+			Progress: &aggregation.ProgressUpdate{
+				Completed: 30,
+				Total:     40,
+			},
 		},
 		{
 			Plugin: "systemd_logs",
@@ -63,6 +71,7 @@ var exampleStatus = aggregation.Status{
 			Plugin: "systemd_logs",
 			Node:   "node03",
 			Status: "running",
+			Error:  "checksum mismatch",
 		},
 	},
 }
@@ -99,3 +108,80 @@ func TestPrintStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestPrintRunStatus_lowDisk(t *testing.T) {
+	var b bytes.Buffer
+	printRunStatus(&b, &aggregation.Status{
+		Status: aggregation.RunningStatus,
+		Disk:   &aggregation.DiskUsage{FreeBytes: 1024, TotalBytes: 4096, Low: true},
+	})
+	if !strings.Contains(b.String(), "WARNING: the aggregator is low on space, with 1024 of 4096 bytes free.") {
+		t.Errorf("expected a warning about the aggregator's disk space, got %q", b.String())
+	}
+}
+
+func TestPrintWide(t *testing.T) {
+	started := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	changed := started.Add(90 * time.Second)
+	status := aggregation.Status{
+		Status: "running",
+		Plugins: []aggregation.PluginStatus{
+			{
+				Plugin:         "e2e",
+				Status:         "complete",
+				Pod:            "sonobuoy-e2e-job-1234",
+				PodNode:        "node02",
+				StartTime:      &started,
+				LastTransition: &changed,
+			},
+			{
+				Plugin:         "systemd_logs",
+				Node:           "node01",
+				Status:         "running",
+				Pod:            "sonobuoy-systemd-logs-daemon-set-abcd",
+				PodNode:        "node01",
+				LastTransition: &started,
+				Progress:       &aggregation.ProgressUpdate{Completed: 30, Total: 40},
+			},
+		},
+	}
+	expected := `PLUGIN		NODE	STATUS		POD					POD NODE	STARTED			LAST TRANSITION		PROGRESS
+e2e			complete	sonobuoy-e2e-job-1234			node02		2018-06-01T12:00:00Z	2018-06-01T12:01:30Z	
+systemd_logs	node01	running		sonobuoy-systemd-logs-daemon-set-abcd	node01					2018-06-01T12:00:00Z	30/40 (75%)
+
+Sonobuoy is still running. Runs can take up to 60 minutes.
+`
+
+	var b bytes.Buffer
+	if err := printWide(&b, &status); err != nil {
+		t.Fatalf("expected err to be nil, got %v", err)
+	}
+	if b.String() != expected {
+		t.Errorf("expected output to be %q, got %q", expected, b.String())
+	}
+}
+
+func TestPrintJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := printJSON(&b, &exampleStatus); err != nil {
+		t.Fatalf("expected err to be nil, got %v", err)
+	}
+
+	var status aggregation.Status
+	if err := json.Unmarshal(b.Bytes(), &status); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", b.String(), err)
+	}
+	if !reflect.DeepEqual(status, exampleStatus) {
+		t.Errorf("expected status to round trip, got %+v", status)
+	}
+
+	var breakdown struct {
+		Nodes []aggregation.PluginNodes `json:"nodes"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &breakdown); err != nil {
+		t.Fatalf("expected JSON output, got %q: %v", b.String(), err)
+	}
+	if !reflect.DeepEqual(breakdown.Nodes, exampleStatus.NodeBreakdown()) {
+		t.Errorf("expected node breakdown %+v, got %+v", exampleStatus.NodeBreakdown(), breakdown.Nodes)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type submitConformanceFlags struct {
+	product   string
+	readme    string
+	outputDir string
+}
+
+var submitConformanceflags submitConformanceFlags
+
+func newSubmitConformanceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "submit-conformance archive.tar.gz",
+		Short: "Check a Sonobuoy archive against the CNCF conformance submission requirements and lay out the submission",
+		Long: "Check a Sonobuoy archive against the CNCF conformance submission requirements and lay out the submission. " +
+			"The e2e results must come from a run of every conformance test, and only those, with none failing, and the product metadata must be complete. " +
+			"If they are, the PRODUCT.yaml, README.md, e2e.log and junit_01.xml are written to <output-dir>/<version>/<product>, " +
+			"ready to be added to a pull request to github.com/cncf/k8s-conformance.",
+		Run:  submitConformance,
+		Args: cobra.ExactArgs(1),
+	}
+	cmd.Flags().StringVar(
+		&submitConformanceflags.product, "product", results.ConformanceProductFile,
+		"The PRODUCT.yaml describing the product the results are for.",
+	)
+	cmd.Flags().StringVar(
+		&submitConformanceflags.readme, "readme", "",
+		"A README.md describing how to reproduce the results. If not set, one is generated that refers to the product's documentation to create the cluster.",
+	)
+	cmd.Flags().StringVar(
+		&submitConformanceflags.outputDir, "output-dir", ".",
+		"The directory to lay out the submission in, such as a clone of github.com/cncf/k8s-conformance.",
+	)
+	return cmd
+}
+
+func submitConformance(cmd *cobra.Command, args []string) {
+	submission, err := loadConformanceSubmission(args[0], submitConformanceflags)
+	if err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+
+	if problems := submission.Validate(); len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "The results can't be submitted:\n")
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "  - %v\n", problem)
+		}
+		os.Exit(1)
+	}
+
+	dir, err := submission.Dir()
+	if err == nil {
+		var files map[string][]byte
+		if files, err = submission.Files(); err == nil {
+			err = writeFiles(submitConformanceflags.outputDir, files)
+		}
+	}
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "could not write conformance submission"))
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote conformance submission to %v\n", filepath.Join(submitConformanceflags.outputDir, dir))
+	if submitConformanceflags.readme == "" {
+		fmt.Printf("Check that the generated %v describes how to create the cluster.\n", results.ConformanceREADMEFile)
+	}
+}
+
+func loadConformanceSubmission(archive string, flags submitConformanceFlags) (*results.ConformanceSubmission, error) {
+	data, err := ioutil.ReadFile(archive)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read sonobuoy archive: %v", archive)
+	}
+	reader, err := results.NewReaderFromBytes(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open sonobuoy archive")
+	}
+	conformance, err := reader.ConformanceResults()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read conformance results")
+	}
+
+	submission := &results.ConformanceSubmission{Results: conformance}
+	if submission.Product, err = ioutil.ReadFile(flags.product); err != nil {
+		return nil, errors.Wrapf(err, "could not read product metadata: %v", flags.product)
+	}
+	if flags.readme != "" {
+		if submission.README, err = ioutil.ReadFile(flags.readme); err != nil {
+			return nil, errors.Wrapf(err, "could not read README: %v", flags.readme)
+		}
+	}
+	return submission, nil
+}
@@ -17,23 +17,40 @@ limitations under the License.
 package app
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/heptio/sonobuoy/pkg/errlog"
 	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/heptio/sonobuoy/pkg/tracing"
 	"github.com/heptio/sonobuoy/pkg/worker"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+// singleNodeSleep is how long the single-node worker sleeps after submitting
+// results, so that DaemonSet pods without a sleeping entrypoint script (such
+// as those on Windows nodes) aren't restarted.
+var singleNodeSleep time.Duration
+
 func init() {
+	singleNodeCmd.Flags().DurationVar(
+		&singleNodeSleep, "sleep", 0,
+		"How long to sleep after submitting results, even if submitting them failed.",
+	)
 	workerCmd.AddCommand(singleNodeCmd)
 	workerCmd.AddCommand(globalCmd)
+	workerCmd.AddCommand(tokenCmd)
+	workerCmd.AddCommand(payloadCmd)
 
 	RootCmd.AddCommand(workerCmd)
 }
@@ -60,6 +77,20 @@ var singleNodeCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(0),
 }
 
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Write the plugin's service account token and kubeconfig before it starts",
+	Run:   runWriteToken,
+	Args:  cobra.ExactArgs(0),
+}
+
+var payloadCmd = &cobra.Command{
+	Use:   "payload",
+	Short: "Download the plugin's files from the master before it starts",
+	Run:   runDownloadPayload,
+	Args:  cobra.ExactArgs(0),
+}
+
 func runGather(cmd *cobra.Command, args []string) {
 	cmd.Help()
 }
@@ -107,8 +138,12 @@ func runGatherSingleNode(cmd *cobra.Command, args []string) {
 	// A single-node results URL looks like:
 	// http://sonobuoy-master:8080/api/v1/results/by-node/node1/systemd_logs
 	url := cfg.MasterURL + "/" + cfg.NodeName + "/" + cfg.ResultType
+	result := plugin.ExpectedResult{NodeName: cfg.NodeName, ResultType: cfg.ResultType}
 
-	err = worker.GatherResults(cfg.ResultsDir+"/done", url, client)
+	err = gatherResults(cfg, result, url, client)
+	if singleNodeSleep > 0 {
+		time.Sleep(singleNodeSleep)
+	}
 	if err != nil {
 		errlog.LogError(err)
 		os.Exit(1)
@@ -131,14 +166,136 @@ func runGatherGlobal(cmd *cobra.Command, args []string) {
 	// A global results URL looks like:
 	// http://sonobuoy-master:8080/api/v1/results/global/systemd_logs
 	url := cfg.MasterURL + "/" + cfg.ResultType
+	result := plugin.ExpectedResult{ResultType: cfg.ResultType}
 
-	err = worker.GatherResults(cfg.ResultsDir+"/done", url, client)
+	err = gatherResults(cfg, result, url, client)
 	if err != nil {
 		errlog.LogError(err)
 		os.Exit(1)
 	}
 }
 
+func runWriteToken(cmd *cobra.Command, args []string) {
+	cfg, err := worker.LoadConfig()
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "error loading agent configuration"))
+		os.Exit(1)
+	}
+	if cfg.TokenDir == "" {
+		errlog.LogError(errors.New("TokenDir not set"))
+		os.Exit(1)
+	}
+
+	if _, err := worker.WriteServiceAccountToken(cfg); err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+}
+
+func runDownloadPayload(cmd *cobra.Command, args []string) {
+	cfg, err := worker.LoadConfig()
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "error loading agent configuration"))
+		os.Exit(1)
+	}
+	if cfg.MasterURL == "" || cfg.ResultType == "" || cfg.PayloadDir == "" {
+		errlog.LogError(errors.New("MasterURL, ResultType and PayloadDir must be set"))
+		os.Exit(1)
+	}
+
+	client, err := getHTTPClient(cfg)
+	if err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+
+	url := aggregation.PayloadURL(cfg.MasterURL, cfg.ResultType)
+	if err := worker.DownloadPayload(url, client, cfg.PayloadDir); err != nil {
+		errlog.LogError(err)
+		os.Exit(1)
+	}
+}
+
+// gatherResults waits for the plugin to finish and submits its results,
+// streaming them if the plugin asked for it, or reporting them repeatedly if
+// it's one of several replicas. Meanwhile, heartbeats and any progress the
+// plugin reports are sent to the master, and the plugin's service account
+// token is kept fresh if it has one. Workers that can't reach the master
+// store the results for it to fetch instead. If the run is traced, all of this
+// is traced as part of it.
+func gatherResults(cfg *plugin.WorkerConfig, result plugin.ExpectedResult, url string, client *http.Client) (err error) {
+	// A nil transport has to stay a nil interface for the default one to be
+	// used.
+	var external http.RoundTripper
+	if cfg.CABundle != "" {
+		transport, err := caBundleTransport(cfg.CABundle)
+		if err != nil {
+			return err
+		}
+		external = transport
+	}
+
+	tracer := tracing.NewTracerWithTransport(cfg.TracingEndpoint, "sonobuoy-worker", map[string]string{
+		"sonobuoy.result_type": cfg.ResultType,
+		"sonobuoy.node":        cfg.NodeName,
+	}, external)
+	defer tracer.Shutdown()
+	parent, parseErr := tracing.ParseTraceparent(cfg.TraceParent)
+	if tracer != nil && parseErr != nil {
+		logrus.WithError(parseErr).Warning("Tracing the worker on its own")
+	}
+	span := tracer.Start("worker", parent, nil)
+	defer func() { span.End(err) }()
+	worker.SetTraceSpan(span)
+
+	worker.SetRetryPolicy(worker.RetryPolicyFromConfig(cfg))
+	if err := worker.SetCompression(cfg.ResultsCompression); err != nil {
+		return err
+	}
+	if err := worker.SetProtocol(cfg.ResultsProtocol); err != nil {
+		return err
+	}
+	worker.SetPluginTimeout(time.Duration(cfg.TimeoutSeconds) * time.Second)
+	if cfg.TimeoutSeconds > 0 {
+		worker.SetPluginPod(cfg.Namespace, cfg.PodName)
+	}
+	worker.SetResultsToken(cfg.ResultsToken)
+	worker.SetExternalTransport(external)
+	if err := worker.SetExternalResults(cfg.ExternalResultsURL, cfg.ExternalResultsAuthorization); err != nil {
+		return err
+	}
+	if err := worker.SetResultsTransport(cfg.ResultsTransport, result); err != nil {
+		return err
+	}
+
+	if cfg.TokenDir != "" {
+		stopToken := make(chan struct{})
+		defer close(stopToken)
+		go worker.KeepServiceAccountToken(cfg, stopToken)
+	}
+
+	ctx, cancel := worker.WithShutdownSignals(context.Background())
+	defer cancel()
+
+	waitfile := filepath.Join(cfg.ResultsDir, "done")
+	if cfg.LocalResultsDir != "" {
+		return worker.StoreLocalResults(ctx, waitfile, aggregation.LocalResultsDir(cfg.LocalResultsDir, result))
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go worker.RelayProgress(filepath.Join(cfg.ResultsDir, "progress"), aggregation.ProgressURL(url), client, stop)
+	go worker.SendHeartbeats(aggregation.HeartbeatURL(url), client, stop)
+
+	if cfg.ReplicaName != "" {
+		return worker.ReportReplicaResults(ctx, waitfile, cfg.ReplicaName, url, client)
+	}
+	if cfg.ResultsStream != "" {
+		return worker.StreamResults(ctx, waitfile, cfg.ResultsStream, url, client)
+	}
+	return worker.GatherResults(ctx, waitfile, url, client)
+}
+
 func getHTTPClient(cfg *plugin.WorkerConfig) (*http.Client, error) {
 	caCertDER, _ := pem.Decode([]byte(cfg.CACert))
 	if caCertDER == nil {
@@ -168,9 +325,17 @@ func getHTTPClient(cfg *plugin.WorkerConfig) (*http.Client, error) {
 
 	certPool := x509.NewCertPool()
 	certPool.AddCert(caCert)
+	if cfg.CABundle != "" {
+		if !certPool.AppendCertsFromPEM([]byte(cfg.CABundle)) {
+			return nil, errors.New("Couldn't parse CaBundle PEM")
+		}
+	}
 
+	// Proxies are taken from HTTP_PROXY, HTTPS_PROXY and NO_PROXY, like
+	// they are for gRPC.
 	return &http.Client{
 		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
 			TLSClientConfig: &tls.Config{
 				Certificates: []tls.Certificate{
 					{
@@ -184,3 +349,25 @@ func getHTTPClient(cfg *plugin.WorkerConfig) (*http.Client, error) {
 		},
 	}, nil
 }
+
+// caBundleTransport returns a transport trusting the certificates in the
+// bundle along with the system's, for what the worker sends elsewhere than the
+// master, such as trace spans. Like the default transport, it takes proxies
+// from the environment.
+func caBundleTransport(bundle string) (*http.Transport, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM([]byte(bundle)) {
+		return nil, errors.New("Couldn't parse CaBundle PEM")
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		TLSClientConfig:       &tls.Config{RootCAs: pool},
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}, nil
+}
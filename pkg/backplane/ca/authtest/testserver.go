@@ -53,6 +53,9 @@ func NewTLSServer(handle http.Handler, t *testing.T) *Server {
 	}
 	srv := httptest.NewUnstartedServer(handle)
 	srv.TLS = cfg
+	// HTTP/2 is needed for gRPC. The server negotiates it with ALPN, falling
+	// back to HTTP/1.1 for clients that don't offer it.
+	srv.TLS.NextProtos = []string{"h2", "http/1.1"}
 	srv.StartTLS()
 	return &Server{
 		Server: srv,
@@ -63,19 +66,26 @@ func NewTLSServer(handle http.Handler, t *testing.T) *Server {
 
 // Client wraps httptest.Server.Client(), injecting our CA and client cert
 func (s *Server) Client() *http.Client {
+	return s.ClientWithName("client1.local")
+}
+
+// ClientWithName is Client, but with a client cert for the given name. Each
+// call returns a new client, so clients for different names can be used side
+// by side.
+func (s *Server) ClientWithName(name string) *http.Client {
 	if s.auth == nil {
 		return s.Server.Client()
 	}
-	clientCert, err := s.auth.ClientKeyPair("client1.local")
+	clientCert, err := s.auth.ClientKeyPair(name)
 	if err != nil {
 		s.t.Fatalf("couldn't get client cert %v", err)
 	}
-	client := s.Server.Client()
-	client.Transport = &http.Transport{
-		TLSClientConfig: &tls.Config{
-			Certificates: []tls.Certificate{*clientCert},
-			RootCAs:      s.auth.CACertPool(),
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				Certificates: []tls.Certificate{*clientCert},
+				RootCAs:      s.auth.CACertPool(),
+			},
 		},
 	}
-	return client
 }
@@ -24,6 +24,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
 	"math/big"
 	"net"
 	"sync"
@@ -81,6 +82,48 @@ func NewAuthority() (*Authority, error) {
 	return auth, nil
 }
 
+// LoadAuthority restores a certificate authority saved with EncodePEM, so
+// that certificates it issued before are still trusted.
+func LoadAuthority(certPEM, keyPEM []byte) (*Authority, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, errors.New("couldn't decode certificate authority root certificate")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't parse certificate authority root certificate")
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, errors.New("couldn't decode certificate authority private key")
+	}
+	privKey, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't parse certificate authority private key")
+	}
+
+	return &Authority{
+		privKey: privKey,
+		cert:    cert,
+		// Serials restart from the time the authority was loaded, so they
+		// don't collide with those of certificates issued before.
+		lastSerial: big.NewInt(time.Now().UnixNano()),
+	}, nil
+}
+
+// EncodePEM returns the authority's root certificate and private key, PEM
+// encoded, so that it can be saved and restored with LoadAuthority.
+func (a *Authority) EncodePEM() (certPEM, keyPEM []byte, err error) {
+	keyDER, err := x509.MarshalECPrivateKey(a.privKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "couldn't marshal certificate authority private key")
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: a.cert.Raw})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
 // makeCert takes a public key and a function to mutate the certificate template with updated parameters
 func (a *Authority) makeCert(pub crypto.PublicKey, mut func(*x509.Certificate)) (*x509.Certificate, error) {
 
@@ -140,3 +140,41 @@ func TestServer(t *testing.T) {
 		t.Errorf("expected %s, got %s", testString, respBody)
 	}
 }
+
+func TestLoadAuthority(t *testing.T) {
+	auth, err := NewAuthority()
+	if err != nil {
+		t.Fatalf("Couldn't create certificate authority")
+	}
+	clientCert, err := auth.ClientKeyPair("client1.local")
+	if err != nil {
+		t.Fatalf("couldn't get client cert %v", err)
+	}
+
+	certPEM, keyPEM, err := auth.EncodePEM()
+	if err != nil {
+		t.Fatalf("couldn't encode certificate authority: %v", err)
+	}
+	loaded, err := LoadAuthority(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("couldn't load certificate authority: %v", err)
+	}
+
+	// Certificates issued before and after loading should both verify.
+	newCert, err := loaded.ClientKeyPair("client2.local")
+	if err != nil {
+		t.Fatalf("couldn't get client cert from loaded authority %v", err)
+	}
+	for _, cert := range []*tls.Certificate{clientCert, newCert} {
+		_, err = cert.Leaf.Verify(x509.VerifyOptions{
+			Roots:     loaded.CACertPool(),
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err != nil {
+			t.Errorf("Expected %v to verify, got error %v", cert.Leaf.Subject.CommonName, err)
+		}
+	}
+	if newCert.Leaf.SerialNumber.Cmp(clientCert.Leaf.SerialNumber) == 0 {
+		t.Errorf("expected a new serial number, got %v again", newCert.Leaf.SerialNumber)
+	}
+}
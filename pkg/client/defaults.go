@@ -44,7 +44,7 @@ func NewRunConfig() *RunConfig {
 // NewDeleteConfig is a DeleteConfig using default images, RBAC enabled, and DeleteAll enabled.
 func NewDeleteConfig() *DeleteConfig {
 	return &DeleteConfig{
-		Namespace:  config.DefaultImage,
+		Namespace:  config.DefaultNamespace,
 		EnableRBAC: true,
 		DeleteAll:  false,
 	}
@@ -17,12 +17,18 @@ limitations under the License.
 package client
 
 import (
+	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
 	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -33,96 +39,454 @@ const (
 	e2eNamespacePrefix = "e2e-"
 )
 
-func (c *SonobuoyClient) Delete(cfg *DeleteConfig) error {
+var (
+	// waitPollInterval is how often Delete checks whether what it deleted is
+	// gone, when it waits.
+	waitPollInterval = 2 * time.Second
+	// stuckAfter is how long a resource can take to be deleted before what's
+	// holding it up is reported.
+	stuckAfter = 30 * time.Second
+)
+
+// DeletedResource is a resource deleted by Delete.
+type DeletedResource struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+func (r DeletedResource) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%v/%v", r.Kind, r.Name)
+	}
+	return fmt.Sprintf("%v/%v/%v", r.Kind, r.Namespace, r.Name)
+}
+
+func (c *SonobuoyClient) Delete(cfg *DeleteConfig) ([]DeletedResource, error) {
 	client, err := c.Client()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	d := &deleter{client: client}
 
-	if err := cleanupNamespace(cfg.Namespace, client); err != nil {
-		return err
+	// Runs maps the namespace of each run to delete to whether the
+	// namespace is Sonobuoy's own, to be deleted along with the run.
+	runs := map[string]bool{cfg.Namespace: !cfg.NamespaceScoped}
+	if cfg.DeleteAll {
+		if err := d.findRuns(runs); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ns := range sortedKeys(runs) {
+		if runs[ns] {
+			err = d.namespace(ns)
+		} else {
+			err = d.namespacedResources(ns)
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if cfg.EnableRBAC {
-		if err := deleteRBAC(client); err != nil {
-			return err
+	if cfg.EnableRBAC && (!cfg.NamespaceScoped || cfg.DeleteAll) {
+		if err := d.clusterRBAC(); err != nil {
+			return nil, err
 		}
 	}
 
 	if cfg.DeleteAll {
-		if err := cleanupE2E(client); err != nil {
-			return err
+		if err := d.e2eNamespaces(); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Wait {
+		if err := d.wait(); err != nil {
+			return nil, err
+		}
+	}
+	return d.deleted, nil
+}
+
+// deleter deletes Sonobuoy's resources, keeping track of what it's deleted so
+// it can wait for them to be gone.
+type deleter struct {
+	client  kubernetes.Interface
+	deleted []DeletedResource
+	// pending lists the resources that are still being deleted, for each
+	// kind of resource deleted.
+	pending []func() ([]pendingResource, error)
+}
+
+// pendingResource is a resource that's still being deleted.
+type pendingResource struct {
+	kind string
+	obj  metav1.Object
+}
+
+// resourceCollection is a kind of resource that Sonobuoy creates, all of which
+// are labeled like the cluster roles.
+type resourceCollection struct {
+	kind   string
+	list   func(metav1.ListOptions) (runtime.Object, error)
+	delete func(*metav1.DeleteOptions, metav1.ListOptions) error
+}
+
+// sonobuoyListOptions selects the resources Sonobuoy creates.
+func sonobuoyListOptions() metav1.ListOptions {
+	selector := metav1.AddLabelToSelector(
+		&metav1.LabelSelector{},
+		clusterRoleFieldName,
+		clusterRoleFieldValue,
+	)
+	return metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(selector),
+	}
+}
+
+// findRuns adds the namespaces of every run in the cluster to runs: those
+// Sonobuoy created, and those holding a namespace-scoped run's service
+// account.
+func (d *deleter) findRuns(runs map[string]bool) error {
+	namespaces, err := d.client.CoreV1().Namespaces().List(sonobuoyListOptions())
+	if err != nil {
+		return errors.Wrap(err, "failed to list namespaces")
+	}
+	for _, ns := range namespaces.Items {
+		runs[ns.Name] = true
+	}
+
+	accounts, err := d.client.CoreV1().ServiceAccounts(metav1.NamespaceAll).List(sonobuoyListOptions())
+	if err != nil {
+		return errors.Wrap(err, "failed to list service accounts")
+	}
+	for _, sa := range accounts.Items {
+		if _, ok := runs[sa.Namespace]; !ok {
+			runs[sa.Namespace] = false
 		}
 	}
 	return nil
 }
 
-func cleanupNamespace(namespace string, client kubernetes.Interface) error {
-	// Delete the namespace
+// namespace deletes a namespace, along with everything in it.
+func (d *deleter) namespace(namespace string) error {
 	log := logrus.WithFields(logrus.Fields{
 		"kind":      "namespace",
 		"namespace": namespace,
 	})
 
-	err := client.CoreV1().Namespaces().Delete(namespace, &metav1.DeleteOptions{})
+	err := d.client.CoreV1().Namespaces().Delete(namespace, &metav1.DeleteOptions{})
 	if err := logDelete(log, err); err != nil {
 		return errors.Wrap(err, "couldn't delete namespace")
 	}
+	if err == nil {
+		d.deleted = append(d.deleted, DeletedResource{Kind: "namespace", Name: namespace})
+	}
 
+	d.pending = append(d.pending, func() ([]pendingResource, error) {
+		return d.pendingNamespace(namespace)
+	})
 	return nil
 }
 
-func deleteRBAC(client kubernetes.Interface) error {
-	// ClusterRole and ClusterRoleBindings aren't namespaced, so delete them seperately
-	selector := metav1.AddLabelToSelector(
-		&metav1.LabelSelector{},
-		clusterRoleFieldName,
-		clusterRoleFieldValue,
-	)
+// pendingNamespace returns the namespace, if it's still being deleted, along
+// with the pods and persistent volume claims in it that have finalizers,
+// which are what usually holds up deleting a namespace.
+func (d *deleter) pendingNamespace(namespace string) ([]pendingResource, error) {
+	ns, err := d.client.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if kubeerror.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get namespace")
+	}
+	pending := []pendingResource{{kind: "namespace", obj: ns}}
 
-	deleteOpts := &metav1.DeleteOptions{}
-	listOpts := metav1.ListOptions{
-		LabelSelector: metav1.FormatLabelSelector(selector),
+	pods, err := d.client.CoreV1().Pods(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pods")
+	}
+	for i := range pods.Items {
+		if len(pods.Items[i].Finalizers) > 0 {
+			pending = append(pending, pendingResource{kind: "pods", obj: &pods.Items[i]})
+		}
 	}
 
-	err := client.RbacV1().ClusterRoleBindings().DeleteCollection(deleteOpts, listOpts)
-	if err := logDelete(logrus.WithField("kind", "clusterrolebindings"), err); err != nil {
-		return errors.Wrap(err, "failed to delete cluster role binding")
+	claims, err := d.client.CoreV1().PersistentVolumeClaims(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list persistent volume claims")
+	}
+	for i := range claims.Items {
+		if len(claims.Items[i].Finalizers) > 0 {
+			pending = append(pending, pendingResource{kind: "persistentvolumeclaims", obj: &claims.Items[i]})
+		}
 	}
+	return pending, nil
+}
+
+// namespacedResources deletes the resources of a namespace-scoped run from a
+// namespace that Sonobuoy didn't create.
+func (d *deleter) namespacedResources(namespace string) error {
+	if err := d.namespacedObjects(namespace); err != nil {
+		return err
+	}
+	core, rbac := d.client.CoreV1(), d.client.RbacV1()
+	return d.collections(namespace, []resourceCollection{
+		{
+			"pods",
+			func(o metav1.ListOptions) (runtime.Object, error) { return core.Pods(namespace).List(o) },
+			core.Pods(namespace).DeleteCollection,
+		},
+		{
+			"rolebindings",
+			func(o metav1.ListOptions) (runtime.Object, error) { return rbac.RoleBindings(namespace).List(o) },
+			rbac.RoleBindings(namespace).DeleteCollection,
+		},
+		{
+			"roles",
+			func(o metav1.ListOptions) (runtime.Object, error) { return rbac.Roles(namespace).List(o) },
+			rbac.Roles(namespace).DeleteCollection,
+		},
+		{
+			"serviceaccounts",
+			func(o metav1.ListOptions) (runtime.Object, error) { return core.ServiceAccounts(namespace).List(o) },
+			core.ServiceAccounts(namespace).DeleteCollection,
+		},
+	})
+}
 
-	// ClusterRole and ClusterRole bindings aren't namespaced, so delete them manually
-	err = client.RbacV1().ClusterRoles().DeleteCollection(deleteOpts, listOpts)
-	if err := logDelete(logrus.WithField("kind", "clusterroles"), err); err != nil {
-		return errors.Wrap(err, "failed to delete cluster role")
+// namespacedObjects deletes the resources of a namespace-scoped run that the
+// aggregator doesn't need to delete the rest: everything but its pods and
+// RBAC resources.
+func (d *deleter) namespacedObjects(namespace string) error {
+	core := d.client.CoreV1()
+	err := d.collections(namespace, []resourceCollection{
+		{
+			"cronjobs",
+			func(o metav1.ListOptions) (runtime.Object, error) {
+				return d.client.BatchV1beta1().CronJobs(namespace).List(o)
+			},
+			d.client.BatchV1beta1().CronJobs(namespace).DeleteCollection,
+		},
+		{
+			"deployments",
+			func(o metav1.ListOptions) (runtime.Object, error) {
+				return d.client.AppsV1beta2().Deployments(namespace).List(o)
+			},
+			d.client.AppsV1beta2().Deployments(namespace).DeleteCollection,
+		},
+		{
+			// Such as the targets of the network-connectivity plugin.
+			"daemonsets",
+			func(o metav1.ListOptions) (runtime.Object, error) {
+				return d.client.AppsV1beta2().DaemonSets(namespace).List(o)
+			},
+			d.client.AppsV1beta2().DaemonSets(namespace).DeleteCollection,
+		},
+		{
+			"configmaps",
+			func(o metav1.ListOptions) (runtime.Object, error) { return core.ConfigMaps(namespace).List(o) },
+			core.ConfigMaps(namespace).DeleteCollection,
+		},
+		{
+			"secrets",
+			func(o metav1.ListOptions) (runtime.Object, error) { return core.Secrets(namespace).List(o) },
+			core.Secrets(namespace).DeleteCollection,
+		},
+		{
+			"persistentvolumeclaims",
+			func(o metav1.ListOptions) (runtime.Object, error) {
+				return core.PersistentVolumeClaims(namespace).List(o)
+			},
+			core.PersistentVolumeClaims(namespace).DeleteCollection,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Services can't be deleted as a collection.
+	services, err := core.Services(namespace).List(sonobuoyListOptions())
+	if err != nil {
+		return errors.Wrap(err, "failed to list services")
+	}
+	for _, svc := range services.Items {
+		log := logrus.WithFields(logrus.Fields{
+			"kind":      "service",
+			"namespace": namespace,
+			"name":      svc.Name,
+		})
+		err := core.Services(namespace).Delete(svc.Name, &metav1.DeleteOptions{})
+		if err := logDelete(log, err); err != nil {
+			return errors.Wrap(err, "failed to delete service")
+		}
+		if err == nil {
+			d.deleted = append(d.deleted, DeletedResource{Kind: "services", Namespace: namespace, Name: svc.Name})
+		}
 	}
+	d.pending = append(d.pending, func() ([]pendingResource, error) {
+		return listPending("services", func(o metav1.ListOptions) (runtime.Object, error) {
+			return core.Services(namespace).List(o)
+		})
+	})
 
 	return nil
 }
 
-func cleanupE2E(client kubernetes.Interface) error {
-	// Delete any dangling E2E namespaces
+// clusterRBAC deletes the cluster roles and cluster role bindings of every
+// run, which aren't namespaced.
+func (d *deleter) clusterRBAC() error {
+	rbac := d.client.RbacV1()
+	return d.collections("", []resourceCollection{
+		{
+			"clusterrolebindings",
+			func(o metav1.ListOptions) (runtime.Object, error) { return rbac.ClusterRoleBindings().List(o) },
+			rbac.ClusterRoleBindings().DeleteCollection,
+		},
+		{
+			"clusterroles",
+			func(o metav1.ListOptions) (runtime.Object, error) { return rbac.ClusterRoles().List(o) },
+			rbac.ClusterRoles().DeleteCollection,
+		},
+	})
+}
 
-	namespaces, err := client.CoreV1().Namespaces().List(metav1.ListOptions{})
+// e2eNamespaces deletes any dangling namespaces left by the e2e tests.
+func (d *deleter) e2eNamespaces() error {
+	namespaces, err := d.client.CoreV1().Namespaces().List(metav1.ListOptions{})
 	if err != nil {
 		return errors.Wrap(err, "failed to list namespaces")
 	}
 
 	for _, namespace := range namespaces.Items {
 		if strings.HasPrefix(namespace.Name, e2eNamespacePrefix) {
-
-			log := logrus.WithFields(logrus.Fields{
-				"kind":      "namespace",
-				"namespace": namespace.Name,
-			})
-			err := client.CoreV1().Namespaces().Delete(namespace.Name, &metav1.DeleteOptions{})
-			if err := logDelete(log, err); err != nil {
-				return errors.Wrap(err, "couldn't delete namespace")
+			if err := d.namespace(namespace.Name); err != nil {
+				return err
 			}
 		}
 	}
 	return nil
 }
 
+// collections deletes the resources Sonobuoy created of each kind in
+// collections, listing them first so what's deleted can be reported.
+func (d *deleter) collections(namespace string, collections []resourceCollection) error {
+	for _, c := range collections {
+		log := logrus.WithField("kind", c.kind)
+		if namespace != "" {
+			log = log.WithField("namespace", namespace)
+		}
+
+		objs, err := listObjects(c.list(sonobuoyListOptions()))
+		if err != nil {
+			return errors.Wrapf(err, "failed to list %v", c.kind)
+		}
+		if err := logDelete(log, c.delete(&metav1.DeleteOptions{}, sonobuoyListOptions())); err != nil {
+			return errors.Wrapf(err, "failed to delete %v", c.kind)
+		}
+		for _, obj := range objs {
+			d.deleted = append(d.deleted, DeletedResource{Kind: c.kind, Namespace: namespace, Name: obj.GetName()})
+		}
+
+		kind, list := c.kind, c.list
+		d.pending = append(d.pending, func() ([]pendingResource, error) {
+			return listPending(kind, list)
+		})
+	}
+	return nil
+}
+
+// listPending lists the resources Sonobuoy created of a kind that still
+// exist.
+func listPending(kind string, list func(metav1.ListOptions) (runtime.Object, error)) ([]pendingResource, error) {
+	objs, err := listObjects(list(sonobuoyListOptions()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list %v", kind)
+	}
+	pending := make([]pendingResource, len(objs))
+	for i, obj := range objs {
+		pending[i] = pendingResource{kind: kind, obj: obj}
+	}
+	return pending, nil
+}
+
+func listObjects(list runtime.Object, err error) ([]metav1.Object, error) {
+	if err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	objs := make([]metav1.Object, len(items))
+	for i, item := range items {
+		if objs[i], err = meta.Accessor(item); err != nil {
+			return nil, err
+		}
+	}
+	return objs, nil
+}
+
+// wait blocks until everything that was deleted is gone, reporting the
+// finalizers of any resource whose deletion is taking a while.
+func (d *deleter) wait() error {
+	var reported time.Time
+	for {
+		var pending []pendingResource
+		for _, list := range d.pending {
+			p, err := list()
+			if err != nil {
+				return err
+			}
+			pending = append(pending, p...)
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		logrus.WithField("remaining", len(pending)).Debug("Waiting for resources to be deleted")
+		if time.Since(reported) >= stuckAfter {
+			for _, p := range pending {
+				reportStuck(p)
+			}
+			reported = time.Now()
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
+
+// reportStuck warns about a resource that has been being deleted for longer
+// than stuckAfter, along with the finalizers it's waiting on.
+func reportStuck(p pendingResource) {
+	deleted := p.obj.GetDeletionTimestamp()
+	if deleted == nil || time.Since(deleted.Time) < stuckAfter {
+		return
+	}
+
+	finalizers := p.obj.GetFinalizers()
+	if ns, ok := p.obj.(*corev1.Namespace); ok {
+		for _, f := range ns.Spec.Finalizers {
+			finalizers = append(finalizers, string(f))
+		}
+	}
+	logrus.WithFields(logrus.Fields{
+		"kind":       p.kind,
+		"namespace":  p.obj.GetNamespace(),
+		"name":       p.obj.GetName(),
+		"finalizers": strings.Join(finalizers, ","),
+	}).Warning("Still waiting for resource to be deleted")
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func logDelete(log logrus.FieldLogger, err error) error {
 	switch {
 	case err == nil:
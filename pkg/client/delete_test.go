@@ -0,0 +1,122 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+// deleteServer serves a cluster with two runs, one of them namespace-scoped in
+// the team namespace, and an e2e namespace. Every list of Sonobuoy's
+// resources has one item until it's deleted.
+type deleteServer struct {
+	gone map[string]bool
+}
+
+func (s *deleteServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	p := r.URL.Path
+	switch {
+	case r.Method == http.MethodDelete:
+		if strings.HasSuffix(path.Dir(p), "/services") {
+			p = path.Dir(p)
+		}
+		s.gone[p] = true
+		fmt.Fprint(w, `{"kind": "Status", "apiVersion": "v1", "status": "Success"}`)
+	case p == "/api/v1/namespaces":
+		if r.URL.Query().Get("labelSelector") != "" {
+			fmt.Fprint(w, `{"items": [{"metadata": {"name": "sonobuoy-a"}}]}`)
+		} else {
+			fmt.Fprint(w, `{"items": [{"metadata": {"name": "default"}}, {"metadata": {"name": "e2e-1"}}]}`)
+		}
+	case p == "/api/v1/serviceaccounts":
+		fmt.Fprint(w, `{"items": [{"metadata": {"name": "sonobuoy-serviceaccount", "namespace": "team"}}]}`)
+	case strings.HasPrefix(p, "/api/v1/namespaces/") && strings.Count(p, "/") == 4:
+		if s.gone[p] {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": 404}`)
+			return
+		}
+		fmt.Fprintf(w, `{"metadata": {"name": %q}}`, path.Base(p))
+	default:
+		// Lists of the resources of a namespace-scoped run, or cluster roles.
+		if s.gone[p] {
+			fmt.Fprint(w, `{"items": []}`)
+			return
+		}
+		fmt.Fprintf(w, `{"items": [{"metadata": {"name": "sonobuoy-%v"}}]}`, path.Base(p))
+	}
+}
+
+func TestDelete(t *testing.T) {
+	defer func(interval time.Duration) { waitPollInterval = interval }(waitPollInterval)
+	waitPollInterval = time.Millisecond
+
+	srv := httptest.NewServer(&deleteServer{gone: map[string]bool{}})
+	defer srv.Close()
+	sbc, err := NewSonobuoyClient(&rest.Config{Host: srv.URL, QPS: 1000, Burst: 1000})
+	if err != nil {
+		t.Fatalf("couldn't create client: %v", err)
+	}
+
+	deleted, err := sbc.Delete(&DeleteConfig{
+		Namespace:  "heptio-sonobuoy",
+		EnableRBAC: true,
+		DeleteAll:  true,
+		Wait:       true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	names := []string{}
+	for _, r := range deleted {
+		names = append(names, r.String())
+	}
+	sort.Strings(names)
+	expected := []string{
+		"clusterrolebindings/sonobuoy-clusterrolebindings",
+		"clusterroles/sonobuoy-clusterroles",
+		"configmaps/team/sonobuoy-configmaps",
+		"cronjobs/team/sonobuoy-cronjobs",
+		"daemonsets/team/sonobuoy-daemonsets",
+		"deployments/team/sonobuoy-deployments",
+		"namespace/e2e-1",
+		"namespace/heptio-sonobuoy",
+		"namespace/sonobuoy-a",
+		"persistentvolumeclaims/team/sonobuoy-persistentvolumeclaims",
+		"pods/team/sonobuoy-pods",
+		"rolebindings/team/sonobuoy-rolebindings",
+		"roles/team/sonobuoy-roles",
+		"secrets/team/sonobuoy-secrets",
+		"serviceaccounts/team/sonobuoy-serviceaccounts",
+		"services/team/sonobuoy-services",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected deleted resources\n%v\ngot\n%v", expected, names)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	kubeerror "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	serviceAccountName = "sonobuoy-serviceaccount"
+	rbacAPIVersion     = "rbac.authorization.k8s.io/v1"
+)
+
+// DeleteSelf deletes a run from within its aggregator, whose pod is podName.
+// Deleting the run's role binding takes away the aggregator's permission to
+// delete anything else, so whatever's left is made to depend on the binding
+// instead, for the garbage collector to delete along with it.
+func (c *SonobuoyClient) DeleteSelf(cfg *DeleteConfig, podName string) error {
+	client, err := c.Client()
+	if err != nil {
+		return err
+	}
+
+	d := &deleter{client: client}
+	if cfg.NamespaceScoped {
+		return d.namespacedSelf(cfg.Namespace, podName)
+	}
+	return d.clusterSelf(cfg.Namespace)
+}
+
+func (d *deleter) clusterSelf(namespace string) error {
+	client := d.client
+	binding, err := client.RbacV1().ClusterRoleBindings().Get(serviceAccountName+"-"+namespace, metav1.GetOptions{})
+	if kubeerror.IsNotFound(err) {
+		// Without RBAC, nothing stops the namespace being deleted directly.
+		return d.namespace(namespace)
+	}
+	if err != nil {
+		return errors.Wrap(err, "couldn't get cluster role binding")
+	}
+	owner := ownerReference(rbacAPIVersion, "ClusterRoleBinding", &binding.ObjectMeta)
+
+	ns, err := client.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "couldn't get namespace")
+	}
+	addOwner(&ns.ObjectMeta, owner)
+	if _, err := client.CoreV1().Namespaces().Update(ns); err != nil {
+		return errors.Wrap(err, "couldn't update namespace")
+	}
+
+	// The cluster role is shared between runs, so it's only deleted once
+	// the bindings of every run are.
+	role, err := client.RbacV1().ClusterRoles().Get(serviceAccountName, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "couldn't get cluster role")
+	}
+	addOwner(&role.ObjectMeta, owner)
+	if _, err := client.RbacV1().ClusterRoles().Update(role); err != nil {
+		return errors.Wrap(err, "couldn't update cluster role")
+	}
+
+	err = client.RbacV1().ClusterRoleBindings().Delete(binding.Name, backgroundDeletion())
+	if err := logDelete(logrus.WithField("kind", "clusterrolebinding"), err); err != nil {
+		return errors.Wrap(err, "couldn't delete cluster role binding")
+	}
+	return nil
+}
+
+func (d *deleter) namespacedSelf(namespace, podName string) error {
+	client := d.client
+	if err := d.namespacedObjects(namespace); err != nil {
+		return err
+	}
+
+	binding, err := client.RbacV1().RoleBindings(namespace).Get(serviceAccountName, metav1.GetOptions{})
+	if kubeerror.IsNotFound(err) {
+		// Without RBAC, the aggregator's pod is deleted right before the
+		// service account it authenticates as.
+		core := client.CoreV1()
+		return d.collections(namespace, []resourceCollection{
+			{
+				"pods",
+				func(o metav1.ListOptions) (runtime.Object, error) { return core.Pods(namespace).List(o) },
+				core.Pods(namespace).DeleteCollection,
+			},
+			{
+				"serviceaccounts",
+				func(o metav1.ListOptions) (runtime.Object, error) { return core.ServiceAccounts(namespace).List(o) },
+				core.ServiceAccounts(namespace).DeleteCollection,
+			},
+		})
+	}
+	if err != nil {
+		return errors.Wrap(err, "couldn't get role binding")
+	}
+	owner := ownerReference(rbacAPIVersion, "RoleBinding", &binding.ObjectMeta)
+
+	role, err := client.RbacV1().Roles(namespace).Get(serviceAccountName, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "couldn't get role")
+	}
+	addOwner(&role.ObjectMeta, owner)
+	if _, err := client.RbacV1().Roles(namespace).Update(role); err != nil {
+		return errors.Wrap(err, "couldn't update role")
+	}
+
+	sa, err := client.CoreV1().ServiceAccounts(namespace).Get(serviceAccountName, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "couldn't get service account")
+	}
+	addOwner(&sa.ObjectMeta, owner)
+	if _, err := client.CoreV1().ServiceAccounts(namespace).Update(sa); err != nil {
+		return errors.Wrap(err, "couldn't update service account")
+	}
+
+	pod, err := client.CoreV1().Pods(namespace).Get(podName, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "couldn't get aggregator pod")
+	}
+	addOwner(&pod.ObjectMeta, owner)
+	if _, err := client.CoreV1().Pods(namespace).Update(pod); err != nil {
+		return errors.Wrap(err, "couldn't update aggregator pod")
+	}
+
+	log := logrus.WithFields(logrus.Fields{
+		"kind":      "rolebinding",
+		"namespace": namespace,
+	})
+	err = client.RbacV1().RoleBindings(namespace).Delete(binding.Name, backgroundDeletion())
+	if err := logDelete(log, err); err != nil {
+		return errors.Wrap(err, "couldn't delete role binding")
+	}
+	return nil
+}
+
+func ownerReference(apiVersion, kind string, owner *metav1.ObjectMeta) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Name:       owner.Name,
+		UID:        owner.UID,
+	}
+}
+
+func addOwner(obj *metav1.ObjectMeta, owner metav1.OwnerReference) {
+	obj.OwnerReferences = append(obj.OwnerReferences, owner)
+}
+
+// backgroundDeletion has the garbage collector delete an object's dependents
+// after the object itself is deleted.
+func backgroundDeletion() *metav1.DeleteOptions {
+	policy := metav1.DeletePropagationBackground
+	return &metav1.DeleteOptions{PropagationPolicy: &policy}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+// selfDeleteServer serves every object as existing, with a UID made from its
+// name, and records the requests made to it. Updated objects are recorded by
+// path with the UIDs of their owners.
+type selfDeleteServer struct {
+	requests []string
+	owners   map[string][]string
+	deleted  map[string]string
+}
+
+func (s *selfDeleteServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	switch r.Method {
+	case http.MethodGet:
+		if strings.HasSuffix(r.URL.Path, "/services") {
+			fmt.Fprint(w, `{"metadata": {}, "items": []}`)
+			return
+		}
+		name := path.Base(r.URL.Path)
+		fmt.Fprintf(w, `{"metadata": {"name": %q, "uid": %q}}`, name, name+"-uid")
+	case http.MethodPut:
+		body, _ := ioutil.ReadAll(r.Body)
+		var obj struct {
+			Metadata struct {
+				OwnerReferences []struct {
+					UID string `json:"uid"`
+				} `json:"ownerReferences"`
+			} `json:"metadata"`
+		}
+		json.Unmarshal(body, &obj)
+		for _, ref := range obj.Metadata.OwnerReferences {
+			s.owners[r.URL.Path] = append(s.owners[r.URL.Path], ref.UID)
+		}
+		w.Write(body)
+	case http.MethodDelete:
+		body, _ := ioutil.ReadAll(r.Body)
+		var opts struct {
+			PropagationPolicy string `json:"propagationPolicy"`
+		}
+		json.Unmarshal(body, &opts)
+		s.deleted[r.URL.Path] = opts.PropagationPolicy
+		fmt.Fprint(w, `{"kind": "Status", "apiVersion": "v1", "status": "Success"}`)
+	}
+}
+
+func TestDeleteSelf(t *testing.T) {
+	testCases := []struct {
+		name            string
+		namespaceScoped bool
+		owner           string
+		owned           []string
+		last            string
+	}{
+		{
+			name:  "cluster",
+			owner: "sonobuoy-serviceaccount-sonobuoy-test-uid",
+			owned: []string{
+				"/api/v1/namespaces/sonobuoy-test",
+				"/apis/rbac.authorization.k8s.io/v1/clusterroles/sonobuoy-serviceaccount",
+			},
+			last: "/apis/rbac.authorization.k8s.io/v1/clusterrolebindings/sonobuoy-serviceaccount-sonobuoy-test",
+		},
+		{
+			name:            "namespace scoped",
+			namespaceScoped: true,
+			owner:           "sonobuoy-serviceaccount-uid",
+			owned: []string{
+				"/apis/rbac.authorization.k8s.io/v1/namespaces/sonobuoy-test/roles/sonobuoy-serviceaccount",
+				"/api/v1/namespaces/sonobuoy-test/serviceaccounts/sonobuoy-serviceaccount",
+				"/api/v1/namespaces/sonobuoy-test/pods/sonobuoy",
+			},
+			last: "/apis/rbac.authorization.k8s.io/v1/namespaces/sonobuoy-test/rolebindings/sonobuoy-serviceaccount",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &selfDeleteServer{owners: map[string][]string{}, deleted: map[string]string{}}
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+
+			sbc, err := NewSonobuoyClient(&rest.Config{Host: srv.URL, QPS: 1000, Burst: 1000})
+			if err != nil {
+				t.Fatalf("couldn't create client: %v", err)
+			}
+			err = sbc.DeleteSelf(&DeleteConfig{Namespace: "sonobuoy-test", NamespaceScoped: tc.namespaceScoped}, "sonobuoy")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for _, p := range tc.owned {
+				if !reflect.DeepEqual(s.owners[p], []string{tc.owner}) {
+					t.Errorf("expected %v to be owned by %v, got %v", p, tc.owner, s.owners[p])
+				}
+			}
+			if last := s.requests[len(s.requests)-1]; last != "DELETE "+tc.last {
+				t.Errorf("expected the binding to be deleted last, got %v", last)
+			}
+			if policy := s.deleted[tc.last]; policy != "Background" {
+				t.Errorf("expected the binding's dependents to be deleted in the background, got %q", policy)
+			}
+		})
+	}
+}
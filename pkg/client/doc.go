@@ -16,4 +16,10 @@ limitations under the License.
 
 // Package client provides primitives for interacting with Sonobuoy and the
 // results archive.
+//
+// Programs embedding Sonobuoy, such as operators and controllers, should use
+// the SDK interface, implemented by SDKClient, which is kept stable across
+// releases. Its calls take a context and are customized with Options.
+// Interface exposes more of what the CLI does, but its configs change as
+// features are added.
 package client
@@ -19,6 +19,7 @@ package client
 import (
 	"io"
 	"os"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -57,14 +58,12 @@ func (c *SonobuoyClient) GetTests(reader io.Reader, show string) ([]reporters.JU
 	return out, nil
 }
 
-// Focus returns a value to be used in the E2E_FOCUS variable that is
-// representative of the test cases in the struct.
+// Focus returns a value to be used in the E2E_FOCUS variable that matches
+// the test cases given, and no others unless their names contain one of them.
 func Focus(testCases []reporters.JUnitTestCase) string {
-	// YAML doesn't like escaped characters and regex needs escaped characters. Therefore a double escape is necessary.
-	r := strings.NewReplacer("[", `\\[`, "]", `\\]`)
 	testNames := make([]string, len(testCases))
 	for i, tc := range testCases {
-		testNames[i] = r.Replace(tc.Name)
+		testNames[i] = regexp.QuoteMeta(tc.Name)
 	}
 	return strings.Join(testNames, "|")
 }
@@ -0,0 +1,49 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/onsi/ginkgo/reporters"
+)
+
+func TestFocus(t *testing.T) {
+	testCases := []reporters.JUnitTestCase{
+		{Name: "[sig-network] Services should serve a basic endpoint from pods  [Conformance]"},
+		{Name: "[k8s.io] Pods should support (remote) command execution over websockets [NodeConformance]"},
+	}
+
+	focus, err := regexp.Compile(Focus(testCases))
+	if err != nil {
+		t.Fatalf("focus isn't a valid regex: %v", err)
+	}
+	for _, tc := range testCases {
+		if !focus.MatchString(tc.Name) {
+			t.Errorf("expected focus %v to match %q", focus, tc.Name)
+		}
+	}
+	for _, name := range []string{
+		"[sig-network] Services should serve a basic endpoint from pods",
+		"[k8s.io] Pods should support remote command execution over websockets [NodeConformance]",
+	} {
+		if focus.MatchString(name) {
+			t.Errorf("expected focus %v not to match %q", focus, name)
+		}
+	}
+}
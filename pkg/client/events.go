@@ -0,0 +1,60 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+)
+
+// StreamEvents reads the events of a Sonobuoy run from its aggregator,
+// through the API server's proxy to its pod, calling handle with each one.
+// With Follow, it returns once the run is complete, otherwise once it has
+// handled the events so far. It stops early if handle returns an error,
+// returning that error.
+func (c *SonobuoyClient) StreamEvents(cfg *EventsConfig, handle func(aggregation.Event) error) error {
+	if cfg.Port <= 0 {
+		return errors.Errorf("invalid port %v, the aggregator's metrics port must be set to stream events", cfg.Port)
+	}
+	client, err := c.Client()
+	if err != nil {
+		return err
+	}
+
+	req := client.CoreV1().RESTClient().Get().
+		Namespace(cfg.Namespace).
+		Resource("pods").
+		Name(fmt.Sprintf("%v:%v", config.MasterPodName, cfg.Port)).
+		SubResource("proxy").
+		Suffix(strings.TrimPrefix(aggregation.EventsPath, "/")).
+		Param("follow", strconv.FormatBool(cfg.Follow))
+	if cfg.Since > 0 {
+		req = req.Param("since", strconv.FormatInt(cfg.Since, 10))
+	}
+	stream, err := req.Stream()
+	if err != nil {
+		return errors.Wrap(err, "couldn't stream events from the aggregator")
+	}
+	defer stream.Close()
+	return aggregation.ReadEvents(stream, handle)
+}
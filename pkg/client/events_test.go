@@ -0,0 +1,73 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"k8s.io/client-go/rest"
+)
+
+func TestStreamEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/sonobuoy-test/pods/sonobuoy:8081/proxy/api/v1/events" {
+			http.NotFound(w, r)
+			return
+		}
+		if follow := r.URL.Query().Get("follow"); follow != "true" {
+			t.Errorf("expected to follow events, got follow=%q", follow)
+		}
+		if since := r.URL.Query().Get("since"); since != "1" {
+			t.Errorf("expected events since the first, got since=%q", since)
+		}
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "id: 2\nevent: plugin-failed\ndata: {\"id\":2,\"type\":\"plugin-failed\",\"plugin\":\"e2e\",\"error\":\"boom\"}\n\n")
+		fmt.Fprint(w, "id: 3\nevent: run-complete\ndata: {\"id\":3,\"type\":\"run-complete\",\"status\":\"failed\"}\n\n")
+	}))
+	defer srv.Close()
+
+	sbc, err := NewSonobuoyClient(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatalf("couldn't make client: %v", err)
+	}
+
+	var events []aggregation.Event
+	err = sbc.StreamEvents(&EventsConfig{Namespace: "sonobuoy-test", Port: 8081, Follow: true, Since: 1}, func(event aggregation.Event) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("couldn't stream events: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", events)
+	}
+	if e := events[0]; e.Type != aggregation.EventPluginFailed || e.Plugin != "e2e" || e.Error != "boom" {
+		t.Errorf("unexpected first event %+v", e)
+	}
+	if e := events[1]; e.Type != aggregation.EventRunComplete || e.Status != aggregation.FailedStatus {
+		t.Errorf("unexpected last event %+v", e)
+	}
+
+	if err := sbc.StreamEvents(&EventsConfig{Namespace: "sonobuoy-test"}, nil); err == nil {
+		t.Error("expected streaming events without a port to fail")
+	}
+}
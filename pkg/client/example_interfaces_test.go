@@ -17,6 +17,10 @@ limitations under the License.
 package client_test
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/heptio/sonobuoy/pkg/client"
 	"github.com/heptio/sonobuoy/pkg/config"
 	"k8s.io/client-go/rest"
@@ -56,3 +60,43 @@ func Example() {
 		panic(err)
 	}
 }
+
+// ExampleSDKClient shows how to run Sonobuoy from another program, wait for
+// it and count its tests, using the stable SDK interface.
+func ExampleSDKClient() {
+	sonobuoy, err := client.NewSDKClient(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	// Every call about the run is given the same options; those that don't
+	// apply to a call are ignored.
+	opts := []client.Option{
+		client.WithNamespace("sonobuoy-quick"),
+		client.WithMode(client.Quick),
+	}
+	if err := sonobuoy.Run(context.Background(), opts...); err != nil {
+		panic(err)
+	}
+
+	// Give up waiting after an hour.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	status, err := sonobuoy.Status(ctx, append(opts, client.WithWait())...)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println("run", status.Status)
+
+	counts, err := sonobuoy.Results(context.Background(), opts...)
+	if err != nil {
+		panic(err)
+	}
+	for _, suite := range counts {
+		fmt.Printf("%v: %v failed of %v\n", suite.Name, suite.Failures, suite.Tests)
+	}
+
+	if _, err := sonobuoy.Delete(context.Background(), append(opts, client.WithWait())...); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+	"k8s.io/client-go/rest"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/heptio/sonobuoy/pkg/tarball"
+)
+
+// Fleet is a set of clusters that Sonobuoy is run on at once, by name, such as
+// the contexts of a kubeconfig.
+type Fleet map[string]Interface
+
+// NewFleet creates a client for each of the clusters from its REST config.
+func NewFleet(restConfigs map[string]*rest.Config) (Fleet, error) {
+	fleet := Fleet{}
+	for name, restConfig := range restConfigs {
+		sbc, err := NewSonobuoyClient(restConfig)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't create sonobuoy client for %v", name)
+		}
+		fleet[name] = sbc
+	}
+	return fleet, nil
+}
+
+// ClusterResult is the outcome of an operation on one cluster of a fleet.
+type ClusterResult struct {
+	// Cluster is the name of the cluster.
+	Cluster string
+	// Status is the status of the run on the cluster, if it was got.
+	Status *aggregation.Status
+	// Run is the run on the cluster, if it was run to completion.
+	Run *CompletedRun
+	// Err is why the operation failed on the cluster, if it did.
+	Err error
+}
+
+// FleetRun is the outcome of running Sonobuoy on every cluster of a fleet.
+type FleetRun struct {
+	// Clusters are the runs on each cluster, sorted by name.
+	Clusters []ClusterResult
+	// Tarball is the combined results tarball, with each cluster's results
+	// in a directory named after it, and ResultsDir the directory it was
+	// made from. They're empty if the results weren't retrieved.
+	Tarball    string
+	ResultsDir string
+}
+
+// unsafeDirChars are the characters of a cluster's name that aren't kept in
+// the name of its results directory. Contexts often have slashes or colons in
+// their names, such as those of EKS clusters.
+var unsafeDirChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// ClusterDir is the name of the directory a cluster's results are stored in.
+// If any of the cluster's name had to be replaced, a hash of the whole name is
+// appended, so that clusters such as a/b and a:b don't share a directory.
+func ClusterDir(cluster string) string {
+	dir := unsafeDirChars.ReplaceAllString(cluster, "_")
+	if dir == cluster && dir != "" && dir != "." && dir != ".." {
+		return dir
+	}
+	sum := sha256.Sum256([]byte(cluster))
+	return dir + "-" + hex.EncodeToString(sum[:4])
+}
+
+// Clusters returns the names of the clusters in the fleet, sorted.
+func (f Fleet) Clusters() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// each calls fn for every cluster of the fleet at once, returning what it
+// returns for each, sorted by cluster.
+func (f Fleet) each(fn func(name string, c Interface) ClusterResult) []ClusterResult {
+	names := f.Clusters()
+	results := make([]ClusterResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			results[i] = fn(name, f[name])
+			results[i].Cluster = name
+		}(i, name)
+	}
+	wg.Wait()
+	return results
+}
+
+// Run starts a run on every cluster of the fleet, each with its own copy of
+// the config. The clusters are run on one at a time, so that the manifests of
+// a dry run aren't interleaved.
+func (f Fleet) Run(cfg *RunConfig) []ClusterResult {
+	results := []ClusterResult{}
+	for _, name := range f.Clusters() {
+		err := f[name].Run(clusterRunConfig(cfg))
+		results = append(results, ClusterResult{Cluster: name, Err: err})
+	}
+	return results
+}
+
+// GetStatus gets the status of the run on every cluster of the fleet.
+func (f Fleet) GetStatus(namespace string) []ClusterResult {
+	return f.each(func(name string, c Interface) ClusterResult {
+		status, err := c.GetStatus(namespace)
+		return ClusterResult{Status: status, Err: err}
+	})
+}
+
+// WaitForRun waits for the run on every cluster of the fleet to complete or
+// fail.
+func (f Fleet) WaitForRun(cfg *WaitConfig) []ClusterResult {
+	return f.each(func(name string, c Interface) ClusterResult {
+		status, err := c.WaitForRun(cfg)
+		return ClusterResult{Status: status, Err: err}
+	})
+}
+
+// RunToCompletion runs Sonobuoy to completion on every cluster of the fleet at
+// once, each with its own copy of the config. If cfg.ResultsDir is set, each
+// cluster's results are extracted into a directory named after it, in a
+// directory for the fleet's run under ResultsDir, which is then combined into
+// a single tarball next to it. A run failing on one cluster doesn't stop the
+// others; it's recorded in its result.
+func (f Fleet) RunToCompletion(cfg *RunToCompletionConfig) (*FleetRun, error) {
+	if len(f) == 0 {
+		return nil, errors.New("no clusters to run on")
+	}
+	run := &FleetRun{}
+	if cfg.ResultsDir != "" {
+		run.ResultsDir = filepath.Join(cfg.ResultsDir, time.Now().UTC().Format("200601021504")+"_sonobuoy_fleet")
+	}
+
+	run.Clusters = f.each(func(name string, c Interface) ClusterResult {
+		clusterCfg := *cfg
+		clusterCfg.RunConfig = *clusterRunConfig(&cfg.RunConfig)
+		if run.ResultsDir != "" {
+			clusterCfg.ResultsDir = filepath.Join(run.ResultsDir, ClusterDir(name))
+		}
+		completed, err := c.RunToCompletion(&clusterCfg)
+		result := ClusterResult{Run: completed, Err: err}
+		if completed != nil {
+			result.Status = completed.Status
+		}
+		return result
+	})
+	if run.ResultsDir == "" {
+		return run, nil
+	}
+
+	// Each cluster's results are already extracted, so only the combined
+	// tarball is kept.
+	for _, result := range run.Clusters {
+		if result.Run != nil && result.Run.Tarball != "" {
+			if err := os.Remove(result.Run.Tarball); err != nil {
+				return run, errors.Wrapf(err, "couldn't remove %v", result.Run.Tarball)
+			}
+			result.Run.Tarball = ""
+		}
+	}
+	if _, err := os.Stat(run.ResultsDir); os.IsNotExist(err) {
+		// None of the runs got as far as retrieving their results.
+		return run, nil
+	}
+
+	tarballPath := run.ResultsDir + ".tar.gz"
+	file, err := os.Create(tarballPath)
+	if err != nil {
+		return run, errors.Wrapf(err, "couldn't create %v", tarballPath)
+	}
+	err = tarball.EncodeTarball(file, run.ResultsDir)
+	if closeErr := file.Close(); err == nil {
+		err = errors.Wrapf(closeErr, "couldn't write %v", tarballPath)
+	}
+	if err != nil {
+		os.Remove(tarballPath)
+		return run, err
+	}
+	run.Tarball = tarballPath
+	return run, nil
+}
+
+// Failed returns whether the run on any cluster failed, or any of the tests it
+// ran did, or it couldn't be run at all.
+func (r *FleetRun) Failed() bool {
+	for _, result := range r.Clusters {
+		if result.Err != nil || result.Run == nil || result.Run.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// FleetStatus sums up the statuses of the runs on a fleet: failed if the run
+// on any cluster failed or its status couldn't be got, running if any are
+// still running, and complete once they all are.
+func FleetStatus(results []ClusterResult) string {
+	status := aggregation.CompleteStatus
+	for _, result := range results {
+		switch {
+		case result.Err != nil || result.Status == nil || result.Status.Status == aggregation.FailedStatus:
+			return aggregation.FailedStatus
+		case result.Status.Status != aggregation.CompleteStatus:
+			status = aggregation.RunningStatus
+		}
+	}
+	return status
+}
+
+// clusterRunConfig copies the config of a run for one cluster of a fleet,
+// since generating the manifest fills in the Sonobuoy config, and gives it its
+// own UUID.
+func clusterRunConfig(cfg *RunConfig) *RunConfig {
+	clusterCfg := *cfg
+	if cfg.Config != nil {
+		sonobuoyCfg := *cfg.Config
+		sonobuoyCfg.UUID = uuid.NewV4().String()
+		clusterCfg.Config = &sonobuoyCfg
+	}
+	return &clusterCfg
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/heptio/sonobuoy/pkg/tarball"
+)
+
+// fakeCluster runs to completion with the given status, or fails to, writing a
+// results tarball and extracting a report into the results directory.
+type fakeCluster struct {
+	Interface
+	status   string
+	failures int
+	err      error
+
+	mu    sync.Mutex
+	uuids []string
+}
+
+func (c *fakeCluster) RunToCompletion(cfg *RunToCompletionConfig) (*CompletedRun, error) {
+	c.mu.Lock()
+	c.uuids = append(c.uuids, cfg.Config.UUID)
+	c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	run := &CompletedRun{
+		Status: &aggregation.Status{Status: c.status},
+		Counts: []results.SuiteCounts{{Name: "e2e", Tests: 2, Failures: c.failures}},
+	}
+	if cfg.ResultsDir == "" {
+		return run, nil
+	}
+	run.Tarball = filepath.Join(cfg.ResultsDir, "results.tar.gz")
+	run.ResultsDir = filepath.Join(cfg.ResultsDir, "results")
+	if err := os.MkdirAll(run.ResultsDir, 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(run.Tarball, []byte("tarball"), 0644); err != nil {
+		return nil, err
+	}
+	return run, ioutil.WriteFile(filepath.Join(run.ResultsDir, "report.xml"), []byte(c.status), 0644)
+}
+
+func (c *fakeCluster) GetStatus(namespace string) (*aggregation.Status, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &aggregation.Status{Status: c.status}, nil
+}
+
+func TestFleetRunToCompletion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-fleet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	east := &fakeCluster{status: aggregation.CompleteStatus}
+	west := &fakeCluster{status: aggregation.CompleteStatus, failures: 1}
+	broken := &fakeCluster{err: errors.New("unreachable")}
+	fleet := Fleet{"us-east": east, "arn:aws:eks:us-west-2:1234:cluster/west": west, "broken": broken}
+
+	run, err := fleet.RunToCompletion(&RunToCompletionConfig{
+		RunConfig:  RunConfig{GenConfig: GenConfig{Config: config.New()}},
+		ResultsDir: dir,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var clusters []string
+	for _, result := range run.Clusters {
+		clusters = append(clusters, result.Cluster)
+	}
+	expectedClusters := []string{"arn:aws:eks:us-west-2:1234:cluster/west", "broken", "us-east"}
+	if !reflect.DeepEqual(clusters, expectedClusters) {
+		t.Errorf("expected results for %v, got %v", expectedClusters, clusters)
+	}
+	if run.Clusters[1].Err == nil {
+		t.Errorf("expected the broken cluster's error to be recorded")
+	}
+	if !run.Failed() {
+		t.Errorf("expected the fleet's run to have failed")
+	}
+	if east.uuids[0] == west.uuids[0] {
+		t.Errorf("expected each cluster's run to have its own UUID, both got %v", east.uuids[0])
+	}
+
+	// Only the combined tarball is kept, holding each cluster's results.
+	if _, err := os.Stat(filepath.Join(run.ResultsDir, "us-east", "results.tar.gz")); !os.IsNotExist(err) {
+		t.Errorf("expected the cluster's own tarball to be removed, got %v", err)
+	}
+	f, err := os.Open(run.Tarball)
+	if err != nil {
+		t.Fatalf("couldn't open combined tarball: %v", err)
+	}
+	defer f.Close()
+	extracted := filepath.Join(dir, "extracted")
+	if err := tarball.DecodeTarball(f, extracted); err != nil {
+		t.Fatalf("couldn't extract combined tarball: %v", err)
+	}
+	for _, cluster := range []string{"us-east", "arn:aws:eks:us-west-2:1234:cluster/west"} {
+		report, err := ioutil.ReadFile(filepath.Join(extracted, ClusterDir(cluster), "results", "report.xml"))
+		if err != nil || string(report) != aggregation.CompleteStatus {
+			t.Errorf("expected the report of %v in the combined tarball, got %q (%v)", cluster, report, err)
+		}
+	}
+}
+
+func TestClusterDir(t *testing.T) {
+	if dir := ClusterDir("us-east"); dir != "us-east" {
+		t.Errorf("expected a safe name to be kept, got %v", dir)
+	}
+	if dir := ClusterDir("arn:aws:eks:us-west-2:1234:cluster/west"); !strings.HasPrefix(dir, "arn_aws_eks_us-west-2_1234_cluster_west-") {
+		t.Errorf("expected unsafe characters to be replaced, got %v", dir)
+	}
+
+	dirs := map[string]string{}
+	for _, cluster := range []string{"a/b", "a:b", "a_b", ".", "..", ""} {
+		dir := ClusterDir(cluster)
+		if other, ok := dirs[dir]; ok {
+			t.Errorf("expected %q and %q to have different directories, both got %q", other, cluster, dir)
+		}
+		dirs[dir] = cluster
+		if dir == "." || dir == ".." || dir == "" || filepath.Base(dir) != dir {
+			t.Errorf("expected %q to have a directory of its own, got %q", cluster, dir)
+		}
+	}
+}
+
+func TestFleetStatus(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		fleet    Fleet
+		expected string
+	}{
+		{
+			desc: "all complete",
+			fleet: Fleet{
+				"a": &fakeCluster{status: aggregation.CompleteStatus},
+				"b": &fakeCluster{status: aggregation.CompleteStatus},
+			},
+			expected: aggregation.CompleteStatus,
+		}, {
+			desc: "some running",
+			fleet: Fleet{
+				"a": &fakeCluster{status: aggregation.CompleteStatus},
+				"b": &fakeCluster{status: aggregation.RunningStatus},
+			},
+			expected: aggregation.RunningStatus,
+		}, {
+			desc: "one failed",
+			fleet: Fleet{
+				"a": &fakeCluster{status: aggregation.FailedStatus},
+				"b": &fakeCluster{status: aggregation.RunningStatus},
+			},
+			expected: aggregation.FailedStatus,
+		}, {
+			desc: "one unreachable",
+			fleet: Fleet{
+				"a": &fakeCluster{status: aggregation.CompleteStatus},
+				"b": &fakeCluster{err: errors.New("unreachable")},
+			},
+			expected: aggregation.FailedStatus,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if status := FleetStatus(tc.fleet.GetStatus("heptio-sonobuoy")); status != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, status)
+			}
+		})
+	}
+}
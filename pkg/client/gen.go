@@ -19,60 +19,322 @@ package client
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"strings"
 
+	"github.com/ghodss/yaml"
 	"github.com/pkg/errors"
 
 	"github.com/heptio/sonobuoy/pkg/buildinfo"
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/image"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/loader"
 	"github.com/heptio/sonobuoy/pkg/templates"
 )
 
 // templateValues are used for direct template substitution for manifest generation.
 type templateValues struct {
-	E2EFocus        string
-	E2ESkip         string
-	SonobuoyConfig  string
-	SonobuoyImage   string
-	Version         string
-	Namespace       string
-	EnableRBAC      bool
-	ImagePullPolicy string
+	E2EFocus    string
+	E2ESkip     string
+	E2EParallel int
+	// E2ERepoList is the YAML of the e2e tests' repo list, or empty if they
+	// use their default registries.
+	E2ERepoList       string
+	SonobuoyConfig    string
+	SonobuoyImage     string
+	Version           string
+	Namespace         string
+	EnableRBAC        bool
+	NamespaceScoped   bool
+	ImagePullPolicy   string
+	ImagePullSecrets  []string
+	Schedule          string
+	ResultsVolumeSize string
+	StorageSecret     string
+	// AggregatorPort is the port the aggregator serves results on, which
+	// its Service exposes and its readiness is probed on.
+	AggregatorPort int
+	MetricsPort    int
+	// AggregatorResources are the resource requests and limits of the
+	// aggregator's container.
+	AggregatorResources config.ResourceConfig
+	PriorityClassName   string
+	RuntimeClassName    string
+	CustomPlugins       []customPlugin
+	// ShipPlugins is set if some custom plugins are too big for the plugins
+	// ConfigMap, so the aggregator waits for sonobuoy run to ship them.
+	ShipPlugins bool
+	// CertManagerIssuer is the issuer the aggregator's serving certificate
+	// is requested from, if any.
+	CertManagerIssuer *certManagerIssuer
+	// Labels and Annotations are YAML for the custom labels and annotations
+	// of every object, or empty if there are none.
+	Labels      string
+	Annotations string
+	// RestrictedUser is the user the aggregator runs as when it's given the
+	// restricted security context, or 0 if it isn't. PrivilegedNamespace
+	// labels the namespace so PodSecurity admission lets privileged plugin
+	// pods in.
+	RestrictedUser      int
+	PrivilegedNamespace bool
+	// PodIPs passes the aggregator all of its pod's IPs, rather than just
+	// the primary one, to advertise the one of the chosen address family.
+	PodIPs bool
 }
 
+// certManagerIssuer refers to a cert-manager Issuer or ClusterIssuer.
+type certManagerIssuer struct {
+	Kind string
+	Name string
+}
+
+// aggregatorTLSDir is where the aggregator's serving certificate from
+// cert-manager is mounted.
+const aggregatorTLSDir = "/etc/sonobuoy-tls"
+
+// podSecurityEnforceLabel is the namespace label that sets which PodSecurity
+// profile admission enforces.
+const podSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+
+// parseCertManagerIssuer parses an issuer given as Kind/name, or just the name
+// of an Issuer.
+func parseCertManagerIssuer(issuer string) (*certManagerIssuer, error) {
+	parsed := &certManagerIssuer{Kind: "Issuer", Name: issuer}
+	if i := strings.Index(issuer, "/"); i >= 0 {
+		parsed.Kind, parsed.Name = issuer[:i], issuer[i+1:]
+	}
+	if parsed.Kind != "Issuer" && parsed.Kind != "ClusterIssuer" {
+		return nil, errors.Errorf("cert-manager issuer %q must be an Issuer or ClusterIssuer", issuer)
+	}
+	if parsed.Name == "" {
+		return nil, errors.Errorf("cert-manager issuer %q has no name", issuer)
+	}
+	return parsed, nil
+}
+
+// customPlugin is a plugin definition added to the plugins ConfigMap.
+type customPlugin struct {
+	Name       string
+	Definition string
+}
+
+// customPluginsLimit is how much of the plugins ConfigMap custom plugin
+// definitions can fill. ConfigMaps are limited to 1MiB, and the rest is left
+// for the built-in plugins.
+const customPluginsLimit = 1000 * 1024
+
+// splitCustomPlugins returns the custom plugins that fit in the plugins
+// ConfigMap, in order, and those that don't.
+func splitCustomPlugins(plugins []customPlugin) (fit, shipped []customPlugin) {
+	size := 0
+	for _, p := range plugins {
+		if size+len(p.Definition) > customPluginsLimit {
+			shipped = append(shipped, p)
+			continue
+		}
+		size += len(p.Definition)
+		fit = append(fit, p)
+	}
+	return fit, shipped
+}
+
+// builtinPlugins are the plugins always in the plugins ConfigMap.
+var builtinPlugins = map[string]bool{"e2e": true, "systemd-logs": true, "node-diagnostics": true, "kube-bench": true, "network-connectivity": true}
+
+// yamlEscaper escapes strings put in double quoted YAML strings, such as
+// regexes with escaped characters of their own.
+var yamlEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
 // GenerateManifest fills in a template with a Sonobuoy config
 func (c *SonobuoyClient) GenerateManifest(cfg *GenConfig) ([]byte, error) {
+	manifest, _, err := c.generateManifest(cfg, false)
+	return manifest, err
+}
+
+// generateManifest fills in a template with a Sonobuoy config, also returning
+// the custom plugins too big for the plugins ConfigMap. Unless they can be
+// shipped to the aggregator once it's created, as sonobuoy run does, there
+// mustn't be any.
+func (c *SonobuoyClient) generateManifest(cfg *GenConfig, canShip bool) ([]byte, []customPlugin, error) {
+	cfg.Image = cfg.ImageMapping.Get(cfg.Image)
 	if cfg.Image != "" {
 		cfg.Config.WorkerImage = cfg.Image
 	}
+	cfg.Config.WorkerImage = cfg.ImageMapping.Get(cfg.Config.WorkerImage)
 
 	if cfg.ImagePullPolicy != "" {
 		cfg.Config.ImagePullPolicy = cfg.ImagePullPolicy
 	}
 
+	if len(cfg.ImagePullSecrets) > 0 {
+		cfg.Config.ImagePullSecrets = cfg.ImagePullSecrets
+	}
+
 	if cfg.Namespace != "" {
 		cfg.Config.Namespace = cfg.Namespace
 	}
 
+	if cfg.Schedule != "" {
+		cfg.Config.KeepResults = cfg.KeepResults
+	}
+
+	customPlugins := make([]customPlugin, len(cfg.CustomPlugins))
+	for i, definition := range cfg.CustomPlugins {
+		def, err := loader.LoadDefinition(definition)
+		if err != nil {
+			return nil, nil, err
+		}
+		name := def.SonobuoyConfig.PluginName
+		if builtinPlugins[name] {
+			return nil, nil, errors.Errorf("plugin %v has the same name as a built-in plugin", name)
+		}
+		for _, p := range customPlugins[:i] {
+			if p.Name == name {
+				return nil, nil, errors.Errorf("more than one plugin is named %v", name)
+			}
+		}
+		customPlugins[i] = customPlugin{Name: name, Definition: strings.TrimSpace(string(definition))}
+	}
+	customPlugins, shipped := splitCustomPlugins(customPlugins)
+	if len(shipped) > 0 {
+		var names []string
+		for i, p := range shipped {
+			names = append(names, p.Name)
+			shipped[i].Definition = string(cfg.ImageMapping.Rewrite([]byte(p.Definition)))
+		}
+		switch {
+		case !canShip:
+			return nil, nil, errors.Errorf("plugins %v are too big for a ConfigMap, and can only be run with sonobuoy run", strings.Join(names, ", "))
+		case cfg.Schedule != "":
+			return nil, nil, errors.Errorf("plugins %v are too big for a ConfigMap, and can't be run on a schedule", strings.Join(names, ", "))
+		}
+	}
+
+	// Workers must reach the aggregator at a name in its certificate from
+	// cert-manager, rather than at its pod's IP.
+	var issuer *certManagerIssuer
+	if cfg.CertManagerIssuer != "" {
+		parsed, err := parseCertManagerIssuer(cfg.CertManagerIssuer)
+		if err != nil {
+			return nil, nil, err
+		}
+		issuer = parsed
+		cfg.Config.Aggregation.TLSCertDir = aggregatorTLSDir
+		if cfg.Config.Aggregation.AdvertiseAddress == "" {
+			cfg.Config.Aggregation.AdvertiseAddress = fmt.Sprintf("%v.%v.svc:%d", plugin.AggregatorService, cfg.Config.Namespace, cfg.Config.Aggregation.BindPort)
+		}
+	}
+
+	if cfg.E2EConfig.Parallel < 0 {
+		return nil, nil, errors.Errorf("e2e parallelism %d can't be negative", cfg.E2EConfig.Parallel)
+	}
+	var e2eParallel int
+	if cfg.E2EConfig.Parallel > 1 {
+		e2eParallel = cfg.E2EConfig.Parallel
+	}
+	var e2eRepoList string
+	if cfg.E2EConfig.RepoList != nil {
+		if err := cfg.E2EConfig.RepoList.Validate(); err != nil {
+			return nil, nil, err
+		}
+		var err error
+		if e2eRepoList, err = cfg.E2EConfig.RepoList.YAML(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := plugin.ValidateMetadata(cfg.Config.Labels, cfg.Config.Annotations); err != nil {
+		return nil, nil, err
+	}
+	labels, err := metadataYAML(cfg.Config.Labels)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "couldn't serialize labels")
+	}
+	annotations, err := metadataYAML(cfg.Config.Annotations)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "couldn't serialize annotations")
+	}
+
+	var restrictedUser int
+	var privilegedNamespace bool
+	switch cfg.Config.SecurityContextMode {
+	case "", plugin.SecurityContextNone:
+	case plugin.SecurityContextRestricted:
+		restrictedUser = plugin.RestrictedUser
+	case plugin.SecurityContextPrivileged:
+		restrictedUser = plugin.RestrictedUser
+		// Leave the namespace alone if the user chose its profile.
+		_, enforced := cfg.Config.Labels[podSecurityEnforceLabel]
+		privilegedNamespace = !enforced
+	default:
+		return nil, nil, errors.Errorf("invalid security context mode %q", cfg.Config.SecurityContextMode)
+	}
+
 	marshalledConfig, err := json.Marshal(cfg.Config)
 	if err != nil {
-		return nil, errors.Wrap(err, "couldn't marshall selector")
+		return nil, nil, errors.Wrap(err, "couldn't marshall selector")
 	}
 
 	tmplVals := &templateValues{
-		E2EFocus:        cfg.E2EConfig.Focus,
-		E2ESkip:         cfg.E2EConfig.Skip,
-		SonobuoyConfig:  string(marshalledConfig),
-		SonobuoyImage:   cfg.Image,
-		Version:         buildinfo.Version,
-		Namespace:       cfg.Namespace,
-		EnableRBAC:      cfg.EnableRBAC,
-		ImagePullPolicy: cfg.ImagePullPolicy,
+		E2EFocus:          yamlEscaper.Replace(cfg.E2EConfig.Focus),
+		E2ESkip:           yamlEscaper.Replace(cfg.E2EConfig.SkipList()),
+		E2EParallel:       e2eParallel,
+		E2ERepoList:       e2eRepoList,
+		SonobuoyConfig:    string(marshalledConfig),
+		SonobuoyImage:     cfg.Image,
+		Version:           buildinfo.Version,
+		Namespace:         cfg.Namespace,
+		EnableRBAC:        cfg.EnableRBAC,
+		NamespaceScoped:   cfg.Config.NamespaceScoped,
+		ImagePullPolicy:   cfg.ImagePullPolicy,
+		ImagePullSecrets:  cfg.Config.ImagePullSecrets,
+		Schedule:          cfg.Schedule,
+		ResultsVolumeSize: cfg.ResultsVolumeSize,
+		StorageSecret:     cfg.StorageSecret,
+		AggregatorPort:    cfg.Config.Aggregation.BindPort,
+		MetricsPort:       cfg.Config.Aggregation.MetricsPort,
+
+		AggregatorResources: cfg.Config.AggregatorResources,
+		PriorityClassName:   cfg.Config.PriorityClassName,
+		RuntimeClassName:    cfg.Config.RuntimeClassName,
+		CustomPlugins:       customPlugins,
+		ShipPlugins:         len(shipped) > 0,
+		CertManagerIssuer:   issuer,
+		Labels:              labels,
+		Annotations:         annotations,
+		RestrictedUser:      restrictedUser,
+		PrivilegedNamespace: privilegedNamespace,
+		PodIPs:              cfg.Config.Aggregation.AddressFamily != "",
 	}
 
 	var buf bytes.Buffer
 
 	if err := templates.Manifest.Execute(&buf, tmplVals); err != nil {
-		return nil, errors.Wrap(err, "couldn't execute manifest template")
+		return nil, nil, errors.Wrap(err, "couldn't execute manifest template")
+	}
+
+	return cfg.ImageMapping.Rewrite(buf.Bytes()), shipped, nil
+}
+
+// metadataYAML returns labels or annotations as YAML, or an empty string if
+// there are none.
+func metadataYAML(metadata map[string]string) (string, error) {
+	if len(metadata) == 0 {
+		return "", nil
 	}
+	b, err := yaml.Marshal(metadata)
+	return strings.TrimSpace(string(b)), err
+}
 
-	return buf.Bytes(), nil
+// GetImages lists the images that a run with the given config needs.
+func (c *SonobuoyClient) GetImages(cfg *GenConfig) ([]string, error) {
+	manifest, shipped, err := c.generateManifest(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range shipped {
+		manifest = append(manifest, "\n"+p.Definition...)
+	}
+	return image.Collect(manifest, cfg.Config.WorkerImage), nil
 }
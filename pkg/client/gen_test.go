@@ -0,0 +1,865 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/image"
+	"github.com/heptio/sonobuoy/pkg/plugin/manifest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// manifestObjects decodes a generated manifest into its objects.
+func manifestObjects(t *testing.T, manifest []byte) []unstructured.Unstructured {
+	objs := []unstructured.Unstructured{}
+	d := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifest), bufferSize)
+	for {
+		ext := runtime.RawExtension{}
+		if err := d.Decode(&ext); err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatalf("couldn't decode manifest: %v", err)
+		}
+		ext.Raw = bytes.TrimSpace(ext.Raw)
+		if len(ext.Raw) == 0 || bytes.Equal(ext.Raw, []byte("null")) {
+			continue
+		}
+
+		obj := unstructured.Unstructured{}
+		if err := runtime.DecodeInto(scheme.Codecs.UniversalDecoder(), ext.Raw, &obj); err != nil {
+			t.Fatalf("couldn't decode manifest object: %v", err)
+		}
+		objs = append(objs, obj)
+	}
+	return objs
+}
+
+// manifestKinds decodes a generated manifest and returns the kinds of the
+// objects in it, keyed by name.
+func manifestKinds(t *testing.T, manifest []byte) map[string]string {
+	kinds := map[string]string{}
+	for _, obj := range manifestObjects(t, manifest) {
+		kinds[obj.GetName()+"/"+obj.GetKind()] = obj.GetKind()
+	}
+	return kinds
+}
+
+func TestGenerateManifest_schedule(t *testing.T) {
+	testCases := []struct {
+		name     string
+		schedule string
+		expected []string
+		missing  []string
+	}{
+		{
+			name:     "once",
+			expected: []string{"sonobuoy/Pod"},
+			missing:  []string{"sonobuoy/CronJob", "sonobuoy-results/PersistentVolumeClaim"},
+		},
+		{
+			name:     "scheduled",
+			schedule: "0 2 * * *",
+			expected: []string{"sonobuoy/CronJob", "sonobuoy-results/PersistentVolumeClaim"},
+			missing:  []string{"sonobuoy/Pod"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &GenConfig{
+				E2EConfig:         &E2EConfig{},
+				Config:            config.New(),
+				Image:             "gcr.io/heptio-images/sonobuoy:latest",
+				Namespace:         "heptio-sonobuoy",
+				ImagePullPolicy:   "Always",
+				Schedule:          tc.schedule,
+				KeepResults:       3,
+				ResultsVolumeSize: "1Gi",
+			}
+
+			manifest, err := (&SonobuoyClient{}).GenerateManifest(cfg)
+			if err != nil {
+				t.Fatalf("couldn't generate manifest: %v", err)
+			}
+
+			kinds := manifestKinds(t, manifest)
+			for _, key := range tc.expected {
+				if _, ok := kinds[key]; !ok {
+					t.Errorf("expected %v in manifest, got %v", key, kinds)
+				}
+			}
+			for _, key := range tc.missing {
+				if _, ok := kinds[key]; ok {
+					t.Errorf("didn't expect %v in manifest", key)
+				}
+			}
+
+			expectedKeep := 0
+			if tc.schedule != "" {
+				expectedKeep = 3
+			}
+			if cfg.Config.KeepResults != expectedKeep {
+				t.Errorf("expected KeepResults %v, got %v", expectedKeep, cfg.Config.KeepResults)
+			}
+		})
+	}
+}
+
+func TestGenerateManifest_namespaceScoped(t *testing.T) {
+	testCases := []struct {
+		name            string
+		namespaceScoped bool
+		expected        []string
+		missing         []string
+	}{
+		{
+			name:     "cluster",
+			expected: []string{"heptio-sonobuoy/Namespace", "sonobuoy-serviceaccount/ClusterRole", "sonobuoy-serviceaccount-heptio-sonobuoy/ClusterRoleBinding"},
+			missing:  []string{"sonobuoy-serviceaccount/Role", "sonobuoy-serviceaccount/RoleBinding"},
+		},
+		{
+			name:            "namespace scoped",
+			namespaceScoped: true,
+			expected:        []string{"sonobuoy-serviceaccount/Role", "sonobuoy-serviceaccount/RoleBinding", "sonobuoy/Pod"},
+			missing:         []string{"heptio-sonobuoy/Namespace", "sonobuoy-serviceaccount/ClusterRole", "sonobuoy-serviceaccount-heptio-sonobuoy/ClusterRoleBinding"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &GenConfig{
+				E2EConfig:       &E2EConfig{},
+				Config:          config.New(),
+				Image:           "gcr.io/heptio-images/sonobuoy:latest",
+				Namespace:       "heptio-sonobuoy",
+				EnableRBAC:      true,
+				ImagePullPolicy: "Always",
+			}
+			cfg.Config.NamespaceScoped = tc.namespaceScoped
+
+			manifest, err := (&SonobuoyClient{}).GenerateManifest(cfg)
+			if err != nil {
+				t.Fatalf("couldn't generate manifest: %v", err)
+			}
+
+			kinds := manifestKinds(t, manifest)
+			for _, key := range tc.expected {
+				if _, ok := kinds[key]; !ok {
+					t.Errorf("expected %v in manifest, got %v", key, kinds)
+				}
+			}
+			for _, key := range tc.missing {
+				if _, ok := kinds[key]; ok {
+					t.Errorf("didn't expect %v in manifest", key)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateManifest_imagePullSecrets(t *testing.T) {
+	cfg := &GenConfig{
+		E2EConfig:        &E2EConfig{},
+		Config:           config.New(),
+		Image:            "gcr.io/heptio-images/sonobuoy:latest",
+		Namespace:        "heptio-sonobuoy",
+		ImagePullPolicy:  "Always",
+		ImagePullSecrets: []string{"regcred"},
+	}
+
+	manifest, err := (&SonobuoyClient{}).GenerateManifest(cfg)
+	if err != nil {
+		t.Fatalf("couldn't generate manifest: %v", err)
+	}
+
+	if !reflect.DeepEqual(cfg.Config.ImagePullSecrets, []string{"regcred"}) {
+		t.Errorf("expected config ImagePullSecrets [regcred], got %v", cfg.Config.ImagePullSecrets)
+	}
+	if !bytes.Contains(manifest, []byte("imagePullSecrets:\n  - name: regcred")) {
+		t.Errorf("expected the aggregator pod to use the image pull secret, got\n%s", manifest)
+	}
+}
+
+func TestGenerateManifest_resources(t *testing.T) {
+	cfg := &GenConfig{
+		E2EConfig:       &E2EConfig{},
+		Config:          config.New(),
+		Image:           "gcr.io/heptio-images/sonobuoy:latest",
+		Namespace:       "heptio-sonobuoy",
+		ImagePullPolicy: "Always",
+	}
+	cfg.Config.AggregatorResources = config.ResourceConfig{
+		Requests: map[string]string{"cpu": "100m", "memory": "128Mi"},
+		Limits:   map[string]string{"memory": "1Gi"},
+	}
+	cfg.Config.PriorityClassName = "sonobuoy-critical"
+	cfg.Config.RuntimeClassName = "gvisor"
+
+	manifest, err := (&SonobuoyClient{}).GenerateManifest(cfg)
+	if err != nil {
+		t.Fatalf("couldn't generate manifest: %v", err)
+	}
+
+	for _, obj := range manifestObjects(t, manifest) {
+		if obj.GetKind() != "Pod" {
+			continue
+		}
+		containers, _ := unstructured.NestedSlice(obj.Object, "spec", "containers")
+		if len(containers) != 1 {
+			t.Fatalf("expected 1 aggregator container, got %v", len(containers))
+		}
+		got, _ := unstructured.NestedMap(containers[0].(map[string]interface{}), "resources")
+		expected := map[string]interface{}{
+			"requests": map[string]interface{}{"cpu": "100m", "memory": "128Mi"},
+			"limits":   map[string]interface{}{"memory": "1Gi"},
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected aggregator resources %v, got %v", expected, got)
+		}
+		if class, _ := unstructured.NestedString(obj.Object, "spec", "priorityClassName"); class != "sonobuoy-critical" {
+			t.Errorf("expected priority class sonobuoy-critical, got %q", class)
+		}
+		if class, _ := unstructured.NestedString(obj.Object, "spec", "runtimeClassName"); class != "gvisor" {
+			t.Errorf("expected runtime class gvisor, got %q", class)
+		}
+		return
+	}
+	t.Fatalf("expected an aggregator pod in\n%s", manifest)
+}
+
+func TestGenerateManifest_imageMapping(t *testing.T) {
+	cfg := &GenConfig{
+		E2EConfig:       &E2EConfig{},
+		Config:          config.New(),
+		Image:           "gcr.io/heptio-images/sonobuoy:latest",
+		Namespace:       "heptio-sonobuoy",
+		ImagePullPolicy: "Always",
+		ImageMapping: image.Mapping{
+			"gcr.io/heptio-images/sonobuoy:latest":         "registry.example.com/sonobuoy:latest",
+			"gcr.io/heptio-images/kube-conformance:latest": "registry.example.com/kube-conformance:latest",
+		},
+	}
+
+	images, err := (&SonobuoyClient{}).GetImages(cfg)
+	if err != nil {
+		t.Fatalf("couldn't list images: %v", err)
+	}
+
+	expected := []string{
+		"gcr.io/heptio-images/sonobuoy-plugin-kube-bench:latest",
+		"gcr.io/heptio-images/sonobuoy-plugin-node-diagnostics:latest",
+		"gcr.io/heptio-images/sonobuoy-plugin-systemd-logs:latest",
+		"registry.example.com/kube-conformance:latest",
+		"registry.example.com/sonobuoy:latest",
+	}
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("expected images %v, got %v", expected, images)
+	}
+	if cfg.Config.WorkerImage != "registry.example.com/sonobuoy:latest" {
+		t.Errorf("expected mapped worker image, got %v", cfg.Config.WorkerImage)
+	}
+}
+
+func TestGenerateManifest_e2eRegexes(t *testing.T) {
+	e2ecfg := &E2EConfig{
+		Focus: `\[Conformance\]|"quoted"`,
+		Skip:  `\[Disruptive\]`,
+	}
+	cfg := &GenConfig{
+		E2EConfig:       e2ecfg,
+		Config:          config.New(),
+		Image:           "gcr.io/heptio-images/sonobuoy:latest",
+		Namespace:       "heptio-sonobuoy",
+		ImagePullPolicy: "Always",
+	}
+
+	generated, err := (&SonobuoyClient{}).GenerateManifest(cfg)
+	if err != nil {
+		t.Fatalf("couldn't generate manifest: %v", err)
+	}
+
+	env := e2eEnv(t, generated)
+	if env["E2E_FOCUS"] != e2ecfg.Focus {
+		t.Errorf("expected E2E_FOCUS %q, got %q", e2ecfg.Focus, env["E2E_FOCUS"])
+	}
+	if env["E2E_SKIP"] != e2ecfg.Skip {
+		t.Errorf("expected E2E_SKIP %q, got %q", e2ecfg.Skip, env["E2E_SKIP"])
+	}
+	if _, ok := env["E2E_PARALLEL"]; ok {
+		t.Errorf("expected no E2E_PARALLEL for a serial run, got %q", env["E2E_PARALLEL"])
+	}
+}
+
+func TestGenerateManifest_e2eParallel(t *testing.T) {
+	testCases := []struct {
+		name           string
+		skip           string
+		parallel       int
+		expectSkip     string
+		expectParallel string
+		expectErr      bool
+	}{
+		{name: "serial", skip: "Alpha", parallel: 1, expectSkip: "Alpha"},
+		{name: "parallel", skip: "Alpha", parallel: 4, expectSkip: `Alpha|\[Serial\]`, expectParallel: "4"},
+		{name: "parallel without skips", parallel: 4, expectSkip: `\[Serial\]`, expectParallel: "4"},
+		{name: "negative", parallel: -1, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &GenConfig{
+				E2EConfig:       &E2EConfig{Focus: "Conformance", Skip: tc.skip, Parallel: tc.parallel},
+				Config:          config.New(),
+				Image:           "gcr.io/heptio-images/sonobuoy:latest",
+				Namespace:       "heptio-sonobuoy",
+				ImagePullPolicy: "Always",
+			}
+
+			generated, err := (&SonobuoyClient{}).GenerateManifest(cfg)
+			if tc.expectErr {
+				if err == nil {
+					t.Error("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("couldn't generate manifest: %v", err)
+			}
+
+			env := e2eEnv(t, generated)
+			if env["E2E_SKIP"] != tc.expectSkip {
+				t.Errorf("expected E2E_SKIP %q, got %q", tc.expectSkip, env["E2E_SKIP"])
+			}
+			if env["E2E_PARALLEL"] != tc.expectParallel {
+				t.Errorf("expected E2E_PARALLEL %q, got %q", tc.expectParallel, env["E2E_PARALLEL"])
+			}
+		})
+	}
+}
+
+func TestGenerateManifest_e2eRepoList(t *testing.T) {
+	cfg := &GenConfig{
+		E2EConfig: &E2EConfig{
+			Focus:    "Conformance",
+			RepoList: image.RepoList{"e2eRegistry": "registry.example.com/e2e", "gcRegistry": "registry.example.com/gc"},
+		},
+		Config:          config.New(),
+		Image:           "gcr.io/heptio-images/sonobuoy:latest",
+		Namespace:       "heptio-sonobuoy",
+		ImagePullPolicy: "Always",
+	}
+
+	generated, err := (&SonobuoyClient{}).GenerateManifest(cfg)
+	if err != nil {
+		t.Fatalf("couldn't generate manifest: %v", err)
+	}
+
+	var repoList string
+	var def manifest.Manifest
+	for _, obj := range manifestObjects(t, generated) {
+		if obj.GetKind() != "ConfigMap" {
+			continue
+		}
+		if obj.GetName() == "sonobuoy-e2e-repo-list" {
+			repoList, _ = unstructured.NestedString(obj.Object, "data", "repo-list.yaml")
+		}
+		if e2eYAML, ok := unstructured.NestedString(obj.Object, "data", "e2e.yaml"); ok {
+			if err := runtime.DecodeInto(manifest.Decoder, []byte(e2eYAML), &def); err != nil {
+				t.Fatalf("couldn't decode e2e plugin definition: %v", err)
+			}
+		}
+	}
+
+	expected := "e2eRegistry: registry.example.com/e2e\ngcRegistry: registry.example.com/gc\n"
+	if repoList != expected {
+		t.Errorf("expected the repo list ConfigMap to have %q, got %q", expected, repoList)
+	}
+	if env := e2eEnv(t, generated); env["KUBE_TEST_REPO_LIST"] != "/etc/sonobuoy-e2e/repo-list.yaml" {
+		t.Errorf("expected the e2e plugin to be given the repo list, got KUBE_TEST_REPO_LIST %q", env["KUBE_TEST_REPO_LIST"])
+	}
+	if len(def.ExtraVolumes) != 1 || def.ExtraVolumes[0].ConfigMap == nil || def.ExtraVolumes[0].ConfigMap.Name != "sonobuoy-e2e-repo-list" {
+		t.Errorf("expected the repo list ConfigMap to be a volume of the e2e plugin, got %+v", def.ExtraVolumes)
+	}
+	mounted := false
+	for _, mount := range def.Spec.VolumeMounts {
+		mounted = mounted || (mount.Name == "e2e-repo-list" && mount.MountPath == "/etc/sonobuoy-e2e")
+	}
+	if !mounted {
+		t.Errorf("expected the repo list to be mounted in the e2e plugin, got %+v", def.Spec.VolumeMounts)
+	}
+
+	cfg.E2EConfig.RepoList = image.RepoList{"e2eRegistry": "https://registry.example.com"}
+	if _, err := (&SonobuoyClient{}).GenerateManifest(cfg); err == nil {
+		t.Error("expected an invalid repo list to be rejected")
+	}
+}
+
+// e2eEnv returns the environment of the e2e plugin in a generated manifest.
+func e2eEnv(t *testing.T, generated []byte) map[string]string {
+	env := map[string]string{}
+	for _, obj := range manifestObjects(t, generated) {
+		if obj.GetKind() != "ConfigMap" {
+			continue
+		}
+		e2eYAML, ok := unstructured.NestedString(obj.Object, "data", "e2e.yaml")
+		if !ok {
+			continue
+		}
+		var def manifest.Manifest
+		if err := runtime.DecodeInto(manifest.Decoder, []byte(e2eYAML), &def); err != nil {
+			t.Fatalf("couldn't decode e2e plugin definition: %v", err)
+		}
+		for _, v := range def.Spec.Env {
+			env[v.Name] = v.Value
+		}
+	}
+	return env
+}
+
+func TestGenerateManifest_customPlugins(t *testing.T) {
+	definition := func(name string) []byte {
+		return []byte(`
+sonobuoy-config:
+  driver: Job
+  plugin-name: ` + name + `
+  result-type: ` + name + `
+spec:
+  image: registry.example.com/` + name + `:v1
+  name: plugin
+`)
+	}
+
+	testCases := []struct {
+		name      string
+		plugins   [][]byte
+		expectErr bool
+	}{
+		{name: "custom", plugins: [][]byte{definition("network"), definition("pod-checks")}},
+		{name: "built-in name", plugins: [][]byte{definition("e2e")}, expectErr: true},
+		{name: "duplicate name", plugins: [][]byte{definition("network"), definition("network")}, expectErr: true},
+		{name: "invalid", plugins: [][]byte{[]byte("sonobuoy-config: [")}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &GenConfig{
+				E2EConfig:       &E2EConfig{},
+				Config:          config.New(),
+				Image:           "gcr.io/heptio-images/sonobuoy:latest",
+				Namespace:       "heptio-sonobuoy",
+				ImagePullPolicy: "Always",
+				CustomPlugins:   tc.plugins,
+			}
+
+			generated, err := (&SonobuoyClient{}).GenerateManifest(cfg)
+			if tc.expectErr {
+				if err == nil {
+					t.Error("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("couldn't generate manifest: %v", err)
+			}
+
+			for _, obj := range manifestObjects(t, generated) {
+				if obj.GetName() != "sonobuoy-plugins-cm" {
+					continue
+				}
+				for _, name := range []string{"e2e", "network", "pod-checks"} {
+					pluginYAML, _ := unstructured.NestedString(obj.Object, "data", name+".yaml")
+					var def manifest.Manifest
+					if err := runtime.DecodeInto(manifest.Decoder, []byte(pluginYAML), &def); err != nil || def.SonobuoyConfig.PluginName != name {
+						t.Errorf("expected plugin %v in the plugins ConfigMap, got %q (%v)", name, pluginYAML, err)
+					}
+				}
+			}
+			if images := image.Collect(generated); !reflect.DeepEqual(images[len(images)-2:], []string{"registry.example.com/network:v1", "registry.example.com/pod-checks:v1"}) {
+				t.Errorf("expected the custom plugins' images to be used, got %v", images)
+			}
+		})
+	}
+}
+
+func TestGenerateManifest_shipPlugins(t *testing.T) {
+	definition := func(name string, size int) []byte {
+		return []byte(`
+sonobuoy-config:
+  driver: Job
+  plugin-name: ` + name + `
+  result-type: ` + name + `
+  description: ` + strings.Repeat("x", size) + `
+spec:
+  image: registry.example.com/` + name + `:v1
+  name: plugin
+`)
+	}
+	newConfig := func() *GenConfig {
+		return &GenConfig{
+			E2EConfig:       &E2EConfig{},
+			Config:          config.New(),
+			Image:           "gcr.io/heptio-images/sonobuoy:latest",
+			Namespace:       "heptio-sonobuoy",
+			ImagePullPolicy: "Always",
+			CustomPlugins:   [][]byte{definition("small", 10), definition("big", customPluginsLimit)},
+		}
+	}
+
+	if _, err := (&SonobuoyClient{}).GenerateManifest(newConfig()); err == nil {
+		t.Error("expected an error generating a manifest with a plugin too big for a ConfigMap, got none")
+	}
+
+	scheduled := newConfig()
+	scheduled.Schedule = "@daily"
+	if _, _, err := (&SonobuoyClient{}).generateManifest(scheduled, true); err == nil {
+		t.Error("expected an error scheduling a plugin too big for a ConfigMap, got none")
+	}
+
+	generated, shipped, err := (&SonobuoyClient{}).generateManifest(newConfig(), true)
+	if err != nil {
+		t.Fatalf("couldn't generate manifest: %v", err)
+	}
+	if len(shipped) != 1 || shipped[0].Name != "big" {
+		t.Fatalf("expected only plugin big to be shipped, got %v", shipped)
+	}
+	for _, obj := range manifestObjects(t, generated) {
+		switch obj.GetName() {
+		case "sonobuoy-plugins-cm":
+			data, _ := unstructured.NestedStringMap(obj.Object, "data")
+			if _, ok := data["small.yaml"]; !ok {
+				t.Error("expected plugin small in the plugins ConfigMap")
+			}
+			if _, ok := data["big.yaml"]; ok {
+				t.Error("expected plugin big not to be in the plugins ConfigMap")
+			}
+		case "sonobuoy":
+			if obj.GetKind() != "Pod" {
+				continue
+			}
+			initContainers, _ := unstructured.NestedSlice(obj.Object, "spec", "initContainers")
+			if len(initContainers) != 1 || initContainers[0].(map[string]interface{})["name"] != shipContainerName {
+				t.Errorf("expected the aggregator to wait for plugins to be shipped, got init containers %v", initContainers)
+			}
+		}
+	}
+}
+
+func TestSplitCustomPlugins(t *testing.T) {
+	sized := func(name string, size int) customPlugin {
+		return customPlugin{Name: name, Definition: strings.Repeat("x", size)}
+	}
+	fit, shipped := splitCustomPlugins([]customPlugin{
+		sized("a", customPluginsLimit/2),
+		sized("b", customPluginsLimit),
+		sized("c", customPluginsLimit/2),
+		sized("d", 1),
+	})
+	names := func(plugins []customPlugin) (names []string) {
+		for _, p := range plugins {
+			names = append(names, p.Name)
+		}
+		return names
+	}
+	if !reflect.DeepEqual(names(fit), []string{"a", "c"}) {
+		t.Errorf("expected plugins [a c] to fit, got %v", names(fit))
+	}
+	if !reflect.DeepEqual(names(shipped), []string{"b", "d"}) {
+		t.Errorf("expected plugins [b d] to be shipped, got %v", names(shipped))
+	}
+}
+
+func TestGenerateManifest_certManagerIssuer(t *testing.T) {
+	testCases := []struct {
+		name       string
+		issuer     string
+		expectKind string
+		expectName string
+		expectErr  bool
+	}{
+		{name: "issuer name", issuer: "corp-ca", expectKind: "Issuer", expectName: "corp-ca"},
+		{name: "cluster issuer", issuer: "ClusterIssuer/corp-ca", expectKind: "ClusterIssuer", expectName: "corp-ca"},
+		{name: "unknown kind", issuer: "Certificate/corp-ca", expectErr: true},
+		{name: "no name", issuer: "Issuer/", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &GenConfig{
+				E2EConfig:         &E2EConfig{},
+				Config:            config.New(),
+				Image:             "gcr.io/heptio-images/sonobuoy:latest",
+				Namespace:         "heptio-sonobuoy",
+				ImagePullPolicy:   "Always",
+				CertManagerIssuer: tc.issuer,
+			}
+			cfg.Config.Namespace = "heptio-sonobuoy"
+
+			generated, err := (&SonobuoyClient{}).GenerateManifest(cfg)
+			if tc.expectErr {
+				if err == nil {
+					t.Error("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("couldn't generate manifest: %v", err)
+			}
+
+			var certificate, pod *unstructured.Unstructured
+			objs := manifestObjects(t, generated)
+			for i := range objs {
+				switch objs[i].GetKind() {
+				case "Certificate":
+					certificate = &objs[i]
+				case "Pod":
+					pod = &objs[i]
+				}
+			}
+			if certificate == nil || pod == nil {
+				t.Fatalf("expected a Certificate and the aggregator Pod, got %v", manifestKinds(t, generated))
+			}
+			kind, _ := unstructured.NestedString(certificate.Object, "spec", "issuerRef", "kind")
+			name, _ := unstructured.NestedString(certificate.Object, "spec", "issuerRef", "name")
+			if kind != tc.expectKind || name != tc.expectName {
+				t.Errorf("expected issuer %v/%v, got %v/%v", tc.expectKind, tc.expectName, kind, name)
+			}
+			volumes, _ := unstructured.NestedSlice(pod.Object, "spec", "volumes")
+			secretName, _ := unstructured.NestedString(volumes[len(volumes)-1].(map[string]interface{}), "secret", "secretName")
+			if secretName != "sonobuoy-aggregator-tls" {
+				t.Errorf("expected the serving certificate's Secret to be mounted, got volumes %v", volumes)
+			}
+			if cfg.Config.Aggregation.TLSCertDir != aggregatorTLSDir {
+				t.Errorf("expected TLS cert dir %v, got %q", aggregatorTLSDir, cfg.Config.Aggregation.TLSCertDir)
+			}
+			if cfg.Config.Aggregation.AdvertiseAddress != "sonobuoy-master.heptio-sonobuoy.svc:8080" {
+				t.Errorf("expected the aggregator to be advertised by its service name, got %q", cfg.Config.Aggregation.AdvertiseAddress)
+			}
+		})
+	}
+}
+
+func TestGenerateManifest_metadata(t *testing.T) {
+	labels := map[string]string{"app.kubernetes.io/part-of": "conformance", "cost-center": "1234"}
+	annotations := map[string]string{"sidecar.istio.io/inject": "false", "owner": `QA: "nightly"`}
+
+	for _, schedule := range []string{"", "0 2 * * *"} {
+		t.Run("schedule "+schedule, func(t *testing.T) {
+			cfg := &GenConfig{
+				E2EConfig:       &E2EConfig{},
+				Config:          config.New(),
+				Image:           "gcr.io/heptio-images/sonobuoy:latest",
+				Namespace:       "heptio-sonobuoy",
+				ImagePullPolicy: "Always",
+				Schedule:        schedule,
+			}
+			cfg.Config.Labels = labels
+			cfg.Config.Annotations = annotations
+			cfg.Config.Aggregation.MetricsPort = 9090
+
+			generated, err := (&SonobuoyClient{}).GenerateManifest(cfg)
+			if err != nil {
+				t.Fatalf("couldn't generate manifest: %v", err)
+			}
+
+			for _, obj := range manifestObjects(t, generated) {
+				metas := []map[string]interface{}{obj.Object["metadata"].(map[string]interface{})}
+				if obj.GetKind() == "CronJob" {
+					podMeta, _ := unstructured.NestedMap(obj.Object, "spec", "jobTemplate", "spec", "template", "metadata")
+					metas = append(metas, podMeta)
+				}
+				for _, meta := range metas {
+					gotLabels, _ := unstructured.NestedStringMap(meta, "labels")
+					gotAnnotations, _ := unstructured.NestedStringMap(meta, "annotations")
+					for key, value := range labels {
+						if gotLabels[key] != value {
+							t.Errorf("expected %v %v to have label %v=%v, got %v", obj.GetKind(), obj.GetName(), key, value, gotLabels)
+						}
+					}
+					for key, value := range annotations {
+						if gotAnnotations[key] != value {
+							t.Errorf("expected %v %v to have annotation %v=%v, got %v", obj.GetKind(), obj.GetName(), key, value, gotAnnotations)
+						}
+					}
+					if gotLabels["component"] != "sonobuoy" {
+						t.Errorf("expected %v %v to keep its own labels, got %v", obj.GetKind(), obj.GetName(), gotLabels)
+					}
+				}
+				if obj.GetKind() == "Pod" && obj.GetAnnotations()["prometheus.io/port"] != "9090" {
+					t.Errorf("expected the aggregator pod to keep its metrics annotations, got %v", obj.GetAnnotations())
+				}
+			}
+		})
+	}
+
+	cfg := &GenConfig{E2EConfig: &E2EConfig{}, Config: config.New(), Namespace: "heptio-sonobuoy"}
+	cfg.Config.Labels = map[string]string{"component": "mine"}
+	if _, err := (&SonobuoyClient{}).GenerateManifest(cfg); err == nil {
+		t.Error("expected an error for a reserved label, got none")
+	}
+}
+
+func TestGenerateManifest_securityContext(t *testing.T) {
+	testCases := []struct {
+		mode                string
+		labels              map[string]string
+		expectRestricted    bool
+		expectNamespaceMode string
+	}{
+		{mode: ""},
+		{mode: "restricted", expectRestricted: true},
+		{mode: "privileged", expectRestricted: true, expectNamespaceMode: "privileged"},
+		{
+			mode:                "privileged",
+			labels:              map[string]string{"pod-security.kubernetes.io/enforce": "baseline"},
+			expectRestricted:    true,
+			expectNamespaceMode: "baseline",
+		},
+	}
+
+	for _, tc := range testCases {
+		for _, schedule := range []string{"", "0 2 * * *"} {
+			t.Run(tc.mode+" schedule "+schedule, func(t *testing.T) {
+				cfg := &GenConfig{
+					E2EConfig:       &E2EConfig{},
+					Config:          config.New(),
+					Image:           "gcr.io/heptio-images/sonobuoy:latest",
+					Namespace:       "heptio-sonobuoy",
+					ImagePullPolicy: "Always",
+					Schedule:        schedule,
+				}
+				cfg.Config.SecurityContextMode = tc.mode
+				cfg.Config.Labels = tc.labels
+
+				generated, err := (&SonobuoyClient{}).GenerateManifest(cfg)
+				if err != nil {
+					t.Fatalf("couldn't generate manifest: %v", err)
+				}
+
+				for _, obj := range manifestObjects(t, generated) {
+					var podPath []string
+					switch obj.GetKind() {
+					case "Namespace":
+						if mode := obj.GetLabels()["pod-security.kubernetes.io/enforce"]; mode != tc.expectNamespaceMode {
+							t.Errorf("expected the namespace to enforce %q, got %q", tc.expectNamespaceMode, mode)
+						}
+						continue
+					case "Pod":
+					case "CronJob":
+						podPath = []string{"spec", "jobTemplate", "spec", "template"}
+					default:
+						continue
+					}
+
+					seccomp, _ := unstructured.NestedString(obj.Object, append(podPath, "metadata", "annotations", "seccomp.security.alpha.kubernetes.io/pod")...)
+					runAsNonRoot, _ := unstructured.NestedBool(obj.Object, append(podPath, "spec", "securityContext", "runAsNonRoot")...)
+					containers, _ := unstructured.NestedSlice(obj.Object, append(podPath, "spec", "containers")...)
+					escalation, found := unstructured.NestedBool(containers[0].(map[string]interface{}), "securityContext", "allowPrivilegeEscalation")
+					restricted := seccomp == "runtime/default" && runAsNonRoot && found && !escalation
+					if restricted != tc.expectRestricted {
+						t.Errorf("expected the aggregator %v to be restricted: %v, got %v", obj.GetKind(), tc.expectRestricted, obj.Object)
+					}
+				}
+			})
+		}
+	}
+
+	cfg := &GenConfig{E2EConfig: &E2EConfig{}, Config: config.New(), Namespace: "heptio-sonobuoy"}
+	cfg.Config.SecurityContextMode = "baseline"
+	if _, err := (&SonobuoyClient{}).GenerateManifest(cfg); err == nil {
+		t.Error("expected an error for an unknown security context mode, got none")
+	}
+}
+
+func TestGenerateManifest_addressFamily(t *testing.T) {
+	for _, family := range []string{"", "IPv6"} {
+		t.Run(family, func(t *testing.T) {
+			cfg := &GenConfig{
+				E2EConfig:       &E2EConfig{},
+				Config:          config.New(),
+				Image:           "gcr.io/heptio-images/sonobuoy:latest",
+				Namespace:       "heptio-sonobuoy",
+				ImagePullPolicy: "Always",
+			}
+			cfg.Config.Aggregation.AddressFamily = family
+
+			generated, err := (&SonobuoyClient{}).GenerateManifest(cfg)
+			if err != nil {
+				t.Fatalf("couldn't generate manifest: %v", err)
+			}
+
+			for _, obj := range manifestObjects(t, generated) {
+				if obj.GetKind() != "Pod" {
+					continue
+				}
+				containers, _ := unstructured.NestedSlice(obj.Object, "spec", "containers")
+				env, _ := unstructured.NestedSlice(containers[0].(map[string]interface{}), "env")
+				var podIPs bool
+				for _, e := range env {
+					if e.(map[string]interface{})["name"] == "SONOBUOY_ADVERTISE_IPS" {
+						podIPs = true
+					}
+				}
+				if podIPs != (family != "") {
+					t.Errorf("expected the aggregator to be given all its pod's IPs: %v, got env %v", family != "", env)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateManifest_aggregatorPort(t *testing.T) {
+	cfg := &GenConfig{
+		E2EConfig:       &E2EConfig{},
+		Config:          config.New(),
+		Image:           "gcr.io/heptio-images/sonobuoy:latest",
+		Namespace:       "heptio-sonobuoy",
+		ImagePullPolicy: "Always",
+	}
+	cfg.Config.Aggregation.BindPort = 8443
+
+	generated, err := (&SonobuoyClient{}).GenerateManifest(cfg)
+	if err != nil {
+		t.Fatalf("couldn't generate manifest: %v", err)
+	}
+
+	for _, obj := range manifestObjects(t, generated) {
+		switch obj.GetKind() {
+		case "Service":
+			ports, _ := unstructured.NestedSlice(obj.Object, "spec", "ports")
+			port := ports[0].(map[string]interface{})
+			if port["port"] != int64(8443) || port["targetPort"] != int64(8443) {
+				t.Errorf("expected the service to expose port 8443, got %v", port)
+			}
+		case "Pod":
+			containers, _ := unstructured.NestedSlice(obj.Object, "spec", "containers")
+			probed, _ := unstructured.NestedFieldCopy(containers[0].(map[string]interface{}), "readinessProbe", "tcpSocket", "port")
+			if probed != int64(8443) {
+				t.Errorf("expected the aggregator's readiness to be probed on port 8443, got %v", probed)
+			}
+		}
+	}
+}
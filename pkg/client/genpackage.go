@@ -0,0 +1,213 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	kubeyaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/heptio/sonobuoy/pkg/buildinfo"
+	"github.com/heptio/sonobuoy/pkg/image"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+const (
+	// KustomizationFile is the file listing the objects of a Kustomize base.
+	KustomizationFile = "kustomization.yaml"
+
+	// HelmChartName is the name of the Helm chart gen generates, which is
+	// also the directory its templates expect to be installed from.
+	HelmChartName = "sonobuoy"
+
+	// helmNamespace and helmPlugin stand in for the namespace and plugin
+	// selections while generating a chart's template, to be replaced by
+	// the chart's values.
+	helmNamespace = "sonobuoy-helm-namespace"
+	helmPlugin    = "sonobuoy-helm-plugins"
+)
+
+// kustomization is the kustomization.yaml of a Kustomize base.
+type kustomization struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Resources  []string `json:"resources"`
+}
+
+// helmChart is the Chart.yaml of a Helm chart.
+type helmChart struct {
+	APIVersion  string `json:"apiVersion"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+	AppVersion  string `json:"appVersion"`
+}
+
+// helmValues are the values.yaml of the Helm chart. Images maps the original
+// name of every image the run uses to the one to use instead.
+type helmValues struct {
+	Namespace string             `json:"namespace"`
+	Images    map[string]string  `json:"images"`
+	Plugins   []plugin.Selection `json:"plugins"`
+}
+
+// helmValuesHeader documents the values of the Helm chart.
+const helmValuesHeader = `# Values for the Sonobuoy chart generated by "sonobuoy gen --format helm".
+# namespace is the namespace Sonobuoy runs in, images maps the original name of
+# each image the run uses to the one to use instead, and plugins are the
+# plugins that are run.
+`
+
+// GenerateKustomization generates the manifest and splits it into a Kustomize
+// base, with a file for each object and a kustomization.yaml listing them. The
+// files are returned by their path within the base's directory.
+func (c *SonobuoyClient) GenerateKustomization(cfg *GenConfig) (map[string][]byte, error) {
+	manifest, err := c.GenerateManifest(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	docs, err := splitManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+	k := kustomization{APIVersion: "kustomize.config.k8s.io/v1beta1", Kind: "Kustomization"}
+	for _, doc := range docs {
+		name := strings.ToLower(doc.kind+"-"+doc.name) + ".yaml"
+		if _, ok := files[name]; ok {
+			return nil, errors.Errorf("manifest has more than one %v named %v", doc.kind, doc.name)
+		}
+		files[name] = doc.raw
+		k.Resources = append(k.Resources, name)
+	}
+
+	if files[KustomizationFile], err = yaml.Marshal(k); err != nil {
+		return nil, errors.Wrap(err, "couldn't encode kustomization")
+	}
+	return files, nil
+}
+
+// GenerateHelmChart generates a Helm chart of the manifest, whose values set
+// the namespace, the images and the plugins of the run, defaulting to those of
+// cfg. Everything else is fixed when the chart is generated. The files are
+// returned by their path within the chart's directory.
+func (c *SonobuoyClient) GenerateHelmChart(cfg *GenConfig) (map[string][]byte, error) {
+	// Find the images the run uses by their original names, without the
+	// image mapping, which only sets their default values.
+	original, originalConfig := *cfg, *cfg.Config
+	original.Config, original.ImageMapping = &originalConfig, nil
+	manifest, err := c.GenerateManifest(&original)
+	if err != nil {
+		return nil, err
+	}
+	images := image.Collect(manifest, originalConfig.WorkerImage)
+
+	values := helmValues{
+		Namespace: cfg.Namespace,
+		Images:    map[string]string{},
+		Plugins:   cfg.Config.PluginSelections,
+	}
+	if values.Namespace == "" {
+		values.Namespace = cfg.Config.Namespace
+	}
+
+	// Generate the template with placeholders for each value, then replace
+	// them with template actions once anything in the manifest that looks
+	// like one has been escaped.
+	placeholders := image.Mapping{}
+	actions := []string{
+		helmNamespace, "{{ .Values.namespace }}",
+		fmt.Sprintf(`[{"name":%q}]`, helmPlugin), "{{ toJson .Values.plugins }}",
+	}
+	for i, img := range images {
+		values.Images[img] = cfg.ImageMapping.Get(img)
+		placeholders[img] = fmt.Sprintf("sonobuoy-helm-image-%d-", i)
+		actions = append(actions, placeholders[img], fmt.Sprintf("{{ index .Values.images %q }}", img))
+	}
+
+	templated, templatedConfig := *cfg, *cfg.Config
+	templated.Config, templated.ImageMapping = &templatedConfig, placeholders
+	templated.Namespace = helmNamespace
+	templatedConfig.PluginSelections = []plugin.Selection{{Name: helmPlugin}}
+	if manifest, err = c.GenerateManifest(&templated); err != nil {
+		return nil, err
+	}
+	manifest = bytes.Replace(manifest, []byte("{{"), []byte(`{{ "{{" }}`), -1)
+	manifest = []byte(strings.NewReplacer(actions...).Replace(string(manifest)))
+
+	files := map[string][]byte{"templates/sonobuoy.yaml": manifest}
+	if files["Chart.yaml"], err = yaml.Marshal(helmChart{
+		APIVersion:  "v1",
+		Name:        HelmChartName,
+		Description: "A Sonobuoy run",
+		Version:     strings.TrimPrefix(buildinfo.Version, "v"),
+		AppVersion:  buildinfo.Version,
+	}); err != nil {
+		return nil, errors.Wrap(err, "couldn't encode Chart.yaml")
+	}
+	b, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't encode values.yaml")
+	}
+	files["values.yaml"] = append([]byte(helmValuesHeader), b...)
+	return files, nil
+}
+
+// manifestDoc is a single object of a generated manifest.
+type manifestDoc struct {
+	kind, name string
+	raw        []byte
+}
+
+// splitManifest splits a generated manifest into its objects, keeping them
+// as they were written.
+func splitManifest(manifest []byte) ([]manifestDoc, error) {
+	docs := []manifestDoc{}
+	r := kubeyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(manifest)))
+	for {
+		raw, err := r.Read()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't split manifest")
+		}
+		raw = bytes.TrimSpace(raw)
+		if len(raw) == 0 {
+			continue
+		}
+
+		var meta struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		}
+		if err := yaml.Unmarshal(raw, &meta); err != nil {
+			return nil, errors.Wrap(err, "couldn't decode manifest object")
+		}
+		docs = append(docs, manifestDoc{kind: meta.Kind, name: meta.Metadata.Name, raw: append(raw, '\n')})
+	}
+}
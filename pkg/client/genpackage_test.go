@@ -0,0 +1,137 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/image"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+func testPackageConfig() *GenConfig {
+	cfg := config.New()
+	cfg.PluginSelections = []plugin.Selection{{Name: "e2e"}}
+	return &GenConfig{
+		E2EConfig:       &E2EConfig{Focus: `\[Conformance\] {{not a template}}`},
+		Config:          cfg,
+		Image:           "gcr.io/heptio-images/sonobuoy:latest",
+		Namespace:       "heptio-sonobuoy",
+		EnableRBAC:      true,
+		ImagePullPolicy: "Always",
+		ImageMapping:    image.Mapping{"gcr.io/heptio-images/sonobuoy:latest": "registry.example.com/sonobuoy:latest"},
+	}
+}
+
+func TestGenerateKustomization(t *testing.T) {
+	manifest, err := (&SonobuoyClient{}).GenerateManifest(testPackageConfig())
+	if err != nil {
+		t.Fatalf("couldn't generate manifest: %v", err)
+	}
+	files, err := (&SonobuoyClient{}).GenerateKustomization(testPackageConfig())
+	if err != nil {
+		t.Fatalf("couldn't generate kustomization: %v", err)
+	}
+
+	var k kustomization
+	if err := yaml.Unmarshal(files[KustomizationFile], &k); err != nil {
+		t.Fatalf("couldn't decode %v: %v", KustomizationFile, err)
+	}
+	if len(k.Resources) != len(files)-1 {
+		t.Errorf("expected every other file to be a resource, got %v of %v files", len(k.Resources), len(files))
+	}
+
+	kinds := map[string]string{}
+	for _, name := range k.Resources {
+		objs := manifestObjects(t, files[name])
+		if len(objs) != 1 {
+			t.Fatalf("expected %v to have one object, got %v", name, len(objs))
+		}
+		kinds[objs[0].GetName()+"/"+objs[0].GetKind()] = objs[0].GetKind()
+	}
+	if expected := manifestKinds(t, manifest); len(kinds) != len(expected) {
+		t.Errorf("expected the objects %v, got %v", expected, kinds)
+	}
+}
+
+func TestGenerateHelmChart(t *testing.T) {
+	files, err := (&SonobuoyClient{}).GenerateHelmChart(testPackageConfig())
+	if err != nil {
+		t.Fatalf("couldn't generate chart: %v", err)
+	}
+	for _, name := range []string{"Chart.yaml", "values.yaml", "templates/sonobuoy.yaml"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("expected chart to have %v, got %v files", name, len(files))
+		}
+	}
+
+	var values helmValues
+	if err := yaml.Unmarshal(files["values.yaml"], &values); err != nil {
+		t.Fatalf("couldn't decode values: %v", err)
+	}
+	if values.Namespace != "heptio-sonobuoy" || len(values.Plugins) != 1 || values.Plugins[0].Name != "e2e" {
+		t.Errorf("expected the config's namespace and plugins as values, got %+v", values)
+	}
+	if img := values.Images["gcr.io/heptio-images/sonobuoy:latest"]; img != "registry.example.com/sonobuoy:latest" {
+		t.Errorf("expected the mapped Sonobuoy image as a value, got %q", img)
+	}
+
+	// Render the chart the way Helm would, with some values overridden.
+	values.Namespace = "other"
+	values.Images["gcr.io/heptio-images/sonobuoy:latest"] = "sonobuoy:custom"
+	values.Plugins = append(values.Plugins, plugin.Selection{Name: "systemd-logs"})
+	tmpl, err := template.New("chart").Funcs(template.FuncMap{
+		"toJson": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(string(files["templates/sonobuoy.yaml"]))
+	if err != nil {
+		t.Fatalf("couldn't parse chart template: %v", err)
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, map[string]interface{}{"Values": map[string]interface{}{
+		"namespace": values.Namespace,
+		"images":    values.Images,
+		"plugins":   values.Plugins,
+	}}); err != nil {
+		t.Fatalf("couldn't render chart template: %v", err)
+	}
+
+	for _, obj := range manifestObjects(t, rendered.Bytes()) {
+		if ns := obj.GetNamespace(); ns != "" && ns != "other" {
+			t.Errorf("expected %v %v in namespace other, got %v", obj.GetKind(), obj.GetName(), ns)
+		}
+	}
+	for _, expected := range []string{
+		"image: sonobuoy:custom",
+		`"WorkerImage":"sonobuoy:custom"`,
+		`"Namespace":"other"`,
+		`"Plugins":[{"name":"e2e"},{"name":"systemd-logs"}]`,
+		"{{not a template}}",
+	} {
+		if !strings.Contains(rendered.String(), expected) {
+			t.Errorf("expected rendered chart to contain %q", expected)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/heptio/sonobuoy/pkg/templates"
+)
+
+// pluginDrivers are the drivers a plugin can be generated for.
+var pluginDrivers = []string{"Job", "DaemonSet", "Deployment"}
+
+// GenPluginConfig are the input options for scaffolding a new plugin.
+type GenPluginConfig struct {
+	// Name is the name and result type of the plugin.
+	Name string
+	// Image is the image of the plugin's container.
+	Image string
+	// Driver is how the plugin is run: Job, DaemonSet or Deployment.
+	Driver string
+}
+
+// GeneratedPlugin is the scaffolding of a new plugin.
+type GeneratedPlugin struct {
+	// Definition is the plugin definition, to go in a plugins.d directory.
+	Definition []byte
+	// Entrypoint is an example entrypoint for the plugin's container, which
+	// follows the contract with the Sonobuoy worker.
+	Entrypoint []byte
+}
+
+// GeneratePlugin scaffolds a new plugin's definition and entrypoint.
+func GeneratePlugin(cfg *GenPluginConfig) (*GeneratedPlugin, error) {
+	if msgs := validation.IsDNS1123Label(cfg.Name); len(msgs) > 0 {
+		return nil, fmt.Errorf("invalid plugin name %q: %v", cfg.Name, strings.Join(msgs, ", "))
+	}
+	if cfg.Image == "" {
+		return nil, errors.New("a plugin needs an image")
+	}
+	validDriver := false
+	for _, driver := range pluginDrivers {
+		if strings.EqualFold(cfg.Driver, driver) {
+			cfg.Driver = driver
+			validDriver = true
+		}
+	}
+	if !validDriver {
+		return nil, fmt.Errorf("unknown driver %q, valid drivers are %s", cfg.Driver, strings.Join(pluginDrivers, ", "))
+	}
+
+	var definition, entrypoint bytes.Buffer
+	if err := templates.PluginDefinition.Execute(&definition, cfg); err != nil {
+		return nil, errors.Wrap(err, "couldn't execute plugin definition template")
+	}
+	if err := templates.PluginEntrypoint.Execute(&entrypoint, cfg); err != nil {
+		return nil, errors.Wrap(err, "couldn't execute plugin entrypoint template")
+	}
+	return &GeneratedPlugin{
+		Definition: definition.Bytes(),
+		Entrypoint: entrypoint.Bytes(),
+	}, nil
+}
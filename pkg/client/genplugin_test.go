@@ -0,0 +1,80 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/manifest"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestGeneratePlugin(t *testing.T) {
+	for _, driver := range []string{"Job", "daemonset", "Deployment"} {
+		t.Run(driver, func(t *testing.T) {
+			cfg := &GenPluginConfig{Name: "my-plugin", Image: "example.com/my-plugin:v1", Driver: driver}
+			plugin, err := GeneratePlugin(cfg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var def manifest.Manifest
+			if err := runtime.DecodeInto(manifest.Decoder, plugin.Definition, &def); err != nil {
+				t.Fatalf("couldn't decode plugin definition: %v\n%s", err, plugin.Definition)
+			}
+			if def.SonobuoyConfig.PluginName != "my-plugin" || def.SonobuoyConfig.ResultType != "my-plugin" {
+				t.Errorf("expected plugin my-plugin, got %+v", def.SonobuoyConfig)
+			}
+			if def.SonobuoyConfig.Driver != cfg.Driver {
+				t.Errorf("expected driver %v, got %v", cfg.Driver, def.SonobuoyConfig.Driver)
+			}
+			if def.SonobuoyConfig.Driver == "Deployment" && def.SonobuoyConfig.DurationSeconds == 0 {
+				t.Error("expected a Deployment plugin to have a duration")
+			}
+			if def.Spec.Image != cfg.Image {
+				t.Errorf("expected image %v, got %v", cfg.Image, def.Spec.Image)
+			}
+
+			if !bytes.HasPrefix(plugin.Entrypoint, []byte("#!/bin/sh\n")) {
+				t.Errorf("expected a shell script entrypoint, got\n%s", plugin.Entrypoint)
+			}
+			if !bytes.Contains(plugin.Entrypoint, []byte(`> "${RESULTS_DIR}/done"`)) {
+				t.Errorf("expected the entrypoint to write the done file, got\n%s", plugin.Entrypoint)
+			}
+		})
+	}
+}
+
+func TestGeneratePlugin_invalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		cfg  GenPluginConfig
+	}{
+		{name: "bad name", cfg: GenPluginConfig{Name: "My_Plugin", Image: "foo", Driver: "Job"}},
+		{name: "no image", cfg: GenPluginConfig{Name: "my-plugin", Driver: "Job"}},
+		{name: "bad driver", cfg: GenPluginConfig{Name: "my-plugin", Image: "foo", Driver: "CronJob"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := GeneratePlugin(&tc.cfg); err == nil {
+				t.Error("expected an error, got none")
+			}
+		})
+	}
+}
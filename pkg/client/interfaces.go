@@ -18,8 +18,11 @@ package client
 
 import (
 	"io"
+	"time"
 
+	"github.com/heptio/sonobuoy/pkg/client/results"
 	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/image"
 	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
 	"github.com/pkg/errors"
 	"k8s.io/client-go/dynamic"
@@ -33,6 +36,8 @@ type LogConfig struct {
 	Follow bool
 	// Namespace is the namespace the sonobuoy aggregator is running in.
 	Namespace string
+	// Color determines if each pod's lines are prefixed in a different color.
+	Color bool
 	// Out is the writer to write to.
 	Out io.Writer
 }
@@ -45,17 +50,72 @@ type GenConfig struct {
 	Namespace       string
 	EnableRBAC      bool
 	ImagePullPolicy string
+	// ImagePullSecrets names the secrets used to pull the images of the
+	// aggregator and every plugin.
+	ImagePullSecrets []string
+	// Schedule is a cron schedule for recurring runs. If it's set, the
+	// aggregator is launched by a CronJob instead of being run once, and its
+	// results are kept in a persistent volume.
+	Schedule string
+	// KeepResults is how many results tarballs recurring runs keep.
+	KeepResults int
+	// ResultsVolumeSize is the size of the persistent volume that recurring
+	// runs keep their results in.
+	ResultsVolumeSize string
+	// StorageSecret is the name of a secret holding credentials for the
+	// results storage backend, which is passed to the aggregator as
+	// environment variables.
+	StorageSecret string
+	// ImageMapping replaces the images the run would use with others, such
+	// as copies of them in a private registry.
+	ImageMapping image.Mapping
+	// CustomPlugins are the definitions of plugins to add to the run besides
+	// the built-in ones, such as those fetched from a URL. They're only run
+	// if they're selected.
+	CustomPlugins [][]byte
+	// CertManagerIssuer is the cert-manager issuer the aggregator's serving
+	// certificate is requested from, as Kind/name or just the name of an
+	// Issuer in the namespace. Empty means the aggregator issues its own.
+	CertManagerIssuer string
 }
 
 // E2EConfig is the configuration of the E2E tests.
 type E2EConfig struct {
 	Focus string
 	Skip  string
+	// Parallel is the number of Ginkgo nodes to run the tests on at once. If
+	// it's more than one, the [Serial] tests are skipped, since they can't run
+	// alongside others.
+	Parallel int
+	// RepoList overrides the registries the tests pull their own images
+	// from, such as for air-gapped clusters. It's given to the tests in a
+	// ConfigMap, as the file KUBE_TEST_REPO_LIST names.
+	RepoList image.RepoList
+}
+
+// serialSkip matches the tests that must run on their own.
+const serialSkip = `\[Serial\]`
+
+// SkipList returns the E2E_SKIP for the configuration, including the [Serial]
+// tests for parallel runs.
+func (c *E2EConfig) SkipList() string {
+	if c.Parallel <= 1 {
+		return c.Skip
+	}
+	if c.Skip == "" {
+		return serialSkip
+	}
+	return c.Skip + "|" + serialSkip
 }
 
 // RunConfig are the input options for running Sonobuoy.
 type RunConfig struct {
 	GenConfig
+	// DryRun validates the objects of the run with the API server without
+	// creating any of them, then writes the manifest to Out.
+	DryRun bool
+	// Out is the writer to write the manifest of a dry run to.
+	Out io.Writer
 }
 
 // DeleteConfig are the input options for cleaning up a Sonobuoy run.
@@ -63,6 +123,74 @@ type DeleteConfig struct {
 	Namespace  string
 	EnableRBAC bool
 	DeleteAll  bool
+	// NamespaceScoped deletes only the resources the run created in
+	// Namespace, leaving the namespace itself in place.
+	NamespaceScoped bool
+	// Wait blocks until everything deleted is gone.
+	Wait bool
+}
+
+// WaitConfig are the input options for waiting for a Sonobuoy run to finish.
+type WaitConfig struct {
+	// Namespace is the namespace the sonobuoy aggregator is running in.
+	Namespace string
+	// Interval is how long to wait before trying again when the status of
+	// the run can't be watched.
+	Interval time.Duration
+	// Timeout is how long to wait before giving up; zero means there's no
+	// limit.
+	Timeout time.Duration
+}
+
+// WatchConfig are the input options for watching a Sonobuoy run.
+type WatchConfig struct {
+	// Namespace is the namespace the sonobuoy aggregator is running in.
+	Namespace string
+	// RetryInterval is how long to wait before trying again when the
+	// aggregator pod can't be listed or watched.
+	RetryInterval time.Duration
+}
+
+// EventsConfig are the input options for streaming the events of a Sonobuoy
+// run.
+type EventsConfig struct {
+	// Namespace is the namespace the sonobuoy aggregator is running in.
+	Namespace string
+	// Port is the aggregator's metrics port, which events are served on.
+	Port int
+	// Follow keeps streaming events as they happen until the run is
+	// complete, rather than stopping after those so far.
+	Follow bool
+	// Since is the ID of the last event already seen; only the events after
+	// it are streamed.
+	Since int64
+}
+
+// RunToCompletionConfig are the input options for running Sonobuoy, waiting for
+// it to finish and retrieving its results.
+type RunToCompletionConfig struct {
+	RunConfig
+	// WaitInterval is how long to wait before trying again when the status
+	// of the run can't be watched, and WaitTimeout how long to wait for it;
+	// zero means there's no limit.
+	WaitInterval time.Duration
+	WaitTimeout  time.Duration
+	// ResultsDir is where the results tarball is retrieved to and
+	// extracted. The results aren't retrieved if it's empty.
+	ResultsDir string
+}
+
+// CompletedRun is the outcome of a Sonobuoy run that was run to completion.
+type CompletedRun struct {
+	// Status is the final status of the run.
+	Status *aggregation.Status
+	// Tarball is the results tarball that was retrieved, and ResultsDir
+	// the directory it was extracted into. They're empty if the results
+	// weren't retrieved.
+	Tarball    string
+	ResultsDir string
+	// Counts are the tests run and failed by each suite in the results.
+	Counts []results.SuiteCounts
 }
 
 // RetrieveConfig are the input options for retrieving a Sonobuoy run's results.
@@ -74,6 +202,8 @@ type RetrieveConfig struct {
 // PreflightConfig are the options passed to PreflightChecks.
 type PreflightConfig struct {
 	Namespace string
+	// NamespaceScoped skips the checks that need cluster-wide permissions.
+	NamespaceScoped bool
 }
 
 // SonobuoyClient is a high-level interface to Sonobuoy operations.
@@ -125,14 +255,38 @@ type Interface interface {
 	Run(cfg *RunConfig) error
 	// GenerateManifest fills in a template with a Sonobuoy config
 	GenerateManifest(cfg *GenConfig) ([]byte, error)
+	// GenerateKustomization generates the manifest as the files of a
+	// Kustomize base, by their path within its directory.
+	GenerateKustomization(cfg *GenConfig) (map[string][]byte, error)
+	// GenerateHelmChart generates the manifest as the files of a Helm chart
+	// whose values set the namespace, images and plugins, by their path
+	// within its directory.
+	GenerateHelmChart(cfg *GenConfig) (map[string][]byte, error)
+	// GetImages lists the images that a run with the given config needs.
+	GetImages(cfg *GenConfig) ([]string, error)
 	// RetrieveResults copies results from a sonobuoy run into a Reader in tar format.
 	RetrieveResults(cfg *RetrieveConfig) (io.Reader, error)
+	// StreamResults writes the results tarball of a sonobuoy run to w.
+	StreamResults(cfg *RetrieveConfig, w io.Writer) error
 	// GetStatus determines the status of the sonobuoy run in order to assist the user.
 	GetStatus(namespace string) (*aggregation.Status, error)
+	// WaitForRun blocks until the sonobuoy run has completed or failed,
+	// returning its final status.
+	WaitForRun(cfg *WaitConfig) (*aggregation.Status, error)
+	// WatchRun sends each change in the phase of the sonobuoy run to the
+	// returned channel until the run finishes or stop is closed.
+	WatchRun(cfg *WatchConfig, stop <-chan struct{}) (<-chan RunTransition, error)
+	// StreamEvents calls handle with each event of the sonobuoy run, such
+	// as a plugin starting or a result being received.
+	StreamEvents(cfg *EventsConfig, handle func(aggregation.Event) error) error
+	// RunToCompletion runs Sonobuoy, waits for the run to finish and
+	// retrieves, extracts and summarizes its results.
+	RunToCompletion(cfg *RunToCompletionConfig) (*CompletedRun, error)
 	// LogReader returns a reader that contains a merged stream of sonobuoy logs.
 	LogReader(cfg *LogConfig) (*Reader, error)
-	// Delete removes a sonobuoy run, namespace, and all associated resources.
-	Delete(cfg *DeleteConfig) error
+	// Delete removes a sonobuoy run, namespace, and all associated resources,
+	// returning what was deleted.
+	Delete(cfg *DeleteConfig) ([]DeletedResource, error)
 	// PreflightChecks runs a number of preflight checks to confirm the environment is good for Sonobuoy
 	PreflightChecks(cfg *PreflightConfig) []error
 }
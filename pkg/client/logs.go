@@ -17,11 +17,13 @@ limitations under the License.
 package client
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"sync"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -103,7 +105,9 @@ func (r *Reader) Read(p []byte) (int, error) {
 	return len(data), nil
 }
 
-// LogReader configures a Reader that provides an io.Reader interface to a merged stream of logs from various containers.
+// LogReader configures a Reader that provides an io.Reader interface to a merged stream of logs from the containers
+// in the Sonobuoy namespace. Each line is prefixed with the pod and container it came from. When following, the logs
+// of pods created later, such as those of plugins that wait for others, are picked up as their containers start.
 func (s *SonobuoyClient) LogReader(cfg *LogConfig) (*Reader, error) {
 	client, err := s.Client()
 	if err != nil {
@@ -114,117 +118,173 @@ func (s *SonobuoyClient) LogReader(cfg *LogConfig) (*Reader, error) {
 		return nil, errors.Wrap(err, "failed to list pods")
 	}
 
-	errc := make(chan error)
-	agg := make(chan *message)
-	var wg sync.WaitGroup
-
-	// TODO(chuckha) if we get an error back that the container is still creating maybe we could retry?
-	for _, pod := range pods.Items {
-		for _, container := range pod.Spec.Containers {
-			wg.Add(1)
-			ls := &logStreamer{
-				ns:        pod.Namespace,
-				pod:       pod.Name,
-				container: container.Name,
-				errc:      errc,
-				logc:      agg,
-				logOpts: &v1.PodLogOptions{
-					Container: container.Name,
-					Follow:    cfg.Follow,
-				},
-				client: client,
-			}
+	errc := make(chan error, 1)
+	agg := make(chan []byte)
+	mux := newLogMultiplexer(client, cfg, agg)
+
+	for i := range pods.Items {
+		mux.add(&pods.Items[i])
+	}
 
-			go func(w *sync.WaitGroup, ls *logStreamer) {
-				defer w.Done()
-				ls.stream()
-			}(&wg, ls)
+	if cfg.Follow {
+		watcher, err := client.CoreV1().Pods(cfg.Namespace).Watch(metav1.ListOptions{ResourceVersion: pods.ResourceVersion})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to watch pods")
 		}
+		mux.wg.Add(1)
+		go func() {
+			defer mux.wg.Done()
+			for event := range watcher.ResultChan() {
+				if pod, ok := event.Object.(*v1.Pod); ok {
+					mux.add(pod)
+				}
+			}
+		}()
 	}
 
 	// Cleanup when finished.
-	go func(wg *sync.WaitGroup, agg chan *message, errc chan error) {
-		wg.Wait()
+	go func() {
+		mux.wg.Wait()
 		close(agg)
 		errc <- io.EOF
 		close(errc)
-	}(&wg, agg, errc)
+	}()
+
+	return NewReader(agg, errc), nil
+}
+
+// logColors are the ANSI colors pods' prefixes are shown in, in turn.
+var logColors = []string{"\x1b[36m", "\x1b[33m", "\x1b[32m", "\x1b[35m", "\x1b[34m", "\x1b[31m"}
+
+const colorReset = "\x1b[0m"
+
+// logMultiplexer streams the logs of each container once it has started, to a
+// fan-in channel.
+type logMultiplexer struct {
+	client kubernetes.Interface
+	cfg    *LogConfig
+	logc   chan []byte
+	wg     sync.WaitGroup
+
+	mutex sync.Mutex
+	// streaming is the containers being streamed, by pod and container name.
+	streaming map[string]bool
+	// colors is the color of each pod's prefix.
+	colors map[string]string
+}
+
+func newLogMultiplexer(client kubernetes.Interface, cfg *LogConfig, logc chan []byte) *logMultiplexer {
+	return &logMultiplexer{
+		client:    client,
+		cfg:       cfg,
+		logc:      logc,
+		streaming: map[string]bool{},
+		colors:    map[string]string{},
+	}
+}
+
+// add starts streaming the logs of the pod's containers that have started and
+// aren't already being streamed.
+func (m *logMultiplexer) add(pod *v1.Pod) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, container := range pod.Spec.Containers {
+		key := pod.Name + "/" + container.Name
+		if m.streaming[key] || !containerStarted(pod, container.Name) {
+			continue
+		}
+		m.streaming[key] = true
 
-	return NewReader(applyHeaders(agg), errc), nil
+		ls := &logStreamer{
+			ns:        pod.Namespace,
+			pod:       pod.Name,
+			container: container.Name,
+			prefix:    m.prefix(pod.Name, container.Name),
+			logc:      m.logc,
+			logOpts: &v1.PodLogOptions{
+				Container: container.Name,
+				Follow:    m.cfg.Follow,
+			},
+			client: m.client,
+		}
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			ls.stream()
+		}()
+	}
 }
 
-// message represents a buffer of logs from a container in a pod in a namespace.
-type message struct {
-	// preamble acts as the id for a particular container as well as the data to print before the actual logs.
-	preamble string
-	// buffer is the blob of logs that we extracted from the container.
-	buffer []byte
+// prefix returns what each line from a container is prefixed with, colored by
+// pod if color is on.
+func (m *logMultiplexer) prefix(pod, container string) string {
+	prefix := fmt.Sprintf("[%v/%v]", pod, container)
+	if !m.cfg.Color {
+		return prefix + " "
+	}
+	color, ok := m.colors[pod]
+	if !ok {
+		color = logColors[len(m.colors)%len(logColors)]
+		m.colors[pod] = color
+	}
+	return color + prefix + colorReset + " "
 }
 
-func newMessage(preamble string, data []byte) *message {
-	// Copy the bytes out of data so that byte slice can be reused.
-	d := make([]byte, len(data))
-	copy(d, data)
-	return &message{
-		preamble: preamble,
-		buffer:   d,
+// containerStarted returns whether the named container of a pod is running or
+// has run, so has logs.
+func containerStarted(pod *v1.Pod, container string) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == container {
+			return status.State.Running != nil || status.State.Terminated != nil
+		}
 	}
+	return false
 }
 
 // logStreamer writes logs from a container to a fan-in channel.
 type logStreamer struct {
 	ns, pod, container string
-	errc               chan error
-	logc               chan *message
+	prefix             string
+	logc               chan []byte
 	logOpts            *v1.PodLogOptions
 	client             kubernetes.Interface
 }
 
-// stream will open a connection to the pod's logs and push messages onto a fan-in channel.
+// stream will open a connection to the pod's logs and push its lines onto a fan-in channel. Since other containers'
+// logs are still worth having, errors are only logged.
 func (l *logStreamer) stream() {
 	req := l.client.CoreV1().Pods(l.ns).GetLogs(l.pod, l.logOpts)
 	readCloser, err := req.Stream()
 	if err != nil {
-		l.errc <- errors.Wrapf(err, "error streaming logs from container [%v]", l.container)
+		logrus.WithError(err).Warningf("error streaming logs from pod %v container %v", l.pod, l.container)
 		return
 	}
 	defer readCloser.Close()
 
-	// newline because logs have new lines in them
-	preamble := fmt.Sprintf("namespace=%q pod=%q container=%q\n", l.ns, l.pod, l.container)
+	if err := prefixLines(readCloser, l.prefix, l.logc); err != nil {
+		logrus.WithError(err).Warningf("error reading logs from pod %v container %v", l.pod, l.container)
+	}
+}
 
-	buf := make([]byte, bufSize)
-	// Loop until EOF (streaming case won't get an EOF)
+// prefixLines sends each line read from r to out with the prefix in front of
+// it. Lines are only sent whole, so lines from different containers aren't
+// mixed up.
+func prefixLines(r io.Reader, prefix string, out chan<- []byte) error {
+	reader := bufio.NewReaderSize(r, bufSize)
 	for {
-		n, err := readCloser.Read(buf)
-		if err != nil && err != io.EOF {
-			l.errc <- errors.Wrapf(err, "error reading logs from container [%v]", l.container)
-			return
-		}
-		if n > 0 {
-			l.logc <- newMessage(preamble, buf[:n])
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if line[len(line)-1] != '\n' {
+				line = append(line, '\n')
+			}
+			out <- append([]byte(prefix), line...)
 		}
 		if err == io.EOF {
-			return
+			return nil
 		}
-	}
-}
-
-// applyHeaders takes a channel of messages and transforms it into a channel of bytes.
-// applyHeaders will write headers to the byte stream as appropriate.
-func applyHeaders(mesc chan *message) chan []byte {
-	out := make(chan []byte)
-	go func() {
-		header := ""
-		for message := range mesc {
-			// Add the header if the header is different (ie the message is coming from a different source)
-			if message.preamble != header {
-				out <- []byte(message.preamble)
-				header = message.preamble
-			}
-			out <- message.buffer
+		if err != nil {
+			return errors.WithStack(err)
 		}
-		close(out)
-	}()
-	return out
+	}
 }
@@ -17,9 +17,13 @@ package client
 
 import (
 	"io"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestLateErrors(t *testing.T) {
@@ -201,3 +205,68 @@ func TestLogReaderNoError(t *testing.T) {
 		})
 	}
 }
+
+func TestPrefixLines(t *testing.T) {
+	out := make(chan []byte, 10)
+	if err := prefixLines(strings.NewReader("first line\nsecond line\nno newline"), "[pod/container] ", out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	close(out)
+
+	var lines []string
+	for line := range out {
+		lines = append(lines, string(line))
+	}
+	expected := []string{
+		"[pod/container] first line\n",
+		"[pod/container] second line\n",
+		"[pod/container] no newline\n",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected %q, got %q", expected, lines)
+	}
+}
+
+func TestContainerStarted(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "sonobuoy-e2e-job", Namespace: "heptio-sonobuoy"},
+		Spec: v1.PodSpec{Containers: []v1.Container{
+			{Name: "e2e"},
+			{Name: "sonobuoy-worker"},
+		}},
+		Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+			{Name: "e2e", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+			{Name: "sonobuoy-worker", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+		}},
+	}
+
+	if containerStarted(pod, "e2e") {
+		t.Error("expected a waiting container not to have started")
+	}
+	pod.Status.ContainerStatuses[0].State = v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+	if !containerStarted(pod, "e2e") {
+		t.Error("expected a running container to have started")
+	}
+	if containerStarted(pod, "missing") {
+		t.Error("expected a container without a status not to have started")
+	}
+}
+
+func TestLogMultiplexerPrefix(t *testing.T) {
+	mux := newLogMultiplexer(nil, &LogConfig{}, nil)
+	if prefix := mux.prefix("pod", "container"); prefix != "[pod/container] " {
+		t.Errorf("expected a plain prefix, got %q", prefix)
+	}
+
+	mux = newLogMultiplexer(nil, &LogConfig{Color: true}, nil)
+	first := mux.prefix("pod-a", "producer")
+	if !strings.HasPrefix(first, logColors[0]) || !strings.Contains(first, "[pod-a/producer]") {
+		t.Errorf("expected the first pod in the first color, got %q", first)
+	}
+	if worker := mux.prefix("pod-a", "sonobuoy-worker"); !strings.HasPrefix(worker, logColors[0]) {
+		t.Errorf("expected each container of a pod in the same color, got %q", worker)
+	}
+	if second := mux.prefix("pod-b", "producer"); !strings.HasPrefix(second, logColors[1]) {
+		t.Errorf("expected the next pod in the next color, got %q", second)
+	}
+}
@@ -18,7 +18,9 @@ package client
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/heptio/sonobuoy/pkg/plugin"
 )
@@ -37,14 +39,27 @@ const (
 	// Extended run all of the E2E tests, the systemd log tests, and
 	// Heptio's E2E Tests.
 	Extended Mode = "Extended"
+	// CertifiedConformance runs exactly the E2E tests required for CNCF
+	// conformance certification, and the systemd log tests.
+	CertifiedConformance Mode = "Certified-Conformance"
+	// NonDisruptive runs the E2E conformance tests that are safe to run
+	// against a cluster in use, and the systemd log tests.
+	NonDisruptive Mode = "Non-Disruptive"
 )
 
-const defaultSkipList = "Alpha|Disruptive|Feature|Flaky|Kubectl"
+const (
+	defaultSkipList       = "Alpha|Disruptive|Feature|Flaky|Kubectl"
+	conformanceFocus      = `\[Conformance\]`
+	nonDisruptiveSkipList = `\[Disruptive\]|NoExecuteTaintManager`
+)
 
 var modeMap = map[string]Mode{
 	string(Conformance): Conformance,
 	string(Quick):       Quick,
 	string(Extended):    Extended,
+
+	string(CertifiedConformance): CertifiedConformance,
+	string(NonDisruptive):        NonDisruptive,
 }
 
 // ModeConfig represents the sonobuoy configuration for a given mode.
@@ -53,6 +68,22 @@ type ModeConfig struct {
 	E2EConfig E2EConfig
 	// Selectors are the plugins selected by this mode.
 	Selectors []plugin.Selection
+	// Description says what the mode is for.
+	Description string
+	// EstimatedDuration is roughly how long a run in this mode takes on a
+	// small, healthy cluster. Larger or slower clusters take longer.
+	EstimatedDuration time.Duration
+}
+
+// ModeInfo describes a mode, for listing what's available without having to
+// read the source.
+type ModeInfo struct {
+	Name              Mode
+	Description       string
+	Plugins           []string
+	E2EFocus          string
+	E2ESkip           string
+	EstimatedDuration time.Duration
 }
 
 // String needed for pflag.Value
@@ -87,6 +118,8 @@ func (m *Mode) Get() *ModeConfig {
 				{Name: "e2e"},
 				{Name: "systemd-logs"},
 			},
+			Description:       "Runs the conformance tests, except alpha, disruptive and flaky ones, and gathers the nodes' systemd logs.",
+			EstimatedDuration: time.Hour,
 		}
 	case Quick:
 		return &ModeConfig{
@@ -97,6 +130,8 @@ func (m *Mode) Get() *ModeConfig {
 			Selectors: []plugin.Selection{
 				{Name: "e2e"},
 			},
+			Description:       "Runs a single E2E test, to check that Sonobuoy works against the cluster.",
+			EstimatedDuration: 5 * time.Minute,
 		}
 	case Extended:
 		return &ModeConfig{
@@ -109,6 +144,33 @@ func (m *Mode) Get() *ModeConfig {
 				{Name: "systemd-logs"},
 				{Name: "heptio-e2e"},
 			},
+			Description:       "Runs the conformance tests, gathers the systemd logs and runs Heptio's E2E tests.",
+			EstimatedDuration: 90 * time.Minute,
+		}
+	case CertifiedConformance:
+		return &ModeConfig{
+			E2EConfig: E2EConfig{
+				Focus: conformanceFocus,
+			},
+			Selectors: []plugin.Selection{
+				{Name: "e2e"},
+				{Name: "systemd-logs"},
+			},
+			Description:       "Runs exactly the tests required for CNCF conformance certification, including disruptive ones.",
+			EstimatedDuration: 2 * time.Hour,
+		}
+	case NonDisruptive:
+		return &ModeConfig{
+			E2EConfig: E2EConfig{
+				Focus: conformanceFocus,
+				Skip:  nonDisruptiveSkipList,
+			},
+			Selectors: []plugin.Selection{
+				{Name: "e2e"},
+				{Name: "systemd-logs"},
+			},
+			Description:       "Runs the conformance tests that are safe against a cluster in use.",
+			EstimatedDuration: time.Hour,
 		}
 	default:
 		return nil
@@ -123,5 +185,27 @@ func GetModes() []string {
 		keys[i] = k
 		i++
 	}
+	sort.Strings(keys)
 	return keys
 }
+
+// ListModes describes each of the available modes, sorted by name.
+func ListModes() []ModeInfo {
+	var infos []ModeInfo
+	for _, name := range GetModes() {
+		mode := modeMap[name]
+		cfg := mode.Get()
+		info := ModeInfo{
+			Name:              mode,
+			Description:       cfg.Description,
+			E2EFocus:          cfg.E2EConfig.Focus,
+			E2ESkip:           cfg.E2EConfig.Skip,
+			EstimatedDuration: cfg.EstimatedDuration,
+		}
+		for _, selection := range cfg.Selectors {
+			info.Plugins = append(info.Plugins, selection.Name)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
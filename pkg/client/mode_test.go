@@ -0,0 +1,60 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListModes(t *testing.T) {
+	modes := ListModes()
+	if len(modes) != len(GetModes()) {
+		t.Fatalf("expected %d modes, got %d", len(GetModes()), len(modes))
+	}
+
+	for i, info := range modes {
+		if i > 0 && modes[i-1].Name >= info.Name {
+			t.Errorf("expected modes sorted by name, got %v before %v", modes[i-1].Name, info.Name)
+		}
+		if info.Description == "" {
+			t.Errorf("expected mode %v to have a description", info.Name)
+		}
+		if info.EstimatedDuration <= 0 {
+			t.Errorf("expected mode %v to have an estimated duration", info.Name)
+		}
+		if len(info.Plugins) == 0 {
+			t.Errorf("expected mode %v to select plugins", info.Name)
+		}
+	}
+
+	var quick *ModeInfo
+	for i := range modes {
+		if modes[i].Name == Quick {
+			quick = &modes[i]
+		}
+	}
+	if quick == nil {
+		t.Fatal("expected the quick mode to be listed")
+	}
+	if !reflect.DeepEqual(quick.Plugins, []string{"e2e"}) {
+		t.Errorf("expected quick mode to run the e2e plugin, got %v", quick.Plugins)
+	}
+	if quick.E2EFocus != "Pods should be submitted and removed" || quick.E2ESkip != defaultSkipList {
+		t.Errorf("unexpected quick mode focus %q and skip %q", quick.E2EFocus, quick.E2ESkip)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/heptio/sonobuoy/pkg/tarball"
+)
+
+// tarballWait is how long RunToCompletion waits for the results tarball once
+// the run has finished, since the aggregator only writes it after cleaning up
+// the plugins.
+var tarballWait = 5 * time.Minute
+
+// latestTarballNameScript prints the name of the newest results tarball in the
+// results directory, like latestTarballScript prints its contents.
+var latestTarballNameScript = fmt.Sprintf(
+	`tarball=$(ls -1 %s/*.tar.gz 2>/dev/null | tail -n 1); [ -n "$tarball" ] || { echo "no results tarball found" >&2; exit 1; }; echo "$tarball"`,
+	config.MasterResultsPath,
+)
+
+// RunToCompletion runs Sonobuoy and waits for the run to complete or fail. If
+// cfg.ResultsDir is set, the results tarball is then retrieved into it,
+// extracted next to it and summarized. Results are retrieved even if the run
+// failed, since they're the best clue as to why.
+func (c *SonobuoyClient) RunToCompletion(cfg *RunToCompletionConfig) (*CompletedRun, error) {
+	if cfg.DryRun {
+		return nil, errors.New("a dry run can't be waited for")
+	}
+	if cfg.Schedule != "" {
+		return nil, errors.New("a recurring run can't be waited for")
+	}
+
+	if err := c.Run(&cfg.RunConfig); err != nil {
+		return nil, err
+	}
+
+	status, err := c.WaitForRun(&WaitConfig{
+		Namespace: cfg.Namespace,
+		Interval:  cfg.WaitInterval,
+		Timeout:   cfg.WaitTimeout,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't wait for run")
+	}
+	run := &CompletedRun{Status: status}
+	if cfg.ResultsDir == "" {
+		return run, nil
+	}
+
+	if err := os.MkdirAll(cfg.ResultsDir, 0755); err != nil {
+		return run, errors.Wrapf(err, "couldn't create results directory %v", cfg.ResultsDir)
+	}
+	if run.Tarball, err = c.retrieveTarball(cfg.Namespace, cfg.ResultsDir, cfg.WaitInterval); err != nil {
+		return run, err
+	}
+
+	data, err := ioutil.ReadFile(run.Tarball)
+	if err != nil {
+		return run, errors.Wrap(err, "couldn't read results tarball")
+	}
+	run.ResultsDir = strings.TrimSuffix(run.Tarball, ".tar.gz")
+	if err := tarball.DecodeTarball(bytes.NewReader(data), run.ResultsDir); err != nil {
+		return run, errors.Wrap(err, "couldn't extract results tarball")
+	}
+	reader, err := results.NewReaderFromBytes(data)
+	if err != nil {
+		return run, errors.Wrap(err, "couldn't open results tarball")
+	}
+	if run.Counts, err = reader.TestCounts(); err != nil {
+		return run, errors.Wrap(err, "couldn't count tests")
+	}
+	return run, nil
+}
+
+// retrieveTarball copies the results tarball of the run into dir, under the
+// same name, retrying every interval until the aggregator has written it.
+func (c *SonobuoyClient) retrieveTarball(namespace, dir string, interval time.Duration) (string, error) {
+	deadline := time.Now().Add(tarballWait)
+	for {
+		file, err := c.copyTarball(namespace, dir)
+		if err == nil {
+			return file, nil
+		}
+		if time.Now().After(deadline) {
+			return "", errors.Wrap(err, "couldn't retrieve results tarball")
+		}
+		logrus.WithError(err).Debug("Results tarball isn't ready, retrying")
+		time.Sleep(interval)
+	}
+}
+
+func (c *SonobuoyClient) copyTarball(namespace, dir string) (string, error) {
+	var name bytes.Buffer
+	if err := c.execInMaster(namespace, []string{"/bin/sh", "-c", latestTarballNameScript}, &name); err != nil {
+		return "", errors.Wrap(err, "couldn't find results tarball")
+	}
+	file := filepath.Join(dir, path.Base(strings.TrimSpace(name.String())))
+
+	f, err := os.Create(file)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't create %v", file)
+	}
+	err = c.StreamResults(&RetrieveConfig{Namespace: namespace}, f)
+	if closeErr := f.Close(); err == nil {
+		err = errors.Wrapf(closeErr, "couldn't write %v", file)
+	}
+	if err != nil {
+		os.Remove(file)
+		return "", err
+	}
+	return file, nil
+}
+
+// Failed returns whether the run failed, or any of the tests it ran did.
+func (r *CompletedRun) Failed() bool {
+	if r.Status.Status == aggregation.FailedStatus {
+		return true
+	}
+	for _, suite := range r.Counts {
+		if suite.Failures > 0 {
+			return true
+		}
+	}
+	return false
+}
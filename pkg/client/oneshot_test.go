@@ -0,0 +1,88 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"k8s.io/client-go/rest"
+)
+
+func TestRunToCompletion_invalid(t *testing.T) {
+	c, err := NewSonobuoyClient(&rest.Config{Host: "http://127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	testCases := []struct {
+		desc string
+		cfg  *RunToCompletionConfig
+	}{
+		{
+			desc: "dry run",
+			cfg:  &RunToCompletionConfig{RunConfig: RunConfig{DryRun: true}},
+		}, {
+			desc: "recurring run",
+			cfg:  &RunToCompletionConfig{RunConfig: RunConfig{GenConfig: GenConfig{Schedule: "@daily"}}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if _, err := c.RunToCompletion(tc.cfg); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestCompletedRunFailed(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		run      CompletedRun
+		expected bool
+	}{
+		{
+			desc: "complete",
+			run: CompletedRun{
+				Status: &aggregation.Status{Status: aggregation.CompleteStatus},
+				Counts: []results.SuiteCounts{{Name: "e2e", Tests: 10}},
+			},
+		}, {
+			desc:     "run failed",
+			run:      CompletedRun{Status: &aggregation.Status{Status: aggregation.FailedStatus}},
+			expected: true,
+		}, {
+			desc: "tests failed",
+			run: CompletedRun{
+				Status: &aggregation.Status{Status: aggregation.CompleteStatus},
+				Counts: []results.SuiteCounts{{Name: "e2e", Tests: 10}, {Name: "systemd_logs", Tests: 2, Failures: 1}},
+			},
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if failed := tc.run.Failed(); failed != tc.expected {
+				t.Errorf("expected Failed() to be %v, got %v", tc.expected, failed)
+			}
+		})
+	}
+}
@@ -58,6 +58,11 @@ const (
 )
 
 func preflightDNSCheck(client kubernetes.Interface, cfg *PreflightConfig) error {
+	// Namespace-scoped runs can't list the pods in kube-system.
+	if cfg.NamespaceScoped {
+		return nil
+	}
+
 	var dnsLabels = []string{
 		kubeDNSLabelValue,
 		coreDNSLabelValue,
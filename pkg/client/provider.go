@@ -0,0 +1,89 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Provider identifies a managed Kubernetes service whose clusters can't pass
+// some E2E tests, usually because they hide the control plane or don't allow
+// SSH access to nodes. Setting a provider adds those tests to the E2E skip
+// list, on top of the mode's.
+type Provider string
+
+const (
+	// GKE is Google Kubernetes Engine.
+	GKE Provider = "gke"
+	// EKS is Amazon Elastic Container Service for Kubernetes.
+	EKS Provider = "eks"
+	// AKS is Azure Kubernetes Service.
+	AKS Provider = "aks"
+)
+
+// managedSkipList skips the tests that need access to the control plane or
+// to nodes over SSH, which no managed service allows.
+const managedSkipList = `SSH|\[sig-cluster-lifecycle\]`
+
+var providerSkipLists = map[Provider]string{
+	GKE: managedSkipList,
+	// EKS nodes only accept traffic from the control plane on ports above
+	// 1024, so it can't proxy to services on lower ports.
+	EKS: managedSkipList + `|should proxy through a service and a pod`,
+	// AKS doesn't expose node ports or host ports by default.
+	AKS: managedSkipList + `|NodePort|HostPort`,
+}
+
+// String needed for pflag.Value
+func (p *Provider) String() string { return string(*p) }
+
+// Type needed for pflag.Value
+func (p *Provider) Type() string { return "Provider" }
+
+// Set the provider with a given string. Returns error on unknown provider.
+func (p *Provider) Set(str string) error {
+	provider := Provider(strings.ToLower(str))
+	if _, ok := providerSkipLists[provider]; !ok {
+		return fmt.Errorf("unknown provider %s", str)
+	}
+	*p = provider
+	return nil
+}
+
+// Skip adds the tests that can't pass on the provider's clusters to skip.
+func (p Provider) Skip(skip string) string {
+	providerSkip, ok := providerSkipLists[p]
+	if !ok {
+		return skip
+	}
+	if skip == "" {
+		return providerSkip
+	}
+	return skip + "|" + providerSkip
+}
+
+// GetProviders gets a list of all known providers.
+func GetProviders() []string {
+	providers := make([]string, 0, len(providerSkipLists))
+	for p := range providerSkipLists {
+		providers = append(providers, string(p))
+	}
+	sort.Strings(providers)
+	return providers
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maxBrowseFileSize is how much of each file a Browser keeps. Bigger files,
+// which are mostly logs, are cut from the start, since they usually end with
+// what went wrong.
+const maxBrowseFileSize = 8 << 20
+
+// Browser holds what's in an archive in memory, so it can be explored in any
+// order rather than in a single pass over the archive.
+type Browser struct {
+	// Plugins are the sorted names of the plugins with results.
+	Plugins []string
+	suites  map[string][]JUnitTestSuite
+	files   map[string][]byte
+	paths   []string
+}
+
+// SearchMatch is a test or a line of a file found by Search. Either Plugin,
+// Suite and Test, or Path and Line, are set.
+type SearchMatch struct {
+	Plugin, Suite, Test string
+	Path                string
+	// Line is the number of the matching line, counting from 1.
+	Line int
+	Text string
+}
+
+// Browse reads the whole archive into a Browser.
+func (r *Reader) Browse() (*Browser, error) {
+	plugins := pluginSet{}
+	b := &Browser{suites: map[string][]JUnitTestSuite{}, files: map[string][]byte{}}
+
+	err := r.walkArchive(func(filePath string, info os.FileInfo) error {
+		data, err := ioutil.ReadAll(info.Sys().(io.Reader))
+		if err != nil {
+			return errors.Wrapf(err, "couldn't read %v", filePath)
+		}
+		b.paths = append(b.paths, filePath)
+		if len(data) > maxBrowseFileSize {
+			b.files[filePath] = data[len(data)-maxBrowseFileSize:]
+		} else {
+			b.files[filePath] = data
+		}
+		return plugins.collect(filePath, &tarFileInfo{info, bytes.NewReader(data)})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(b.paths)
+	b.Plugins = plugins.names()
+	for _, name := range b.Plugins {
+		b.suites[name] = plugins[name].suites(name)
+	}
+	return b, nil
+}
+
+// Suites returns a plugin's tests, as in the archive's JUnitReport.
+func (b *Browser) Suites(plugin string) []JUnitTestSuite {
+	return b.suites[plugin]
+}
+
+// Files returns the sorted paths of the files under dir.
+func (b *Browser) Files(dir string) []string {
+	var paths []string
+	for _, p := range b.paths {
+		if strings.HasPrefix(p, dir) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// PodLogs returns the paths of the pod logs that were collected.
+func (b *Browser) PodLogs() []string {
+	return b.Files(podLogs)
+}
+
+// Resources returns the paths of the resources that were collected, cluster
+// and namespace scoped.
+func (b *Browser) Resources() []string {
+	return b.Files("resources/")
+}
+
+// PluginFiles returns the paths of the results and errors a plugin stored.
+func (b *Browser) PluginFiles(plugin string) []string {
+	return b.Files(PluginsDir + plugin + "/")
+}
+
+// File returns what's in the file at path, and whether there is one. Only the
+// end of big files is kept.
+func (b *Browser) File(path string) ([]byte, bool) {
+	data, ok := b.files[path]
+	return data, ok
+}
+
+// Search returns the tests whose names, and the lines of files, that contain
+// query, ignoring case. Tests come first, then files in path order.
+func (b *Browser) Search(query string) []SearchMatch {
+	query = strings.ToLower(query)
+	if query == "" {
+		return nil
+	}
+
+	var matches []SearchMatch
+	for _, plugin := range b.Plugins {
+		for _, suite := range b.suites[plugin] {
+			for _, testCase := range suite.TestCases {
+				if strings.Contains(strings.ToLower(testCase.Name), query) {
+					matches = append(matches, SearchMatch{Plugin: plugin, Suite: suite.Name, Test: testCase.Name, Text: testCase.Name})
+				}
+			}
+		}
+	}
+	for _, p := range b.paths {
+		for i, line := range strings.Split(string(b.files[p]), "\n") {
+			if strings.Contains(strings.ToLower(line), query) {
+				matches = append(matches, SearchMatch{Path: p, Line: i + 1, Text: line})
+			}
+		}
+	}
+	return matches
+}
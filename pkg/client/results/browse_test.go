@@ -0,0 +1,68 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+)
+
+func TestBrowse(t *testing.T) {
+	junit := `<testsuite name="e2e" tests="2" failures="1"><testcase name="[sig-network] DNS works"><failure message="timed out">lookup failed</failure></testcase><testcase name="[sig-apps] Job runs"></testcase></testsuite>`
+	buf := makeArchive(t, []archiveFile{
+		{"plugins/e2e/results/junit_01.xml", junit},
+		{"plugins/systemd_logs/errors/node2", `{"error":"timeout"}`},
+		{"podlogs/kube-system/coredns-1/logs/coredns.txt", "starting\nDNS lookup failed\n"},
+		{"resources/ns/kube-system/Pods.json", "[]"},
+		{"resources/cluster/Nodes.json", "[]"},
+	})
+
+	browser, err := results.NewReaderWithVersion(buf, results.VersionTen).Browse()
+	if err != nil {
+		t.Fatalf("unexpected error browsing archive: %v", err)
+	}
+
+	if !reflect.DeepEqual(browser.Plugins, []string{"e2e", "systemd_logs"}) {
+		t.Errorf("unexpected plugins %v", browser.Plugins)
+	}
+	if suites := browser.Suites("systemd_logs"); len(suites) != 1 || suites[0].Tests != 1 || suites[0].Failures != 1 {
+		t.Errorf("expected systemd_logs' error to be a failed test, got %+v", suites)
+	}
+	if logs := browser.PodLogs(); !reflect.DeepEqual(logs, []string{"podlogs/kube-system/coredns-1/logs/coredns.txt"}) {
+		t.Errorf("unexpected pod logs %v", logs)
+	}
+	if resources := browser.Resources(); !reflect.DeepEqual(resources, []string{"resources/cluster/Nodes.json", "resources/ns/kube-system/Pods.json"}) {
+		t.Errorf("unexpected resources %v", resources)
+	}
+	if files := browser.PluginFiles("systemd_logs"); !reflect.DeepEqual(files, []string{"plugins/systemd_logs/errors/node2"}) {
+		t.Errorf("unexpected plugin files %v", files)
+	}
+	if data, ok := browser.File("resources/cluster/Nodes.json"); !ok || string(data) != "[]" {
+		t.Errorf("expected the nodes file, got %q", data)
+	}
+
+	expected := []results.SearchMatch{
+		{Plugin: "e2e", Suite: "e2e", Test: "[sig-network] DNS works", Text: "[sig-network] DNS works"},
+		{Path: "plugins/e2e/results/junit_01.xml", Line: 1, Text: junit},
+		{Path: "podlogs/kube-system/coredns-1/logs/coredns.txt", Line: 2, Text: "DNS lookup failed"},
+	}
+	if matches := browser.Search("dns"); !reflect.DeepEqual(matches, expected) {
+		t.Errorf("expected matches %+v, got %+v", expected, matches)
+	}
+}
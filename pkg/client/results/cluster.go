@@ -0,0 +1,192 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/heptio/sonobuoy/pkg/discovery"
+	"github.com/pkg/errors"
+)
+
+// maxKubeletSkew is how many minor versions older than the API server
+// kubelets are supported.
+const maxKubeletSkew = 2
+
+// ClusterInfo reads the versions and platform of the cluster the run was on,
+// or nil if the archive predates them being recorded.
+func (r *Reader) ClusterInfo() (*discovery.ClusterInfo, error) {
+	var info *discovery.ClusterInfo
+	err := r.WalkFiles(func(filePath string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath != r.ClusterInfoFile() {
+			return nil
+		}
+		info = &discovery.ClusterInfo{}
+		return ExtractFileIntoStruct(r.ClusterInfoFile(), filePath, fileInfo, info)
+	})
+	return info, errors.Wrap(err, "couldn't walk archive")
+}
+
+// minorVersion is the major and minor parts of a Kubernetes version.
+type minorVersion struct {
+	major, minor int
+}
+
+var minorVersionRE = regexp.MustCompile(`^v?(\d+)\.(\d+)`)
+
+// parseMinorVersion parses versions such as v1.10.3 or v1.10.3-gke.0.
+func parseMinorVersion(v string) (minorVersion, bool) {
+	m := minorVersionRE.FindStringSubmatch(v)
+	if m == nil {
+		return minorVersion{}, false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return minorVersion{major, minor}, true
+}
+
+// minorsBehind is how many minor versions v is older than other, negative if
+// it's newer.
+func (v minorVersion) minorsBehind(other minorVersion) int {
+	if v.major != other.major {
+		return (other.major - v.major) * 100
+	}
+	return other.minor - v.minor
+}
+
+// VersionSkew warns about the versions of the cluster's components that are
+// outside Kubernetes' version skew policy: kubelets newer than the API server
+// or more than two minor versions older, and kube-proxies that don't match
+// their kubelets. It also warns when the nodes run different minor versions,
+// such as part way through an upgrade, since results may differ by node.
+func VersionSkew(info *discovery.ClusterInfo) []string {
+	if info == nil {
+		return nil
+	}
+	var warnings []string
+
+	kubelets := nodesByValue(info.Nodes, func(n discovery.NodeInfo) string { return n.KubeletVersion })
+	if info.ServerVersion != nil {
+		if server, ok := parseMinorVersion(info.ServerVersion.GitVersion); ok {
+			for _, kubelet := range kubelets {
+				v, ok := parseMinorVersion(kubelet.value)
+				if !ok {
+					continue
+				}
+				switch behind := v.minorsBehind(server); {
+				case behind < 0:
+					warnings = append(warnings, fmt.Sprintf("kubelet %v on %v is newer than the API server %v, which isn't supported",
+						kubelet.value, kubelet.nodeList(), info.ServerVersion.GitVersion))
+				case behind > maxKubeletSkew:
+					warnings = append(warnings, fmt.Sprintf("kubelet %v on %v is more than %d minor versions older than the API server %v, which isn't supported",
+						kubelet.value, kubelet.nodeList(), maxKubeletSkew, info.ServerVersion.GitVersion))
+				}
+			}
+		}
+	}
+
+	minors := map[minorVersion]bool{}
+	for _, kubelet := range kubelets {
+		if v, ok := parseMinorVersion(kubelet.value); ok {
+			minors[v] = true
+		}
+	}
+	if len(minors) > 1 {
+		warnings = append(warnings, fmt.Sprintf("nodes run kubelets of %d minor versions (%v), so results may differ by node",
+			len(minors), valueCounts(kubelets)))
+	}
+
+	proxies := nodesByValue(info.Nodes, func(n discovery.NodeInfo) string {
+		kubelet, kubeletOK := parseMinorVersion(n.KubeletVersion)
+		proxy, proxyOK := parseMinorVersion(n.KubeProxyVersion)
+		if !kubeletOK || !proxyOK || kubelet == proxy {
+			return ""
+		}
+		return fmt.Sprintf("kube-proxy %v with kubelet %v", n.KubeProxyVersion, n.KubeletVersion)
+	})
+	for _, proxy := range proxies {
+		warnings = append(warnings, fmt.Sprintf("%v on %v don't match", proxy.value, proxy.nodeList()))
+	}
+	return warnings
+}
+
+// nodeValues is the nodes that have a value, such as a kubelet version.
+type nodeValues struct {
+	value string
+	nodes []string
+}
+
+// nodesByValue groups nodes by a value of theirs, most common first, leaving
+// out those without one.
+func nodesByValue(nodes []discovery.NodeInfo, value func(discovery.NodeInfo) string) []nodeValues {
+	byValue := map[string][]string{}
+	for _, n := range nodes {
+		if v := value(n); v != "" {
+			byValue[v] = append(byValue[v], n.Name)
+		}
+	}
+	grouped := make([]nodeValues, 0, len(byValue))
+	for v, names := range byValue {
+		grouped = append(grouped, nodeValues{value: v, nodes: names})
+	}
+	sort.Slice(grouped, func(i, j int) bool {
+		if len(grouped[i].nodes) != len(grouped[j].nodes) {
+			return len(grouped[i].nodes) > len(grouped[j].nodes)
+		}
+		return grouped[i].value < grouped[j].value
+	})
+	return grouped
+}
+
+// maxListedNodes is how many nodes are named in a warning before the rest
+// are counted.
+const maxListedNodes = 3
+
+// nodeList names the nodes, such as "node a" or "3 nodes (a, b, c)".
+func (n nodeValues) nodeList() string {
+	if len(n.nodes) == 1 {
+		return "node " + n.nodes[0]
+	}
+	names := n.nodes
+	if len(names) > maxListedNodes {
+		names = append(append([]string(nil), names[:maxListedNodes]...), fmt.Sprintf("%d more", len(n.nodes)-maxListedNodes))
+	}
+	return fmt.Sprintf("%d nodes (%v)", len(n.nodes), strings.Join(names, ", "))
+}
+
+// NodeValueCounts summarizes a value of the nodes, such as their kubelet
+// versions, as "v1.10.3 (2), v1.9.7 (1)", most common first.
+func NodeValueCounts(nodes []discovery.NodeInfo, value func(discovery.NodeInfo) string) string {
+	return valueCounts(nodesByValue(nodes, value))
+}
+
+// valueCounts formats grouped nodes as "v1.10.3 (2), v1.9.7 (1)".
+func valueCounts(grouped []nodeValues) string {
+	counts := make([]string, len(grouped))
+	for i, g := range grouped {
+		counts[i] = fmt.Sprintf("%v (%d)", g.value, len(g.nodes))
+	}
+	return strings.Join(counts, ", ")
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results_test
+
+import (
+	"reflect"
+	"testing"
+
+	k8sver "k8s.io/apimachinery/pkg/version"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+	"github.com/heptio/sonobuoy/pkg/discovery"
+)
+
+func TestClusterInfo(t *testing.T) {
+	archive := makeArchive(t, []archiveFile{
+		{"meta/cluster.json", `{
+			"serverVersion": {"gitVersion": "v1.10.3"},
+			"provider": "gce",
+			"nodes": [{"name": "node-a", "kubeletVersion": "v1.10.3"}]
+		}`},
+	})
+	info, err := results.NewReaderWithVersion(archive, results.VersionTen).ClusterInfo()
+	if err != nil {
+		t.Fatalf("unexpected error reading cluster info: %v", err)
+	}
+	if info == nil || info.Provider != "gce" || len(info.Nodes) != 1 || info.ServerVersion.GitVersion != "v1.10.3" {
+		t.Errorf("unexpected cluster info %+v", info)
+	}
+
+	archive = makeArchive(t, []archiveFile{{"meta/config.json", "{}"}})
+	info, err = results.NewReaderWithVersion(archive, results.VersionTen).ClusterInfo()
+	if err != nil || info != nil {
+		t.Errorf("expected no cluster info in an older archive, got %+v, %v", info, err)
+	}
+}
+
+func TestVersionSkew(t *testing.T) {
+	node := func(name, kubelet, proxy string) discovery.NodeInfo {
+		return discovery.NodeInfo{Name: name, KubeletVersion: kubelet, KubeProxyVersion: proxy}
+	}
+	server := &k8sver.Info{GitVersion: "v1.10.3"}
+
+	testCases := []struct {
+		desc     string
+		nodes    []discovery.NodeInfo
+		expected []string
+	}{
+		{
+			desc:  "supported",
+			nodes: []discovery.NodeInfo{node("a", "v1.10.3", "v1.10.3"), node("b", "v1.10.1-gke.0", "v1.10.1")},
+		},
+		{
+			desc:  "newer kubelet",
+			nodes: []discovery.NodeInfo{node("a", "v1.10.3", ""), node("b", "v1.11.0", "")},
+			expected: []string{
+				"kubelet v1.11.0 on node b is newer than the API server v1.10.3, which isn't supported",
+				"nodes run kubelets of 2 minor versions (v1.10.3 (1), v1.11.0 (1)), so results may differ by node",
+			},
+		},
+		{
+			desc:  "old kubelets",
+			nodes: []discovery.NodeInfo{node("a", "v1.7.0", ""), node("b", "v1.7.0", ""), node("c", "v1.7.0", ""), node("d", "v1.7.0", "")},
+			expected: []string{
+				"kubelet v1.7.0 on 4 nodes (a, b, c, 1 more) is more than 2 minor versions older than the API server v1.10.3, which isn't supported",
+			},
+		},
+		{
+			desc:  "kube-proxy",
+			nodes: []discovery.NodeInfo{node("a", "v1.10.3", "v1.9.0")},
+			expected: []string{
+				"kube-proxy v1.9.0 with kubelet v1.10.3 on node a don't match",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			warnings := results.VersionSkew(&discovery.ClusterInfo{ServerVersion: server, Nodes: tc.nodes})
+			if !reflect.DeepEqual(warnings, tc.expected) {
+				t.Errorf("expected warnings %q, got %q", tc.expected, warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+	"github.com/heptio/sonobuoy/pkg/client/results/e2e"
+	"github.com/pkg/errors"
+)
+
+// Files of a CNCF conformance submission.
+const (
+	ConformanceProductFile = "PRODUCT.yaml"
+	ConformanceREADMEFile  = "README.md"
+	ConformanceE2ELogFile  = "e2e.log"
+	ConformanceJUnitFile   = e2e.JUnitResultsFile
+)
+
+// conformanceTag marks the tests required for conformance.
+const conformanceTag = "[Conformance]"
+
+// conformanceProductTypes are the kinds of product that can be certified.
+var conformanceProductTypes = []string{"distribution", "hosted platform", "installer"}
+
+// minorVersionRegexp matches the major and minor version of a Kubernetes
+// gitVersion, such as v1.13 in v1.13.2-gke.1.
+var minorVersionRegexp = regexp.MustCompile(`^v[0-9]+\.[0-9]+`)
+
+// slugSeparatorRegexp matches the runs of characters replaced by dashes in a
+// product's directory name.
+var slugSeparatorRegexp = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ConformanceProduct is the PRODUCT.yaml describing the product a conformance
+// submission is for.
+type ConformanceProduct struct {
+	Vendor           string `json:"vendor"`
+	Name             string `json:"name"`
+	Version          string `json:"version"`
+	WebsiteURL       string `json:"website_url"`
+	RepoURL          string `json:"repo_url,omitempty"`
+	DocumentationURL string `json:"documentation_url"`
+	ProductLogoURL   string `json:"product_logo_url"`
+	Type             string `json:"type"`
+	Description      string `json:"description"`
+}
+
+// Validate returns the problems with the product metadata, if any.
+func (p *ConformanceProduct) Validate() (errs []error) {
+	required := []struct{ field, value string }{
+		{"vendor", p.Vendor},
+		{"name", p.Name},
+		{"version", p.Version},
+		{"website_url", p.WebsiteURL},
+		{"documentation_url", p.DocumentationURL},
+		{"product_logo_url", p.ProductLogoURL},
+		{"type", p.Type},
+		{"description", p.Description},
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			errs = append(errs, fmt.Errorf("%v is missing %v", ConformanceProductFile, r.field))
+		}
+	}
+
+	urls := []struct{ field, value string }{
+		{"website_url", p.WebsiteURL},
+		{"repo_url", p.RepoURL},
+		{"documentation_url", p.DocumentationURL},
+		{"product_logo_url", p.ProductLogoURL},
+	}
+	for _, u := range urls {
+		if u.value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u.value); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("%v %v %q isn't an http(s) URL", ConformanceProductFile, u.field, u.value))
+		}
+	}
+
+	if p.Type != "" && !containsString(conformanceProductTypes, p.Type) {
+		errs = append(errs, fmt.Errorf("%v type %q must be one of %q", ConformanceProductFile, p.Type, conformanceProductTypes))
+	}
+	return errs
+}
+
+// ConformanceResults are the results of a conformance run needed for a
+// submission.
+type ConformanceResults struct {
+	// KubernetesVersion is the major and minor version of the cluster, such
+	// as v1.13, which submissions are filed under.
+	KubernetesVersion string
+	// E2ELog and JUnit are the e2e plugin's log and JUnit results.
+	E2ELog []byte
+	JUnit  []byte
+}
+
+// ConformanceResults reads the results of the e2e plugin and the version of
+// the cluster from the archive.
+func (r *Reader) ConformanceResults() (*ConformanceResults, error) {
+	resultsDir := PluginsDir + e2e.ResultsSubdirectory
+	logBuf, junitBuf, versionBuf := bytes.Buffer{}, bytes.Buffer{}, bytes.Buffer{}
+	err := r.WalkFiles(func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ExtractBytes(resultsDir+ConformanceE2ELogFile, filePath, info, &logBuf); err != nil {
+			return err
+		}
+		if err := ExtractBytes(resultsDir+ConformanceJUnitFile, filePath, info, &junitBuf); err != nil {
+			return err
+		}
+		return ExtractBytes(r.ServerVersionFile(), filePath, info, &versionBuf)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't walk archive")
+	}
+
+	results := &ConformanceResults{E2ELog: logBuf.Bytes(), JUnit: junitBuf.Bytes()}
+	if versionBuf.Len() > 0 {
+		var version struct {
+			GitVersion string `json:"gitVersion"`
+		}
+		if err := json.Unmarshal(versionBuf.Bytes(), &version); err != nil {
+			return nil, errors.Wrap(err, "couldn't decode server version")
+		}
+		results.KubernetesVersion = minorVersionRegexp.FindString(version.GitVersion)
+	}
+	return results, nil
+}
+
+// Validate returns the reasons the results can't be submitted, if any: they
+// must come from a run of every conformance test, and only those, in which
+// none failed.
+func (c *ConformanceResults) Validate() (errs []error) {
+	if c.KubernetesVersion == "" {
+		errs = append(errs, errors.New("couldn't find the cluster's Kubernetes version in the archive"))
+	}
+	if len(c.E2ELog) == 0 {
+		errs = append(errs, fmt.Errorf("archive has no e2e %v", ConformanceE2ELogFile))
+	}
+	if len(c.JUnit) == 0 {
+		return append(errs, fmt.Errorf("archive has no e2e %v", ConformanceJUnitFile))
+	}
+
+	suites, err := readJUnitSuites(bytes.NewReader(c.JUnit))
+	if err != nil {
+		return append(errs, errors.Wrapf(err, "couldn't read e2e %v", ConformanceJUnitFile))
+	}
+	var ran int
+	var failed, skipped, extra []string
+	for _, suite := range suites {
+		for _, testCase := range suite.TestCases {
+			conformance := strings.Contains(testCase.Name, conformanceTag)
+			switch {
+			case Skipped(testCase):
+				if conformance {
+					skipped = append(skipped, testCase.Name)
+				}
+				continue
+			case Failed(testCase):
+				failed = append(failed, testCase.Name)
+			}
+			ran++
+			if !conformance {
+				extra = append(extra, testCase.Name)
+			}
+		}
+	}
+	if ran == 0 {
+		errs = append(errs, errors.New("no e2e tests ran"))
+	}
+	if len(failed) > 0 {
+		errs = append(errs, fmt.Errorf("%d e2e tests failed, such as %q", len(failed), failed[0]))
+	}
+	if len(skipped) > 0 {
+		errs = append(errs, fmt.Errorf("%d conformance tests were skipped, such as %q; run with --mode certified-conformance", len(skipped), skipped[0]))
+	}
+	if len(extra) > 0 {
+		errs = append(errs, fmt.Errorf("%d tests that aren't conformance tests ran, such as %q; run with --mode certified-conformance", len(extra), extra[0]))
+	}
+	return errs
+}
+
+// ConformanceSubmission is the directory of a product's conformance results,
+// as submitted to github.com/cncf/k8s-conformance.
+type ConformanceSubmission struct {
+	Results *ConformanceResults
+	// Product is the product's PRODUCT.yaml, kept as written.
+	Product []byte
+	// README describes how to reproduce the results. If it's empty, a
+	// README with the steps to run Sonobuoy is generated, leaving how to
+	// create the cluster to the product's documentation.
+	README []byte
+}
+
+// Validate returns every problem that would get the submission rejected that
+// can be found from its files.
+func (s *ConformanceSubmission) Validate() []error {
+	errs := s.Results.Validate()
+	product, err := s.product()
+	if err != nil {
+		return append(errs, err)
+	}
+	return append(errs, product.Validate()...)
+}
+
+// Dir is the path of the submission in the k8s-conformance repository, such
+// as v1.13/my-product.
+func (s *ConformanceSubmission) Dir() (string, error) {
+	product, err := s.product()
+	if err != nil {
+		return "", err
+	}
+	if s.Results.KubernetesVersion == "" || productSlug(product.Name) == "" {
+		return "", errors.New("submission needs a Kubernetes version and product name")
+	}
+	return path.Join(s.Results.KubernetesVersion, productSlug(product.Name)), nil
+}
+
+// Files returns the files of the submission, by path within the repository.
+func (s *ConformanceSubmission) Files() (map[string][]byte, error) {
+	dir, err := s.Dir()
+	if err != nil {
+		return nil, err
+	}
+	readme := s.README
+	if len(readme) == 0 {
+		product, err := s.product()
+		if err != nil {
+			return nil, err
+		}
+		buf := bytes.Buffer{}
+		if err := conformanceREADME.Execute(&buf, product); err != nil {
+			return nil, errors.Wrap(err, "couldn't generate README")
+		}
+		readme = buf.Bytes()
+	}
+	return map[string][]byte{
+		path.Join(dir, ConformanceProductFile): s.Product,
+		path.Join(dir, ConformanceREADMEFile):  readme,
+		path.Join(dir, ConformanceE2ELogFile):  s.Results.E2ELog,
+		path.Join(dir, ConformanceJUnitFile):   s.Results.JUnit,
+	}, nil
+}
+
+func (s *ConformanceSubmission) product() (*ConformanceProduct, error) {
+	product := &ConformanceProduct{}
+	if err := yaml.Unmarshal(s.Product, product); err != nil {
+		return nil, errors.Wrapf(err, "couldn't decode %v", ConformanceProductFile)
+	}
+	return product, nil
+}
+
+// productSlug is the directory a product's submissions are kept in, its name
+// in lowercase with dashes between words.
+func productSlug(name string) string {
+	return strings.Trim(slugSeparatorRegexp.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+var conformanceREADME = template.Must(template.New("README").Parse(`# {{.Name}}
+
+## Creating the cluster
+
+Create a cluster with {{.Name}} {{.Version}} by following its documentation:
+{{.DocumentationURL}}
+
+## Running the conformance tests
+
+Download a [Sonobuoy](https://github.com/heptio/sonobuoy/releases) release and
+run the conformance tests against the cluster:
+
+` + "```" + `
+$ sonobuoy run --mode certified-conformance
+$ sonobuoy status
+` + "```" + `
+
+Once ` + "`sonobuoy status`" + ` shows the run has completed, retrieve the results,
+which include the ` + "`e2e.log`" + ` and ` + "`junit_01.xml`" + ` submitted here:
+
+` + "```" + `
+$ sonobuoy retrieve .
+` + "```" + `
+`))
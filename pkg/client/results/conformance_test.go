@@ -0,0 +1,159 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+)
+
+const conformanceProduct = `vendor: Example
+name: Example Kubernetes Engine
+version: v2.1
+website_url: https://example.com
+documentation_url: https://example.com/docs
+product_logo_url: https://example.com/logo.svg
+type: hosted platform
+description: Managed Kubernetes.
+`
+
+func conformanceArchive(junit string) []archiveFile {
+	return []archiveFile{
+		{"serverversion.json", `{"major": "1", "minor": "13+", "gitVersion": "v1.13.2-example.1"}`},
+		{"plugins/e2e/results/e2e.log", "SUCCESS! -- 2 Passed | 0 Failed | 0 Pending | 1 Skipped PASS"},
+		{"plugins/e2e/results/junit_01.xml", junit},
+	}
+}
+
+func TestConformanceSubmission(t *testing.T) {
+	testCases := []struct {
+		name           string
+		files          []archiveFile
+		product        string
+		expectProblems []string
+	}{
+		{
+			name: "valid",
+			files: conformanceArchive(`<testsuite tests="3" failures="0">
+				<testcase name="[sig-network] Services should serve a basic endpoint [Conformance]"></testcase>
+				<testcase name="[k8s.io] Pods should be submitted and removed [Conformance]"></testcase>
+				<testcase name="[sig-storage] Volumes should be mountable [Slow]"><skipped></skipped></testcase>
+			</testsuite>`),
+			product: conformanceProduct,
+		}, {
+			name: "failed, skipped and extra tests",
+			files: conformanceArchive(`<testsuite tests="3" failures="1">
+				<testcase name="[sig-network] Services should serve a basic endpoint [Conformance]"><failure type="Failure">boom</failure></testcase>
+				<testcase name="[k8s.io] Pods should be submitted and removed [Conformance]"><skipped></skipped></testcase>
+				<testcase name="[sig-storage] Volumes should be mountable [Slow]"></testcase>
+			</testsuite>`),
+			product: conformanceProduct,
+			expectProblems: []string{
+				"1 e2e tests failed",
+				"1 conformance tests were skipped",
+				"1 tests that aren't conformance tests ran",
+			},
+		}, {
+			name:    "missing results",
+			files:   []archiveFile{{"meta/config.json", "{}"}},
+			product: conformanceProduct,
+			expectProblems: []string{
+				"Kubernetes version",
+				"no e2e e2e.log",
+				"no e2e junit_01.xml",
+			},
+		}, {
+			name: "incomplete product",
+			files: conformanceArchive(`<testsuite tests="1" failures="0">
+				<testcase name="[k8s.io] Pods should be submitted and removed [Conformance]"></testcase>
+			</testsuite>`),
+			product: "name: Example\nwebsite_url: example.com\ntype: cloud\n",
+			expectProblems: []string{
+				"missing vendor",
+				"missing version",
+				"missing documentation_url",
+				"missing product_logo_url",
+				"missing description",
+				`website_url "example.com" isn't an http(s) URL`,
+				`type "cloud" must be one of`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reader := results.NewReaderWithVersion(makeArchive(t, tc.files), results.VersionTen)
+			conformance, err := reader.ConformanceResults()
+			if err != nil {
+				t.Fatalf("unexpected error reading conformance results: %v", err)
+			}
+			submission := &results.ConformanceSubmission{Results: conformance, Product: []byte(tc.product)}
+
+			problems := submission.Validate()
+			if len(problems) != len(tc.expectProblems) {
+				t.Fatalf("expected %d problems, got %v", len(tc.expectProblems), problems)
+			}
+			for i, expected := range tc.expectProblems {
+				if !strings.Contains(problems[i].Error(), expected) {
+					t.Errorf("expected problem %q, got %q", expected, problems[i])
+				}
+			}
+		})
+	}
+}
+
+func TestConformanceSubmission_Files(t *testing.T) {
+	reader := results.NewReaderWithVersion(makeArchive(t, conformanceArchive("<testsuite></testsuite>")), results.VersionTen)
+	conformance, err := reader.ConformanceResults()
+	if err != nil {
+		t.Fatalf("unexpected error reading conformance results: %v", err)
+	}
+	submission := &results.ConformanceSubmission{Results: conformance, Product: []byte(conformanceProduct)}
+
+	files, err := submission.Files()
+	if err != nil {
+		t.Fatalf("unexpected error getting submission files: %v", err)
+	}
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	expected := []string{
+		"v1.13/example-kubernetes-engine/PRODUCT.yaml",
+		"v1.13/example-kubernetes-engine/README.md",
+		"v1.13/example-kubernetes-engine/e2e.log",
+		"v1.13/example-kubernetes-engine/junit_01.xml",
+	}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected files %v, got %v", expected, paths)
+	}
+	if string(files[expected[0]]) != conformanceProduct {
+		t.Errorf("expected PRODUCT.yaml to be kept as written, got %q", files[expected[0]])
+	}
+	if readme := string(files[expected[1]]); !strings.Contains(readme, "https://example.com/docs") || !strings.Contains(readme, "--mode certified-conformance") {
+		t.Errorf("expected the generated README to explain how to reproduce the results, got %q", readme)
+	}
+
+	submission.README = []byte("# Custom\n")
+	if files, err = submission.Files(); err != nil || string(files[expected[1]]) != "# Custom\n" {
+		t.Errorf("expected the given README to be used, got %q (%v)", files[expected[1]], err)
+	}
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/onsi/ginkgo/reporters"
+	"github.com/pkg/errors"
+)
+
+const (
+	outcomePassed  = "passed"
+	outcomeFailed  = "failed"
+	outcomeSkipped = "skipped"
+)
+
+// volatileResources are the resources left out of diffs, since they're
+// different in every run.
+var volatileResources = map[string]bool{
+	"Events":      true,
+	"NodeMetrics": true,
+	"PodMetrics":  true,
+}
+
+// volatileMetadata are the metadata fields left out when comparing objects,
+// since the API server changes them whenever it likes.
+var volatileMetadata = []string{
+	"creationTimestamp",
+	"generation",
+	"resourceVersion",
+	"selfLink",
+	"uid",
+}
+
+// Summary is what's compared between two runs: the outcome of each test and
+// the objects of each resource.
+type Summary struct {
+	tests map[TestID]string
+	// resources maps each resource, in a namespace or across the cluster, to
+	// the JSON of its objects by name, without their status.
+	resources map[resourceKey]map[string]string
+}
+
+type resourceKey struct {
+	namespace, kind string
+}
+
+// TestID identifies a test across runs.
+type TestID struct {
+	Suite string `json:"suite"`
+	Name  string `json:"name"`
+}
+
+// TestCounts counts the outcomes of the tests in a run.
+type TestCounts struct {
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+// TestsDiff compares the outcomes of the tests in two runs. Skipped tests
+// count as not having run.
+type TestsDiff struct {
+	Old TestCounts `json:"old"`
+	New TestCounts `json:"new"`
+	// NewlyFailing are the tests which failed in the new run, but passed or
+	// didn't run in the old one.
+	NewlyFailing []TestID `json:"newlyFailing,omitempty"`
+	// Fixed are the tests which failed in the old run and passed in the new
+	// one.
+	Fixed []TestID `json:"fixed,omitempty"`
+	// NoLongerRun are the tests which ran in the old run but not in the new
+	// one.
+	NoLongerRun []TestID `json:"noLongerRun,omitempty"`
+}
+
+// ResourceDiff lists the objects of a resource that differ between two runs,
+// by name.
+type ResourceDiff struct {
+	// Namespace is empty for cluster-scoped resources.
+	Namespace string   `json:"namespace,omitempty"`
+	Kind      string   `json:"kind"`
+	Added     []string `json:"added,omitempty"`
+	Removed   []string `json:"removed,omitempty"`
+	Changed   []string `json:"changed,omitempty"`
+}
+
+// Diff is how two runs differ, for tracking regressions across changes to a
+// cluster such as upgrades.
+type Diff struct {
+	Tests     TestsDiff      `json:"tests"`
+	Resources []ResourceDiff `json:"resources,omitempty"`
+}
+
+// Summary reads the outcome of each test and the cluster's resources from the
+// archive. Tests are the ones in its JUnitReport. Objects are compared without
+// their status and the metadata the API server manages, and events and
+// metrics are left out.
+func (r *Reader) Summary() (*Summary, error) {
+	plugins := pluginSet{}
+	summary := &Summary{tests: map[TestID]string{}, resources: map[resourceKey]map[string]string{}}
+	err := r.walkArchive(func(filePath string, info os.FileInfo) error {
+		if err := plugins.collect(filePath, info); err != nil {
+			return err
+		}
+		return summary.collectResource(r, filePath, info)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, suite := range junitReport(plugins, plugins.names()).Suites {
+		for _, testCase := range suite.TestCases {
+			summary.tests[TestID{Suite: suite.Name, Name: testCase.Name}] = outcome(testCase)
+		}
+	}
+	return summary, nil
+}
+
+func outcome(testCase reporters.JUnitTestCase) string {
+	switch {
+	case Skipped(testCase):
+		return outcomeSkipped
+	case Failed(testCase):
+		return outcomeFailed
+	default:
+		return outcomePassed
+	}
+}
+
+// collectResource adds the objects in the file at filePath, if it's one of the
+// resources that are compared.
+func (s *Summary) collectResource(r *Reader, filePath string, info os.FileInfo) error {
+	if path.Ext(filePath) != ".json" {
+		return nil
+	}
+	var key resourceKey
+	switch {
+	case strings.HasPrefix(filePath, r.NonNamespacedResources()):
+		key.kind = strings.TrimPrefix(filePath, r.NonNamespacedResources())
+	case strings.HasPrefix(filePath, r.NamespacedResources()):
+		parts := strings.Split(strings.TrimPrefix(filePath, r.NamespacedResources()), "/")
+		if len(parts) != 2 {
+			return nil
+		}
+		key.namespace, key.kind = parts[0], parts[1]
+	default:
+		return nil
+	}
+	key.kind = strings.TrimSuffix(key.kind, ".json")
+	if strings.Contains(key.kind, "/") || volatileResources[key.kind] {
+		return nil
+	}
+
+	var objs []map[string]interface{}
+	if err := json.NewDecoder(info.Sys().(io.Reader)).Decode(&objs); err != nil {
+		// Not everything stored with the resources is a list of objects.
+		return nil
+	}
+	byName := map[string]string{}
+	for _, obj := range objs {
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		if name == "" {
+			continue
+		}
+		for _, field := range volatileMetadata {
+			delete(metadata, field)
+		}
+		delete(obj, "status")
+		normalized, err := json.Marshal(obj)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't encode %v in %v", name, filePath)
+		}
+		byName[name] = string(normalized)
+	}
+	s.resources[key] = byName
+	return nil
+}
+
+// DiffSummaries compares the summaries of an old run, before, and a new one,
+// after.
+func DiffSummaries(before, after *Summary) *Diff {
+	diff := &Diff{}
+	diff.Tests.Old = countTests(before.tests)
+	diff.Tests.New = countTests(after.tests)
+	for id, newOutcome := range after.tests {
+		oldOutcome := before.tests[id]
+		switch {
+		case newOutcome == outcomeFailed && oldOutcome != outcomeFailed:
+			diff.Tests.NewlyFailing = append(diff.Tests.NewlyFailing, id)
+		case newOutcome == outcomePassed && oldOutcome == outcomeFailed:
+			diff.Tests.Fixed = append(diff.Tests.Fixed, id)
+		}
+	}
+	for id, oldOutcome := range before.tests {
+		if newOutcome := after.tests[id]; oldOutcome != outcomeSkipped && (newOutcome == "" || newOutcome == outcomeSkipped) {
+			diff.Tests.NoLongerRun = append(diff.Tests.NoLongerRun, id)
+		}
+	}
+	sortTestIDs(diff.Tests.NewlyFailing)
+	sortTestIDs(diff.Tests.Fixed)
+	sortTestIDs(diff.Tests.NoLongerRun)
+
+	keys := map[resourceKey]bool{}
+	for key := range before.resources {
+		keys[key] = true
+	}
+	for key := range after.resources {
+		keys[key] = true
+	}
+	for key := range keys {
+		resourceDiff := ResourceDiff{Namespace: key.namespace, Kind: key.kind}
+		oldObjs, newObjs := before.resources[key], after.resources[key]
+		for name, newObj := range newObjs {
+			oldObj, ok := oldObjs[name]
+			switch {
+			case !ok:
+				resourceDiff.Added = append(resourceDiff.Added, name)
+			case oldObj != newObj:
+				resourceDiff.Changed = append(resourceDiff.Changed, name)
+			}
+		}
+		for name := range oldObjs {
+			if _, ok := newObjs[name]; !ok {
+				resourceDiff.Removed = append(resourceDiff.Removed, name)
+			}
+		}
+		if len(resourceDiff.Added)+len(resourceDiff.Removed)+len(resourceDiff.Changed) == 0 {
+			continue
+		}
+		sort.Strings(resourceDiff.Added)
+		sort.Strings(resourceDiff.Removed)
+		sort.Strings(resourceDiff.Changed)
+		diff.Resources = append(diff.Resources, resourceDiff)
+	}
+	sort.Slice(diff.Resources, func(i, j int) bool {
+		a, b := diff.Resources[i], diff.Resources[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Kind < b.Kind
+	})
+	return diff
+}
+
+func countTests(tests map[TestID]string) TestCounts {
+	counts := TestCounts{}
+	for _, outcome := range tests {
+		switch outcome {
+		case outcomePassed:
+			counts.Passed++
+		case outcomeFailed:
+			counts.Failed++
+		case outcomeSkipped:
+			counts.Skipped++
+		}
+	}
+	return counts
+}
+
+func sortTestIDs(ids []TestID) {
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].Suite != ids[j].Suite {
+			return ids[i].Suite < ids[j].Suite
+		}
+		return ids[i].Name < ids[j].Name
+	})
+}
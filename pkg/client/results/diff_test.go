@@ -0,0 +1,100 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+)
+
+const (
+	oldJUnit = `<testsuite name="e2e" tests="4" failures="1">
+	<testcase name="stays passing"></testcase>
+	<testcase name="starts failing"></testcase>
+	<testcase name="gets fixed"><failure type="Failure">boom</failure></testcase>
+	<testcase name="gets skipped"></testcase>
+</testsuite>`
+	newJUnit = `<testsuite name="e2e" tests="4" failures="1">
+	<testcase name="stays passing"></testcase>
+	<testcase name="starts failing"><failure type="Failure">boom</failure></testcase>
+	<testcase name="gets fixed"></testcase>
+	<testcase name="gets skipped"><skipped></skipped></testcase>
+</testsuite>`
+)
+
+func mustSummarize(t *testing.T, files []archiveFile) *results.Summary {
+	t.Helper()
+	summary, err := results.NewReaderWithVersion(makeArchive(t, files), results.VersionTen).Summary()
+	if err != nil {
+		t.Fatalf("unexpected error summarizing archive: %v", err)
+	}
+	return summary
+}
+
+func TestDiffSummaries(t *testing.T) {
+	before := mustSummarize(t, []archiveFile{
+		{"plugins/e2e/results/junit_01.xml", oldJUnit},
+		{"plugins/systemd_logs/results/node1", "logs"},
+		{"resources/cluster/Nodes.json", `[{"metadata": {"name": "node1", "resourceVersion": "1"}, "status": {"phase": "Running"}}]`},
+		{"resources/ns/default/Deployments.json", `[
+			{"metadata": {"name": "web"}, "spec": {"replicas": 1}},
+			{"metadata": {"name": "old"}, "spec": {"replicas": 1}}
+		]`},
+		{"resources/ns/default/Events.json", `[{"metadata": {"name": "event1"}}]`},
+	})
+	after := mustSummarize(t, []archiveFile{
+		{"plugins/e2e/results/junit_01.xml", newJUnit},
+		{"plugins/systemd_logs/errors/node1", `{"error":"timeout"}`},
+		{"resources/cluster/Nodes.json", `[{"metadata": {"name": "node1", "resourceVersion": "2"}, "status": {"phase": "Pending"}}]`},
+		{"resources/ns/default/Deployments.json", `[
+			{"metadata": {"name": "web"}, "spec": {"replicas": 3}},
+			{"metadata": {"name": "new"}, "spec": {"replicas": 1}}
+		]`},
+		{"resources/ns/default/Events.json", `[{"metadata": {"name": "event2"}}]`},
+	})
+
+	diff := results.DiffSummaries(before, after)
+
+	expectedTests := results.TestsDiff{
+		Old: results.TestCounts{Passed: 4, Failed: 1},
+		New: results.TestCounts{Passed: 2, Failed: 2, Skipped: 1},
+		NewlyFailing: []results.TestID{
+			{Suite: "e2e", Name: "starts failing"},
+			{Suite: "systemd_logs", Name: "node1"},
+		},
+		Fixed:       []results.TestID{{Suite: "e2e", Name: "gets fixed"}},
+		NoLongerRun: []results.TestID{{Suite: "e2e", Name: "gets skipped"}},
+	}
+	if !reflect.DeepEqual(diff.Tests, expectedTests) {
+		t.Errorf("expected tests diff %+v, got %+v", expectedTests, diff.Tests)
+	}
+
+	// Node status and resource versions don't count as changes, and events
+	// aren't compared.
+	expectedResources := []results.ResourceDiff{{
+		Namespace: "default",
+		Kind:      "Deployments",
+		Added:     []string{"new"},
+		Removed:   []string{"old"},
+		Changed:   []string{"web"},
+	}}
+	if !reflect.DeepEqual(diff.Resources, expectedResources) {
+		t.Errorf("expected resources diff %+v, got %+v", expectedResources, diff.Resources)
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results
+
+import (
+	"html/template"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	k8sver "k8s.io/apimachinery/pkg/version"
+)
+
+// maxSnippetLength is how much of each failed test's message and output the
+// HTML report shows. Output is cut from the start, since it usually ends with
+// what went wrong.
+const maxSnippetLength = 4096
+
+// htmlRun is what the HTML report shows from the run's config.
+type htmlRun struct {
+	UUID    string `json:"UUID"`
+	Version string `json:"Version"`
+}
+
+// htmlNode is what the HTML report shows about each node.
+type htmlNode struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Status struct {
+		NodeInfo struct {
+			KubeletVersion          string `json:"kubeletVersion"`
+			OSImage                 string `json:"osImage"`
+			ContainerRuntimeVersion string `json:"containerRuntimeVersion"`
+		} `json:"nodeInfo"`
+	} `json:"status"`
+}
+
+// htmlSuite summarizes a test suite for the HTML report.
+type htmlSuite struct {
+	Name                           string
+	Tests, Passed, Failed, Skipped int
+}
+
+// htmlFailure is a failed test in the HTML report.
+type htmlFailure struct {
+	Suite, Name, Message, Output string
+}
+
+// HTMLReport writes a single, self-contained HTML page reporting on the
+// archive: a summary of each plugin's tests, the message and output of each
+// failed one, and what's known about the cluster. Tests are the ones in the
+// archive's JUnitReport.
+func (r *Reader) HTMLReport(w io.Writer) error {
+	plugins := pluginSet{}
+	run := htmlRun{}
+	serverVersion := k8sver.Info{}
+	var nodes []htmlNode
+
+	err := r.walkArchive(func(filePath string, info os.FileInfo) error {
+		switch filePath {
+		case ConfigFile(r.Version):
+			return ExtractFileIntoStruct(filePath, filePath, info, &run)
+		case r.ServerVersionFile():
+			return ExtractFileIntoStruct(filePath, filePath, info, &serverVersion)
+		case r.NodesFile():
+			return ExtractFileIntoStruct(filePath, filePath, info, &nodes)
+		default:
+			return plugins.collect(filePath, info)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	report := junitReport(plugins, plugins.names())
+	data := struct {
+		Run           htmlRun
+		ServerVersion k8sver.Info
+		Nodes         []htmlNode
+		Total         htmlSuite
+		Suites        []htmlSuite
+		Failures      []htmlFailure
+		Generated     time.Time
+	}{
+		Run:           run,
+		ServerVersion: serverVersion,
+		Nodes:         nodes,
+		Generated:     time.Now().UTC(),
+	}
+	for _, suite := range report.Suites {
+		summary := htmlSuite{Name: suite.Name, Tests: len(suite.TestCases)}
+		for _, testCase := range suite.TestCases {
+			switch {
+			case Skipped(testCase):
+				summary.Skipped++
+			case Failed(testCase):
+				summary.Failed++
+				data.Failures = append(data.Failures, htmlFailure{
+					Suite:   suite.Name,
+					Name:    testCase.Name,
+					Message: snippet(testCase.FailureMessage.Message, false),
+					Output:  snippet(testCase.SystemOut, true),
+				})
+			default:
+				summary.Passed++
+			}
+		}
+		data.Suites = append(data.Suites, summary)
+		data.Total.Tests += summary.Tests
+		data.Total.Passed += summary.Passed
+		data.Total.Failed += summary.Failed
+		data.Total.Skipped += summary.Skipped
+	}
+
+	return errors.Wrap(htmlReportTemplate.Execute(w, data), "couldn't render HTML report")
+}
+
+// snippet shortens s to maxSnippetLength, keeping its end if fromEnd is set
+// and its start otherwise.
+func snippet(s string, fromEnd bool) string {
+	if len(s) <= maxSnippetLength {
+		return s
+	}
+	if fromEnd {
+		return "..." + s[len(s)-maxSnippetLength:]
+	}
+	return s[:maxSnippetLength] + "..."
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Sonobuoy results{{with .Run.UUID}}: {{.}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; vertical-align: top; }
+pre { background: #f6f6f6; padding: 0.5em; overflow-x: auto; white-space: pre-wrap; }
+.passed { color: #26a269; }
+.failed { color: #c01c28; }
+.skipped { color: #777; }
+</style>
+</head>
+<body>
+<h1>Sonobuoy results</h1>
+<p>{{.Total.Tests}} tests: <span class="passed">{{.Total.Passed}} passed</span>, <span class="failed">{{.Total.Failed}} failed</span>, <span class="skipped">{{.Total.Skipped}} skipped</span>.
+Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}.</p>
+
+<h2>Cluster</h2>
+<table>
+<tr><th>Run</th><td>{{.Run.UUID}}</td></tr>
+<tr><th>Sonobuoy version</th><td>{{.Run.Version}}</td></tr>
+<tr><th>Kubernetes version</th><td>{{.ServerVersion.GitVersion}}</td></tr>
+<tr><th>Platform</th><td>{{.ServerVersion.Platform}}</td></tr>
+<tr><th>Nodes</th><td>{{len .Nodes}}</td></tr>
+</table>
+{{- if .Nodes }}
+<table>
+<tr><th>Node</th><th>Kubelet</th><th>OS</th><th>Container runtime</th></tr>
+{{- range .Nodes }}
+<tr><td>{{.Metadata.Name}}</td><td>{{.Status.NodeInfo.KubeletVersion}}</td><td>{{.Status.NodeInfo.OSImage}}</td><td>{{.Status.NodeInfo.ContainerRuntimeVersion}}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+
+<h2>Plugins</h2>
+<table>
+<tr><th>Plugin</th><th>Tests</th><th>Passed</th><th>Failed</th><th>Skipped</th></tr>
+{{- range .Suites }}
+<tr><td>{{.Name}}</td><td>{{.Tests}}</td><td class="passed">{{.Passed}}</td><td class="failed">{{.Failed}}</td><td class="skipped">{{.Skipped}}</td></tr>
+{{- end }}
+</table>
+
+<h2>Failures</h2>
+{{- range .Failures }}
+<h3><span class="failed">{{.Suite}}</span> {{.Name}}</h3>
+{{- if .Message }}
+<pre>{{.Message}}</pre>
+{{- end }}
+{{- if .Output }}
+<details><summary>Output</summary><pre>{{.Output}}</pre></details>
+{{- end }}
+{{- else }}
+<p class="passed">No tests failed.</p>
+{{- end }}
+</body>
+</html>
+`))
@@ -0,0 +1,62 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+)
+
+func TestHTMLReport(t *testing.T) {
+	buf := makeArchive(t, []archiveFile{
+		{"meta/config.json", `{"UUID": "run-1234", "Version": "v0.10.0"}`},
+		{"serverversion.json", `{"gitVersion": "v1.10.2"}`},
+		{"resources/cluster/Nodes.json", `[{"metadata": {"name": "node1"}, "status": {"nodeInfo": {"kubeletVersion": "v1.10.2"}}}]`},
+		{"plugins/e2e/results/junit_01.xml", `<testsuite name="e2e" tests="2" failures="1">
+			<testcase name="works"></testcase>
+			<testcase name="breaks &lt;badly&gt;"><failure type="Failure">expected true</failure><system-out>lots of output</system-out></testcase>
+		</testsuite>`},
+		{"plugins/systemd_logs/results/node1", "logs"},
+	})
+
+	out := &bytes.Buffer{}
+	if err := results.NewReaderWithVersion(buf, results.VersionTen).HTMLReport(out); err != nil {
+		t.Fatalf("unexpected error writing report: %v", err)
+	}
+
+	report := out.String()
+	for _, expected := range []string{
+		"run-1234",
+		"v1.10.2",
+		"node1",
+		"3 tests",
+		"<td>e2e</td><td>2</td>",
+		"breaks &lt;badly&gt;",
+		"expected true",
+		"lots of output",
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("expected the report to contain %q, got\n%s", expected, report)
+		}
+	}
+	if strings.Contains(report, "No tests failed") {
+		t.Errorf("expected the report to show the failure, got\n%s", report)
+	}
+}
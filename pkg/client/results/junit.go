@@ -0,0 +1,150 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"sort"
+
+	"github.com/onsi/ginkgo/reporters"
+	"github.com/pkg/errors"
+)
+
+// JUnitTestSuites is the root element of a JUnit XML report. Most CI systems
+// (Jenkins, GitLab, Buildkite...) accept it directly as a test report.
+type JUnitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Suites   []JUnitTestSuite `xml:"testsuite"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+}
+
+// JUnitTestSuite is a reporters.JUnitTestSuite with a name, so that suites
+// from different plugins can be told apart in a combined report.
+type JUnitTestSuite struct {
+	XMLName   xml.Name                  `xml:"testsuite"`
+	Name      string                    `xml:"name,attr"`
+	TestCases []reporters.JUnitTestCase `xml:"testcase"`
+	Tests     int                       `xml:"tests,attr"`
+	Failures  int                       `xml:"failures,attr"`
+	Time      float64                   `xml:"time,attr"`
+}
+
+// JUnitReport builds a JUnit report from the plugin results in the archive.
+// Plugins that produced JUnit XML themselves (such as e2e) contribute their
+// own test suites. Every other plugin gets a suite with one test case per
+// result it reported, which fails if the result was an error.
+func (r *Reader) JUnitReport() (*JUnitTestSuites, error) {
+	plugins, names, err := r.readPluginResults()
+	if err != nil {
+		return nil, err
+	}
+	return junitReport(plugins, names), nil
+}
+
+// junitReport builds a JUnit report from the results of the named plugins.
+func junitReport(plugins map[string]*pluginResults, names []string) *JUnitTestSuites {
+	report := &JUnitTestSuites{}
+	for _, name := range names {
+		for _, suite := range plugins[name].suites(name) {
+			report.Suites = append(report.Suites, suite)
+			report.Tests += suite.Tests
+			report.Failures += suite.Failures
+		}
+	}
+	return report
+}
+
+// suites returns the JUnit suites for a plugin. Errors are always reported as
+// failed test cases, even alongside the plugin's own JUnit results, since an
+// error usually means those results are incomplete.
+func (p *pluginResults) suites(name string) []JUnitTestSuite {
+	suites := p.junit
+	for i := range suites {
+		if suites[i].Name == "" {
+			suites[i].Name = name
+		}
+	}
+
+	synthesized := JUnitTestSuite{Name: name}
+	if len(p.junit) == 0 {
+		for _, entry := range sortedKeys(p.results) {
+			synthesized.TestCases = append(synthesized.TestCases, reporters.JUnitTestCase{
+				Name:      entry,
+				ClassName: name,
+			})
+		}
+	}
+	errorEntries := make(map[string]bool, len(p.errors))
+	for entry := range p.errors {
+		errorEntries[entry] = true
+	}
+	for _, entry := range sortedKeys(errorEntries) {
+		synthesized.TestCases = append(synthesized.TestCases, reporters.JUnitTestCase{
+			Name:      entry,
+			ClassName: name,
+			FailureMessage: &reporters.JUnitFailureMessage{
+				Type:    "error",
+				Message: p.errors[entry],
+			},
+		})
+		synthesized.Failures++
+	}
+	synthesized.Tests = len(synthesized.TestCases)
+
+	if synthesized.Tests > 0 {
+		suites = append(suites, synthesized)
+	}
+	return suites
+}
+
+// readJUnitSuites decodes a JUnit XML file, whose root may either be a single
+// testsuite or a testsuites element.
+func readJUnitSuites(r io.Reader) ([]JUnitTestSuite, error) {
+	data := bytes.Buffer{}
+	if _, err := io.Copy(&data, r); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	report := struct {
+		XMLName xml.Name
+		Suites  []JUnitTestSuite `xml:"testsuite"`
+	}{}
+	if err := xml.Unmarshal(data.Bytes(), &report); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if report.XMLName.Local == "testsuites" {
+		return report.Suites, nil
+	}
+
+	suite := JUnitTestSuite{}
+	if err := xml.Unmarshal(data.Bytes(), &suite); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return []JUnitTestSuite{suite}, nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
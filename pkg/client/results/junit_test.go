@@ -0,0 +1,149 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+)
+
+func TestJUnitReport(t *testing.T) {
+	reader := MustGetReader((&version{0, 10}).path(), t)
+	report, err := reader.JUnitReport()
+	if err != nil {
+		t.Fatalf("unexpected error building report: %v", err)
+	}
+
+	if len(report.Suites) != 2 {
+		t.Fatalf("expected 2 suites, got %v", len(report.Suites))
+	}
+	e2e, systemd := report.Suites[0], report.Suites[1]
+	if e2e.Name != "e2e" || len(e2e.TestCases) != 698 {
+		t.Errorf("expected e2e suite with 698 test cases, got %q with %v", e2e.Name, len(e2e.TestCases))
+	}
+	if systemd.Name != "systemd_logs" || systemd.Tests != 3 || systemd.Failures != 0 {
+		t.Errorf("expected systemd_logs suite with 3 passing tests, got %q with %v tests and %v failures", systemd.Name, systemd.Tests, systemd.Failures)
+	}
+	if report.Tests != e2e.Tests+systemd.Tests {
+		t.Errorf("expected %v tests in the report, got %v", e2e.Tests+systemd.Tests, report.Tests)
+	}
+}
+
+func TestJUnitReport_errors(t *testing.T) {
+	buf := makeArchive(t, []archiveFile{
+		{"plugins/systemd_logs/results/node1", "logs"},
+		{"plugins/systemd_logs/errors/node2", `{"error":"timeout"}`},
+	})
+
+	report, err := results.NewReaderWithVersion(buf, results.VersionTen).JUnitReport()
+	if err != nil {
+		t.Fatalf("unexpected error building report: %v", err)
+	}
+	if report.Tests != 2 || report.Failures != 1 {
+		t.Fatalf("expected 2 tests and 1 failure, got %v tests and %v failures", report.Tests, report.Failures)
+	}
+	failed := report.Suites[0].TestCases[1]
+	if failed.Name != "node2" || !results.Failed(failed) || failed.FailureMessage.Message != `{"error":"timeout"}` {
+		t.Errorf("expected node2 to fail with the reported error, got %+v", failed)
+	}
+}
+
+func TestTestCounts(t *testing.T) {
+	// The e2e plugin's results were summarized by the aggregator, so its
+	// JUnit file isn't read; systemd_logs' weren't.
+	buf := makeArchive(t, []archiveFile{
+		{"meta/results.json", `{"plugins": [
+			{"plugin": "e2e", "resultType": "e2e", "results": [
+				{"status": "complete", "processed": {"junit-summary": {"tests": 5, "failures": 2, "suites": [{"name": "conformance", "tests": 5, "failures": 2}]}}}
+			]},
+			{"plugin": "systemd_logs", "resultType": "systemd_logs", "results": [{"node": "node1", "status": "complete"}]}
+		]}`},
+		{"plugins/e2e/results/junit_01.xml", `<testsuite name="conformance"><testcase name="a"></testcase></testsuite>`},
+		{"plugins/systemd_logs/results/node1", "logs"},
+	})
+
+	counts, err := results.NewReaderWithVersion(buf, results.VersionTen).TestCounts()
+	if err != nil {
+		t.Fatalf("unexpected error counting tests: %v", err)
+	}
+	expected := []results.SuiteCounts{
+		{Name: "conformance", Tests: 5, Failures: 2},
+		{Name: "systemd_logs", Tests: 1},
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected counts %+v, got %+v", expected, counts)
+	}
+}
+
+func TestBenchmarkCounts(t *testing.T) {
+	// Controls are summed over nodes, and results the processor failed on are
+	// left out.
+	buf := makeArchive(t, []archiveFile{
+		{"meta/results.json", `{"plugins": [
+			{"plugin": "kube-bench", "resultType": "kube-bench", "results": [
+				{"node": "master1", "status": "complete", "processed": {"kube-bench-summary": {"controls": [
+					{"id": "4", "text": "Worker Node Security Configuration", "pass": 10, "warn": 1, "fail": 2},
+					{"id": "1", "text": "Master Node Security Configuration", "pass": 50, "warn": 5, "fail": 3}
+				]}}},
+				{"node": "node1", "status": "complete", "processed": {"kube-bench-summary": {"controls": [
+					{"id": "4", "text": "Worker Node Security Configuration", "pass": 11, "warn": 1, "fail": 1}
+				]}}},
+				{"node": "node2", "status": "complete", "processed": {"kube-bench-summary": {"error": "boom"}}}
+			]},
+			{"plugin": "e2e", "resultType": "e2e", "results": [{"status": "complete"}]}
+		]}`},
+	})
+
+	counts, err := results.NewReaderWithVersion(buf, results.VersionTen).BenchmarkCounts()
+	if err != nil {
+		t.Fatalf("unexpected error counting benchmark checks: %v", err)
+	}
+	expected := []results.ControlCounts{
+		{Plugin: "kube-bench", ID: "1", Text: "Master Node Security Configuration", Pass: 50, Warn: 5, Fail: 3},
+		{Plugin: "kube-bench", ID: "4", Text: "Worker Node Security Configuration", Pass: 21, Warn: 2, Fail: 3},
+	}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("expected counts %+v, got %+v", expected, counts)
+	}
+}
+
+type archiveFile struct {
+	name, contents string
+}
+
+// makeArchive returns an uncompressed tarball holding files, in order.
+func makeArchive(t *testing.T, files []archiveFile) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.contents))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/heptio/sonobuoy/pkg/netcheck"
+	"github.com/pkg/errors"
+)
+
+// ConnectivityMatrix is how the network connectivity checks made from each
+// node went.
+type ConnectivityMatrix struct {
+	// Nodes are the nodes checks were made of, sorted.
+	Nodes []string
+	// Rows has the checks made from each node, sorted by node.
+	Rows []ConnectivityRow
+}
+
+// ConnectivityRow is how the checks made from one node went.
+type ConnectivityRow struct {
+	Node string
+	// Error is why no checks could be made from the node.
+	Error string
+	// Nodes maps each node checked to the kinds of check of it that failed,
+	// which are none if they all passed.
+	Nodes   map[string][]string
+	Service CheckOutcomes
+	DNS     CheckOutcomes
+}
+
+// CheckOutcomes counts checks of one kind and how many failed.
+type CheckOutcomes struct {
+	Checks int
+	Failed int
+}
+
+// ConnectivityReports reads the reports of the network connectivity checks in
+// the archive's plugin results, sorted by node.
+func (r *Reader) ConnectivityReports() ([]netcheck.Report, error) {
+	var reports []netcheck.Report
+	err := r.walkArchive(func(filePath string, info os.FileInfo) error {
+		// plugins/<plugin>/results/<node>/.../connectivity.json
+		parts := strings.Split(filePath, "/")
+		if len(parts) < 5 || parts[0]+"/" != PluginsDir || parts[2] != resultsDir || path.Base(filePath) != netcheck.ReportFile {
+			return nil
+		}
+		var report netcheck.Report
+		if err := json.NewDecoder(info.Sys().(io.Reader)).Decode(&report); err != nil {
+			return errors.Wrapf(err, "couldn't decode network connectivity report %v", filePath)
+		}
+		reports = append(reports, report)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(reports, func(i, j int) bool { return reports[i].Node < reports[j].Node })
+	return reports, nil
+}
+
+// NewConnectivityMatrix tabulates the reports of the network connectivity
+// checks made from each node.
+func NewConnectivityMatrix(reports []netcheck.Report) *ConnectivityMatrix {
+	matrix := &ConnectivityMatrix{}
+	nodes := map[string]bool{}
+	for _, report := range reports {
+		row := ConnectivityRow{Node: report.Node, Error: report.Error, Nodes: map[string][]string{}}
+		for _, c := range report.Checks {
+			var outcomes *CheckOutcomes
+			switch c.Kind {
+			case netcheck.PodCheck, netcheck.NodePortCheck:
+				nodes[c.Target] = true
+				failed := row.Nodes[c.Target]
+				if !c.OK() {
+					failed = append(failed, c.Kind)
+				}
+				row.Nodes[c.Target] = failed
+				continue
+			case netcheck.ServiceCheck:
+				outcomes = &row.Service
+			case netcheck.DNSCheck:
+				outcomes = &row.DNS
+			default:
+				continue
+			}
+			outcomes.Checks++
+			if !c.OK() {
+				outcomes.Failed++
+			}
+		}
+		matrix.Rows = append(matrix.Rows, row)
+	}
+
+	for node := range nodes {
+		matrix.Nodes = append(matrix.Nodes, node)
+	}
+	sort.Strings(matrix.Nodes)
+	sort.SliceStable(matrix.Rows, func(i, j int) bool { return matrix.Rows[i].Node < matrix.Rows[j].Node })
+	return matrix
+}
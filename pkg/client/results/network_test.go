@@ -0,0 +1,64 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+)
+
+func TestConnectivityMatrix(t *testing.T) {
+	archive := makeArchive(t, []archiveFile{
+		{"plugins/network_connectivity/results/node2/network-connectivity/connectivity.json", `{"node": "node2", "checks": [
+			{"kind": "pod", "target": "node1", "address": "10.0.1.5:8080", "error": "timeout"},
+			{"kind": "pod", "target": "node2", "address": "10.0.2.5:8080"},
+			{"kind": "service", "target": "sonobuoy-network-target", "address": "10.96.0.20:8080"},
+			{"kind": "dns", "target": "kubernetes.default.svc", "address": "kubernetes.default.svc"},
+			{"kind": "dns", "target": "sonobuoy-network-target.sonobuoy.svc", "address": "sonobuoy-network-target.sonobuoy.svc", "error": "no such host"},
+			{"kind": "node-port", "target": "node1", "address": "192.168.0.1:30080", "error": "connection refused"},
+			{"kind": "node-port", "target": "node2", "address": "192.168.0.2:30080"}
+		]}`},
+		{"plugins/network_connectivity/results/node2/network-connectivity/junit.xml", `<testsuite name="network-connectivity node2"></testsuite>`},
+		{"plugins/network_connectivity/results/node1/network-connectivity/connectivity.json", `{"node": "node1", "error": "targets weren't ready", "checks": []}`},
+	})
+
+	reports, err := results.NewReaderWithVersion(archive, results.VersionTen).ConnectivityReports()
+	if err != nil {
+		t.Fatalf("unexpected error reading connectivity reports: %v", err)
+	}
+	if len(reports) != 2 || reports[0].Node != "node1" || reports[1].Node != "node2" {
+		t.Fatalf("expected reports from node1 and node2, got %+v", reports)
+	}
+
+	expected := &results.ConnectivityMatrix{
+		Nodes: []string{"node1", "node2"},
+		Rows: []results.ConnectivityRow{
+			{Node: "node1", Error: "targets weren't ready", Nodes: map[string][]string{}},
+			{
+				Node:    "node2",
+				Nodes:   map[string][]string{"node1": {"pod", "node-port"}, "node2": nil},
+				Service: results.CheckOutcomes{Checks: 1},
+				DNS:     results.CheckOutcomes{Checks: 2, Failed: 1},
+			},
+		},
+	}
+	if matrix := results.NewConnectivityMatrix(reports); !reflect.DeepEqual(matrix, expected) {
+		t.Errorf("expected connectivity matrix %+v, got %+v", expected, matrix)
+	}
+}
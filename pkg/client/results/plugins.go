@@ -0,0 +1,114 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	resultsDir = "results"
+	errorsDir  = "errors"
+)
+
+// pluginResults collects everything in the archive for a single plugin.
+type pluginResults struct {
+	// junit holds the suites from any JUnit XML files the plugin produced.
+	junit []JUnitTestSuite
+	// sarif holds the runs from any SARIF files the plugin produced.
+	sarif []json.RawMessage
+	// results is the set of results reported: node names, or file names for
+	// global plugins.
+	results map[string]bool
+	// errors maps each errored result to the error reported for it.
+	errors map[string]string
+}
+
+// pluginSet collects the results of each plugin, by name, while walking an
+// archive.
+type pluginSet map[string]*pluginResults
+
+// readPluginResults walks the archive and collects the results of each plugin,
+// returning them along with the sorted plugin names.
+func (r *Reader) readPluginResults() (map[string]*pluginResults, []string, error) {
+	plugins := pluginSet{}
+	if err := r.walkArchive(plugins.collect); err != nil {
+		return nil, nil, err
+	}
+	return plugins, plugins.names(), nil
+}
+
+// collect adds the file at filePath to the results of its plugin, if it's
+// one of the plugins' results or errors.
+func (s pluginSet) collect(filePath string, info os.FileInfo) error {
+	parts := strings.Split(filePath, "/")
+	// plugins/<plugin>/<results|errors>/<name>[/...]
+	if len(parts) < 4 || parts[0]+"/" != PluginsDir || strings.HasPrefix(path.Base(filePath), ".") {
+		return nil
+	}
+	name, dir, entry := parts[1], parts[2], parts[3]
+	p, ok := s[name]
+	if !ok {
+		p = &pluginResults{results: map[string]bool{}, errors: map[string]string{}}
+		s[name] = p
+	}
+
+	switch dir {
+	case resultsDir:
+		if path.Ext(filePath) == ".xml" {
+			suites, err := readJUnitSuites(info.Sys().(io.Reader))
+			if err != nil {
+				return errors.Wrapf(err, "couldn't read JUnit results %v", filePath)
+			}
+			p.junit = append(p.junit, suites...)
+			return nil
+		}
+		if path.Ext(filePath) == ".sarif" {
+			runs, err := readSARIFRuns(info.Sys().(io.Reader))
+			if err != nil {
+				return errors.Wrapf(err, "couldn't read SARIF results %v", filePath)
+			}
+			p.sarif = append(p.sarif, runs...)
+		}
+		p.results[entry] = true
+	case errorsDir:
+		buf := bytes.Buffer{}
+		if _, err := io.Copy(&buf, info.Sys().(io.Reader)); err != nil {
+			return errors.Wrapf(err, "couldn't read error %v", filePath)
+		}
+		p.errors[entry] = buf.String()
+	}
+	return nil
+}
+
+// names returns the sorted names of the plugins.
+func (s pluginSet) names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
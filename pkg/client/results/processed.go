@@ -0,0 +1,173 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/pkg/errors"
+)
+
+// SuiteCounts counts the tests and failures of a test suite.
+type SuiteCounts struct {
+	Name     string
+	Tests    int
+	Failures int
+}
+
+// ControlCounts counts the checks of a CIS benchmark control that passed,
+// warned and failed.
+type ControlCounts struct {
+	// Plugin is the result type of the plugin that ran the benchmark.
+	Plugin string
+	ID     string
+	Text   string
+	Pass   int
+	Warn   int
+	Fail   int
+}
+
+// TestCounts counts the tests and failures of each test suite in the
+// archive's JUnitReport. Where the aggregator summarized every one of a
+// plugin's results with the junit-summary result processor, its summaries are
+// used instead of the plugin's JUnit files.
+func (r *Reader) TestCounts() ([]SuiteCounts, error) {
+	plugins := pluginSet{}
+	var index *aggregation.ResultsIndex
+	err := r.walkArchive(func(filePath string, info os.FileInfo) error {
+		if filePath == r.ResultsIndexFile() {
+			index = &aggregation.ResultsIndex{}
+			return errors.Wrap(json.NewDecoder(info.Sys().(io.Reader)).Decode(index), "couldn't decode results index")
+		}
+		return plugins.collect(filePath, info)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := map[string][]aggregation.JUnitSuiteSummary{}
+	if index != nil {
+		for _, p := range index.Plugins {
+			if suites, ok := junitSummaries(p); ok {
+				summaries[p.ResultType] = suites
+			}
+		}
+	}
+
+	var counts []SuiteCounts
+	for _, name := range plugins.names() {
+		suites, ok := summaries[name]
+		if !ok {
+			for _, suite := range plugins[name].suites(name) {
+				counts = append(counts, SuiteCounts{Name: suite.Name, Tests: suite.Tests, Failures: suite.Failures})
+			}
+			continue
+		}
+
+		for _, suite := range suites {
+			if suite.Name == "" {
+				suite.Name = name
+			}
+			counts = append(counts, SuiteCounts{Name: suite.Name, Tests: suite.Tests, Failures: suite.Failures})
+		}
+		// Errors are reported as failed test cases, as in JUnitReport.
+		if errs := len(plugins[name].errors); errs > 0 {
+			counts = append(counts, SuiteCounts{Name: name, Tests: errs, Failures: errs})
+		}
+	}
+	return counts, nil
+}
+
+// junitSummaries returns the suites the junit-summary processor found in a
+// plugin's results, if it was run on all of those that didn't fail and found
+// any.
+func junitSummaries(p aggregation.PluginIndex) ([]aggregation.JUnitSuiteSummary, bool) {
+	var suites []aggregation.JUnitSuiteSummary
+	for _, result := range p.Results {
+		if result.Error != "" {
+			continue
+		}
+		processed, ok := result.Processed[aggregation.JUnitSummaryProcessor]
+		if !ok {
+			return nil, false
+		}
+		summary := aggregation.JUnitSummary{}
+		if err := json.Unmarshal(processed, &summary); err != nil {
+			// The processor failed on this result.
+			return nil, false
+		}
+		suites = append(suites, summary.Suites...)
+	}
+	return suites, len(suites) > 0
+}
+
+// BenchmarkCounts counts the checks of each benchmark control that the
+// kube-bench-summary result processor found in the archive's plugin results,
+// over all nodes, by plugin and then control ID. Archives without results
+// summarized that way have none.
+func (r *Reader) BenchmarkCounts() ([]ControlCounts, error) {
+	var index aggregation.ResultsIndex
+	err := r.walkArchive(func(filePath string, info os.FileInfo) error {
+		return ExtractFileIntoStruct(r.ResultsIndexFile(), filePath, info, &index)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []ControlCounts
+	for _, p := range index.Plugins {
+		byID := map[string]*ControlCounts{}
+		var controls []*ControlCounts
+		for _, result := range p.Results {
+			processed, ok := result.Processed[aggregation.KubeBenchSummaryProcessor]
+			if !ok || result.Error != "" {
+				continue
+			}
+			summary := aggregation.KubeBenchSummary{}
+			if err := json.Unmarshal(processed, &summary); err != nil {
+				// The processor failed on this result.
+				continue
+			}
+			for _, control := range summary.Controls {
+				c, ok := byID[control.ID]
+				if !ok {
+					c = &ControlCounts{Plugin: p.ResultType, ID: control.ID, Text: control.Text}
+					byID[control.ID] = c
+					controls = append(controls, c)
+				}
+				c.Pass += control.Pass
+				c.Warn += control.Warn
+				c.Fail += control.Fail
+			}
+		}
+		// Control IDs are numbers, so shorter ones come first.
+		sort.SliceStable(controls, func(i, j int) bool {
+			if len(controls[i].ID) != len(controls[j].ID) {
+				return len(controls[i].ID) < len(controls[j].ID)
+			}
+			return controls[i].ID < controls[j].ID
+		})
+		for _, c := range controls {
+			counts = append(counts, *c)
+		}
+	}
+	return counts, nil
+}
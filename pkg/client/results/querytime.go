@@ -0,0 +1,125 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// QueryTime is a query of the cluster made during a run, as recorded in
+// meta/query-time.json.
+type QueryTime struct {
+	Name      string
+	Namespace string
+	Duration  time.Duration
+	// APICalls is the number of requests the query made, or zero if the run
+	// didn't count them.
+	APICalls int64
+	Failed   bool
+}
+
+// queryData is how a query is recorded in meta/query-time.json.
+type queryData struct {
+	QueryObj    string          `json:"queryobj"`
+	Namespace   string          `json:"namespace"`
+	ElapsedTime string          `json:"time"`
+	APICalls    int64           `json:"apicalls"`
+	Error       json.RawMessage `json:"error"`
+}
+
+// QueryTimes reads the queries made of the cluster, in the order they were
+// made.
+func (r *Reader) QueryTimes() ([]QueryTime, error) {
+	var recorded []queryData
+	var found bool
+	err := r.WalkFiles(func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath == r.QueryTimeFile() {
+			found = true
+		}
+		return ExtractFileIntoStruct(r.QueryTimeFile(), filePath, info, &recorded)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't walk archive")
+	}
+	if !found {
+		return nil, errors.Errorf("archive has no %v", r.QueryTimeFile())
+	}
+
+	times := make([]QueryTime, len(recorded))
+	for i, q := range recorded {
+		duration, err := time.ParseDuration(q.ElapsedTime)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't parse time of query %v", q.QueryObj)
+		}
+		times[i] = QueryTime{
+			Name:      q.QueryObj,
+			Namespace: q.Namespace,
+			Duration:  duration,
+			APICalls:  q.APICalls,
+			Failed:    len(q.Error) > 0 && string(q.Error) != "null",
+		}
+	}
+	return times, nil
+}
+
+// QueryStats totals the queries of one resource across namespaces.
+type QueryStats struct {
+	Name     string
+	Queries  int
+	Duration time.Duration
+	APICalls int64
+	Failures int
+}
+
+// SummarizeQueryTimes totals the queries of each resource, slowest first, to
+// show which dominate the time a run spends querying.
+func SummarizeQueryTimes(times []QueryTime) []QueryStats {
+	byName := map[string]*QueryStats{}
+	for _, t := range times {
+		stats, ok := byName[t.Name]
+		if !ok {
+			stats = &QueryStats{Name: t.Name}
+			byName[t.Name] = stats
+		}
+		stats.Queries++
+		stats.Duration += t.Duration
+		stats.APICalls += t.APICalls
+		if t.Failed {
+			stats.Failures++
+		}
+	}
+
+	summary := make([]QueryStats, 0, len(byName))
+	for _, stats := range byName {
+		summary = append(summary, *stats)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Duration != summary[j].Duration {
+			return summary[i].Duration > summary[j].Duration
+		}
+		return summary[i].Name < summary[j].Name
+	})
+	return summary
+}
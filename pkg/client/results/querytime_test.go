@@ -0,0 +1,60 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+)
+
+func TestQueryTimes(t *testing.T) {
+	archive := makeArchive(t, []archiveFile{
+		{"meta/query-time.json", `[
+			{"queryobj": "Pods", "namespace": "default", "time": "1.5s", "apicalls": 2},
+			{"queryobj": "Pods", "namespace": "kube-system", "time": "500ms", "apicalls": 1, "error": {}},
+			{"queryobj": "PodLogs", "namespace": "default", "time": "3s", "apicalls": 12},
+			{"queryobj": "serverversion", "time": "10ms"}
+		]`},
+	})
+
+	times, err := results.NewReaderWithVersion(archive, results.VersionTen).QueryTimes()
+	if err != nil {
+		t.Fatalf("unexpected error reading query times: %v", err)
+	}
+	if len(times) != 4 || !times[1].Failed || times[0].Failed || times[0].Duration != 1500*time.Millisecond {
+		t.Fatalf("unexpected query times %+v", times)
+	}
+
+	expected := []results.QueryStats{
+		{Name: "PodLogs", Queries: 1, Duration: 3 * time.Second, APICalls: 12},
+		{Name: "Pods", Queries: 2, Duration: 2 * time.Second, APICalls: 3, Failures: 1},
+		{Name: "serverversion", Queries: 1, Duration: 10 * time.Millisecond},
+	}
+	if stats := results.SummarizeQueryTimes(times); !reflect.DeepEqual(stats, expected) {
+		t.Errorf("expected query stats %+v, got %+v", expected, stats)
+	}
+}
+
+func TestQueryTimes_missing(t *testing.T) {
+	archive := makeArchive(t, []archiveFile{{"meta/config.json", "{}"}})
+	if _, err := results.NewReaderWithVersion(archive, results.VersionTen).QueryTimes(); err == nil {
+		t.Error("expected an error for an archive without query times, got none")
+	}
+}
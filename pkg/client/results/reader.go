@@ -28,6 +28,8 @@ import (
 	"strings"
 
 	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/discovery"
+	"github.com/heptio/sonobuoy/pkg/encryption"
 	"github.com/pkg/errors"
 )
 
@@ -44,6 +46,8 @@ const (
 	defaultNodesFile          = "Nodes.json"
 	defaultServerVersionFile  = "serverversion.json"
 	defaultServerGroupsFile   = "servergroups.json"
+	defaultResultsIndexFile   = "meta/results.json"
+	defaultQueryTimeFile      = "meta/query-time.json"
 )
 
 const (
@@ -75,6 +79,9 @@ func NewReaderWithVersion(reader io.Reader, version string) *Reader {
 // NewReaderFromBytes is a helper constructor that will discover the version of the archive
 // and return a new Reader with the correct version already populated.
 func NewReaderFromBytes(data []byte) (*Reader, error) {
+	if bytes.HasPrefix(data, []byte(encryption.Magic)) {
+		return nil, errors.New("the archive is encrypted, decrypt it with sonobuoy decrypt first")
+	}
 	r := bytes.NewReader(data)
 	gzipReader, err := gzip.NewReader(r)
 	if err != nil {
@@ -161,6 +168,24 @@ func (r *Reader) WalkFiles(walkfn filepath.WalkFunc) error {
 	return nil
 }
 
+// walkArchive calls fn for each file in the archive, skipping directories. As
+// WalkFiles doesn't stop on errors from the walk function, it skips the rest
+// of the archive itself once fn returns one, and returns that.
+func (r *Reader) walkArchive(fn func(filePath string, info os.FileInfo) error) error {
+	var walkErr error
+	err := r.WalkFiles(func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || walkErr != nil || info.IsDir() {
+			return err
+		}
+		walkErr = fn(filePath, info)
+		return walkErr
+	})
+	if err == nil {
+		err = walkErr
+	}
+	return errors.Wrap(err, "couldn't walk archive")
+}
+
 // Functions to be used within a walkfn.
 
 // ExtractBytes pulls out bytes into a buffer for any path matching file.
@@ -260,6 +285,24 @@ func (r *Reader) NodesFile() string {
 	return filepath.Join(r.NonNamespacedResources(), defaultNodesFile)
 }
 
+// ResultsIndexFile returns the path to the index of the plugin results, if the
+// archive has one.
+func (r *Reader) ResultsIndexFile() string {
+	return defaultResultsIndexFile
+}
+
+// QueryTimeFile returns the path to the record of how long each query of the
+// cluster took.
+func (r *Reader) QueryTimeFile() string {
+	return defaultQueryTimeFile
+}
+
+// ClusterInfoFile returns the path to the record of the versions and platform
+// of the cluster, if the archive has one.
+func (r *Reader) ClusterInfoFile() string {
+	return metadataDir + discovery.ClusterInfoFile
+}
+
 // ServerGroupsFile returns the path to the groups the Kubernetes API supported at the time of the run.
 func (r *Reader) ServerGroupsFile() string {
 	return defaultServerGroupsFile
@@ -0,0 +1,168 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SARIFVersion is the version of the SARIF format written by SARIFReport.
+	SARIFVersion = "2.1.0"
+	// SARIFSchema is the JSON schema for SARIFVersion.
+	SARIFSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// SARIFLog is the root object of a SARIF report, as consumed by GitHub code
+// scanning and other static analysis tooling. Runs are kept as raw JSON so
+// that runs produced by the plugins themselves are passed through untouched.
+type SARIFLog struct {
+	Version string            `json:"version"`
+	Schema  string            `json:"$schema"`
+	Runs    []json.RawMessage `json:"runs"`
+}
+
+// SARIFRun is a run of a single tool, which for Sonobuoy is a plugin.
+type SARIFRun struct {
+	Tool    SARIFTool     `json:"tool"`
+	Results []SARIFResult `json:"results"`
+}
+
+// SARIFTool describes the tool that produced a run.
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+// SARIFDriver is the component of a tool that produced the results, along
+// with the rules its results refer to.
+type SARIFDriver struct {
+	Name  string      `json:"name"`
+	Rules []SARIFRule `json:"rules,omitempty"`
+}
+
+// SARIFRule is a check whose failures are reported as results.
+type SARIFRule struct {
+	ID string `json:"id"`
+}
+
+// SARIFResult is a single finding.
+type SARIFResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   SARIFMessage    `json:"message"`
+	Locations []SARIFLocation `json:"locations,omitempty"`
+}
+
+// SARIFMessage is the human readable description of a result.
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+// SARIFLocation is where a result was found. Findings about a cluster don't
+// point at source files, so only logical locations (plugin and node) are used.
+type SARIFLocation struct {
+	LogicalLocations []SARIFLogicalLocation `json:"logicalLocations"`
+}
+
+// SARIFLogicalLocation names a location that isn't a file.
+type SARIFLogicalLocation struct {
+	Name string `json:"name"`
+}
+
+// SARIFReport builds a SARIF log from the plugin results in the archive.
+// Plugins that produced SARIF themselves (such as trivy) contribute their own
+// runs unchanged. Every other plugin gets a run whose results are the failed
+// test cases of its JUnit report (see JUnitReport), so checks reported as
+// JUnit (such as kube-bench) and plugin errors both show up as findings.
+func (r *Reader) SARIFReport() (*SARIFLog, error) {
+	plugins, names, err := r.readPluginResults()
+	if err != nil {
+		return nil, err
+	}
+
+	log := &SARIFLog{Version: SARIFVersion, Schema: SARIFSchema, Runs: []json.RawMessage{}}
+	for _, name := range names {
+		p := plugins[name]
+		log.Runs = append(log.Runs, p.sarif...)
+
+		run := sarifRun(name, p.suites(name))
+		// A plugin with its own SARIF output only needs another run if
+		// something went wrong that its output couldn't have reported.
+		if len(p.sarif) > 0 && len(run.Results) == 0 {
+			continue
+		}
+		data, err := json.Marshal(run)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't encode SARIF run for plugin %v", name)
+		}
+		log.Runs = append(log.Runs, data)
+	}
+	return log, nil
+}
+
+// sarifRun converts the failed test cases of a plugin's suites into a run.
+func sarifRun(plugin string, suites []JUnitTestSuite) SARIFRun {
+	run := SARIFRun{
+		Tool:    SARIFTool{Driver: SARIFDriver{Name: plugin}},
+		Results: []SARIFResult{},
+	}
+	rules := map[string]bool{}
+	for _, suite := range suites {
+		for _, tc := range suite.TestCases {
+			if !Failed(tc) {
+				continue
+			}
+			ruleID, location := tc.Name, tc.ClassName
+			// Test cases synthesized from a plugin's results are named after
+			// the node (or file) they are about, so the plugin itself is the
+			// rule and the node is where it failed.
+			if tc.ClassName == plugin {
+				ruleID, location = plugin, tc.Name
+			}
+			if !rules[ruleID] {
+				rules[ruleID] = true
+				run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, SARIFRule{ID: ruleID})
+			}
+
+			message := tc.FailureMessage.Message
+			if message == "" {
+				message = tc.Name
+			}
+			run.Results = append(run.Results, SARIFResult{
+				RuleID:  ruleID,
+				Level:   "error",
+				Message: SARIFMessage{Text: message},
+				Locations: []SARIFLocation{{
+					LogicalLocations: []SARIFLogicalLocation{{Name: location}},
+				}},
+			})
+		}
+	}
+	return run
+}
+
+// readSARIFRuns decodes a SARIF file and returns its runs.
+func readSARIFRuns(r io.Reader) ([]json.RawMessage, error) {
+	log := SARIFLog{}
+	if err := json.NewDecoder(r).Decode(&log); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return log.Runs, nil
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package results_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+)
+
+func TestSARIFReport(t *testing.T) {
+	buf := makeArchive(t, []archiveFile{
+		{"plugins/kube-bench/results/junit.xml", `<testsuite name="CIS" tests="2" failures="1">
+  <testcase name="1.1.1 Ensure anonymous-auth is disabled" classname="master"><failure type="">anonymous-auth is true</failure></testcase>
+  <testcase name="1.1.2 Ensure basic-auth-file is not set" classname="master"></testcase>
+</testsuite>`},
+		{"plugins/trivy/results/report.sarif", `{"version":"2.1.0","runs":[{"tool":{"driver":{"name":"Trivy"}},"results":[{"ruleId":"CVE-2018-1002105"}]}]}`},
+		{"plugins/systemd_logs/results/node1", "logs"},
+		{"plugins/systemd_logs/errors/node2", `{"error":"timeout"}`},
+	})
+
+	log, err := results.NewReaderWithVersion(buf, results.VersionTen).SARIFReport()
+	if err != nil {
+		t.Fatalf("unexpected error building report: %v", err)
+	}
+	if log.Version != results.SARIFVersion {
+		t.Errorf("expected version %v, got %v", results.SARIFVersion, log.Version)
+	}
+	if len(log.Runs) != 3 {
+		t.Fatalf("expected 3 runs, got %v", len(log.Runs))
+	}
+
+	testCases := []struct {
+		name     string
+		driver   string
+		ruleIDs  []string
+		location string
+	}{
+		{"kube-bench failed checks", "kube-bench", []string{"1.1.1 Ensure anonymous-auth is disabled"}, "master"},
+		{"systemd_logs errors", "systemd_logs", []string{"systemd_logs"}, "node2"},
+		{"trivy passed through", "Trivy", []string{"CVE-2018-1002105"}, ""},
+	}
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run := results.SARIFRun{}
+			if err := json.Unmarshal(log.Runs[i], &run); err != nil {
+				t.Fatalf("couldn't decode run: %v", err)
+			}
+			if run.Tool.Driver.Name != tc.driver {
+				t.Errorf("expected driver %v, got %v", tc.driver, run.Tool.Driver.Name)
+			}
+			if len(run.Results) != len(tc.ruleIDs) {
+				t.Fatalf("expected %v results, got %v", len(tc.ruleIDs), len(run.Results))
+			}
+			for j, result := range run.Results {
+				if result.RuleID != tc.ruleIDs[j] {
+					t.Errorf("expected rule %v, got %v", tc.ruleIDs[j], result.RuleID)
+				}
+				if tc.location != "" && result.Locations[0].LogicalLocations[0].Name != tc.location {
+					t.Errorf("expected location %v, got %v", tc.location, result.Locations[0].LogicalLocations[0].Name)
+				}
+			}
+		})
+	}
+}
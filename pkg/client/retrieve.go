@@ -20,6 +20,7 @@ import (
 	"archive/tar"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
@@ -35,47 +36,91 @@ import (
 )
 
 func (c *SonobuoyClient) RetrieveResults(cfg *RetrieveConfig) (io.Reader, error) {
+	reader, writer := io.Pipe()
+	go func(writer *io.PipeWriter) {
+		defer writer.Close()
+		err := c.execInMaster(cfg.Namespace, []string{"tar", "cf", "-", config.MasterResultsPath}, writer)
+		if err != nil {
+			// Since this function returns an io.Reader to the consumer and does
+			// not buffer the entire (potentially large) output, RetrieveResults
+			// has to return the reader first to be read from. This means we
+			// either lose this error (easy) or provide a significantly more
+			// complex error mechanism for the consumer (hard).
+			logrus.Error(err)
+			return
+		}
+		if err := c.markRetrieved(cfg.Namespace); err != nil {
+			logrus.Error(err)
+		}
+	}(writer)
+
+	return reader, nil
+}
+
+// latestTarballScript prints the newest results tarball in the results
+// directory. Tarballs are named after the time their run started, so the last
+// one in order is the newest.
+var latestTarballScript = fmt.Sprintf(
+	`tarball=$(ls -1 %s/*.tar.gz 2>/dev/null | tail -n 1); [ -n "$tarball" ] || { echo "no results tarball found" >&2; exit 1; }; cat "$tarball"`,
+	config.MasterResultsPath,
+)
+
+// StreamResults writes the results tarball of a sonobuoy run to w as it's
+// copied out of the aggregator, without writing anything to disk.
+func (c *SonobuoyClient) StreamResults(cfg *RetrieveConfig, w io.Writer) error {
+	if err := c.execInMaster(cfg.Namespace, []string{"/bin/sh", "-c", latestTarballScript}, w); err != nil {
+		return errors.Wrap(err, "couldn't stream results tarball")
+	}
+	return c.markRetrieved(cfg.Namespace)
+}
+
+// markRetrieved tells the aggregator its results have been retrieved, so a
+// run that's deleted on completion can be deleted without waiting any longer.
+func (c *SonobuoyClient) markRetrieved(namespace string) error {
+	marker := path.Join(config.MasterResultsPath, config.RetrievedMarker)
+	err := c.execInMaster(namespace, []string{"touch", marker}, ioutil.Discard)
+	return errors.Wrap(err, "couldn't mark results as retrieved")
+}
+
+// execInMaster runs command in the aggregator container, writing its output to
+// stdout.
+func (c *SonobuoyClient) execInMaster(namespace string, command []string, stdout io.Writer) error {
+	return c.execInContainer(namespace, config.MasterContainerName, command, nil, stdout)
+}
+
+// execInContainer runs command in the named container of the aggregator's pod,
+// reading its input from stdin, if it isn't nil, and writing its output to
+// stdout.
+func (c *SonobuoyClient) execInContainer(namespace, container string, command []string, stdin io.Reader, stdout io.Writer) error {
 	client, err := c.Client()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	restClient := client.CoreV1().RESTClient()
 	req := restClient.Post().
 		Resource("pods").
 		Name(config.MasterPodName).
-		Namespace(cfg.Namespace).
+		Namespace(namespace).
 		SubResource("exec").
-		Param("container", config.MasterContainerName)
+		Param("container", container)
 	req.VersionedParams(&corev1.PodExecOptions{
-		Container: config.MasterContainerName,
-		Command:   []string{"tar", "cf", "-", config.MasterResultsPath},
-		Stdin:     false,
+		Container: container,
+		Command:   command,
+		Stdin:     stdin != nil,
 		Stdout:    true,
 		Stderr:    true,
 	}, scheme.ParameterCodec)
 	executor, err := remotecommand.NewSPDYExecutor(c.RestConfig, "POST", req.URL())
 	if err != nil {
-		return nil, err
+		return err
 	}
-	reader, writer := io.Pipe()
-	go func(writer *io.PipeWriter) {
-		defer writer.Close()
-		err = executor.Stream(remotecommand.StreamOptions{
-			Stdout: writer,
-			Stderr: os.Stderr,
-			Tty:    false,
-		})
-		if err != nil {
-			// Since this function returns an io.Reader to the consumer and does
-			// not buffer the entire (potentially large) output, RetrieveResults
-			// has to return the reader first to be read from. This means we
-			// either lose this error (easy) or provide a significantly more
-			// complex error mechanism for the consumer (hard).
-			logrus.Error(err)
-		}
-	}(writer)
 
-	return reader, nil
+	return executor.Stream(remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: os.Stderr,
+		Tty:    false,
+	})
 }
 
 /** Everything below this marker has been copy/pasta'd from k8s/k8s. The only modification is exporting UntarAll **/
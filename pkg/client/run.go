@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"io"
 
+	version "github.com/hashicorp/go-version"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	kubeerror "k8s.io/apimachinery/pkg/api/errors"
@@ -37,12 +38,34 @@ import (
 
 const bufferSize = 4096
 
+// createFunc creates an object of a run, or pretends to.
+type createFunc func(dynamic.ClientPool, *unstructured.Unstructured, meta.RESTMapper) error
+
+// minimumDryRunVersion is the first version of Kubernetes with server-side
+// dry-run enabled by default. Older API servers ignore the dryRun parameter
+// and would create the objects.
+var minimumDryRunVersion = version.Must(version.NewVersion("1.13.0"))
+
 func (c *SonobuoyClient) Run(cfg *RunConfig) error {
-	manifest, err := c.GenerateManifest(&cfg.GenConfig)
+	manifest, shipped, err := c.generateManifest(&cfg.GenConfig, true)
 	if err != nil {
 		return errors.Wrap(err, "couldn't run invalid manifest")
 	}
 
+	create := createObject
+	if cfg.DryRun {
+		serverDryRun, err := c.supportsDryRun()
+		if err != nil {
+			return err
+		}
+		if !serverDryRun {
+			logrus.Warningf("The API server doesn't support dry-run (added in Kubernetes %v), only checking that it serves every resource", minimumDryRunVersion)
+			create = checkObject
+		} else {
+			create = dryRunObject(c.RestConfig)
+		}
+	}
+
 	buf := bytes.NewBuffer(manifest)
 
 	mapper, err := newMapper(c.RestConfig)
@@ -72,14 +95,41 @@ func (c *SonobuoyClient) Run(cfg *RunConfig) error {
 			return errors.Wrap(err, "couldn't decode template")
 		}
 
-		err := createObject(c.DynamicClientPool(), &obj, mapper)
+		err := create(c.DynamicClientPool(), &obj, mapper)
 		if err != nil {
 			return errors.Wrap(err, "failed to create object")
 		}
 	}
+
+	if cfg.DryRun && cfg.Out != nil {
+		if _, err := cfg.Out.Write(manifest); err != nil {
+			return errors.Wrap(err, "couldn't write manifest")
+		}
+	}
+	if len(shipped) > 0 && !cfg.DryRun {
+		return c.shipPlugins(cfg.Config.Namespace, shipped)
+	}
 	return nil
 }
 
+// supportsDryRun reports whether the API server can validate objects
+// without persisting them.
+func (c *SonobuoyClient) supportsDryRun() (bool, error) {
+	client, err := c.Client()
+	if err != nil {
+		return false, err
+	}
+	versionInfo, err := client.Discovery().ServerVersion()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to retrieve server version")
+	}
+	serverVersion, err := version.NewVersion(versionInfo.String())
+	if err != nil {
+		return false, errors.Wrap(err, "couldn't parse version string")
+	}
+	return !serverVersion.LessThan(minimumDryRunVersion), nil
+}
+
 func createObject(pool dynamic.ClientPool, obj *unstructured.Unstructured, mapper meta.RESTMapper) error {
 	client, err := pool.ClientForGroupVersionKind(obj.GroupVersionKind())
 	if err != nil {
@@ -126,6 +176,72 @@ func createObject(pool dynamic.ClientPool, obj *unstructured.Unstructured, mappe
 	return nil
 }
 
+// dryRunObject returns a createFunc that sends each object to the API server
+// with server-side dry-run, so it's validated and admitted but not persisted.
+// The dynamic client can't pass the dryRun parameter, so a REST client is
+// built for each object's group and version instead.
+func dryRunObject(cfg *rest.Config) createFunc {
+	return func(_ dynamic.ClientPool, obj *unstructured.Unstructured, mapper meta.RESTMapper) error {
+		gvk := obj.GroupVersionKind()
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return errors.Wrap(err, "could not get resource for object")
+		}
+		name, namespace, err := getNames(obj)
+		if err != nil {
+			return errors.Wrap(err, "couldn't retrive object metadata")
+		}
+
+		conf := *cfg
+		conf.ContentConfig = dynamic.ContentConfig()
+		gv := gvk.GroupVersion()
+		conf.GroupVersion = &gv
+		conf.APIPath = dynamic.LegacyAPIPathResolverFunc(gvk)
+		client, err := rest.RESTClientFor(&conf)
+		if err != nil {
+			return errors.Wrap(err, "could not make kubernetes client")
+		}
+
+		err = client.Post().
+			NamespaceIfScoped(namespace, namespace != "").
+			Resource(mapping.Resource).
+			Param("dryRun", "All").
+			Body(obj).
+			Do().
+			Error()
+
+		log := logrus.WithFields(logrus.Fields{
+			"name":      name,
+			"namespace": namespace,
+			"resource":  mapping.Resource,
+		})
+
+		switch {
+		case err == nil:
+			log.Info("validated object")
+		case namespace == "" && kubeerror.IsAlreadyExists(err):
+			log.Info("object already exists")
+		// Nothing is created in a dry run, including the run's namespace, so
+		// objects in a new namespace can't be validated.
+		case namespace != "" && kubeerror.IsNotFound(err):
+			log.Warning("namespace doesn't exist yet, couldn't validate object")
+		case err != nil:
+			return errors.Wrapf(err, "API server rejected %s", name)
+		}
+		return nil
+	}
+}
+
+// checkObject only checks that the API server serves the object's resource,
+// for API servers without dry-run.
+func checkObject(_ dynamic.ClientPool, obj *unstructured.Unstructured, mapper meta.RESTMapper) error {
+	gvk := obj.GroupVersionKind()
+	if _, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		return errors.Wrapf(err, "API server doesn't serve %v", gvk)
+	}
+	return nil
+}
+
 func newMapper(cfg *rest.Config) (meta.RESTMapper, error) {
 	client, err := discovery.NewDiscoveryClientForConfig(cfg)
 	if err != nil {
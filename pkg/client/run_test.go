@@ -0,0 +1,141 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	"k8s.io/client-go/rest"
+)
+
+// fakeAPIServer serves just enough of the Kubernetes API for Run, recording
+// the objects posted to it.
+type fakeAPIServer struct {
+	minorVersion string
+
+	sync.Mutex
+	posts []string
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resources := func(groupVersion string, names ...string) interface{} {
+		list := []map[string]interface{}{}
+		for _, name := range names {
+			parts := strings.SplitN(name, "/", 2)
+			list = append(list, map[string]interface{}{
+				"name":       parts[0],
+				"kind":       parts[1],
+				"namespaced": parts[0] != "namespaces" && !strings.HasPrefix(parts[0], "cluster"),
+				"verbs":      []string{"create", "get"},
+			})
+		}
+		return map[string]interface{}{"kind": "APIResourceList", "groupVersion": groupVersion, "resources": list}
+	}
+
+	var body interface{}
+	switch {
+	case r.Method == http.MethodPost:
+		f.Lock()
+		f.posts = append(f.posts, r.URL.Path+"?"+r.URL.RawQuery)
+		f.Unlock()
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(b)
+		return
+	case r.URL.Path == "/version":
+		body = map[string]string{"major": "1", "minor": f.minorVersion, "gitVersion": fmt.Sprintf("v1.%v.0", f.minorVersion)}
+	case r.URL.Path == "/api":
+		body = map[string]interface{}{"kind": "APIVersions", "versions": []string{"v1"}}
+	case r.URL.Path == "/apis":
+		gv := map[string]string{"groupVersion": "rbac.authorization.k8s.io/v1", "version": "v1"}
+		body = map[string]interface{}{"kind": "APIGroupList", "groups": []interface{}{
+			map[string]interface{}{"name": "rbac.authorization.k8s.io", "versions": []interface{}{gv}, "preferredVersion": gv},
+		}}
+	case r.URL.Path == "/api/v1":
+		body = resources("v1", "namespaces/Namespace", "serviceaccounts/ServiceAccount", "configmaps/ConfigMap", "pods/Pod", "services/Service")
+	case r.URL.Path == "/apis/rbac.authorization.k8s.io/v1":
+		body = resources("rbac.authorization.k8s.io/v1", "clusterroles/ClusterRole", "clusterrolebindings/ClusterRoleBinding")
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestRun_dryRun(t *testing.T) {
+	testCases := []struct {
+		name          string
+		minorVersion  string
+		expectedPosts int
+	}{
+		{name: "server-side dry-run", minorVersion: "13", expectedPosts: 8},
+		{name: "no server-side dry-run", minorVersion: "11", expectedPosts: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiserver := &fakeAPIServer{minorVersion: tc.minorVersion}
+			server := httptest.NewServer(apiserver)
+			defer server.Close()
+
+			sbc, err := NewSonobuoyClient(&rest.Config{Host: server.URL})
+			if err != nil {
+				t.Fatalf("couldn't create client: %v", err)
+			}
+
+			var out bytes.Buffer
+			err = sbc.Run(&RunConfig{
+				GenConfig: GenConfig{
+					E2EConfig:       &E2EConfig{},
+					Config:          config.New(),
+					Image:           "gcr.io/heptio-images/sonobuoy:latest",
+					Namespace:       "heptio-sonobuoy",
+					EnableRBAC:      true,
+					ImagePullPolicy: "Always",
+				},
+				DryRun: true,
+				Out:    &out,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(apiserver.posts) != tc.expectedPosts {
+				t.Errorf("expected %v objects to be posted, got %v", tc.expectedPosts, apiserver.posts)
+			}
+			for _, post := range apiserver.posts {
+				if !strings.HasSuffix(post, "?dryRun=All") {
+					t.Errorf("expected a dry run, got %v", post)
+				}
+			}
+			if !strings.Contains(out.String(), "kind: Pod") {
+				t.Errorf("expected the manifest to be written, got %q", out.String())
+			}
+		})
+	}
+}
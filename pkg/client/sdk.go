@@ -0,0 +1,293 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/rest"
+
+	"github.com/heptio/sonobuoy/pkg/client/results"
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/image"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+)
+
+// defaultRetryInterval is how long SDK calls wait before trying again when
+// the status of a run can't be watched, unless WithRetryInterval says
+// otherwise.
+const defaultRetryInterval = 10 * time.Second
+
+// SDK is the stable interface for embedding Sonobuoy in other programs, such
+// as operators and controllers, rather than shelling out to the CLI. Each
+// call is customized with Options, and defaults to what the CLI does without
+// flags: a Conformance run in the default namespace, with RBAC enabled.
+//
+// Cancelling a call's context stops it waiting and making further requests,
+// and it returns the context's error. Requests already sent to the cluster
+// aren't interrupted.
+type SDK interface {
+	// Run starts a Sonobuoy run, without waiting for it.
+	Run(ctx context.Context, opts ...Option) error
+	// Status returns the status of the run, or with WithWait, its final
+	// status once it has finished.
+	Status(ctx context.Context, opts ...Option) (*aggregation.Status, error)
+	// Retrieve writes the results tarball of the run to w.
+	Retrieve(ctx context.Context, w io.Writer, opts ...Option) error
+	// Results retrieves the results tarball of the run and counts the tests
+	// run and failed by each suite in it.
+	Results(ctx context.Context, opts ...Option) ([]results.SuiteCounts, error)
+	// Delete removes the run and returns what was deleted.
+	Delete(ctx context.Context, opts ...Option) ([]DeletedResource, error)
+}
+
+// Option customizes an SDK call. Options are applied in order, and those that
+// don't apply to a call are ignored, so the same ones can be passed to every
+// call about a run.
+type Option func(*sdkOptions)
+
+// sdkOptions are what Options set, starting from the defaults.
+type sdkOptions struct {
+	run             RunConfig
+	wait            bool
+	retryInterval   time.Duration
+	deleteAll       bool
+	namespaceScoped bool
+}
+
+func newSDKOptions(opts []Option) *sdkOptions {
+	o := &sdkOptions{
+		run:           *NewRunConfig(),
+		retryInterval: defaultRetryInterval,
+	}
+	o.run.ImagePullPolicy = "Always"
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithNamespace sets the namespace the run is in.
+func WithNamespace(namespace string) Option {
+	return func(o *sdkOptions) { o.run.Namespace = namespace }
+}
+
+// WithMode selects the plugins and E2E tests of a mode, such as Quick.
+func WithMode(mode Mode) Option {
+	return func(o *sdkOptions) {
+		modeConfig := mode.Get()
+		if modeConfig == nil {
+			return
+		}
+		e2eConfig := modeConfig.E2EConfig
+		o.run.E2EConfig = &e2eConfig
+		o.run.Config.PluginSelections = modeConfig.Selectors
+	}
+}
+
+// WithE2EFocus sets the regular expression of the E2E tests to run.
+func WithE2EFocus(focus string) Option {
+	return func(o *sdkOptions) { o.run.E2EConfig.Focus = focus }
+}
+
+// WithE2ESkip sets the regular expression of the E2E tests to skip.
+func WithE2ESkip(skip string) Option {
+	return func(o *sdkOptions) { o.run.E2EConfig.Skip = skip }
+}
+
+// WithE2ERepoList sets the registries the E2E tests pull their own images
+// from.
+func WithE2ERepoList(list image.RepoList) Option {
+	return func(o *sdkOptions) { o.run.E2EConfig.RepoList = list }
+}
+
+// WithPlugins selects the plugins to run, by name.
+func WithPlugins(names ...string) Option {
+	return func(o *sdkOptions) {
+		o.run.Config.PluginSelections = make([]plugin.Selection, len(names))
+		for i, name := range names {
+			o.run.Config.PluginSelections[i] = plugin.Selection{Name: name}
+		}
+	}
+}
+
+// WithConfig runs with the given Sonobuoy config, including its plugin
+// selections, in place of the default one.
+func WithConfig(cfg *config.Config) Option {
+	return func(o *sdkOptions) { o.run.Config = cfg }
+}
+
+// WithImage sets the Sonobuoy image.
+func WithImage(image string) Option {
+	return func(o *sdkOptions) { o.run.Image = image }
+}
+
+// WithImagePullPolicy sets when the Sonobuoy image is pulled.
+func WithImagePullPolicy(policy string) Option {
+	return func(o *sdkOptions) { o.run.ImagePullPolicy = policy }
+}
+
+// WithRBAC sets whether the run's RBAC resources are created and deleted.
+func WithRBAC(enabled bool) Option {
+	return func(o *sdkOptions) { o.run.EnableRBAC = enabled }
+}
+
+// WithWait makes Status wait until the run has finished, and Delete until
+// everything it deleted is gone.
+func WithWait() Option {
+	return func(o *sdkOptions) { o.wait = true }
+}
+
+// WithRetryInterval sets how long Status waits before trying again when the
+// status of the run can't be watched.
+func WithRetryInterval(interval time.Duration) Option {
+	return func(o *sdkOptions) { o.retryInterval = interval }
+}
+
+// WithDeleteAll makes Delete remove every Sonobuoy run in the cluster, not
+// just the one in the namespace.
+func WithDeleteAll() Option {
+	return func(o *sdkOptions) { o.deleteAll = true }
+}
+
+// WithNamespaceScoped makes the run only use, and Delete only remove,
+// resources in its namespace, leaving the namespace itself in place.
+func WithNamespaceScoped() Option {
+	return func(o *sdkOptions) {
+		o.namespaceScoped = true
+		o.run.Config.NamespaceScoped = true
+	}
+}
+
+// SDKClient implements SDK on top of a SonobuoyClient.
+type SDKClient struct {
+	client *SonobuoyClient
+}
+
+// Make sure SDKClient implements the interface
+var _ SDK = &SDKClient{}
+
+// NewSDKClient creates a new SDKClient for the cluster of the given config.
+func NewSDKClient(restConfig *rest.Config) (*SDKClient, error) {
+	client, err := NewSonobuoyClient(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &SDKClient{client: client}, nil
+}
+
+// Run starts a Sonobuoy run, without waiting for it.
+func (s *SDKClient) Run(ctx context.Context, opts ...Option) error {
+	o := newSDKOptions(opts)
+	if errs := o.run.Config.Validate(); len(errs) > 0 {
+		return errors.Errorf("invalid configuration: %v", errs)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.client.Run(&o.run)
+}
+
+// Status returns the status of the run, or with WithWait, its final status
+// once it has finished.
+func (s *SDKClient) Status(ctx context.Context, opts ...Option) (*aggregation.Status, error) {
+	o := newSDKOptions(opts)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !o.wait {
+		return s.client.GetStatus(o.run.Namespace)
+	}
+
+	transitions, err := s.client.WatchRun(&WatchConfig{Namespace: o.run.Namespace, RetryInterval: o.retryInterval}, ctx.Done())
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for transition := range transitions {
+		if transition.To.Finished() {
+			return transition.Status, nil
+		}
+		lastErr = transition.Err
+	}
+	if lastErr != nil {
+		return nil, errors.Wrapf(lastErr, "stopped waiting for the run to finish (%v)", ctx.Err())
+	}
+	return nil, ctx.Err()
+}
+
+// Retrieve writes the results tarball of the run to w.
+func (s *SDKClient) Retrieve(ctx context.Context, w io.Writer, opts ...Option) error {
+	o := newSDKOptions(opts)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := s.client.StreamResults(&RetrieveConfig{Namespace: o.run.Namespace}, &contextWriter{ctx: ctx, w: w})
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// Results retrieves the results tarball of the run and counts the tests run
+// and failed by each suite in it.
+func (s *SDKClient) Results(ctx context.Context, opts ...Option) ([]results.SuiteCounts, error) {
+	var buf bytes.Buffer
+	if err := s.Retrieve(ctx, &buf, opts...); err != nil {
+		return nil, err
+	}
+	reader, err := results.NewReaderFromBytes(buf.Bytes())
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't open results tarball")
+	}
+	counts, err := reader.TestCounts()
+	return counts, errors.Wrap(err, "couldn't count tests")
+}
+
+// Delete removes the run and returns what was deleted.
+func (s *SDKClient) Delete(ctx context.Context, opts ...Option) ([]DeletedResource, error) {
+	o := newSDKOptions(opts)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.client.Delete(&DeleteConfig{
+		Namespace:       o.run.Namespace,
+		EnableRBAC:      o.run.EnableRBAC,
+		DeleteAll:       o.deleteAll,
+		NamespaceScoped: o.namespaceScoped,
+		Wait:            o.wait,
+	})
+}
+
+// contextWriter is a writer that fails once its context is done, so whatever
+// is writing to it stops.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (c *contextWriter) Write(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.w.Write(p)
+}
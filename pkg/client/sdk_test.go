@@ -0,0 +1,126 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/rest"
+)
+
+func TestSDKOptions(t *testing.T) {
+	defaults := newSDKOptions(nil)
+	if defaults.run.Namespace != config.DefaultNamespace {
+		t.Errorf("expected the default namespace %v, got %v", config.DefaultNamespace, defaults.run.Namespace)
+	}
+	if !defaults.run.EnableRBAC || defaults.run.ImagePullPolicy != "Always" {
+		t.Errorf("expected RBAC and the Always pull policy by default, got %v and %v", defaults.run.EnableRBAC, defaults.run.ImagePullPolicy)
+	}
+	if defaults.run.E2EConfig.Focus != "Conformance" {
+		t.Errorf("expected the Conformance mode by default, got focus %q", defaults.run.E2EConfig.Focus)
+	}
+
+	o := newSDKOptions([]Option{
+		WithNamespace("team"),
+		WithMode(Quick),
+		WithE2ESkip("Slow"),
+		WithPlugins("e2e", "kube-bench"),
+		WithNamespaceScoped(),
+		WithWait(),
+	})
+	if o.run.Namespace != "team" {
+		t.Errorf("expected namespace team, got %v", o.run.Namespace)
+	}
+	quick := Quick
+	if focus := quick.Get().E2EConfig.Focus; o.run.E2EConfig.Focus != focus || o.run.E2EConfig.Skip != "Slow" {
+		t.Errorf("expected the Quick focus %q and skip Slow, got %+v", focus, o.run.E2EConfig)
+	}
+	expected := []plugin.Selection{{Name: "e2e"}, {Name: "kube-bench"}}
+	if !reflect.DeepEqual(o.run.Config.PluginSelections, expected) {
+		t.Errorf("expected plugins %v, got %v", expected, o.run.Config.PluginSelections)
+	}
+	if !o.namespaceScoped || !o.run.Config.NamespaceScoped || !o.wait {
+		t.Errorf("expected a namespace-scoped run to be waited for, got %+v", o)
+	}
+}
+
+func TestSDKStatus(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		statuses []string
+		opts     []Option
+		expected string
+		timeout  time.Duration
+	}{
+		{
+			desc:     "current",
+			statuses: []string{aggregation.RunningStatus},
+			expected: aggregation.RunningStatus,
+		}, {
+			desc:     "wait",
+			statuses: []string{"", aggregation.RunningStatus, aggregation.CompleteStatus},
+			opts:     []Option{WithWait()},
+			expected: aggregation.CompleteStatus,
+		}, {
+			desc:     "wait cancelled",
+			statuses: []string{aggregation.RunningStatus},
+			opts:     []Option{WithWait()},
+			timeout:  20 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			srv := httptest.NewServer(&statusServer{statuses: tc.statuses})
+			defer srv.Close()
+
+			sdk, err := NewSDKClient(&rest.Config{Host: srv.URL})
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+			opts := append([]Option{WithRetryInterval(time.Millisecond)}, tc.opts...)
+			status, err := sdk.Status(ctx, opts...)
+			if tc.expected == "" {
+				if errors.Cause(err) != context.DeadlineExceeded {
+					t.Fatalf("expected the context's error, got status %v and error %v", status, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error getting status: %v", err)
+			}
+			if status.Status != tc.expected {
+				t.Errorf("expected status %v, got %v", tc.expected, status.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+)
+
+const (
+	// shipContainerName is the init container of the aggregator's pod that
+	// waits for the plugins too big for their ConfigMap to be shipped to
+	// shipDir, until shipMarker is written there.
+	shipContainerName = "sonobuoy-plugins"
+	shipDir           = "/plugins.d"
+	shipMarker        = ".shipped"
+)
+
+// shipPollInterval is how often the aggregator's pod is checked for its
+// plugins' init container running, and shipTimeout how long that can take,
+// such as to pull the Sonobuoy image.
+var (
+	shipPollInterval = 2 * time.Second
+	shipTimeout      = 5 * time.Minute
+)
+
+// shipPlugins copies the definitions of plugins too big for the plugins
+// ConfigMap into the aggregator's pod once it's waiting for them.
+func (c *SonobuoyClient) shipPlugins(namespace string, plugins []customPlugin) error {
+	if err := c.waitForShipContainer(namespace); err != nil {
+		return err
+	}
+
+	for _, p := range plugins {
+		logrus.WithField("plugin", p.Name).Info("Shipping plugin too big for its ConfigMap")
+		// The file is passed as an argument rather than in the script, so
+		// it's never interpreted by the shell.
+		file := path.Join(shipDir, p.Name+".yaml")
+		command := []string{"/bin/sh", "-c", `cat > "$0"`, file}
+		if err := c.execInContainer(namespace, shipContainerName, command, strings.NewReader(p.Definition+"\n"), ioutil.Discard); err != nil {
+			return errors.Wrapf(err, "couldn't ship plugin %v", p.Name)
+		}
+	}
+
+	command := []string{"touch", path.Join(shipDir, shipMarker)}
+	return errors.Wrap(c.execInContainer(namespace, shipContainerName, command, nil, ioutil.Discard), "couldn't finish shipping plugins")
+}
+
+// waitForShipContainer waits until the init container that plugins are
+// shipped to is running, giving up after shipTimeout.
+func (c *SonobuoyClient) waitForShipContainer(namespace string) error {
+	client, err := c.Client()
+	if err != nil {
+		return err
+	}
+
+	timeout := time.After(shipTimeout)
+	ticker := time.NewTicker(shipPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pod, err := client.CoreV1().Pods(namespace).Get(config.MasterPodName, metav1.GetOptions{})
+		switch {
+		case err == nil && initContainerRunning(pod, shipContainerName):
+			return nil
+		case err == nil && pod.Status.Phase != corev1.PodPending:
+			return errors.Errorf("pod %v is %v without waiting for plugins to be shipped", config.MasterPodName, pod.Status.Phase)
+		// The pod may not be in the cache of the API server yet.
+		case err != nil && !apierrors.IsNotFound(err):
+			return errors.Wrapf(err, "couldn't get pod %v", config.MasterPodName)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timeout:
+			return errors.Errorf("pod %v isn't waiting for plugins to be shipped after %v", config.MasterPodName, shipTimeout)
+		}
+	}
+}
+
+// initContainerRunning returns whether the named init container of pod is
+// running.
+func initContainerRunning(pod *corev1.Pod, name string) bool {
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.Name == name {
+			return status.State.Running != nil
+		}
+	}
+	return false
+}
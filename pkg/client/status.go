@@ -19,8 +19,10 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -41,7 +43,12 @@ func (c *SonobuoyClient) GetStatus(namespace string) (*aggregation.Status, error
 	if err != nil {
 		return nil, errors.Wrap(err, "could not retrieve sonobuoy pod")
 	}
+	return statusFromPod(pod)
+}
 
+// statusFromPod reads the status of a run from its aggregator pod's
+// annotation.
+func statusFromPod(pod *corev1.Pod) (*aggregation.Status, error) {
 	if pod.Status.Phase != corev1.PodRunning {
 		return nil, fmt.Errorf("pod has status %q", pod.Status.Phase)
 	}
@@ -58,3 +65,43 @@ func (c *SonobuoyClient) GetStatus(namespace string) (*aggregation.Status, error
 
 	return &status, nil
 }
+
+// WaitForRun watches the sonobuoy run until it has completed or failed, and
+// returns that final status. Errors getting the status, such as the
+// aggregator not having started yet, are retried until the timeout.
+func (c *SonobuoyClient) WaitForRun(cfg *WaitConfig) (*aggregation.Status, error) {
+	if cfg.Interval <= 0 {
+		return nil, errors.Errorf("invalid interval %v, it must be positive", cfg.Interval)
+	}
+	var timeout <-chan time.Time
+	if cfg.Timeout > 0 {
+		timeout = time.After(cfg.Timeout)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	transitions, err := c.WatchRun(&WatchConfig{Namespace: cfg.Namespace, RetryInterval: cfg.Interval}, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for {
+		select {
+		case transition, ok := <-transitions:
+			if !ok {
+				return nil, errors.New("stopped watching the run before it finished")
+			}
+			if transition.To.Finished() {
+				return transition.Status, nil
+			}
+			logrus.WithField("status", transition.To).Debug("Waiting for the run to finish")
+			lastErr = transition.Err
+		case <-timeout:
+			if lastErr != nil {
+				return nil, errors.Wrapf(lastErr, "timed out after %v waiting for the run to finish", cfg.Timeout)
+			}
+			return nil, errors.Errorf("timed out after %v waiting for the run to finish", cfg.Timeout)
+		}
+	}
+}
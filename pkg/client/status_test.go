@@ -0,0 +1,228 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"k8s.io/client-go/rest"
+)
+
+// statusServer serves the sonobuoy namespace and aggregator pod. The pod is
+// got and listed with the first of statuses, and watching it streams the rest
+// before waiting for the client to go away. An empty status means the pod
+// hasn't started.
+type statusServer struct {
+	statuses []string
+}
+
+func (s *statusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if strings.Contains(r.URL.Path, "/pods/") {
+		json.NewEncoder(w).Encode(statusPod(s.statuses[0]))
+		return
+	}
+	if !strings.HasSuffix(r.URL.Path, "/pods") {
+		fmt.Fprint(w, `{"metadata": {"name": "heptio-sonobuoy"}}`)
+		return
+	}
+
+	if r.URL.Query().Get("watch") != "true" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"kind":       "PodList",
+			"apiVersion": "v1",
+			"metadata":   map[string]string{"resourceVersion": "1"},
+			"items":      []interface{}{statusPod(s.statuses[0])},
+		})
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	for _, status := range s.statuses[1:] {
+		encoder.Encode(map[string]interface{}{"type": "MODIFIED", "object": statusPod(status)})
+	}
+	w.(http.Flusher).Flush()
+	<-r.Context().Done()
+}
+
+// statusPod is the aggregator pod with the given status, or pending if it's
+// empty.
+func statusPod(status string) map[string]interface{} {
+	if status == "" {
+		return map[string]interface{}{
+			"kind":       "Pod",
+			"apiVersion": "v1",
+			"metadata":   map[string]interface{}{"name": aggregation.StatusPodName},
+			"status":     map[string]string{"phase": "Pending"},
+		}
+	}
+	statusJSON, _ := json.Marshal(aggregation.Status{Status: status})
+	return map[string]interface{}{
+		"kind":       "Pod",
+		"apiVersion": "v1",
+		"metadata": map[string]interface{}{
+			"name":        aggregation.StatusPodName,
+			"annotations": map[string]string{aggregation.StatusAnnotationName: string(statusJSON)},
+		},
+		"status": map[string]string{"phase": "Running"},
+	}
+}
+
+func TestWaitForRun(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		server    *statusServer
+		timeout   time.Duration
+		expected  string
+		expectErr bool
+	}{
+		{
+			desc:     "completes",
+			server:   &statusServer{statuses: []string{"", aggregation.RunningStatus, aggregation.CompleteStatus}},
+			expected: aggregation.CompleteStatus,
+		}, {
+			desc:     "fails",
+			server:   &statusServer{statuses: []string{aggregation.RunningStatus, aggregation.FailedStatus}},
+			expected: aggregation.FailedStatus,
+		}, {
+			desc:      "times out",
+			server:    &statusServer{statuses: []string{aggregation.RunningStatus}},
+			timeout:   20 * time.Millisecond,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			srv := httptest.NewServer(tc.server)
+			defer srv.Close()
+
+			c, err := NewSonobuoyClient(&rest.Config{Host: srv.URL})
+			if err != nil {
+				t.Fatalf("unexpected error creating client: %v", err)
+			}
+
+			status, err := c.WaitForRun(&WaitConfig{
+				Namespace: "heptio-sonobuoy",
+				Interval:  time.Millisecond,
+				Timeout:   tc.timeout,
+			})
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got status %v", status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error waiting for run: %v", err)
+			}
+			if status.Status != tc.expected {
+				t.Errorf("expected status %v, got %v", tc.expected, status.Status)
+			}
+		})
+	}
+}
+
+func TestWatchRun(t *testing.T) {
+	srv := httptest.NewServer(&statusServer{statuses: []string{
+		"",
+		aggregation.RunningStatus,
+		aggregation.RunningStatus,
+		aggregation.CompleteStatus,
+	}})
+	defer srv.Close()
+
+	c, err := NewSonobuoyClient(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatalf("unexpected error creating client: %v", err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	transitions, err := c.WatchRun(&WatchConfig{Namespace: "heptio-sonobuoy", RetryInterval: time.Millisecond}, stop)
+	if err != nil {
+		t.Fatalf("unexpected error watching run: %v", err)
+	}
+
+	var got []RunTransition
+	for transition := range transitions {
+		got = append(got, transition)
+	}
+
+	expected := []struct{ from, to RunPhase }{
+		{"", RunPhasePending},
+		{RunPhasePending, RunPhaseRunning},
+		{RunPhaseRunning, RunPhaseComplete},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v transitions, got %+v", len(expected), got)
+	}
+	for i, transition := range got {
+		if transition.From != expected[i].from || transition.To != expected[i].to {
+			t.Errorf("expected transition %v from %q to %q, got from %q to %q", i, expected[i].from, expected[i].to, transition.From, transition.To)
+		}
+	}
+	if got[0].Err == nil || got[0].Status != nil {
+		t.Errorf("expected the pending transition to have an error and no status, got %+v", got[0])
+	}
+	if status := got[2].Status; status == nil || status.Status != aggregation.CompleteStatus {
+		t.Errorf("expected the final transition to have the complete status, got %+v", status)
+	}
+}
+
+func TestRunPhase(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		status   aggregation.Status
+		expected RunPhase
+	}{
+		{
+			desc:     "running",
+			status:   aggregation.Status{Status: aggregation.RunningStatus},
+			expected: RunPhaseRunning,
+		}, {
+			desc: "failed",
+			status: aggregation.Status{Status: aggregation.FailedStatus, Plugins: []aggregation.PluginStatus{
+				{Plugin: "e2e", Status: aggregation.CompleteStatus},
+				{Plugin: "systemd_logs", Node: "node1", Status: aggregation.FailedStatus},
+			}},
+			expected: RunPhaseFailed,
+		}, {
+			desc: "failed while another plugin is running",
+			status: aggregation.Status{Status: aggregation.FailedStatus, Plugins: []aggregation.PluginStatus{
+				{Plugin: "e2e", Status: aggregation.RunningStatus},
+				{Plugin: "systemd_logs", Node: "node1", Status: aggregation.FailedStatus},
+			}},
+			expected: RunPhaseRunning,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if phase := RunPhaseOf(&tc.status); phase != tc.expected {
+				t.Errorf("expected phase %q, got %q", tc.expected, phase)
+			}
+		})
+	}
+}
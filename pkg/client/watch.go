@@ -0,0 +1,237 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+)
+
+// runWatchResync is how long a watch of the aggregator pod is kept open before
+// it's listed again, in case an update was missed.
+const runWatchResync = 5 * time.Minute
+
+// RunPhase is where a Sonobuoy run is up to, as seen by a client watching it.
+type RunPhase string
+
+const (
+	// RunPhasePending means the aggregator isn't reporting the run's status,
+	// such as while its pod is starting, or because it doesn't exist (yet).
+	RunPhasePending RunPhase = "pending"
+	// RunPhaseRunning means the run is in progress.
+	RunPhaseRunning RunPhase = RunPhase(aggregation.RunningStatus)
+	// RunPhaseComplete means the run finished and every plugin completed.
+	RunPhaseComplete RunPhase = RunPhase(aggregation.CompleteStatus)
+	// RunPhaseFailed means the run finished but a plugin failed.
+	RunPhaseFailed RunPhase = RunPhase(aggregation.FailedStatus)
+)
+
+// RunPhaseOf returns the phase of a run with the given status. The aggregator
+// reports a run as failed as soon as any plugin fails, but it isn't over until
+// none of them are still running.
+func RunPhaseOf(status *aggregation.Status) RunPhase {
+	if status.Status == aggregation.FailedStatus {
+		for _, plugin := range status.Plugins {
+			if plugin.Status == aggregation.RunningStatus {
+				return RunPhaseRunning
+			}
+		}
+	}
+	return RunPhase(status.Status)
+}
+
+// Finished reports whether a run in this phase is over.
+func (p RunPhase) Finished() bool {
+	return p != RunPhasePending && p != RunPhaseRunning
+}
+
+// RunTransition is a change in the phase of a Sonobuoy run.
+type RunTransition struct {
+	// From is the phase the run was in, which is empty for the first
+	// transition a watch sees.
+	From RunPhase
+	To   RunPhase
+	// Status is the status of the run as of the transition. It's nil while
+	// the run is pending.
+	Status *aggregation.Status
+	// Err is why the run is pending, if the aggregator's status couldn't be
+	// read.
+	Err error
+}
+
+// WatchRun watches the aggregator pod of a Sonobuoy run, sending each change
+// in the run's phase, starting with the phase it's in, to the returned
+// channel. The channel is closed once the run has finished or stop is closed.
+func (c *SonobuoyClient) WatchRun(cfg *WatchConfig, stop <-chan struct{}) (<-chan RunTransition, error) {
+	if cfg.RetryInterval <= 0 {
+		return nil, errors.Errorf("invalid retry interval %v, it must be positive", cfg.RetryInterval)
+	}
+	client, err := c.Client()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &runWatcher{
+		pods:        client.CoreV1().Pods(cfg.Namespace),
+		retry:       cfg.RetryInterval,
+		transitions: make(chan RunTransition),
+		stop:        stop,
+	}
+	go w.run()
+	return w.transitions, nil
+}
+
+// runWatcher lists and watches the aggregator pod, turning updates to it into
+// RunTransitions.
+type runWatcher struct {
+	pods        typedcorev1.PodInterface
+	retry       time.Duration
+	transitions chan RunTransition
+	stop        <-chan struct{}
+
+	phase RunPhase
+}
+
+// aggregatorPodSelector selects the aggregator pod by name, so only updates
+// to it are watched.
+var aggregatorPodSelector = "metadata.name=" + aggregation.StatusPodName
+
+// run lists the aggregator pod and watches it from there, listing it again
+// whenever the watch ends, until the run finishes or the watcher is stopped.
+func (w *runWatcher) run() {
+	defer close(w.transitions)
+
+	for {
+		pods, err := w.pods.List(metav1.ListOptions{FieldSelector: aggregatorPodSelector})
+		if err != nil {
+			if !w.observe(nil, errors.Wrap(err, "could not retrieve sonobuoy pod")) || !w.sleep() {
+				return
+			}
+			continue
+		}
+		more := true
+		if len(pods.Items) == 0 {
+			more = w.observe(nil, errors.Errorf("sonobuoy pod %v not found", aggregation.StatusPodName))
+		} else {
+			more = w.observe(&pods.Items[0], nil)
+		}
+		if !more {
+			return
+		}
+
+		timeoutSeconds := int64(runWatchResync.Seconds())
+		watcher, err := w.pods.Watch(metav1.ListOptions{
+			FieldSelector:   aggregatorPodSelector,
+			ResourceVersion: pods.ResourceVersion,
+			TimeoutSeconds:  &timeoutSeconds,
+		})
+		if err != nil {
+			logrus.WithError(err).Debug("Couldn't watch the aggregator pod, retrying")
+			if !w.sleep() {
+				return
+			}
+			continue
+		}
+		more = w.follow(watcher)
+		watcher.Stop()
+		if !more {
+			return
+		}
+	}
+}
+
+// follow observes the events of a watch until it ends, returning whether to
+// carry on watching.
+func (w *runWatcher) follow(watcher watch.Interface) bool {
+	for {
+		select {
+		case <-w.stop:
+			return false
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return true
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				pod, ok := event.Object.(*corev1.Pod)
+				if !ok {
+					continue
+				}
+				if !w.observe(pod, nil) {
+					return false
+				}
+			case watch.Deleted:
+				if !w.observe(nil, errors.Errorf("sonobuoy pod %v was deleted", aggregation.StatusPodName)) {
+					return false
+				}
+			case watch.Error:
+				// Such as the resource version being too old; listing again
+				// starts afresh.
+				logrus.WithField("status", event.Object).Debug("Watch of the aggregator pod failed, listing it again")
+				return true
+			}
+		}
+	}
+}
+
+// observe sends a transition if the pod's status, or err getting it, puts the
+// run in a different phase, returning whether to carry on watching: until
+// the run has finished or the watcher is stopped.
+func (w *runWatcher) observe(pod *corev1.Pod, err error) bool {
+	var status *aggregation.Status
+	if err == nil {
+		status, err = statusFromPod(pod)
+	}
+	phase := RunPhasePending
+	if err == nil {
+		phase = RunPhaseOf(status)
+	} else {
+		logrus.WithError(err).Debug("Couldn't get the status of the run")
+		status = nil
+	}
+	if phase == w.phase {
+		return true
+	}
+
+	transition := RunTransition{From: w.phase, To: phase, Status: status, Err: err}
+	w.phase = phase
+	select {
+	case w.transitions <- transition:
+	case <-w.stop:
+		return false
+	}
+	return !phase.Finished()
+}
+
+// sleep waits for the retry interval, returning false if the watcher was
+// stopped first.
+func (w *runWatcher) sleep() bool {
+	select {
+	case <-time.After(w.retry):
+		return true
+	case <-w.stop:
+		return false
+	}
+}
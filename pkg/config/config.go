@@ -22,8 +22,15 @@ import (
 
 	"github.com/c2h5oh/datasize"
 	"github.com/heptio/sonobuoy/pkg/buildinfo"
+	"github.com/heptio/sonobuoy/pkg/encryption"
+	"github.com/heptio/sonobuoy/pkg/notify"
 	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/storage"
+	"github.com/heptio/sonobuoy/pkg/tracing"
+	"github.com/pkg/errors"
 	"github.com/satori/go.uuid"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 const (
@@ -35,6 +42,19 @@ const (
 	MasterContainerName = "kube-sonobuoy"
 	// MasterResultsPath is the location in the main container of the master pod where results will be archived.
 	MasterResultsPath = "/tmp/sonobuoy"
+	// RetrievedMarker is the file written to the results directory once the
+	// results have been retrieved or stored elsewhere.
+	RetrievedMarker = ".retrieved"
+	// DefaultRetrieveTimeout is how long the master waits for its results to
+	// be retrieved before deleting the run, if it's deleted on completion.
+	DefaultRetrieveTimeout = time.Hour
+	// DefaultQueryPageSize is how many objects the queries list at a time,
+	// unless the config says otherwise.
+	DefaultQueryPageSize = 500
+	// DefaultMinFreeBytes is how much space the aggregator keeps free in its
+	// results volume, turning results away until there's room, unless the
+	// config says otherwise.
+	DefaultMinFreeBytes = 100 * 1024 * 1024
 )
 
 // DefaultImage is the URL of the docker image to run for the aggregator and workers
@@ -54,6 +74,7 @@ var ClusterResources = []string{
 	"ClusterRoles",
 	"ComponentStatuses",
 	"CustomResourceDefinitions",
+	"NodeMetrics",
 	"Nodes",
 	"PersistentVolumes",
 	"PodSecurityPolicies",
@@ -73,6 +94,7 @@ var NamespacedResources = []string{
 	"Deployments",
 	"Endpoints",
 	"Events",
+	"HelmReleases",
 	"HorizontalPodAutoscalers",
 	"Ingresses",
 	"Jobs",
@@ -81,6 +103,7 @@ var NamespacedResources = []string{
 	"PersistentVolumeClaims",
 	"PodDisruptionBudgets",
 	"PodLogs",
+	"PodMetrics",
 	"PodPresets",
 	"PodTemplates",
 	"Pods",
@@ -95,10 +118,66 @@ var NamespacedResources = []string{
 	"StatefulSets",
 }
 
+// CustomResourceOptions select the custom resources whose instances are
+// collected. Instances are only collected from the namespaces matching the
+// Filters, and with the label selector, like other namespaced resources.
+type CustomResourceOptions struct {
+	// Collect turns on collecting instances of custom resources.
+	Collect bool `json:"Collect" mapstructure:"Collect"`
+	// Names limits collection to the custom resources with the given names,
+	// such as "widgets.example.com". Empty means all of them.
+	Names []string `json:"Names,omitempty" mapstructure:"Names"`
+}
+
+// PodLogOptions select the pods whose logs are collected. How much of each
+// container's logs is collected is set by Limits.PodLogs.
+type PodLogOptions struct {
+	// Namespaces is a regex further limiting which of the namespaces
+	// selected by the Filters have their pod logs collected. Empty means all
+	// of them.
+	Namespaces string `json:"Namespaces,omitempty" mapstructure:"Namespaces"`
+	// LabelSelector selects the pods whose logs are collected, in place of
+	// the Filters' label selector.
+	LabelSelector string `json:"LabelSelector,omitempty" mapstructure:"LabelSelector"`
+}
+
+// QueryOptions limit the load the queries of the cluster put on its API
+// server.
+type QueryOptions struct {
+	// PageSize is the most objects listed in one request, with the rest
+	// listed in further pages. Zero lists every object of a kind at once.
+	PageSize int64 `json:"PageSize,omitempty" mapstructure:"PageSize"`
+	// QPS and Burst limit the rate of requests the queries make. Zero uses
+	// client-go's defaults of 5 requests a second, in bursts of up to 10.
+	QPS   float32 `json:"QPS,omitempty" mapstructure:"QPS"`
+	Burst int     `json:"Burst,omitempty" mapstructure:"Burst"`
+}
+
+// RedactionOptions control what's removed from the resources collected.
+type RedactionOptions struct {
+	// Redact replaces the values of Secrets and of annotations known to
+	// hold secrets, such as kubectl's last applied configuration. It's on by
+	// default.
+	Redact bool `json:"Redact" mapstructure:"Redact"`
+	// Patterns are regexes whose matches in any string value of a resource
+	// are replaced too, if Redact is on.
+	Patterns []string `json:"Patterns,omitempty" mapstructure:"Patterns"`
+}
+
 // FilterOptions allow operators to select sets to include in a report
 type FilterOptions struct {
 	Namespaces    string `json:"Namespaces"`
 	LabelSelector string `json:"LabelSelector"`
+
+	// IncludeNamespaces limits the namespaces matching Namespaces to those
+	// listed. Empty means all of them.
+	IncludeNamespaces []string `json:"IncludeNamespaces,omitempty" mapstructure:"IncludeNamespaces"`
+	// ExcludeNamespaces are never queried, even if they match the rest of the
+	// filters.
+	ExcludeNamespaces []string `json:"ExcludeNamespaces,omitempty" mapstructure:"ExcludeNamespaces"`
+	// NamespaceLabelSelector limits the namespaces queried to those whose
+	// labels it matches.
+	NamespaceLabelSelector string `json:"NamespaceLabelSelector,omitempty" mapstructure:"NamespaceLabelSelector"`
 }
 
 // Config is the input struct used to determine what data to collect.
@@ -111,6 +190,11 @@ type Config struct {
 	//
 	// To be safe we annotate with both json and mapstructure tags.
 
+	// APIVersion is the version of the config's schema. Configs without one
+	// are APIVersionV1, and every config is converted to APIVersion when
+	// it's read.
+	APIVersion string `json:"APIVersion" mapstructure:"APIVersion"`
+
 	///////////////////////////////////////////////
 	// Meta-Data collection options
 	///////////////////////////////////////////////
@@ -118,11 +202,37 @@ type Config struct {
 	UUID        string `json:"UUID" mapstructure:"UUID"`
 	Version     string `json:"Version" mapstructure:"Version"`
 	ResultsDir  string `json:"ResultsDir" mapstructure:"ResultsDir"`
+	// Provenance records how the run was generated, if it was generated by
+	// the CLI.
+	Provenance *Provenance `json:"Provenance,omitempty" mapstructure:"Provenance"`
+	// KeepResults is how many results tarballs are kept in ResultsDir, with
+	// older ones removed after each run. Zero keeps them all.
+	KeepResults int `json:"KeepResults,omitempty" mapstructure:"KeepResults"`
+	// ResultsRetention also removes results tarballs once they're older than
+	// its LimitTime, and the oldest ones while all of them together are
+	// bigger than its LimitSize. Like KeepResults, it applies to the
+	// tarballs in ResultsDir and in Storage after each run.
+	ResultsRetention SizeOrTimeLimitConfig `json:"ResultsRetention,omitempty" mapstructure:"ResultsRetention"`
 
 	///////////////////////////////////////////////
 	// Data collection options
 	///////////////////////////////////////////////
 	Resources []string `json:"Resources" mapstructure:"Resources"`
+	// QueryModules names the groups of queries to run, such as "core",
+	// "rbac", "crds", "metrics" and "helm", along with any compiled into a
+	// custom build. Resources only applies within them. Empty means all of them.
+	QueryModules []string `json:"QueryModules,omitempty" mapstructure:"QueryModules"`
+	// CustomResources selects the custom resources whose instances the
+	// crds module collects, besides their definitions.
+	CustomResources CustomResourceOptions `json:"CustomResources" mapstructure:"CustomResources"`
+	// PodLogs selects the pods whose logs are collected, if PodLogs is among
+	// the Resources.
+	PodLogs PodLogOptions `json:"PodLogs" mapstructure:"PodLogs"`
+	// Queries limits how hard the queries work the API server.
+	Queries QueryOptions `json:"Queries" mapstructure:"Queries"`
+	// Redaction removes secrets from the resources collected before they're
+	// stored.
+	Redaction RedactionOptions `json:"Redaction" mapstructure:"Redaction"`
 
 	///////////////////////////////////////////////
 	// Filtering options
@@ -140,19 +250,84 @@ type Config struct {
 	Aggregation      plugin.AggregationConfig `json:"Server" mapstructure:"Server"`
 	PluginSelections []plugin.Selection       `json:"Plugins" mapstructure:"Plugins"`
 	PluginSearchPath []string                 `json:"PluginSearchPath" mapstructure:"PluginSearchPath"`
-	Namespace        string                   `json:"Namespace" mapstructure:"Namespace"`
-	LoadedPlugins    []plugin.Interface       // this is assigned when plugins are loaded.
+	// Storage is where the results tarball is uploaded to, besides
+	// ResultsDir.
+	Storage       storage.Config     `json:"Storage" mapstructure:"Storage"`
+	Namespace     string             `json:"Namespace" mapstructure:"Namespace"`
+	LoadedPlugins []plugin.Interface `json:"-" mapstructure:"-"` // this is assigned when plugins are loaded.
+	// NamespaceScoped restricts the run to Namespace, for users without
+	// cluster-admin: cluster-scoped queries are skipped and only plugins
+	// that don't need to run on every node are launched.
+	NamespaceScoped bool `json:"NamespaceScoped,omitempty" mapstructure:"NamespaceScoped"`
+	// DeleteOnCompletion has the master delete the run once its results have
+	// been stored or retrieved, or RetrieveTimeout after it finishes if
+	// they're neither.
+	DeleteOnCompletion bool `json:"DeleteOnCompletion,omitempty" mapstructure:"DeleteOnCompletion"`
+	// RetrieveTimeout is a duration, defaulting to DefaultRetrieveTimeout.
+	RetrieveTimeout string `json:"RetrieveTimeout,omitempty" mapstructure:"RetrieveTimeout"`
+	// Encryption says how the results tarball is encrypted before it's kept
+	// or stored, if at all.
+	Encryption encryption.Config `json:"Encryption,omitempty" mapstructure:"Encryption"`
 
 	///////////////////////////////////////////////
 	// sonobuoy configuration
 	///////////////////////////////////////////////
 	WorkerImage     string `json:"WorkerImage" mapstructure:"WorkerImage"`
 	ImagePullPolicy string `json:"ImagePullPolicy" mapstructure:"ImagePullPolicy"`
+	// ImagePullSecrets names the secrets used to pull the images of every
+	// plugin, such as those hosted in a private registry.
+	ImagePullSecrets []string `json:"ImagePullSecrets,omitempty" mapstructure:"ImagePullSecrets"`
+	// AggregatorResources and WorkerResources are the resource requests and
+	// limits of the aggregator's container and of the worker container in
+	// every plugin pod.
+	AggregatorResources ResourceConfig `json:"AggregatorResources,omitempty" mapstructure:"AggregatorResources"`
+	WorkerResources     ResourceConfig `json:"WorkerResources,omitempty" mapstructure:"WorkerResources"`
+	// PriorityClassName is the priority class of the aggregator's pod and of
+	// every plugin pod.
+	PriorityClassName string `json:"PriorityClassName,omitempty" mapstructure:"PriorityClassName"`
+	// RuntimeClassName is the runtime class of the aggregator's pod.
+	RuntimeClassName string `json:"RuntimeClassName,omitempty" mapstructure:"RuntimeClassName"`
+	// Labels and Annotations are set on every object Sonobuoy creates,
+	// including its namespace and every plugin's pods. Viper would mangle
+	// keys such as app.kubernetes.io/name, so they're read from the config
+	// file by LoadConfig itself.
+	Labels      map[string]string `json:"Labels,omitempty" mapstructure:"-"`
+	Annotations map[string]string `json:"Annotations,omitempty" mapstructure:"-"`
+	// SecurityContextMode is which security contexts the aggregator's and
+	// plugins' pods are given, so they pass PodSecurity admission: none,
+	// restricted or privileged. Empty means none.
+	SecurityContextMode string `json:"SecurityContextMode,omitempty" mapstructure:"SecurityContextMode"`
+	// WorkerProxy is the proxy workers send results and traces through, and
+	// WorkerCABundle PEM encoded certificates they trust besides the
+	// aggregator's, for clusters behind a TLS-intercepting proxy.
+	WorkerProxy    plugin.ProxyConfig `json:"WorkerProxy,omitempty" mapstructure:"WorkerProxy"`
+	WorkerCABundle string             `json:"WorkerCABundle,omitempty" mapstructure:"WorkerCABundle"`
+
+	// Tracing is where OpenTelemetry spans of the run are exported, from
+	// both the aggregator and the workers.
+	Tracing tracing.Config `json:"Tracing,omitempty" mapstructure:"Tracing"`
+
+	// Notifications are the webhooks told how the run went once it has
+	// finished.
+	Notifications []notify.Config `json:"Notifications,omitempty" mapstructure:"Notifications"`
+}
+
+// ResourceConfig is the resource requests and limits of a container, by
+// resource name (such as "cpu" or "memory") and quantity (such as "100m" or
+// "256Mi").
+type ResourceConfig struct {
+	Requests map[string]string `json:"Requests,omitempty" mapstructure:"Requests"`
+	Limits   map[string]string `json:"Limits,omitempty" mapstructure:"Limits"`
 }
 
 // LimitConfig is a configuration on the limits of sizes of various responses.
 type LimitConfig struct {
+	// PodLogs limits how much of each container's logs are collected, by
+	// size and by how far back they go.
 	PodLogs SizeOrTimeLimitConfig `json:"PodLogs" mapstructure:"PodLogs"`
+	// CustomResources limits how much of each custom resource's instances
+	// are collected, in each namespace. Only LimitSize applies.
+	CustomResources SizeOrTimeLimitConfig `json:"CustomResources" mapstructure:"CustomResources"`
 }
 
 // SizeOrTimeLimitConfig represents configuration that limits the size of
@@ -162,6 +337,11 @@ type SizeOrTimeLimitConfig struct {
 	LimitTime string `json:"LimitTime" mapstructure:"LimitTime"`
 }
 
+// IsSet returns whether either limit is set.
+func (c SizeOrTimeLimitConfig) IsSet() bool {
+	return c.LimitSize != "" || c.LimitTime != ""
+}
+
 // FilterResources is a utility function used to parse Resources
 func (cfg *Config) FilterResources(filter []string) []string {
 	var results []string
@@ -227,15 +407,56 @@ func (c SizeOrTimeLimitConfig) timeLimitDuration() (val time.Duration, defaulted
 	return val, false, err
 }
 
+// Requirements returns the resource requirements of a container, or an error
+// if any of the quantities are invalid.
+func (c ResourceConfig) Requirements() (v1.ResourceRequirements, error) {
+	var requirements v1.ResourceRequirements
+	var err error
+	if requirements.Requests, err = resourceList(c.Requests); err != nil {
+		return requirements, errors.Wrap(err, "invalid resource requests")
+	}
+	if requirements.Limits, err = resourceList(c.Limits); err != nil {
+		return requirements, errors.Wrap(err, "invalid resource limits")
+	}
+	return requirements, nil
+}
+
+func resourceList(quantities map[string]string) (v1.ResourceList, error) {
+	if len(quantities) == 0 {
+		return nil, nil
+	}
+	list := make(v1.ResourceList, len(quantities))
+	for name, value := range quantities {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%v: %q", name, value)
+		}
+		list[v1.ResourceName(name)] = quantity
+	}
+	return list, nil
+}
+
+// RetrieveTimeoutDuration returns the RetrieveTimeout, or
+// DefaultRetrieveTimeout if it isn't set.
+func (cfg *Config) RetrieveTimeoutDuration() (time.Duration, error) {
+	if cfg.RetrieveTimeout == "" {
+		return DefaultRetrieveTimeout, nil
+	}
+	return time.ParseDuration(cfg.RetrieveTimeout)
+}
+
 // New returns a newly-constructed Config object with default values.
 func New() *Config {
 	var cfg Config
+	cfg.APIVersion = APIVersion
 	cfg.UUID = uuid.NewV4().String()
 	cfg.Description = "DEFAULT"
 	cfg.ResultsDir = "/tmp/sonobuoy"
 	cfg.Version = buildinfo.Version
 
 	cfg.Filters.Namespaces = ".*"
+	cfg.Queries.PageSize = DefaultQueryPageSize
+	cfg.Redaction.Redact = true
 
 	cfg.Resources = ClusterResources
 	cfg.Resources = append(cfg.Resources, NamespacedResources...)
@@ -244,7 +465,9 @@ func New() *Config {
 
 	cfg.Aggregation.BindAddress = "0.0.0.0"
 	cfg.Aggregation.BindPort = 8080
+	cfg.Aggregation.MetricsPort = 8081
 	cfg.Aggregation.TimeoutSeconds = 5400 // 90 minutes
+	cfg.Aggregation.MinFreeBytes = DefaultMinFreeBytes
 
 	cfg.PluginSearchPath = []string{
 		"./plugins.d",
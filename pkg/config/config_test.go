@@ -19,6 +19,10 @@ package config
 import (
 	"reflect"
 	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func TestDefaults(t *testing.T) {
@@ -37,3 +41,286 @@ func TestDefaults(t *testing.T) {
 		t.Fatalf("Defaults should match but didn't")
 	}
 }
+
+func TestResourceConfigRequirements(t *testing.T) {
+	testCases := []struct {
+		name      string
+		cfg       ResourceConfig
+		expected  v1.ResourceRequirements
+		expectErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "requests and limits",
+			cfg: ResourceConfig{
+				Requests: map[string]string{"cpu": "100m"},
+				Limits:   map[string]string{"memory": "256Mi"},
+			},
+			expected: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+				Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")},
+			},
+		},
+		{
+			name:      "invalid quantity",
+			cfg:       ResourceConfig{Limits: map[string]string{"memory": "lots"}},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requirements, err := tc.cfg.Requirements()
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				cfg := New()
+				cfg.WorkerResources = tc.cfg
+				if errs := cfg.Validate(); len(errs) != 1 {
+					t.Errorf("expected 1 validation error, got %v", errs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(requirements, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, requirements)
+			}
+		})
+	}
+}
+
+func TestValidateWorkerNetwork(t *testing.T) {
+	testCases := []struct {
+		name      string
+		proxy     plugin.ProxyConfig
+		caBundle  string
+		expectErr bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:  "proxies",
+			proxy: plugin.ProxyConfig{HTTPProxy: "http://proxy:3128", HTTPSProxy: "http://proxy:3128", NoProxy: ".svc"},
+		},
+		{
+			name:      "proxy without a host",
+			proxy:     plugin.ProxyConfig{HTTPSProxy: "proxy"},
+			expectErr: true,
+		},
+		{
+			name:      "CA bundle without certificates",
+			caBundle:  "not a certificate",
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := New()
+			cfg.WorkerProxy = tc.proxy
+			cfg.WorkerCABundle = tc.caBundle
+			errs := cfg.Validate()
+			if tc.expectErr != (len(errs) > 0) {
+				t.Errorf("expected error: %v, got %v", tc.expectErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateQueries(t *testing.T) {
+	testCases := []struct {
+		name      string
+		queries   QueryOptions
+		expectErr bool
+	}{
+		{name: "default", queries: New().Queries},
+		{name: "rate limited", queries: QueryOptions{PageSize: 100, QPS: 2.5, Burst: 5}},
+		{name: "negative page size", queries: QueryOptions{PageSize: -1}, expectErr: true},
+		{name: "negative QPS", queries: QueryOptions{QPS: -1}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := New()
+			cfg.Queries = tc.queries
+			errs := cfg.Validate()
+			if tc.expectErr != (len(errs) > 0) {
+				t.Errorf("expected error: %v, got %v", tc.expectErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateRedaction(t *testing.T) {
+	testCases := []struct {
+		name      string
+		redaction RedactionOptions
+		expectErr bool
+	}{
+		{name: "default", redaction: New().Redaction},
+		{name: "patterns", redaction: RedactionOptions{Redact: true, Patterns: []string{`password=\S+`}}},
+		{name: "invalid pattern", redaction: RedactionOptions{Redact: true, Patterns: []string{`(`}}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := New()
+			cfg.Redaction = tc.redaction
+			errs := cfg.Validate()
+			if tc.expectErr != (len(errs) > 0) {
+				t.Errorf("expected error: %v, got %v", tc.expectErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	testCases := []struct {
+		name      string
+		filters   FilterOptions
+		expectErr bool
+	}{
+		{name: "default", filters: New().Filters},
+		{name: "include and exclude", filters: FilterOptions{Namespaces: ".*", IncludeNamespaces: []string{"tenant-a"}, ExcludeNamespaces: []string{"kube-system"}}},
+		{name: "namespace selector", filters: FilterOptions{Namespaces: ".*", NamespaceLabelSelector: "team in (a,b)"}},
+		{name: "invalid regex", filters: FilterOptions{Namespaces: "("}, expectErr: true},
+		{name: "invalid label selector", filters: FilterOptions{Namespaces: ".*", LabelSelector: "a b"}, expectErr: true},
+		{name: "invalid namespace selector", filters: FilterOptions{Namespaces: ".*", NamespaceLabelSelector: "a b"}, expectErr: true},
+		{name: "excluding the sonobuoy namespace", filters: FilterOptions{Namespaces: ".*", ExcludeNamespaces: []string{DefaultNamespace}}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := New()
+			cfg.Filters = tc.filters
+			errs := cfg.Validate()
+			if tc.expectErr != (len(errs) > 0) {
+				t.Errorf("expected error: %v, got %v", tc.expectErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateMetadata(t *testing.T) {
+	testCases := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		expectErr   bool
+	}{
+		{name: "none"},
+		{
+			name:        "valid",
+			labels:      map[string]string{"app.kubernetes.io/part-of": "conformance"},
+			annotations: map[string]string{"sidecar.istio.io/inject": "false", "owner": "QA team, nightly"},
+		},
+		{name: "reserved label", labels: map[string]string{"tier": "analysis"}, expectErr: true},
+		{name: "sonobuoy label", labels: map[string]string{"sonobuoy-run": "abc"}, expectErr: true},
+		{name: "invalid label key", labels: map[string]string{"cost center": "1234"}, expectErr: true},
+		{name: "invalid label value", labels: map[string]string{"owner": "QA team"}, expectErr: true},
+		{name: "reserved annotation", annotations: map[string]string{"prometheus.io/port": "9090"}, expectErr: true},
+		{name: "invalid annotation key", annotations: map[string]string{"/owner": "QA"}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := New()
+			cfg.Labels = tc.labels
+			cfg.Annotations = tc.annotations
+			errs := cfg.Validate()
+			if tc.expectErr != (len(errs) > 0) {
+				t.Errorf("expected error: %v, got %v", tc.expectErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateSecurityContextMode(t *testing.T) {
+	testCases := []struct {
+		mode      string
+		expectErr bool
+	}{
+		{mode: ""},
+		{mode: "none"},
+		{mode: "restricted"},
+		{mode: "privileged"},
+		{mode: "baseline", expectErr: true},
+		{mode: "Restricted", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.mode, func(t *testing.T) {
+			cfg := New()
+			cfg.SecurityContextMode = tc.mode
+			errs := cfg.Validate()
+			if tc.expectErr != (len(errs) > 0) {
+				t.Errorf("expected error: %v, got %v", tc.expectErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateAddressFamily(t *testing.T) {
+	testCases := []struct {
+		name      string
+		family    string
+		advertise string
+		bind      string
+		expectErr bool
+	}{
+		{name: "none", advertise: "[fd00::1]:8080"},
+		{name: "IPv4", family: "IPv4", advertise: "10.0.0.1:8080"},
+		{name: "IPv6", family: "IPv6", advertise: "[fd00::1]:8080"},
+		{name: "IPv6 wildcard", family: "IPv6", advertise: "[fd00::1]:8080", bind: "::"},
+		{name: "hostname", family: "IPv6", advertise: "sonobuoy-master.heptio-sonobuoy.svc:8080"},
+		{name: "unknown", family: "ipv6", expectErr: true},
+		{name: "IPv4 address for IPv6", family: "IPv6", advertise: "10.0.0.1:8080", expectErr: true},
+		{name: "IPv6 address for IPv4", family: "IPv4", advertise: "[fd00::1]:8080", expectErr: true},
+		{name: "IPv4 bind address for IPv6", family: "IPv6", bind: "10.0.0.1", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := New()
+			cfg.Aggregation.AddressFamily = tc.family
+			cfg.Aggregation.AdvertiseAddress = tc.advertise
+			if tc.bind != "" {
+				cfg.Aggregation.BindAddress = tc.bind
+			}
+			errs := cfg.Validate()
+			if tc.expectErr != (len(errs) > 0) {
+				t.Errorf("expected error: %v, got %v", tc.expectErr, errs)
+			}
+		})
+	}
+}
+
+func TestValidateAdvertiseService(t *testing.T) {
+	testCases := []struct {
+		name      string
+		service   string
+		expectErr bool
+	}{
+		{name: "none"},
+		{name: "valid", service: "sonobuoy-master"},
+		{name: "uppercase", service: "Sonobuoy-Master", expectErr: true},
+		{name: "dotted", service: "sonobuoy-master.heptio-sonobuoy", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := New()
+			cfg.Aggregation.AdvertiseService = tc.service
+			errs := cfg.Validate()
+			if tc.expectErr != (len(errs) > 0) {
+				t.Errorf("expected error: %v, got %v", tc.expectErr, errs)
+			}
+		})
+	}
+}
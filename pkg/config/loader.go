@@ -17,15 +17,29 @@ limitations under the License.
 package config
 
 import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/heptio/sonobuoy/pkg/buildinfo"
 	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
 	pluginloader "github.com/heptio/sonobuoy/pkg/plugin/loader"
+	"github.com/heptio/sonobuoy/pkg/tracing"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // LoadConfig will load the current sonobuoy configuration using the filesystem
@@ -45,30 +59,50 @@ func LoadConfig() (*Config, error) {
 		viper.SetConfigFile(forceCfg)
 	}
 
-	// 1 - Read in the config file.
+	// 1 - Read in the config file, converted to the current version.
 	if err = viper.ReadInConfig(); err != nil {
 		return nil, errors.WithStack(err)
 	}
+	if err = convertConfigFile(viper.ConfigFileUsed()); err != nil {
+		return nil, err
+	}
 
 	// 2 - Unmarshal the Config struct
 	if err = viper.Unmarshal(cfg); err != nil {
 		return nil, errors.WithStack(err)
 	}
 
+	if err = loadMetadata(cfg, viper.ConfigFileUsed()); err != nil {
+		return nil, err
+	}
+
 	// 3 - figure out what address we will tell pods to dial for aggregation
+	if cfg.Aggregation.AdvertiseAddress == "" && cfg.Aggregation.AdvertiseService != "" {
+		// A Service's DNS name outlives the aggregator pod's IP.
+		cfg.Aggregation.AdvertiseAddress = fmt.Sprintf("%v.%v.svc", cfg.Aggregation.AdvertiseService, cfg.Namespace)
+	}
 	if cfg.Aggregation.AdvertiseAddress == "" {
-		if ip := os.Getenv("SONOBUOY_ADVERTISE_IP"); ip != "" {
-			cfg.Aggregation.AdvertiseAddress = fmt.Sprintf("%v:%d", ip, cfg.Aggregation.BindPort)
+		// A dual-stack pod has an IP of each family, the primary one first.
+		ips := strings.Split(os.Getenv("SONOBUOY_ADVERTISE_IPS"), ",")
+		ips = append(ips, os.Getenv("SONOBUOY_ADVERTISE_IP"))
+		if ip := advertiseIP(ips, cfg.Aggregation.AddressFamily); ip != "" {
+			cfg.Aggregation.AdvertiseAddress = ip
 		} else {
 			hostname, _ := os.Hostname()
-			if hostname != "" {
-				cfg.Aggregation.AdvertiseAddress = fmt.Sprintf("%v:%d", hostname, cfg.Aggregation.BindPort)
-			}
+			cfg.Aggregation.AdvertiseAddress = hostname
 		}
 	}
+	if cfg.Aggregation.AdvertiseAddress != "" {
+		cfg.Aggregation.AdvertiseAddress = withPort(cfg.Aggregation.AdvertiseAddress, cfg.Aggregation.BindPort)
+	}
+	if cfg.Aggregation.AddressFamily == plugin.IPv6Family && cfg.Aggregation.BindAddress == net.IPv4zero.String() {
+		cfg.Aggregation.BindAddress = net.IPv6zero.String()
+	}
 
 	// 4 - Any other settings
 	cfg.Version = buildinfo.Version
+	cfg.Aggregation.Labels = cfg.Labels
+	cfg.Aggregation.Annotations = cfg.Annotations
 
 	// Make the results dir overridable with an environment variable
 	if resultsDir, ok := os.LookupEnv("RESULTS_DIR"); ok {
@@ -104,6 +138,73 @@ func LoadConfig() (*Config, error) {
 	return cfg, err
 }
 
+// advertiseIP returns the first of ips of the given address family, or of
+// either if it's empty, or an empty string if there's none.
+func advertiseIP(ips []string, family string) string {
+	for _, s := range ips {
+		ip := net.ParseIP(strings.TrimSpace(s))
+		if ip == nil {
+			continue
+		}
+		if family == "" || (ip.To4() != nil) == (family == plugin.IPv4Family) {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// withPort returns address with port added if it doesn't have one, so that it
+// can be used in URLs. IPv6 literals are bracketed whether or not they were.
+func withPort(address string, port int) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// convertConfigFile has viper read the config file converted to APIVersion,
+// logging any warnings about it.
+func convertConfigFile(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	fields, warnings, err := convert(data)
+	if err != nil {
+		return errors.Wrapf(err, "invalid config %v", file)
+	}
+	for _, warning := range warnings {
+		logrus.WithField("config", file).Warning(warning)
+	}
+
+	converted, err := json.Marshal(fields)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode converted config")
+	}
+	return errors.WithStack(viper.ReadConfig(bytes.NewReader(converted)))
+}
+
+// loadMetadata reads the labels and annotations of the config file, since
+// viper splits their keys on dots and lowercases them.
+func loadMetadata(cfg *Config, file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var metadata struct {
+		Labels      map[string]string
+		Annotations map[string]string
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return errors.Wrap(err, "couldn't read labels and annotations")
+	}
+	cfg.Labels = metadata.Labels
+	cfg.Annotations = metadata.Annotations
+	return nil
+}
+
 // Validate returns a list of errors for the configuration, if any are found.
 func (cfg *Config) Validate() (errors []error) {
 	if _, defaulted, err := cfg.Limits.PodLogs.sizeLimitBytes(); err != nil && !defaulted {
@@ -114,21 +215,195 @@ func (cfg *Config) Validate() (errors []error) {
 		errors = append(errors, err)
 	}
 
+	if _, defaulted, err := cfg.Limits.CustomResources.sizeLimitBytes(); err != nil && !defaulted {
+		errors = append(errors, err)
+	}
+
+	if _, defaulted, err := cfg.ResultsRetention.sizeLimitBytes(); err != nil && !defaulted {
+		errors = append(errors, fmt.Errorf("invalid results retention size %q: %v", cfg.ResultsRetention.LimitSize, err))
+	}
+
+	if _, defaulted, err := cfg.ResultsRetention.timeLimitDuration(); err != nil && !defaulted {
+		errors = append(errors, fmt.Errorf("invalid results retention time %q: %v", cfg.ResultsRetention.LimitTime, err))
+	}
+
+	if _, err := cfg.RetrieveTimeoutDuration(); err != nil {
+		errors = append(errors, fmt.Errorf("invalid retrieve timeout %q: %v", cfg.RetrieveTimeout, err))
+	}
+
+	if cfg.DeleteOnCompletion && cfg.KeepResults > 0 {
+		errors = append(errors, fmt.Errorf("recurring runs can't be deleted on completion"))
+	}
+
+	if _, err := regexp.Compile(cfg.Filters.Namespaces); err != nil {
+		errors = append(errors, fmt.Errorf("invalid namespace filter %q: %v", cfg.Filters.Namespaces, err))
+	}
+
+	if _, err := labels.Parse(cfg.Filters.LabelSelector); err != nil {
+		errors = append(errors, fmt.Errorf("invalid label selector %q: %v", cfg.Filters.LabelSelector, err))
+	}
+
+	if _, err := labels.Parse(cfg.Filters.NamespaceLabelSelector); err != nil {
+		errors = append(errors, fmt.Errorf("invalid namespace label selector %q: %v", cfg.Filters.NamespaceLabelSelector, err))
+	}
+
+	for _, ns := range cfg.Filters.ExcludeNamespaces {
+		if ns == cfg.Namespace {
+			errors = append(errors, fmt.Errorf("the Sonobuoy namespace %q can't be excluded from the queries", ns))
+		}
+	}
+
+	if _, err := regexp.Compile(cfg.PodLogs.Namespaces); err != nil {
+		errors = append(errors, fmt.Errorf("invalid pod log namespaces %q: %v", cfg.PodLogs.Namespaces, err))
+	}
+
+	if cfg.Aggregation.MinFreeBytes < 0 {
+		errors = append(errors, fmt.Errorf("the aggregator's minimum free space can't be negative"))
+	}
+
+	if cfg.Queries.PageSize < 0 || cfg.Queries.QPS < 0 || cfg.Queries.Burst < 0 {
+		errors = append(errors, fmt.Errorf("query page size, QPS and burst can't be negative"))
+	}
+
+	for _, pattern := range cfg.Redaction.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errors = append(errors, fmt.Errorf("invalid redaction pattern %q: %v", pattern, err))
+		}
+	}
+
+	if err := plugin.ValidateMetadata(cfg.Labels, cfg.Annotations); err != nil {
+		errors = append(errors, err)
+	}
+
+	switch cfg.SecurityContextMode {
+	case "", plugin.SecurityContextNone, plugin.SecurityContextRestricted, plugin.SecurityContextPrivileged:
+	default:
+		errors = append(errors, fmt.Errorf("invalid security context mode %q", cfg.SecurityContextMode))
+	}
+
+	if err := validateAddressFamily(cfg.Aggregation); err != nil {
+		errors = append(errors, err)
+	}
+
+	if service := cfg.Aggregation.AdvertiseService; service != "" {
+		if errs := validation.IsDNS1035Label(service); len(errs) > 0 {
+			errors = append(errors, fmt.Errorf("invalid advertise service %q: %v", service, strings.Join(errs, ", ")))
+		}
+	}
+
+	if _, err := labels.Parse(cfg.PodLogs.LabelSelector); err != nil {
+		errors = append(errors, fmt.Errorf("invalid pod log label selector %q: %v", cfg.PodLogs.LabelSelector, err))
+	}
+
+	if _, err := cfg.AggregatorResources.Requirements(); err != nil {
+		errors = append(errors, fmt.Errorf("invalid aggregator resources: %v", err))
+	}
+
+	if _, err := cfg.WorkerResources.Requirements(); err != nil {
+		errors = append(errors, fmt.Errorf("invalid worker resources: %v", err))
+	}
+
+	if err := cfg.Storage.Validate(); err != nil {
+		errors = append(errors, err)
+	}
+
+	if err := cfg.Encryption.Validate(); err != nil {
+		errors = append(errors, err)
+	}
+
+	if err := validateProxy(cfg.WorkerProxy); err != nil {
+		errors = append(errors, err)
+	}
+
+	if cfg.WorkerCABundle != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(cfg.WorkerCABundle)) {
+		errors = append(errors, fmt.Errorf("worker CA bundle has no PEM encoded certificates"))
+	}
+
+	for _, n := range cfg.Notifications {
+		if err := n.Validate(); err != nil {
+			errors = append(errors, err)
+		}
+	}
+
 	return errors
 }
 
+// validateAddressFamily returns an error if the aggregator's address family
+// isn't one, or its advertise or bind address is an IP of the other family.
+func validateAddressFamily(aggregation plugin.AggregationConfig) error {
+	family := aggregation.AddressFamily
+	switch family {
+	case "":
+		return nil
+	case plugin.IPv4Family, plugin.IPv6Family:
+	default:
+		return fmt.Errorf("invalid address family %q, expected %v or %v", family, plugin.IPv4Family, plugin.IPv6Family)
+	}
+
+	advertised := aggregation.AdvertiseAddress
+	if host, _, err := net.SplitHostPort(advertised); err == nil {
+		advertised = host
+	}
+	for _, address := range []string{advertised, aggregation.BindAddress} {
+		ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"))
+		if ip != nil && !ip.IsUnspecified() && (ip.To4() != nil) != (family == plugin.IPv4Family) {
+			return fmt.Errorf("address %v isn't an %v address", address, family)
+		}
+	}
+	return nil
+}
+
+// validateProxy returns an error if either of the proxies isn't a URL.
+func validateProxy(proxy plugin.ProxyConfig) error {
+	for _, u := range []string{proxy.HTTPProxy, proxy.HTTPSProxy} {
+		if u == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u); err != nil || parsed.Host == "" {
+			return fmt.Errorf("invalid worker proxy %q", u)
+		}
+	}
+	return nil
+}
+
 // loadAllPlugins takes the given sonobuoy configuration and gives back a
 // plugin.Interface for every plugin specified by the configuration.
 func loadAllPlugins(cfg *Config) error {
 	var plugins []plugin.Interface
 
+	workerResources, err := cfg.WorkerResources.Requirements()
+	if err != nil {
+		return errors.Wrap(err, "invalid worker resources")
+	}
+
+	// Workers need to trust the CA of a serving certificate the aggregator
+	// is given, which may not be in the system's pool.
+	caBundle := cfg.WorkerCABundle
+	if cfg.Aggregation.TLSCertDir != "" {
+		if ca, err := ioutil.ReadFile(filepath.Join(cfg.Aggregation.TLSCertDir, aggregation.TLSCAFile)); err == nil {
+			caBundle = strings.TrimSpace(caBundle + "\n" + string(ca))
+		}
+	}
+
 	// Load all Plugins
-	plugins, err := pluginloader.LoadAllPlugins(
+	plugins, err = pluginloader.LoadAllPlugins(
 		cfg.Namespace,
 		cfg.WorkerImage,
 		cfg.ImagePullPolicy,
+		cfg.ImagePullSecrets,
 		cfg.PluginSearchPath,
 		cfg.PluginSelections,
+		plugin.PodConfig{
+			WorkerResources:     workerResources,
+			PriorityClassName:   cfg.PriorityClassName,
+			TracingEndpoint:     cfg.Tracing.Endpoint,
+			TraceParent:         tracing.RunSpanContext(cfg.UUID).Traceparent(),
+			Proxy:               cfg.WorkerProxy,
+			CABundle:            caBundle,
+			Labels:              cfg.Labels,
+			Annotations:         cfg.Annotations,
+			SecurityContextMode: cfg.SecurityContextMode,
+		},
 	)
 	if err != nil {
 		return err
@@ -148,6 +423,10 @@ func loadAllPlugins(cfg *Config) error {
 		}
 	}
 
+	if cfg.NamespaceScoped {
+		plugins = pluginloader.NamespaceScopedPlugins(plugins)
+	}
+
 	for _, p := range plugins {
 		cfg.addPlugin(p)
 	}
@@ -57,6 +57,74 @@ func TestSaveAndLoad(t *testing.T) {
 
 }
 
+func TestLoadMetadata(t *testing.T) {
+	blob := []byte(`{
+		"Labels": {"app.kubernetes.io/part-of": "conformance", "Team": "qa"},
+		"Annotations": {"sidecar.istio.io/inject": "false"}
+	}`)
+	if err := ioutil.WriteFile("./config.json", blob, 0644); err != nil {
+		t.Fatalf("Failed to write config.json: %v", err)
+	}
+	defer os.Remove("./config.json")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedLabels := map[string]string{"app.kubernetes.io/part-of": "conformance", "Team": "qa"}
+	expectedAnnotations := map[string]string{"sidecar.istio.io/inject": "false"}
+	if !reflect.DeepEqual(cfg.Labels, expectedLabels) || !reflect.DeepEqual(cfg.Aggregation.Labels, expectedLabels) {
+		t.Errorf("expected labels %v, got %v and %v for the aggregator", expectedLabels, cfg.Labels, cfg.Aggregation.Labels)
+	}
+	if !reflect.DeepEqual(cfg.Annotations, expectedAnnotations) || !reflect.DeepEqual(cfg.Aggregation.Annotations, expectedAnnotations) {
+		t.Errorf("expected annotations %v, got %v and %v for the aggregator", expectedAnnotations, cfg.Annotations, cfg.Aggregation.Annotations)
+	}
+}
+
+func TestLoadAdvertiseAddress(t *testing.T) {
+	os.Setenv("SONOBUOY_ADVERTISE_IP", "10.0.0.5")
+	defer os.Unsetenv("SONOBUOY_ADVERTISE_IP")
+	os.Setenv("SONOBUOY_ADVERTISE_IPS", "10.0.0.5,fd00::5")
+	defer os.Unsetenv("SONOBUOY_ADVERTISE_IPS")
+
+	testCases := []struct {
+		name            string
+		server          string
+		expectAdvertise string
+		expectBind      string
+	}{
+		{name: "primary", server: `{}`, expectAdvertise: "10.0.0.5:8080", expectBind: "0.0.0.0"},
+		{name: "IPv4", server: `{"addressfamily": "IPv4"}`, expectAdvertise: "10.0.0.5:8080", expectBind: "0.0.0.0"},
+		{name: "IPv6", server: `{"addressfamily": "IPv6"}`, expectAdvertise: "[fd00::5]:8080", expectBind: "::"},
+		{name: "explicit", server: `{"advertiseaddress": "sonobuoy.example.com:443"}`, expectAdvertise: "sonobuoy.example.com:443", expectBind: "0.0.0.0"},
+		{name: "explicit without port", server: `{"advertiseaddress": "fd00::9"}`, expectAdvertise: "[fd00::9]:8080", expectBind: "0.0.0.0"},
+		{name: "service", server: `{"advertiseservice": "sonobuoy-master"}`, expectAdvertise: "sonobuoy-master.heptio-sonobuoy.svc:8080", expectBind: "0.0.0.0"},
+		{name: "explicit over service", server: `{"advertiseaddress": "10.0.0.9:8080", "advertiseservice": "sonobuoy-master"}`, expectAdvertise: "10.0.0.9:8080", expectBind: "0.0.0.0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			blob := []byte(`{"Server": ` + tc.server + `}`)
+			if err := ioutil.WriteFile("./config.json", blob, 0644); err != nil {
+				t.Fatalf("Failed to write config.json: %v", err)
+			}
+			defer os.Remove("./config.json")
+
+			cfg, err := LoadConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Aggregation.AdvertiseAddress != tc.expectAdvertise {
+				t.Errorf("expected advertise address %v, got %v", tc.expectAdvertise, cfg.Aggregation.AdvertiseAddress)
+			}
+			if cfg.Aggregation.BindAddress != tc.expectBind {
+				t.Errorf("expected bind address %v, got %v", tc.expectBind, cfg.Aggregation.BindAddress)
+			}
+		})
+	}
+}
+
 func TestDefaultResources(t *testing.T) {
 	// Check that giving empty resources results in empty resources
 	blob := `{"Resources":[]}`
@@ -107,6 +175,7 @@ func TestLoadAllPlugins(t *testing.T) {
 			plugin.Selection{Name: "systemd-logs"},
 			plugin.Selection{Name: "e2e"},
 			plugin.Selection{Name: "heptio-e2e"},
+			plugin.Selection{Name: "node-diagnostics"},
 		},
 	}
 
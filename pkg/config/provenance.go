@@ -0,0 +1,63 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/buildinfo"
+)
+
+// Provenance records how a run was generated, so its results can be traced
+// back to the CLI, flags and user that created it. The aggregator writes it,
+// along with when the run started and finished, to meta/run.json.
+type Provenance struct {
+	// CLIVersion is the version of the sonobuoy CLI the run was generated
+	// with, which may differ from the aggregator's.
+	CLIVersion string `json:"CLIVersion" mapstructure:"CLIVersion"`
+	// Flags are the flags the CLI was given, as --name=value.
+	Flags []string `json:"Flags,omitempty" mapstructure:"Flags"`
+	// User is the name of the local user who ran the CLI.
+	User string `json:"User,omitempty" mapstructure:"User"`
+	// GeneratedAt is when the run was generated, in RFC 3339 format.
+	GeneratedAt string `json:"GeneratedAt" mapstructure:"GeneratedAt"`
+}
+
+// NewProvenance returns the provenance of a run being generated now, by the
+// current user, with the given flags.
+func NewProvenance(flags []string) *Provenance {
+	return &Provenance{
+		CLIVersion:  buildinfo.Version,
+		Flags:       flags,
+		User:        currentUser(),
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// currentUser returns the name of the user running the process, or an empty
+// string if it can't be found.
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
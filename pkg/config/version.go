@@ -0,0 +1,227 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// APIVersionV1 is the version of configs from before they were
+	// versioned, which have no APIVersion.
+	APIVersionV1 = "sonobuoy.heptio.com/v1"
+	// APIVersionV2 is the first versioned config. Fields it doesn't have
+	// are errors, rather than being ignored.
+	APIVersionV2 = "sonobuoy.heptio.com/v2"
+	// APIVersion is the version of the configs this Sonobuoy writes, which
+	// configs of older versions are converted to.
+	APIVersion = APIVersionV2
+)
+
+// apiVersionField is the field of a config with its version.
+const apiVersionField = "APIVersion"
+
+// conversion converts the fields of a config of one version to those of the
+// next, returning warnings about any it deprecated.
+type conversion struct {
+	to      string
+	convert func(fields map[string]interface{}) []string
+}
+
+// conversions convert configs of each old version to the next, until they're
+// of APIVersion.
+var conversions = map[string]conversion{
+	APIVersionV1: {to: APIVersionV2, convert: convertV1ToV2},
+}
+
+// removedInV2 are the fields of v1 configs which v2 configs don't have, and
+// why.
+var removedInV2 = map[string]string{
+	"LoadedPlugins": "plugins are loaded from the PluginSearchPath",
+}
+
+func convertV1ToV2(fields map[string]interface{}) []string {
+	var warnings []string
+	for _, key := range sortedKeys(fields) {
+		for name, why := range removedInV2 {
+			if !strings.EqualFold(key, name) {
+				continue
+			}
+			// Sonobuoy used to write some of them empty itself.
+			if fields[key] != nil {
+				warnings = append(warnings, fmt.Sprintf("%v is deprecated and ignored, %v", name, why))
+			}
+			delete(fields, key)
+		}
+	}
+	return warnings
+}
+
+// Decode reads a config of any version into cfg, converted to APIVersion. It
+// returns warnings about the deprecated fields the config has and, if it's
+// from before configs were versioned, the fields Sonobuoy doesn't know, which
+// are errors in versioned configs.
+func Decode(data []byte, cfg *Config) (warnings []string, err error) {
+	fields, warnings, err := convert(data)
+	if err != nil {
+		return warnings, err
+	}
+	converted, err := json.Marshal(fields)
+	if err != nil {
+		return warnings, errors.Wrap(err, "couldn't encode converted config")
+	}
+	return warnings, errors.Wrap(json.Unmarshal(converted, cfg), "couldn't decode config")
+}
+
+// convert returns the fields of a config converted to APIVersion, and checked
+// against the fields of Config, along with any warnings about them.
+func convert(data []byte) (map[string]interface{}, []string, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, nil, errors.Wrap(err, "couldn't decode config")
+	}
+
+	version := APIVersionV1
+	for _, key := range sortedKeys(fields) {
+		if !strings.EqualFold(key, apiVersionField) {
+			continue
+		}
+		s, ok := fields[key].(string)
+		if !ok {
+			return nil, nil, errors.Errorf("config %v %v isn't a string", apiVersionField, fields[key])
+		}
+		version = s
+		delete(fields, key)
+	}
+	versioned := version != APIVersionV1
+
+	var warnings []string
+	for version != APIVersion {
+		c, ok := conversions[version]
+		if !ok {
+			return nil, nil, errors.Errorf("unknown config %v %q, this Sonobuoy reads %v configs and older", apiVersionField, version, APIVersion)
+		}
+		warnings = append(warnings, c.convert(fields)...)
+		version = c.to
+	}
+
+	unknown := unknownFields(fields, reflect.TypeOf(Config{}), "")
+	if len(unknown) > 0 {
+		if versioned {
+			return nil, warnings, errors.Errorf("unknown config fields %v", strings.Join(unknown, ", "))
+		}
+		for _, field := range unknown {
+			warnings = append(warnings, fmt.Sprintf("unknown field %v is ignored", field))
+		}
+	}
+
+	fields[apiVersionField] = APIVersion
+	return fields, warnings, nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownFields returns the paths, under prefix, of the fields in value that
+// aren't fields of type t, the type value is decoded into. Like encoding/json,
+// field names are matched ignoring case. Values of the wrong kind are left
+// for decoding to report.
+func unknownFields(value interface{}, t reflect.Type, prefix string) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	// Types that decode themselves have no fields to check.
+	if reflect.PtrTo(t).Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return nil
+	}
+
+	var unknown []string
+	switch t.Kind() {
+	case reflect.Struct:
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		known := jsonFields(t)
+		for _, key := range sortedKeys(fields) {
+			fieldType, ok := known[strings.ToLower(key)]
+			if !ok {
+				unknown = append(unknown, prefix+key)
+				continue
+			}
+			unknown = append(unknown, unknownFields(fields[key], fieldType, prefix+key+".")...)
+		}
+	case reflect.Map:
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for _, key := range sortedKeys(entries) {
+			unknown = append(unknown, unknownFields(entries[key], t.Elem(), prefix+key+".")...)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range items {
+			unknown = append(unknown, unknownFields(item, t.Elem(), fmt.Sprintf("%v[%d].", strings.TrimSuffix(prefix, "."), i))...)
+		}
+	}
+	return unknown
+}
+
+// jsonFields returns the types of the fields of struct type t by the
+// lowercased names encoding/json gives them, including those of embedded
+// structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embedded, fieldType := range jsonFields(field.Type) {
+				fields[embedded] = fieldType
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = field.Type
+	}
+	return fields
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	current, err := json.Marshal(New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name           string
+		config         string
+		expectWarnings []string
+		expectErr      string
+	}{
+		{name: "current", config: string(current)},
+		{
+			name:   "unversioned",
+			config: `{"Namespace": "sonobuoy", "LoadedPlugins": null, "Labels": {"app.kubernetes.io/name": "sonobuoy"}}`,
+		},
+		{
+			name:           "unversioned with deprecated field",
+			config:         `{"Namespace": "sonobuoy", "LoadedPlugins": [{}]}`,
+			expectWarnings: []string{"LoadedPlugins is deprecated and ignored, plugins are loaded from the PluginSearchPath"},
+		},
+		{
+			name:           "unversioned with unknown fields",
+			config:         `{"Namespace": "sonobuoy", "Namespaces": "typo", "Server": {"bindport": 8080, "bindprot": 8081}, "Plugins": [{"name": "e2e", "nmae": "e2e"}]}`,
+			expectWarnings: []string{"unknown field Namespaces is ignored", "unknown field Plugins[0].nmae is ignored", "unknown field Server.bindprot is ignored"},
+		},
+		{
+			name:   "versioned",
+			config: `{"apiVersion": "sonobuoy.heptio.com/v2", "Namespace": "sonobuoy"}`,
+		},
+		{
+			name:      "versioned with unknown fields",
+			config:    `{"APIVersion": "sonobuoy.heptio.com/v2", "Namespace": "sonobuoy", "Namespaces": "typo", "Plugins": [{"nmae": "e2e"}]}`,
+			expectErr: "unknown config fields Namespaces, Plugins[0].nmae",
+		},
+		{
+			name:      "newer version",
+			config:    `{"APIVersion": "sonobuoy.heptio.com/v3"}`,
+			expectErr: `unknown config APIVersion "sonobuoy.heptio.com/v3"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := Config{}
+			warnings, err := Decode([]byte(tc.config), &cfg)
+			if tc.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(warnings, tc.expectWarnings) {
+				t.Errorf("expected warnings %q, got %q", tc.expectWarnings, warnings)
+			}
+			if cfg.APIVersion != APIVersion || cfg.Namespace == "" {
+				t.Errorf("expected a %v config with a namespace, got %+v", APIVersion, cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ClusterInfoFile is where the versions and platform of the cluster are
+// recorded, within the meta directory.
+const ClusterInfoFile = "cluster.json"
+
+// Labels nodes are given with their cloud placement and instance type.
+const (
+	regionLabel       = "failure-domain.beta.kubernetes.io/region"
+	zoneLabel         = "failure-domain.beta.kubernetes.io/zone"
+	instanceTypeLabel = "beta.kubernetes.io/instance-type"
+)
+
+// ClusterInfo is the context a run's results are read in: the versions of the
+// cluster's components and the platform it runs on.
+type ClusterInfo struct {
+	ServerVersion *version.Info `json:"serverVersion,omitempty"`
+	// Provider is the cloud provider the nodes run on, taken from their
+	// provider IDs, such as aws or gce. It's empty if that isn't known.
+	Provider string `json:"provider,omitempty"`
+	// Nodes is empty if the nodes couldn't be listed, such as in a
+	// namespace-scoped run.
+	Nodes []NodeInfo `json:"nodes,omitempty"`
+}
+
+// NodeInfo is the versions and platform of a node.
+type NodeInfo struct {
+	Name                    string `json:"name"`
+	KubeletVersion          string `json:"kubeletVersion"`
+	KubeProxyVersion        string `json:"kubeProxyVersion,omitempty"`
+	ContainerRuntimeVersion string `json:"containerRuntimeVersion,omitempty"`
+	OSImage                 string `json:"osImage,omitempty"`
+	KernelVersion           string `json:"kernelVersion,omitempty"`
+	OperatingSystem         string `json:"operatingSystem,omitempty"`
+	Architecture            string `json:"architecture,omitempty"`
+	ProviderID              string `json:"providerID,omitempty"`
+	Region                  string `json:"region,omitempty"`
+	Zone                    string `json:"zone,omitempty"`
+	InstanceType            string `json:"instanceType,omitempty"`
+}
+
+// recordClusterInfo writes the versions and platform of the cluster to
+// ClusterInfoFile in metapath. Nodes aren't listed in namespace-scoped runs,
+// which can't.
+func recordClusterInfo(kubeClient kubernetes.Interface, metapath string, namespaceScoped bool) error {
+	info, err := gatherClusterInfo(kubeClient, namespaceScoped)
+	if err != nil {
+		return err
+	}
+	blob, err := json.Marshal(info)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode cluster info")
+	}
+	return errors.Wrapf(ioutil.WriteFile(path.Join(metapath, ClusterInfoFile), blob, 0644), "couldn't write %v", ClusterInfoFile)
+}
+
+func gatherClusterInfo(kubeClient kubernetes.Interface, namespaceScoped bool) (*ClusterInfo, error) {
+	serverVersion, err := kubeClient.Discovery().ServerVersion()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get server version")
+	}
+	info := &ClusterInfo{ServerVersion: serverVersion}
+	if namespaceScoped {
+		return info, nil
+	}
+
+	nodes, err := kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		// The API server's version is still worth having.
+		logrus.WithError(err).Warning("Couldn't list nodes to record their versions")
+		return info, nil
+	}
+	for _, node := range nodes.Items {
+		nodeInfo := newNodeInfo(&node)
+		if info.Provider == "" {
+			info.Provider = providerName(nodeInfo.ProviderID)
+		}
+		info.Nodes = append(info.Nodes, nodeInfo)
+	}
+	return info, nil
+}
+
+func newNodeInfo(node *v1.Node) NodeInfo {
+	system := node.Status.NodeInfo
+	return NodeInfo{
+		Name:                    node.Name,
+		KubeletVersion:          system.KubeletVersion,
+		KubeProxyVersion:        system.KubeProxyVersion,
+		ContainerRuntimeVersion: system.ContainerRuntimeVersion,
+		OSImage:                 system.OSImage,
+		KernelVersion:           system.KernelVersion,
+		OperatingSystem:         system.OperatingSystem,
+		Architecture:            system.Architecture,
+		ProviderID:              node.Spec.ProviderID,
+		Region:                  node.Labels[regionLabel],
+		Zone:                    node.Labels[zoneLabel],
+		InstanceType:            node.Labels[instanceTypeLabel],
+	}
+}
+
+// providerName is the cloud provider of a provider ID, such as aws for
+// aws:///us-west-2a/i-0123, or empty if it has none.
+func providerName(providerID string) string {
+	if i := strings.Index(providerID, "://"); i > 0 {
+		return providerID[:i]
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestGatherClusterInfo(t *testing.T) {
+	nodesListed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/version":
+			fmt.Fprint(w, `{"major": "1", "minor": "10", "gitVersion": "v1.10.3", "platform": "linux/amd64"}`)
+		case "/api/v1/nodes":
+			nodesListed = true
+			fmt.Fprint(w, `{"kind": "NodeList", "apiVersion": "v1", "items": [{
+				"metadata": {"name": "node-a", "labels": {
+					"failure-domain.beta.kubernetes.io/region": "us-west-2",
+					"failure-domain.beta.kubernetes.io/zone": "us-west-2a",
+					"beta.kubernetes.io/instance-type": "m5.large"
+				}},
+				"spec": {"providerID": "aws:///us-west-2a/i-0123"},
+				"status": {"nodeInfo": {
+					"kubeletVersion": "v1.10.3",
+					"kubeProxyVersion": "v1.10.3",
+					"containerRuntimeVersion": "docker://17.3.2",
+					"osImage": "Ubuntu 16.04.4 LTS",
+					"operatingSystem": "linux",
+					"architecture": "amd64"
+				}}
+			}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	kubeClient, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatalf("couldn't create client: %v", err)
+	}
+
+	info, err := gatherClusterInfo(kubeClient, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.ServerVersion == nil || info.ServerVersion.GitVersion != "v1.10.3" {
+		t.Errorf("expected server version v1.10.3, got %+v", info.ServerVersion)
+	}
+	if info.Provider != "aws" {
+		t.Errorf("expected provider aws, got %q", info.Provider)
+	}
+	expected := NodeInfo{
+		Name:                    "node-a",
+		KubeletVersion:          "v1.10.3",
+		KubeProxyVersion:        "v1.10.3",
+		ContainerRuntimeVersion: "docker://17.3.2",
+		OSImage:                 "Ubuntu 16.04.4 LTS",
+		OperatingSystem:         "linux",
+		Architecture:            "amd64",
+		ProviderID:              "aws:///us-west-2a/i-0123",
+		Region:                  "us-west-2",
+		Zone:                    "us-west-2a",
+		InstanceType:            "m5.large",
+	}
+	if len(info.Nodes) != 1 || info.Nodes[0] != expected {
+		t.Errorf("expected nodes %+v, got %+v", expected, info.Nodes)
+	}
+
+	nodesListed = false
+	info, err = gatherClusterInfo(kubeClient, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if nodesListed || len(info.Nodes) != 0 {
+		t.Error("expected a namespace-scoped run not to list nodes")
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// crdPath is where CustomResourceDefinitions are served.
+	crdPath = "/apis/apiextensions.k8s.io/v1beta1/customresourcedefinitions"
+	// defaultCustomResourceLimitBytes is how much of each custom resource's
+	// instances are collected in each namespace, unless the config says
+	// otherwise.
+	defaultCustomResourceLimitBytes = 10 * 1024 * 1024
+)
+
+// listCustomResourceDefinitions lists the cluster's CustomResourceDefinitions.
+// They're requested directly, since the API server serves them under their own
+// API group rather than the core one kubeClient is set up for.
+func listCustomResourceDefinitions(kubeClient kubernetes.Interface) (*apiextensionsv1beta1.CustomResourceDefinitionList, error) {
+	body, err := kubeClient.CoreV1().RESTClient().Get().AbsPath(crdPath).DoRaw()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	crds := &apiextensionsv1beta1.CustomResourceDefinitionList{}
+	if err := json.Unmarshal(body, crds); err != nil {
+		return nil, errors.Wrap(err, "couldn't decode CustomResourceDefinitions")
+	}
+	return crds, nil
+}
+
+// crdModule is the resourceModule for custom resource definitions, which can
+// also collect the instances of each custom resource.
+type crdModule struct {
+	resourceModule
+	// definitions are the custom resources found by the last QueryCluster,
+	// whose instances are collected from each namespace.
+	definitions []apiextensionsv1beta1.CustomResourceDefinition
+}
+
+// QueryCluster queries the definitions, as well as the instances of
+// cluster-scoped custom resources if they're to be collected.
+func (m *crdModule) QueryCluster(q *Querier) error {
+	m.definitions = nil
+	if err := m.resourceModule.QueryCluster(q); err != nil {
+		return err
+	}
+	if !q.Config.CustomResources.Collect {
+		return nil
+	}
+
+	crds, err := listCustomResourceDefinitions(q.KubeClient)
+	if err != nil {
+		return errors.Wrap(err, "couldn't list custom resources to collect")
+	}
+	m.definitions = selectCustomResources(crds.Items, q.Config.CustomResources)
+
+	for _, crd := range m.definitions {
+		if crd.Spec.Scope == apiextensionsv1beta1.ClusterScoped {
+			q.QueryCluster(crd.Name, customResourceQuery(q, crd, ""))
+		}
+	}
+	return nil
+}
+
+// QueryNamespace queries the instances of namespaced custom resources in ns,
+// if they're to be collected.
+func (m *crdModule) QueryNamespace(q *Querier, ns string) error {
+	if err := m.resourceModule.QueryNamespace(q, ns); err != nil {
+		return err
+	}
+	for _, crd := range m.definitions {
+		if crd.Spec.Scope != apiextensionsv1beta1.ClusterScoped {
+			q.QueryNamespace(ns, crd.Name, customResourceQuery(q, crd, ns))
+		}
+	}
+	return nil
+}
+
+// selectCustomResources returns the definitions of the custom resources named
+// in opts, or all of them if it names none.
+func selectCustomResources(crds []apiextensionsv1beta1.CustomResourceDefinition, opts config.CustomResourceOptions) []apiextensionsv1beta1.CustomResourceDefinition {
+	if len(opts.Names) == 0 {
+		return crds
+	}
+	names := make(map[string]bool, len(opts.Names))
+	for _, name := range opts.Names {
+		names[name] = true
+	}
+	var selected []apiextensionsv1beta1.CustomResourceDefinition
+	for _, crd := range crds {
+		if names[crd.Name] {
+			selected = append(selected, crd)
+		}
+	}
+	return selected
+}
+
+// customResourceQuery lists the instances of the custom resource in namespace
+// ns, or across the cluster if it's empty, a page at a time. Once they add up
+// to more than the configured limit, the rest are left out.
+func customResourceQuery(q *Querier, crd apiextensionsv1beta1.CustomResourceDefinition, ns string) UntypedQuery {
+	path := "/apis/" + crd.Spec.Group + "/" + crd.Spec.Version
+	if ns != "" {
+		path += "/namespaces/" + ns
+	}
+	path += "/" + crd.Spec.Names.Plural
+	opts := q.ListOptions()
+	limit := q.Config.Limits.CustomResources.SizeLimitBytes(defaultCustomResourceLimitBytes)
+
+	return func() (interface{}, error) {
+		var items []json.RawMessage
+		var size int64
+		continueToken := ""
+		for {
+			req := q.KubeClient.CoreV1().RESTClient().Get().AbsPath(path)
+			if pageSize := q.Config.Queries.PageSize; pageSize > 0 {
+				req = req.Param("limit", strconv.FormatInt(pageSize, 10))
+			}
+			if opts.LabelSelector != "" {
+				req = req.Param("labelSelector", opts.LabelSelector)
+			}
+			if continueToken != "" {
+				req = req.Param("continue", continueToken)
+			}
+			body, err := req.DoRaw()
+			if err != nil {
+				return nil, errors.Wrapf(err, "couldn't list %v", crd.Name)
+			}
+
+			var list struct {
+				Metadata metav1.ListMeta   `json:"metadata"`
+				Items    []json.RawMessage `json:"items"`
+			}
+			if err := json.Unmarshal(body, &list); err != nil {
+				return nil, errors.Wrapf(err, "couldn't decode %v", crd.Name)
+			}
+			for _, item := range list.Items {
+				size += int64(len(item))
+				if size > limit {
+					logrus.WithFields(logrus.Fields{
+						"resource":  crd.Name,
+						"namespace": ns,
+					}).Warningf("Only collecting the first %d instances, which fit within %d bytes", len(items), limit)
+					return items, nil
+				}
+				items = append(items, item)
+			}
+
+			if list.Metadata.Continue == "" {
+				break
+			}
+			continueToken = list.Metadata.Continue
+		}
+
+		// Like other resources, nothing is stored if there aren't any.
+		if len(items) == 0 {
+			return nil, nil
+		}
+		return items, nil
+	}
+}
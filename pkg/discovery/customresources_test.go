@@ -0,0 +1,159 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const testCRDs = `{"kind": "CustomResourceDefinitionList", "items": [
+	{"metadata": {"name": "widgets.example.com"}, "spec": {"group": "example.com", "version": "v1", "scope": "Namespaced", "names": {"plural": "widgets"}}},
+	{"metadata": {"name": "gadgets.example.com"}, "spec": {"group": "example.com", "version": "v1", "scope": "Cluster", "names": {"plural": "gadgets"}}}
+]}`
+
+// customResourceServer serves testCRDs, two pages of widgets in the default
+// namespace and no gadgets.
+func customResourceServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case crdPath:
+			fmt.Fprint(w, testCRDs)
+		case "/apis/example.com/v1/namespaces/default/widgets":
+			if got := r.URL.Query().Get("labelSelector"); got != "app=test" {
+				t.Errorf("expected the label selector to be used, got %q", got)
+			}
+			if r.URL.Query().Get("continue") == "" {
+				fmt.Fprint(w, `{"metadata": {"continue": "next"}, "items": [{"metadata": {"name": "a"}}, {"metadata": {"name": "b"}}]}`)
+			} else {
+				fmt.Fprint(w, `{"metadata": {}, "items": [{"metadata": {"name": "c"}}]}`)
+			}
+		case "/apis/example.com/v1/gadgets":
+			fmt.Fprint(w, `{"metadata": {}, "items": []}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestCRDModule(t *testing.T) {
+	srv := customResourceServer(t)
+	defer srv.Close()
+	kubeClient, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatalf("couldn't create client: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		options  config.CustomResourceOptions
+		limit    string
+		expected []string
+	}{
+		{name: "not collected"},
+		{name: "all", options: config.CustomResourceOptions{Collect: true}, expected: []string{"a", "b", "c"}},
+		{name: "by name", options: config.CustomResourceOptions{Collect: true, Names: []string{"gadgets.example.com"}}},
+		{name: "limited", options: config.CustomResourceOptions{Collect: true}, limit: "60", expected: []string{"a", "b"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpdir, err := ioutil.TempDir("", "sonobuoy_discovery_test")
+			if err != nil {
+				t.Fatalf("couldn't create temp dir: %v", err)
+			}
+			defer os.RemoveAll(tmpdir)
+
+			cfg := &config.Config{
+				ResultsDir:      tmpdir,
+				UUID:            "run",
+				Resources:       []string{"CustomResourceDefinitions"},
+				CustomResources: tc.options,
+				Filters:         config.FilterOptions{LabelSelector: "app=test"},
+				Limits:          config.LimitConfig{CustomResources: config.SizeOrTimeLimitConfig{LimitSize: tc.limit}},
+			}
+			recorder := NewQueryRecorder()
+			q := NewQuerier(kubeClient, recorder, cfg)
+			m := &crdModule{resourceModule: resourceModule{name: CRDModule, clusterResources: []string{"CustomResourceDefinitions"}}}
+			if err := m.QueryCluster(q); err != nil {
+				t.Fatalf("unexpected error querying the cluster: %v", err)
+			}
+			if err := q.makeNamespaceDir("default"); err != nil {
+				t.Fatalf("couldn't create namespace dir: %v", err)
+			}
+			if err := m.QueryNamespace(q, "default"); err != nil {
+				t.Fatalf("unexpected error querying the namespace: %v", err)
+			}
+
+			for _, query := range recorder.queries {
+				if query.Error != nil {
+					t.Errorf("unexpected error for query %v: %v", query.QueryObj, query.Error)
+				}
+			}
+			var crds []json.RawMessage
+			readJSON(t, path.Join(cfg.OutputDir(), ClusterResourceLocation, "CustomResourceDefinitions.json"), &crds)
+			if len(crds) != 2 {
+				t.Errorf("expected 2 CustomResourceDefinitions, got %d", len(crds))
+			}
+			if _, err := os.Stat(path.Join(cfg.OutputDir(), ClusterResourceLocation, "gadgets.example.com.json")); !os.IsNotExist(err) {
+				t.Errorf("expected nothing to be stored without any gadgets, got %v", err)
+			}
+
+			widgetsFile := path.Join(cfg.OutputDir(), NSResourceLocation, "default", "widgets.example.com.json")
+			if tc.expected == nil {
+				if _, err := os.Stat(widgetsFile); !os.IsNotExist(err) {
+					t.Errorf("expected widgets not to be collected, got %v", err)
+				}
+				return
+			}
+			var widgets []struct {
+				Metadata struct {
+					Name string `json:"name"`
+				} `json:"metadata"`
+			}
+			readJSON(t, widgetsFile, &widgets)
+			var names []string
+			for _, widget := range widgets {
+				names = append(names, widget.Metadata.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tc.expected) {
+				t.Errorf("expected widgets %v, got %v", tc.expected, names)
+			}
+		})
+	}
+}
+
+func readJSON(t *testing.T, filename string, v interface{}) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("couldn't read %v: %v", filename, err)
+	}
+	if err := json.Unmarshal(contents, v); err != nil {
+		t.Fatalf("couldn't decode %v: %v", filename, err)
+	}
+}
@@ -18,26 +18,46 @@ package discovery
 
 import (
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"time"
 
 	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/encryption"
 	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/notify"
 	pluginaggregation "github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/heptio/sonobuoy/pkg/tracing"
 	"github.com/pkg/errors"
 	"github.com/rifflock/lfshook"
 	"github.com/sirupsen/logrus"
 	"github.com/viniciuschiele/tarx"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
-// Run is the main entrypoint for discovery
-func Run(kubeClient kubernetes.Interface, cfg *config.Config) (errCount int) {
+// Run is the main entrypoint for discovery. The REST config is only used to
+// fetch results from plugins that store them instead of submitting them.
+func Run(kubeClient kubernetes.Interface, restConfig *rest.Config, cfg *config.Config) (errCount int) {
 	t := time.Now()
 
+	// The whole run is traced if an endpoint is configured, in a span the
+	// plugins' workers are told to trace themselves in too.
+	tracer := tracing.NewTracer(cfg.Tracing.Endpoint, "sonobuoy-aggregator", map[string]string{
+		"sonobuoy.run":       cfg.UUID,
+		"sonobuoy.namespace": cfg.Namespace,
+	})
+	defer tracer.Shutdown()
+	span := tracer.StartRoot("sonobuoy.run", tracing.RunSpanContext(cfg.UUID), nil)
+	defer func() {
+		var err error
+		if errCount > 0 {
+			err = errors.Errorf("%v errors during the run", errCount)
+		}
+		span.End(err)
+	}()
+
 	// 1. Create the directory which will store the results, including the
 	// `meta` directory inside it (which we always need regardless of
 	// config)
@@ -75,56 +95,177 @@ func Run(kubeClient kubernetes.Interface, cfg *config.Config) (errCount int) {
 		}
 	}
 
-	// 2. Get the list of namespaces and apply the regex filter on the namespace
-	nsfilter := fmt.Sprintf("%s|%s", cfg.Filters.Namespaces, cfg.Namespace)
-	logrus.Infof("Filtering namespaces based on the following regex:%s", nsfilter)
-	nslist, err := FilterNamespaces(kubeClient, nsfilter)
+	modules, err := EnabledModules(cfg.QueryModules)
 	if err != nil {
-		errlog.LogError(errors.Wrap(err, "could not filter namespaces"))
+		errlog.LogError(err)
 		return errCount + 1
 	}
 
-	// 3. Dump the config.json we used to run our test
+	// 2. Get the list of namespaces and apply the filters on the namespace.
+	// A namespace-scoped run can't list namespaces, and only queries its own.
+	nslist := []string{cfg.Namespace}
+	if !cfg.NamespaceScoped {
+		logrus.Infof("Filtering namespaces based on the following regex:%s", cfg.Filters.Namespaces)
+		nslist, err = SelectNamespaces(kubeClient, cfg.Filters, cfg.Namespace)
+		if err != nil {
+			errlog.LogError(errors.Wrap(err, "could not filter namespaces"))
+			return errCount + 1
+		}
+	}
+
+	// 3. Dump the config.json we used to run our test, and the versions and
+	// platform of the cluster it's run on
+	var runMeta *RunMetadata
 	if blob, err := json.Marshal(cfg); err == nil {
 		if err = ioutil.WriteFile(path.Join(metapath, "config.json"), blob, 0644); err != nil {
 			errlog.LogError(errors.Wrap(err, "could not write config.json file"))
 			return errCount + 1
 		}
+		runMeta = newRunMetadata(cfg, blob, t)
 	}
+	trackErrorsFor("recording cluster info")(
+		recordClusterInfo(kubeClient, metapath, cfg.NamespaceScoped),
+	)
 
 	// 4. Run the plugin aggregator
 	trackErrorsFor("running plugins")(
-		pluginaggregation.Run(kubeClient, cfg.LoadedPlugins, cfg.Aggregation, cfg.Namespace, outpath),
+		pluginaggregation.Run(kubeClient, restConfig, cfg.LoadedPlugins, cfg.Aggregation, cfg.Namespace, outpath, span),
 	)
 
-	// 5. Run the queries
+	// 5. Run the queries of each enabled module
+	queries := span.Child("queries", nil)
 	recorder := NewQueryRecorder()
-	trackErrorsFor("querying cluster resources")(
-		QueryClusterResources(kubeClient, recorder, cfg),
-	)
+	queryClient := kubeClient
+	if restConfig != nil {
+		if counting, err := recorder.CountingClient(queryConfig(restConfig, cfg.Queries)); err != nil {
+			errlog.LogError(errors.Wrap(err, "couldn't count API calls of queries"))
+		} else {
+			queryClient = counting
+		}
+	}
+	querier := NewQuerier(queryClient, recorder, cfg)
+	if cfg.NamespaceScoped {
+		logrus.Infof("Skipping non-ns query: run is namespace-scoped")
+	} else {
+		logrus.Infof("Running non-ns query")
+		for _, m := range modules {
+			trackErrorsFor("querying cluster resources for the " + m.Name() + " module")(
+				m.QueryCluster(querier),
+			)
+		}
+	}
 
 	for _, ns := range nslist {
-		trackErrorsFor("querying resources under namespace " + ns)(
-			QueryNSResources(kubeClient, recorder, ns, cfg),
-		)
+		logrus.Infof("Running ns query (%v)", ns)
+		if err := querier.makeNamespaceDir(ns); err != nil {
+			trackErrorsFor("querying resources under namespace " + ns)(err)
+			continue
+		}
+		for _, m := range modules {
+			trackErrorsFor("querying resources under namespace " + ns + " for the " + m.Name() + " module")(
+				m.QueryNamespace(querier, ns),
+			)
+		}
 	}
 
-	// 6. Dump the query times
+	queries.End(nil)
+
+	// 6. Dump the query times, and where the run came from and how long it
+	// took
 	trackErrorsFor("recording query times")(
 		recorder.DumpQueryData(path.Join(metapath, "query-time.json")),
 	)
+	if runMeta != nil {
+		trackErrorsFor("recording run metadata")(runMeta.write(outpath, time.Now()))
+	}
 
 	// 7. Clean up after the plugins
 	pluginaggregation.Cleanup(kubeClient, cfg.LoadedPlugins)
 
-	// 8. tarball up results YYYYMMDDHHMM_sonobuoy_UID.tar.gz
+	// 8. tarball up results YYYYMMDDHHMM_sonobuoy_UID.tar.gz, encrypting it
+	// if configured to
 	tb := cfg.ResultsDir + "/" + t.Format("200601021504") + "_sonobuoy_" + cfg.UUID + ".tar.gz"
-	err = tarx.Compress(tb, outpath, &tarx.CompressOptions{Compression: tarx.Gzip})
+	tarSpan := span.Child("results.tarball", nil)
+	err = compressResults(tb, outpath, cfg.Encryption)
+	tarSpan.End(err)
 	if err == nil {
 		defer os.RemoveAll(outpath)
 	}
 	trackErrorsFor("assembling results tarball")(err)
 	logrus.Infof("Results available at %v", tb)
+	location := tb
+
+	// 9. Upload the results tarball, if it's stored elsewhere too, marking
+	// it as retrieved once it's safely stored
+	if err == nil && cfg.Storage.Backend != "" {
+		storeSpan := span.Child("results.store", map[string]string{"sonobuoy.storage_backend": cfg.Storage.Backend})
+		var stored string
+		stored, err = storeResults(cfg.Storage, tb)
+		if err == nil {
+			location = stored
+			err = markRetrieved(cfg.ResultsDir)
+		}
+		storeSpan.End(err)
+		trackErrorsFor("storing results tarball")(err)
+	}
+
+	// 10. Remove old results tarballs, for recurring runs, wherever they're
+	// kept
+	if policy := newRetentionPolicy(cfg); policy.enabled() {
+		trackErrorsFor("removing old results tarballs")(
+			pruneResults(cfg.ResultsDir, policy),
+		)
+		if cfg.Storage.Backend != "" {
+			trackErrorsFor("removing old stored results tarballs")(
+				pruneStoredResults(cfg.Storage, policy),
+			)
+		}
+	}
+
+	// 11. Tell whoever's configured to be notified how the run went
+	if len(cfg.Notifications) > 0 {
+		notifySpan := span.Child("notify", nil)
+		summary, err := runSummary(cfg, outpath, errCount, location)
+		if err == nil {
+			err = notify.Send(cfg.Notifications, summary)
+		}
+		notifySpan.End(err)
+		trackErrorsFor("sending notifications")(err)
+	}
 
 	return errCount
 }
+
+// queryConfig returns a copy of restConfig that limits the rate of requests as
+// the query options say.
+func queryConfig(restConfig *rest.Config, opts config.QueryOptions) *rest.Config {
+	cfg := rest.CopyConfig(restConfig)
+	if opts.QPS > 0 {
+		cfg.QPS = opts.QPS
+	}
+	if opts.Burst > 0 {
+		cfg.Burst = opts.Burst
+	}
+	// client-go only defaults the burst if the QPS isn't set either.
+	if cfg.QPS > 0 && cfg.Burst <= 0 {
+		cfg.Burst = rest.DefaultBurst
+	}
+	return cfg
+}
+
+// compressResults writes the results tarball under a temporary name first, so
+// that it's only ever seen once it's complete, and encrypted if enc says so.
+func compressResults(tb, outpath string, enc encryption.Config) error {
+	partial := tb + ".partial"
+	if err := tarx.Compress(partial, outpath, &tarx.CompressOptions{Compression: tarx.Gzip}); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	if enc.Enabled() {
+		if err := encryption.EncryptFile(enc, partial); err != nil {
+			os.Remove(partial)
+			return err
+		}
+	}
+	return errors.WithStack(os.Rename(partial, tb))
+}
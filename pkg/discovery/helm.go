@@ -0,0 +1,206 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// helmReleaseSecretType is the type of the Secrets Helm v3 stores each
+	// revision of a release in.
+	helmReleaseSecretType = "helm.sh/release.v1"
+	// helmReleaseSelector selects the Secrets Helm manages.
+	helmReleaseSelector = "owner=helm"
+)
+
+// sensitiveHelmValue matches the keys of chart values that are redacted
+// before they're stored, whether or not redaction is turned on, since charts
+// are commonly given credentials in their values.
+var sensitiveHelmValue = regexp.MustCompile(`(?i)password|passwd|secret|token|credential|apikey|api_key|privatekey|private_key`)
+
+// HelmRelease is a revision of a Helm release, as stored in
+// resources/ns/<ns>/HelmReleases.json.
+type HelmRelease struct {
+	Name          string                 `json:"name"`
+	Namespace     string                 `json:"namespace"`
+	Revision      int                    `json:"revision"`
+	Status        string                 `json:"status,omitempty"`
+	Chart         string                 `json:"chart,omitempty"`
+	ChartVersion  string                 `json:"chartVersion,omitempty"`
+	AppVersion    string                 `json:"appVersion,omitempty"`
+	FirstDeployed string                 `json:"firstDeployed,omitempty"`
+	LastDeployed  string                 `json:"lastDeployed,omitempty"`
+	Description   string                 `json:"description,omitempty"`
+	Values        map[string]interface{} `json:"values,omitempty"`
+}
+
+// helmReleaseData is the part of the release Helm encodes into its Secrets
+// that's recorded. The chart's templates and the rendered manifest are left
+// out, since they're large and the manifest can include Secrets.
+type helmReleaseData struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Version   int    `json:"version"`
+	Info      struct {
+		FirstDeployed string `json:"first_deployed"`
+		LastDeployed  string `json:"last_deployed"`
+		Status        string `json:"status"`
+		Description   string `json:"description"`
+	} `json:"info"`
+	Chart struct {
+		Metadata struct {
+			Name       string `json:"name"`
+			Version    string `json:"version"`
+			AppVersion string `json:"appVersion"`
+		} `json:"metadata"`
+	} `json:"chart"`
+	Config map[string]interface{} `json:"config"`
+}
+
+// helmModule records the Helm v3 releases in each namespace, from the Secrets
+// Helm stores them in, since what's installed is often the first question
+// when triaging a cluster.
+type helmModule struct{}
+
+func (helmModule) Name() string {
+	return HelmModule
+}
+
+func (helmModule) QueryCluster(q *Querier) error {
+	return nil
+}
+
+func (helmModule) QueryNamespace(q *Querier, ns string) error {
+	if len(q.Wanted(ns, []string{"HelmReleases"})) > 0 {
+		q.QueryNamespace(ns, "HelmReleases", helmReleasesQuery(q.KubeClient, ns))
+	}
+	return nil
+}
+
+// helmReleasesQuery lists the revisions of the Helm releases in namespace ns,
+// or nothing if there aren't any.
+func helmReleasesQuery(kubeClient kubernetes.Interface, ns string) UntypedQuery {
+	return func() (interface{}, error) {
+		secrets, err := kubeClient.CoreV1().Secrets(ns).List(metav1.ListOptions{LabelSelector: helmReleaseSelector})
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't list Helm release secrets in %v", ns)
+		}
+
+		var releases []HelmRelease
+		for _, secret := range secrets.Items {
+			if secret.Type != helmReleaseSecretType {
+				continue
+			}
+			release, err := decodeHelmRelease(&secret)
+			if err != nil {
+				logrus.Warningf("Skipping Helm release secret %v/%v: %v", ns, secret.Name, err)
+				continue
+			}
+			releases = append(releases, *release)
+		}
+		if len(releases) == 0 {
+			return nil, nil
+		}
+		sort.Slice(releases, func(i, j int) bool {
+			if releases[i].Name != releases[j].Name {
+				return releases[i].Name < releases[j].Name
+			}
+			return releases[i].Revision < releases[j].Revision
+		})
+		return releases, nil
+	}
+}
+
+// decodeHelmRelease decodes the release Helm stores in a Secret: base64
+// encoded, usually gzipped, JSON.
+func decodeHelmRelease(secret *corev1.Secret) (*HelmRelease, error) {
+	encoded, ok := secret.Data["release"]
+	if !ok {
+		return nil, errors.New("no release data")
+	}
+	data, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't decode release data")
+	}
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't decompress release data")
+		}
+		if data, err = ioutil.ReadAll(gz); err != nil {
+			return nil, errors.Wrap(err, "couldn't decompress release data")
+		}
+	}
+
+	var rel helmReleaseData
+	if err := json.Unmarshal(data, &rel); err != nil {
+		return nil, errors.Wrap(err, "couldn't decode release")
+	}
+	return &HelmRelease{
+		Name:          rel.Name,
+		Namespace:     rel.Namespace,
+		Revision:      rel.Version,
+		Status:        rel.Info.Status,
+		Chart:         rel.Chart.Metadata.Name,
+		ChartVersion:  rel.Chart.Metadata.Version,
+		AppVersion:    rel.Chart.Metadata.AppVersion,
+		FirstDeployed: rel.Info.FirstDeployed,
+		LastDeployed:  rel.Info.LastDeployed,
+		Description:   rel.Info.Description,
+		Values:        redactHelmValues(rel.Config),
+	}, nil
+}
+
+// redactHelmValues replaces the values of sensitive keys in values, and any
+// maps nested in it.
+func redactHelmValues(values map[string]interface{}) map[string]interface{} {
+	for key, value := range values {
+		if sensitiveHelmValue.MatchString(key) {
+			values[key] = Redacted
+			continue
+		}
+		values[key] = redactHelmValue(value)
+	}
+	return values
+}
+
+func redactHelmValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return redactHelmValues(v)
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactHelmValue(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// helmReleaseSecret returns a Secret like Helm v3 stores the release in.
+func helmReleaseSecret(t *testing.T, name string, release string, compress bool) corev1.Secret {
+	data := []byte(release)
+	if compress {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		if err := gz.Close(); err != nil {
+			t.Fatalf("couldn't compress release: %v", err)
+		}
+		data = buf.Bytes()
+	}
+	return corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"owner": "helm"}},
+		Type:       helmReleaseSecretType,
+		Data:       map[string][]byte{"release": []byte(base64.StdEncoding.EncodeToString(data))},
+	}
+}
+
+func TestHelmReleasesQuery(t *testing.T) {
+	secrets := corev1.SecretList{
+		TypeMeta: metav1.TypeMeta{Kind: "SecretList", APIVersion: "v1"},
+		Items: []corev1.Secret{
+			helmReleaseSecret(t, "sh.helm.release.v1.web.v2", `{
+				"name": "web", "namespace": "apps", "version": 2,
+				"info": {"first_deployed": "2018-06-01T10:00:00Z", "last_deployed": "2018-06-02T10:00:00Z", "status": "deployed", "description": "Upgrade complete"},
+				"chart": {"metadata": {"name": "nginx", "version": "1.2.0", "appVersion": "1.15"}, "templates": [{"name": "deployment.yaml"}]},
+				"config": {"replicas": 3, "auth": {"adminPassword": "hunter2", "users": [{"name": "bob", "apiToken": "abc"}]}},
+				"manifest": "kind: Secret"
+			}`, true),
+			helmReleaseSecret(t, "sh.helm.release.v1.web.v1", `{
+				"name": "web", "namespace": "apps", "version": 1,
+				"info": {"status": "superseded"},
+				"chart": {"metadata": {"name": "nginx", "version": "1.1.0"}}
+			}`, false),
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "sh.helm.release.v1.broken.v1", Labels: map[string]string{"owner": "helm"}},
+				Type:       helmReleaseSecretType,
+				Data:       map[string][]byte{"release": []byte("not base64!")},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Labels: map[string]string{"owner": "helm"}},
+				Type:       corev1.SecretTypeOpaque,
+			},
+		},
+	}
+
+	var labelSelector string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/apps/secrets" {
+			http.NotFound(w, r)
+			return
+		}
+		labelSelector = r.URL.Query().Get("labelSelector")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(secrets)
+	}))
+	defer srv.Close()
+	kubeClient, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatalf("couldn't create client: %v", err)
+	}
+
+	obj, err := helmReleasesQuery(kubeClient, "apps")()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if labelSelector != helmReleaseSelector {
+		t.Errorf("expected secrets to be listed with selector %q, got %q", helmReleaseSelector, labelSelector)
+	}
+
+	expected := []HelmRelease{
+		{
+			Name: "web", Namespace: "apps", Revision: 1, Status: "superseded",
+			Chart: "nginx", ChartVersion: "1.1.0",
+		},
+		{
+			Name: "web", Namespace: "apps", Revision: 2, Status: "deployed",
+			Chart: "nginx", ChartVersion: "1.2.0", AppVersion: "1.15",
+			FirstDeployed: "2018-06-01T10:00:00Z", LastDeployed: "2018-06-02T10:00:00Z",
+			Description: "Upgrade complete",
+			Values: map[string]interface{}{
+				"replicas": float64(3),
+				"auth": map[string]interface{}{
+					"adminPassword": Redacted,
+					"users":         []interface{}{map[string]interface{}{"name": "bob", "apiToken": Redacted}},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(obj, expected) {
+		t.Errorf("expected releases %+v, got %+v", expected, obj)
+	}
+}
+
+func TestHelmReleasesQuery_none(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"kind": "SecretList", "apiVersion": "v1", "items": []}`))
+	}))
+	defer srv.Close()
+	kubeClient, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatalf("couldn't create client: %v", err)
+	}
+
+	obj, err := helmReleasesQuery(kubeClient, "apps")()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if obj != nil {
+		t.Errorf("expected nothing to be stored without releases, got %v", obj)
+	}
+}
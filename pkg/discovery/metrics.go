@@ -0,0 +1,73 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// metricsAPIPath is where the resource metrics API is served, by
+// metrics-server or an equivalent, if the cluster has one.
+const metricsAPIPath = "/apis/metrics.k8s.io/v1beta1"
+
+// metricsModule queries current node and pod resource usage from the metrics
+// API. Clusters without it are skipped over.
+type metricsModule struct{}
+
+func (metricsModule) Name() string {
+	return MetricsModule
+}
+
+func (metricsModule) QueryCluster(q *Querier) error {
+	if len(q.Wanted("", []string{"NodeMetrics"})) > 0 {
+		q.QueryCluster("NodeMetrics", metricsQuery(q.KubeClient, metricsAPIPath+"/nodes"))
+	}
+	return nil
+}
+
+func (metricsModule) QueryNamespace(q *Querier, ns string) error {
+	if len(q.Wanted(ns, []string{"PodMetrics"})) > 0 {
+		q.QueryNamespace(ns, "PodMetrics", metricsQuery(q.KubeClient, metricsAPIPath+"/namespaces/"+ns+"/pods"))
+	}
+	return nil
+}
+
+// metricsQuery gets the metrics at the given path of the API server, or
+// nothing if the metrics API isn't served.
+func metricsQuery(kubeClient kubernetes.Interface, path string) UntypedQuery {
+	return func() (interface{}, error) {
+		body, err := kubeClient.CoreV1().RESTClient().Get().AbsPath(path).DoRaw()
+		if apierrors.IsNotFound(err) {
+			logrus.Infof("Metrics API not available, skipping %v", path)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't get metrics from %v", path)
+		}
+
+		var metrics map[string]interface{}
+		if err := json.Unmarshal(body, &metrics); err != nil {
+			return nil, errors.Wrapf(err, "couldn't decode metrics from %v", path)
+		}
+		return metrics, nil
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// CoreModule queries nodes, workloads, pod logs and the other core
+	// resources, along with the server's version and API groups.
+	CoreModule = "core"
+	// RBACModule queries roles and role bindings.
+	RBACModule = "rbac"
+	// CRDModule queries custom resource definitions.
+	CRDModule = "crds"
+	// MetricsModule queries node and pod resource usage from the metrics
+	// API, if the cluster serves it.
+	MetricsModule = "metrics"
+	// HelmModule queries the Helm v3 releases installed in each namespace.
+	HelmModule = "helm"
+)
+
+// Module is a group of queries whose results are gathered into the results
+// tarball. Sonobuoy's own queries are split into the core, rbac, crds, metrics
+// and helm modules; others can be compiled into a custom build of Sonobuoy and
+// registered with RegisterModule.
+type Module interface {
+	// Name is what the module is called in the config's QueryModules.
+	Name() string
+	// QueryCluster runs the module's queries for cluster-scoped data.
+	QueryCluster(q *Querier) error
+	// QueryNamespace runs the module's queries for data in namespace ns.
+	QueryNamespace(q *Querier, ns string) error
+}
+
+var (
+	modulesMutex sync.Mutex
+	modules      []Module
+)
+
+// RegisterModule makes a module available to be run. It's meant to be called
+// from the init function of the package the module is defined in, and panics
+// if a module with the same name has already been registered.
+func RegisterModule(m Module) {
+	modulesMutex.Lock()
+	defer modulesMutex.Unlock()
+
+	for _, registered := range modules {
+		if registered.Name() == m.Name() {
+			panic(fmt.Sprintf("query module %v registered twice", m.Name()))
+		}
+	}
+	modules = append(modules, m)
+}
+
+// RegisteredModules returns the names of the registered modules, in the order
+// they're run.
+func RegisteredModules() []string {
+	modulesMutex.Lock()
+	defer modulesMutex.Unlock()
+
+	names := make([]string, 0, len(modules))
+	for _, m := range modules {
+		names = append(names, m.Name())
+	}
+	return names
+}
+
+// EnabledModules returns the registered modules with the given names, in the
+// order they're run, or all of them if there are no names.
+func EnabledModules(names []string) ([]Module, error) {
+	modulesMutex.Lock()
+	defer modulesMutex.Unlock()
+
+	if len(names) == 0 {
+		return append([]Module(nil), modules...), nil
+	}
+
+	enabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		enabled[name] = true
+	}
+	var selected []Module
+	for _, m := range modules {
+		if enabled[m.Name()] {
+			selected = append(selected, m)
+			delete(enabled, m.Name())
+		}
+	}
+	if len(enabled) > 0 {
+		var unknown []string
+		for _, name := range names {
+			if enabled[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		return nil, errors.Errorf("unknown query modules %v", strings.Join(unknown, ", "))
+	}
+	return selected, nil
+}
+
+// Querier is what modules run their queries with. It records how long each
+// query takes, for meta/query-time.json, and stores what they return in the
+// run's results.
+type Querier struct {
+	// KubeClient is the client for the cluster being queried.
+	KubeClient kubernetes.Interface
+	// Config is the config of the run.
+	Config *config.Config
+
+	recorder *QueryRecorder
+	redactor *redactor
+}
+
+// NewQuerier returns a Querier for the run with the given config, which
+// records its queries with recorder.
+func NewQuerier(kubeClient kubernetes.Interface, recorder *QueryRecorder, cfg *config.Config) *Querier {
+	return &Querier{KubeClient: kubeClient, Config: cfg, recorder: recorder, redactor: newRedactor(cfg.Redaction)}
+}
+
+// ListOptions returns the options to list namespaced resources with, which
+// select only those matching the config's label selector, if it has one.
+func (q *Querier) ListOptions() metav1.ListOptions {
+	opts := metav1.ListOptions{}
+	if selector := q.Config.Filters.LabelSelector; len(selector) > 0 {
+		if _, err := labels.Parse(selector); err != nil {
+			logrus.Warningf("Labelselector %v failed to parse with error %v", selector, err)
+		} else {
+			opts.LabelSelector = selector
+		}
+	}
+	return opts
+}
+
+// Wanted returns those of resources that the config's Resources ask for, in
+// namespace ns or, if it's empty, across the cluster. Everything is wanted in
+// Sonobuoy's own namespace.
+func (q *Querier) Wanted(ns string, resources []string) []string {
+	if ns != "" && ns == q.Config.Namespace {
+		return resources
+	}
+	return q.Config.FilterResources(resources)
+}
+
+// QueryCluster runs f, a query for cluster-scoped data, recording it as name.
+// What it returns, if anything, is stored as resources/cluster/<name>.json.
+// Failed queries are recorded, rather than stopping the module.
+func (q *Querier) QueryCluster(name string, f UntypedQuery) {
+	q.query(name, "", path.Join(q.Config.OutputDir(), ClusterResourceLocation), f)
+}
+
+// QueryNamespace runs f, a query for data in namespace ns, recording it as
+// name. What it returns, if anything, is stored as
+// resources/ns/<ns>/<name>.json. Failed queries are recorded, rather than
+// stopping the module.
+func (q *Querier) QueryNamespace(ns, name string, f UntypedQuery) {
+	q.query(name, ns, path.Join(q.Config.OutputDir(), NSResourceLocation, ns), f)
+}
+
+func (q *Querier) query(name, ns, outdir string, f UntypedQuery) {
+	timedQuery(q.recorder, name, ns, func() (time.Duration, error) {
+		return untypedQuery(outdir, name+".json", f, q.redactor)
+	})
+}
+
+// makeNamespaceDir creates the directory resources in namespace ns are stored
+// in, whether or not any are found.
+func (q *Querier) makeNamespaceDir(ns string) error {
+	return errors.WithStack(os.MkdirAll(path.Join(q.Config.OutputDir(), NSResourceLocation, ns), 0755))
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+)
+
+func TestBuiltinModules(t *testing.T) {
+	expected := []string{CoreModule, RBACModule, CRDModule, MetricsModule, HelmModule}
+	if names := RegisteredModules(); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected the built-in modules %v, got %v", expected, names)
+	}
+
+	// Every resource in the config belongs to exactly one module.
+	owners := map[string][]string{}
+	addOwner := func(m *resourceModule) {
+		for _, r := range append(append([]string(nil), m.clusterResources...), m.nsResources...) {
+			owners[r] = append(owners[r], m.name)
+		}
+	}
+	for _, m := range modules {
+		switch m := m.(type) {
+		case *resourceModule:
+			addOwner(m)
+		case *crdModule:
+			addOwner(&m.resourceModule)
+		case metricsModule:
+			owners["NodeMetrics"] = append(owners["NodeMetrics"], m.Name())
+			owners["PodMetrics"] = append(owners["PodMetrics"], m.Name())
+		case helmModule:
+			owners["HelmReleases"] = append(owners["HelmReleases"], m.Name())
+		}
+	}
+	resources := append(append([]string(nil), config.ClusterResources...), config.NamespacedResources...)
+	for _, r := range resources {
+		if len(owners[r]) != 1 {
+			t.Errorf("expected %v to be queried by one module, got %v", r, owners[r])
+		}
+	}
+	if len(owners) != len(resources) {
+		t.Errorf("expected modules to only query the config's %d resources, got %d", len(resources), len(owners))
+	}
+}
+
+func TestEnabledModules(t *testing.T) {
+	testCases := []struct {
+		name      string
+		enabled   []string
+		expected  []string
+		expectErr bool
+	}{
+		{name: "default", expected: RegisteredModules()},
+		{name: "subset in run order", enabled: []string{MetricsModule, CoreModule}, expected: []string{CoreModule, MetricsModule}},
+		{name: "unknown", enabled: []string{CoreModule, "nope"}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			enabled, err := EnabledModules(tc.enabled)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got modules %v", enabled)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var names []string
+			for _, m := range enabled {
+				names = append(names, m.Name())
+			}
+			if !reflect.DeepEqual(names, tc.expected) {
+				t.Errorf("expected modules %v, got %v", tc.expected, names)
+			}
+		})
+	}
+}
+
+func TestRegisterModule_duplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering a module twice to panic")
+		}
+	}()
+	RegisterModule(metricsModule{})
+}
+
+func TestQuerier(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "sonobuoy_discovery_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	cfg := &config.Config{ResultsDir: tmpdir, UUID: "run", Namespace: "heptio-sonobuoy", Resources: []string{"Widgets"}}
+	recorder := NewQueryRecorder()
+	q := NewQuerier(nil, recorder, cfg)
+
+	if wanted := q.Wanted("default", []string{"Widgets", "Gadgets"}); !reflect.DeepEqual(wanted, []string{"Widgets"}) {
+		t.Errorf("expected only the configured resources to be wanted, got %v", wanted)
+	}
+	if wanted := q.Wanted("heptio-sonobuoy", []string{"Widgets", "Gadgets"}); len(wanted) != 2 {
+		t.Errorf("expected everything to be wanted in Sonobuoy's namespace, got %v", wanted)
+	}
+
+	q.QueryNamespace("default", "Widgets", func() (interface{}, error) {
+		return map[string]string{"widget": "blue"}, nil
+	})
+	q.QueryCluster("Gadgets", func() (interface{}, error) {
+		return nil, nil
+	})
+
+	contents, err := ioutil.ReadFile(path.Join(cfg.OutputDir(), NSResourceLocation, "default", "Widgets.json"))
+	if err != nil {
+		t.Fatalf("expected the query's results to be stored: %v", err)
+	}
+	if string(contents) != `{"widget":"blue"}` {
+		t.Errorf("unexpected results %s", contents)
+	}
+	if _, err := os.Stat(path.Join(cfg.OutputDir(), ClusterResourceLocation, "Gadgets.json")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be stored for an empty query, got %v", err)
+	}
+	if len(recorder.queries) != 2 || recorder.queries[0].QueryObj != "Widgets" || recorder.queries[0].Namespace != "default" {
+		t.Errorf("expected both queries to be recorded, got %+v", recorder.queries)
+	}
+}
@@ -69,7 +69,7 @@ func gatherNodeData(kubeClient kubernetes.Interface, cfg *config.Config) error {
 			}
 
 			return configz, err
-		})
+		}, nil)
 		if err != nil {
 			return err
 		}
@@ -90,7 +90,7 @@ func gatherNodeData(kubeClient kubernetes.Interface, cfg *config.Config) error {
 				logrus.Warningf("Could not get healthz endpoint for node %v: %v", node.Name, result.Error())
 			}
 			return health, err
-		})
+		}, nil)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,84 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ListFunc lists a kind of object with the given options.
+type ListFunc func(opts metav1.ListOptions) (runtime.Object, error)
+
+// listPages lists every object list returns, pageSize at a time, so that no
+// one request makes the API server gather tens of thousands of them. The
+// objects are returned together in the first page's list. If the continue
+// token expires partway through, they're listed again all at once. A page size
+// of zero lists them all at once to begin with.
+func listPages(opts metav1.ListOptions, pageSize int64, list ListFunc) (runtime.Object, error) {
+	if pageSize <= 0 {
+		return list(opts)
+	}
+
+	opts.Limit = pageSize
+	var all runtime.Object
+	var items []runtime.Object
+	for {
+		page, err := list(opts)
+		if err != nil {
+			if opts.Continue != "" && (apierrors.IsResourceExpired(err) || apierrors.IsGone(err)) {
+				opts.Limit, opts.Continue = 0, ""
+				return list(opts)
+			}
+			return nil, err
+		}
+		if page == nil {
+			return nil, errors.New("got invalid response from API server")
+		}
+
+		pageItems, err := meta.ExtractList(page)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		items = append(items, pageItems...)
+		if all == nil {
+			all = page
+		}
+
+		listMeta, err := meta.ListAccessor(page)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if listMeta.GetContinue() == "" {
+			break
+		}
+		opts.Continue = listMeta.GetContinue()
+	}
+
+	if err := meta.SetList(all, items); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	listMeta, err := meta.ListAccessor(all)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	listMeta.SetContinue("")
+	return all, nil
+}
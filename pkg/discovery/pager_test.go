@@ -0,0 +1,118 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// podPages serves pods named pod-0 to pod-<count-1> a page at a time, failing
+// continued lists once expireAfter pages have been served, if it's set.
+type podPages struct {
+	count       int
+	expireAfter int
+	requests    []metav1.ListOptions
+}
+
+func (p *podPages) list(opts metav1.ListOptions) (runtime.Object, error) {
+	p.requests = append(p.requests, opts)
+	if p.expireAfter > 0 && opts.Continue != "" && len(p.requests) > p.expireAfter {
+		return nil, apierrors.NewResourceExpired("continue token expired")
+	}
+
+	start, _ := strconv.Atoi(opts.Continue)
+	end := p.count
+	if opts.Limit > 0 && start+int(opts.Limit) < p.count {
+		end = start + int(opts.Limit)
+	}
+	list := &v1.PodList{}
+	for i := start; i < end; i++ {
+		list.Items = append(list.Items, v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod-" + strconv.Itoa(i)}})
+	}
+	if end < p.count {
+		list.Continue = strconv.Itoa(end)
+	}
+	return list, nil
+}
+
+func podNames(t *testing.T, obj runtime.Object) []string {
+	list, ok := obj.(*v1.PodList)
+	if !ok {
+		t.Fatalf("expected a pod list, got %T", obj)
+	}
+	if list.Continue != "" {
+		t.Errorf("expected no continue token in the combined list, got %q", list.Continue)
+	}
+	names := []string{}
+	for _, pod := range list.Items {
+		names = append(names, pod.Name)
+	}
+	return names
+}
+
+func TestListPages(t *testing.T) {
+	testCases := []struct {
+		name           string
+		pages          *podPages
+		pageSize       int64
+		expectRequests int
+	}{
+		{name: "one page", pages: &podPages{count: 3}, pageSize: 5, expectRequests: 1},
+		{name: "several pages", pages: &podPages{count: 5}, pageSize: 2, expectRequests: 3},
+		{name: "no paging", pages: &podPages{count: 5}, pageSize: 0, expectRequests: 1},
+		{name: "expired continue token", pages: &podPages{count: 5, expireAfter: 1}, pageSize: 2, expectRequests: 3},
+	}
+
+	expected := []string{"pod-0", "pod-1", "pod-2", "pod-3", "pod-4"}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			list, err := listPages(metav1.ListOptions{LabelSelector: "app=web"}, tc.pageSize, tc.pages.list)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if names := podNames(t, list); !reflect.DeepEqual(names, expected[:tc.pages.count]) {
+				t.Errorf("expected pods %v, got %v", expected[:tc.pages.count], names)
+			}
+			if len(tc.pages.requests) != tc.expectRequests {
+				t.Errorf("expected %d requests, got %d", tc.expectRequests, len(tc.pages.requests))
+			}
+			for _, opts := range tc.pages.requests {
+				if opts.LabelSelector != "app=web" {
+					t.Errorf("expected every request to keep the label selector, got %+v", opts)
+				}
+			}
+		})
+	}
+}
+
+func TestListPages_error(t *testing.T) {
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", nil)
+	_, err := listPages(metav1.ListOptions{}, 2, func(metav1.ListOptions) (runtime.Object, error) {
+		return nil, forbidden
+	})
+	if err != forbidden {
+		t.Errorf("expected the list's error, got %v", err)
+	}
+}
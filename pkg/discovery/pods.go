@@ -20,13 +20,16 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"regexp"
 	"time"
 
 	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/errlog"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -36,10 +39,39 @@ const (
 	PodLogsLocation = "podlogs"
 )
 
+// podLogsWanted returns whether pod logs are collected from namespace ns,
+// which the config's PodLogs can narrow down. They're always collected from
+// Sonobuoy's own namespace.
+func podLogsWanted(cfg *config.Config, ns string) bool {
+	if cfg.PodLogs.Namespaces == "" || ns == cfg.Namespace {
+		return true
+	}
+	re, err := regexp.Compile(cfg.PodLogs.Namespaces)
+	if err != nil {
+		logrus.Warningf("Pod log namespaces %v failed to parse with error %v", cfg.PodLogs.Namespaces, err)
+		return true
+	}
+	return re.MatchString(ns)
+}
+
+// podLogListOptions returns the options to list the pods whose logs are
+// collected with, using the config's PodLogs label selector in place of
+// opts' if it has one.
+func podLogListOptions(cfg *config.Config, opts metav1.ListOptions) metav1.ListOptions {
+	if selector := cfg.PodLogs.LabelSelector; len(selector) > 0 {
+		if _, err := labels.Parse(selector); err != nil {
+			logrus.Warningf("Pod log labelselector %v failed to parse with error %v", selector, err)
+		} else {
+			opts.LabelSelector = selector
+		}
+	}
+	return opts
+}
+
 // gatherPodLogs will loop through collecting pod logs and placing them into a directory tree
 func gatherPodLogs(kubeClient kubernetes.Interface, ns string, opts metav1.ListOptions, cfg *config.Config) error {
 	// 1 - Collect the list of pods
-	podlist, err := kubeClient.CoreV1().Pods(ns).List(opts)
+	podlist, err := kubeClient.CoreV1().Pods(ns).List(podLogListOptions(cfg, opts))
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -50,36 +82,55 @@ func gatherPodLogs(kubeClient kubernetes.Interface, ns string, opts metav1.ListO
 
 	// 2 - Foreach pod, dump each of its containers' logs in a tree in the following location:
 	//   pods/:podname/logs/:containername.txt
+	// Containers which have restarted also have the logs of their previous
+	// run, which is usually what explains a failing workload, in
+	// :containername-previous.txt. A container whose logs can't be fetched,
+	// such as one that hasn't started yet, is logged and skipped.
 	for _, pod := range podlist.Items {
 		if pod.Status.Phase == v1.PodFailed && pod.Status.Reason == "Evicted" {
 			logrus.WithField("podName", pod.Name).Info("Skipping evicted pod.")
 			continue
 		}
-		for _, container := range pod.Spec.Containers {
-			body, err := kubeClient.CoreV1().Pods(ns).GetLogs(
-				pod.Name,
-				&v1.PodLogOptions{
-					Container:    container.Name,
-					LimitBytes:   &limitBytes,
-					SinceSeconds: &limitTime,
-				},
-			).Do().Raw()
-
-			if err != nil {
-				return errors.WithStack(err)
-			}
 
-			outdir := path.Join(cfg.OutputDir(), PodLogsLocation, ns, pod.Name, "logs")
-			if err = os.MkdirAll(outdir, 0755); err != nil {
-				return errors.WithStack(err)
+		restarted := map[string]bool{}
+		for _, status := range append(append([]v1.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+			restarted[status.Name] = status.RestartCount > 0
+		}
+
+		outdir := path.Join(cfg.OutputDir(), PodLogsLocation, ns, pod.Name, "logs")
+		for _, container := range append(append([]v1.Container(nil), pod.Spec.InitContainers...), pod.Spec.Containers...) {
+			logOpts := v1.PodLogOptions{
+				Container:    container.Name,
+				LimitBytes:   &limitBytes,
+				SinceSeconds: &limitTime,
+			}
+			if err := writePodLogs(kubeClient, ns, pod.Name, logOpts, outdir, container.Name+".txt"); err != nil {
+				errlog.LogError(errors.Wrapf(err, "could not collect logs of container %v in pod %v/%v", container.Name, ns, pod.Name))
 			}
 
-			outfile := path.Join(outdir, container.Name) + ".txt"
-			if err = ioutil.WriteFile(outfile, body, 0644); err != nil {
-				return errors.WithStack(err)
+			if restarted[container.Name] {
+				logOpts.Previous = true
+				if err := writePodLogs(kubeClient, ns, pod.Name, logOpts, outdir, container.Name+"-previous.txt"); err != nil {
+					errlog.LogError(errors.Wrapf(err, "could not collect previous logs of container %v in pod %v/%v", container.Name, ns, pod.Name))
+				}
 			}
 		}
 	}
 
 	return nil
 }
+
+// writePodLogs writes the logs of pod podName selected by logOpts to file in
+// outdir.
+func writePodLogs(kubeClient kubernetes.Interface, ns, podName string, logOpts v1.PodLogOptions, outdir, file string) error {
+	body, err := kubeClient.CoreV1().Pods(ns).GetLogs(podName, &logOpts).Do().Raw()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err = os.MkdirAll(outdir, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(ioutil.WriteFile(path.Join(outdir, file), body, 0644))
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestPodLogsWanted(t *testing.T) {
+	testCases := []struct {
+		namespaces string
+		ns         string
+		expected   bool
+	}{
+		{namespaces: "", ns: "default", expected: true},
+		{namespaces: "^kube-", ns: "kube-system", expected: true},
+		{namespaces: "^kube-", ns: "default", expected: false},
+		{namespaces: "^kube-", ns: "heptio-sonobuoy", expected: true},
+	}
+
+	for _, tc := range testCases {
+		cfg := &config.Config{Namespace: "heptio-sonobuoy", PodLogs: config.PodLogOptions{Namespaces: tc.namespaces}}
+		if wanted := podLogsWanted(cfg, tc.ns); wanted != tc.expected {
+			t.Errorf("expected pod logs from %v with namespaces %q to be wanted: %v, got %v", tc.ns, tc.namespaces, tc.expected, wanted)
+		}
+	}
+}
+
+func TestGatherPodLogs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/namespaces/default/pods":
+			if got := r.URL.Query().Get("labelSelector"); got != "app=failing" {
+				t.Errorf("expected the pod log label selector to be used, got %q", got)
+			}
+			fmt.Fprint(w, `{"kind": "PodList", "apiVersion": "v1", "items": [{
+				"metadata": {"name": "failing"},
+				"spec": {"initContainers": [{"name": "setup"}], "containers": [{"name": "app"}, {"name": "pending"}]},
+				"status": {"containerStatuses": [{"name": "app", "restartCount": 3}]}
+			}]}`)
+		case "/api/v1/namespaces/default/pods/failing/log":
+			container := r.URL.Query().Get("container")
+			if container == "pending" {
+				http.Error(w, "container is waiting to start", http.StatusBadRequest)
+				return
+			}
+			if r.URL.Query().Get("previous") == "true" {
+				container += " (previous)"
+			}
+			fmt.Fprintf(w, "logs of %v", container)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	kubeClient, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatalf("couldn't create client: %v", err)
+	}
+
+	tmpdir, err := ioutil.TempDir("", "sonobuoy_discovery_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	cfg := &config.Config{ResultsDir: tmpdir, UUID: "run", PodLogs: config.PodLogOptions{LabelSelector: "app=failing"}}
+	if err := gatherPodLogs(kubeClient, "default", metav1.ListOptions{LabelSelector: "app=other"}, cfg); err != nil {
+		t.Fatalf("unexpected error gathering pod logs: %v", err)
+	}
+
+	logdir := path.Join(cfg.OutputDir(), PodLogsLocation, "default", "failing", "logs")
+	expected := map[string]string{
+		"setup.txt":        "logs of setup",
+		"app.txt":          "logs of app",
+		"app-previous.txt": "logs of app (previous)",
+	}
+	files, err := ioutil.ReadDir(logdir)
+	if err != nil {
+		t.Fatalf("couldn't read logs: %v", err)
+	}
+	if len(files) != len(expected) {
+		t.Errorf("expected %d log files, got %d", len(expected), len(files))
+	}
+	for file, logs := range expected {
+		contents, err := ioutil.ReadFile(path.Join(logdir, file))
+		if err != nil {
+			t.Errorf("expected %v to be collected: %v", file, err)
+			continue
+		}
+		if string(contents) != logs {
+			t.Errorf("expected %v to hold %q, got %q", file, logs, contents)
+		}
+	}
+}
@@ -21,15 +21,11 @@ import (
 	"path"
 	"time"
 
-	"github.com/heptio/sonobuoy/pkg/config"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
-	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/conversion"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 )
@@ -54,8 +50,9 @@ const (
 	MetaLocation = "meta"
 )
 
-// objListQuery performs a list query and serialize the results
-func objListQuery(outpath string, file string, f ObjQuery) (time.Duration, error) {
+// objListQuery performs a list query and serialize the results, redacted by r
+// if it isn't nil
+func objListQuery(outpath string, file string, f ObjQuery, r *redactor) (time.Duration, error) {
 	start := time.Now()
 	listObj, err := f()
 	duration := time.Since(start)
@@ -77,18 +74,19 @@ func objListQuery(outpath string, file string, f ObjQuery) (time.Duration, error
 	}
 
 	if items.Len() > 0 {
-		err = errors.WithStack(SerializeObj(listPtr, outpath, file))
+		err = errors.WithStack(serializeRedacted(r, listPtr, outpath, file))
 	}
 	return duration, err
 }
 
-// untypedQuery performs a untyped query and serialize the results
-func untypedQuery(outpath string, file string, f UntypedQuery) (time.Duration, error) {
+// untypedQuery performs a untyped query and serialize the results, redacted by
+// r if it isn't nil
+func untypedQuery(outpath string, file string, f UntypedQuery, r *redactor) (time.Duration, error) {
 	start := time.Now()
 	Obj, err := f()
 	duration := time.Since(start)
 	if err == nil && Obj != nil {
-		err = SerializeObj(Obj, outpath, file)
+		err = serializeRedacted(r, Obj, outpath, file)
 	}
 	return duration, err
 }
@@ -106,6 +104,7 @@ func untypedListQuery(outpath string, file string, f UntypedListQuery) (time.Dur
 
 // timedQuery Wraps the execution of the function with a recorded timed snapshot
 func timedQuery(recorder *QueryRecorder, name string, ns string, fn func() (time.Duration, error)) {
+	recorder.StartQuery()
 	duration, fnErr := fn()
 	recorder.RecordQuery(name, ns, duration, fnErr)
 }
@@ -231,49 +230,44 @@ func queryNsResource(ns string, resourceKind string, opts metav1.ListOptions, ku
 }
 
 // queryNonNsResource performs the appropriate non-namespace-scoped query according to its input args
-func queryNonNsResource(resourceKind string, kubeClient kubernetes.Interface) (runtime.Object, error) {
+func queryNonNsResource(resourceKind string, opts metav1.ListOptions, kubeClient kubernetes.Interface) (runtime.Object, error) {
 	switch resourceKind {
 	case "CertificateSigningRequests":
-		return kubeClient.CertificatesV1beta1().CertificateSigningRequests().List(metav1.ListOptions{})
+		return kubeClient.CertificatesV1beta1().CertificateSigningRequests().List(opts)
 	case "ClusterRoleBindings":
-		lst, err := kubeClient.RbacV1().ClusterRoleBindings().List(metav1.ListOptions{})
+		lst, err := kubeClient.RbacV1().ClusterRoleBindings().List(opts)
 		if apierrors.IsNotFound(err) {
-			lst, err := kubeClient.RbacV1beta1().ClusterRoleBindings().List(metav1.ListOptions{})
+			lst, err := kubeClient.RbacV1beta1().ClusterRoleBindings().List(opts)
 			if apierrors.IsNotFound(err) {
-				return kubeClient.RbacV1alpha1().ClusterRoleBindings().List(metav1.ListOptions{})
+				return kubeClient.RbacV1alpha1().ClusterRoleBindings().List(opts)
 			}
 			return lst, err
 		}
 		return lst, err
 	case "ClusterRoles":
-		lst, err := kubeClient.RbacV1().ClusterRoles().List(metav1.ListOptions{})
+		lst, err := kubeClient.RbacV1().ClusterRoles().List(opts)
 		if apierrors.IsNotFound(err) {
-			lst, err := kubeClient.RbacV1beta1().ClusterRoles().List(metav1.ListOptions{})
+			lst, err := kubeClient.RbacV1beta1().ClusterRoles().List(opts)
 			if apierrors.IsNotFound(err) {
-				return kubeClient.RbacV1alpha1().ClusterRoles().List(metav1.ListOptions{})
+				return kubeClient.RbacV1alpha1().ClusterRoles().List(opts)
 			}
 			return lst, err
 		}
 		return lst, err
 	case "ComponentStatuses":
-		return kubeClient.CoreV1().ComponentStatuses().List(metav1.ListOptions{})
+		return kubeClient.CoreV1().ComponentStatuses().List(opts)
 	case "CustomResourceDefinitions":
-		// TODO : This should get cleaned up in future revisions.
-		apiextensionsclientset := apiextensionsclient.New(kubeClient.CoreV1().RESTClient())
-		if apiextensionsclientset != nil {
-			return apiextensionsclientset.ApiextensionsV1beta1().CustomResourceDefinitions().List(metav1.ListOptions{})
-		}
-		return nil, errors.Errorf("Failed to create extensions client for CRDs")
+		return listCustomResourceDefinitions(kubeClient)
 	case "Nodes":
-		return kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
+		return kubeClient.CoreV1().Nodes().List(opts)
 	case "PersistentVolumes":
-		return kubeClient.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
+		return kubeClient.CoreV1().PersistentVolumes().List(opts)
 	case "PodSecurityPolicies":
-		return kubeClient.ExtensionsV1beta1().PodSecurityPolicies().List(metav1.ListOptions{})
+		return kubeClient.ExtensionsV1beta1().PodSecurityPolicies().List(opts)
 	case "StorageClasses":
-		lst, err := kubeClient.StorageV1().StorageClasses().List(metav1.ListOptions{})
+		lst, err := kubeClient.StorageV1().StorageClasses().List(opts)
 		if apierrors.IsNotFound(err) {
-			return kubeClient.StorageV1beta1().StorageClasses().List(metav1.ListOptions{})
+			return kubeClient.StorageV1beta1().StorageClasses().List(opts)
 		}
 		return lst, err
 	default:
@@ -281,63 +275,112 @@ func queryNonNsResource(resourceKind string, kubeClient kubernetes.Interface) (r
 	}
 }
 
-// QueryNSResources will query namespace-specific resources in the cluster,
-// writing them out to <resultsdir>/resources/ns/<ns>/*.json
-// TODO: Eliminate dependencies from config.Config and pass in data
-func QueryNSResources(kubeClient kubernetes.Interface, recorder *QueryRecorder, ns string, cfg *config.Config) error {
-	logrus.Infof("Running ns query (%v)", ns)
+func init() {
+	RegisterModule(&resourceModule{
+		name: CoreModule,
+		clusterResources: []string{
+			"CertificateSigningRequests",
+			"ComponentStatuses",
+			"Nodes",
+			"PersistentVolumes",
+			"PodSecurityPolicies",
+			"ServerGroups",
+			"ServerVersion",
+			"StorageClasses",
+		},
+		nsResources: []string{
+			"ConfigMaps",
+			"ControllerRevisions",
+			"CronJobs",
+			"DaemonSets",
+			"Deployments",
+			"Endpoints",
+			"Events",
+			"HorizontalPodAutoscalers",
+			"Ingresses",
+			"Jobs",
+			"LimitRanges",
+			"NetworkPolicies",
+			"PersistentVolumeClaims",
+			"PodDisruptionBudgets",
+			"PodLogs",
+			"PodPresets",
+			"PodTemplates",
+			"Pods",
+			"ReplicaSets",
+			"ReplicationControllers",
+			"ResourceQuotas",
+			"Secrets",
+			"ServiceAccounts",
+			"Services",
+			"StatefulSets",
+		},
+	})
+	RegisterModule(&resourceModule{
+		name:             RBACModule,
+		clusterResources: []string{"ClusterRoleBindings", "ClusterRoles"},
+		nsResources:      []string{"RoleBindings", "Roles"},
+	})
+	RegisterModule(&crdModule{resourceModule: resourceModule{
+		name:             CRDModule,
+		clusterResources: []string{"CustomResourceDefinitions", "ThirdPartyResources"},
+	}})
+	RegisterModule(metricsModule{})
+	RegisterModule(helmModule{})
+}
 
-	// 1. Create the parent directory we will use to store the results
-	outdir := path.Join(cfg.OutputDir(), NSResourceLocation, ns)
-	if err := os.MkdirAll(outdir, 0755); err != nil {
-		return errors.WithStack(err)
-	}
+// resourceModule is a module that queries API resources by kind, writing each
+// kind out to <resultsdir>/resources/ns/<ns>/<kind>.json or
+// <resultsdir>/resources/cluster/<kind>.json.
+type resourceModule struct {
+	name             string
+	clusterResources []string
+	nsResources      []string
+}
 
-	// 2. Setup label filter if there is one.
-	opts := metav1.ListOptions{}
-	if len(cfg.Filters.LabelSelector) > 0 {
-		if _, err := labels.Parse(cfg.Filters.LabelSelector); err != nil {
-			logrus.Warningf("Labelselector %v failed to parse with error %v", cfg.Filters.LabelSelector, err)
-		} else {
-			opts.LabelSelector = cfg.Filters.LabelSelector
-		}
-	}
+func (m *resourceModule) Name() string {
+	return m.name
+}
 
-	var resources []string
-	if cfg.Namespace == ns {
-		resources = config.NamespacedResources
-	} else {
-		resources = cfg.FilterResources(config.NamespacedResources)
-	}
+// QueryNamespace queries the module's namespace-specific resources in ns.
+func (m *resourceModule) QueryNamespace(q *Querier, ns string) error {
+	outdir := path.Join(q.Config.OutputDir(), NSResourceLocation, ns)
+	opts := q.ListOptions()
 
-	// 3. Execute the ns-query
-	for _, resourceKind := range resources {
+	for _, resourceKind := range q.Wanted(ns, m.nsResources) {
 		switch resourceKind {
 		case "PodLogs":
+			if !podLogsWanted(q.Config, ns) {
+				continue
+			}
+			q.recorder.StartQuery()
 			start := time.Now()
-			err := gatherPodLogs(kubeClient, ns, opts, cfg)
+			err := gatherPodLogs(q.KubeClient, ns, opts, q.Config)
 			if err != nil {
 				return err
 			}
 			duration := time.Since(start)
-			recorder.RecordQuery("PodLogs", ns, duration, err)
+			q.recorder.RecordQuery("PodLogs", ns, duration, err)
 		default:
-			lister := func() (runtime.Object, error) { return queryNsResource(ns, resourceKind, opts, kubeClient) }
-			query := func() (time.Duration, error) { return objListQuery(outdir+"/", resourceKind+".json", lister) }
-			timedQuery(recorder, resourceKind, ns, query)
+			lister := func() (runtime.Object, error) {
+				return listPages(opts, q.Config.Queries.PageSize, func(opts metav1.ListOptions) (runtime.Object, error) {
+					return queryNsResource(ns, resourceKind, opts, q.KubeClient)
+				})
+			}
+			query := func() (time.Duration, error) {
+				return objListQuery(outdir+"/", resourceKind+".json", lister, q.redactor)
+			}
+			timedQuery(q.recorder, resourceKind, ns, query)
 		}
 	}
 
 	return nil
 }
 
-// QueryClusterResources queries non-namespace resources in the cluster, writing
-// them out to <resultsdir>/resources/non-ns/*.json
-// TODO: Eliminate dependencies from config.Config and pass in data
-func QueryClusterResources(kubeClient kubernetes.Interface, recorder *QueryRecorder, cfg *config.Config) error {
-	logrus.Infof("Running non-ns query")
-
-	resources := cfg.FilterResources(config.ClusterResources)
+// QueryCluster queries the module's non-namespaced resources.
+func (m *resourceModule) QueryCluster(q *Querier) error {
+	kubeClient, cfg := q.KubeClient, q.Config
+	resources := q.Wanted("", m.clusterResources)
 
 	// 1. Create the parent directory we will use to store the results
 	outdir := path.Join(cfg.OutputDir(), ClusterResourceLocation)
@@ -353,15 +396,15 @@ func QueryClusterResources(kubeClient kubernetes.Interface, recorder *QueryRecor
 		case "ServerVersion":
 			objqry := func() (interface{}, error) { return kubeClient.Discovery().ServerVersion() }
 			query := func() (time.Duration, error) {
-				return untypedQuery(cfg.OutputDir(), "serverversion.json", objqry)
+				return untypedQuery(cfg.OutputDir(), "serverversion.json", objqry, nil)
 			}
-			timedQuery(recorder, "serverversion", "", query)
+			timedQuery(q.recorder, "serverversion", "", query)
 		case "ServerGroups":
 			objqry := func() (interface{}, error) { return kubeClient.Discovery().ServerGroups() }
 			query := func() (time.Duration, error) {
-				return untypedQuery(cfg.OutputDir(), "servergroups.json", objqry)
+				return untypedQuery(cfg.OutputDir(), "servergroups.json", objqry, nil)
 			}
-			timedQuery(recorder, "servergroups", "", query)
+			timedQuery(q.recorder, "servergroups", "", query)
 		case "Nodes":
 			// cfg.Nodes configures whether users want to gather the Nodes resource in the
 			// cluster, but we also use that option to guide whether we get node data such
@@ -369,15 +412,22 @@ func QueryClusterResources(kubeClient kubernetes.Interface, recorder *QueryRecor
 
 			// NOTE: Node data collection is an aggregated time b/c propagating that detail back up
 			// is odd and would pollute some of the output.
+			q.recorder.StartQuery()
 			start := time.Now()
 			err := gatherNodeData(kubeClient, cfg)
 			duration := time.Since(start)
-			recorder.RecordQuery("Nodes", "", duration, err)
+			q.recorder.RecordQuery("Nodes", "", duration, err)
 			fallthrough
 		default:
-			lister := func() (runtime.Object, error) { return queryNonNsResource(resourceKind, kubeClient) }
-			query := func() (time.Duration, error) { return objListQuery(outdir+"/", resourceKind+".json", lister) }
-			timedQuery(recorder, resourceKind, "", query)
+			lister := func() (runtime.Object, error) {
+				return listPages(metav1.ListOptions{}, cfg.Queries.PageSize, func(opts metav1.ListOptions) (runtime.Object, error) {
+					return queryNonNsResource(resourceKind, opts, kubeClient)
+				})
+			}
+			query := func() (time.Duration, error) {
+				return objListQuery(outdir+"/", resourceKind+".json", lister, q.redactor)
+			}
+			timedQuery(q.recorder, resourceKind, "", query)
 		}
 	}
 
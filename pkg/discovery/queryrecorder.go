@@ -18,17 +18,26 @@ package discovery
 
 import (
 	"encoding/json"
+	"net/http"
 	"os"
 	"path"
+	"sync/atomic"
 	"time"
 
 	"github.com/heptio/sonobuoy/pkg/errlog"
 	"github.com/pkg/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 // QueryRecorder records a sequence of queries
 type QueryRecorder struct {
 	queries []*QueryData
+
+	// apiCalls counts the requests made by clients from CountingClient, and
+	// startCalls is the count when the current query started.
+	apiCalls   int64
+	startCalls int64
 }
 
 // NewQueryRecorder returns a new empty QueryRecorder
@@ -43,24 +52,63 @@ type QueryData struct {
 	QueryObj    string `json:"queryobj,omitempty"`
 	Namespace   string `json:"namespace,omitempty"`
 	ElapsedTime string `json:"time,omitempty"`
-	Error       error  `json:"error,omitempty"`
+	// APICalls is the number of requests the query made to the API server,
+	// if they were counted.
+	APICalls int64 `json:"apicalls,omitempty"`
+	Error    error `json:"error,omitempty"`
+}
+
+// CountingClient returns a client for the cluster restConfig refers to whose
+// requests are counted towards the API calls of each query recorded.
+func (q *QueryRecorder) CountingClient(restConfig *rest.Config) (kubernetes.Interface, error) {
+	cfg := rest.CopyConfig(restConfig)
+	wrap := cfg.WrapTransport
+	cfg.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		if wrap != nil {
+			rt = wrap(rt)
+		}
+		return &countingRoundTripper{RoundTripper: rt, count: &q.apiCalls}
+	}
+	client, err := kubernetes.NewForConfig(cfg)
+	return client, errors.Wrap(err, "couldn't create counting client")
+}
+
+// StartQuery marks the start of a query, so that only the API calls made from
+// then on are recorded for it.
+func (q *QueryRecorder) StartQuery() {
+	q.startCalls = atomic.LoadInt64(&q.apiCalls)
 }
 
-// RecordQuery transcribes a query by name, namespace, duration and error
+// RecordQuery transcribes a query by name, namespace, duration and error, along
+// with the API calls made since StartQuery.
 func (q *QueryRecorder) RecordQuery(name string, namespace string, duration time.Duration, recerr error) {
 	if recerr != nil {
 		errlog.LogError(errors.Wrapf(recerr, "error querying %v", name))
 	}
+	calls := atomic.LoadInt64(&q.apiCalls)
 	summary := &QueryData{
 		QueryObj:    name,
 		Namespace:   namespace,
 		ElapsedTime: duration.String(),
+		APICalls:    calls - q.startCalls,
 		Error:       recerr,
 	}
+	q.startCalls = calls
 
 	q.queries = append(q.queries, summary)
 }
 
+// countingRoundTripper counts the requests made through it.
+type countingRoundTripper struct {
+	http.RoundTripper
+	count *int64
+}
+
+func (c *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(c.count, 1)
+	return c.RoundTripper.RoundTrip(req)
+}
+
 // DumpQueryData writes query information out to a file at the give filepath
 func (q *QueryRecorder) DumpQueryData(filepath string) error {
 	// Ensure the leading path is created
@@ -0,0 +1,73 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestQueryRecorder_apiCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"kind": "NamespaceList", "apiVersion": "v1", "items": []}`))
+	}))
+	defer server.Close()
+
+	recorder := NewQueryRecorder()
+	client, err := recorder.CountingClient(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("couldn't create counting client: %v", err)
+	}
+
+	list := func() error {
+		_, err := client.CoreV1().Namespaces().List(metav1.ListOptions{})
+		return err
+	}
+
+	recorder.StartQuery()
+	for i := 0; i < 3; i++ {
+		if err := list(); err != nil {
+			t.Fatalf("couldn't list namespaces: %v", err)
+		}
+	}
+	recorder.RecordQuery("Namespaces", "", time.Second, nil)
+
+	// Calls made between queries aren't counted towards the next one.
+	if err := list(); err != nil {
+		t.Fatalf("couldn't list namespaces: %v", err)
+	}
+	recorder.StartQuery()
+	if err := list(); err != nil {
+		t.Fatalf("couldn't list namespaces: %v", err)
+	}
+	recorder.RecordQuery("Namespaces", "default", time.Second, nil)
+
+	if len(recorder.queries) != 2 {
+		t.Fatalf("expected 2 queries to be recorded, got %d", len(recorder.queries))
+	}
+	for i, expected := range []int64{3, 1} {
+		if calls := recorder.queries[i].APICalls; calls != expected {
+			t.Errorf("expected query %d to make %d API calls, got %d", i, expected, calls)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces each value removed from the resources collected.
+const Redacted = "REDACTED"
+
+// secretsFile is where the Secrets of a namespace are stored.
+const secretsFile = "Secrets.json"
+
+// sensitiveAnnotations are annotations whose values may include secrets, such
+// as the whole object as kubectl last applied it.
+var sensitiveAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"openshift.io/token-secret.value",
+}
+
+// redactor removes sensitive values from resources before they're stored:
+// the values of Secrets, sensitive annotations and whatever matches the
+// configured patterns.
+type redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// newRedactor returns the redactor for the options, or nil if redaction is
+// turned off. Patterns that don't compile, which the config's validation
+// rejects, are skipped.
+func newRedactor(opts config.RedactionOptions) *redactor {
+	if !opts.Redact {
+		return nil
+	}
+	r := &redactor{}
+	for _, pattern := range opts.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			logrus.WithError(err).Warningf("Skipping invalid redaction pattern %q", pattern)
+			continue
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r
+}
+
+// redact returns the JSON in data, which was stored as file, with sensitive
+// values replaced.
+func (r *redactor) redact(file string, data []byte) ([]byte, error) {
+	var obj interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&obj); err != nil {
+		return nil, errors.Wrap(err, "couldn't decode resources to redact")
+	}
+	redacted, err := json.Marshal(r.redactValue(obj, file == secretsFile))
+	return redacted, errors.Wrap(err, "couldn't encode redacted resources")
+}
+
+// redactValue redacts any objects in v. Objects from a list of Secrets don't
+// have their kind set, so inSecrets says whether v is from one.
+func (r *redactor) redactValue(v interface{}, inSecrets bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if metadata, ok := v["metadata"].(map[string]interface{}); ok {
+			redactAnnotations(metadata)
+			if inSecrets || v["kind"] == "Secret" {
+				redactKeys(v, "data")
+				redactKeys(v, "stringData")
+			}
+		}
+		for key, value := range v {
+			v[key] = r.redactValue(value, inSecrets)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = r.redactValue(value, inSecrets)
+		}
+		return v
+	case string:
+		for _, re := range r.patterns {
+			v = re.ReplaceAllString(v, Redacted)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// redactAnnotations redacts the sensitive annotations of an object's
+// metadata.
+func redactAnnotations(metadata map[string]interface{}) {
+	annotations, ok := metadata["annotations"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, key := range sensitiveAnnotations {
+		if _, ok := annotations[key]; ok {
+			annotations[key] = Redacted
+		}
+	}
+}
+
+// redactKeys redacts every value in the map obj[field], keeping the keys so
+// that it's still clear what's there.
+func redactKeys(obj map[string]interface{}, field string) {
+	values, ok := obj[field].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for key := range values {
+		values[key] = Redacted
+	}
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/storage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// resultsTarballPattern matches the names of results tarballs.
+const resultsTarballPattern = "*_sonobuoy_*.tar.gz"
+
+// retentionPolicy is which results tarballs are kept after a run. Zero values
+// don't limit them.
+type retentionPolicy struct {
+	keep     int
+	maxAge   time.Duration
+	maxBytes int64
+}
+
+func newRetentionPolicy(cfg *config.Config) retentionPolicy {
+	return retentionPolicy{
+		keep:     cfg.KeepResults,
+		maxAge:   cfg.ResultsRetention.TimeLimitDuration(0),
+		maxBytes: cfg.ResultsRetention.SizeLimitBytes(0),
+	}
+}
+
+// enabled returns whether the policy removes any tarballs at all.
+func (p retentionPolicy) enabled() bool {
+	return p.keep > 0 || p.maxAge > 0 || p.maxBytes > 0
+}
+
+// resultsTarball is a results tarball that the policy may remove.
+type resultsTarball struct {
+	name     string
+	size     int64
+	modified time.Time
+}
+
+// expired returns the tarballs to remove as of now: all but the newest keep,
+// those older than maxAge, and the oldest while they add up to more than
+// maxBytes. Tarballs are named after the time their run started, so sorting
+// them by name sorts them oldest first. The newest tarball, which is usually
+// the run's own, is always kept.
+func (p retentionPolicy) expired(tarballs []resultsTarball, now time.Time) []resultsTarball {
+	sort.Slice(tarballs, func(i, j int) bool { return tarballs[i].name < tarballs[j].name })
+
+	var expired []resultsTarball
+	var total int64
+	for i := len(tarballs) - 1; i >= 0; i-- {
+		t := tarballs[i]
+		total += t.size
+		newest := i == len(tarballs)-1
+		switch {
+		case newest:
+		case p.keep > 0 && len(tarballs)-i > p.keep,
+			p.maxAge > 0 && now.Sub(t.modified) > p.maxAge,
+			p.maxBytes > 0 && total > p.maxBytes:
+			expired = append(expired, t)
+		}
+	}
+	return expired
+}
+
+// pruneResults removes the results tarballs in resultsDir that the policy
+// doesn't keep.
+func pruneResults(resultsDir string, policy retentionPolicy) error {
+	files, err := filepath.Glob(filepath.Join(resultsDir, resultsTarballPattern))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tarballs := make([]resultsTarball, 0, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		tarballs = append(tarballs, resultsTarball{name: file, size: info.Size(), modified: info.ModTime()})
+	}
+
+	for _, tarball := range policy.expired(tarballs, time.Now()) {
+		logrus.WithField("tarball", tarball.name).Info("Removing old results")
+		if err := os.Remove(tarball.name); err != nil {
+			return errors.Wrapf(err, "couldn't remove old results %v", tarball.name)
+		}
+	}
+	return nil
+}
+
+// pruneStoredResults removes the results tarballs stored under the storage
+// config's prefix that the policy doesn't keep.
+func pruneStoredResults(cfg storage.Config, policy retentionPolicy) error {
+	backend, err := storage.New(cfg)
+	if err != nil {
+		return errors.Wrap(err, "couldn't set up results storage")
+	}
+
+	prefix := ""
+	if cfg.Prefix != "" {
+		prefix = strings.TrimSuffix(cfg.Prefix, "/") + "/"
+	}
+	objects, err := backend.List(prefix)
+	if err != nil {
+		return err
+	}
+
+	var tarballs []resultsTarball
+	for _, object := range objects {
+		// Only tarballs stored directly under the prefix are Sonobuoy's.
+		if storage.StoredName(cfg, object.Name) != object.Name {
+			continue
+		}
+		if matched, _ := path.Match(resultsTarballPattern, path.Base(object.Name)); !matched {
+			continue
+		}
+		tarballs = append(tarballs, resultsTarball{name: object.Name, size: object.Size, modified: object.Modified})
+	}
+
+	for _, tarball := range policy.expired(tarballs, time.Now()) {
+		logrus.WithField("tarball", backend.Location(tarball.name)).Info("Removing old stored results")
+		if err := backend.Delete(tarball.name); err != nil {
+			return errors.Wrapf(err, "couldn't remove old results %v", backend.Location(tarball.name))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyExpired(t *testing.T) {
+	now := time.Date(2018, time.October, 15, 12, 0, 0, 0, time.UTC)
+	tarballs := []resultsTarball{
+		{name: "201810120000_sonobuoy_c.tar.gz", size: 300, modified: now.Add(-72 * time.Hour)},
+		{name: "201810150000_sonobuoy_f.tar.gz", size: 600, modified: now},
+		{name: "201810130000_sonobuoy_d.tar.gz", size: 400, modified: now.Add(-48 * time.Hour)},
+		{name: "201810140000_sonobuoy_e.tar.gz", size: 500, modified: now.Add(-24 * time.Hour)},
+	}
+
+	testCases := []struct {
+		name     string
+		policy   retentionPolicy
+		expected []string
+	}{
+		{
+			name:   "unlimited",
+			policy: retentionPolicy{},
+		},
+		{
+			name:     "keep last",
+			policy:   retentionPolicy{keep: 2},
+			expected: []string{"201810120000_sonobuoy_c.tar.gz", "201810130000_sonobuoy_d.tar.gz"},
+		},
+		{
+			name:     "max age",
+			policy:   retentionPolicy{maxAge: 36 * time.Hour},
+			expected: []string{"201810120000_sonobuoy_c.tar.gz", "201810130000_sonobuoy_d.tar.gz"},
+		},
+		{
+			name:     "max size",
+			policy:   retentionPolicy{maxBytes: 1500},
+			expected: []string{"201810120000_sonobuoy_c.tar.gz"},
+		},
+		{
+			name:     "newest is kept",
+			policy:   retentionPolicy{maxAge: time.Minute, maxBytes: 100},
+			expected: []string{"201810120000_sonobuoy_c.tar.gz", "201810130000_sonobuoy_d.tar.gz", "201810140000_sonobuoy_e.tar.gz"},
+		},
+		{
+			name:     "combined",
+			policy:   retentionPolicy{keep: 3, maxAge: 60 * time.Hour},
+			expected: []string{"201810120000_sonobuoy_c.tar.gz"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var names []string
+			for _, tarball := range tc.policy.expired(tarballs, now) {
+				names = append(names, tarball.name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tc.expected) {
+				t.Errorf("expected %v to expire, got %v", tc.expected, names)
+			}
+		})
+	}
+}
+
+func TestPruneResults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy_retention_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []string{
+		"201810130000_sonobuoy_a.tar.gz",
+		"201810140000_sonobuoy_b.tar.gz",
+		"201810150000_sonobuoy_c.tar.gz",
+		"unrelated.tar.gz",
+	}
+	for _, file := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte("results"), 0644); err != nil {
+			t.Fatalf("couldn't write %v: %v", file, err)
+		}
+	}
+
+	if err := pruneResults(dir, retentionPolicy{keep: 1}); err != nil {
+		t.Fatalf("unexpected error pruning results: %v", err)
+	}
+
+	remaining, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(dir, "201810150000_sonobuoy_c.tar.gz"), filepath.Join(dir, "unrelated.tar.gz")}
+	if !reflect.DeepEqual(remaining, expected) {
+		t.Errorf("expected %v to remain, got %v", expected, remaining)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/buildinfo"
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// RunMetadataPath is where the provenance and timings of a run are stored in
+// its results.
+const RunMetadataPath = "meta/run.json"
+
+// RunMetadata records where a run came from and when it ran, so its results
+// can be audited and reproduced. The CLI's fields are empty if the run wasn't
+// generated by the CLI.
+type RunMetadata struct {
+	UUID string `json:"uuid"`
+	// CLIVersion, Flags, User and GeneratedAt are the config's Provenance.
+	CLIVersion  string   `json:"cliVersion,omitempty"`
+	Flags       []string `json:"flags,omitempty"`
+	User        string   `json:"user,omitempty"`
+	GeneratedAt string   `json:"generatedAt,omitempty"`
+	// AggregatorVersion is the version of Sonobuoy the aggregator was built
+	// from. Results from workers of other versions were refused unless
+	// AllowMixedVersions was set.
+	AggregatorVersion  string `json:"aggregatorVersion"`
+	AllowMixedVersions bool   `json:"allowMixedVersions,omitempty"`
+	// ConfigSHA256 is the hex-encoded SHA256 of meta/config.json, as
+	// written by the aggregator.
+	ConfigSHA256 string `json:"configSHA256"`
+	// StartedAt is when the aggregator started the run, and FinishedAt when
+	// its plugins and queries had finished.
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// newRunMetadata returns the metadata of a run with the given config, whose
+// config.json has the given contents, that started at started.
+func newRunMetadata(cfg *config.Config, configJSON []byte, started time.Time) *RunMetadata {
+	sum := sha256.Sum256(configJSON)
+	meta := &RunMetadata{
+		UUID:               cfg.UUID,
+		AggregatorVersion:  buildinfo.Version,
+		AllowMixedVersions: cfg.Aggregation.AllowMixedVersions,
+		ConfigSHA256:       hex.EncodeToString(sum[:]),
+		StartedAt:          started.UTC(),
+	}
+	if p := cfg.Provenance; p != nil {
+		meta.CLIVersion = p.CLIVersion
+		meta.Flags = p.Flags
+		meta.User = p.User
+		meta.GeneratedAt = p.GeneratedAt
+	}
+	return meta
+}
+
+// write writes the metadata to meta/run.json under outpath, for a run that
+// finished at finished.
+func (m *RunMetadata) write(outpath string, finished time.Time) error {
+	m.FinishedAt = finished.UTC()
+	blob, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode run metadata")
+	}
+	return errors.Wrap(ioutil.WriteFile(path.Join(outpath, RunMetadataPath), blob, 0644), "couldn't write run metadata")
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/buildinfo"
+	"github.com/heptio/sonobuoy/pkg/config"
+)
+
+func TestRunMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy_runmeta_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, MetaLocation), 0755); err != nil {
+		t.Fatalf("couldn't create meta dir: %v", err)
+	}
+
+	cfg := config.New()
+	cfg.Aggregation.AllowMixedVersions = true
+	cfg.Provenance = &config.Provenance{
+		CLIVersion:  "v0.10.0",
+		Flags:       []string{"--mode=Quick"},
+		User:        "jdoe",
+		GeneratedAt: "2018-10-15T12:00:00Z",
+	}
+	configJSON := []byte(`{"UUID":"abc"}`)
+	started := time.Date(2018, time.October, 15, 12, 1, 0, 0, time.UTC)
+	finished := started.Add(time.Hour)
+
+	if err := newRunMetadata(cfg, configJSON, started).write(dir, finished); err != nil {
+		t.Fatalf("unexpected error writing run metadata: %v", err)
+	}
+
+	blob, err := ioutil.ReadFile(filepath.Join(dir, RunMetadataPath))
+	if err != nil {
+		t.Fatalf("couldn't read run metadata: %v", err)
+	}
+	var meta RunMetadata
+	if err := json.Unmarshal(blob, &meta); err != nil {
+		t.Fatalf("couldn't decode run metadata: %v", err)
+	}
+
+	sum := sha256.Sum256(configJSON)
+	expected := RunMetadata{
+		UUID:               cfg.UUID,
+		CLIVersion:         "v0.10.0",
+		Flags:              []string{"--mode=Quick"},
+		User:               "jdoe",
+		GeneratedAt:        "2018-10-15T12:00:00Z",
+		AggregatorVersion:  buildinfo.Version,
+		AllowMixedVersions: true,
+		ConfigSHA256:       hex.EncodeToString(sum[:]),
+		StartedAt:          started,
+		FinishedAt:         finished,
+	}
+	if !reflect.DeepEqual(meta, expected) {
+		t.Errorf("expected run metadata %+v, got %+v", expected, meta)
+	}
+}
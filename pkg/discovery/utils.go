@@ -20,8 +20,13 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/notify"
+	pluginaggregation "github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/heptio/sonobuoy/pkg/storage"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -46,6 +51,43 @@ func FilterNamespaces(kubeClient kubernetes.Interface, filter string) ([]string,
 	return validns, nil
 }
 
+// SelectNamespaces lists the namespaces the filters select for querying. The
+// Sonobuoy namespace is always selected, so the run's own resources are
+// recorded.
+func SelectNamespaces(kubeClient kubernetes.Interface, filters config.FilterOptions, sonobuoyNamespace string) ([]string, error) {
+	re, err := regexp.Compile(filters.Namespaces)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid namespace filter %q", filters.Namespaces)
+	}
+	nslist, err := kubeClient.CoreV1().Namespaces().List(metav1.ListOptions{LabelSelector: filters.NamespaceLabelSelector})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	include := make(map[string]bool, len(filters.IncludeNamespaces))
+	for _, ns := range filters.IncludeNamespaces {
+		include[ns] = true
+	}
+	exclude := make(map[string]bool, len(filters.ExcludeNamespaces))
+	for _, ns := range filters.ExcludeNamespaces {
+		exclude[ns] = true
+	}
+	selected := []string{sonobuoyNamespace}
+	for _, ns := range nslist.Items {
+		if ns.Name == sonobuoyNamespace {
+			continue
+		}
+		matched := re.MatchString(ns.Name) &&
+			(len(include) == 0 || include[ns.Name]) &&
+			!exclude[ns.Name]
+		logrus.Infof("Namespace %v Matched=%v", ns.Name, matched)
+		if matched {
+			selected = append(selected, ns.Name)
+		}
+	}
+	return selected, nil
+}
+
 // SerializeObj will write out an object
 func SerializeObj(obj interface{}, outpath string, file string) error {
 	var err error
@@ -57,6 +99,25 @@ func SerializeObj(obj interface{}, outpath string, file string) error {
 	return errors.WithStack(err)
 }
 
+// serializeRedacted writes out an object like SerializeObj, redacted by r if
+// it isn't nil.
+func serializeRedacted(r *redactor, obj interface{}, outpath string, file string) error {
+	if r == nil {
+		return SerializeObj(obj, outpath, file)
+	}
+	if err := os.MkdirAll(outpath, 0755); err != nil {
+		return errors.WithStack(err)
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if data, err = r.redact(file, data); err != nil {
+		return err
+	}
+	return errors.WithStack(ioutil.WriteFile(filepath.Join(outpath, file), data, 0644))
+}
+
 // SerializeArrayObj will write out an array of object
 func SerializeArrayObj(objs []interface{}, outpath string, file string) error {
 	var err error
@@ -77,3 +138,64 @@ func SerializeObjAppend(f *os.File, obj interface{}) error {
 	}
 	return errors.WithStack(err)
 }
+
+// markRetrieved writes the marker showing the results in resultsDir have been
+// retrieved.
+func markRetrieved(resultsDir string) error {
+	err := ioutil.WriteFile(filepath.Join(resultsDir, config.RetrievedMarker), nil, 0644)
+	return errors.Wrap(err, "couldn't mark results as retrieved")
+}
+
+// storeResults uploads the results tarball to the configured storage backend,
+// returning where it was stored.
+func storeResults(cfg storage.Config, tarball string) (string, error) {
+	backend, err := storage.New(cfg)
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't set up results storage")
+	}
+
+	location, err := storage.StoreFile(backend, cfg, tarball)
+	if err != nil {
+		return "", err
+	}
+	logrus.Infof("Results stored at %v", location)
+	return location, nil
+}
+
+// runSummary summarizes the run for notifications, from the index of the
+// plugins' results in outpath. A run without one, which ran no plugins or
+// failed before they were launched, is complete unless it had errors.
+func runSummary(cfg *config.Config, outpath string, errCount int, results string) (*notify.Summary, error) {
+	summary := &notify.Summary{
+		Run:       cfg.UUID,
+		Namespace: cfg.Namespace,
+		Status:    pluginaggregation.CompleteStatus,
+		Errors:    errCount,
+		Plugins:   []notify.PluginSummary{},
+		Results:   results,
+	}
+
+	blob, err := ioutil.ReadFile(filepath.Join(outpath, pluginaggregation.ResultsIndexPath))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "couldn't read results index")
+	}
+	if err == nil {
+		var index pluginaggregation.ResultsIndex
+		if err := json.Unmarshal(blob, &index); err != nil {
+			return nil, errors.Wrap(err, "couldn't decode results index")
+		}
+		summary.Status = index.Status
+		for _, p := range index.Plugins {
+			summary.Plugins = append(summary.Plugins, notify.PluginSummary{
+				Plugin: p.Plugin,
+				Status: p.Status,
+				Items:  p.Items,
+			})
+		}
+	}
+
+	if errCount > 0 {
+		summary.Status = pluginaggregation.FailedStatus
+	}
+	return summary, nil
+}
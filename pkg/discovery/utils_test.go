@@ -0,0 +1,99 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/config"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestSelectNamespaces(t *testing.T) {
+	var labelSelector string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces" {
+			http.NotFound(w, r)
+			return
+		}
+		labelSelector = r.URL.Query().Get("labelSelector")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"kind": "NamespaceList", "apiVersion": "v1", "items": [
+			{"metadata": {"name": "default"}},
+			{"metadata": {"name": "heptio-sonobuoy"}},
+			{"metadata": {"name": "kube-system"}},
+			{"metadata": {"name": "tenant-a"}},
+			{"metadata": {"name": "tenant-b"}}
+		]}`)
+	}))
+	defer srv.Close()
+	kubeClient, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatalf("couldn't create client: %v", err)
+	}
+
+	testCases := []struct {
+		desc     string
+		filters  config.FilterOptions
+		expected []string
+	}{
+		{
+			desc:     "all namespaces",
+			filters:  config.FilterOptions{Namespaces: ".*"},
+			expected: []string{"heptio-sonobuoy", "default", "kube-system", "tenant-a", "tenant-b"},
+		}, {
+			desc:     "regex always keeps the sonobuoy namespace",
+			filters:  config.FilterOptions{Namespaces: "^tenant-"},
+			expected: []string{"heptio-sonobuoy", "tenant-a", "tenant-b"},
+		}, {
+			desc:     "include list",
+			filters:  config.FilterOptions{Namespaces: ".*", IncludeNamespaces: []string{"kube-system", "tenant-b"}},
+			expected: []string{"heptio-sonobuoy", "kube-system", "tenant-b"},
+		}, {
+			desc:     "exclude list",
+			filters:  config.FilterOptions{Namespaces: ".*", ExcludeNamespaces: []string{"kube-system", "tenant-a"}},
+			expected: []string{"heptio-sonobuoy", "default", "tenant-b"},
+		}, {
+			desc:     "exclude wins over include",
+			filters:  config.FilterOptions{Namespaces: ".*", IncludeNamespaces: []string{"tenant-a", "tenant-b"}, ExcludeNamespaces: []string{"tenant-a"}},
+			expected: []string{"heptio-sonobuoy", "tenant-b"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			namespaces, err := SelectNamespaces(kubeClient, tc.filters, "heptio-sonobuoy")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(namespaces, tc.expected) {
+				t.Errorf("expected namespaces %v, got %v", tc.expected, namespaces)
+			}
+		})
+	}
+
+	if _, err := SelectNamespaces(kubeClient, config.FilterOptions{Namespaces: ".*", NamespaceLabelSelector: "team=a"}, "heptio-sonobuoy"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if labelSelector != "team=a" {
+		t.Errorf("expected the namespaces to be listed with label selector team=a, got %q", labelSelector)
+	}
+}
@@ -0,0 +1,393 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package encryption encrypts results tarballs at rest with AES-GCM, for
+// clusters whose resources are too sensitive to leave their dumps readable
+// wherever results end up.
+//
+// Each tarball is encrypted with its own random data key, which is stored in
+// the tarball's header wrapped either by a key the user supplies or by a
+// Google Cloud KMS key. The data is sealed in chunks, so tarballs of any size
+// are encrypted and decrypted as they're streamed.
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Magic starts every encrypted tarball, telling it apart from a gzipped
+	// one.
+	Magic = "SONOBUOY-ENCRYPTED-V1\n"
+
+	// KeySize is the size in bytes of AES-256 keys.
+	KeySize = 32
+
+	// chunkSize is how much plaintext each sealed chunk holds.
+	chunkSize = 64 * 1024
+	// maxHeaderSize bounds the header that's read before anything is
+	// authenticated.
+	maxHeaderSize = 64 * 1024
+
+	localKeySource = "key"
+	kmsKeySource   = "kms"
+)
+
+// Config says how results tarballs are encrypted. At most one of KeyEnv and
+// KMSKey may be set; if neither is, tarballs aren't encrypted.
+type Config struct {
+	// KeyEnv names an environment variable of the aggregator holding a
+	// base64 encoded 256 bit key, such as one passed in with
+	// --storage-secret.
+	KeyEnv string `json:"KeyEnv,omitempty" mapstructure:"KeyEnv"`
+	// KMSKey is the resource name of a Google Cloud KMS crypto key, such as
+	// projects/p/locations/global/keyRings/r/cryptoKeys/k, used with the
+	// application default credentials.
+	KMSKey string `json:"KMSKey,omitempty" mapstructure:"KMSKey"`
+}
+
+// Enabled returns whether tarballs are encrypted.
+func (c Config) Enabled() bool {
+	return c.KeyEnv != "" || c.KMSKey != ""
+}
+
+// Validate returns an error if tarballs can't be encrypted with the config.
+func (c Config) Validate() error {
+	if c.KeyEnv != "" && c.KMSKey != "" {
+		return errors.New("results can be encrypted with a key or a KMS key, not both")
+	}
+	if c.KMSKey != "" && !strings.Contains(c.KMSKey, "/cryptoKeys/") {
+		return errors.Errorf("KMS key %q isn't the resource name of a crypto key", c.KMSKey)
+	}
+	return nil
+}
+
+// header describes how an encrypted tarball's data key is wrapped. It's
+// authenticated along with every chunk.
+type header struct {
+	KeySource  string `json:"keySource"`
+	KMSKey     string `json:"kmsKey,omitempty"`
+	WrappedKey []byte `json:"wrappedKey"`
+}
+
+// keyWrapper protects data keys.
+type keyWrapper interface {
+	wrap(dataKey []byte) ([]byte, error)
+	unwrap(wrapped []byte) ([]byte, error)
+}
+
+// localKey wraps data keys with a key the user supplies.
+type localKey []byte
+
+func (k localKey) wrap(dataKey []byte) ([]byte, error) {
+	aead, err := newAEAD(k)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "couldn't generate nonce")
+	}
+	return aead.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+func (k localKey) unwrap(wrapped []byte) ([]byte, error) {
+	aead, err := newAEAD(k)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped data key is too short")
+	}
+	dataKey, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil)
+	return dataKey, errors.Wrap(err, "couldn't unwrap data key, is it the right key?")
+}
+
+// ParseKey decodes a base64 encoded 256 bit key.
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.Wrap(err, "key isn't base64 encoded")
+	}
+	if len(key) != KeySize {
+		return nil, errors.Errorf("key is %d bytes, expected %d", len(key), KeySize)
+	}
+	return key, nil
+}
+
+// wrapperFor returns what wraps data keys for cfg.
+func wrapperFor(cfg Config) (keyWrapper, *header, error) {
+	if cfg.KMSKey != "" {
+		kms, err := newKMSKey(cfg.KMSKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		return kms, &header{KeySource: kmsKeySource, KMSKey: cfg.KMSKey}, nil
+	}
+	encoded := os.Getenv(cfg.KeyEnv)
+	if encoded == "" {
+		return nil, nil, errors.Errorf("no results encryption key in $%v", cfg.KeyEnv)
+	}
+	key, err := ParseKey(encoded)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid results encryption key in $%v", cfg.KeyEnv)
+	}
+	return localKey(key), &header{KeySource: localKeySource}, nil
+}
+
+// EncryptFile encrypts the file at path as cfg says, replacing it once it's
+// encrypted.
+func EncryptFile(cfg Config, path string) error {
+	wrapper, hdr, err := wrapperFor(cfg)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't open %v", path)
+	}
+	defer in.Close()
+
+	encrypted := path + ".encrypting"
+	out, err := os.Create(encrypted)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't create %v", encrypted)
+	}
+	err = encrypt(out, in, wrapper, hdr)
+	if closeErr := out.Close(); err == nil {
+		err = errors.WithStack(closeErr)
+	}
+	if err != nil {
+		os.Remove(encrypted)
+		return errors.Wrapf(err, "couldn't encrypt %v", path)
+	}
+	return errors.WithStack(os.Rename(encrypted, path))
+}
+
+// encrypt writes r to w encrypted with a new data key wrapped by wrapper.
+func encrypt(w io.Writer, r io.Reader, wrapper keyWrapper, hdr *header) error {
+	dataKey := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return errors.Wrap(err, "couldn't generate data key")
+	}
+	wrapped, err := wrapper.wrap(dataKey)
+	if err != nil {
+		return err
+	}
+	hdr.WrappedKey = wrapped
+	hdrJSON, err := json.Marshal(hdr)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode header")
+	}
+
+	if _, err := io.WriteString(w, Magic); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(len(hdrJSON))); err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := w.Write(hdrJSON); err != nil {
+		return errors.WithStack(err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	s := &chunkSealer{aead: aead, additional: hdrJSON}
+	plain := make([]byte, chunkSize)
+	br := bufio.NewReaderSize(r, chunkSize)
+	for {
+		n, err := io.ReadFull(br, plain)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return errors.Wrap(err, "couldn't read plaintext")
+		}
+		last := err != nil
+		if !last {
+			// A chunk that ends the plaintext exactly is the last one.
+			if _, peekErr := br.Peek(1); peekErr == io.EOF {
+				last = true
+			}
+		}
+		sealed, err := s.seal(plain[:n], last)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(sealed); err != nil {
+			return errors.WithStack(err)
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// Decrypt writes the encrypted tarball read from r to w. key is the user's
+// key if the tarball's data key was wrapped with one; otherwise it's unwrapped
+// with the KMS key named in its header.
+func Decrypt(w io.Writer, r io.Reader, key []byte) error {
+	br := bufio.NewReaderSize(r, chunkSize+aes.BlockSize)
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != Magic {
+		return errors.New("not an encrypted results tarball")
+	}
+	var hdrLen uint32
+	if err := binary.Read(br, binary.BigEndian, &hdrLen); err != nil {
+		return errors.Wrap(err, "couldn't read header")
+	}
+	if hdrLen > maxHeaderSize {
+		return errors.Errorf("header is %d bytes, more than %d", hdrLen, maxHeaderSize)
+	}
+	hdrJSON := make([]byte, hdrLen)
+	if _, err := io.ReadFull(br, hdrJSON); err != nil {
+		return errors.Wrap(err, "couldn't read header")
+	}
+	var hdr header
+	if err := json.Unmarshal(hdrJSON, &hdr); err != nil {
+		return errors.Wrap(err, "couldn't decode header")
+	}
+
+	var wrapper keyWrapper
+	switch hdr.KeySource {
+	case localKeySource:
+		if key == nil {
+			return errors.New("results were encrypted with a key, which is needed to decrypt them")
+		}
+		wrapper = localKey(key)
+	case kmsKeySource:
+		kms, err := newKMSKey(hdr.KMSKey)
+		if err != nil {
+			return err
+		}
+		wrapper = kms
+	default:
+		return errors.Errorf("unknown key source %q", hdr.KeySource)
+	}
+	dataKey, err := wrapper.unwrap(hdr.WrappedKey)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	s := &chunkSealer{aead: aead, additional: hdrJSON}
+	sealed := make([]byte, chunkSize+aead.Overhead())
+	for {
+		n, err := io.ReadFull(br, sealed)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return errors.Wrap(err, "couldn't read ciphertext")
+		}
+		last := err != nil
+		if !last {
+			if _, peekErr := br.Peek(1); peekErr == io.EOF {
+				last = true
+			}
+		}
+		plain, err := s.open(sealed[:n], last)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(plain); err != nil {
+			return errors.WithStack(err)
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// IsEncrypted returns whether the file at path is an encrypted tarball.
+func IsEncrypted(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, errors.Wrapf(err, "couldn't open %v", path)
+	}
+	defer f.Close()
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(magic, []byte(Magic)), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid key")
+	}
+	aead, err := cipher.NewGCM(block)
+	return aead, errors.Wrap(err, "couldn't create AES-GCM cipher")
+}
+
+// chunkSealer seals and opens the chunks of a tarball in order. Each chunk's
+// nonce is its index, with the last chunk marked, so chunks can't be
+// reordered, dropped or truncated without the tarball failing to decrypt. The
+// data key is only ever used for one tarball, so the nonces aren't reused.
+type chunkSealer struct {
+	aead       cipher.AEAD
+	additional []byte
+	index      uint32
+	done       bool
+}
+
+func (s *chunkSealer) nonce(last bool) ([]byte, error) {
+	if s.done {
+		return nil, errors.New("data after the last chunk")
+	}
+	if s.index == ^uint32(0) {
+		return nil, errors.New("too many chunks")
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	binary.BigEndian.PutUint32(nonce[len(nonce)-5:], s.index)
+	if last {
+		nonce[len(nonce)-1] = 1
+		s.done = true
+	}
+	s.index++
+	return nonce, nil
+}
+
+func (s *chunkSealer) seal(plain []byte, last bool) ([]byte, error) {
+	nonce, err := s.nonce(last)
+	if err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nil, nonce, plain, s.additional), nil
+}
+
+func (s *chunkSealer) open(sealed []byte, last bool) ([]byte, error) {
+	nonce, err := s.nonce(last)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := s.aead.Open(nil, nonce, sealed, s.additional)
+	return plain, errors.Wrapf(err, "couldn't decrypt chunk %d, the tarball is corrupt or truncated", s.index-1)
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(t *testing.T) []byte {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		t.Fatalf("couldn't generate key: %v", err)
+	}
+	return key
+}
+
+func encryptWithKey(t *testing.T, key, plain []byte) []byte {
+	var encrypted bytes.Buffer
+	if err := encrypt(&encrypted, bytes.NewReader(plain), localKey(key), &header{KeySource: localKeySource}); err != nil {
+		t.Fatalf("unexpected error encrypting: %v", err)
+	}
+	return encrypted.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := testKey(t)
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		encrypted := encryptWithKey(t, key, plain)
+		if size > 16 && bytes.Contains(encrypted, plain) {
+			t.Errorf("size %d: plaintext found in encrypted tarball", size)
+		}
+		var decrypted bytes.Buffer
+		if err := Decrypt(&decrypted, bytes.NewReader(encrypted), key); err != nil {
+			t.Fatalf("size %d: unexpected error decrypting: %v", size, err)
+		}
+		if !bytes.Equal(decrypted.Bytes(), plain) {
+			t.Errorf("size %d: decrypted %d bytes that don't match", size, decrypted.Len())
+		}
+	}
+}
+
+func TestDecryptFailures(t *testing.T) {
+	key := testKey(t)
+	plain := make([]byte, 2*chunkSize+5)
+	encrypted := encryptWithKey(t, key, plain)
+	headerEnd := len(encrypted) - (len(plain) + 3*16)
+
+	tampered := append([]byte(nil), encrypted...)
+	tampered[len(tampered)-20] ^= 1
+
+	truncated := encrypted[:len(encrypted)-(5+16)]
+
+	testCases := []struct {
+		desc      string
+		encrypted []byte
+		key       []byte
+		expected  string
+	}{
+		{desc: "wrong key", encrypted: encrypted, key: testKey(t), expected: "right key"},
+		{desc: "no key", encrypted: encrypted, expected: "encrypted with a key"},
+		{desc: "tampered", encrypted: tampered, key: key, expected: "corrupt"},
+		{desc: "truncated", encrypted: truncated, key: key, expected: "corrupt"},
+		{desc: "header only", encrypted: encrypted[:headerEnd], key: key, expected: "corrupt"},
+		{desc: "not encrypted", encrypted: plain, key: key, expected: "not an encrypted"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := Decrypt(ioutil.Discard, bytes.NewReader(tc.encrypted), tc.key)
+			if err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("expected error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestEncryptFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-encryption")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "results.tar.gz")
+	plain := []byte("results")
+	if err := ioutil.WriteFile(path, plain, 0644); err != nil {
+		t.Fatalf("couldn't write tarball: %v", err)
+	}
+
+	cfg := Config{KeyEnv: "SONOBUOY_TEST_RESULTS_KEY"}
+	if err := EncryptFile(cfg, path); err == nil {
+		t.Fatal("expected an error without a key")
+	}
+
+	key := testKey(t)
+	os.Setenv(cfg.KeyEnv, base64.StdEncoding.EncodeToString(key))
+	defer os.Unsetenv(cfg.KeyEnv)
+	if err := EncryptFile(cfg, path); err != nil {
+		t.Fatalf("unexpected error encrypting: %v", err)
+	}
+	if encrypted, err := IsEncrypted(path); err != nil || !encrypted {
+		t.Fatalf("expected %v to be encrypted, got %v, %v", path, encrypted, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected only the tarball to be left, got %d files", len(files))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("couldn't open tarball: %v", err)
+	}
+	defer f.Close()
+	var decrypted bytes.Buffer
+	if err := Decrypt(&decrypted, f, key); err != nil {
+		t.Fatalf("unexpected error decrypting: %v", err)
+	}
+	if decrypted.String() != string(plain) {
+		t.Errorf("expected %q, got %q", plain, decrypted.String())
+	}
+}
+
+func TestKMSRoundTrip(t *testing.T) {
+	const name = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	var calls []string
+	// The fake KMS "encrypts" by reversing the bytes.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+		var req map[string][]byte
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		field, out := "plaintext", "ciphertext"
+		if strings.HasSuffix(r.URL.Path, ":decrypt") {
+			field, out = out, field
+		}
+		data := req[field]
+		reversed := make([]byte, len(data))
+		for i, b := range data {
+			reversed[len(data)-1-i] = b
+		}
+		json.NewEncoder(w).Encode(map[string][]byte{out: reversed})
+	}))
+	defer server.Close()
+
+	defer func(endpoint string, client func() (*http.Client, error)) {
+		kmsEndpoint, kmsClient = endpoint, client
+	}(kmsEndpoint, kmsClient)
+	kmsEndpoint = server.URL
+	kmsClient = func() (*http.Client, error) { return server.Client(), nil }
+
+	wrapper, hdr, err := wrapperFor(Config{KMSKey: name})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var encrypted bytes.Buffer
+	if err := encrypt(&encrypted, strings.NewReader("results"), wrapper, hdr); err != nil {
+		t.Fatalf("unexpected error encrypting: %v", err)
+	}
+	var decrypted bytes.Buffer
+	if err := Decrypt(&decrypted, &encrypted, nil); err != nil {
+		t.Fatalf("unexpected error decrypting: %v", err)
+	}
+	if decrypted.String() != "results" {
+		t.Errorf("expected %q, got %q", "results", decrypted.String())
+	}
+
+	expected := []string{"/v1/" + name + ":encrypt", "/v1/" + name + ":decrypt"}
+	if strings.Join(calls, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	testCases := []struct {
+		cfg   Config
+		valid bool
+	}{
+		{cfg: Config{}, valid: true},
+		{cfg: Config{KeyEnv: "RESULTS_KEY"}, valid: true},
+		{cfg: Config{KMSKey: "projects/p/locations/global/keyRings/r/cryptoKeys/k"}, valid: true},
+		{cfg: Config{KMSKey: "k"}},
+		{cfg: Config{KeyEnv: "RESULTS_KEY", KMSKey: "projects/p/locations/global/keyRings/r/cryptoKeys/k"}},
+	}
+	for _, tc := range testCases {
+		if err := tc.cfg.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%+v: expected valid %v, got %v", tc.cfg, tc.valid, err)
+		}
+	}
+}
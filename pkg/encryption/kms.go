@@ -0,0 +1,95 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2/google"
+)
+
+const kmsScope = "https://www.googleapis.com/auth/cloudkms"
+
+// kmsEndpoint is the Cloud KMS API, and can be replaced in tests.
+var kmsEndpoint = "https://cloudkms.googleapis.com"
+
+// kmsClient returns the HTTP client Cloud KMS is called with, and can be
+// replaced in tests.
+var kmsClient = func() (*http.Client, error) {
+	return google.DefaultClient(context.Background(), kmsScope)
+}
+
+// kmsKey wraps data keys with a Google Cloud KMS crypto key, using the
+// application default credentials (such as GOOGLE_APPLICATION_CREDENTIALS, or
+// the node's service account).
+type kmsKey struct {
+	name   string
+	client *http.Client
+}
+
+func newKMSKey(name string) (*kmsKey, error) {
+	client, err := kmsClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't find Google Cloud credentials to use KMS")
+	}
+	return &kmsKey{name: name, client: client}, nil
+}
+
+func (k *kmsKey) wrap(dataKey []byte) ([]byte, error) {
+	var resp struct {
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	err := k.call("encrypt", map[string][]byte{"plaintext": dataKey}, &resp)
+	return resp.Ciphertext, err
+}
+
+func (k *kmsKey) unwrap(wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	err := k.call("decrypt", map[string][]byte{"ciphertext": wrapped}, &resp)
+	return resp.Plaintext, err
+}
+
+// call POSTs req to one of the key's methods, decoding the response into
+// resp. Byte slices are base64 encoded in JSON, as the API expects.
+func (k *kmsKey) call(method string, req, resp interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't encode KMS %v request", method)
+	}
+	url := fmt.Sprintf("%s/v1/%s:%s", kmsEndpoint, k.name, method)
+	httpResp, err := k.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "couldn't %v data key with %v", method, k.name)
+	}
+	defer httpResp.Body.Close()
+	respBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't read KMS %v response", method)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return errors.Errorf("couldn't %v data key with %v: %v: %s", method, k.name, httpResp.Status, bytes.TrimSpace(respBody))
+	}
+	return errors.Wrapf(json.Unmarshal(respBody, resp), "couldn't decode KMS %v response", method)
+}
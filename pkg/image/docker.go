@@ -0,0 +1,126 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Client pulls, retags, pushes and saves images, and runs commands in them.
+type Client interface {
+	Pull(image string) error
+	Tag(image, target string) error
+	Push(image string) error
+	Save(images []string, output string) error
+	// Run runs command, its executable and arguments, in a container of
+	// image and returns what it wrote to stdout.
+	Run(image string, command ...string) (string, error)
+}
+
+// DockerClient is a Client that runs the docker CLI, so it uses whatever
+// daemon and registry credentials docker is configured with.
+type DockerClient struct {
+	// Command is the docker binary to run. It defaults to "docker".
+	Command string
+}
+
+// Pull pulls image.
+func (d DockerClient) Pull(image string) error {
+	return d.run("pull", image)
+}
+
+// Tag gives image the name target.
+func (d DockerClient) Tag(image, target string) error {
+	return d.run("tag", image, target)
+}
+
+// Push pushes image.
+func (d DockerClient) Push(image string) error {
+	return d.run("push", image)
+}
+
+// Save writes images to a tarball at output, which can be loaded with
+// `docker load`.
+func (d DockerClient) Save(images []string, output string) error {
+	return d.run(append([]string{"save", "-o", output}, images...)...)
+}
+
+// Run runs command in a throwaway container of image, in place of its
+// entrypoint.
+func (d DockerClient) Run(image string, command ...string) (string, error) {
+	if len(command) == 0 {
+		return "", errors.New("no command to run")
+	}
+	return d.output(append([]string{"run", "--rm", "--entrypoint", command[0], image}, command[1:]...)...)
+}
+
+func (d DockerClient) run(args ...string) error {
+	_, err := d.output(args...)
+	return err
+}
+
+func (d DockerClient) output(args ...string) (string, error) {
+	command := d.Command
+	if command == "" {
+		command = "docker"
+	}
+
+	logrus.WithField("args", args).Debug("running docker")
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "docker %v failed: %v", strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// PullAll pulls each of images.
+func PullAll(c Client, images []string) error {
+	for _, image := range images {
+		logrus.WithField("image", image).Info("pulling image")
+		if err := c.Pull(image); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Mirror pulls each image in the mapping, tags it with its mapped name and
+// pushes it.
+func Mirror(c Client, m Mapping) error {
+	for _, image := range m.Images() {
+		target := m.Get(image)
+		logrus.WithFields(logrus.Fields{"image": image, "target": target}).Info("mirroring image")
+		if err := c.Pull(image); err != nil {
+			return err
+		}
+		if err := c.Tag(image, target); err != nil {
+			return err
+		}
+		if err := c.Push(target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
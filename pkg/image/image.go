@@ -0,0 +1,75 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package image lists the container images a Sonobuoy run needs and mirrors
+// them to a private registry, so that runs can be done in air-gapped clusters.
+package image
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// imageLine matches the image of a container in a generated manifest,
+// including those of the plugin definitions embedded in it.
+var imageLine = regexp.MustCompile(`(?m)^([ \t]*(?:- )?image:[ \t]*)(\S+)[ \t]*$`)
+
+// Collect returns the images used in a generated manifest, plus any extra
+// ones given (such as the worker image, which is only in the Sonobuoy
+// config), sorted and without duplicates.
+func Collect(manifest []byte, extra ...string) []string {
+	seen := map[string]bool{}
+	for _, match := range imageLine.FindAllSubmatch(manifest, -1) {
+		seen[unquote(string(match[2]))] = true
+	}
+	for _, image := range extra {
+		if image != "" {
+			seen[image] = true
+		}
+	}
+
+	images := make([]string, 0, len(seen))
+	for image := range seen {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// MirrorName returns the name an image is given in registry. The registry
+// host of the image is replaced, but the rest of its repository and its tag
+// are kept, so gcr.io/heptio-images/sonobuoy:v0.11.0 becomes
+// registry.example.com/heptio-images/sonobuoy:v0.11.0.
+func MirrorName(image, registry string) string {
+	registry = strings.TrimSuffix(registry, "/")
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && isRegistryHost(parts[0]) {
+		return registry + "/" + parts[1]
+	}
+	return registry + "/" + image
+}
+
+// isRegistryHost reports whether the first component of an image name is a
+// registry host rather than part of the repository, the same way docker
+// decides it.
+func isRegistryHost(component string) bool {
+	return strings.ContainsAny(component, ".:") || component == "localhost"
+}
+
+func unquote(s string) string {
+	return strings.Trim(s, `"'`)
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testManifest = `
+apiVersion: v1
+data:
+  e2e.yaml: |
+    spec:
+      image: gcr.io/heptio-images/kube-conformance:latest
+      imagePullPolicy: Always
+kind: ConfigMap
+---
+spec:
+  containers:
+  - image: "gcr.io/heptio-images/sonobuoy:master"
+    name: kube-sonobuoy
+`
+
+func TestCollect(t *testing.T) {
+	images := Collect([]byte(testManifest), "gcr.io/heptio-images/sonobuoy:master", "busybox", "")
+	expected := []string{
+		"busybox",
+		"gcr.io/heptio-images/kube-conformance:latest",
+		"gcr.io/heptio-images/sonobuoy:master",
+	}
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("expected %v, got %v", expected, images)
+	}
+}
+
+func TestMirrorName(t *testing.T) {
+	testCases := []struct {
+		image    string
+		registry string
+		expected string
+	}{
+		{"gcr.io/heptio-images/sonobuoy:v0.11.0", "registry.example.com", "registry.example.com/heptio-images/sonobuoy:v0.11.0"},
+		{"gcr.io/heptio-images/sonobuoy:v0.11.0", "registry.example.com/mirror/", "registry.example.com/mirror/heptio-images/sonobuoy:v0.11.0"},
+		{"localhost:5000/sonobuoy", "registry.example.com", "registry.example.com/sonobuoy"},
+		{"library/busybox", "registry.example.com", "registry.example.com/library/busybox"},
+		{"busybox", "registry.example.com", "registry.example.com/busybox"},
+	}
+
+	for _, tc := range testCases {
+		if name := MirrorName(tc.image, tc.registry); name != tc.expected {
+			t.Errorf("MirrorName(%q, %q): expected %q, got %q", tc.image, tc.registry, tc.expected, name)
+		}
+	}
+}
+
+func TestMapping(t *testing.T) {
+	m := NewMapping([]string{
+		"gcr.io/heptio-images/kube-conformance:latest",
+		"gcr.io/heptio-images/sonobuoy:master",
+	}, "registry.example.com")
+
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatalf("unexpected error writing mapping: %v", err)
+	}
+	read, err := ReadMapping(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error reading mapping: %v", err)
+	}
+	if !reflect.DeepEqual(read, m) {
+		t.Errorf("expected %v, got %v", m, read)
+	}
+
+	rewritten := string(read.Rewrite([]byte(testManifest)))
+	for _, expected := range []string{
+		"\n      image: registry.example.com/heptio-images/kube-conformance:latest\n      imagePullPolicy: Always\n",
+		"\n  - image: registry.example.com/heptio-images/sonobuoy:master\n",
+	} {
+		if !strings.Contains(rewritten, expected) {
+			t.Errorf("expected rewritten manifest to contain %q, got\n%v", expected, rewritten)
+		}
+	}
+	if read.Get("busybox") != "busybox" {
+		t.Errorf("expected unmapped image to be unchanged, got %v", read.Get("busybox"))
+	}
+}
+
+type fakeClient struct {
+	calls  []string
+	output string
+}
+
+func (f *fakeClient) Pull(image string) error {
+	f.calls = append(f.calls, "pull "+image)
+	return nil
+}
+
+func (f *fakeClient) Tag(image, target string) error {
+	f.calls = append(f.calls, "tag "+image+" "+target)
+	return nil
+}
+
+func (f *fakeClient) Push(image string) error {
+	f.calls = append(f.calls, "push "+image)
+	return nil
+}
+
+func (f *fakeClient) Save(images []string, output string) error {
+	f.calls = append(f.calls, "save "+output+" "+strings.Join(images, " "))
+	return nil
+}
+
+func (f *fakeClient) Run(image string, command ...string) (string, error) {
+	f.calls = append(f.calls, "run "+image+" "+strings.Join(command, " "))
+	return f.output, nil
+}
+
+func TestMirror(t *testing.T) {
+	client := &fakeClient{}
+	m := Mapping{"gcr.io/a/b:1": "reg/a/b:1"}
+	if err := Mirror(client, m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"pull gcr.io/a/b:1", "tag gcr.io/a/b:1 reg/a/b:1", "push reg/a/b:1"}
+	if !reflect.DeepEqual(client.calls, expected) {
+		t.Errorf("expected %v, got %v", expected, client.calls)
+	}
+}
+
+func TestReadRepoList(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		expected  RepoList
+		unknown   []string
+		expectErr bool
+	}{
+		{
+			name:     "registries",
+			input:    "e2eRegistry: registry.example.com/e2e\ngcRegistry: registry.example.com:5000\n",
+			expected: RepoList{"e2eRegistry": "registry.example.com/e2e", "gcRegistry": "registry.example.com:5000"},
+		},
+		{
+			name:     "json",
+			input:    `{"dockerLibraryRegistry": "registry.example.com/library"}`,
+			expected: RepoList{"dockerLibraryRegistry": "registry.example.com/library"},
+		},
+		{
+			name:     "unknown registry",
+			input:    "e2eRegistry: registry.example.com/e2e\ne2eRegsitry: registry.example.com/e2e\n",
+			expected: RepoList{"e2eRegistry": "registry.example.com/e2e", "e2eRegsitry": "registry.example.com/e2e"},
+			unknown:  []string{"e2eRegsitry"},
+		},
+		{name: "empty", input: "", expectErr: true},
+		{name: "not a map", input: "- registry.example.com\n", expectErr: true},
+		{name: "scheme", input: "e2eRegistry: https://registry.example.com\n", expectErr: true},
+		{name: "tag", input: "e2eRegistry: registry.example.com/e2e:v1\n", expectErr: true},
+		{name: "empty component", input: "e2eRegistry: registry.example.com//e2e\n", expectErr: true},
+		{name: "empty registry", input: "e2eRegistry: \"\"\n", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := ReadRepoList(strings.NewReader(tc.input))
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", l)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(l, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, l)
+			}
+			if unknown := l.Unknown(); !reflect.DeepEqual(unknown, tc.unknown) {
+				t.Errorf("expected unknown registries %v, got %v", tc.unknown, unknown)
+			}
+		})
+	}
+}
+
+func TestE2EImages(t *testing.T) {
+	client := &fakeClient{output: `k8s.gcr.io/e2e-test-images/agnhost:2.20
+docker.io/library/nginx:1.14-alpine
+invalid.com/invalid/alpine:3.1
+gcr.io/authenticated-image-pulling/alpine:3.7
+k8s.gcr.io/pause:3.2
+
+docker.io/library/nginx:1.14-alpine
+`}
+	images, err := E2EImages(client, "gcr.io/heptio-images/kube-conformance:latest")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"docker.io/library/nginx:1.14-alpine", "k8s.gcr.io/e2e-test-images/agnhost:2.20", "k8s.gcr.io/pause:3.2"}
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("expected %v, got %v", expected, images)
+	}
+	if calls := []string{"run gcr.io/heptio-images/kube-conformance:latest /usr/local/bin/e2e.test --list-images"}; !reflect.DeepEqual(client.calls, calls) {
+		t.Errorf("expected calls %v, got %v", calls, client.calls)
+	}
+
+	if _, err := E2EImages(&fakeClient{output: "invalid.com/invalid/alpine:3.1\n"}, "conformance"); err == nil {
+		t.Error("expected an error when no images can be mirrored")
+	}
+}
+
+func TestNewRepoList(t *testing.T) {
+	images := []string{
+		"docker.io/library/nginx:1.14-alpine",
+		"k8s.gcr.io/e2e-test-images/agnhost:2.20",
+		"k8s.gcr.io/pause:3.2",
+	}
+	l := NewRepoList(images, "registry.example.com/mirror/")
+	expected := RepoList{
+		"dockerLibraryRegistry": "registry.example.com/mirror/library",
+		"e2eRegistry":           "registry.example.com/mirror/e2e-test-images",
+		"gcEtcdRegistry":        "registry.example.com/mirror",
+		"gcRegistry":            "registry.example.com/mirror",
+		"promoterE2eRegistry":   "registry.example.com/mirror/e2e-test-images",
+	}
+	if !reflect.DeepEqual(l, expected) {
+		t.Errorf("expected %v, got %v", expected, l)
+	}
+	if err := l.Validate(); err != nil {
+		t.Errorf("expected a valid repo list, got %v", err)
+	}
+
+	// Each image is where the repo list says once it's mirrored.
+	for _, image := range images {
+		mirrored := MirrorName(image, "registry.example.com/mirror")
+		found := false
+		for _, registry := range l {
+			if rest := strings.TrimPrefix(mirrored, registry+"/"); rest != mirrored && !strings.Contains(rest, "/") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected %v, mirrored as %v, to be in one of the registries of %v", image, mirrored, l)
+		}
+	}
+}
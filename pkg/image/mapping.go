@@ -0,0 +1,99 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io"
+	"os"
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	kubeyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// Mapping maps the images a run normally uses to the ones to use instead,
+// such as copies of them in a private registry.
+type Mapping map[string]string
+
+// NewMapping returns the mapping of each image to its name in registry.
+func NewMapping(images []string, registry string) Mapping {
+	m := Mapping{}
+	for _, image := range images {
+		m[image] = MirrorName(image, registry)
+	}
+	return m
+}
+
+// Get returns the image to use in place of image.
+func (m Mapping) Get(image string) string {
+	if mapped, ok := m[image]; ok {
+		return mapped
+	}
+	return image
+}
+
+// Images returns the original images in the mapping, sorted.
+func (m Mapping) Images() []string {
+	images := make([]string, 0, len(m))
+	for image := range m {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// Rewrite replaces every mapped image in a generated manifest.
+func (m Mapping) Rewrite(manifest []byte) []byte {
+	if len(m) == 0 {
+		return manifest
+	}
+	return imageLine.ReplaceAllFunc(manifest, func(line []byte) []byte {
+		match := imageLine.FindSubmatch(line)
+		return append(append([]byte{}, match[1]...), m.Get(unquote(string(match[2])))...)
+	})
+}
+
+// Write writes the mapping as YAML, in the format read by ReadMapping.
+func (m Mapping) Write(w io.Writer) error {
+	b, err := yaml.Marshal(m)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode image mapping")
+	}
+	_, err = w.Write(b)
+	return errors.WithStack(err)
+}
+
+// ReadMapping reads a mapping file, which is a YAML or JSON object of
+// original image names to the names to use instead.
+func ReadMapping(r io.Reader) (Mapping, error) {
+	m := Mapping{}
+	if err := kubeyaml.NewYAMLOrJSONDecoder(r, 4096).Decode(&m); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "couldn't decode image mapping")
+	}
+	return m, nil
+}
+
+// LoadMapping reads the mapping file at path.
+func LoadMapping(path string) (Mapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't open image mapping %v", path)
+	}
+	defer f.Close()
+	return ReadMapping(f)
+}
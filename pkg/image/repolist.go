@@ -0,0 +1,259 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package image
+
+import (
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	kubeyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// RepoListEnv is the environment variable the e2e tests read the path of
+// their repo list from.
+const RepoListEnv = "KUBE_TEST_REPO_LIST"
+
+// RepoList overrides the registries the e2e tests pull their own images
+// from, such as with copies of them in a private registry. It's keyed by the
+// names the tests give their registries, such as e2eRegistry, and is written
+// to the file RepoListEnv names.
+type RepoList map[string]string
+
+// knownRegistries are the registries named by the e2e tests of the Kubernetes
+// versions Sonobuoy supports, and later ones. Each version only reads its own,
+// and ignores the rest.
+var knownRegistries = map[string]bool{
+	"buildImageRegistry":      true,
+	"dockerGluster":           true,
+	"dockerLibraryRegistry":   true,
+	"e2eRegistry":             true,
+	"e2eVolumeRegistry":       true,
+	"gcAuthenticatedRegistry": true,
+	"gcEtcdRegistry":          true,
+	"gcRegistry":              true,
+	"gcrReleaseRegistry":      true,
+	"invalidRegistry":         true,
+	"microsoftRegistry":       true,
+	"PrivateRegistry":         true,
+	"privateRegistry":         true,
+	"promoterE2eRegistry":     true,
+	"quayIncubator":           true,
+	"quayK8sCSI":              true,
+	"sampleRegistry":          true,
+	"sigStorageRegistry":      true,
+}
+
+// defaultRegistries are the registries the e2e tests pull from unless a repo
+// list overrides them, by the names the tests give them. Some have moved
+// between versions of the tests. Those used to test failing or authenticated
+// pulls, such as invalidRegistry, are left out, since they mustn't be
+// mirrored.
+var defaultRegistries = map[string][]string{
+	"buildImageRegistry":    {"k8s.gcr.io/build-image"},
+	"dockerGluster":         {"docker.io/gluster"},
+	"dockerLibraryRegistry": {"docker.io/library"},
+	"e2eRegistry":           {"gcr.io/kubernetes-e2e-test-images", "k8s.gcr.io/e2e-test-images"},
+	"e2eVolumeRegistry":     {"gcr.io/kubernetes-e2e-test-images/volume"},
+	"gcEtcdRegistry":        {"k8s.gcr.io"},
+	"gcRegistry":            {"k8s.gcr.io"},
+	"gcrReleaseRegistry":    {"gcr.io/gke-release"},
+	"microsoftRegistry":     {"mcr.microsoft.com"},
+	"promoterE2eRegistry":   {"k8s.gcr.io/e2e-test-images"},
+	"quayIncubator":         {"quay.io/kubernetes_incubator"},
+	"quayK8sCSI":            {"quay.io/k8scsi"},
+	"sampleRegistry":        {"gcr.io/google-samples"},
+	"sigStorageRegistry":    {"k8s.gcr.io/sig-storage"},
+}
+
+// E2EImagesCommand lists the images the e2e tests pull, one per line, when
+// run in the conformance image.
+var E2EImagesCommand = []string{"/usr/local/bin/e2e.test", "--list-images"}
+
+// E2EImages returns the images the e2e tests in conformanceImage pull, by
+// running them with E2EImagesCommand, sorted. Images from registries that
+// mustn't be mirrored aren't included.
+func E2EImages(c Client, conformanceImage string) ([]string, error) {
+	out, err := c.Run(conformanceImage, E2EImagesCommand...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't list the images of the e2e tests in %v", conformanceImage)
+	}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		if image := strings.TrimSpace(line); image != "" && mirrorable(image) {
+			seen[image] = true
+		}
+	}
+	if len(seen) == 0 {
+		return nil, errors.Errorf("the e2e tests in %v didn't list any images", conformanceImage)
+	}
+
+	images := make([]string, 0, len(seen))
+	for image := range seen {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images, nil
+}
+
+// NewRepoList returns the repo list that has the e2e tests pull images from
+// registry once they've been mirrored there with MirrorName. Only the
+// registries that some of images are in are overridden, so that each version
+// of the tests only has its own registries moved.
+func NewRepoList(images []string, registry string) RepoList {
+	l := RepoList{}
+	for name, defaults := range defaultRegistries {
+		for _, original := range defaults {
+			if holdsAny(original, images) {
+				l[name] = mirrorRegistry(original, registry)
+				break
+			}
+		}
+	}
+	return l
+}
+
+// mirrorRegistry returns what original becomes when it's mirrored to
+// registry, consistently with MirrorName, so that an image in original is in
+// the result once it's mirrored.
+func mirrorRegistry(original, registry string) string {
+	registry = strings.TrimSuffix(registry, "/")
+	parts := strings.SplitN(original, "/", 2)
+	if len(parts) == 2 {
+		return registry + "/" + parts[1]
+	}
+	return registry
+}
+
+// mirrorable reports whether image is in one of the registries the e2e tests
+// pull from by default, rather than one they test failing pulls from.
+func mirrorable(image string) bool {
+	for _, defaults := range defaultRegistries {
+		for _, original := range defaults {
+			if strings.HasPrefix(image, original+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// holdsAny reports whether any of images is in registry itself, rather than
+// just under it.
+func holdsAny(registry string, images []string) bool {
+	for _, image := range images {
+		if rest := strings.TrimPrefix(image, registry+"/"); rest != image && !strings.Contains(rest, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadRepoList reads a repo list, which is a YAML or JSON object of registry
+// names to the registries to use instead, and validates it.
+func ReadRepoList(r io.Reader) (RepoList, error) {
+	l := RepoList{}
+	if err := kubeyaml.NewYAMLOrJSONDecoder(r, 4096).Decode(&l); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "couldn't decode e2e repo list")
+	}
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// LoadRepoList reads the repo list file at path.
+func LoadRepoList(path string) (RepoList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't open e2e repo list %v", path)
+	}
+	defer f.Close()
+	return ReadRepoList(f)
+}
+
+// Validate returns an error if the repo list is empty, or overrides a
+// registry with something that isn't one, such as a URL or an image with a
+// tag.
+func (l RepoList) Validate() error {
+	if len(l) == 0 {
+		return errors.New("e2e repo list doesn't override any registries")
+	}
+	for _, name := range l.names() {
+		if err := validateRegistry(l[name]); err != nil {
+			return errors.Wrapf(err, "invalid registry for %v in e2e repo list", name)
+		}
+	}
+	return nil
+}
+
+// Unknown returns the names in the repo list that no supported version of
+// the e2e tests reads, such as misspelled ones, sorted.
+func (l RepoList) Unknown() []string {
+	var unknown []string
+	for _, name := range l.names() {
+		if !knownRegistries[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
+
+// YAML returns the repo list in the format the e2e tests read.
+func (l RepoList) YAML() (string, error) {
+	b, err := yaml.Marshal(l)
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't encode e2e repo list")
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (l RepoList) names() []string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateRegistry checks that registry is a registry host, optionally with
+// a port and a path within it, such as registry.example.com:5000/e2e. The
+// tests add the image names and tags themselves.
+func validateRegistry(registry string) error {
+	switch {
+	case registry == "":
+		return errors.New("registry is empty")
+	case strings.Contains(registry, "://"):
+		return errors.Errorf("%q has a scheme, but should just be the registry's host and path", registry)
+	case strings.ContainsAny(registry, " \t\n@"):
+		return errors.Errorf("%q isn't a registry", registry)
+	}
+	for i, component := range strings.Split(registry, "/") {
+		if component == "" {
+			return errors.Errorf("%q has an empty path component", registry)
+		}
+		// Only the host can have a colon, before its port.
+		if i > 0 && strings.Contains(component, ":") {
+			return errors.Errorf("%q has a tag, but the tests add their own", registry)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netcheck
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Checker checks connectivity to the targets.
+type Checker struct {
+	// Get makes an HTTP GET request of url, failing unless it's answered
+	// with a 200.
+	Get func(url string) error
+	// Lookup resolves host.
+	Lookup func(host string) error
+	// Attempts is how many times each check is tried before it fails, with
+	// Interval between tries, so a single dropped packet isn't reported.
+	Attempts int
+	Interval time.Duration
+}
+
+// NewChecker returns a Checker that makes real requests and lookups, each of
+// which fails after timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	client := &http.Client{
+		Timeout: timeout,
+		// The targets are reached directly, not through any proxy the node
+		// is configured with.
+		Transport: &http.Transport{DisableKeepAlives: true},
+	}
+	resolver := &net.Resolver{}
+	return &Checker{
+		Get: func(url string) error {
+			resp, err := client.Get(url)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			io.Copy(ioutil.Discard, resp.Body)
+			if resp.StatusCode != http.StatusOK {
+				return errors.Errorf("unexpected status %v", resp.Status)
+			}
+			return nil
+		},
+		Lookup: func(host string) error {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			addrs, err := resolver.LookupHost(ctx, host)
+			if err == nil && len(addrs) == 0 {
+				err = errors.New("no addresses found")
+			}
+			return err
+		},
+		Attempts: 3,
+		Interval: time.Second,
+	}
+}
+
+// Check makes every check of targets from node: a request to the pod and node
+// port on each node, a request to the Service and a lookup of each name.
+func (c *Checker) Check(node string, targets *Targets) Report {
+	report := Report{Node: node, Checks: []Check{}}
+	for _, target := range targets.Nodes() {
+		address := hostPort(targets.Pods[target], TargetPort)
+		report.Checks = append(report.Checks, c.check(PodCheck, target, address, func() error {
+			return c.Get("http://" + address + "/")
+		}))
+	}
+
+	address := hostPort(targets.ServiceIP, TargetPort)
+	report.Checks = append(report.Checks, c.check(ServiceCheck, TargetName, address, func() error {
+		return c.Get("http://" + address + "/")
+	}))
+
+	for _, name := range targets.Names {
+		name := name
+		report.Checks = append(report.Checks, c.check(DNSCheck, name, name, func() error {
+			return c.Lookup(name)
+		}))
+	}
+
+	for _, target := range targets.Nodes() {
+		address := hostPort(targets.NodeIPs[target], int(targets.NodePort))
+		report.Checks = append(report.Checks, c.check(NodePortCheck, target, address, func() error {
+			return c.Get("http://" + address + "/")
+		}))
+	}
+	return report
+}
+
+// check tries fn up to c.Attempts times, returning how the last try went.
+func (c *Checker) check(kind, target, address string, fn func() error) Check {
+	var err error
+	var took time.Duration
+	for attempt := 1; attempt <= c.Attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(c.Interval)
+		}
+		start := time.Now()
+		err = fn()
+		took = time.Since(start)
+		if err == nil {
+			break
+		}
+	}
+
+	check := Check{Kind: kind, Target: target, Address: address, Millis: int64(took / time.Millisecond)}
+	log := logrus.WithFields(logrus.Fields{"kind": kind, "target": target, "address": address})
+	if err != nil {
+		check.Error = err.Error()
+		log.WithError(err).Warning("Network check failed")
+	} else {
+		log.Info("Network check succeeded")
+	}
+	return check
+}
+
+func hostPort(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
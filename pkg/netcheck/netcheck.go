@@ -0,0 +1,158 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package netcheck checks the network connectivity of the node it runs on for
+// the network-connectivity plugin: to a pod on every node, to a Service,
+// through the cluster's DNS and to a NodePort on every node.
+package netcheck
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/onsi/ginkgo/reporters"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ReportFile is the file in a node's results its Report is written to, as
+	// JSON.
+	ReportFile = "connectivity.json"
+	// JUnitFile is the file in a node's results its checks are written to as
+	// JUnit test cases, so they're counted like any other tests.
+	JUnitFile = "junit.xml"
+)
+
+// The kinds of check made from each node.
+const (
+	// PodCheck makes an HTTP request to the target pod on another node.
+	PodCheck = "pod"
+	// ServiceCheck makes an HTTP request to the target Service's cluster IP.
+	ServiceCheck = "service"
+	// DNSCheck looks up a name through the cluster's DNS.
+	DNSCheck = "dns"
+	// NodePortCheck makes an HTTP request to the target Service's node port
+	// on another node.
+	NodePortCheck = "node-port"
+)
+
+// Report is the result of every check made from a node.
+type Report struct {
+	Node string `json:"node"`
+	// Error is why no checks could be made, such as the targets never
+	// becoming ready.
+	Error  string  `json:"error,omitempty"`
+	Checks []Check `json:"checks"`
+}
+
+// Failed counts the checks that failed.
+func (r Report) Failed() int {
+	failed := 0
+	for _, c := range r.Checks {
+		if !c.OK() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Check is the result of a single check.
+type Check struct {
+	Kind string `json:"kind"`
+	// Target is the node whose pod or node port was checked, or the Service
+	// or name that was.
+	Target string `json:"target"`
+	// Address is what was requested or looked up.
+	Address string `json:"address"`
+	Error   string `json:"error,omitempty"`
+	// Millis is how long the check took, in milliseconds.
+	Millis int64 `json:"millis"`
+}
+
+// OK returns whether the check succeeded.
+func (c Check) OK() bool {
+	return c.Error == ""
+}
+
+// Name is the check's name as a test case.
+func (c Check) Name() string {
+	return fmt.Sprintf("%v to %v", c.Kind, c.Target)
+}
+
+// WriteResults writes report into dir, as JSON and as a JUnit test suite.
+func WriteResults(dir string, report Report) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "couldn't create results directory %v", dir)
+	}
+
+	blob, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode report")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ReportFile), blob, 0644); err != nil {
+		return errors.Wrap(err, "couldn't write report")
+	}
+
+	blob, err = xml.MarshalIndent(junitSuite(report), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode JUnit results")
+	}
+	blob = append([]byte(xml.Header), blob...)
+	return errors.Wrap(ioutil.WriteFile(filepath.Join(dir, JUnitFile), blob, 0644), "couldn't write JUnit results")
+}
+
+// junitTestSuite is a reporters.JUnitTestSuite with a name, so each node's
+// checks can be told apart.
+type junitTestSuite struct {
+	XMLName   xml.Name                  `xml:"testsuite"`
+	Name      string                    `xml:"name,attr"`
+	TestCases []reporters.JUnitTestCase `xml:"testcase"`
+	Tests     int                       `xml:"tests,attr"`
+	Failures  int                       `xml:"failures,attr"`
+}
+
+// junitSuite is report as a test suite with a test case for each check, or a
+// single failed one if no checks could be made.
+func junitSuite(report Report) junitTestSuite {
+	suite := junitTestSuite{Name: "network-connectivity " + report.Node}
+	if report.Error != "" {
+		suite.TestCases = []reporters.JUnitTestCase{{
+			Name:           "targets",
+			FailureMessage: &reporters.JUnitFailureMessage{Message: report.Error},
+		}}
+	}
+	for _, c := range report.Checks {
+		tc := reporters.JUnitTestCase{
+			Name: c.Name(),
+			Time: float64(c.Millis) / 1000,
+		}
+		if !c.OK() {
+			tc.FailureMessage = &reporters.JUnitFailureMessage{Message: fmt.Sprintf("%v: %v", c.Address, c.Error)}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Tests = len(suite.TestCases)
+	for _, tc := range suite.TestCases {
+		if tc.FailureMessage != nil {
+			suite.Failures++
+		}
+	}
+	return suite
+}
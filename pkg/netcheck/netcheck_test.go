@@ -0,0 +1,121 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netcheck
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	targets := &Targets{
+		Pods:      map[string]string{"node2": "10.0.2.5", "node1": "10.0.1.5"},
+		NodeIPs:   map[string]string{"node2": "192.168.0.2", "node1": "192.168.0.1"},
+		ServiceIP: "10.96.0.20",
+		NodePort:  30080,
+		Names:     []string{"sonobuoy-network-target.sonobuoy.svc"},
+	}
+	// The pod on node2 is only reachable on the second try, and the node
+	// port on node2 not at all.
+	tries := map[string]int{}
+	c := &Checker{
+		Get: func(url string) error {
+			tries[url]++
+			switch {
+			case url == "http://10.0.2.5:8080/" && tries[url] == 1:
+				return errors.New("timeout")
+			case url == "http://192.168.0.2:30080/":
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+		Lookup: func(host string) error {
+			return errors.New("no such host")
+		},
+		Attempts: 2,
+	}
+
+	report := c.Check("node1", targets)
+	var got []Check
+	for _, check := range report.Checks {
+		check.Millis = 0
+		got = append(got, check)
+	}
+	expected := []Check{
+		{Kind: PodCheck, Target: "node1", Address: "10.0.1.5:8080"},
+		{Kind: PodCheck, Target: "node2", Address: "10.0.2.5:8080"},
+		{Kind: ServiceCheck, Target: TargetName, Address: "10.96.0.20:8080"},
+		{Kind: DNSCheck, Target: "sonobuoy-network-target.sonobuoy.svc", Address: "sonobuoy-network-target.sonobuoy.svc", Error: "no such host"},
+		{Kind: NodePortCheck, Target: "node1", Address: "192.168.0.1:30080"},
+		{Kind: NodePortCheck, Target: "node2", Address: "192.168.0.2:30080", Error: "connection refused"},
+	}
+	if report.Node != "node1" || !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected checks %+v from node1, got %+v from %v", expected, got, report.Node)
+	}
+	if report.Failed() != 2 {
+		t.Errorf("expected 2 failed checks, got %v", report.Failed())
+	}
+	if tries["http://192.168.0.2:30080/"] != 2 {
+		t.Errorf("expected a failing check to be tried twice, got %v tries", tries["http://192.168.0.2:30080/"])
+	}
+}
+
+func TestWriteResults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy_netcheck_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	report := Report{Node: "node1", Checks: []Check{
+		{Kind: PodCheck, Target: "node2", Address: "10.0.2.5:8080", Millis: 3},
+		{Kind: NodePortCheck, Target: "node2", Address: "192.168.0.2:30080", Error: "connection refused"},
+	}}
+	if err := WriteResults(dir, report); err != nil {
+		t.Fatalf("unexpected error writing results: %v", err)
+	}
+
+	blob, err := ioutil.ReadFile(filepath.Join(dir, ReportFile))
+	if err != nil {
+		t.Fatalf("expected the report to be written: %v", err)
+	}
+	var written Report
+	if err := json.Unmarshal(blob, &written); err != nil || !reflect.DeepEqual(written, report) {
+		t.Errorf("expected report %+v, got %+v (%v)", report, written, err)
+	}
+
+	blob, err = ioutil.ReadFile(filepath.Join(dir, JUnitFile))
+	if err != nil {
+		t.Fatalf("expected the JUnit results to be written: %v", err)
+	}
+	var suite junitTestSuite
+	if err := xml.Unmarshal(blob, &suite); err != nil {
+		t.Fatalf("couldn't decode JUnit results: %v", err)
+	}
+	if suite.Name != "network-connectivity node1" || suite.Tests != 2 || suite.Failures != 1 {
+		t.Errorf("unexpected test suite %+v", suite)
+	}
+	if failure := suite.TestCases[1].FailureMessage; suite.TestCases[1].Name != "node-port to node2" || failure == nil || failure.Message != "192.168.0.2:30080: connection refused" {
+		t.Errorf("expected the node port check to fail, got %+v", suite.TestCases[1])
+	}
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netcheck
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	appsv1beta2 "k8s.io/api/apps/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// TargetName names the DaemonSet of pods, and the NodePort Service in
+	// front of them, that connectivity is checked against.
+	TargetName = "sonobuoy-network-target"
+	// TargetPort is the port the target pods serve on, and the port of the
+	// target Service.
+	TargetPort = 8080
+)
+
+// targetsPollInterval is how often the target pods are checked for being
+// ready.
+var targetsPollInterval = 5 * time.Second
+
+// TargetConfig is how the targets are created.
+type TargetConfig struct {
+	Namespace       string
+	Image           string
+	ImagePullPolicy corev1.PullPolicy
+}
+
+// Targets are what connectivity is checked against.
+type Targets struct {
+	// Pods maps each node to the IP of the target pod on it.
+	Pods map[string]string
+	// NodeIPs maps each node with a target pod to its IP.
+	NodeIPs   map[string]string
+	ServiceIP string
+	// NodePort is the target Service's port on every node.
+	NodePort int32
+	// Names are the names looked up through the cluster's DNS.
+	Names []string
+}
+
+// Nodes returns the nodes with a target pod, sorted.
+func (t *Targets) Nodes() []string {
+	nodes := make([]string, 0, len(t.Pods))
+	for node := range t.Pods {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+func targetLabels() map[string]string {
+	return map[string]string{
+		"component": "sonobuoy",
+		"app":       TargetName,
+	}
+}
+
+// EnsureTargets creates the target DaemonSet and Service, unless the checks of
+// another node already have.
+func EnsureTargets(client kubernetes.Interface, cfg TargetConfig) error {
+	labels := targetLabels()
+	ds := &appsv1beta2.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: TargetName, Namespace: cfg.Namespace, Labels: labels},
+		Spec: appsv1beta2.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:            "target",
+						Image:           cfg.Image,
+						ImagePullPolicy: cfg.ImagePullPolicy,
+						Command:         []string{"/sonobuoy", "network-check", "serve", "--port", strconv.Itoa(TargetPort)},
+						Env: []corev1.EnvVar{{
+							Name:      "NODE_NAME",
+							ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"}},
+						}},
+						Ports: []corev1.ContainerPort{{ContainerPort: TargetPort}},
+					}},
+					// The same nodes as plugins' DaemonSets are scheduled to.
+					Tolerations: []corev1.Toleration{
+						{Key: "node-role.kubernetes.io/master", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+						{Key: "CriticalAddonsOnly", Operator: corev1.TolerationOpExists},
+					},
+					NodeSelector: map[string]string{"beta.kubernetes.io/os": "linux"},
+				},
+			},
+		},
+	}
+	if _, err := client.AppsV1beta2().DaemonSets(cfg.Namespace).Create(ds); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrap(err, "couldn't create target DaemonSet")
+	}
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: TargetName, Namespace: cfg.Namespace, Labels: labels},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeNodePort,
+			Selector: labels,
+			Ports:    []corev1.ServicePort{{Port: TargetPort}},
+		},
+	}
+	if _, err := client.CoreV1().Services(cfg.Namespace).Create(svc); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrap(err, "couldn't create target Service")
+	}
+	return nil
+}
+
+// WaitForTargets waits until a target pod is ready on every node the target
+// DaemonSet is scheduled to, giving up after timeout, and returns the
+// targets.
+func WaitForTargets(client kubernetes.Interface, namespace string, timeout time.Duration) (*Targets, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		targets, err := readyTargets(client, namespace)
+		switch {
+		case err != nil:
+			logrus.WithError(err).Info("Waiting for network targets")
+		case targets != nil:
+			return targets, nil
+		}
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = errors.New("target pods aren't ready")
+			}
+			return nil, errors.Wrapf(err, "targets weren't ready after %v", timeout)
+		}
+		time.Sleep(targetsPollInterval)
+	}
+}
+
+// readyTargets returns the targets if a target pod is ready on every node it
+// should be, or nil if not yet.
+func readyTargets(client kubernetes.Interface, namespace string) (*Targets, error) {
+	ds, err := client.AppsV1beta2().DaemonSets(namespace).Get(TargetName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get target DaemonSet")
+	}
+	if ds.Status.DesiredNumberScheduled == 0 || ds.Status.NumberReady < ds.Status.DesiredNumberScheduled {
+		logrus.WithFields(logrus.Fields{
+			"ready":   ds.Status.NumberReady,
+			"desired": ds.Status.DesiredNumberScheduled,
+		}).Info("Waiting for network target pods to be ready")
+		return nil, nil
+	}
+
+	svc, err := client.CoreV1().Services(namespace).Get(TargetName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get target Service")
+	}
+	if len(svc.Spec.Ports) == 0 || svc.Spec.Ports[0].NodePort == 0 {
+		return nil, errors.New("target Service has no node port")
+	}
+
+	pods, err := client.CoreV1().Pods(namespace).List(metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(&metav1.LabelSelector{MatchLabels: targetLabels()}),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't list target pods")
+	}
+
+	targets := &Targets{
+		Pods:      map[string]string{},
+		NodeIPs:   map[string]string{},
+		ServiceIP: svc.Spec.ClusterIP,
+		NodePort:  svc.Spec.Ports[0].NodePort,
+		Names: []string{
+			fmt.Sprintf("%v.%v.svc", TargetName, namespace),
+			"kubernetes.default.svc",
+		},
+	}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || pod.Status.PodIP == "" || !podReady(&pod) {
+			continue
+		}
+		targets.Pods[pod.Spec.NodeName] = pod.Status.PodIP
+		targets.NodeIPs[pod.Spec.NodeName] = pod.Status.HostIP
+	}
+	if int32(len(targets.Pods)) < ds.Status.DesiredNumberScheduled {
+		return nil, nil
+	}
+	return targets, nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// Serve answers connectivity checks on port, responding with the name of the
+// node it's on, until it fails.
+func Serve(port int, node string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, node)
+	})
+	addr := net.JoinHostPort("", strconv.Itoa(port))
+	logrus.WithField("address", addr).Info("Serving network connectivity checks")
+	return errors.WithStack(http.ListenAndServe(addr, mux))
+}
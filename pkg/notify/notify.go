@@ -0,0 +1,220 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify tells webhooks, such as a Slack channel's, when a run has
+// finished and how it went.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// WebhookType POSTs the run's Summary as JSON.
+	WebhookType = "webhook"
+	// SlackType posts a message describing the run to a Slack incoming
+	// webhook.
+	SlackType = "slack"
+
+	// failedStatus is the status of a run in which something failed, as in
+	// the aggregator's status.
+	failedStatus = "failed"
+)
+
+// requestTimeout is how long each notification may take, so that an
+// unresponsive webhook can't hold up the end of the run.
+var requestTimeout = 30 * time.Second
+
+// Config is a webhook to notify when a run finishes.
+type Config struct {
+	// Type is either WebhookType or SlackType.
+	Type string `json:"Type" mapstructure:"Type"`
+	// URL is where the notification is POSTed.
+	URL string `json:"URL,omitempty" mapstructure:"URL"`
+	// URLEnv names an environment variable of the aggregator to read the URL
+	// from instead, for webhooks whose URL is a secret.
+	URLEnv string `json:"URLEnv,omitempty" mapstructure:"URLEnv"`
+	// Headers are added to each notification, such as for authorization.
+	Headers map[string]string `json:"Headers,omitempty" mapstructure:"Headers"`
+	// OnlyOnFailure skips the notification for runs that didn't fail.
+	OnlyOnFailure bool `json:"OnlyOnFailure,omitempty" mapstructure:"OnlyOnFailure"`
+}
+
+// Validate returns an error if notifications can't be sent with the config.
+func (c Config) Validate() error {
+	switch c.Type {
+	case WebhookType, SlackType:
+	default:
+		return errors.Errorf("unknown notification type %q", c.Type)
+	}
+
+	if (c.URL == "") == (c.URLEnv == "") {
+		return errors.Errorf("%v notification needs exactly one of a URL or URLEnv", c.Type)
+	}
+	return nil
+}
+
+// url returns where the notification is sent.
+func (c Config) url() (string, error) {
+	if c.URLEnv == "" {
+		return c.URL, nil
+	}
+	url := os.Getenv(c.URLEnv)
+	if url == "" {
+		return "", errors.Errorf("%v must be set to send %v notification", c.URLEnv, c.Type)
+	}
+	return url, nil
+}
+
+// Summary is what notifications say about a run.
+type Summary struct {
+	// Run is the run's UUID.
+	Run       string `json:"run"`
+	Namespace string `json:"namespace"`
+	// Status is the status of the run's plugins as a whole, as in the
+	// aggregator's status, or "failed" if the run itself had errors.
+	Status string `json:"status"`
+	// Errors counts the errors during the run besides the plugins' own, such
+	// as failed queries.
+	Errors  int             `json:"errors,omitempty"`
+	Plugins []PluginSummary `json:"plugins"`
+	// Results is where the results tarball is: its storage location if it
+	// was stored, otherwise its path in the aggregator's pod.
+	Results string `json:"results,omitempty"`
+}
+
+// PluginSummary is what notifications say about each plugin.
+type PluginSummary struct {
+	Plugin string `json:"plugin"`
+	Status string `json:"status"`
+	// Items counts the plugin's expected results by status.
+	Items map[string]int `json:"items,omitempty"`
+}
+
+// Failed returns whether the run failed.
+func (s *Summary) Failed() bool {
+	return s.Status == failedStatus || s.Errors > 0
+}
+
+// Send sends each configured notification about the run, returning an error
+// for the ones that couldn't be sent.
+func Send(cfgs []Config, summary *Summary) error {
+	client := &http.Client{Timeout: requestTimeout}
+	var failures []string
+	for _, cfg := range cfgs {
+		if cfg.OnlyOnFailure && !summary.Failed() {
+			continue
+		}
+		if err := send(client, cfg, summary); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("couldn't send notifications: %v", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func send(client *http.Client, cfg Config, summary *Summary) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	url, err := cfg.url()
+	if err != nil {
+		return err
+	}
+
+	var payload interface{} = summary
+	if cfg.Type == SlackType {
+		payload = slackMessage{Text: slackText(summary)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode notification")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "couldn't make %v notification", cfg.Type)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range cfg.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't send %v notification", cfg.Type)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// The URL itself isn't included, since it may be a secret.
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errors.Errorf("got a %v response sending %v notification: %s", resp.StatusCode, cfg.Type, respBody)
+	}
+	return nil
+}
+
+// slackMessage is the body of a message to a Slack incoming webhook.
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+// slackText describes the run in Slack's markup, with a line per plugin.
+func slackText(summary *Summary) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Sonobuoy run `%v` in namespace `%v` is *%v*", summary.Run, summary.Namespace, summary.Status)
+	if summary.Errors > 0 {
+		fmt.Fprintf(&b, " with %d errors", summary.Errors)
+	}
+	b.WriteString("\n")
+	for _, p := range summary.Plugins {
+		fmt.Fprintf(&b, "• %v: %v", p.Plugin, p.Status)
+		if len(p.Items) > 1 {
+			fmt.Fprintf(&b, " (%v)", itemCounts(p.Items))
+		}
+		b.WriteString("\n")
+	}
+	if summary.Results != "" {
+		fmt.Fprintf(&b, "Results: %v\n", summary.Results)
+	}
+	return b.String()
+}
+
+// itemCounts lists how many results have each status, in a stable order.
+func itemCounts(items map[string]int) string {
+	statuses := make([]string, 0, len(items))
+	for status := range items {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	counts := make([]string, len(statuses))
+	for i, status := range statuses {
+		counts[i] = fmt.Sprintf("%d %v", items[status], status)
+	}
+	return strings.Join(counts, ", ")
+}
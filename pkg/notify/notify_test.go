@@ -0,0 +1,154 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		cfg       Config
+		expectErr bool
+	}{
+		{name: "webhook", cfg: Config{Type: WebhookType, URL: "https://example.com/hook"}},
+		{name: "slack from env", cfg: Config{Type: SlackType, URLEnv: "SLACK_WEBHOOK_URL"}},
+		{name: "no url", cfg: Config{Type: WebhookType}, expectErr: true},
+		{name: "both urls", cfg: Config{Type: SlackType, URL: "https://example.com/hook", URLEnv: "SLACK_WEBHOOK_URL"}, expectErr: true},
+		{name: "unknown", cfg: Config{Type: "email", URL: "https://example.com/hook"}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if (err != nil) != tc.expectErr {
+				t.Errorf("expected error: %v, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+// recorder records the bodies and headers of the notifications it's sent.
+type recorder struct {
+	bodies  []string
+	headers []http.Header
+	status  int
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.bodies = append(r.bodies, string(body))
+	r.headers = append(r.headers, req.Header)
+	if r.status != 0 {
+		w.WriteHeader(r.status)
+	}
+}
+
+var exampleSummary = &Summary{
+	Run:       "8ffb0e15-a1e4-4e07-a03d-56d4a66a1ad0",
+	Namespace: "heptio-sonobuoy",
+	Status:    "failed",
+	Plugins: []PluginSummary{
+		{Plugin: "e2e", Status: "complete", Items: map[string]int{"complete": 1}},
+		{Plugin: "systemd-logs", Status: "failed", Items: map[string]int{"complete": 2, "failed": 1}},
+	},
+	Results: "s3://results/201810151200_sonobuoy_8ffb0e15-a1e4-4e07-a03d-56d4a66a1ad0.tar.gz",
+}
+
+func TestSend(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	os.Setenv("TEST_SLACK_WEBHOOK_URL", srv.URL)
+	defer os.Unsetenv("TEST_SLACK_WEBHOOK_URL")
+
+	err := Send([]Config{
+		{Type: WebhookType, URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer secret"}},
+		{Type: SlackType, URLEnv: "TEST_SLACK_WEBHOOK_URL", OnlyOnFailure: true},
+	}, exampleSummary)
+	if err != nil {
+		t.Fatalf("unexpected error sending notifications: %v", err)
+	}
+	if len(rec.bodies) != 2 {
+		t.Fatalf("expected 2 notifications, got %d", len(rec.bodies))
+	}
+
+	var summary Summary
+	if err := json.Unmarshal([]byte(rec.bodies[0]), &summary); err != nil {
+		t.Fatalf("couldn't decode webhook notification %q: %v", rec.bodies[0], err)
+	}
+	if summary.Run != exampleSummary.Run || len(summary.Plugins) != 2 || summary.Results != exampleSummary.Results {
+		t.Errorf("unexpected webhook notification %+v", summary)
+	}
+	if auth := rec.headers[0].Get("Authorization"); auth != "Bearer secret" {
+		t.Errorf("expected Authorization header to be set, got %q", auth)
+	}
+
+	var message slackMessage
+	if err := json.Unmarshal([]byte(rec.bodies[1]), &message); err != nil {
+		t.Fatalf("couldn't decode slack notification %q: %v", rec.bodies[1], err)
+	}
+	for _, expected := range []string{"*failed*", "systemd-logs: failed (2 complete, 1 failed)", "Results: s3://results/"} {
+		if !strings.Contains(message.Text, expected) {
+			t.Errorf("expected slack message to contain %q, got %q", expected, message.Text)
+		}
+	}
+}
+
+func TestSend_onlyOnFailure(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	err := Send([]Config{{Type: SlackType, URL: srv.URL, OnlyOnFailure: true}}, &Summary{Status: "complete"})
+	if err != nil {
+		t.Fatalf("unexpected error sending notifications: %v", err)
+	}
+	if len(rec.bodies) != 0 {
+		t.Errorf("expected no notifications for a run that didn't fail, got %v", rec.bodies)
+	}
+}
+
+func TestSend_error(t *testing.T) {
+	rec := &recorder{status: http.StatusForbidden}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	err := Send([]Config{
+		{Type: WebhookType, URL: srv.URL},
+		{Type: SlackType, URLEnv: "TEST_UNSET_WEBHOOK_URL"},
+	}, exampleSummary)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(rec.bodies) != 1 {
+		t.Errorf("expected the webhook to still be notified, got %d notifications", len(rec.bodies))
+	}
+	for _, expected := range []string{"403", "TEST_UNSET_WEBHOOK_URL"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to mention %v, got %v", expected, err)
+		}
+	}
+}
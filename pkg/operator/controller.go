@@ -0,0 +1,249 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/heptio/sonobuoy/pkg/client"
+	"github.com/heptio/sonobuoy/pkg/config"
+	"github.com/heptio/sonobuoy/pkg/errlog"
+)
+
+// resultsWait is how long after a run has finished its results are tried for,
+// since the aggregator only writes them once it has cleaned up the plugins.
+var resultsWait = 5 * time.Minute
+
+// Controller starts Sonobuoy for each new SonobuoyRun and keeps its status up
+// to date until it has finished.
+type Controller struct {
+	// SDK is what runs Sonobuoy.
+	SDK client.SDK
+	// Runs is where the SonobuoyRuns are found.
+	Runs RunStore
+	// Interval is how often every SonobuoyRun is reconciled.
+	Interval time.Duration
+
+	// now returns the current time, and can be replaced in tests.
+	now func() time.Time
+}
+
+// NewController returns a Controller running Sonobuoy with sdk for the
+// SonobuoyRuns in runs, reconciling them every interval.
+func NewController(sdk client.SDK, runs RunStore, interval time.Duration) *Controller {
+	return &Controller{SDK: sdk, Runs: runs, Interval: interval, now: time.Now}
+}
+
+// Run reconciles every SonobuoyRun each interval until stop is closed.
+func (c *Controller) Run(stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		if err := c.ReconcileAll(ctx); err != nil {
+			errlog.LogError(err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// ReconcileAll reconciles every SonobuoyRun once, saving those whose status
+// changed.
+func (c *Controller) ReconcileAll(ctx context.Context) error {
+	runs, err := c.Runs.List()
+	if err != nil {
+		return err
+	}
+	for i := range runs {
+		run := &runs[i]
+		if !c.reconcile(ctx, run) {
+			continue
+		}
+		if err := c.Runs.Update(run); err != nil {
+			errlog.LogError(err)
+		}
+	}
+	return nil
+}
+
+// reconcile moves a run along, returning whether its status changed.
+func (c *Controller) reconcile(ctx context.Context, run *SonobuoyRun) bool {
+	log := logrus.WithFields(logrus.Fields{"namespace": run.Namespace, "name": run.Name})
+	now := metav1.NewTime(c.now())
+	status := &run.Status
+
+	opts, err := runOptions(&run.Spec)
+	if err != nil {
+		if status.Phase != string(client.RunPhaseFailed) {
+			status.Phase = string(client.RunPhaseFailed)
+			status.setCondition(ConditionFailed, corev1.ConditionTrue, "InvalidSpec", err.Error(), now)
+			return true
+		}
+		return false
+	}
+
+	switch phase := client.RunPhase(status.Phase); {
+	case phase == "":
+		if err := c.SDK.Run(ctx, opts...); err != nil {
+			log.WithError(err).Warning("Couldn't start Sonobuoy")
+			status.Phase = string(client.RunPhaseFailed)
+			status.CompletionTime = &now
+			status.setCondition(ConditionStarted, corev1.ConditionFalse, "RunFailed", err.Error(), now)
+			status.setCondition(ConditionFailed, corev1.ConditionTrue, "RunFailed", err.Error(), now)
+			return true
+		}
+		log.Info("Started Sonobuoy")
+		status.Phase = string(client.RunPhasePending)
+		status.StartTime = &now
+		status.setCondition(ConditionStarted, corev1.ConditionTrue, "RunCreated", "Sonobuoy was started in namespace "+runNamespace(&run.Spec), now)
+		return true
+
+	case !phase.Finished():
+		current, err := c.SDK.Status(ctx, opts...)
+		if err != nil {
+			// Such as while the aggregator is starting.
+			log.WithError(err).Debug("Couldn't get the status of the run")
+			return false
+		}
+		next := client.RunPhaseOf(current)
+		if next == phase {
+			return false
+		}
+		status.Phase = string(next)
+		if !next.Finished() {
+			return true
+		}
+		log.WithField("status", current.Status).Info("Sonobuoy finished")
+		status.CompletionTime = &now
+		if next == client.RunPhaseComplete {
+			status.setCondition(ConditionComplete, corev1.ConditionTrue, "RunComplete", "Every plugin completed", now)
+		} else {
+			status.setCondition(ConditionFailed, corev1.ConditionTrue, "PluginFailed", "A plugin failed", now)
+		}
+		c.collect(ctx, run, now)
+		return true
+
+	default:
+		return c.collect(ctx, run, now)
+	}
+}
+
+// collect summarizes a finished run's results in its status, then cleans it
+// up if it asks for that, returning whether its status changed. Each is only
+// done once.
+func (c *Controller) collect(ctx context.Context, run *SonobuoyRun, now metav1.Time) bool {
+	status := &run.Status
+	opts, _ := runOptions(&run.Spec)
+	// Runs that couldn't be started have nothing to collect.
+	if status.StartTime == nil {
+		return false
+	}
+
+	changed := false
+	if status.Condition(ConditionResultsRetrieved) == nil {
+		counts, err := c.SDK.Results(ctx, opts...)
+		switch {
+		case err == nil:
+			status.Suites = make([]SuiteStatus, len(counts))
+			for i, suite := range counts {
+				status.Suites[i] = SuiteStatus{Name: suite.Name, Tests: suite.Tests, Failures: suite.Failures}
+			}
+			status.setCondition(ConditionResultsRetrieved, corev1.ConditionTrue, "ResultsRetrieved", suitesMessage(status.Suites), now)
+			changed = true
+		case status.CompletionTime == nil || now.Sub(status.CompletionTime.Time) > resultsWait:
+			status.setCondition(ConditionResultsRetrieved, corev1.ConditionFalse, "RetrieveFailed", err.Error(), now)
+			changed = true
+		default:
+			// The aggregator may not have written them yet.
+			return changed
+		}
+	}
+
+	if run.Spec.Cleanup && status.Condition(ConditionCleanedUp) == nil {
+		if _, err := c.SDK.Delete(ctx, opts...); err != nil {
+			errlog.LogError(errors.Wrapf(err, "couldn't clean up SonobuoyRun %v/%v", run.Namespace, run.Name))
+			return changed
+		}
+		status.setCondition(ConditionCleanedUp, corev1.ConditionTrue, "Deleted", "Deleted namespace "+runNamespace(&run.Spec), now)
+		changed = true
+	}
+	return changed
+}
+
+// suitesMessage summarizes the counts of each suite, e.g. "e2e: 2 of 150
+// tests failed".
+func suitesMessage(suites []SuiteStatus) string {
+	if len(suites) == 0 {
+		return "No test results"
+	}
+	messages := make([]string, len(suites))
+	for i, suite := range suites {
+		messages[i] = fmt.Sprintf("%v: %d of %d tests failed", suite.Name, suite.Failures, suite.Tests)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// runNamespace is the namespace Sonobuoy runs in for a spec.
+func runNamespace(spec *SonobuoyRunSpec) string {
+	if spec.Namespace != "" {
+		return spec.Namespace
+	}
+	return config.DefaultNamespace
+}
+
+// runOptions are the SDK options for a spec.
+func runOptions(spec *SonobuoyRunSpec) ([]client.Option, error) {
+	opts := []client.Option{client.WithNamespace(runNamespace(spec))}
+	if spec.Mode != "" {
+		var mode client.Mode
+		if err := mode.Set(spec.Mode); err != nil {
+			return nil, err
+		}
+		opts = append(opts, client.WithMode(mode))
+	}
+	if len(spec.Plugins) > 0 {
+		opts = append(opts, client.WithPlugins(spec.Plugins...))
+	}
+	if spec.E2EFocus != "" {
+		opts = append(opts, client.WithE2EFocus(spec.E2EFocus))
+	}
+	if spec.E2ESkip != "" {
+		opts = append(opts, client.WithE2ESkip(spec.E2ESkip))
+	}
+	if spec.Image != "" {
+		opts = append(opts, client.WithImage(spec.Image))
+	}
+	return opts, nil
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/heptio/sonobuoy/pkg/client"
+	"github.com/heptio/sonobuoy/pkg/client/results"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+)
+
+// fakeSDK records the calls made to it, returning canned answers.
+type fakeSDK struct {
+	runErr     error
+	status     string
+	resultsErr error
+	counts     []results.SuiteCounts
+
+	runs, deletes int
+}
+
+func (f *fakeSDK) Run(ctx context.Context, opts ...client.Option) error {
+	f.runs++
+	return f.runErr
+}
+
+func (f *fakeSDK) Status(ctx context.Context, opts ...client.Option) (*aggregation.Status, error) {
+	return &aggregation.Status{Status: f.status}, nil
+}
+
+func (f *fakeSDK) Retrieve(ctx context.Context, w io.Writer, opts ...client.Option) error {
+	return errors.New("not implemented")
+}
+
+func (f *fakeSDK) Results(ctx context.Context, opts ...client.Option) ([]results.SuiteCounts, error) {
+	return f.counts, f.resultsErr
+}
+
+func (f *fakeSDK) Delete(ctx context.Context, opts ...client.Option) ([]client.DeletedResource, error) {
+	f.deletes++
+	return nil, nil
+}
+
+// fakeStore keeps its runs in memory.
+type fakeStore struct {
+	runs    []SonobuoyRun
+	updates int
+}
+
+func (f *fakeStore) List() ([]SonobuoyRun, error) {
+	return append([]SonobuoyRun(nil), f.runs...), nil
+}
+
+func (f *fakeStore) Update(run *SonobuoyRun) error {
+	f.updates++
+	for i := range f.runs {
+		if f.runs[i].Name == run.Name {
+			f.runs[i] = *run
+		}
+	}
+	return nil
+}
+
+func newTestController(sdk *fakeSDK, spec SonobuoyRunSpec) (*Controller, *fakeStore) {
+	store := &fakeStore{runs: []SonobuoyRun{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "conformance"},
+		Spec:       spec,
+	}}}
+	c := NewController(sdk, store, time.Minute)
+	c.now = func() time.Time { return time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC) }
+	return c, store
+}
+
+func expectCondition(t *testing.T, status *SonobuoyRunStatus, conditionType ConditionType, expected corev1.ConditionStatus) {
+	t.Helper()
+	condition := status.Condition(conditionType)
+	if condition == nil {
+		t.Fatalf("expected condition %v, got none", conditionType)
+	}
+	if condition.Status != expected {
+		t.Errorf("expected condition %v to be %v, got %v", conditionType, expected, condition.Status)
+	}
+}
+
+func TestReconcileLifecycle(t *testing.T) {
+	sdk := &fakeSDK{
+		status: string(client.RunPhaseRunning),
+		counts: []results.SuiteCounts{{Name: "e2e", Tests: 150, Failures: 2}},
+	}
+	c, store := newTestController(sdk, SonobuoyRunSpec{Mode: "quick", Cleanup: true})
+	ctx := context.Background()
+
+	reconcile := func(expectedPhase client.RunPhase) *SonobuoyRunStatus {
+		t.Helper()
+		if err := c.ReconcileAll(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		status := &store.runs[0].Status
+		if status.Phase != string(expectedPhase) {
+			t.Fatalf("expected phase %v, got %v", expectedPhase, status.Phase)
+		}
+		return status
+	}
+
+	status := reconcile(client.RunPhasePending)
+	expectCondition(t, status, ConditionStarted, corev1.ConditionTrue)
+	if status.StartTime == nil {
+		t.Error("expected a start time")
+	}
+
+	reconcile(client.RunPhaseRunning)
+	updates := store.updates
+	reconcile(client.RunPhaseRunning)
+	if store.updates != updates {
+		t.Error("expected an unchanged run not to be updated")
+	}
+
+	sdk.status = string(client.RunPhaseComplete)
+	status = reconcile(client.RunPhaseComplete)
+	expectCondition(t, status, ConditionComplete, corev1.ConditionTrue)
+	expectCondition(t, status, ConditionResultsRetrieved, corev1.ConditionTrue)
+	expectCondition(t, status, ConditionCleanedUp, corev1.ConditionTrue)
+	if len(status.Suites) != 1 || status.Suites[0].Failures != 2 {
+		t.Errorf("expected the e2e suite with 2 failures, got %+v", status.Suites)
+	}
+	if msg := status.Condition(ConditionResultsRetrieved).Message; msg != "e2e: 2 of 150 tests failed" {
+		t.Errorf("unexpected results message %q", msg)
+	}
+
+	reconcile(client.RunPhaseComplete)
+	if sdk.runs != 1 || sdk.deletes != 1 {
+		t.Errorf("expected one run and one delete, got %d and %d", sdk.runs, sdk.deletes)
+	}
+}
+
+func TestReconcileResultsPending(t *testing.T) {
+	sdk := &fakeSDK{status: string(client.RunPhaseFailed), resultsErr: errors.New("no results yet")}
+	c, store := newTestController(sdk, SonobuoyRunSpec{})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := c.ReconcileAll(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	status := &store.runs[0].Status
+	expectCondition(t, status, ConditionFailed, corev1.ConditionTrue)
+	if status.Condition(ConditionResultsRetrieved) != nil {
+		t.Fatal("expected results to still be waited for")
+	}
+
+	c.now = func() time.Time { return status.CompletionTime.Add(resultsWait + time.Second) }
+	if err := c.ReconcileAll(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectCondition(t, &store.runs[0].Status, ConditionResultsRetrieved, corev1.ConditionFalse)
+	if sdk.deletes != 0 {
+		t.Error("expected a run without cleanup not to be deleted")
+	}
+}
+
+func TestReconcileFailures(t *testing.T) {
+	testCases := []struct {
+		desc string
+		sdk  *fakeSDK
+		spec SonobuoyRunSpec
+		runs int
+	}{
+		{
+			desc: "invalid mode",
+			sdk:  &fakeSDK{},
+			spec: SonobuoyRunSpec{Mode: "bogus"},
+		},
+		{
+			desc: "run fails to start",
+			sdk:  &fakeSDK{runErr: errors.New("namespace already exists")},
+			runs: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			c, store := newTestController(tc.sdk, tc.spec)
+			for i := 0; i < 2; i++ {
+				if err := c.ReconcileAll(context.Background()); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			status := &store.runs[0].Status
+			if status.Phase != string(client.RunPhaseFailed) {
+				t.Errorf("expected phase failed, got %v", status.Phase)
+			}
+			expectCondition(t, status, ConditionFailed, corev1.ConditionTrue)
+			if tc.sdk.runs != tc.runs {
+				t.Errorf("expected %d runs, got %d", tc.runs, tc.sdk.runs)
+			}
+			if store.updates != 1 {
+				t.Errorf("expected 1 update, got %d", store.updates)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptio/sonobuoy/pkg/templates"
+)
+
+// DefaultNamespace is the namespace the operator is deployed in by default.
+const DefaultNamespace = "sonobuoy-operator"
+
+// ManifestConfig are the input options for generating the operator's
+// manifest.
+type ManifestConfig struct {
+	// Namespace is the namespace the operator is deployed in.
+	Namespace string
+	// Image is the Sonobuoy image the operator runs, and ImagePullPolicy
+	// when it's pulled.
+	Image           string
+	ImagePullPolicy string
+	// Interval is how often the operator reconciles every SonobuoyRun.
+	Interval time.Duration
+}
+
+// GenerateManifest returns the manifest of the SonobuoyRun custom resource
+// definition and the operator.
+func GenerateManifest(cfg *ManifestConfig) ([]byte, error) {
+	data := struct {
+		*ManifestConfig
+		Group, Version, Kind, Plural, Singular string
+	}{
+		ManifestConfig: cfg,
+		Group:          Group,
+		Version:        Version,
+		Kind:           Kind,
+		Plural:         Plural,
+		Singular:       "sonobuoyrun",
+	}
+
+	var b bytes.Buffer
+	if err := templates.Operator.Execute(&b, data); err != nil {
+		return nil, errors.Wrap(err, "couldn't fill operator template")
+	}
+	return b.Bytes(), nil
+}
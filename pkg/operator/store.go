@@ -0,0 +1,74 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operator
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// RunStore is where the controller finds SonobuoyRuns and records their
+// status.
+type RunStore interface {
+	// List returns the SonobuoyRuns in every namespace.
+	List() ([]SonobuoyRun, error)
+	// Update saves a SonobuoyRun, including its status.
+	Update(run *SonobuoyRun) error
+}
+
+// apiRunStore keeps SonobuoyRuns in the API server. They're requested
+// directly, since they're served under their own API group rather than the
+// core one the client is set up for.
+type apiRunStore struct {
+	client kubernetes.Interface
+}
+
+// NewRunStore returns a RunStore for the SonobuoyRuns of a cluster.
+func NewRunStore(client kubernetes.Interface) RunStore {
+	return &apiRunStore{client: client}
+}
+
+const apiPath = "/apis/" + Group + "/" + Version
+
+func (s *apiRunStore) List() ([]SonobuoyRun, error) {
+	body, err := s.client.CoreV1().RESTClient().Get().AbsPath(apiPath, Plural).DoRaw()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't list SonobuoyRuns")
+	}
+	list := &SonobuoyRunList{}
+	if err := json.Unmarshal(body, list); err != nil {
+		return nil, errors.Wrap(err, "couldn't decode SonobuoyRuns")
+	}
+	return list.Items, nil
+}
+
+func (s *apiRunStore) Update(run *SonobuoyRun) error {
+	run.APIVersion = Group + "/" + Version
+	run.Kind = Kind
+	body, err := json.Marshal(run)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't encode SonobuoyRun %v/%v", run.Namespace, run.Name)
+	}
+	_, err = s.client.CoreV1().RESTClient().Put().
+		AbsPath(apiPath, "namespaces", run.Namespace, Plural, run.Name).
+		SetHeader("Content-Type", "application/json").
+		Body(body).
+		DoRaw()
+	return errors.Wrapf(err, "couldn't update SonobuoyRun %v/%v", run.Namespace, run.Name)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package operator runs Sonobuoy for SonobuoyRun custom resources, so runs can
+// be declared alongside the rest of a cluster's configuration and their
+// outcome read from the resources' status.
+package operator
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The API group, version and names of the SonobuoyRun custom resource.
+const (
+	Group   = "sonobuoy.heptio.com"
+	Version = "v1alpha1"
+	Kind    = "SonobuoyRun"
+	Plural  = "sonobuoyruns"
+)
+
+// SonobuoyRun declares a Sonobuoy run. The operator starts it once, and
+// reports its progress and outcome in its status.
+type SonobuoyRun struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SonobuoyRunSpec   `json:"spec"`
+	Status SonobuoyRunStatus `json:"status,omitempty"`
+}
+
+// SonobuoyRunList is a list of SonobuoyRuns.
+type SonobuoyRunList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []SonobuoyRun `json:"items"`
+}
+
+// SonobuoyRunSpec is what to run. Empty fields default to what the CLI does
+// without flags.
+type SonobuoyRunSpec struct {
+	// Namespace is the namespace Sonobuoy runs in, which is
+	// heptio-sonobuoy by default. Only one run can use a namespace at once.
+	Namespace string `json:"namespace,omitempty"`
+	// Mode selects the plugins and E2E tests of a mode, such as Quick.
+	Mode string `json:"mode,omitempty"`
+	// Plugins are the plugins to run, by name, in place of the mode's.
+	Plugins []string `json:"plugins,omitempty"`
+	// E2EFocus and E2ESkip are the regular expressions of the E2E tests to
+	// run and skip, in place of the mode's.
+	E2EFocus string `json:"e2eFocus,omitempty"`
+	E2ESkip  string `json:"e2eSkip,omitempty"`
+	// Image is the Sonobuoy image.
+	Image string `json:"image,omitempty"`
+	// Cleanup deletes what Sonobuoy created once the run has finished and
+	// its results have been summarized in the status.
+	Cleanup bool `json:"cleanup,omitempty"`
+}
+
+// SonobuoyRunStatus is how far a run has got.
+type SonobuoyRunStatus struct {
+	// Phase is the phase of the run: pending, running, complete or failed.
+	// It's empty until the run is started.
+	Phase string `json:"phase,omitempty"`
+	// Conditions are the milestones the run has reached.
+	Conditions []Condition `json:"conditions,omitempty"`
+	// StartTime is when the run was started, and CompletionTime when it
+	// was seen to have finished.
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Suites are the tests run and failed by each suite in the results.
+	Suites []SuiteStatus `json:"suites,omitempty"`
+}
+
+// SuiteStatus counts the tests a suite ran and how many failed.
+type SuiteStatus struct {
+	Name     string `json:"name"`
+	Tests    int    `json:"tests"`
+	Failures int    `json:"failures"`
+}
+
+// ConditionType is a milestone of a run.
+type ConditionType string
+
+const (
+	// ConditionStarted is true once Sonobuoy has been started for the run.
+	ConditionStarted ConditionType = "Started"
+	// ConditionComplete is true once the run has finished with every plugin
+	// complete.
+	ConditionComplete ConditionType = "Complete"
+	// ConditionFailed is true if the run couldn't be started, or finished
+	// with a plugin failed.
+	ConditionFailed ConditionType = "Failed"
+	// ConditionResultsRetrieved is true once the results have been
+	// summarized in the status, or false if they couldn't be.
+	ConditionResultsRetrieved ConditionType = "ResultsRetrieved"
+	// ConditionCleanedUp is true once what Sonobuoy created for the run has
+	// been deleted, for runs that ask for it.
+	ConditionCleanedUp ConditionType = "CleanedUp"
+)
+
+// Condition is the state of one of a run's milestones.
+type Condition struct {
+	Type               ConditionType          `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime"`
+}
+
+// Condition returns the run's condition of the given type, or nil if it
+// hasn't got one.
+func (s *SonobuoyRunStatus) Condition(conditionType ConditionType) *Condition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// setCondition sets the run's condition of the given type, only changing its
+// transition time if its status changes.
+func (s *SonobuoyRunStatus) setCondition(conditionType ConditionType, status corev1.ConditionStatus, reason, message string, now metav1.Time) {
+	condition := s.Condition(conditionType)
+	if condition == nil {
+		s.Conditions = append(s.Conditions, Condition{Type: conditionType})
+		condition = &s.Conditions[len(s.Conditions)-1]
+	}
+	if condition.Status != status {
+		condition.LastTransitionTime = now
+	}
+	condition.Status = status
+	condition.Reason = reason
+	condition.Message = message
+}
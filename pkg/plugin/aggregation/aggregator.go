@@ -21,15 +21,21 @@ limitations under the License.
 package aggregation
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
 	"sync"
+	"time"
 
+	"github.com/heptio/sonobuoy/pkg/buildinfo"
+	"github.com/heptio/sonobuoy/pkg/errlog"
 	"github.com/heptio/sonobuoy/pkg/plugin"
 	"github.com/heptio/sonobuoy/pkg/tarball"
+	"github.com/heptio/sonobuoy/pkg/tracing"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -49,23 +55,116 @@ type Aggregator struct {
 	Results map[string]*plugin.Result
 	// ExpectedResults stores a map of results the server should expect
 	ExpectedResults map[string]*plugin.ExpectedResult
+	// Progress stores the latest progress update received for each result
+	Progress map[string]*ProgressUpdate
+	// ChecksumMismatches counts the uploads of each result that were
+	// rejected because they were corrupted on the way.
+	ChecksumMismatches map[plugin.ExpectedResult]int
+	// Duplicates counts the uploads of each result received after it
+	// already had been, such as by a pod that was retried.
+	Duplicates map[plugin.ExpectedResult]int
+	// Heartbeats stores when a heartbeat was last received for each result
+	Heartbeats map[plugin.ExpectedResult]time.Time
+	// ReportTimes stores when each result was received
+	ReportTimes map[plugin.ExpectedResult]time.Time
+	// LastErrors stores the last error reported for each result, whether
+	// it failed the result or just a single upload of it.
+	LastErrors map[plugin.ExpectedResult]string
+	// FlushRequested is set once the run is about to time out, to ask
+	// workers for whatever results their plugins have so far.
+	FlushRequested bool
+	// MaxPluginBytes limits how many bytes of results each plugin can
+	// upload, and MaxTotalBytes how many all plugins can upload together, so
+	// a misbehaving plugin can't fill up the disk. Zero means no limit.
+	MaxPluginBytes int64
+	MaxTotalBytes  int64
+	// MinFreeBytes is how much space must be left in the volume results are
+	// stored in to accept a result. Workers are told to send results again
+	// later while there's less. Zero means results are accepted until the
+	// volume is full.
+	MinFreeBytes int64
+	// Trace, if set, is the span results are handled in, unless they were
+	// submitted in a span of their own.
+	Trace *tracing.Span
+	// Processors are run on each result once it has been stored, by result
+	// type.
+	Processors map[string][]ResultProcessor
+	// Formats are what results must be valid in, by result type. Results
+	// of plugins that don't declare a format aren't checked.
+	Formats map[string]ResultFormat
+	// Version is the version of Sonobuoy the aggregator was built from.
+	// Results from workers of any other version fail, unless
+	// AllowMixedVersions is set.
+	Version            string
+	AllowMixedVersions bool
+
+	// pluginBytes and totalBytes count the bytes of results stored or being
+	// uploaded, resultBytes those of each result by its ID, and stagedBytes
+	// those of each duplicate written to staging until it replaces the
+	// result. They're guarded by bytesMutex, so they can be counted as
+	// results are read.
+	pluginBytes map[string]int64
+	totalBytes  int64
+	resultBytes map[string]int64
+	stagedBytes map[string]int64
+
+	// checksums are the checksums of the single-file results stored so far,
+	// and staging the directories duplicates of results are written to until
+	// they're complete. They're guarded by resultsMutex.
+	checksums map[string]string
+	staging   map[string]string
+
+	// resultLocks keep uploads of the same result from being handled at the
+	// same time, by result ID. It's guarded by resultsMutex.
+	resultLocks map[string]*sync.Mutex
+
+	// disk is how much space was left in the results volume when it was
+	// last checked. It's guarded by statusMutex.
+	disk *DiskUsage
+
+	// metrics counts what has happened so far, for MetricsHandler.
+	metrics *runMetrics
+	// events are what has happened so far, for EventsHandler.
+	events *eventBroker
 
 	// resultEvents is a channel that is written to when results are seen
 	// by the server, so we can block until we're done.
 	resultEvents chan *plugin.Result
-	// resultsMutex prevents race conditions if two identical results
-	// come in at the same time.
+	// resultsMutex guards Results and what's stored of them. It isn't held
+	// while a result is read from its worker, which can take as long as the
+	// plugin runs, so one upload doesn't hold up the others.
 	resultsMutex sync.Mutex
+	// bytesMutex guards the counts of the bytes of results.
+	bytesMutex sync.Mutex
+	// statusMutex guards Progress, ChecksumMismatches, Duplicates,
+	// Heartbeats, ReportTimes, LastErrors, FlushRequested and disk, which
+	// are updated without a result being stored.
+	statusMutex sync.Mutex
 }
 
 // NewAggregator constructs a new Aggregator object to write the given result
 // set out to the given output directory.
 func NewAggregator(outputDir string, expected []plugin.ExpectedResult) *Aggregator {
 	aggr := &Aggregator{
-		OutputDir:       outputDir,
-		Results:         make(map[string]*plugin.Result, len(expected)),
-		ExpectedResults: make(map[string]*plugin.ExpectedResult, len(expected)),
-		resultEvents:    make(chan *plugin.Result, len(expected)),
+		OutputDir:          outputDir,
+		Results:            make(map[string]*plugin.Result, len(expected)),
+		ExpectedResults:    make(map[string]*plugin.ExpectedResult, len(expected)),
+		Progress:           make(map[string]*ProgressUpdate, len(expected)),
+		ChecksumMismatches: make(map[plugin.ExpectedResult]int),
+		Duplicates:         make(map[plugin.ExpectedResult]int),
+		Heartbeats:         make(map[plugin.ExpectedResult]time.Time, len(expected)),
+		ReportTimes:        make(map[plugin.ExpectedResult]time.Time, len(expected)),
+		LastErrors:         make(map[plugin.ExpectedResult]string),
+		pluginBytes:        make(map[string]int64),
+		resultBytes:        make(map[string]int64),
+		stagedBytes:        make(map[string]int64),
+		checksums:          make(map[string]string),
+		staging:            make(map[string]string),
+		resultLocks:        make(map[string]*sync.Mutex),
+		metrics:            newRunMetrics(),
+		events:             newEventBroker(),
+		resultEvents:       make(chan *plugin.Result, len(expected)),
+		Version:            buildinfo.Version,
 	}
 
 	for i, expResult := range expected {
@@ -100,6 +199,20 @@ func (a *Aggregator) isComplete() bool {
 	return true
 }
 
+// missingResults returns which of the given results haven't checked in yet.
+func (a *Aggregator) missingResults(expected []plugin.ExpectedResult) []plugin.ExpectedResult {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	var missing []plugin.ExpectedResult
+	for _, result := range expected {
+		if _, ok := a.Results[result.ID()]; !ok {
+			missing = append(missing, result)
+		}
+	}
+	return missing
+}
+
 func (a *Aggregator) isResultExpected(result *plugin.Result) bool {
 	_, ok := a.ExpectedResults[result.ExpectedResultID()]
 	return ok
@@ -112,17 +225,19 @@ func (a *Aggregator) isResultDuplicate(result *plugin.Result) bool {
 
 // HandleHTTPResult is called every time the HTTP server gets a well-formed
 // request with results. This method is responsible for returning with things
-// like a 409 conflict if a node has checked in twice (or a 403 forbidden if a
-// node isn't expected), as well as actually calling handleResult to write the
-// results to OutputDir.
+// like a 403 forbidden if a node isn't expected, as well as actually calling
+// handleResult to write the results to OutputDir. A result that has already
+// been received replaces the earlier one, as handleDuplicate describes.
 func (a *Aggregator) HandleHTTPResult(result *plugin.Result, w http.ResponseWriter) {
-	a.resultsMutex.Lock()
-	defer a.resultsMutex.Unlock()
+	span := a.startResultSpan(result)
+	var spanErr error
+	defer func() { span.End(spanErr) }()
 
 	resultID := result.ExpectedResultID()
 
 	// Make sure we were expecting this result
 	if !a.isResultExpected(result) {
+		spanErr = errors.Errorf("result %v unexpected", resultID)
 		http.Error(
 			w,
 			fmt.Sprintf("Result %v unexpected", resultID),
@@ -131,27 +246,208 @@ func (a *Aggregator) HandleHTTPResult(result *plugin.Result, w http.ResponseWrit
 		return
 	}
 
-	// Don't allow duplicates
-	if a.isResultDuplicate(result) {
-		logrus.Warningf("Got a duplicate result %v", resultID)
+	unlock := a.lockResult(resultID)
+	defer unlock()
+
+	// A worker of another version may not submit its results the way this
+	// aggregator expects, so its result fails rather than being stored.
+	if mismatch := a.checkWorkerVersion(result); mismatch != nil {
+		logrus.Warning(mismatch)
+		spanErr = mismatch
+		a.resultsMutex.Lock()
+		err := a.refuseResult(result, mismatch)
+		a.resultsMutex.Unlock()
+		if err != nil {
+			errlog.LogError(errors.Wrapf(err, "couldn't record refused result %v", resultID))
+		}
+		writeVersionMismatch(w, mismatch)
+		return
+	}
+
+	// Turn the result away before any of it is written, rather than fill up
+	// the volume partway through it.
+	if err := a.checkDiskSpace(result); err != nil {
+		logrus.Info(err)
+		spanErr = err
+		a.recordError(result, err.Error())
+		writeInsufficientStorage(w, err.(*InsufficientStorageError))
+		return
+	}
+
+	if err := a.receiveResult(result); err != nil {
+		errMsg := fmt.Sprintf("Error handling result %v: %v", resultID, err)
+		logrus.Info(errMsg)
+		spanErr = err
+		a.recordError(result, err.Error())
+
+		if tooLarge, ok := errors.Cause(err).(*ResultTooLargeError); ok {
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			json.NewEncoder(w).Encode(tooLarge)
+			return
+		}
+
+		if insufficient, ok := errors.Cause(err).(*InsufficientStorageError); ok {
+			writeInsufficientStorage(w, insufficient)
+			return
+		}
+
+		if invalid, ok := errors.Cause(err).(*InvalidResultError); ok {
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(invalid)
+			return
+		}
+
+		code := http.StatusInternalServerError
+		if _, ok := errors.Cause(err).(*ChecksumMismatchError); ok {
+			a.recordChecksumMismatch(result)
+			// Tell the worker to send it again.
+			code = http.StatusUnprocessableEntity
+		}
+		http.Error(w, errMsg, code)
+		return
+	}
+}
+
+func (a *Aggregator) recordError(result *plugin.Result, err string) {
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+	a.LastErrors[plugin.ExpectedResult{NodeName: result.NodeName, ResultType: result.ResultType}] = err
+}
+
+// LatestErrors returns the last error reported for each result that has had
+// one.
+func (a *Aggregator) LatestErrors() map[plugin.ExpectedResult]string {
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+
+	errs := make(map[plugin.ExpectedResult]string, len(a.LastErrors))
+	for result, err := range a.LastErrors {
+		errs[result] = err
+	}
+	return errs
+}
+
+// LatestReportTimes returns when each result that has been received was.
+func (a *Aggregator) LatestReportTimes() map[plugin.ExpectedResult]time.Time {
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+
+	times := make(map[plugin.ExpectedResult]time.Time, len(a.ReportTimes))
+	for result, t := range a.ReportTimes {
+		times[result] = t
+	}
+	return times
+}
+
+func (a *Aggregator) recordChecksumMismatch(result *plugin.Result) {
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+	a.ChecksumMismatches[plugin.ExpectedResult{NodeName: result.NodeName, ResultType: result.ResultType}]++
+}
+
+func (a *Aggregator) recordDuplicate(result *plugin.Result) {
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+	a.Duplicates[plugin.ExpectedResult{NodeName: result.NodeName, ResultType: result.ResultType}]++
+}
+
+// DuplicateCounts returns how many uploads of each result have been received
+// after it already had been.
+func (a *Aggregator) DuplicateCounts() map[plugin.ExpectedResult]int {
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+
+	counts := make(map[plugin.ExpectedResult]int, len(a.Duplicates))
+	for result, count := range a.Duplicates {
+		counts[result] = count
+	}
+	return counts
+}
+
+// ChecksumMismatchCounts returns how many uploads of each result have been
+// rejected for not matching their checksum.
+func (a *Aggregator) ChecksumMismatchCounts() map[plugin.ExpectedResult]int {
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+
+	counts := make(map[plugin.ExpectedResult]int, len(a.ChecksumMismatches))
+	for result, count := range a.ChecksumMismatches {
+		counts[result] = count
+	}
+	return counts
+}
+
+// HandleHTTPProgress is called every time the HTTP server gets a well-formed
+// progress update, recording it as the latest progress for its result.
+func (a *Aggregator) HandleHTTPProgress(update *ProgressUpdate, w http.ResponseWriter) {
+	if _, ok := a.ExpectedResults[update.ID()]; !ok {
 		http.Error(
 			w,
-			fmt.Sprintf("Result %v already received", resultID),
-			http.StatusConflict,
+			fmt.Sprintf("Result %v unexpected", update.ID()),
+			http.StatusForbidden,
 		)
 		return
 	}
 
-	if err := a.handleResult(result); err != nil {
-		errMsg := fmt.Sprintf("Error handling result %v: %v", resultID, err)
-		logrus.Info(errMsg)
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+	a.Progress[update.ID()] = update
+}
+
+// LatestProgress returns the latest progress update for every result that
+// has reported any.
+func (a *Aggregator) LatestProgress() []ProgressUpdate {
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+
+	updates := make([]ProgressUpdate, 0, len(a.Progress))
+	for _, update := range a.Progress {
+		updates = append(updates, *update)
+	}
+	return updates
+}
+
+// HandleHTTPHeartbeat is called every time the HTTP server gets a heartbeat
+// from a worker, recording when the worker was last heard from.
+func (a *Aggregator) HandleHTTPHeartbeat(result plugin.ExpectedResult, w http.ResponseWriter) {
+	if _, ok := a.ExpectedResults[result.ID()]; !ok {
 		http.Error(
 			w,
-			errMsg,
-			http.StatusInternalServerError,
+			fmt.Sprintf("Result %v unexpected", result.ID()),
+			http.StatusForbidden,
 		)
 		return
 	}
+
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+	a.Heartbeats[result] = time.Now()
+	if a.FlushRequested {
+		w.Header().Set(FlushResultsHeader, "true")
+	}
+}
+
+// RequestFlush asks workers, in their responses to heartbeats, to send
+// whatever results their plugins have so far, because the run is about to
+// time out.
+func (a *Aggregator) RequestFlush() {
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+	a.FlushRequested = true
+}
+
+// LatestHeartbeats returns when each result last had a heartbeat.
+func (a *Aggregator) LatestHeartbeats() map[plugin.ExpectedResult]time.Time {
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+
+	heartbeats := make(map[plugin.ExpectedResult]time.Time, len(a.Heartbeats))
+	for result, t := range a.Heartbeats {
+		heartbeats[result] = t
+	}
+	return heartbeats
 }
 
 // IngestResults takes a channel of results and handles them as they come in.
@@ -189,24 +485,400 @@ func (a *Aggregator) IngestResults(resultsCh <-chan *plugin.Result) {
 	}
 }
 
+// lockResult keeps other uploads of the result with the given ID from being
+// handled until the returned function is called, without holding up those of
+// other results.
+func (a *Aggregator) lockResult(resultID string) func() {
+	a.resultsMutex.Lock()
+	lock, ok := a.resultLocks[resultID]
+	if !ok {
+		lock = &sync.Mutex{}
+		a.resultLocks[resultID] = lock
+	}
+	a.resultsMutex.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// receiveResult handles a result read from its worker, which must have been
+// locked with lockResult. The body can take as long to arrive as the plugin
+// takes to run, for a result that's streamed, so it's written to a staging
+// directory without resultsMutex held, and only put in place once it's
+// complete and verified.
+func (a *Aggregator) receiveResult(result *plugin.Result) error {
+	resultID := result.ExpectedResultID()
+
+	a.resultsMutex.Lock()
+	duplicate := a.isResultDuplicate(result)
+	staging, err := a.stagingDir(result, duplicate)
+	a.resultsMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	if duplicate {
+		logrus.Warningf("Got a duplicate result %v", resultID)
+	}
+
+	n, err := a.writeResultIn(staging, result, duplicate)
+
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	if !duplicate && a.isResultDuplicate(result) {
+		// It was recorded while it was being uploaded, such as by timing
+		// out, so the upload takes its place.
+		duplicate = true
+		a.staging[resultID] = staging
+		a.restageBytes(result, n)
+	}
+	if duplicate {
+		return a.replaceResult(staging, n, err, result)
+	}
+
+	defer os.RemoveAll(staging)
+	if err == nil {
+		if err = a.moveResult(staging, result); err != nil {
+			a.countBytes(result, false, -n)
+		}
+	}
+	if result.Partial {
+		// More files are coming for this result, so don't record it yet,
+		// unless the rest of it can't fit either.
+		if _, ok := errors.Cause(err).(*ResultTooLargeError); ok {
+			a.recordResult(result)
+		}
+		return err
+	}
+	return a.recordWritten(result, err)
+}
+
+// stagingDir returns the directory a result is written to until it's
+// complete: the one all the files of a duplicate are written to until it
+// replaces the result, or a new one otherwise. It must be called with
+// resultsMutex held.
+func (a *Aggregator) stagingDir(result *plugin.Result, duplicate bool) (string, error) {
+	resultID := result.ExpectedResultID()
+	if staging, ok := a.staging[resultID]; ok && duplicate {
+		return staging, nil
+	}
+
+	prefix := ".upload-"
+	if duplicate {
+		prefix = ".duplicate-"
+	}
+	if err := os.MkdirAll(a.OutputDir, 0755); err != nil {
+		return "", errors.Wrapf(err, "couldn't create directory %v", a.OutputDir)
+	}
+	staging, err := ioutil.TempDir(a.OutputDir, prefix)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't create a directory for result %v", resultID)
+	}
+	if duplicate {
+		a.staging[resultID] = staging
+	}
+	return staging, nil
+}
+
+// moveResult moves a result, or the file of it, from where it was written
+// within staging to its place in OutputDir, replacing a file of the same
+// name that was sent before.
+func (a *Aggregator) moveResult(staging string, result *plugin.Result) error {
+	file := path.Join(result.Path(), result.Filename)
+	resultPath := path.Join(a.OutputDir, file)
+	if err := os.MkdirAll(path.Dir(resultPath), 0755); err != nil {
+		return errors.Wrapf(err, "couldn't create directory %v", path.Dir(resultPath))
+	}
+	if err := os.RemoveAll(resultPath); err != nil {
+		return errors.Wrapf(err, "couldn't remove the earlier %v", file)
+	}
+	return errors.Wrapf(os.Rename(path.Join(staging, file), resultPath), "couldn't store result %v", result.ExpectedResultID())
+}
+
 // handleResult takes a given plugin Result and writes it out to the
-// filesystem, signaling to the resultEvents channel when complete.
+// filesystem, signaling to the resultEvents channel when complete. It's for
+// results that are already in memory, and must be called with resultsMutex
+// held.
 func (a *Aggregator) handleResult(result *plugin.Result) error {
+	return a.recordWritten(result, a.writeResult(result))
+}
+
+// recordWritten records a result once it has been written, which failed with
+// err if that isn't nil, and validates and processes it if it's fit to be.
+func (a *Aggregator) recordWritten(result *plugin.Result, err error) error {
+	switch errors.Cause(err).(type) {
+	case *ChecksumMismatchError, *InsufficientStorageError:
+		// Don't record a corrupted result, or one there wasn't room for,
+		// so the worker can send it again.
+		return err
+	}
+
+	if err == nil {
+		a.recordChecksum(result)
+	}
+	if err == nil && result.Error == "" && !result.Incomplete {
+		// Whatever a plugin had when the run timed out isn't expected to
+		// be valid yet.
+		err = a.validateResult(result)
+	}
+	if err == nil && result.Error == "" {
+		a.processResult(result)
+	}
+
 	// Send an event that we got this result even if we get an error, so
 	// that Wait() doesn't hang forever on problems.
+	a.recordResult(result)
+	return err
+}
+
+// handleDuplicate handles an upload of a result that has already been
+// received, such as by a pod that was retried, when it's already in memory.
+// It must be called with resultsMutex held.
+func (a *Aggregator) handleDuplicate(result *plugin.Result) error {
+	staging, err := a.stagingDir(result, true)
+	if err != nil {
+		return err
+	}
+	n, err := a.writeResultIn(staging, result, true)
+	return a.replaceResult(staging, n, err, result)
+}
+
+// replaceResult finishes handling a duplicate, n bytes of which were written
+// to staging, failing with err if that isn't nil. It's kept aside until it's
+// complete, so an upload that fails doesn't lose the earlier result, then
+// replaces the earlier result, unless both are the same, so the latest is
+// kept. Either way the duplicate is counted in the result's status. It must be
+// called with resultsMutex held.
+func (a *Aggregator) replaceResult(staging string, n int64, err error, result *plugin.Result) error {
+	resultID := result.ExpectedResultID()
+	switch errors.Cause(err).(type) {
+	case *ChecksumMismatchError, *InsufficientStorageError:
+		// The worker sends the file again.
+		return err
+	}
+	if err != nil || !result.Partial {
+		delete(a.staging, resultID)
+		defer os.RemoveAll(staging)
+	}
+	if err != nil {
+		a.discardStagedBytes(resultID)
+		return err
+	}
+	if result.Partial {
+		return nil
+	}
+
+	a.recordDuplicate(result)
+	checksum := resultChecksum(result)
+	if checksum != "" && checksum == a.checksums[resultID] {
+		logrus.WithField("result", resultID).Info("Duplicate result is the same as the one received, keeping it")
+		a.discardStagedBytes(resultID)
+		return nil
+	}
+
+	// Nothing of the earlier result is kept, including whatever was
+	// processed from it.
+	earlier := a.Results[resultID]
+	expected := plugin.ExpectedResult{NodeName: result.NodeName, ResultType: result.ResultType}
+	for _, file := range []string{earlier.Path(), ProcessedPath(expected), FailuresPath(expected)} {
+		if err := os.RemoveAll(path.Join(a.OutputDir, file)); err != nil {
+			return errors.Wrapf(err, "couldn't remove the earlier result %v", resultID)
+		}
+	}
+	resultPath := path.Join(a.OutputDir, result.Path())
+	if err := os.MkdirAll(path.Dir(resultPath), 0755); err != nil {
+		return errors.Wrapf(err, "couldn't create directory %v", path.Dir(resultPath))
+	}
+	if err := os.Rename(path.Join(staging, result.Path()), resultPath); err != nil {
+		return errors.Wrapf(err, "couldn't replace result %v", resultID)
+	}
+	logrus.WithField("result", resultID).Info("Replaced result with its duplicate")
+	a.replaceBytes(result)
+
+	a.recordChecksum(result)
+	if result.Error == "" && !result.Incomplete {
+		err = a.validateResult(result)
+	}
+	if err == nil && result.Error == "" {
+		a.processResult(result)
+	}
+	// The result was already counted as received, so Wait isn't told again.
+	a.Results[resultID] = result
+	a.recordReport(result)
+	return err
+}
+
+// discardDuplicates removes duplicates of results whose uploads never
+// finished, so they aren't left in the output directory.
+func (a *Aggregator) discardDuplicates() {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	for resultID, staging := range a.staging {
+		if err := os.RemoveAll(staging); err != nil {
+			errlog.LogError(errors.Wrapf(err, "couldn't remove duplicate result %v", resultID))
+		}
+		delete(a.staging, resultID)
+		a.discardStagedBytes(resultID)
+	}
+}
+
+// recordChecksum records the checksum of a stored result, to tell whether a
+// duplicate of it is the same.
+func (a *Aggregator) recordChecksum(result *plugin.Result) {
+	if checksum := resultChecksum(result); checksum != "" {
+		a.checksums[result.ExpectedResultID()] = checksum
+	} else {
+		delete(a.checksums, result.ExpectedResultID())
+	}
+}
+
+// resultChecksum returns the checksum of a result that's a single file, once
+// it has been written, or an empty string if it's made up of several files or
+// there's none.
+func resultChecksum(result *plugin.Result) string {
+	if result.Filename != "" || result.Checksum == nil {
+		return ""
+	}
+	return result.Checksum()
+}
+
+// recordResult records a result as received, signaling to the resultEvents
+// channel.
+func (a *Aggregator) recordResult(result *plugin.Result) {
+	a.Results[result.ExpectedResultID()] = result
+	a.metrics.resultReceived(result.ResultType, result.Error != "")
+	a.events.publish(resultEvent(result))
+	a.recordReport(result)
+	a.resultEvents <- result
+}
+
+// recordReport records when a result was received, and its error if it
+// failed.
+func (a *Aggregator) recordReport(result *plugin.Result) {
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+
+	expected := plugin.ExpectedResult{NodeName: result.NodeName, ResultType: result.ResultType}
+	a.ReportTimes[expected] = time.Now()
+	if result.Error != "" {
+		a.LastErrors[expected] = result.Error
+	} else if result.Incomplete {
+		a.LastErrors[expected] = incompleteError
+	}
+}
+
+// writeResult writes a plugin Result out to the filesystem without recording
+// it as received, then verifies it.
+func (a *Aggregator) writeResult(result *plugin.Result) error {
+	_, err := a.writeResultIn(a.OutputDir, result, false)
+	return err
+}
+
+// countBytes adds n bytes of a result to those of its plugin and of the run,
+// and to those of the result itself, or of its duplicate being staged.
+func (a *Aggregator) countBytes(result *plugin.Result, duplicate bool, n int64) {
+	a.bytesMutex.Lock()
+	defer a.bytesMutex.Unlock()
+	a.countBytesLocked(result, duplicate, n)
+}
+
+// countBytesLocked is countBytes, with bytesMutex held.
+func (a *Aggregator) countBytesLocked(result *plugin.Result, duplicate bool, n int64) {
+	a.pluginBytes[result.ResultType] += n
+	a.totalBytes += n
+	if duplicate {
+		a.stagedBytes[result.ExpectedResultID()] += n
+	} else {
+		a.resultBytes[result.ExpectedResultID()] += n
+	}
+}
+
+// restageBytes counts n bytes of a result as those of its duplicate instead,
+// for a result that was recorded while it was being uploaded.
+func (a *Aggregator) restageBytes(result *plugin.Result, n int64) {
+	a.bytesMutex.Lock()
+	defer a.bytesMutex.Unlock()
+	a.resultBytes[result.ExpectedResultID()] -= n
+	a.stagedBytes[result.ExpectedResultID()] += n
+}
+
+// replaceBytes has the bytes of a result's duplicate take the place of the
+// earlier result's, once it has replaced it.
+func (a *Aggregator) replaceBytes(result *plugin.Result) {
+	a.bytesMutex.Lock()
+	defer a.bytesMutex.Unlock()
+	resultID := result.ExpectedResultID()
+	a.pluginBytes[result.ResultType] -= a.resultBytes[resultID]
+	a.totalBytes -= a.resultBytes[resultID]
+	a.resultBytes[resultID] = a.stagedBytes[resultID]
+	delete(a.stagedBytes, resultID)
+}
+
+// discardStagedBytes stops counting the bytes of a duplicate of the result
+// with the given ID that won't replace it.
+func (a *Aggregator) discardStagedBytes(resultID string) {
+	a.bytesMutex.Lock()
+	defer a.bytesMutex.Unlock()
+	staged := a.stagedBytes[resultID]
+	a.pluginBytes[a.ExpectedResults[resultID].ResultType] -= staged
+	a.totalBytes -= staged
+	delete(a.stagedBytes, resultID)
+}
+
+// writeResultIn is like writeResult, but writes the result within dir rather
+// than OutputDir, and returns how many bytes were read. They're counted
+// towards the size limits as the result's, or its duplicate's, unless it
+// fails, since only results that are stored count, not those the worker has
+// to send again.
+func (a *Aggregator) writeResultIn(dir string, result *plugin.Result, duplicate bool) (n int64, err error) {
+	limited := a.limitResultSize(result, duplicate)
 	defer func() {
-		a.Results[result.ExpectedResultID()] = result
-		a.resultEvents <- result
+		a.metrics.bytesReceived(result.ResultType, limited.read)
+		if err != nil {
+			a.countBytes(result, duplicate, -limited.read)
+			n = 0
+		}
 	}()
 
 	if result.MimeType == gzipMimeType {
-		return a.handleArchiveResult(result)
+		err = a.handleArchiveResult(dir, result)
+	} else {
+		err = a.writeResultFile(dir, result)
+	}
+	if _, ok := errors.Cause(err).(*ResultTooLargeError); ok {
+		// Whatever was received has been thrown away, so the result failed.
+		result.Error = err.Error()
+		result.FailureReason = plugin.FailureUploadFailed
+	}
+	if err == nil && result.Verify != nil {
+		err = result.Verify()
+	}
+	if err != nil {
+		// Don't keep the part that was written, such as what was
+		// extracted from a corrupted archive before its checksum could be
+		// checked; the worker sends it again, or it failed.
+		os.RemoveAll(path.Join(dir, result.Path(), result.Filename))
+	}
+	if isNoSpace(err) {
+		var free int64
+		if usage, usageErr := a.UpdateDiskUsage(); usageErr == nil {
+			free = usage.FreeBytes
+		}
+		return limited.read, errors.WithStack(a.insufficientStorage(result, free))
 	}
+	return limited.read, err
+}
 
+func (a *Aggregator) writeResultFile(dir string, result *plugin.Result) error {
 	// Create the output directory for the result.  Will be of the
 	// form .../plugins/:results_type/:node.json (for DaemonSet plugins) or
-	// .../plugins/:results_type.json (for Job plugins)
-	resultsFile := path.Join(a.OutputDir, result.Path())
+	// .../plugins/:results_type.json (for Job plugins). Results made up of
+	// several files are stored as .../:node/:filename instead.
+	resultsFile := path.Join(dir, result.Path())
+	if result.Filename != "" {
+		resultsFile = path.Join(resultsFile, result.Filename)
+	}
 	resultsDir := path.Dir(resultsFile)
 
 	if err := os.MkdirAll(resultsDir, 0755); err != nil {
@@ -221,6 +893,10 @@ func (a *Aggregator) handleResult(result *plugin.Result) error {
 	defer outFile.Close()
 
 	if _, err = io.Copy(outFile, result.Body); err != nil {
+		if _, ok := errors.Cause(err).(*ResultTooLargeError); ok {
+			// Don't keep the part that fit.
+			os.Remove(resultsFile)
+		}
 		err = errors.Wrapf(err, "could not write body to file %v", outFile.Name())
 		return err
 	}
@@ -229,8 +905,10 @@ func (a *Aggregator) handleResult(result *plugin.Result) error {
 
 }
 
-func (a *Aggregator) handleArchiveResult(result *plugin.Result) error {
-	resultsDir := path.Join(a.OutputDir, result.Path())
+func (a *Aggregator) handleArchiveResult(dir string, result *plugin.Result) error {
+	// An archive that's one of several files for a result is extracted into
+	// a directory of its own.
+	resultsDir := path.Join(dir, result.Path(), result.Filename)
 
 	return errors.Wrapf(
 		tarball.DecodeTarball(result.Body, resultsDir),
@@ -18,15 +18,25 @@ package aggregation
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/heptio/sonobuoy/pkg/backplane/ca/authtest"
 	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/job"
 	pluginutils "github.com/heptio/sonobuoy/pkg/plugin/driver/utils"
 	"github.com/viniciuschiele/tarx"
 )
@@ -123,6 +133,462 @@ func TestAggregation_tarfile(t *testing.T) {
 	})
 }
 
+func TestAggregation_partial(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expected, func(agg *Aggregator, srv *authtest.Server) {
+		URL, err := GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+
+		headers := http.Header{}
+		headers.Set(ContentDispositionHeader, `attachment; filename="first.txt"`)
+		headers.Set(PartialResultHeader, "true")
+		resp := doRequestWithHeaders(t, srv.Client(), "PUT", URL, []byte("foo"), headers)
+		if resp.StatusCode != 200 {
+			t.Errorf("Got non-200 response from server: %v", resp.StatusCode)
+		}
+		if _, ok := agg.Results["e2e"]; ok {
+			t.Fatal("Aggregator completed a result from a partial upload")
+		}
+
+		headers = http.Header{}
+		headers.Set(ContentDispositionHeader, `attachment; filename="../../second.txt"`)
+		resp = doRequestWithHeaders(t, srv.Client(), "PUT", URL, []byte("bar"), headers)
+		if resp.StatusCode != 200 {
+			t.Errorf("Got non-200 response from server: %v", resp.StatusCode)
+		}
+		result, ok := agg.Results["e2e"]
+		if !ok {
+			t.Fatal("Aggregator didn't complete the result with the final upload")
+		}
+
+		for file, expectedContents := range map[string]string{"first.txt": "foo", "second.txt": "bar"} {
+			bytes, err := ioutil.ReadFile(path.Join(agg.OutputDir, result.Path(), file))
+			if string(bytes) != expectedContents {
+				t.Errorf("results for %v incorrect (got %v): %v", file, string(bytes), err)
+			}
+		}
+	})
+}
+
+func TestAggregation_concurrentUploads(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		plugin.ExpectedResult{NodeName: "node1", ResultType: "systemd_logs"},
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expected, func(agg *Aggregator, srv *authtest.Server) {
+		streamURL, err := NodeResultURL(srv.URL, "node1", "systemd_logs")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+		URL, err := GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+
+		// A streamed result stays open until its plugin finishes.
+		body, stream := io.Pipe()
+		req, err := http.NewRequest("PUT", streamURL, body)
+		if err != nil {
+			t.Fatalf("error constructing request: %v", err)
+		}
+		streamed := make(chan *http.Response, 1)
+		go func() {
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Errorf("error performing request: %v", err)
+			}
+			streamed <- resp
+		}()
+		stream.Write([]byte("first "))
+
+		done := make(chan *http.Response, 1)
+		go func() { done <- doRequest(t, srv.Client(), "PUT", URL, []byte("bar")) }()
+		select {
+		case resp := <-done:
+			if resp.StatusCode != 200 {
+				t.Errorf("Got non-200 response from server: %v", resp.StatusCode)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Result was held up by another one being streamed")
+		}
+
+		stream.Write([]byte("second"))
+		stream.Close()
+		if resp := <-streamed; resp == nil || resp.StatusCode != 200 {
+			t.Fatalf("Got unexpected response to the streamed result: %+v", resp)
+		}
+		contents, err := ioutil.ReadFile(path.Join(agg.OutputDir, "systemd_logs", "results", "node1"))
+		if err != nil || string(contents) != "first second" {
+			t.Errorf("Expected the streamed result to be stored, got %q (%v)", contents, err)
+		}
+		if !agg.isComplete() {
+			t.Error("Expected both results to be recorded")
+		}
+	})
+}
+
+func TestAggregation_progress(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		plugin.ExpectedResult{NodeName: "node1", ResultType: "systemd_logs"},
+	}
+
+	withAggregator(t, expected, func(agg *Aggregator, srv *authtest.Server) {
+		URL, err := NodeResultURL(srv.URL, "node1", "systemd_logs")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+
+		resp := doRequest(t, srv.Client(), "PUT", ProgressURL(URL), []byte(`{"completed": 120, "total": 350}`))
+		if resp.StatusCode != 200 {
+			t.Errorf("Got non-200 response from server: %v", resp.StatusCode)
+		}
+		progress := agg.LatestProgress()
+		if len(progress) != 1 || progress[0].Completed != 120 || progress[0].Total != 350 || progress[0].Node != "node1" {
+			t.Errorf("Unexpected progress recorded: %v", progress)
+		}
+
+		if _, ok := agg.Results["systemd_logs/node1"]; ok {
+			t.Error("A progress update shouldn't complete a result")
+		}
+
+		URL, err = NodeResultURL(srv.URL, "node2", "systemd_logs")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+		resp = doRequest(t, srv.Client(), "PUT", ProgressURL(URL), []byte(`{"completed": 1, "total": 2}`))
+		if resp.StatusCode != 403 {
+			t.Errorf("Expected a 403 forbidden for progress from an unexpected node, got %v", resp.StatusCode)
+		}
+
+		resp = doRequest(t, srv.Client(), "PUT", ProgressURL(URL), []byte(`not json`))
+		if resp.StatusCode != 400 {
+			t.Errorf("Expected a 400 bad request for a malformed update, got %v", resp.StatusCode)
+		}
+	})
+}
+
+func TestAggregation_checksum(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		plugin.ExpectedResult{NodeName: "node1", ResultType: "systemd_logs"},
+	}
+
+	withAggregator(t, expected, func(agg *Aggregator, srv *authtest.Server) {
+		URL, err := NodeResultURL(srv.URL, "node1", "systemd_logs")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+
+		headers := http.Header{}
+		headers.Set(ChecksumHeader, fmt.Sprintf("%x", sha256.Sum256([]byte("foo"))))
+		resp := doRequestWithHeaders(t, srv.Client(), "PUT", URL, []byte("corrupted"), headers)
+		if resp.StatusCode != 422 {
+			t.Errorf("Expected a 422 for a result not matching its checksum, got %v", resp.StatusCode)
+		}
+		if _, ok := agg.Results["systemd_logs/node1"]; ok {
+			t.Fatal("Aggregator recorded a corrupted result")
+		}
+		if count := agg.ChecksumMismatchCounts()[expected[0]]; count != 1 {
+			t.Errorf("Expected 1 checksum mismatch to be recorded, got %v", count)
+		}
+
+		headers = http.Header{}
+		headers.Set(ChecksumHeader, fmt.Sprintf("%x", sha256.Sum256([]byte("foo"))))
+		resp = doRequestWithHeaders(t, srv.Client(), "PUT", URL, []byte("foo"), headers)
+		if resp.StatusCode != 200 {
+			t.Errorf("Got non-200 response from server: %v", resp.StatusCode)
+		}
+		if _, ok := agg.Results["systemd_logs/node1"]; !ok {
+			t.Error("Aggregator didn't record a result matching its checksum")
+		}
+	})
+}
+
+func TestAggregation_corruptedTarball(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+	tarBytes := makeTarWithContents(t, "inside_tar.txt", []byte("foo"))
+
+	withAggregator(t, expected, func(agg *Aggregator, srv *authtest.Server) {
+		// Written where it's kept, the tarball is extracted before its
+		// checksum can be checked, so what was extracted must go.
+		result := &plugin.Result{
+			ResultType: "e2e",
+			MimeType:   gzipMimeType,
+			Body:       bytes.NewReader(tarBytes),
+			Verify:     func() error { return errors.New("checksum mismatch") },
+		}
+		if _, err := agg.writeResultIn(agg.OutputDir, result, false); err == nil {
+			t.Fatal("expected the checksum mismatch to fail the result")
+		}
+		if _, err := os.Stat(path.Join(agg.OutputDir, result.Path())); !os.IsNotExist(err) {
+			t.Errorf("expected a corrupted tarball not to be kept, got %v", err)
+		}
+
+		URL, err := GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+		headers := http.Header{}
+		headers.Add("content-type", gzipMimeType)
+		headers.Set(ChecksumHeader, fmt.Sprintf("%x", sha256.Sum256([]byte("foo"))))
+		resp := doRequestWithHeaders(t, srv.Client(), "PUT", URL, tarBytes, headers)
+		if resp.StatusCode != 422 {
+			t.Errorf("Expected a 422 for a tarball not matching its checksum, got %v", resp.StatusCode)
+		}
+		filepath.Walk(agg.OutputDir, func(file string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				t.Errorf("expected no files to be left behind by a corrupted tarball, found %v", file)
+			}
+			return nil
+		})
+	})
+}
+
+func TestAggregation_sizeLimits(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		plugin.ExpectedResult{NodeName: "node1", ResultType: "systemd_logs"},
+		plugin.ExpectedResult{NodeName: "node2", ResultType: "systemd_logs"},
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expected, func(agg *Aggregator, srv *authtest.Server) {
+		agg.MaxPluginBytes = 5
+		agg.MaxTotalBytes = 7
+
+		URL, err := NodeResultURL(srv.URL, "node1", "systemd_logs")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+		resp := doRequest(t, srv.Client(), "PUT", URL, []byte("foo"))
+		if resp.StatusCode != 200 {
+			t.Errorf("Got non-200 response from server: %v", resp.StatusCode)
+		}
+
+		URL, err = NodeResultURL(srv.URL, "node2", "systemd_logs")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+		resp = doRequest(t, srv.Client(), "PUT", URL, []byte("foo"))
+		if resp.StatusCode != 413 {
+			t.Errorf("Expected a 413 for going over the plugin limit, got %v", resp.StatusCode)
+		}
+		tooLarge := &ResultTooLargeError{}
+		if err := json.NewDecoder(resp.Body).Decode(tooLarge); err != nil || tooLarge.Scope != "plugin" || tooLarge.Limit != 5 {
+			t.Errorf("Expected a plugin limit error, got %+v (%v)", tooLarge, err)
+		}
+		if result, ok := agg.Results["systemd_logs/node2"]; !ok || result.IsSuccess() {
+			t.Errorf("Expected a result too large to be recorded as failed, got %+v", result)
+		}
+		if _, err := os.Stat(path.Join(agg.OutputDir, "systemd_logs", "results", "node2")); !os.IsNotExist(err) {
+			t.Errorf("Expected a result too large not to be kept, got %v", err)
+		}
+
+		URL, err = GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+		resp = doRequest(t, srv.Client(), "PUT", URL, []byte("foobar"))
+		if resp.StatusCode != 413 {
+			t.Errorf("Expected a 413 for going over the total limit, got %v", resp.StatusCode)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(tooLarge); err != nil || tooLarge.Scope != "total" {
+			t.Errorf("Expected a total limit error, got %+v (%v)", tooLarge, err)
+		}
+	})
+}
+
+func TestAggregation_sizeLimitsRetries(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		plugin.ExpectedResult{NodeName: "node1", ResultType: "systemd_logs"},
+	}
+
+	withAggregator(t, expected, func(agg *Aggregator, srv *authtest.Server) {
+		agg.MaxPluginBytes = 5
+
+		URL, err := NodeResultURL(srv.URL, "node1", "systemd_logs")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+		headers := http.Header{}
+		headers.Set(ChecksumHeader, fmt.Sprintf("%x", sha256.Sum256([]byte("foo"))))
+
+		// Corrupted uploads are sent again, so they don't count.
+		for i := 0; i < 3; i++ {
+			resp := doRequestWithHeaders(t, srv.Client(), "PUT", URL, []byte("fo0"), headers)
+			if resp.StatusCode != http.StatusUnprocessableEntity {
+				t.Fatalf("Expected a 422 for a checksum mismatch, got %v", resp.StatusCode)
+			}
+		}
+		resp := doRequestWithHeaders(t, srv.Client(), "PUT", URL, []byte("foo"), headers)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected a 200 for the result sent again, got %v", resp.StatusCode)
+		}
+
+		// A duplicate takes the place of the result it replaces.
+		for _, body := range []string{"bar", "baz"} {
+			resp = doRequest(t, srv.Client(), "PUT", URL, []byte(body))
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("Expected a 200 for a duplicate within the limit, got %v", resp.StatusCode)
+			}
+		}
+		if agg.pluginBytes["systemd_logs"] != 3 || agg.totalBytes != 3 {
+			t.Errorf("Expected only the stored result to count, got %v bytes for the plugin and %v in total", agg.pluginBytes["systemd_logs"], agg.totalBytes)
+		}
+	})
+}
+
+func TestAggregation_workerVersion(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		plugin.ExpectedResult{NodeName: "node1", ResultType: "systemd_logs"},
+		plugin.ExpectedResult{NodeName: "node2", ResultType: "systemd_logs"},
+		plugin.ExpectedResult{NodeName: "node3", ResultType: "systemd_logs"},
+		plugin.ExpectedResult{NodeName: "node4", ResultType: "systemd_logs"},
+	}
+
+	withAggregator(t, expected, func(agg *Aggregator, srv *authtest.Server) {
+		agg.Version = "v1.0.0"
+		send := func(node, version string) *http.Response {
+			URL, err := NodeResultURL(srv.URL, node, "systemd_logs")
+			if err != nil {
+				t.Fatalf("couldn't get test server URL: %v", err)
+			}
+			headers := http.Header{}
+			if version != "" {
+				headers.Set(WorkerVersionHeader, version)
+			}
+			return doRequestWithHeaders(t, srv.Client(), "PUT", URL, []byte("foo"), headers)
+		}
+
+		if resp := send("node1", "v1.0.0"); resp.StatusCode != 200 {
+			t.Errorf("Expected a result from a worker of the same version to be accepted, got %v", resp.StatusCode)
+		}
+		if resp := send("node2", ""); resp.StatusCode != 200 {
+			t.Errorf("Expected a result from a worker that didn't report its version to be accepted, got %v", resp.StatusCode)
+		}
+
+		resp := send("node3", "v0.9.0")
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("Expected a 409 for a worker of a different version, got %v", resp.StatusCode)
+		}
+		mismatch := &VersionMismatchError{}
+		if err := json.NewDecoder(resp.Body).Decode(mismatch); err != nil || mismatch.WorkerVersion != "v0.9.0" || mismatch.AggregatorVersion != "v1.0.0" {
+			t.Errorf("Expected a version mismatch error, got %+v (%v)", mismatch, err)
+		}
+		result, ok := agg.Results["systemd_logs/node3"]
+		if !ok || result.IsSuccess() || result.FailureReason != plugin.FailureVersionMismatch {
+			t.Errorf("Expected the result to be recorded as failed by the version mismatch, got %+v", result)
+		}
+		if contents, err := ioutil.ReadFile(path.Join(agg.OutputDir, "systemd_logs", "errors", "node3")); err != nil || !strings.Contains(string(contents), "v0.9.0") {
+			t.Errorf("Expected the mismatch to be stored in place of the result, got %q (%v)", contents, err)
+		}
+
+		agg.AllowMixedVersions = true
+		if resp := send("node4", "v0.9.0"); resp.StatusCode != 200 {
+			t.Errorf("Expected a result from a worker of a different version to be accepted when mixed versions are allowed, got %v", resp.StatusCode)
+		}
+		if result, ok := agg.Results["systemd_logs/node4"]; !ok || !result.IsSuccess() {
+			t.Errorf("Expected the result to be recorded as successful, got %+v", result)
+		}
+	})
+}
+
+func TestAggregation_diskSpace(t *testing.T) {
+	defer func(stat func(string) (int64, int64, error)) { statDisk = stat }(statDisk)
+	var free int64
+	statDisk = func(string) (int64, int64, error) { return free, 10000, nil }
+
+	expected := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expected, func(agg *Aggregator, srv *authtest.Server) {
+		agg.MinFreeBytes = 1000
+		URL, err := GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+
+		free = 500
+		resp := doRequest(t, srv.Client(), "PUT", URL, []byte("foo"))
+		if resp.StatusCode != http.StatusInsufficientStorage {
+			t.Errorf("Expected a 507 while the disk is low on space, got %v", resp.StatusCode)
+		}
+		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "60" {
+			t.Errorf("Expected workers to be asked to retry after 60 seconds, got %q", retryAfter)
+		}
+		insufficient := &InsufficientStorageError{}
+		if err := json.NewDecoder(resp.Body).Decode(insufficient); err != nil || insufficient.FreeBytes != 500 || insufficient.MinFreeBytes != 1000 {
+			t.Errorf("Expected an insufficient storage error, got %+v (%v)", insufficient, err)
+		}
+		if _, ok := agg.Results["e2e"]; ok {
+			t.Error("Expected a result turned away for lack of space not to be recorded")
+		}
+		if usage := agg.LatestDiskUsage(); usage == nil || !usage.Low || usage.FreeBytes != 500 {
+			t.Errorf("Expected the disk to be recorded as low on space, got %+v", usage)
+		}
+
+		free = 5000
+		resp = doRequest(t, srv.Client(), "PUT", URL, []byte("foo"))
+		if resp.StatusCode != 200 {
+			t.Errorf("Expected the result to be accepted once there's space, got %v", resp.StatusCode)
+		}
+		if _, ok := agg.Results["e2e"]; !ok {
+			t.Error("Expected the result to be recorded once there's space")
+		}
+		if usage := agg.LatestDiskUsage(); usage == nil || usage.Low || usage.TotalBytes != 10000 {
+			t.Errorf("Expected the disk to be recorded with space, got %+v", usage)
+		}
+	})
+}
+
+func TestAggregation_invalid(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		plugin.ExpectedResult{NodeName: "node1", ResultType: "netcheck"},
+		plugin.ExpectedResult{NodeName: "node2", ResultType: "netcheck"},
+	}
+
+	withAggregator(t, expected, func(agg *Aggregator, srv *authtest.Server) {
+		agg.Formats = map[string]ResultFormat{"netcheck": jsonFormat{}}
+		headers := http.Header{"Content-Type": []string{"application/json"}}
+
+		URL, err := NodeResultURL(srv.URL, "node1", "netcheck")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+		resp := doRequestWithHeaders(t, srv.Client(), "PUT", URL, []byte(`{"latency": 5}`), headers)
+		if resp.StatusCode != 200 {
+			t.Errorf("Got non-200 response from server: %v", resp.StatusCode)
+		}
+
+		URL, err = NodeResultURL(srv.URL, "node2", "netcheck")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+		resp = doRequestWithHeaders(t, srv.Client(), "PUT", URL, []byte(`{"latency": `), headers)
+		if resp.StatusCode != 400 {
+			t.Errorf("Expected a 400 for an invalid result, got %v", resp.StatusCode)
+		}
+		invalid := &InvalidResultError{}
+		if err := json.NewDecoder(resp.Body).Decode(invalid); err != nil || invalid.Format != JSONFormat || len(invalid.Problems) != 1 {
+			t.Errorf("Expected an invalid result error, got %+v (%v)", invalid, err)
+		}
+		result, ok := agg.Results["netcheck/node2"]
+		if !ok || result.IsSuccess() || result.FailureReason != plugin.FailureInvalidResult {
+			t.Errorf("Expected an invalid result to be recorded as failed, got %+v", result)
+		}
+		if _, err := os.Stat(path.Join(agg.OutputDir, result.Path())); !os.IsNotExist(err) {
+			t.Errorf("Expected an invalid result not to be kept, got %v", err)
+		}
+	})
+}
+
 func TestAggregation_wrongnodes(t *testing.T) {
 	expected := []plugin.ExpectedResult{
 		plugin.ExpectedResult{NodeName: "node1", ResultType: "systemd_logs"},
@@ -162,10 +628,38 @@ func TestAggregation_duplicates(t *testing.T) {
 			t.Errorf("Got non-200 response from server: %v", resp.StatusCode)
 		}
 
-		// Check in the same node again, should conflict
-		resp = doRequest(t, srv.Client(), "PUT", URL, []byte("foo"))
-		if resp.StatusCode != 409 {
-			t.Errorf("Expected a 409 conflict for checking in a duplicate node, got %v", resp.StatusCode)
+		// Check in the same node again, with the same result and then a
+		// different one, which replaces it
+		for i, contents := range []string{"foo", "bar"} {
+			resp = doRequest(t, srv.Client(), "PUT", URL, []byte(contents))
+			if resp.StatusCode != 200 {
+				t.Errorf("Expected a duplicate result to be accepted, got %v", resp.StatusCode)
+			}
+			if count := agg.DuplicateCounts()[expected[0]]; count != i+1 {
+				t.Errorf("Expected %v duplicates to be recorded, got %v", i+1, count)
+			}
+			bytes, err := ioutil.ReadFile(path.Join(agg.OutputDir, "systemd_logs", "results", "node1"))
+			if string(bytes) != contents {
+				t.Errorf("Expected the latest result %q to be kept, got %q (%v)", contents, string(bytes), err)
+			}
+		}
+
+		// A corrupted duplicate doesn't replace the result
+		headers := http.Header{}
+		headers.Set(ChecksumHeader, fmt.Sprintf("%x", sha256.Sum256([]byte("baz"))))
+		resp = doRequestWithHeaders(t, srv.Client(), "PUT", URL, []byte("corrupted"), headers)
+		if resp.StatusCode != 422 {
+			t.Errorf("Expected a 422 for a duplicate not matching its checksum, got %v", resp.StatusCode)
+		}
+		bytes, err := ioutil.ReadFile(path.Join(agg.OutputDir, "systemd_logs", "results", "node1"))
+		if string(bytes) != "bar" {
+			t.Errorf("Expected a corrupted duplicate not to replace the result, got %q (%v)", string(bytes), err)
+		}
+
+		agg.discardDuplicates()
+		files, err := ioutil.ReadDir(agg.OutputDir)
+		if err != nil || len(files) != 1 {
+			t.Errorf("Expected only the stored results to be left, got %v (%v)", files, err)
 		}
 
 		if _, ok := agg.Results["node10"]; ok {
@@ -174,6 +668,47 @@ func TestAggregation_duplicates(t *testing.T) {
 	})
 }
 
+func TestAggregation_duplicatePartial(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expected, func(agg *Aggregator, srv *authtest.Server) {
+		URL, err := GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+
+		upload := func(files ...string) {
+			for i, file := range files {
+				headers := http.Header{}
+				headers.Set(ContentDispositionHeader, fmt.Sprintf(`attachment; filename="%v"`, file))
+				if i < len(files)-1 {
+					headers.Set(PartialResultHeader, "true")
+				}
+				resp := doRequestWithHeaders(t, srv.Client(), "PUT", URL, []byte(file), headers)
+				if resp.StatusCode != 200 {
+					t.Errorf("Got non-200 response from server: %v", resp.StatusCode)
+				}
+			}
+		}
+
+		upload("first.txt", "second.txt")
+		upload("third.txt", "fourth.txt")
+		result, ok := agg.Results["e2e"]
+		if !ok {
+			t.Fatal("Aggregator didn't record the result")
+		}
+		files, err := ioutil.ReadDir(path.Join(agg.OutputDir, result.Path()))
+		if err != nil || len(files) != 2 || files[0].Name() != "fourth.txt" || files[1].Name() != "third.txt" {
+			t.Errorf("Expected only the files of the latest upload, got %v (%v)", files, err)
+		}
+		if count := agg.DuplicateCounts()[expected[0]]; count != 1 {
+			t.Errorf("Expected 1 duplicate to be recorded, got %v", count)
+		}
+	})
+}
+
 func TestAggregation_errors(t *testing.T) {
 	expected := []plugin.ExpectedResult{
 		plugin.ExpectedResult{ResultType: "e2e"},
@@ -195,6 +730,55 @@ func TestAggregation_errors(t *testing.T) {
 		} else {
 			t.Errorf("Aggregator didn't record error result from e2e plugin, got %v", agg.Results)
 		}
+
+		e2e := plugin.ExpectedResult{ResultType: "e2e"}
+		if err := agg.LatestErrors()[e2e]; err != "foo" {
+			t.Errorf("expected the e2e error to be recorded, got %q", err)
+		}
+		if _, ok := agg.LatestReportTimes()[e2e]; !ok {
+			t.Error("expected the e2e report time to be recorded")
+		}
+	})
+}
+
+func TestAggregation_metrics(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		plugin.ExpectedResult{NodeName: "node1", ResultType: "systemd_logs"},
+		plugin.ExpectedResult{NodeName: "node2", ResultType: "systemd_logs"},
+	}
+
+	withAggregator(t, expected, func(agg *Aggregator, srv *authtest.Server) {
+		agg.PluginLaunched("systemd_logs")
+
+		URL, err := NodeResultURL(srv.URL, "node1", "systemd_logs")
+		if err != nil {
+			t.Fatalf("couldn't get test server URL: %v", err)
+		}
+		resp := doRequest(t, srv.Client(), "PUT", URL, []byte("foo"))
+		if resp.StatusCode != 200 {
+			t.Errorf("Got non-200 response from server: %v", resp.StatusCode)
+		}
+
+		resultsCh := make(chan *plugin.Result)
+		go agg.IngestResults(resultsCh)
+		resultsCh <- pluginutils.MakeErrorResult("systemd_logs", map[string]interface{}{"error": "foo"}, "node2")
+		agg.Wait(make(chan bool))
+
+		rec := httptest.NewRecorder()
+		agg.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		metrics := rec.Body.String()
+		for _, line := range []string{
+			`sonobuoy_plugins_launched_total{plugin="systemd_logs"} 1`,
+			`sonobuoy_results_expected{plugin="systemd_logs"} 2`,
+			`sonobuoy_results_received_total{plugin="systemd_logs"} 2`,
+			`sonobuoy_results_failed_total{plugin="systemd_logs"} 1`,
+			`sonobuoy_result_bytes_received_total{plugin="systemd_logs"} 18`,
+			`# TYPE sonobuoy_run_duration_seconds gauge`,
+		} {
+			if !strings.Contains(metrics, line+"\n") {
+				t.Errorf("expected metrics to contain %q, got:\n%v", line, metrics)
+			}
+		}
 	})
 }
 
@@ -208,7 +792,7 @@ func withAggregator(t *testing.T, expected []plugin.ExpectedResult, callback fun
 	defer os.RemoveAll(dir)
 
 	agg := NewAggregator(dir, expected)
-	handler := NewHandler(agg.HandleHTTPResult)
+	handler := NewHandler(agg.HandleHTTPResult, agg.HandleHTTPProgress, agg.HandleHTTPHeartbeat)
 	srv := authtest.NewTLSServer(handler, t)
 	defer srv.Close()
 
@@ -257,3 +841,59 @@ func makeTarWithContents(t *testing.T, filename string, fileContents []byte) (ta
 
 	return tarbytes
 }
+
+func TestWaitForDependencies(t *testing.T) {
+	dependencyPollInterval = 10 * time.Millisecond
+
+	setup := job.NewPlugin(plugin.Definition{Name: "setup", ResultType: "setup"}, "", "", "Always")
+	tests := job.NewPlugin(plugin.Definition{Name: "tests", ResultType: "tests", DependsOn: []string{"setup"}}, "", "", "Always")
+	plugins := []plugin.Interface{setup, tests}
+
+	testCases := []struct {
+		name        string
+		setupResult *plugin.Result
+		expectErr   bool
+	}{
+		{
+			name:        "dependency succeeded",
+			setupResult: &plugin.Result{ResultType: "setup", Body: bytes.NewReader([]byte("ok"))},
+		},
+		{
+			name:        "dependency failed",
+			setupResult: pluginutils.MakeErrorResult("setup", map[string]interface{}{"error": "broken"}, ""),
+			expectErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expected := []plugin.ExpectedResult{{ResultType: "setup"}, {ResultType: "tests"}}
+			withAggregator(t, expected, func(aggr *Aggregator, _ *authtest.Server) {
+
+				errc := make(chan error, 1)
+				go func() {
+					errc <- waitForDependencies(tests, plugins, nil, aggr, make(chan struct{}))
+				}()
+
+				select {
+				case err := <-errc:
+					t.Fatalf("expected to wait for setup, got %v", err)
+				case <-time.After(5 * dependencyPollInterval):
+				}
+
+				resultsCh := make(chan *plugin.Result, 1)
+				resultsCh <- tc.setupResult
+				close(resultsCh)
+				aggr.IngestResults(resultsCh)
+
+				err := <-errc
+				if _, ok := err.(*DependencyFailedError); ok != tc.expectErr {
+					t.Errorf("expected a dependency failure: %v, got %v", tc.expectErr, err)
+				}
+				if !tc.expectErr && err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	pluginutils "github.com/heptio/sonobuoy/pkg/plugin/driver/utils"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+)
+
+// dependencyPollInterval is how often a plugin waiting on others checks
+// whether they've finished.
+var dependencyPollInterval = 5 * time.Second
+
+// errStoppedWaiting is returned when the run ends before a plugin's
+// dependencies have finished.
+var errStoppedWaiting = errors.New("stopped waiting for dependencies")
+
+// DependencyFailedError is returned when a plugin can't be run because a
+// plugin it depends on failed.
+type DependencyFailedError struct {
+	Plugin     string
+	Dependency string
+}
+
+func (e *DependencyFailedError) Error() string {
+	return fmt.Sprintf("plugin %v wasn't run because plugin %v, which it depends on, failed", e.Plugin, e.Dependency)
+}
+
+// resultsOutcome reports whether all of the given results have checked in,
+// and if so, whether they all succeeded.
+func (a *Aggregator) resultsOutcome(expected []plugin.ExpectedResult) (done bool, succeeded bool) {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	succeeded = true
+	for _, exp := range expected {
+		result, ok := a.Results[exp.ID()]
+		if !ok {
+			return false, false
+		}
+		if !result.IsSuccess() {
+			succeeded = false
+		}
+	}
+	return true, succeeded
+}
+
+// waitForDependencies blocks until every plugin p depends on has submitted all
+// of its results successfully, returning a DependencyFailedError as soon as
+// one of them fails, or errStoppedWaiting if stop is closed first.
+func waitForDependencies(p plugin.Interface, plugins []plugin.Interface, nodes []v1.Node, aggr *Aggregator, stop <-chan struct{}) error {
+	byName := make(map[string]plugin.Interface, len(plugins))
+	for _, other := range plugins {
+		byName[other.GetName()] = other
+	}
+
+	pending := p.GetDependsOn()
+	for {
+		var stillPending []string
+		for _, name := range pending {
+			dep, ok := byName[name]
+			if !ok {
+				return errors.Errorf("plugin %v depends on unknown plugin %v", p.GetName(), name)
+			}
+			done, succeeded := aggr.resultsOutcome(dep.ExpectedResults(nodes))
+			switch {
+			case !done:
+				stillPending = append(stillPending, name)
+			case !succeeded:
+				return &DependencyFailedError{Plugin: p.GetName(), Dependency: name}
+			}
+		}
+		if len(stillPending) == 0 {
+			return nil
+		}
+		pending = stillPending
+
+		select {
+		case <-time.After(dependencyPollInterval):
+		case <-stop:
+			return errStoppedWaiting
+		}
+	}
+}
+
+// failPlugin sends an error result through resultsCh for each of the plugin's
+// missing results, so the rest of the run doesn't wait for a plugin that
+// won't be run.
+func failPlugin(p plugin.Interface, nodes []v1.Node, aggr *Aggregator, resultsCh chan<- *plugin.Result, err error) {
+	for _, expected := range aggr.missingResults(p.ExpectedResults(nodes)) {
+		resultsCh <- pluginutils.MakeErrorResult(expected.ResultType, map[string]interface{}{
+			"error": err.Error(),
+		}, expected.NodeName)
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+// diskRetryAfter is how long workers are asked to wait before sending a
+// result again when the results volume is too full for it.
+var diskRetryAfter = time.Minute
+
+// statDisk returns the free and total bytes of the volume dir is on. It's a
+// variable so tests can fill up the disk.
+var statDisk = volumeUsage
+
+// DiskUsage is how much space is left in the volume the aggregator stores
+// results in.
+type DiskUsage struct {
+	FreeBytes  int64 `json:"freeBytes"`
+	TotalBytes int64 `json:"totalBytes"`
+	// Low is set while less than the aggregator's minimum is free, and
+	// results are turned away until there's more.
+	Low bool `json:"low,omitempty"`
+}
+
+// InsufficientStorageError is returned when the results volume is too full to
+// store a result. It's sent to the worker as the JSON body of a 507 response,
+// with a Retry-After header saying when to send the result again.
+type InsufficientStorageError struct {
+	Plugin       string `json:"plugin"`
+	Node         string `json:"node,omitempty"`
+	FreeBytes    int64  `json:"freeBytes"`
+	MinFreeBytes int64  `json:"minFreeBytes"`
+	// RetryAfterSeconds is how long the worker should wait before sending
+	// the result again.
+	RetryAfterSeconds int `json:"retryAfterSeconds"`
+}
+
+func (e *InsufficientStorageError) Error() string {
+	return fmt.Sprintf("not enough space to store the result for plugin %v: %v bytes free, %v needed", e.Plugin, e.FreeBytes, e.MinFreeBytes)
+}
+
+// RetryAfter is how long to wait before sending the result again.
+func (e *InsufficientStorageError) RetryAfter() time.Duration {
+	return time.Duration(e.RetryAfterSeconds) * time.Second
+}
+
+// UpdateDiskUsage checks how much space is left in the results volume,
+// recording it for LatestDiskUsage.
+func (a *Aggregator) UpdateDiskUsage() (*DiskUsage, error) {
+	// The output directory isn't created until the first result arrives,
+	// but it's on the same volume as its parents.
+	dir := a.OutputDir
+	for {
+		if _, err := os.Stat(dir); err == nil || path.Dir(dir) == dir {
+			break
+		}
+		dir = path.Dir(dir)
+	}
+	free, total, err := statDisk(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't check free space in %v", dir)
+	}
+
+	usage := &DiskUsage{FreeBytes: free, TotalBytes: total, Low: free < a.MinFreeBytes}
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+	if usage.Low && (a.disk == nil || !a.disk.Low) {
+		logrus.WithFields(logrus.Fields{"free": free, "minimum": a.MinFreeBytes}).Warning("Results volume is low on space, holding back results")
+	}
+	a.disk = usage
+	return usage, nil
+}
+
+// LatestDiskUsage returns how much space was left in the results volume when
+// it was last checked, if it has been.
+func (a *Aggregator) LatestDiskUsage() *DiskUsage {
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+	if a.disk == nil {
+		return nil
+	}
+	usage := *a.disk
+	return &usage
+}
+
+// checkDiskSpace returns an InsufficientStorageError if there's too little
+// space left to accept result. Results are accepted if there's no minimum, or
+// the free space can't be checked.
+func (a *Aggregator) checkDiskSpace(result *plugin.Result) error {
+	if a.MinFreeBytes <= 0 {
+		return nil
+	}
+	usage, err := a.UpdateDiskUsage()
+	if err != nil {
+		logrus.WithError(err).Info("accepting result without checking free space")
+		return nil
+	}
+	if !usage.Low {
+		return nil
+	}
+	return a.insufficientStorage(result, usage.FreeBytes)
+}
+
+func (a *Aggregator) insufficientStorage(result *plugin.Result, free int64) *InsufficientStorageError {
+	return &InsufficientStorageError{
+		Plugin:            result.ResultType,
+		Node:              result.NodeName,
+		FreeBytes:         free,
+		MinFreeBytes:      a.MinFreeBytes,
+		RetryAfterSeconds: int(diskRetryAfter / time.Second),
+	}
+}
+
+// writeInsufficientStorage responds to a worker whose result couldn't be
+// stored for lack of space, asking it to send it again later.
+func writeInsufficientStorage(w http.ResponseWriter, err *InsufficientStorageError) {
+	w.Header().Set("content-type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(err.RetryAfterSeconds))
+	w.WriteHeader(http.StatusInsufficientStorage)
+	json.NewEncoder(w).Encode(err)
+}
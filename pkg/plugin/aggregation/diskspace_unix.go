@@ -0,0 +1,49 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// volumeUsage returns the bytes available to unprivileged users, and the
+// total bytes, of the volume dir is on.
+func volumeUsage(dir string) (free, total int64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), int64(stat.Blocks) * int64(stat.Bsize), nil
+}
+
+// isNoSpace reports whether err is from running out of space.
+func isNoSpace(err error) bool {
+	switch err := errors.Cause(err).(type) {
+	case *os.PathError:
+		return err.Err == syscall.ENOSPC
+	case syscall.Errno:
+		return err == syscall.ENOSPC
+	default:
+		return false
+	}
+}
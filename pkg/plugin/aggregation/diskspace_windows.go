@@ -1,5 +1,5 @@
 /*
-Copyright 2018 The Kubernetes Authors.
+Copyright 2018 Heptio Inc.
 
 Licensed under the Apache License, Version 2.0 (the "License");
 you may not use this file except in compliance with the License.
@@ -14,5 +14,16 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// This package has the automatically generated typed clients.
-package v1beta1
+package aggregation
+
+import "github.com/pkg/errors"
+
+// volumeUsage isn't supported on Windows, where the aggregator doesn't run.
+func volumeUsage(dir string) (free, total int64, err error) {
+	return 0, 0, errors.New("checking free space isn't supported on windows")
+}
+
+// isNoSpace reports whether err is from running out of space.
+func isNoSpace(err error) bool {
+	return false
+}
@@ -0,0 +1,295 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+// EventsPath is where the aggregator streams the events of a run, as
+// server-sent events.
+const EventsPath = "/api/v1/events"
+
+// EventType is what happened in an Event.
+type EventType string
+
+const (
+	// EventPluginStarted is sent when a plugin has been launched.
+	EventPluginStarted EventType = "plugin-started"
+	// EventResultReceived is sent when a result has been received.
+	EventResultReceived EventType = "result-received"
+	// EventPluginFailed is sent when a result reports that its plugin failed.
+	EventPluginFailed EventType = "plugin-failed"
+	// EventRunComplete is sent once the run is over, and is the last event.
+	EventRunComplete EventType = "run-complete"
+)
+
+const (
+	// eventBufferSize is how many events a subscriber can fall behind by
+	// before it's dropped, so one slow client can't hold up the run.
+	eventBufferSize = 256
+	// eventKeepAlive is how often a comment is sent to idle streams, so
+	// proxies between the aggregator and its clients don't close them.
+	eventKeepAlive = 30 * time.Second
+)
+
+// Event is something that happened during a run.
+type Event struct {
+	// ID increases with each event, so that clients can resume a stream
+	// from the last event they saw.
+	ID   int64     `json:"id"`
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Plugin and Node are what the event is about, if it's about a plugin.
+	// Node is empty for global results.
+	Plugin string `json:"plugin,omitempty"`
+	Node   string `json:"node,omitempty"`
+	// Error is why a plugin failed.
+	Error string `json:"error,omitempty"`
+	// Status is the status of the run once it's complete.
+	Status string `json:"status,omitempty"`
+}
+
+// eventBroker keeps the events of a run and sends them on to subscribers.
+type eventBroker struct {
+	mutex       sync.Mutex
+	history     []Event
+	subscribers map[chan Event]struct{}
+	closed      bool
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscribers: make(map[chan Event]struct{})}
+}
+
+// publish records an event and sends it to every subscriber. Subscribers
+// that have fallen too far behind are dropped.
+func (b *eventBroker) publish(event Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return
+	}
+
+	event.ID = int64(len(b.history)) + 1
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	b.history = append(b.history, event)
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns the events after the one with the given ID, and a
+// channel the events that follow are sent to. The channel is closed once the
+// run is complete, or if the subscriber falls behind. It's nil if the run is
+// already complete.
+func (b *eventBroker) subscribe(after int64) ([]Event, chan Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var past []Event
+	if after >= 0 && after < int64(len(b.history)) {
+		past = append(past, b.history[after:]...)
+	}
+	if b.closed {
+		return past, nil
+	}
+	ch := make(chan Event, eventBufferSize)
+	b.subscribers[ch] = struct{}{}
+	return past, ch
+}
+
+// unsubscribe stops sending events to ch.
+func (b *eventBroker) unsubscribe(ch chan Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// close stops sending events, closing every subscriber's channel.
+func (b *eventBroker) close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Events returns the events of the run so far.
+func (a *Aggregator) Events() []Event {
+	events, _ := a.events.subscribe(0)
+	return events
+}
+
+// RunComplete sends the last event of the run, with its final status, and
+// ends every stream of its events.
+func (a *Aggregator) RunComplete(status string) {
+	a.events.publish(Event{Type: EventRunComplete, Status: status})
+	a.events.close()
+}
+
+// resultEvent is the event sent when result is received.
+func resultEvent(result *plugin.Result) Event {
+	event := Event{
+		Type:   EventResultReceived,
+		Plugin: result.ResultType,
+		Node:   result.NodeName,
+	}
+	if result.Error != "" {
+		event.Type = EventPluginFailed
+		event.Error = result.Error
+	}
+	return event
+}
+
+// EventsHandler returns a handler streaming the run's events as server-sent
+// events, starting after the one in the Last-Event-ID header or the since
+// query parameter, if either is set. The stream ends once the run is
+// complete, or straight away with follow=false, after the events so far.
+func (a *Aggregator) EventsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since := r.Header.Get("Last-Event-ID")
+		if since == "" {
+			since = r.URL.Query().Get("since")
+		}
+		var after int64
+		if since != "" {
+			var err error
+			after, err = strconv.ParseInt(since, 10, 64)
+			if err != nil || after < 0 {
+				http.Error(w, fmt.Sprintf("invalid event ID %q", since), http.StatusBadRequest)
+				return
+			}
+		}
+		follow := r.URL.Query().Get("follow") != "false"
+
+		past, ch := a.events.subscribe(after)
+		if ch != nil {
+			defer a.events.unsubscribe(ch)
+		}
+
+		w.Header().Set("content-type", "text/event-stream")
+		w.Header().Set("cache-control", "no-cache")
+		flusher, _ := w.(http.Flusher)
+		flush := func() {
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		for _, event := range past {
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+		flush()
+		if !follow || ch == nil {
+			return
+		}
+
+		keepAlive := time.NewTicker(eventKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case event, ok := <-ch:
+				if !ok {
+					return
+				}
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			}
+			flush()
+		}
+	})
+}
+
+// writeEvent writes an event in the server-sent events format.
+func writeEvent(w http.ResponseWriter, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// ReadEvents reads a stream written by EventsHandler, calling handle with
+// each event in it until the stream ends or handle returns an error.
+func ReadEvents(r io.Reader, handle func(Event) error) error {
+	scanner := bufio.NewScanner(r)
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		switch {
+		case len(line) == 0:
+			// A blank line ends an event.
+			if data.Len() == 0 {
+				continue
+			}
+			event := Event{}
+			if err := json.Unmarshal(data.Bytes(), &event); err != nil {
+				return errors.Wrap(err, "couldn't decode event")
+			}
+			data.Reset()
+			if err := handle(event); err != nil {
+				return err
+			}
+		case bytes.HasPrefix(line, []byte("data:")):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.Write(bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" ")))
+		}
+		// The id and event fields are repeated in the data, and comments
+		// are only to keep the stream open.
+	}
+	return errors.Wrap(scanner.Err(), "couldn't read events")
+}
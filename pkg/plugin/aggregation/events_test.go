@@ -0,0 +1,123 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"bufio"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	pluginutils "github.com/heptio/sonobuoy/pkg/plugin/driver/utils"
+)
+
+func TestEventsHandler(t *testing.T) {
+	agg := NewAggregator("", []plugin.ExpectedResult{
+		{ResultType: "e2e"},
+		{ResultType: "systemd_logs", NodeName: "node1"},
+	})
+	agg.PluginLaunched("e2e")
+	agg.events.publish(resultEvent(&plugin.Result{ResultType: "e2e"}))
+
+	srv := httptest.NewServer(agg.EventsHandler())
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + EventsPath + "?since=1")
+	if err != nil {
+		t.Fatalf("couldn't get events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("content-type"); ct != "text/event-stream" {
+		t.Errorf("expected an event stream, got %q", ct)
+	}
+
+	// Events published after the stream started follow those before it,
+	// until the run is complete.
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != "id: 2\n" {
+		t.Fatalf("expected the stream to start after the first event, got %q: %v", line, err)
+	}
+	agg.events.publish(resultEvent(pluginutils.MakeErrorResult("systemd_logs", map[string]interface{}{"error": "foo"}, "node1")))
+	agg.RunComplete(FailedStatus)
+
+	var events []Event
+	err = ReadEvents(reader, func(event Event) error {
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("couldn't read events: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %+v", events)
+	}
+	if e := events[0]; e.ID != 2 || e.Type != EventResultReceived || e.Plugin != "e2e" {
+		t.Errorf("unexpected result-received event %+v", e)
+	}
+	if e := events[1]; e.ID != 3 || e.Type != EventPluginFailed || e.Plugin != "systemd_logs" || e.Node != "node1" || !strings.Contains(e.Error, "foo") {
+		t.Errorf("unexpected plugin-failed event %+v", e)
+	}
+	if e := events[2]; e.ID != 4 || e.Type != EventRunComplete || e.Status != FailedStatus {
+		t.Errorf("unexpected run-complete event %+v", e)
+	}
+
+	// Once the run is complete, streams end after the events so far.
+	rec := httptest.NewRecorder()
+	agg.EventsHandler().ServeHTTP(rec, httptest.NewRequest("GET", EventsPath, nil))
+	events = nil
+	if err := ReadEvents(rec.Body, func(event Event) error {
+		events = append(events, event)
+		return nil
+	}); err != nil {
+		t.Fatalf("couldn't read events: %v", err)
+	}
+	expected := []EventType{EventPluginStarted, EventResultReceived, EventPluginFailed, EventRunComplete}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %v events, got %+v", len(expected), events)
+	}
+	for i, e := range events {
+		if e.Type != expected[i] {
+			t.Errorf("expected event %v to be %v, got %v", i, expected[i], e.Type)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	agg.EventsHandler().ServeHTTP(rec, httptest.NewRequest("GET", EventsPath+"?since=x", nil))
+	if rec.Code != 400 {
+		t.Errorf("expected an invalid event ID to be rejected, got %v", rec.Code)
+	}
+}
+
+func TestEventBroker_slowSubscriber(t *testing.T) {
+	b := newEventBroker()
+	_, ch := b.subscribe(0)
+	for i := 0; i < eventBufferSize+1; i++ {
+		b.publish(Event{Type: EventResultReceived})
+	}
+
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != eventBufferSize {
+		t.Errorf("expected a subscriber to be dropped after %v events, got %v", eventBufferSize, n)
+	}
+	if len(b.history) != eventBufferSize+1 {
+		t.Errorf("expected every event to be kept, got %v", len(b.history))
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	// JUnitFormat is the result format of plugins whose results include
+	// JUnit XML reports, all of which must be valid.
+	JUnitFormat = "junit"
+	// JSONFormat is the result format of plugins whose results include JSON
+	// files, all of which must be well-formed.
+	JSONFormat = "json"
+)
+
+// ResultFormat checks that a plugin's results are in the format it declares in
+// its result-format, so that malformed results are rejected when they're
+// submitted rather than breaking whatever reads the results tarball. Sonobuoy's
+// own formats are junit and json; others can be compiled into a custom build
+// of Sonobuoy and registered with RegisterResultFormat.
+type ResultFormat interface {
+	// Name is what plugins call the format in their result-format.
+	Name() string
+	// Validate is given a result and the file or directory it was stored
+	// in, and returns everything that's wrong with it, if anything.
+	Validate(result *plugin.Result, resultPath string) ([]string, error)
+}
+
+// InvalidResultError is returned when a result isn't valid in its plugin's
+// result format. It's sent to the worker as the JSON body of a 400 response.
+type InvalidResultError struct {
+	Plugin string `json:"plugin"`
+	Node   string `json:"node,omitempty"`
+	Format string `json:"format"`
+	// Problems lists what's wrong with the result, each naming the file it's
+	// about, if any.
+	Problems []string `json:"problems"`
+}
+
+func (e *InvalidResultError) Error() string {
+	result := e.Plugin
+	if e.Node != "" {
+		result += " on node " + e.Node
+	}
+	return fmt.Sprintf("result for plugin %v isn't valid %v, as the plugin's result-format says it should be: %v",
+		result, e.Format, strings.Join(e.Problems, "; "))
+}
+
+var (
+	formatsMutex sync.Mutex
+	formats      = map[string]ResultFormat{}
+)
+
+func init() {
+	RegisterResultFormat(junitFormat{})
+	RegisterResultFormat(jsonFormat{})
+}
+
+// RegisterResultFormat makes a format available to plugins. It's meant to be
+// called from the init function of the package the format is defined in, and
+// panics if a format with the same name has already been registered.
+func RegisterResultFormat(f ResultFormat) {
+	formatsMutex.Lock()
+	defer formatsMutex.Unlock()
+
+	if _, ok := formats[f.Name()]; ok {
+		panic(fmt.Sprintf("result format %v registered twice", f.Name()))
+	}
+	formats[f.Name()] = f
+}
+
+// pluginResultFormats returns the format each plugin declared, by result type.
+func pluginResultFormats(plugins []plugin.Interface) (map[string]ResultFormat, error) {
+	formatsMutex.Lock()
+	defer formatsMutex.Unlock()
+
+	byResultType := map[string]ResultFormat{}
+	for _, p := range plugins {
+		name := p.GetResultFormat()
+		if name == "" {
+			continue
+		}
+		format, ok := formats[name]
+		if !ok {
+			return nil, errors.Errorf("plugin %v has unknown result format %q", p.GetName(), name)
+		}
+		byResultType[p.GetResultType()] = format
+	}
+	return byResultType, nil
+}
+
+// validateResult checks that a stored result is valid in its plugin's format.
+// An invalid result is removed, so it doesn't end up in the results tarball,
+// and fails with an InvalidResultError.
+func (a *Aggregator) validateResult(result *plugin.Result) error {
+	format := a.Formats[result.ResultType]
+	if format == nil {
+		return nil
+	}
+
+	resultPath := path.Join(a.OutputDir, result.Path())
+	problems, err := format.Validate(result, resultPath)
+	if err != nil {
+		// The result couldn't be checked, which isn't the plugin's fault.
+		errlog.LogError(errors.Wrapf(err, "couldn't validate result %v", result.ExpectedResultID()))
+		return nil
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	invalid := &InvalidResultError{
+		Plugin:   result.ResultType,
+		Node:     result.NodeName,
+		Format:   format.Name(),
+		Problems: problems,
+	}
+	if err := os.RemoveAll(resultPath); err != nil {
+		errlog.LogError(errors.Wrapf(err, "couldn't remove invalid result %v", result.ExpectedResultID()))
+	}
+	result.Error = invalid.Error()
+	result.FailureReason = plugin.FailureInvalidResult
+	return invalid
+}
+
+type junitFormat struct{}
+
+func (junitFormat) Name() string { return JUnitFormat }
+
+func (junitFormat) Validate(result *plugin.Result, resultPath string) ([]string, error) {
+	var problems []string
+	reports := 0
+	err := walkResult(resultPath, func(file string) error {
+		if resultFileExt(result, resultPath, file) != ".xml" {
+			return nil
+		}
+		reports++
+		name := relPath(resultPath, file)
+		suites, err := readJUnitFile(file)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%v: %v", name, errors.Cause(err)))
+			return nil
+		}
+		for _, suite := range suites {
+			for i, tc := range suite.TestCases {
+				if tc.Name == "" {
+					problems = append(problems, fmt.Sprintf("%v: test case %v of suite %q has no name", name, i+1, suite.Name))
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read result files")
+	}
+	if reports == 0 {
+		problems = append(problems, "there are no JUnit XML (.xml) files")
+	}
+	return problems, nil
+}
+
+type jsonFormat struct{}
+
+func (jsonFormat) Name() string { return JSONFormat }
+
+func (jsonFormat) Validate(result *plugin.Result, resultPath string) ([]string, error) {
+	var problems []string
+	documents := 0
+	err := walkResult(resultPath, func(file string) error {
+		if resultFileExt(result, resultPath, file) != ".json" {
+			return nil
+		}
+		documents++
+		name := relPath(resultPath, file)
+
+		f, err := os.Open(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer f.Close()
+		if info, err := f.Stat(); err == nil && info.Size() == 0 {
+			problems = append(problems, fmt.Sprintf("%v: is empty", name))
+		} else if err := checkJSON(f); err != nil {
+			problems = append(problems, fmt.Sprintf("%v: %v", name, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read result files")
+	}
+	if documents == 0 {
+		problems = append(problems, "there are no JSON (.json) files")
+	}
+	return problems, nil
+}
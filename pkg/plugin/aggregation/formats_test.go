@@ -0,0 +1,137 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/job"
+)
+
+func TestResultFormats(t *testing.T) {
+	testCases := []struct {
+		name     string
+		format   ResultFormat
+		files    map[string]string
+		expected []string
+	}{
+		{
+			name:   "junit",
+			format: junitFormat{},
+			files: map[string]string{
+				"e2e.log":       "not XML",
+				"junit_01.xml":  junitXML,
+				"junit_02.xml":  `<testsuites><testsuite name="more"><testcase name="passes"/></testsuite></testsuites>`,
+				"notes/doc.txt": "ignored",
+			},
+		},
+		{
+			name:   "invalid junit",
+			format: junitFormat{},
+			files: map[string]string{
+				"html.xml":     "<html></html>",
+				"junit_01.xml": `<testsuite name="conformance"><testcase></testcase></testsuite>`,
+				"broken.xml":   "<testsuite",
+			},
+			expected: []string{
+				"broken.xml: XML syntax error on line 1: unexpected EOF",
+				"html.xml: root element html isn't a JUnit test suite",
+				`junit_01.xml: test case 1 of suite "conformance" has no name`,
+			},
+		},
+		{
+			name:     "no junit",
+			format:   junitFormat{},
+			files:    map[string]string{"e2e.log": "passed"},
+			expected: []string{"there are no JUnit XML (.xml) files"},
+		},
+		{
+			name:   "json",
+			format: jsonFormat{},
+			files:  map[string]string{"latency.json": `{"latency": 5}`, "log.txt": "ignored"},
+		},
+		{
+			name:   "invalid json",
+			format: jsonFormat{},
+			files:  map[string]string{"empty.json": "", "latency.json": `{"latency": `},
+			expected: []string{
+				"empty.json: is empty",
+				"latency.json: unexpected EOF",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "sonobuoy_formats")
+			if err != nil {
+				t.Fatalf("couldn't create temp dir: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			writeFiles(t, dir, tc.files)
+
+			problems, err := tc.format.Validate(&plugin.Result{}, dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(problems, tc.expected) {
+				t.Errorf("expected problems %q, got %q", tc.expected, problems)
+			}
+		})
+	}
+}
+
+func TestResultFormats_singleFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy_formats")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A result that's a single file is stored without an extension, so its
+	// MIME type says what it is.
+	file := filepath.Join(dir, "node1")
+	if err := ioutil.WriteFile(file, []byte(junitXML), 0644); err != nil {
+		t.Fatalf("couldn't write result: %v", err)
+	}
+	problems, err := junitFormat{}.Validate(&plugin.Result{MimeType: "application/xml"}, file)
+	if err != nil || len(problems) > 0 {
+		t.Errorf("expected the result to be valid, got %q (%v)", problems, err)
+	}
+}
+
+func TestPluginResultFormats(t *testing.T) {
+	e2e := job.NewPlugin(plugin.Definition{Name: "e2e", ResultType: "e2e", ResultFormat: JUnitFormat}, "", "", "Always")
+	other := job.NewPlugin(plugin.Definition{Name: "other", ResultType: "other"}, "", "", "Always")
+	byResultType, err := pluginResultFormats([]plugin.Interface{e2e, other})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(byResultType, map[string]ResultFormat{"e2e": junitFormat{}}) {
+		t.Errorf("expected only e2e to have a format, got %v", byResultType)
+	}
+
+	unknown := job.NewPlugin(plugin.Definition{Name: "e2e", ResultType: "e2e", ResultFormat: "nope"}, "", "", "Always")
+	if _, err := pluginResultFormats([]plugin.Interface{unknown}); err == nil {
+		t.Error("expected an error for an unknown result format")
+	}
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation/resultspb"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	// Registers the gzip compressor workers may send results with.
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+//go:generate protoc --go_out=plugins=grpc:. resultspb/results.proto
+
+// errResultHandled is what a worker's further chunks are refused with once
+// the aggregator has finished with their result, e.g. by rejecting it.
+var errResultHandled = errors.New("result already handled")
+
+// resultsServer implements the Results gRPC service by passing what it
+// receives to the same callbacks as the HTTP endpoints, so results are handled
+// identically whichever way they're sent. Since it's served alongside them,
+// it checks the client certificate and results token itself.
+type resultsServer struct {
+	handler *Handler
+	tokens  *pluginTokens
+}
+
+// NewGRPCServer returns a gRPC server for the Results service that hands
+// results and progress to the handler's callbacks. Only results for the plugin
+// the client's certificate was issued to are accepted, with that plugin's
+// token if tokens is given.
+func NewGRPCServer(handler *Handler, tokens *pluginTokens) *grpc.Server {
+	srv := grpc.NewServer()
+	resultspb.RegisterResultsServer(srv, &resultsServer{handler: handler, tokens: tokens})
+	return srv
+}
+
+// WithGRPC serves gRPC requests with grpcServer, and everything else with
+// handler, so both can share a port.
+func WithGRPC(grpcServer *grpc.Server, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("content-type"), "application/grpc") {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Submit receives a plugin's progress and, unless the stream only relays
+// progress, a result.
+func (s *resultsServer) Submit(stream resultspb.Results_SubmitServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	header := req.GetHeader()
+	if header == nil {
+		return status.Error(codes.InvalidArgument, "the first request must be a header")
+	}
+	if err := s.authorize(stream.Context(), header.Plugin); err != nil {
+		return err
+	}
+
+	var version string
+	if md, ok := metadata.FromIncomingContext(stream.Context()); ok && len(md[WorkerVersionHeader]) > 0 {
+		version = md[WorkerVersionHeader][0]
+	}
+
+	var upload *grpcUpload
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			if upload != nil {
+				upload.writer.CloseWithError(errors.New("stream ended before the result was done"))
+				upload.wait()
+				return status.Error(codes.Aborted, "stream ended before the result was done")
+			}
+			return nil
+		}
+		if err != nil {
+			if upload != nil {
+				upload.writer.CloseWithError(err)
+				upload.wait()
+			}
+			return err
+		}
+
+		switch r := req.Request.(type) {
+		case *resultspb.SubmitRequest_Progress:
+			if err := s.progress(header, r.Progress); err != nil {
+				return err
+			}
+		case *resultspb.SubmitRequest_Chunk:
+			if upload == nil {
+				upload = s.startUpload(header, version)
+			}
+			if _, err := upload.writer.Write(r.Chunk.Data); err != nil {
+				// The result was handled without reading all of it.
+				return upload.wait()
+			}
+		case *resultspb.SubmitRequest_Done:
+			if upload == nil {
+				upload = s.startUpload(header, version)
+			}
+			upload.checksum = r.Done.Sha256
+			upload.writer.Close()
+			if err := upload.wait(); err != nil {
+				return err
+			}
+			return stream.Send(&resultspb.SubmitResponse{Stored: true})
+		default:
+			return status.Error(codes.InvalidArgument, "a stream can only have one header")
+		}
+	}
+}
+
+// authorize checks that the client's certificate was issued for the plugin,
+// and that it sent the plugin's results token.
+func (s *resultsServer) authorize(ctx context.Context, pluginName string) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "no client certificate")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.PeerCertificates) == 0 || tlsInfo.State.PeerCertificates[0].Subject.CommonName != pluginName {
+		logrus.WithField("plugin_name", pluginName).Warning("rejected gRPC stream without a client certificate for the plugin")
+		return status.Errorf(codes.PermissionDenied, "Client certificate not valid for plugin %v", pluginName)
+	}
+
+	if s.tokens == nil {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var auth string
+	if values := md[AuthorizationHeader]; len(values) > 0 {
+		auth = values[0]
+	}
+	if !strings.HasPrefix(auth, bearerPrefix) || !s.tokens.valid(pluginName, strings.TrimPrefix(auth, bearerPrefix)) {
+		logrus.WithField("plugin_name", pluginName).Warning("rejected gRPC stream without a valid token for the plugin")
+		return status.Errorf(codes.Unauthenticated, "Results token not valid for plugin %v", pluginName)
+	}
+	return nil
+}
+
+func (s *resultsServer) progress(header *resultspb.Header, progress *resultspb.Progress) error {
+	update := &ProgressUpdate{
+		Plugin:    header.Plugin,
+		Node:      header.Node,
+		Completed: int(progress.Completed),
+		Total:     int(progress.Total),
+		Message:   progress.Message,
+	}
+	rec := newStatusRecorder()
+	s.handler.ProgressCallback(update, rec)
+	return rec.err()
+}
+
+// grpcUpload is a result being received over a stream. Its chunks are piped
+// to the results callback as they arrive, so it's never held in memory.
+type grpcUpload struct {
+	writer *io.PipeWriter
+	// checksum is set by the done request, before the writer is closed.
+	checksum string
+	done     chan error
+}
+
+func (s *resultsServer) startUpload(header *resultspb.Header, version string) *grpcUpload {
+	reader, writer := io.Pipe()
+	upload := &grpcUpload{writer: writer, done: make(chan error, 1)}
+
+	result := newResult(header.Plugin, header.Node, reader, func() string {
+		return upload.checksum
+	})
+	result.MimeType = header.MimeType
+	result.Filename = cleanFilename(header.Filename)
+	result.Partial = header.Partial
+	result.Incomplete = header.Incomplete
+	result.WorkerVersion = version
+	if header.TimedOut {
+		result.TimedOut = true
+		result.Error = timedOutError
+	}
+
+	go func() {
+		rec := newStatusRecorder()
+		s.handler.ResultsCallback(result, rec)
+		// Anything the callback didn't read is refused.
+		reader.CloseWithError(errResultHandled)
+		upload.done <- rec.err()
+	}()
+	return upload
+}
+
+// wait returns how the result was handled.
+func (u *grpcUpload) wait() error {
+	return <-u.done
+}
+
+// statusRecorder is the http.ResponseWriter the callbacks are given for
+// gRPC requests, so their responses can be turned into gRPC statuses.
+type statusRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func newStatusRecorder() *statusRecorder {
+	return &statusRecorder{header: http.Header{}, code: http.StatusOK}
+}
+
+func (r *statusRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+}
+
+// err returns the gRPC status for the response, or nil if it was successful.
+func (r *statusRecorder) err() error {
+	if r.code == http.StatusOK {
+		return nil
+	}
+	msg := strings.TrimSpace(r.body.String())
+	if msg == "" {
+		msg = fmt.Sprintf("got a %v response", r.code)
+	}
+	return status.Error(grpcCode(r.code), msg)
+}
+
+// grpcCode returns the gRPC code equivalent to an HTTP status code returned by
+// the callbacks, so that workers can retry the same failures either way.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		// The status message is the InvalidResultError as JSON, just like
+		// the HTTP response body.
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusConflict:
+		// The status message is the VersionMismatchError as JSON, if the
+		// worker's version was the conflict, just like the HTTP response
+		// body.
+		return codes.AlreadyExists
+	case http.StatusRequestEntityTooLarge:
+		// The status message is the ResultTooLargeError as JSON, just like
+		// the HTTP response body.
+		return codes.FailedPrecondition
+	case http.StatusUnprocessableEntity:
+		return codes.DataLoss
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusInsufficientStorage:
+		// The status message is the InsufficientStorageError as JSON, just
+		// like the HTTP response body.
+		return codes.ResourceExhausted
+	default:
+		if httpStatus >= http.StatusInternalServerError {
+			return codes.Internal
+		}
+		return codes.InvalidArgument
+	}
+}
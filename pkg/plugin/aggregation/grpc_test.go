@@ -0,0 +1,201 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/backplane/ca/authtest"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation/resultspb"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// submitGRPC sends a result's header and chunks to the results server,
+// followed by the given checksum, as the named client.
+func submitGRPC(t *testing.T, srv *authtest.Server, clientName, token string, header *resultspb.Header, chunks []string, checksum string) error {
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("couldn't parse server URL: %v", err)
+	}
+	tlsCfg := srv.ClientWithName(clientName).Transport.(*http.Transport).TLSClientConfig
+	conn, err := grpc.Dial(u.Host, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
+	if err != nil {
+		t.Fatalf("couldn't connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, AuthorizationHeader, BearerToken(token))
+	}
+	stream, err := resultspb.NewResultsClient(conn).Submit(ctx)
+	if err != nil {
+		return err
+	}
+	requests := []*resultspb.SubmitRequest{{Request: &resultspb.SubmitRequest_Header{Header: header}}}
+	for _, chunk := range chunks {
+		requests = append(requests, &resultspb.SubmitRequest{Request: &resultspb.SubmitRequest_Chunk{Chunk: &resultspb.Chunk{Data: []byte(chunk)}}})
+	}
+	requests = append(requests, &resultspb.SubmitRequest{Request: &resultspb.SubmitRequest_Done{Done: &resultspb.Done{Sha256: checksum}}})
+	for _, req := range requests {
+		if err := stream.Send(req); err != nil {
+			// The server ended the stream; its status comes from Recv.
+			break
+		}
+	}
+	stream.CloseSend()
+	resp, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if !resp.Stored {
+		t.Errorf("expected the result to be stored")
+	}
+	return nil
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestResultsServer(t *testing.T) {
+	tokens := newPluginTokens(nil)
+	token, err := tokens.issue("e2e")
+	if err != nil {
+		t.Fatalf("unexpected error issuing token: %v", err)
+	}
+
+	var received []string
+	h := NewHandler(func(result *plugin.Result, w http.ResponseWriter) {
+		body, err := ioutil.ReadAll(result.Body)
+		if err == nil {
+			err = result.Verify()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if result.Filename == "secret" {
+			http.Error(w, "already received", http.StatusConflict)
+			return
+		}
+		received = append(received, result.ExpectedResultID()+": "+string(body))
+	}, func(update *ProgressUpdate, w http.ResponseWriter) {}, func(result plugin.ExpectedResult, w http.ResponseWriter) {})
+
+	srv := authtest.NewTLSServer(WithGRPC(NewGRPCServer(h, tokens), h), t)
+	defer srv.Close()
+
+	results := []string{"first ", "second"}
+	testCases := []struct {
+		name     string
+		client   string
+		token    string
+		header   *resultspb.Header
+		checksum string
+		expected codes.Code
+	}{
+		{name: "valid", client: "e2e", token: token, header: &resultspb.Header{Plugin: "e2e"}, checksum: sha256Hex("first second"), expected: codes.OK},
+		{name: "other plugin's certificate", client: "systemd_logs", token: token, header: &resultspb.Header{Plugin: "e2e"}, checksum: sha256Hex("first second"), expected: codes.PermissionDenied},
+		{name: "no token", client: "e2e", header: &resultspb.Header{Plugin: "e2e"}, checksum: sha256Hex("first second"), expected: codes.Unauthenticated},
+		{name: "wrong token", client: "e2e", token: "not-the-token", header: &resultspb.Header{Plugin: "e2e"}, checksum: sha256Hex("first second"), expected: codes.Unauthenticated},
+		{name: "checksum mismatch", client: "e2e", token: token, header: &resultspb.Header{Plugin: "e2e"}, checksum: sha256Hex("something else"), expected: codes.DataLoss},
+		{name: "rejected", client: "e2e", token: token, header: &resultspb.Header{Plugin: "e2e", Filename: "../secret"}, checksum: sha256Hex("first second"), expected: codes.AlreadyExists},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			received = nil
+			err := submitGRPC(t, srv, tc.client, tc.token, tc.header, results, tc.checksum)
+			if code := status.Code(err); code != tc.expected {
+				t.Fatalf("expected %v, got %v (%v)", tc.expected, code, err)
+			}
+			if tc.expected != codes.OK {
+				return
+			}
+			if len(received) != 1 || received[0] != "e2e: first second" {
+				t.Errorf("expected the result to be received, got %v", received)
+			}
+		})
+	}
+}
+
+func TestResultsServer_progress(t *testing.T) {
+	updates := make(chan *ProgressUpdate, 1)
+	h := NewHandler(func(result *plugin.Result, w http.ResponseWriter) {}, func(update *ProgressUpdate, w http.ResponseWriter) {
+		updates <- update
+	}, func(result plugin.ExpectedResult, w http.ResponseWriter) {})
+
+	srv := authtest.NewTLSServer(WithGRPC(NewGRPCServer(h, nil), h), t)
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	tlsCfg := srv.ClientWithName("e2e").Transport.(*http.Transport).TLSClientConfig
+	conn, err := grpc.Dial(u.Host, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
+	if err != nil {
+		t.Fatalf("couldn't connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	stream, err := resultspb.NewResultsClient(conn).Submit(context.Background())
+	if err != nil {
+		t.Fatalf("couldn't start stream: %v", err)
+	}
+	stream.Send(&resultspb.SubmitRequest{Request: &resultspb.SubmitRequest_Header{Header: &resultspb.Header{Plugin: "e2e", Node: "node1"}}})
+	stream.Send(&resultspb.SubmitRequest{Request: &resultspb.SubmitRequest_Progress{Progress: &resultspb.Progress{Completed: 3, Total: 4}}})
+	stream.CloseSend()
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatalf("expected the stream to end cleanly, got %v", err)
+	}
+
+	update := <-updates
+	if update.Plugin != "e2e" || update.Node != "node1" || update.Completed != 3 || update.Total != 4 {
+		t.Errorf("unexpected progress update %+v", update)
+	}
+}
+
+func TestGRPCCode(t *testing.T) {
+	testCases := []struct {
+		status   int
+		expected codes.Code
+	}{
+		{status: http.StatusBadRequest, expected: codes.InvalidArgument},
+		{status: http.StatusForbidden, expected: codes.PermissionDenied},
+		{status: http.StatusConflict, expected: codes.AlreadyExists},
+		{status: http.StatusRequestEntityTooLarge, expected: codes.FailedPrecondition},
+		{status: http.StatusUnprocessableEntity, expected: codes.DataLoss},
+		{status: http.StatusServiceUnavailable, expected: codes.Unavailable},
+		{status: http.StatusInternalServerError, expected: codes.Internal},
+	}
+	for _, tc := range testCases {
+		if code := grpcCode(tc.status); code != tc.expected {
+			t.Errorf("expected %v for a %v response, got %v", tc.expected, tc.status, code)
+		}
+	}
+}
@@ -17,11 +17,22 @@ limitations under the License.
 package aggregation
 
 import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
+	"path"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/tracing"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -35,6 +46,43 @@ const (
 	resultsByNode = "/api/v1/results/by-node/{node}/{plugin}"
 	// resultsGlobal is the path for global (non node-specific) results to be PUT
 	resultsGlobal = "/api/v1/results/global/{plugin}"
+	// progressByNode is the path for node-specific progress updates to be PUT
+	progressByNode = "/api/v1/progress/by-node/{node}/{plugin}"
+	// progressGlobal is the path for global progress updates to be PUT
+	progressGlobal = "/api/v1/progress/global/{plugin}"
+	// heartbeatByNode is the path for node-specific heartbeats to be POSTed
+	heartbeatByNode = "/api/v1/heartbeat/by-node/{node}/{plugin}"
+	// heartbeatGlobal is the path for global heartbeats to be POSTed
+	heartbeatGlobal = "/api/v1/heartbeat/global/{plugin}"
+)
+
+const (
+	// ContentDispositionHeader carries the filename of a result when a
+	// plugin submits several files for a single result.
+	ContentDispositionHeader = "content-disposition"
+	// PartialResultHeader is set to "true" on every file of a multi-file
+	// result except the last, which completes the result.
+	PartialResultHeader = "sonobuoy-partial-result"
+	// ContentEncodingHeader is set to "gzip" when a worker has compressed a
+	// result for transmission. Results are stored uncompressed.
+	ContentEncodingHeader = "content-encoding"
+	// ChecksumHeader carries the hex-encoded SHA256 of a result, as stored.
+	// Since workers may not know it until they've sent the whole result, it
+	// can be sent as a trailer instead of a header.
+	ChecksumHeader = "sonobuoy-checksum-sha256"
+	// TimedOutHeader is set to "true" by a worker reporting that its plugin
+	// didn't finish in time, in place of its results.
+	TimedOutHeader = "sonobuoy-timed-out"
+	// IncompleteResultHeader is set to "true" by a worker sending whatever
+	// results its plugin had when the run was about to time out.
+	IncompleteResultHeader = "sonobuoy-incomplete-result"
+	// FlushResultsHeader is set to "true" on the response to a heartbeat when
+	// the run is about to time out, asking the worker to send whatever
+	// results its plugin has so far.
+	FlushResultsHeader = "sonobuoy-flush-results"
+	// WorkerVersionHeader carries the version of Sonobuoy a worker was built
+	// from, with each result it submits. It's also sent as gRPC metadata.
+	WorkerVersionHeader = "sonobuoy-version"
 )
 
 var (
@@ -50,39 +98,199 @@ type Handler struct {
 	mux.Router
 	// ResultsCallback is the function that is called when a result is checked in.
 	ResultsCallback func(*plugin.Result, http.ResponseWriter)
+	// ProgressCallback is the function that is called when a plugin reports
+	// its progress.
+	ProgressCallback func(*ProgressUpdate, http.ResponseWriter)
+	// HeartbeatCallback is the function that is called when a worker sends a
+	// heartbeat for the result it's waiting on.
+	HeartbeatCallback func(plugin.ExpectedResult, http.ResponseWriter)
 }
 
-// NewHandler constructs a new aggregation handler which will handler results
-// and pass them to the given results callback.
-func NewHandler(resultsCallback func(*plugin.Result, http.ResponseWriter)) http.Handler {
+// NewHandler constructs a new aggregation handler which will handler results,
+// progress updates and heartbeats and pass them to the given callbacks.
+func NewHandler(resultsCallback func(*plugin.Result, http.ResponseWriter), progressCallback func(*ProgressUpdate, http.ResponseWriter), heartbeatCallback func(plugin.ExpectedResult, http.ResponseWriter)) *Handler {
 	handler := &Handler{
-		Router:          *mux.NewRouter(),
-		ResultsCallback: resultsCallback,
+		Router:            *mux.NewRouter(),
+		ResultsCallback:   resultsCallback,
+		ProgressCallback:  progressCallback,
+		HeartbeatCallback: heartbeatCallback,
 	}
 	// We accept PUT because the client is specifying the resource identifier via
 	// the HTTP path. (As opposed to POST, where typically the clients would post
 	// to a base URL and the server picks the final resource path.)
 	handler.HandleFunc(resultsByNode, handler.resultsHandler).Methods("PUT")
 	handler.HandleFunc(resultsGlobal, handler.resultsHandler).Methods("PUT")
+	handler.HandleFunc(progressByNode, handler.progressHandler).Methods("PUT")
+	handler.HandleFunc(progressGlobal, handler.progressHandler).Methods("PUT")
+	// Heartbeats are events rather than resources, so they're POSTed.
+	handler.HandleFunc(heartbeatByNode, handler.heartbeatHandler).Methods("POST")
+	handler.HandleFunc(heartbeatGlobal, handler.heartbeatHandler).Methods("POST")
 	return handler
 }
 
+// RequirePluginCert is middleware for a Handler that only lets through
+// requests made with a client certificate issued for the plugin (i.e. the
+// result type) in the request path. Any client the server trusts could
+// otherwise submit, or forge, results for any plugin. Requests to read results
+// are also let through with the results reader's certificate.
+func RequirePluginCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pluginName := mux.Vars(r)["plugin"]
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 || !certAllowed(r.TLS.PeerCertificates[0].Subject.CommonName, pluginName, r) {
+			logrus.WithField("plugin_name", pluginName).Warning("rejected request without a client certificate for the plugin")
+			http.Error(
+				w,
+				fmt.Sprintf("Client certificate not valid for plugin %v", pluginName),
+				http.StatusForbidden,
+			)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// certAllowed reports whether a client certificate with the given common name
+// may make a request about a plugin.
+func certAllowed(commonName, pluginName string, r *http.Request) bool {
+	if commonName == ResultsReaderName && isResultsRead(r) {
+		return true
+	}
+	return pluginName != "" && commonName == pluginName
+}
+
 func (h *Handler) resultsHandler(w http.ResponseWriter, r *http.Request) {
 	logRequest(r)
 	vars := mux.Vars(r)
+	defer r.Body.Close()
 
-	result := &plugin.Result{
-		ResultType: vars["plugin"], // will be empty string in global case
-		NodeName:   vars["node"],
-		Body:       r.Body,
-		MimeType:   r.Header.Get("content-type"),
+	var body io.Reader = r.Body
+	switch encoding := r.Header.Get(ContentEncodingHeader); encoding {
+	case "", "identity":
+	case "gzip":
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Couldn't decompress result: %v", err), http.StatusBadRequest)
+			return
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported content encoding %q", encoding), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	result := newResult(vars["plugin"], vars["node"], body, func() string {
+		// Trailers only arrive after the body.
+		if checksum := r.Header.Get(ChecksumHeader); checksum != "" {
+			return checksum
+		}
+		return r.Trailer.Get(ChecksumHeader)
+	})
+	result.MimeType = r.Header.Get("content-type")
+	result.Filename = resultFilename(r)
+	result.Partial = r.Header.Get(PartialResultHeader) == "true"
+	result.TraceParent = r.Header.Get(tracing.TraceparentHeader)
+	result.Incomplete = r.Header.Get(IncompleteResultHeader) == "true"
+	result.WorkerVersion = r.Header.Get(WorkerVersionHeader)
+	if r.Header.Get(TimedOutHeader) == "true" {
+		result.TimedOut = true
+		result.Error = timedOutError
 	}
 
 	// Trigger our callback with this checkin record (which should write the file
-	// out.) The callback is responsible for doing a 409 conflict if results are
-	// given twice for the same node, etc.
+	// out.) The callback is responsible for doing a 403 forbidden if results
+	// aren't expected, etc.
 	h.ResultsCallback(result, w)
+}
+
+// newResult returns a result for the given plugin (and node, unless it's a
+// global result) that reads its contents from body. Once they've been read,
+// Verify checks them against the checksum the worker sent, which it's given
+// by checksum, and Checksum returns theirs.
+func newResult(resultType, nodeName string, body io.Reader, checksum func() string) *plugin.Result {
+	hash := sha256.New()
+	body = io.TeeReader(body, hash)
+
+	return &plugin.Result{
+		ResultType: resultType, // will be empty string in global case
+		NodeName:   nodeName,
+		Body:       body,
+		Verify: func() error {
+			// Whatever handled the body may not have read all of it (the end of
+			// a tarball, say).
+			if _, err := io.Copy(ioutil.Discard, body); err != nil {
+				return errors.Wrap(err, "couldn't read result")
+			}
+			expected := checksum()
+			// Not every client sends a checksum, so there may be nothing to verify.
+			if expected == "" {
+				return nil
+			}
+			if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+				return &ChecksumMismatchError{Expected: expected, Actual: actual}
+			}
+			return nil
+		},
+		Checksum: func() string {
+			return hex.EncodeToString(hash.Sum(nil))
+		},
+	}
+}
+
+func (h *Handler) progressHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	defer r.Body.Close()
+
+	update := &ProgressUpdate{}
+	if err := json.NewDecoder(r.Body).Decode(update); err != nil {
+		http.Error(w, fmt.Sprintf("Couldn't decode progress update: %v", err), http.StatusBadRequest)
+		return
+	}
+	// The path, not the body, says who the update is from.
+	update.Plugin = vars["plugin"]
+	update.Node = vars["node"]
+
+	h.ProgressCallback(update, w)
+}
+
+func (h *Handler) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
 	r.Body.Close()
+
+	h.HeartbeatCallback(plugin.ExpectedResult{
+		ResultType: vars["plugin"],
+		NodeName:   vars["node"],
+	}, w)
+}
+
+// ChecksumMismatchError is returned when a result's contents don't match the
+// checksum the worker sent with it, meaning it was corrupted on the way.
+type ChecksumMismatchError struct {
+	Expected, Actual string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch: expected sha256 %v, got %v", e.Expected, e.Actual)
+}
+
+// resultFilename gets the filename the client wants a result stored as, if
+// any.
+func resultFilename(r *http.Request) string {
+	_, params, err := mime.ParseMediaType(r.Header.Get(ContentDispositionHeader))
+	if err != nil {
+		return ""
+	}
+	return cleanFilename(params["filename"])
+}
+
+// cleanFilename returns only the base name of a filename a client sent, so
+// clients can't write outside the result's directory.
+func cleanFilename(name string) string {
+	filename := path.Base(name)
+	if filename == "." || filename == "/" {
+		return ""
+	}
+	return filename
 }
 
 // NodeResultURL is the URL for results for a given node result. Takes the baseURL (http[s]://hostname:port/,
@@ -122,6 +330,18 @@ func GlobalResultURL(baseURL, pluginName string) (string, error) {
 
 }
 
+// ProgressURL is the URL that progress updates for a result are sent to,
+// given the URL for the result itself.
+func ProgressURL(resultURL string) string {
+	return strings.Replace(resultURL, "/api/v1/results/", "/api/v1/progress/", 1)
+}
+
+// HeartbeatURL is the URL that heartbeats for a result are sent to, given the
+// URL for the result itself.
+func HeartbeatURL(resultURL string) string {
+	return strings.Replace(resultURL, "/api/v1/results/", "/api/v1/heartbeat/", 1)
+}
+
 func logRequest(req *http.Request) {
 	vars := mux.Vars(req)
 	log := logrus.WithField("plugin_name", vars["plugin"])
@@ -44,7 +44,7 @@ func TestStart(t *testing.T) {
 	h := NewHandler(func(checkin *plugin.Result, w http.ResponseWriter) {
 		// Just take note of what we've received
 		checkins[checkin.Path()] = checkin
-	})
+	}, func(update *ProgressUpdate, w http.ResponseWriter) {}, func(result plugin.ExpectedResult, w http.ResponseWriter) {})
 
 	srv := authtest.NewTLSServer(h, t)
 	defer srv.Close()
@@ -116,6 +116,85 @@ func TestStart(t *testing.T) {
 	}
 }
 
+func TestRequirePluginCert(t *testing.T) {
+	h := NewHandler(func(checkin *plugin.Result, w http.ResponseWriter) {}, func(update *ProgressUpdate, w http.ResponseWriter) {}, func(result plugin.ExpectedResult, w http.ResponseWriter) {})
+	h.Use(RequirePluginCert)
+
+	srv := authtest.NewTLSServer(h, t)
+	defer srv.Close()
+
+	URL, err := GlobalResultURL(srv.URL, "e2e")
+	if err != nil {
+		t.Fatalf("error getting global result URL %v", err)
+	}
+
+	// Both clients are made up front, so each has to keep its own certificate.
+	other, own := srv.ClientWithName("systemd_logs"), srv.ClientWithName("e2e")
+
+	response := doRequest(t, other, "PUT", URL, []byte("{}"))
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected a 403 for results from another plugin's certificate, got %v", response.StatusCode)
+	}
+
+	response = doRequest(t, own, "PUT", URL, []byte("{}"))
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Expected a 200 for results with the plugin's certificate, got %v", response.StatusCode)
+	}
+
+	response = doRequest(t, other, "PUT", ProgressURL(URL), []byte("{}"))
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected a 403 for progress from another plugin's certificate, got %v", response.StatusCode)
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	tokens := newPluginTokens(nil)
+	token, err := tokens.issue("e2e")
+	if err != nil {
+		t.Fatalf("unexpected error issuing token: %v", err)
+	}
+	if again, _ := tokens.issue("e2e"); again != token {
+		t.Errorf("expected the same token for the same result type, got %v and %v", token, again)
+	}
+
+	h := NewHandler(func(checkin *plugin.Result, w http.ResponseWriter) {}, func(update *ProgressUpdate, w http.ResponseWriter) {}, func(result plugin.ExpectedResult, w http.ResponseWriter) {})
+	h.Use(tokens.requireToken)
+
+	srv := authtest.NewTLSServer(h, t)
+	defer srv.Close()
+
+	URL, err := GlobalResultURL(srv.URL, "e2e")
+	if err != nil {
+		t.Fatalf("error getting global result URL %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		url      string
+		auth     string
+		expected int
+	}{
+		{name: "no token", url: URL, expected: http.StatusUnauthorized},
+		{name: "wrong token", url: URL, auth: BearerToken("not-the-token"), expected: http.StatusUnauthorized},
+		{name: "not a bearer token", url: URL, auth: token, expected: http.StatusUnauthorized},
+		{name: "valid token", url: URL, auth: BearerToken(token), expected: http.StatusOK},
+		{name: "progress without token", url: ProgressURL(URL), expected: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			headers := http.Header{}
+			if tc.auth != "" {
+				headers.Set(AuthorizationHeader, tc.auth)
+			}
+			response := doRequestWithHeaders(t, srv.ClientWithName("e2e"), "PUT", tc.url, []byte("{}"), headers)
+			if response.StatusCode != tc.expected {
+				t.Errorf("Expected a %v, got %v", tc.expected, response.StatusCode)
+			}
+		})
+	}
+}
+
 func doRequestWithHeaders(t *testing.T, client *http.Client, method, reqURL string, body []byte, headers http.Header) *http.Response {
 	req, err := http.NewRequest(
 		method,
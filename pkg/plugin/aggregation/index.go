@@ -0,0 +1,204 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/pkg/errors"
+)
+
+// ResultsIndexPath is where the index of the plugin results is written, within
+// the results tarball.
+const ResultsIndexPath = "meta/results.json"
+
+// ResultsIndex describes every plugin's results in a results tarball, so that
+// tools reading it don't need to know how the tarball is laid out.
+type ResultsIndex struct {
+	// Status is the status of the run's plugins as a whole, as in Status.
+	Status  string        `json:"status"`
+	Plugins []PluginIndex `json:"plugins"`
+}
+
+// PluginIndex describes the results of a single plugin.
+type PluginIndex struct {
+	Plugin     string `json:"plugin"`
+	ResultType string `json:"resultType"`
+	// Status is the status of the plugin's results as a whole.
+	Status string `json:"status"`
+	// Items counts the plugin's expected results by status.
+	Items map[string]int `json:"items"`
+	// Results describes each of the plugin's expected results, one per node
+	// for plugins that run on every node.
+	Results []ResultIndex `json:"results"`
+}
+
+// ResultIndex describes a single result of a plugin.
+type ResultIndex struct {
+	Node   string `json:"node,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Reason is why the result failed, if it's one of the plugin.Failure
+	// reasons.
+	Reason string `json:"reason,omitempty"`
+	// Files are the paths of the result's files within the tarball, if it
+	// has any.
+	Files []string `json:"files,omitempty"`
+	// Processed is the metadata derived from the result by each of its
+	// plugin's result processors, by processor name.
+	Processed map[string]json.RawMessage `json:"processed,omitempty"`
+}
+
+// writeResultsIndex writes the index of the results in outdir, as of the
+// status u has.
+func writeResultsIndex(outdir string, plugins []plugin.Interface, u *updater) error {
+	names := make(map[string]string, len(plugins))
+	for _, p := range plugins {
+		names[p.GetResultType()] = p.GetName()
+	}
+
+	u.RLock()
+	index, err := buildResultsIndex(outdir, names, u.status)
+	u.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	blob, err := json.Marshal(index)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode results index")
+	}
+	indexFile := path.Join(outdir, ResultsIndexPath)
+	if err := os.MkdirAll(path.Dir(indexFile), 0755); err != nil {
+		return errors.Wrap(err, "couldn't create directory for results index")
+	}
+	return errors.Wrap(ioutil.WriteFile(indexFile, blob, 0644), "couldn't write results index")
+}
+
+// buildResultsIndex indexes the results in outdir of each plugin in status,
+// whose names are given by result type.
+func buildResultsIndex(outdir string, names map[string]string, status Status) (*ResultsIndex, error) {
+	index := &ResultsIndex{Status: status.Status, Plugins: []PluginIndex{}}
+	positions := map[string]int{}
+	for _, result := range status.Plugins {
+		i, ok := positions[result.Plugin]
+		if !ok {
+			i = len(index.Plugins)
+			positions[result.Plugin] = i
+			name := names[result.Plugin]
+			if name == "" {
+				name = result.Plugin
+			}
+			index.Plugins = append(index.Plugins, PluginIndex{
+				Plugin:     name,
+				ResultType: result.Plugin,
+				Items:      map[string]int{},
+			})
+		}
+
+		files, err := resultFiles(outdir, result.Plugin, result.Node)
+		if err != nil {
+			return nil, err
+		}
+		processed, err := readProcessed(outdir, result.Plugin, result.Node)
+		if err != nil {
+			return nil, err
+		}
+		p := &index.Plugins[i]
+		p.Items[result.Status]++
+		p.Results = append(p.Results, ResultIndex{
+			Node:      result.Node,
+			Status:    result.Status,
+			Error:     result.Error,
+			Reason:    result.Reason,
+			Files:     files,
+			Processed: processed,
+		})
+	}
+
+	for i := range index.Plugins {
+		p := &index.Plugins[i]
+		pluginStatus := Status{}
+		for _, result := range p.Results {
+			pluginStatus.Plugins = append(pluginStatus.Plugins, PluginStatus{Status: result.Status})
+		}
+		if err := pluginStatus.updateStatus(); err != nil {
+			return nil, err
+		}
+		p.Status = pluginStatus.Status
+	}
+	return index, nil
+}
+
+// resultFiles lists the files of a plugin's result for node, or of a global
+// plugin's result if it's empty, relative to outdir. Results and errors are
+// stored as either a file or a directory of files, and the failed tests the
+// junit-failures processor found in them in a directory of files.
+func resultFiles(outdir, resultType, node string) ([]string, error) {
+	var files []string
+	for _, dir := range []string{"results", "errors", "failures"} {
+		root := filepath.Join(outdir, "plugins", resultType, dir, node)
+		err := filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && file == root {
+					return nil
+				}
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(outdir, file)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't list files of %v", root)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// readProcessed reads what the result processors derived from a plugin's
+// result for node, or from a global plugin's result if it's empty, if they
+// were run on it.
+func readProcessed(outdir, resultType, node string) (map[string]json.RawMessage, error) {
+	processedFile := filepath.Join(outdir, "plugins", ProcessedPath(plugin.ExpectedResult{ResultType: resultType, NodeName: node}))
+	blob, err := ioutil.ReadFile(processedFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't read %v", processedFile)
+	}
+
+	var processed map[string]json.RawMessage
+	if err := json.Unmarshal(blob, &processed); err != nil {
+		return nil, errors.Wrapf(err, "couldn't decode %v", processedFile)
+	}
+	return processed, nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+func TestWriteResultsIndex(t *testing.T) {
+	outdir, err := ioutil.TempDir("", "sonobuoy_index_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(outdir)
+
+	for _, file := range []string{
+		"plugins/systemd_logs/results/node1",
+		"plugins/systemd_logs/errors/node2",
+		"plugins/e2e/results/e2e.log",
+		"plugins/e2e/results/junit_01.xml",
+		"plugins/e2e/failures/001-fails.txt",
+	} {
+		file = filepath.Join(outdir, file)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte("results"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u := newUpdater([]plugin.ExpectedResult{
+		{NodeName: "node1", ResultType: "systemd_logs"},
+		{NodeName: "node2", ResultType: "systemd_logs"},
+		{NodeName: "node3", ResultType: "systemd_logs"},
+		{ResultType: "e2e"},
+	}, "heptio-sonobuoy", nil)
+	u.ReceiveAll(map[string]*plugin.Result{
+		"systemd_logs/node1": {NodeName: "node1", ResultType: "systemd_logs"},
+		"systemd_logs/node2": {NodeName: "node2", ResultType: "systemd_logs", Error: "boom"},
+		"e2e":                {ResultType: "e2e"},
+	})
+	u.ReceiveErrors(map[plugin.ExpectedResult]string{{NodeName: "node2", ResultType: "systemd_logs"}: "boom"})
+
+	if err := writeResultsIndex(outdir, nil, u); err != nil {
+		t.Fatalf("unexpected error writing index: %v", err)
+	}
+	blob, err := ioutil.ReadFile(filepath.Join(outdir, ResultsIndexPath))
+	if err != nil {
+		t.Fatalf("expected the index to be written: %v", err)
+	}
+	index := ResultsIndex{}
+	if err := json.Unmarshal(blob, &index); err != nil {
+		t.Fatalf("couldn't decode index: %v", err)
+	}
+
+	expected := ResultsIndex{
+		Status: FailedStatus,
+		Plugins: []PluginIndex{
+			{
+				Plugin:     "systemd_logs",
+				ResultType: "systemd_logs",
+				Status:     FailedStatus,
+				Items:      map[string]int{CompleteStatus: 1, FailedStatus: 1, RunningStatus: 1},
+				Results: []ResultIndex{
+					{Node: "node1", Status: CompleteStatus, Files: []string{"plugins/systemd_logs/results/node1"}},
+					{Node: "node2", Status: FailedStatus, Error: "boom", Files: []string{"plugins/systemd_logs/errors/node2"}},
+					{Node: "node3", Status: RunningStatus},
+				},
+			},
+			{
+				Plugin:     "e2e",
+				ResultType: "e2e",
+				Status:     CompleteStatus,
+				Items:      map[string]int{CompleteStatus: 1},
+				Results: []ResultIndex{
+					{Status: CompleteStatus, Files: []string{"plugins/e2e/failures/001-fails.txt", "plugins/e2e/results/e2e.log", "plugins/e2e/results/junit_01.xml"}},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(index, expected) {
+		t.Errorf("expected index %+v, got %+v", expected, index)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type kubeBenchSummaryProcessor struct{}
+
+// KubeBenchSummary is the metadata of the kube-bench-summary processor.
+type KubeBenchSummary struct {
+	Pass int `json:"pass"`
+	Warn int `json:"warn"`
+	Fail int `json:"fail"`
+	Info int `json:"info"`
+	// Controls summarizes each control of the benchmark on its own, such as
+	// "Worker Node Security Configuration".
+	Controls []KubeBenchControlSummary `json:"controls"`
+}
+
+// KubeBenchControlSummary counts the checks of a single benchmark control.
+type KubeBenchControlSummary struct {
+	ID       string `json:"id"`
+	Text     string `json:"text"`
+	NodeType string `json:"nodeType,omitempty"`
+	Pass     int    `json:"pass"`
+	Warn     int    `json:"warn"`
+	Fail     int    `json:"fail"`
+	Info     int    `json:"info"`
+}
+
+// kubeBenchControls is as much of a control in kube-bench's JSON output as is
+// needed to count its checks.
+type kubeBenchControls struct {
+	ID       string `json:"id"`
+	Text     string `json:"text"`
+	NodeType string `json:"node_type"`
+	Groups   []struct {
+		Checks []struct {
+			Status string `json:"status"`
+		} `json:"results"`
+	} `json:"tests"`
+}
+
+// kubeBenchOutput is a value in kube-bench's JSON output. Older versions write
+// one control after another, and newer ones an object listing them all.
+type kubeBenchOutput struct {
+	kubeBenchControls
+	Controls []kubeBenchControls `json:"Controls"`
+}
+
+func (kubeBenchSummaryProcessor) Name() string { return KubeBenchSummaryProcessor }
+
+func (kubeBenchSummaryProcessor) Process(result *plugin.Result, resultPath string) (interface{}, error) {
+	summary := KubeBenchSummary{Controls: []KubeBenchControlSummary{}}
+	err := walkResult(resultPath, func(file string) error {
+		if resultFileExt(result, resultPath, file) != ".json" {
+			return nil
+		}
+		controls, err := readKubeBenchFile(file)
+		if err != nil {
+			// As for junit-summary, JSON files that aren't kube-bench's
+			// output aren't counted.
+			logrus.WithError(err).WithField("file", file).Debug("Skipping JSON file that isn't kube-bench output")
+			return nil
+		}
+		for _, control := range controls {
+			c := KubeBenchControlSummary{ID: control.ID, Text: control.Text, NodeType: control.NodeType}
+			for _, group := range control.Groups {
+				for _, check := range group.Checks {
+					switch check.Status {
+					case "PASS":
+						c.Pass++
+					case "WARN":
+						c.Warn++
+					case "FAIL":
+						c.Fail++
+					case "INFO":
+						c.Info++
+					}
+				}
+			}
+			summary.Pass += c.Pass
+			summary.Warn += c.Warn
+			summary.Fail += c.Fail
+			summary.Info += c.Info
+			summary.Controls = append(summary.Controls, c)
+		}
+		return nil
+	})
+	return summary, errors.Wrap(err, "couldn't read result files")
+}
+
+// readKubeBenchFile reads the controls in a file of kube-bench's JSON output.
+func readKubeBenchFile(file string) ([]kubeBenchControls, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	var controls []kubeBenchControls
+	decoder := json.NewDecoder(f)
+	for {
+		var output kubeBenchOutput
+		if err := decoder.Decode(&output); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		switch {
+		case len(output.Controls) > 0:
+			controls = append(controls, output.Controls...)
+		case output.ID != "" && output.Groups != nil:
+			controls = append(controls, output.kubeBenchControls)
+		default:
+			return nil, errors.New("no kube-bench controls found")
+		}
+	}
+	if len(controls) == 0 {
+		return nil, errors.New("no kube-bench controls found")
+	}
+	return controls, nil
+}
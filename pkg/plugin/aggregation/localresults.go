@@ -0,0 +1,300 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	pluginutils "github.com/heptio/sonobuoy/pkg/plugin/driver/utils"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// LocalResultsDoneFile is the file a worker that can't reach the master writes
+// to its local results directory once it's stored its results there. It holds
+// LocalResults.
+const LocalResultsDoneFile = "sonobuoy-done"
+
+// LocalResults describes the results a worker stored for the master to fetch.
+type LocalResults struct {
+	// Token is the digest of the worker's results token, so the master
+	// only fetches results stored during its own run.
+	Token string `json:"token"`
+	// Files are the result files, in the order they'd have been submitted.
+	Files []LocalResultFile `json:"files,omitempty"`
+	// Error is set, in place of any files, if the plugin failed.
+	Error    string `json:"error,omitempty"`
+	TimedOut bool   `json:"timedOut,omitempty"`
+}
+
+// LocalResultFile is a result file a worker stored, and the content type it'd
+// have been submitted with.
+type LocalResultFile struct {
+	Name     string `json:"name"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// LocalResultsDir is the directory under baseDir that a worker stores the
+// given result in.
+func LocalResultsDir(baseDir string, result plugin.ExpectedResult) string {
+	return path.Join(baseDir, result.ResultType, result.NodeName)
+}
+
+// LocalResultsToken is what a worker stores in place of its results token,
+// since anything with access to the volume can read it.
+func LocalResultsToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// localResultsPollInterval is how often stored results are looked for.
+var localResultsPollInterval = 10 * time.Second
+
+// podExecutor runs a command in a pod, writing its output to stdout.
+type podExecutor func(namespace, podName string, command []string, stdout io.Writer) error
+
+// newPodExecutor returns a podExecutor that runs commands through the API
+// server, which can reach pods even when the aggregator can't.
+func newPodExecutor(restConfig *rest.Config, client kubernetes.Interface) podExecutor {
+	return func(namespace, podName string, command []string, stdout io.Writer) error {
+		req := client.CoreV1().RESTClient().Post().
+			Resource("pods").
+			Name(podName).
+			Namespace(namespace).
+			SubResource("exec")
+		req.VersionedParams(&v1.PodExecOptions{
+			Command: command,
+			Stdout:  true,
+			Stderr:  true,
+		}, scheme.ParameterCodec)
+		executor, err := remotecommand.NewSPDYExecutor(restConfig, "POST", req.URL())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		var stderr bytes.Buffer
+		err = executor.Stream(remotecommand.StreamOptions{
+			Stdout: stdout,
+			Stderr: &stderr,
+		})
+		return errors.Wrapf(err, "couldn't run %v in pod %v: %v", command, podName, stderr.String())
+	}
+}
+
+// localResultsFetcher fetches the results of a plugin whose workers store
+// them, using the plugin's fetch pods.
+type localResultsFetcher struct {
+	client    kubernetes.Interface
+	exec      podExecutor
+	plugin    plugin.Interface
+	namespace string
+	token     string
+	aggr      *Aggregator
+	// pods are the fetch pods created so far, by the node they're pinned
+	// to, if any.
+	pods map[string]*v1.Pod
+}
+
+// fetchLocalResults fetches the plugin's expected results as its workers store
+// them, until they've all been received or stop is closed, then deletes its
+// fetch pods.
+func (f *localResultsFetcher) fetchLocalResults(expected []plugin.ExpectedResult, stop <-chan struct{}) {
+	defer f.cleanup()
+
+	ticker := time.NewTicker(localResultsPollInterval)
+	defer ticker.Stop()
+	for {
+		for _, result := range f.aggr.missingResults(expected) {
+			if err := f.fetch(result); err != nil {
+				logrus.WithError(err).WithField("result", result.ID()).Debug("Couldn't fetch stored result yet")
+			}
+		}
+		if len(f.aggr.missingResults(expected)) == 0 {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// fetch fetches a result, if its worker has stored it, then removes it from
+// the volume.
+func (f *localResultsFetcher) fetch(expected plugin.ExpectedResult) error {
+	pod, err := f.fetchPod(expected)
+	if err != nil {
+		return err
+	}
+
+	dir := LocalResultsDir(plugin.LocalResultsPath, expected)
+	var contents bytes.Buffer
+	if err := f.exec(f.namespace, pod.Name, []string{"cat", path.Join(dir, LocalResultsDoneFile)}, &contents); err != nil {
+		return errors.Wrap(err, "result hasn't been stored")
+	}
+	var stored LocalResults
+	if err := json.Unmarshal(contents.Bytes(), &stored); err != nil {
+		return errors.Wrap(err, "couldn't decode stored result")
+	}
+	if stored.Token != f.token {
+		return errors.New("stored result is from another run")
+	}
+
+	logrus.WithField("result", expected.ID()).Info("Fetching stored result")
+	if stored.Error != "" || len(stored.Files) == 0 {
+		errMsg := stored.Error
+		if errMsg == "" {
+			errMsg = "worker didn't store any result files"
+		}
+		result := pluginutils.MakeErrorResult(expected.ResultType, map[string]interface{}{
+			"error": errMsg,
+		}, expected.NodeName)
+		if stored.TimedOut {
+			result.TimedOut = true
+			result.Error = timedOutError
+		}
+		if err := f.aggr.handleLocalResult(result); err != nil {
+			return err
+		}
+	}
+	for i, file := range stored.Files {
+		result := &plugin.Result{
+			ResultType: expected.ResultType,
+			NodeName:   expected.NodeName,
+			MimeType:   file.MimeType,
+		}
+		filename := cleanFilename(file.Name)
+		if filename == "" || filename == ".." {
+			return errors.Errorf("stored result has an invalid filename %q", file.Name)
+		}
+		// Several files are stored under their own names, as they would
+		// be if they'd been submitted.
+		if len(stored.Files) > 1 {
+			result.Filename = filename
+			result.Partial = i < len(stored.Files)-1
+		}
+		if err := f.fetchFile(pod, path.Join(dir, filename), result); err != nil {
+			return err
+		}
+	}
+
+	// It's been received, so it's no longer needed on the volume.
+	if err := f.exec(f.namespace, pod.Name, []string{"rm", "-rf", dir}, ioutil.Discard); err != nil {
+		errlog.LogError(errors.Wrapf(err, "couldn't remove stored result %v", expected.ID()))
+	}
+	return nil
+}
+
+// fetchFile streams a stored file into the result as it's handled.
+func (f *localResultsFetcher) fetchFile(pod *v1.Pod, file string, result *plugin.Result) error {
+	reader, writer := io.Pipe()
+	execErr := make(chan error, 1)
+	go func() {
+		err := f.exec(f.namespace, pod.Name, []string{"cat", file}, writer)
+		writer.CloseWithError(err)
+		execErr <- err
+	}()
+
+	result.Body = reader
+	err := f.aggr.handleLocalResult(result)
+	// Whatever wasn't read isn't wanted.
+	reader.Close()
+	if err != nil {
+		return err
+	}
+	return errors.Wrapf(<-execErr, "couldn't fetch stored result file %v", file)
+}
+
+// fetchPod returns the running fetch pod for a result, creating it if it
+// hasn't been already.
+func (f *localResultsFetcher) fetchPod(expected plugin.ExpectedResult) (*v1.Pod, error) {
+	spec, err := f.plugin.FetchPod(f.client, expected)
+	if err != nil {
+		return nil, err
+	}
+	node := spec.Spec.NodeName
+
+	pod, ok := f.pods[node]
+	if !ok {
+		if pod, err = f.client.CoreV1().Pods(f.namespace).Create(spec); err != nil {
+			return nil, errors.Wrapf(err, "couldn't create fetch pod for plugin %v", f.plugin.GetName())
+		}
+		f.pods[node] = pod
+	}
+	if pod.Status.Phase == v1.PodRunning {
+		return pod, nil
+	}
+
+	if pod, err = f.client.CoreV1().Pods(f.namespace).Get(pod.Name, metav1.GetOptions{}); err != nil {
+		return nil, errors.Wrapf(err, "couldn't get fetch pod for plugin %v", f.plugin.GetName())
+	}
+	f.pods[node] = pod
+	switch pod.Status.Phase {
+	case v1.PodRunning:
+		return pod, nil
+	case v1.PodFailed, v1.PodSucceeded:
+		// Start another one next time.
+		delete(f.pods, node)
+		return nil, errors.Errorf("fetch pod %v stopped", pod.Name)
+	default:
+		return nil, errors.Errorf("fetch pod %v isn't running yet", pod.Name)
+	}
+}
+
+// cleanup deletes the fetch pods.
+func (f *localResultsFetcher) cleanup() {
+	for _, pod := range f.pods {
+		err := f.client.CoreV1().Pods(f.namespace).Delete(pod.Name, &metav1.DeleteOptions{})
+		if err != nil {
+			errlog.LogError(errors.Wrapf(err, "couldn't delete fetch pod %v", pod.Name))
+		}
+	}
+}
+
+// handleLocalResult handles a result fetched from where its worker stored it,
+// like HandleHTTPResult does for those that are submitted.
+func (a *Aggregator) handleLocalResult(result *plugin.Result) error {
+	resultID := result.ExpectedResultID()
+	if !a.isResultExpected(result) {
+		return errors.Errorf("result %v unexpected", resultID)
+	}
+
+	unlock := a.lockResult(resultID)
+	defer unlock()
+	if err := a.receiveResult(result); err != nil {
+		a.recordError(result, err.Error())
+		return errors.Wrapf(err, "error handling result %v", resultID)
+	}
+	return nil
+}
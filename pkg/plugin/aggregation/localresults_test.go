@@ -0,0 +1,139 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/job"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestFetchLocalResults(t *testing.T) {
+	volumeDir, err := ioutil.TempDir("", "sonobuoy_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(volumeDir)
+	outputDir, err := ioutil.TempDir("", "sonobuoy_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	// The worker stored two files.
+	resultDir := LocalResultsDir(volumeDir, plugin.ExpectedResult{ResultType: "e2e"})
+	os.MkdirAll(resultDir, 0755)
+	ioutil.WriteFile(path.Join(resultDir, "junit.xml"), []byte("<xml/>"), 0644)
+	ioutil.WriteFile(path.Join(resultDir, "e2e.log"), []byte("log"), 0644)
+	stored, _ := json.Marshal(LocalResults{
+		Token: LocalResultsToken("token"),
+		Files: []LocalResultFile{{Name: "junit.xml"}, {Name: "e2e.log"}},
+	})
+	ioutil.WriteFile(path.Join(resultDir, LocalResultsDoneFile), stored, 0644)
+
+	// The fetch pod is running as soon as it's created.
+	var created, deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodPost:
+			var pod v1.Pod
+			json.NewDecoder(r.Body).Decode(&pod)
+			pod.Name = pod.GenerateName + "abcde"
+			pod.Status.Phase = v1.PodRunning
+			created = append(created, pod.Name)
+			json.NewEncoder(w).Encode(pod)
+		case http.MethodDelete:
+			deleted = append(deleted, path.Base(r.URL.Path))
+			w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatalf("couldn't create client: %v", err)
+	}
+
+	// Commands run in the fetch pod are run against the temporary volume.
+	exec := func(namespace, podName string, command []string, stdout io.Writer) error {
+		file := path.Join(volumeDir, strings.TrimPrefix(command[len(command)-1], plugin.LocalResultsPath))
+		switch command[0] {
+		case "cat":
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(stdout, f)
+			return err
+		case "rm":
+			return os.RemoveAll(file)
+		}
+		return errors.Errorf("unexpected command %v", command)
+	}
+
+	p := job.NewPlugin(plugin.Definition{Name: "e2e", ResultType: "e2e", ResultsClaimName: "results"}, "sonobuoy", "sonobuoy:test", "Always")
+	expected := p.ExpectedResults(nil)
+	aggr := NewAggregator(outputDir, expected)
+	fetcher := &localResultsFetcher{
+		client:    client,
+		exec:      exec,
+		plugin:    p,
+		namespace: "sonobuoy",
+		token:     LocalResultsToken("other"),
+		aggr:      aggr,
+		pods:      map[string]*v1.Pod{},
+	}
+
+	// Results stored by another run aren't fetched.
+	if err := fetcher.fetch(expected[0]); err == nil {
+		t.Fatal("expected results stored by another run not to be fetched")
+	}
+
+	fetcher.token = LocalResultsToken("token")
+	fetcher.fetchLocalResults(expected, nil)
+
+	if result, ok := aggr.Results["e2e"]; !ok || !result.IsSuccess() {
+		t.Fatalf("expected a successful result, got %v", aggr.Results)
+	}
+	for _, file := range []string{"junit.xml", "e2e.log"} {
+		if _, err := os.Stat(path.Join(outputDir, "e2e", "results", file)); err != nil {
+			t.Errorf("expected %v to be fetched: %v", file, err)
+		}
+	}
+	if _, err := os.Stat(resultDir); !os.IsNotExist(err) {
+		t.Errorf("expected the stored results to be removed, got %v", err)
+	}
+	if len(created) != 1 || len(deleted) != 1 || created[0] != deleted[0] {
+		t.Errorf("expected one fetch pod to be created and deleted, created %v and deleted %v", created, deleted)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsContentType is the Prometheus text exposition format.
+const metricsContentType = "text/plain; version=0.0.4"
+
+// runMetrics counts what happens during a run so it can be scraped by
+// Prometheus. It has its own mutex rather than reading the aggregator's
+// state, so a scrape doesn't have to wait for results to be stored.
+type runMetrics struct {
+	mutex    sync.Mutex
+	start    time.Time
+	launched map[string]int64
+	received map[string]int64
+	failed   map[string]int64
+	bytes    map[string]int64
+}
+
+func newRunMetrics() *runMetrics {
+	return &runMetrics{
+		start:    time.Now(),
+		launched: make(map[string]int64),
+		received: make(map[string]int64),
+		failed:   make(map[string]int64),
+		bytes:    make(map[string]int64),
+	}
+}
+
+// PluginLaunched records that a plugin has been run.
+func (a *Aggregator) PluginLaunched(resultType string) {
+	a.metrics.mutex.Lock()
+	a.metrics.launched[resultType]++
+	a.metrics.mutex.Unlock()
+	a.events.publish(Event{Type: EventPluginStarted, Plugin: resultType})
+}
+
+func (m *runMetrics) resultReceived(resultType string, failed bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.received[resultType]++
+	if failed {
+		m.failed[resultType]++
+	}
+}
+
+func (m *runMetrics) bytesReceived(resultType string, n int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.bytes[resultType] += n
+}
+
+// MetricsHandler returns a handler serving the aggregator's metrics in the
+// Prometheus text format.
+func (a *Aggregator) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", metricsContentType)
+		a.writeMetrics(w)
+	})
+}
+
+func (a *Aggregator) writeMetrics(w io.Writer) {
+	// ExpectedResults never changes once the aggregator is created.
+	expected := make(map[string]int64)
+	for _, result := range a.ExpectedResults {
+		expected[result.ResultType]++
+	}
+
+	m := a.metrics
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	writeMetric(w, "sonobuoy_plugins_launched_total", "counter", "Number of times each plugin has been launched.", m.launched)
+	writeMetric(w, "sonobuoy_results_expected", "gauge", "Number of results expected from each plugin.", expected)
+	writeMetric(w, "sonobuoy_results_received_total", "counter", "Number of results received from each plugin, including failures.", m.received)
+	writeMetric(w, "sonobuoy_results_failed_total", "counter", "Number of results from each plugin that reported an error.", m.failed)
+	writeMetric(w, "sonobuoy_result_bytes_received_total", "counter", "Bytes of results received from each plugin.", m.bytes)
+
+	fmt.Fprintf(w, "# HELP sonobuoy_run_duration_seconds How long the run has been going.\n")
+	fmt.Fprintf(w, "# TYPE sonobuoy_run_duration_seconds gauge\n")
+	fmt.Fprintf(w, "sonobuoy_run_duration_seconds %v\n", time.Since(m.start).Seconds())
+}
+
+// writeMetric writes a metric with one sample per plugin, sorted so that the
+// output is stable.
+func writeMetric(w io.Writer, name, kind, help string, values map[string]int64) {
+	fmt.Fprintf(w, "# HELP %v %v\n", name, help)
+	fmt.Fprintf(w, "# TYPE %v %v\n", name, kind)
+
+	plugins := make([]string, 0, len(values))
+	for plugin := range values {
+		plugins = append(plugins, plugin)
+	}
+	sort.Strings(plugins)
+	for _, plugin := range plugins {
+		fmt.Fprintf(w, "%v{plugin=\"%v\"} %v\n", name, escapeLabel(plugin), values[plugin])
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
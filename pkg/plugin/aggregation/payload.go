@@ -0,0 +1,68 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/sirupsen/logrus"
+)
+
+// payloadPath is the path workers GET a plugin's files from before it starts.
+const payloadPath = "/api/v1/payload/{plugin}"
+
+// pluginPayloads returns the files of each plugin that has any, by result type.
+func pluginPayloads(plugins []plugin.Interface) map[string]map[string]string {
+	byResultType := map[string]map[string]string{}
+	for _, p := range plugins {
+		if files := p.GetFiles(); len(files) > 0 {
+			byResultType[p.GetResultType()] = files
+		}
+	}
+	return byResultType
+}
+
+// payloadHandler serves the files of the plugin in the request path as a JSON
+// object of their contents, keyed by name.
+func payloadHandler(payloads map[string]map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logRequest(r)
+		files, ok := payloads[mux.Vars(r)["plugin"]]
+		if !ok {
+			http.Error(w, "Plugin has no files", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("content-type", "application/json")
+		if err := json.NewEncoder(w).Encode(files); err != nil {
+			logrus.WithError(err).Warning("couldn't send plugin files")
+		}
+	}
+}
+
+// PayloadURL is the URL a worker downloads its plugin's files from, given the
+// URL it submits results under.
+func PayloadURL(resultsURL, resultType string) string {
+	if i := strings.Index(resultsURL, "/api/v1/results/"); i >= 0 {
+		resultsURL = resultsURL[:i]
+	}
+	return resultsURL + "/api/v1/payload/" + resultType
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/job"
+)
+
+func TestPayloadHandler(t *testing.T) {
+	files := map[string]string{"skip.txt": "Flaky"}
+	e2e := job.NewPlugin(plugin.Definition{Name: "e2e", ResultType: "e2e", Files: files}, "", "", "Always")
+	other := job.NewPlugin(plugin.Definition{Name: "other", ResultType: "other"}, "", "", "Always")
+
+	router := mux.NewRouter()
+	router.HandleFunc(payloadPath, payloadHandler(pluginPayloads([]plugin.Interface{e2e, other}))).Methods("GET")
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	testCases := []struct {
+		resultType     string
+		expectedStatus int
+		expectedFiles  map[string]string
+	}{
+		{resultType: "e2e", expectedStatus: http.StatusOK, expectedFiles: files},
+		{resultType: "other", expectedStatus: http.StatusNotFound},
+		{resultType: "unknown", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.resultType, func(t *testing.T) {
+			url := PayloadURL(srv.URL+"/api/v1/results/global", tc.resultType)
+			resp, err := http.Get(url)
+			if err != nil {
+				t.Fatalf("couldn't get %v: %v", url, err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.expectedStatus {
+				t.Fatalf("expected status %v, got %v", tc.expectedStatus, resp.StatusCode)
+			}
+			if tc.expectedFiles == nil {
+				return
+			}
+
+			var got map[string]string
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("couldn't decode files: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.expectedFiles) {
+				t.Errorf("expected files %v, got %v", tc.expectedFiles, got)
+			}
+		})
+	}
+}
+
+func TestPayloadURL(t *testing.T) {
+	testCases := []struct {
+		resultsURL string
+		expected   string
+	}{
+		{"https://10.0.0.1:8080/api/v1/results/global", "https://10.0.0.1:8080/api/v1/payload/e2e"},
+		{"https://10.0.0.1:8080/api/v1/results/by-node", "https://10.0.0.1:8080/api/v1/payload/e2e"},
+		{"https://[fd00::1]:8080/api/v1/results/global", "https://[fd00::1]:8080/api/v1/payload/e2e"},
+	}
+	for _, tc := range testCases {
+		if got := PayloadURL(tc.resultsURL, "e2e"); got != tc.expected {
+			t.Errorf("expected %v for %v, got %v", tc.expected, tc.resultsURL, got)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// PodsFile and EventsFile are where the pods each plugin launched, and
+	// the events about them, are stored in the plugin's directory of the
+	// results tarball.
+	PodsFile   = "pods.json"
+	EventsFile = "events.json"
+)
+
+// podRecordInterval is how often the plugins' pods and their events are
+// recorded.
+var podRecordInterval = 10 * time.Second
+
+// podRecorder keeps the latest status of every pod the plugins launch, and the
+// events about them, so failed runs have the evidence of why with their
+// results. Pods and events are kept after they're deleted or expire.
+type podRecorder struct {
+	client    kubernetes.Interface
+	namespace string
+	plugins   []plugin.Interface
+
+	// pods and events are kept by the result type of the plugin they're
+	// for, then by UID. They're guarded by mutex.
+	mutex  sync.Mutex
+	pods   map[string]map[types.UID]v1.Pod
+	events map[string]map[types.UID]v1.Event
+}
+
+func newPodRecorder(client kubernetes.Interface, namespace string, plugins []plugin.Interface) *podRecorder {
+	return &podRecorder{
+		client:    client,
+		namespace: namespace,
+		plugins:   plugins,
+		pods:      map[string]map[types.UID]v1.Pod{},
+		events:    map[string]map[types.UID]v1.Event{},
+	}
+}
+
+// run records the pods and events regularly until stop is closed, and once
+// more then.
+func (r *podRecorder) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(podRecordInterval)
+	defer ticker.Stop()
+	for {
+		if err := r.record(); err != nil {
+			errlog.LogError(errors.Wrap(err, "couldn't record plugin pods, will retry"))
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			if err := r.record(); err != nil {
+				errlog.LogError(errors.Wrap(err, "couldn't record plugin pods"))
+			}
+			return
+		}
+	}
+}
+
+// record lists the plugins' pods and the events about them.
+func (r *podRecorder) record() error {
+	pods := map[string][]v1.Pod{}
+	for _, p := range r.plugins {
+		list, err := r.client.CoreV1().Pods(r.namespace).List(metav1.ListOptions{
+			LabelSelector: "sonobuoy-run=" + p.GetSessionID(),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "couldn't list pods of plugin %v", p.GetName())
+		}
+		pods[p.GetResultType()] = list.Items
+	}
+
+	events, err := r.client.CoreV1().Events(r.namespace).List(metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=Pod",
+	})
+	if err != nil {
+		return errors.Wrap(err, "couldn't list events")
+	}
+
+	r.add(pods, events.Items)
+	return nil
+}
+
+// add keeps the given pods, by the result type of their plugin, and the events
+// about any pod kept so far.
+func (r *podRecorder) add(pods map[string][]v1.Pod, events []v1.Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	resultTypes := map[types.UID]string{}
+	for resultType, list := range pods {
+		if r.pods[resultType] == nil {
+			r.pods[resultType] = map[types.UID]v1.Pod{}
+		}
+		for _, pod := range list {
+			r.pods[resultType][pod.UID] = pod
+		}
+		for uid := range r.pods[resultType] {
+			resultTypes[uid] = resultType
+		}
+	}
+	for _, event := range events {
+		resultType, ok := resultTypes[event.InvolvedObject.UID]
+		if !ok {
+			continue
+		}
+		if r.events[resultType] == nil {
+			r.events[resultType] = map[types.UID]v1.Event{}
+		}
+		r.events[resultType][event.UID] = event
+	}
+}
+
+// Pods returns the pods recorded so far, by the result type of the plugin
+// they're for.
+func (r *podRecorder) Pods() map[string][]v1.Pod {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	pods := map[string][]v1.Pod{}
+	for resultType, byUID := range r.pods {
+		for _, pod := range byUID {
+			pods[resultType] = append(pods[resultType], pod)
+		}
+	}
+	return pods
+}
+
+// write stores the pods and events recorded for each plugin in its directory
+// of outdir, the plugins directory of the results, sorted by name and time
+// respectively.
+func (r *podRecorder) write(outdir string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for resultType, byUID := range r.pods {
+		pods := make([]v1.Pod, 0, len(byUID))
+		for _, pod := range byUID {
+			pods = append(pods, pod)
+		}
+		sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+
+		events := make([]v1.Event, 0, len(r.events[resultType]))
+		for _, event := range r.events[resultType] {
+			events = append(events, event)
+		}
+		sort.Slice(events, func(i, j int) bool {
+			if !events[i].FirstTimestamp.Equal(&events[j].FirstTimestamp) {
+				return events[i].FirstTimestamp.Before(&events[j].FirstTimestamp)
+			}
+			return events[i].Name < events[j].Name
+		})
+
+		if err := writeJSON(path.Join(outdir, resultType, PodsFile), pods); err != nil {
+			return err
+		}
+		if err := writeJSON(path.Join(outdir, resultType, EventsFile), events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSON(file string, v interface{}) error {
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't encode %v", file)
+	}
+	if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+		return errors.Wrapf(err, "couldn't create directory for %v", file)
+	}
+	return errors.Wrapf(ioutil.WriteFile(file, blob, 0644), "couldn't write %v", file)
+}
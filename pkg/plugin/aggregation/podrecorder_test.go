@@ -0,0 +1,117 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func testPod(name string, phase v1.PodPhase) v1.Pod {
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID(name)},
+		Status:     v1.PodStatus{Phase: phase},
+	}
+}
+
+func testEvent(name string, pod string, at time.Time) v1.Event {
+	return v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: name, UID: types.UID(name)},
+		InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: pod, UID: types.UID(pod)},
+		FirstTimestamp: metav1.NewTime(at),
+	}
+}
+
+func TestPodRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy_podrecorder")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := newPodRecorder(nil, "sonobuoy", nil)
+	r.add(map[string][]v1.Pod{
+		"e2e":     {testPod("e2e-pod", v1.PodPending)},
+		"systemd": {testPod("systemd-b", v1.PodRunning), testPod("systemd-a", v1.PodRunning)},
+	}, []v1.Event{
+		testEvent("pulling", "e2e-pod", start),
+		testEvent("other", "unrelated-pod", start),
+	})
+
+	// The e2e pod has been deleted by the next poll, but what's known about
+	// it is kept.
+	r.add(map[string][]v1.Pod{
+		"e2e":     {},
+		"systemd": {testPod("systemd-a", v1.PodFailed), testPod("systemd-b", v1.PodRunning)},
+	}, []v1.Event{
+		testEvent("backoff", "e2e-pod", start.Add(time.Minute)),
+		testEvent("oom", "systemd-a", start),
+	})
+
+	if err := r.write(dir); err != nil {
+		t.Fatalf("unexpected error writing pods: %v", err)
+	}
+
+	readNames := func(file string) (names []string, phases []v1.PodPhase) {
+		blob, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatalf("couldn't read %v: %v", file, err)
+		}
+		var objs []struct {
+			Metadata metav1.ObjectMeta `json:"metadata"`
+			Status   v1.PodStatus      `json:"status"`
+		}
+		if err := json.Unmarshal(blob, &objs); err != nil {
+			t.Fatalf("couldn't decode %v: %v", file, err)
+		}
+		for _, obj := range objs {
+			names = append(names, obj.Metadata.Name)
+			phases = append(phases, obj.Status.Phase)
+		}
+		return names, phases
+	}
+
+	tests := []struct {
+		file   string
+		names  []string
+		phases []v1.PodPhase
+	}{
+		{file: "e2e/pods.json", names: []string{"e2e-pod"}, phases: []v1.PodPhase{v1.PodPending}},
+		{file: "e2e/events.json", names: []string{"pulling", "backoff"}, phases: []v1.PodPhase{"", ""}},
+		{file: "systemd/pods.json", names: []string{"systemd-a", "systemd-b"}, phases: []v1.PodPhase{v1.PodFailed, v1.PodRunning}},
+		{file: "systemd/events.json", names: []string{"oom"}, phases: []v1.PodPhase{""}},
+	}
+	for _, test := range tests {
+		names, phases := readNames(test.file)
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("expected %v to have %v, got %v", test.file, test.names, names)
+		}
+		if !reflect.DeepEqual(phases, test.phases) {
+			t.Errorf("expected %v to have phases %v, got %v", test.file, test.phases, phases)
+		}
+	}
+}
@@ -0,0 +1,516 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/tarball"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// UntarProcessor extracts the gzipped tarballs in a result, in place of
+	// the tarballs themselves.
+	UntarProcessor = "untar"
+	// ValidateProcessor checks that the JSON and XML files in a result are
+	// well-formed.
+	ValidateProcessor = "validate"
+	// JUnitSummaryProcessor counts the tests, failures and skipped tests in
+	// the JUnit XML files in a result.
+	JUnitSummaryProcessor = "junit-summary"
+	// JUnitFailuresProcessor writes each failed test in the JUnit XML files
+	// in a result to a file of its own.
+	JUnitFailuresProcessor = "junit-failures"
+	// KubeBenchSummaryProcessor counts the checks of each CIS benchmark
+	// control that passed, warned and failed in kube-bench's JSON output.
+	KubeBenchSummaryProcessor = "kube-bench-summary"
+)
+
+// maxFailureFileName is how much of a failed test's name is used in the name
+// of the file it's written to.
+const maxFailureFileName = 100
+
+// ResultProcessor derives metadata from a plugin's result once all of it has
+// been stored, such as how many tests it ran. Sonobuoy's own processors are
+// untar, validate, junit-summary, junit-failures and kube-bench-summary; others
+// can be compiled into a custom build of Sonobuoy and registered with
+// RegisterResultProcessor.
+type ResultProcessor interface {
+	// Name is what plugins call the processor in their result-processors.
+	Name() string
+	// Process is given a result and the file or directory it was stored in,
+	// and returns metadata about it to be stored as JSON.
+	Process(result *plugin.Result, resultPath string) (interface{}, error)
+}
+
+var (
+	processorsMutex sync.Mutex
+	processors      = map[string]ResultProcessor{}
+)
+
+func init() {
+	RegisterResultProcessor(untarProcessor{})
+	RegisterResultProcessor(validateProcessor{})
+	RegisterResultProcessor(junitSummaryProcessor{})
+	RegisterResultProcessor(junitFailuresProcessor{})
+	RegisterResultProcessor(kubeBenchSummaryProcessor{})
+}
+
+// RegisterResultProcessor makes a processor available to plugins. It's meant
+// to be called from the init function of the package the processor is defined
+// in, and panics if a processor with the same name has already been
+// registered.
+func RegisterResultProcessor(p ResultProcessor) {
+	processorsMutex.Lock()
+	defer processorsMutex.Unlock()
+
+	if _, ok := processors[p.Name()]; ok {
+		panic(fmt.Sprintf("result processor %v registered twice", p.Name()))
+	}
+	processors[p.Name()] = p
+}
+
+// pluginResultProcessors returns the processors each plugin asked for, by
+// result type.
+func pluginResultProcessors(plugins []plugin.Interface) (map[string][]ResultProcessor, error) {
+	processorsMutex.Lock()
+	defer processorsMutex.Unlock()
+
+	byResultType := map[string][]ResultProcessor{}
+	for _, p := range plugins {
+		for _, name := range p.GetResultProcessors() {
+			processor, ok := processors[name]
+			if !ok {
+				return nil, errors.Errorf("plugin %v has unknown result processor %q", p.GetName(), name)
+			}
+			byResultType[p.GetResultType()] = append(byResultType[p.GetResultType()], processor)
+		}
+	}
+	return byResultType, nil
+}
+
+// ProcessedPath is the path within the "plugins" section of the results
+// tarball where the metadata derived from result by its plugin's processors is
+// stored.
+func ProcessedPath(result plugin.ExpectedResult) string {
+	return path.Join(result.ResultType, "processed", result.NodeName) + ".json"
+}
+
+// FailuresPath is the path within the "plugins" section of the results
+// tarball of the directory the junit-failures processor writes result's
+// failed tests to.
+func FailuresPath(result plugin.ExpectedResult) string {
+	return path.Join(result.ResultType, "failures", result.NodeName)
+}
+
+// processResult runs the processors of result's plugin on it, in order, and
+// stores what they derive by processor name. A processor failing is logged
+// and stored in place of its metadata, but doesn't fail the result.
+func (a *Aggregator) processResult(result *plugin.Result) {
+	resultProcessors := a.Processors[result.ResultType]
+	if len(resultProcessors) == 0 {
+		return
+	}
+
+	resultPath := path.Join(a.OutputDir, result.Path())
+	processed := make(map[string]interface{}, len(resultProcessors))
+	for _, p := range resultProcessors {
+		metadata, err := p.Process(result, resultPath)
+		if err != nil {
+			err = errors.Wrapf(err, "result processor %v failed on result %v", p.Name(), result.ExpectedResultID())
+			errlog.LogError(err)
+			metadata = map[string]string{"error": err.Error()}
+		}
+		processed[p.Name()] = metadata
+	}
+
+	expected := plugin.ExpectedResult{NodeName: result.NodeName, ResultType: result.ResultType}
+	processedFile := path.Join(a.OutputDir, ProcessedPath(expected))
+	if err := writeJSON(processedFile, processed); err != nil {
+		errlog.LogError(err)
+		return
+	}
+	logrus.WithField("result", result.ExpectedResultID()).Info("Processed result")
+}
+
+// resultFileExt is the extension of a file in a result, or for a result
+// that's a single file, stored without one, the extension of its MIME type.
+func resultFileExt(result *plugin.Result, resultPath, file string) string {
+	if ext := filepath.Ext(file); ext != "" || file != resultPath {
+		return ext
+	}
+	switch {
+	case strings.Contains(result.MimeType, "json"):
+		return ".json"
+	case strings.Contains(result.MimeType, "xml"):
+		return ".xml"
+	}
+	return ""
+}
+
+// walkResult calls fn with every regular file in a result, in lexical order.
+func walkResult(resultPath string, fn func(file string) error) error {
+	return filepath.Walk(resultPath, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return fn(file)
+	})
+}
+
+// relPath is file relative to the result it's in, or its base name if the
+// result is just that file.
+func relPath(resultPath, file string) string {
+	if file == resultPath {
+		return filepath.Base(file)
+	}
+	rel, err := filepath.Rel(resultPath, file)
+	if err != nil {
+		return file
+	}
+	return filepath.ToSlash(rel)
+}
+
+type untarProcessor struct{}
+
+// UntarResult is the metadata of the untar processor.
+type UntarResult struct {
+	// Extracted lists the tarballs that were extracted, each into a
+	// directory named after it without its extension.
+	Extracted []string `json:"extracted"`
+}
+
+func (untarProcessor) Name() string { return UntarProcessor }
+
+func (untarProcessor) Process(result *plugin.Result, resultPath string) (interface{}, error) {
+	var tarballs []string
+	err := walkResult(resultPath, func(file string) error {
+		if file != resultPath && (strings.HasSuffix(file, ".tar.gz") || strings.HasSuffix(file, ".tgz")) {
+			tarballs = append(tarballs, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't list result files")
+	}
+
+	untarred := UntarResult{Extracted: []string{}}
+	for _, file := range tarballs {
+		dir := strings.TrimSuffix(strings.TrimSuffix(file, ".tgz"), ".tar.gz")
+		if err := untar(file, dir); err != nil {
+			return nil, err
+		}
+		untarred.Extracted = append(untarred.Extracted, relPath(resultPath, file))
+	}
+	return untarred, nil
+}
+
+func untar(file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+	if err := tarball.DecodeTarball(f, dir); err != nil {
+		return errors.Wrapf(err, "couldn't extract %v", file)
+	}
+	return errors.WithStack(os.Remove(file))
+}
+
+type validateProcessor struct{}
+
+// ValidateResult is the metadata of the validate processor.
+type ValidateResult struct {
+	// Checked counts the JSON and XML files that were checked.
+	Checked int `json:"checked"`
+	// Invalid maps each file that isn't well-formed to why.
+	Invalid map[string]string `json:"invalid,omitempty"`
+}
+
+func (validateProcessor) Name() string { return ValidateProcessor }
+
+func (validateProcessor) Process(result *plugin.Result, resultPath string) (interface{}, error) {
+	validated := ValidateResult{}
+	err := walkResult(resultPath, func(file string) error {
+		var check func(io.Reader) error
+		switch resultFileExt(result, resultPath, file) {
+		case ".json":
+			check = checkJSON
+		case ".xml":
+			check = checkXML
+		default:
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer f.Close()
+		validated.Checked++
+		if err := check(f); err != nil {
+			if validated.Invalid == nil {
+				validated.Invalid = map[string]string{}
+			}
+			validated.Invalid[relPath(resultPath, file)] = err.Error()
+		}
+		return nil
+	})
+	return validated, errors.Wrap(err, "couldn't check result files")
+}
+
+func checkJSON(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	for {
+		var v json.RawMessage
+		if err := decoder.Decode(&v); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func checkXML(r io.Reader) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+type junitSummaryProcessor struct{}
+
+// JUnitSummary is the metadata of the junit-summary processor.
+type JUnitSummary struct {
+	Tests    int `json:"tests"`
+	Failures int `json:"failures"`
+	Skipped  int `json:"skipped"`
+	// Suites summarizes each test suite on its own.
+	Suites []JUnitSuiteSummary `json:"suites"`
+}
+
+// JUnitSuiteSummary counts the tests of a single JUnit test suite.
+type JUnitSuiteSummary struct {
+	Name     string `json:"name"`
+	Tests    int    `json:"tests"`
+	Failures int    `json:"failures"`
+	Skipped  int    `json:"skipped"`
+}
+
+// junitSuite is as much of a JUnit test suite as is needed to count and
+// validate its tests, and report on those that failed.
+type junitSuite struct {
+	Name      string `xml:"name,attr"`
+	TestCases []struct {
+		Name      string        `xml:"name,attr"`
+		Failure   *junitFailure `xml:"failure"`
+		Error     *junitFailure `xml:"error"`
+		Skipped   *struct{}     `xml:"skipped"`
+		SystemOut string        `xml:"system-out"`
+	} `xml:"testcase"`
+}
+
+// junitFailure is the failure or error of a JUnit test case.
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (junitSummaryProcessor) Name() string { return JUnitSummaryProcessor }
+
+func (junitSummaryProcessor) Process(result *plugin.Result, resultPath string) (interface{}, error) {
+	summary := JUnitSummary{Suites: []JUnitSuiteSummary{}}
+	err := walkResult(resultPath, func(file string) error {
+		if resultFileExt(result, resultPath, file) != ".xml" {
+			return nil
+		}
+		suites, err := readJUnitFile(file)
+		if err != nil {
+			// Not every XML file is JUnit, so the ones that can't be read
+			// aren't counted.
+			logrus.WithError(err).WithField("file", file).Debug("Skipping XML file that isn't JUnit")
+			return nil
+		}
+		for _, suite := range suites {
+			s := JUnitSuiteSummary{Name: suite.Name}
+			for _, tc := range suite.TestCases {
+				s.Tests++
+				switch {
+				case tc.Failure != nil || tc.Error != nil:
+					s.Failures++
+				case tc.Skipped != nil:
+					s.Skipped++
+				}
+			}
+			summary.Tests += s.Tests
+			summary.Failures += s.Failures
+			summary.Skipped += s.Skipped
+			summary.Suites = append(summary.Suites, s)
+		}
+		return nil
+	})
+	return summary, errors.Wrap(err, "couldn't read result files")
+}
+
+// readJUnitFile reads the test suites of a JUnit XML file, whose root is
+// either a single testsuite or a testsuites element.
+func readJUnitFile(file string) ([]junitSuite, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	report := struct {
+		XMLName xml.Name
+		Suites  []junitSuite `xml:"testsuite"`
+	}{}
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	switch report.XMLName.Local {
+	case "testsuites":
+		return report.Suites, nil
+	case "testsuite":
+		suite := junitSuite{}
+		if err := xml.Unmarshal(data, &suite); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return []junitSuite{suite}, nil
+	}
+	return nil, errors.Errorf("root element %v isn't a JUnit test suite", report.XMLName.Local)
+}
+
+type junitFailuresProcessor struct{}
+
+// JUnitFailures is the metadata of the junit-failures processor.
+type JUnitFailures struct {
+	// Failures lists each failed test, in the order they were found.
+	Failures []JUnitFailure `json:"failures"`
+}
+
+// JUnitFailure is a failed test, and where its failure was written.
+type JUnitFailure struct {
+	Suite string `json:"suite"`
+	Name  string `json:"name"`
+	// File is the path within the results tarball of the file with the
+	// test's name, failure message and output.
+	File string `json:"file"`
+}
+
+func (junitFailuresProcessor) Name() string { return JUnitFailuresProcessor }
+
+func (junitFailuresProcessor) Process(result *plugin.Result, resultPath string) (interface{}, error) {
+	expected := plugin.ExpectedResult{NodeName: result.NodeName, ResultType: result.ResultType}
+	// The result is stored at its Path within the "plugins" section, and its
+	// failures beside it, replacing any written from an earlier result.
+	pluginsDir := strings.TrimSuffix(filepath.ToSlash(resultPath), result.Path())
+	dir := filepath.Join(pluginsDir, FailuresPath(expected))
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, errors.Wrapf(err, "couldn't remove earlier failures in %v", dir)
+	}
+
+	failures := JUnitFailures{Failures: []JUnitFailure{}}
+	err := walkResult(resultPath, func(file string) error {
+		if resultFileExt(result, resultPath, file) != ".xml" {
+			return nil
+		}
+		suites, err := readJUnitFile(file)
+		if err != nil {
+			// As for junit-summary, XML files that aren't JUnit are skipped.
+			return nil
+		}
+		for _, suite := range suites {
+			for _, tc := range suite.TestCases {
+				failure := tc.Failure
+				if failure == nil {
+					failure = tc.Error
+				}
+				if failure == nil {
+					continue
+				}
+
+				name := fmt.Sprintf("%03d-%v.txt", len(failures.Failures)+1, failureFileName(tc.Name))
+				var buf bytes.Buffer
+				fmt.Fprintf(&buf, "Suite: %v\nTest: %v\n\nFailure: %v\n", suite.Name, tc.Name, failure.Message)
+				if text := strings.TrimSpace(failure.Text); text != "" {
+					fmt.Fprintf(&buf, "\n%v\n", text)
+				}
+				if tc.SystemOut != "" {
+					fmt.Fprintf(&buf, "\nOutput:\n%v\n", strings.TrimRight(tc.SystemOut, "\n"))
+				}
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					return errors.Wrapf(err, "couldn't create directory %v", dir)
+				}
+				if err := ioutil.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644); err != nil {
+					return errors.Wrapf(err, "couldn't write failure of test %v", tc.Name)
+				}
+				failures.Failures = append(failures.Failures, JUnitFailure{
+					Suite: suite.Name,
+					Name:  tc.Name,
+					File:  path.Join("plugins", FailuresPath(expected), name),
+				})
+			}
+		}
+		return nil
+	})
+	return failures, errors.Wrap(err, "couldn't write failed tests")
+}
+
+// failureFileName makes a test's name fit to be part of a file name: lower
+// case letters, digits and dashes, and no longer than maxFailureFileName.
+func failureFileName(test string) string {
+	var b bytes.Buffer
+	dash := false
+	for _, r := range strings.ToLower(test) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+		if b.Len() >= maxFailureFileName {
+			break
+		}
+	}
+	name := strings.TrimSuffix(b.String(), "-")
+	if name == "" {
+		return "test"
+	}
+	return name
+}
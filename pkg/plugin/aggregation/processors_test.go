@@ -0,0 +1,291 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/job"
+	"github.com/heptio/sonobuoy/pkg/tarball"
+)
+
+const junitXML = `<testsuite name="conformance">
+  <testcase name="passes"></testcase>
+  <testcase name="fails"><failure>boom</failure></testcase>
+  <testcase name="skips"><skipped></skipped></testcase>
+</testsuite>`
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProcessResult(t *testing.T) {
+	outdir, err := ioutil.TempDir("", "sonobuoy_processors_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(outdir)
+
+	p := job.NewPlugin(plugin.Definition{
+		Name:             "e2e",
+		ResultType:       "e2e",
+		ResultProcessors: []string{ValidateProcessor, JUnitSummaryProcessor},
+	}, "", "", "Always")
+	processors, err := pluginResultProcessors([]plugin.Interface{p})
+	if err != nil {
+		t.Fatalf("unexpected error getting processors: %v", err)
+	}
+
+	aggr := NewAggregator(outdir, p.ExpectedResults(nil))
+	aggr.Processors = processors
+	writeFiles(t, filepath.Join(outdir, "e2e", "results"), map[string]string{
+		"junit_01.xml": junitXML,
+		"meta.json":    `{"broken": `,
+		"e2e.log":      "log",
+	})
+	aggr.processResult(&plugin.Result{ResultType: "e2e"})
+
+	blob, err := ioutil.ReadFile(filepath.Join(outdir, ProcessedPath(plugin.ExpectedResult{ResultType: "e2e"})))
+	if err != nil {
+		t.Fatalf("expected the processed result to be written: %v", err)
+	}
+	processed := struct {
+		Validate     ValidateResult `json:"validate"`
+		JUnitSummary JUnitSummary   `json:"junit-summary"`
+	}{}
+	if err := json.Unmarshal(blob, &processed); err != nil {
+		t.Fatalf("couldn't decode processed result: %v", err)
+	}
+
+	if processed.Validate.Checked != 2 || len(processed.Validate.Invalid) != 1 || processed.Validate.Invalid["meta.json"] == "" {
+		t.Errorf("expected only meta.json to be invalid, got %+v", processed.Validate)
+	}
+	expected := JUnitSummary{
+		Tests: 3, Failures: 1, Skipped: 1,
+		Suites: []JUnitSuiteSummary{{Name: "conformance", Tests: 3, Failures: 1, Skipped: 1}},
+	}
+	if !reflect.DeepEqual(processed.JUnitSummary, expected) {
+		t.Errorf("expected JUnit summary %+v, got %+v", expected, processed.JUnitSummary)
+	}
+}
+
+func TestProcessResult_singleFile(t *testing.T) {
+	outdir, err := ioutil.TempDir("", "sonobuoy_processors_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(outdir)
+
+	// A single file result is stored without an extension, so its MIME type
+	// says what it is.
+	writeFiles(t, filepath.Join(outdir, "e2e"), map[string]string{"results": junitXML})
+	summary, err := junitSummaryProcessor{}.Process(&plugin.Result{ResultType: "e2e", MimeType: "text/xml"}, filepath.Join(outdir, "e2e", "results"))
+	if err != nil {
+		t.Fatalf("unexpected error summarizing result: %v", err)
+	}
+	if tests := summary.(JUnitSummary).Tests; tests != 3 {
+		t.Errorf("expected 3 tests, got %v", tests)
+	}
+}
+
+func TestUntarProcessor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy_processors_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFiles(t, filepath.Join(dir, "archived"), map[string]string{"logs/kubelet.log": "log"})
+	resultDir := filepath.Join(dir, "results")
+	if err := os.MkdirAll(resultDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(resultDir, "logs.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tarball.EncodeTarball(f, filepath.Join(dir, "archived")); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	untarred, err := untarProcessor{}.Process(&plugin.Result{ResultType: "e2e"}, resultDir)
+	if err != nil {
+		t.Fatalf("unexpected error extracting result: %v", err)
+	}
+	if !reflect.DeepEqual(untarred, UntarResult{Extracted: []string{"logs.tar.gz"}}) {
+		t.Errorf("expected logs.tar.gz to be extracted, got %+v", untarred)
+	}
+	if _, err := os.Stat(filepath.Join(resultDir, "logs", "logs", "kubelet.log")); err != nil {
+		t.Errorf("expected the tarball's files to be extracted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(resultDir, "logs.tar.gz")); !os.IsNotExist(err) {
+		t.Errorf("expected the tarball to be removed, got %v", err)
+	}
+}
+
+func TestJUnitFailuresProcessor(t *testing.T) {
+	outdir, err := ioutil.TempDir("", "sonobuoy_processors_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(outdir)
+
+	writeFiles(t, filepath.Join(outdir, "e2e", "results"), map[string]string{
+		"junit_01.xml": `<testsuite name="conformance">
+  <testcase name="passes"></testcase>
+  <testcase name="[sig-network] DNS should resolve"><failure message="timed out">stack</failure><system-out>dialing 10.0.0.10</system-out></testcase>
+  <testcase name="errors"><error message="panic"></error></testcase>
+</testsuite>`,
+		"e2e.log": "log",
+	})
+	// Failures written from an earlier result are replaced.
+	writeFiles(t, filepath.Join(outdir, "e2e", "failures"), map[string]string{"001-stale.txt": "stale"})
+
+	processed, err := junitFailuresProcessor{}.Process(&plugin.Result{ResultType: "e2e"}, filepath.Join(outdir, "e2e", "results"))
+	if err != nil {
+		t.Fatalf("unexpected error writing failures: %v", err)
+	}
+	expected := JUnitFailures{Failures: []JUnitFailure{
+		{Suite: "conformance", Name: "[sig-network] DNS should resolve", File: "plugins/e2e/failures/001-sig-network-dns-should-resolve.txt"},
+		{Suite: "conformance", Name: "errors", File: "plugins/e2e/failures/002-errors.txt"},
+	}}
+	if !reflect.DeepEqual(processed, expected) {
+		t.Fatalf("expected failures %+v, got %+v", expected, processed)
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(outdir, "e2e", "failures"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected just the 2 failures to be written, got %v (%v)", files, err)
+	}
+	written, err := ioutil.ReadFile(filepath.Join(outdir, "e2e", "failures", "001-sig-network-dns-should-resolve.txt"))
+	if err != nil {
+		t.Fatalf("couldn't read failure: %v", err)
+	}
+	expectedFailure := `Suite: conformance
+Test: [sig-network] DNS should resolve
+
+Failure: timed out
+
+stack
+
+Output:
+dialing 10.0.0.10
+`
+	if string(written) != expectedFailure {
+		t.Errorf("expected failure file\n%v\ngot\n%v", expectedFailure, string(written))
+	}
+}
+
+func TestJUnitFailuresProcessor_node(t *testing.T) {
+	outdir, err := ioutil.TempDir("", "sonobuoy_processors_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(outdir)
+
+	// A node's result that's a single file has its failures beside it.
+	writeFiles(t, filepath.Join(outdir, "checks", "results"), map[string]string{"node1": junitXML})
+	result := &plugin.Result{ResultType: "checks", NodeName: "node1", MimeType: "application/xml"}
+	processed, err := junitFailuresProcessor{}.Process(result, filepath.Join(outdir, "checks", "results", "node1"))
+	if err != nil {
+		t.Fatalf("unexpected error writing failures: %v", err)
+	}
+	expected := JUnitFailures{Failures: []JUnitFailure{
+		{Suite: "conformance", Name: "fails", File: "plugins/checks/failures/node1/001-fails.txt"},
+	}}
+	if !reflect.DeepEqual(processed, expected) {
+		t.Errorf("expected failures %+v, got %+v", expected, processed)
+	}
+	if _, err := os.Stat(filepath.Join(outdir, "checks", "failures", "node1", "001-fails.txt")); err != nil {
+		t.Errorf("expected the failure to be written: %v", err)
+	}
+}
+
+func TestFailureFileName(t *testing.T) {
+	testCases := []struct {
+		test, expect string
+	}{
+		{test: "[sig-network] DNS should resolve", expect: "sig-network-dns-should-resolve"},
+		{test: "  ", expect: "test"},
+		{test: strings.Repeat("a", 200), expect: strings.Repeat("a", maxFailureFileName)},
+	}
+	for _, tc := range testCases {
+		if name := failureFileName(tc.test); name != tc.expect {
+			t.Errorf("expected %q for %q, got %q", tc.expect, tc.test, name)
+		}
+	}
+}
+
+func TestKubeBenchSummaryProcessor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy_processors_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Older versions of kube-bench write each control on its own, and newer
+	// ones all of them in one object.
+	writeFiles(t, dir, map[string]string{
+		"master.json": `{"id": "1", "text": "Master Node Security Configuration", "node_type": "master", "tests": [
+			{"section": "1.1", "results": [{"test_number": "1.1.1", "status": "PASS"}, {"test_number": "1.1.2", "status": "FAIL"}]},
+			{"section": "1.2", "results": [{"test_number": "1.2.1", "status": "WARN"}]}
+		]}`,
+		"node.json": `{"Controls": [{"id": "4", "text": "Worker Node Security Configuration", "node_type": "node", "tests": [
+			{"section": "4.1", "results": [{"test_number": "4.1.1", "status": "PASS"}, {"test_number": "4.1.2", "status": "INFO"}]}
+		]}], "Totals": {"total_pass": 1}}`,
+		"other.json": `{"nodes": 3}`,
+	})
+
+	summary, err := kubeBenchSummaryProcessor{}.Process(&plugin.Result{ResultType: "kube-bench"}, dir)
+	if err != nil {
+		t.Fatalf("unexpected error summarizing result: %v", err)
+	}
+	expected := KubeBenchSummary{
+		Pass: 2, Warn: 1, Fail: 1, Info: 1,
+		Controls: []KubeBenchControlSummary{
+			{ID: "1", Text: "Master Node Security Configuration", NodeType: "master", Pass: 1, Warn: 1, Fail: 1},
+			{ID: "4", Text: "Worker Node Security Configuration", NodeType: "node", Pass: 1, Info: 1},
+		},
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Errorf("expected kube-bench summary %+v, got %+v", expected, summary)
+	}
+}
+
+func TestPluginResultProcessors_unknown(t *testing.T) {
+	p := job.NewPlugin(plugin.Definition{Name: "e2e", ResultType: "e2e", ResultProcessors: []string{"nope"}}, "", "", "Always")
+	if _, err := pluginResultProcessors([]plugin.Interface{p}); err == nil {
+		t.Error("expected an error for an unknown result processor")
+	}
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/gorilla/mux"
+	"github.com/heptio/sonobuoy/pkg/backplane/ca"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/tarball"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// resultsList is the path tools GET the results received so far from.
+	resultsList = "/api/v1/results/"
+	// resultsDownload is the path tools GET a plugin's results from, as a
+	// gzipped tarball.
+	resultsDownload = "/api/v1/results/{plugin}"
+
+	// ResultsReaderName is the common name of the client certificate that
+	// can read every plugin's results. A plugin's own certificate can only
+	// read its results.
+	ResultsReaderName = "sonobuoy-results-reader"
+	// ResultsReaderSecretName is the name of the kubernetes.io/tls Secret the
+	// aggregator keeps the results reader's certificate in, along with the
+	// CA certificate of the aggregator's server.
+	ResultsReaderSecretName = "sonobuoy-results-reader"
+)
+
+// PluginResults are the results a plugin has submitted so far.
+type PluginResults struct {
+	Plugin  string           `json:"plugin"`
+	Results []ReceivedResult `json:"results"`
+}
+
+// ReceivedResult is a single result the aggregator has received, from a node
+// or, if Node is empty, global.
+type ReceivedResult struct {
+	Node       string `json:"node,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Incomplete bool   `json:"incomplete,omitempty"`
+}
+
+// ReceivedResults returns the results received so far, by plugin, sorted by
+// plugin and node.
+func (a *Aggregator) ReceivedResults() []PluginResults {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	byPlugin := map[string][]ReceivedResult{}
+	for _, result := range a.Results {
+		byPlugin[result.ResultType] = append(byPlugin[result.ResultType], ReceivedResult{
+			Node:       result.NodeName,
+			Error:      result.Error,
+			Incomplete: result.Incomplete,
+		})
+	}
+
+	received := make([]PluginResults, 0, len(byPlugin))
+	for resultType, results := range byPlugin {
+		sort.Slice(results, func(i, j int) bool { return results[i].Node < results[j].Node })
+		received = append(received, PluginResults{Plugin: resultType, Results: results})
+	}
+	sort.Slice(received, func(i, j int) bool { return received[i].Plugin < received[j].Plugin })
+	return received
+}
+
+// HandleResults adds the routes tools read results through while the run is
+// going: a list of the results received so far, and each plugin's results
+// as a gzipped tarball.
+func (h *Handler) HandleResults(aggr *Aggregator) {
+	h.HandleFunc(resultsList, resultsListHandler(aggr)).Methods("GET")
+	h.HandleFunc(resultsDownload, resultsDownloadHandler(aggr)).Methods("GET")
+}
+
+// resultsListHandler serves the results received so far as a JSON list of
+// PluginResults.
+func resultsListHandler(aggr *Aggregator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logRequest(r)
+		w.Header().Set("content-type", "application/json")
+		if err := json.NewEncoder(w).Encode(aggr.ReceivedResults()); err != nil {
+			logrus.WithError(err).Warning("couldn't send results list")
+		}
+	}
+}
+
+// resultsDownloadHandler serves everything stored so far for the plugin in
+// the request path, laid out as in the plugin's directory of the results
+// tarball. The files are listed while results are held back, but sent after,
+// so a slow client doesn't hold up results coming in; files replaced or
+// removed since they were listed are left out.
+func resultsDownloadHandler(aggr *Aggregator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logRequest(r)
+		resultType := mux.Vars(r)["plugin"]
+
+		resultDir := filepath.Join(aggr.OutputDir, resultType)
+
+		aggr.resultsMutex.Lock()
+		if !aggr.hasResults(resultType) {
+			aggr.resultsMutex.Unlock()
+			http.Error(w, fmt.Sprintf("No results received for plugin %v", resultType), http.StatusNotFound)
+			return
+		}
+		files, err := tarball.ListFiles(resultDir)
+		aggr.resultsMutex.Unlock()
+		if err != nil {
+			logrus.WithError(err).WithField("plugin_name", resultType).Error("couldn't list plugin results")
+			http.Error(w, fmt.Sprintf("Couldn't read results for plugin %v", resultType), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("content-type", gzipMimeType)
+		w.Header().Set(ContentDispositionHeader, fmt.Sprintf("attachment; filename=%q", resultType+".tar.gz"))
+		if err := tarball.EncodeFiles(w, resultDir, files); err != nil {
+			// The response has already started, so the client only sees a
+			// truncated tarball.
+			logrus.WithError(err).WithField("plugin_name", resultType).Warning("couldn't send plugin results")
+		}
+	}
+}
+
+// hasResults reports whether any results have been received for a result
+// type. The caller must hold resultsMutex.
+func (a *Aggregator) hasResults(resultType string) bool {
+	for _, result := range a.Results {
+		if result.ResultType == resultType {
+			return true
+		}
+	}
+	return false
+}
+
+// isResultsRead reports whether a request is to read results, which the
+// results reader is allowed to do as well as the plugin they're for.
+func isResultsRead(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if r.Method != http.MethodGet || route == nil {
+		return false
+	}
+	tmpl, err := route.GetPathTemplate()
+	return err == nil && (tmpl == resultsList || tmpl == resultsDownload)
+}
+
+// saveResultsReader issues the results reader's certificate and stores it in
+// the ResultsReaderSecretName Secret, replacing any a previous aggregator for
+// the run stored. caPEM is the CA certificate readers verify the server with.
+func saveResultsReader(client kubernetes.Interface, namespace string, auth *ca.Authority, caPEM []byte, labels, annotations map[string]string) error {
+	cert, err := auth.ClientKeyPair(ResultsReaderName)
+	if err != nil {
+		return errors.Wrap(err, "couldn't issue results reader certificate")
+	}
+	certPEM, keyPEM, err := encodeKeyPair(cert)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode results reader certificate")
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        ResultsReaderSecretName,
+			Namespace:   namespace,
+			Labels:      plugin.MergeMetadata(labels, map[string]string{"component": "sonobuoy"}),
+			Annotations: annotations,
+		},
+		Data: map[string][]byte{
+			v1.TLSCertKey:       certPEM,
+			v1.TLSPrivateKeyKey: keyPEM,
+			TLSCAFile:           caPEM,
+		},
+		Type: v1.SecretTypeTLS,
+	}
+	secrets := client.CoreV1().Secrets(namespace)
+	_, err = secrets.Update(secret)
+	if kubeerrors.IsNotFound(err) {
+		_, err = secrets.Create(secret)
+	}
+	return errors.Wrap(err, "couldn't save results reader secret")
+}
+
+// serverCAPEM returns the PEM-encoded certificate of the CA that issued the
+// server's certificate: the one in certDir if it's served from there, or
+// otherwise the run's.
+func serverCAPEM(certDir string, runCA *x509.Certificate) ([]byte, error) {
+	if certDir == "" {
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: runCA.Raw}), nil
+	}
+	caPEM, err := ioutil.ReadFile(filepath.Join(certDir, TLSCAFile))
+	if os.IsNotExist(err) {
+		// The certificate is signed by a CA readers already trust.
+		return nil, nil
+	}
+	return caPEM, errors.Wrap(err, "couldn't read serving CA certificate")
+}
+
+// encodeKeyPair PEM-encodes a certificate and its ECDSA private key.
+func encodeKeyPair(cert *tls.Certificate) (certPEM, keyPEM []byte, err error) {
+	key, ok := cert.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("private key not ECDSA")
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, nil, errors.New("no certs in tls.certificate")
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/backplane/ca"
+	"github.com/heptio/sonobuoy/pkg/backplane/ca/authtest"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/tarball"
+)
+
+func TestResultsAPI(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		{ResultType: "e2e"},
+		{ResultType: "systemd_logs", NodeName: "node1"},
+		{ResultType: "systemd_logs", NodeName: "node2"},
+	}
+	withAggregator(t, expected, func(agg *Aggregator, srv *authtest.Server) {
+		handler := srv.Config.Handler.(*Handler)
+		handler.HandleResults(agg)
+		handler.HandleFunc(payloadPath, payloadHandler(nil)).Methods("GET")
+		handler.Use(RequirePluginCert)
+
+		URL, err := NodeResultURL(srv.URL, "node1", "systemd_logs")
+		if err != nil {
+			t.Fatalf("error getting node result URL %v", err)
+		}
+		response := doRequest(t, srv.ClientWithName("systemd_logs"), "PUT", URL, []byte("node1 logs"))
+		if response.StatusCode != http.StatusOK {
+			t.Fatalf("Expected a 200 for results, got %v", response.StatusCode)
+		}
+
+		testCases := []struct {
+			name     string
+			client   string
+			path     string
+			expected int
+		}{
+			{name: "list as reader", client: ResultsReaderName, path: "/api/v1/results/", expected: http.StatusOK},
+			{name: "list as plugin", client: "systemd_logs", path: "/api/v1/results/", expected: http.StatusForbidden},
+			{name: "download as reader", client: ResultsReaderName, path: "/api/v1/results/systemd_logs", expected: http.StatusOK},
+			{name: "download as plugin", client: "systemd_logs", path: "/api/v1/results/systemd_logs", expected: http.StatusOK},
+			{name: "download as other plugin", client: "e2e", path: "/api/v1/results/systemd_logs", expected: http.StatusForbidden},
+			{name: "download without results", client: ResultsReaderName, path: "/api/v1/results/e2e", expected: http.StatusNotFound},
+			{name: "payload as reader", client: ResultsReaderName, path: "/api/v1/payload/e2e", expected: http.StatusForbidden},
+		}
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				response, err := srv.ClientWithName(tc.client).Get(srv.URL + tc.path)
+				if err != nil {
+					t.Fatalf("couldn't get %v: %v", tc.path, err)
+				}
+				defer response.Body.Close()
+				if response.StatusCode != tc.expected {
+					t.Errorf("Expected a %v, got %v", tc.expected, response.StatusCode)
+				}
+			})
+		}
+
+		response, err = srv.ClientWithName(ResultsReaderName).Get(srv.URL + "/api/v1/results/")
+		if err != nil {
+			t.Fatalf("couldn't list results: %v", err)
+		}
+		var listed []PluginResults
+		err = json.NewDecoder(response.Body).Decode(&listed)
+		response.Body.Close()
+		if err != nil {
+			t.Fatalf("couldn't decode results list: %v", err)
+		}
+		expectedList := []PluginResults{{Plugin: "systemd_logs", Results: []ReceivedResult{{Node: "node1"}}}}
+		if !reflect.DeepEqual(listed, expectedList) {
+			t.Errorf("expected results %+v, got %+v", expectedList, listed)
+		}
+
+		response, err = srv.ClientWithName(ResultsReaderName).Get(srv.URL + "/api/v1/results/systemd_logs")
+		if err != nil {
+			t.Fatalf("couldn't download results: %v", err)
+		}
+		defer response.Body.Close()
+		dir, err := ioutil.TempDir("", "sonobuoy_results_api_test")
+		if err != nil {
+			t.Fatalf("Could not create temp directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		if err := tarball.DecodeTarball(response.Body, dir); err != nil {
+			t.Fatalf("couldn't decode results tarball: %v", err)
+		}
+		contents, err := ioutil.ReadFile(filepath.Join(dir, "results", "node1"))
+		if err != nil {
+			t.Fatalf("expected node1's results in the tarball: %v", err)
+		}
+		if string(contents) != "node1 logs" {
+			t.Errorf("expected node1's results to be %q, got %q", "node1 logs", contents)
+		}
+	})
+}
+
+func TestEncodeKeyPair(t *testing.T) {
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make authority: %v", err)
+	}
+	cert, err := auth.ClientKeyPair(ResultsReaderName)
+	if err != nil {
+		t.Fatalf("couldn't issue certificate: %v", err)
+	}
+
+	certPEM, keyPEM, err := encodeKeyPair(cert)
+	if err != nil {
+		t.Fatalf("unexpected error encoding key pair: %v", err)
+	}
+	decoded, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("couldn't decode encoded key pair: %v", err)
+	}
+	if !reflect.DeepEqual(decoded.Certificate[0], cert.Certificate[0]) {
+		t.Error("expected the encoded certificate to be the one issued")
+	}
+}
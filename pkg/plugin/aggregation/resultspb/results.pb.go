@@ -0,0 +1,538 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: results.proto
+
+/*
+Package resultspb is a generated protocol buffer package.
+
+It is generated from these files:
+
+	results.proto
+
+It has these top-level messages:
+
+	SubmitRequest
+	Header
+	Progress
+	Chunk
+	Done
+	SubmitResponse
+*/
+package resultspb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type SubmitRequest struct {
+	// Types that are valid to be assigned to Request:
+	//	*SubmitRequest_Header
+	//	*SubmitRequest_Progress
+	//	*SubmitRequest_Chunk
+	//	*SubmitRequest_Done
+	Request isSubmitRequest_Request `protobuf_oneof:"request"`
+}
+
+func (m *SubmitRequest) Reset()                    { *m = SubmitRequest{} }
+func (m *SubmitRequest) String() string            { return proto.CompactTextString(m) }
+func (*SubmitRequest) ProtoMessage()               {}
+func (*SubmitRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+type isSubmitRequest_Request interface{ isSubmitRequest_Request() }
+
+type SubmitRequest_Header struct {
+	Header *Header `protobuf:"bytes,1,opt,name=header,oneof"`
+}
+type SubmitRequest_Progress struct {
+	Progress *Progress `protobuf:"bytes,2,opt,name=progress,oneof"`
+}
+type SubmitRequest_Chunk struct {
+	Chunk *Chunk `protobuf:"bytes,3,opt,name=chunk,oneof"`
+}
+type SubmitRequest_Done struct {
+	Done *Done `protobuf:"bytes,4,opt,name=done,oneof"`
+}
+
+func (*SubmitRequest_Header) isSubmitRequest_Request()   {}
+func (*SubmitRequest_Progress) isSubmitRequest_Request() {}
+func (*SubmitRequest_Chunk) isSubmitRequest_Request()    {}
+func (*SubmitRequest_Done) isSubmitRequest_Request()     {}
+
+func (m *SubmitRequest) GetRequest() isSubmitRequest_Request {
+	if m != nil {
+		return m.Request
+	}
+	return nil
+}
+
+func (m *SubmitRequest) GetHeader() *Header {
+	if x, ok := m.GetRequest().(*SubmitRequest_Header); ok {
+		return x.Header
+	}
+	return nil
+}
+
+func (m *SubmitRequest) GetProgress() *Progress {
+	if x, ok := m.GetRequest().(*SubmitRequest_Progress); ok {
+		return x.Progress
+	}
+	return nil
+}
+
+func (m *SubmitRequest) GetChunk() *Chunk {
+	if x, ok := m.GetRequest().(*SubmitRequest_Chunk); ok {
+		return x.Chunk
+	}
+	return nil
+}
+
+func (m *SubmitRequest) GetDone() *Done {
+	if x, ok := m.GetRequest().(*SubmitRequest_Done); ok {
+		return x.Done
+	}
+	return nil
+}
+
+// XXX_OneofFuncs is for the internal use of the proto package.
+func (*SubmitRequest) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), func(msg proto.Message) (n int), []interface{}) {
+	return _SubmitRequest_OneofMarshaler, _SubmitRequest_OneofUnmarshaler, _SubmitRequest_OneofSizer, []interface{}{
+		(*SubmitRequest_Header)(nil),
+		(*SubmitRequest_Progress)(nil),
+		(*SubmitRequest_Chunk)(nil),
+		(*SubmitRequest_Done)(nil),
+	}
+}
+
+func _SubmitRequest_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
+	m := msg.(*SubmitRequest)
+	// request
+	switch x := m.Request.(type) {
+	case *SubmitRequest_Header:
+		b.EncodeVarint(1<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Header); err != nil {
+			return err
+		}
+	case *SubmitRequest_Progress:
+		b.EncodeVarint(2<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Progress); err != nil {
+			return err
+		}
+	case *SubmitRequest_Chunk:
+		b.EncodeVarint(3<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Chunk); err != nil {
+			return err
+		}
+	case *SubmitRequest_Done:
+		b.EncodeVarint(4<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Done); err != nil {
+			return err
+		}
+	case nil:
+	default:
+		return fmt.Errorf("SubmitRequest.Request has unexpected type %T", x)
+	}
+	return nil
+}
+
+func _SubmitRequest_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error) {
+	m := msg.(*SubmitRequest)
+	switch tag {
+	case 1: // request.header
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Header)
+		err := b.DecodeMessage(msg)
+		m.Request = &SubmitRequest_Header{msg}
+		return true, err
+	case 2: // request.progress
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Progress)
+		err := b.DecodeMessage(msg)
+		m.Request = &SubmitRequest_Progress{msg}
+		return true, err
+	case 3: // request.chunk
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Chunk)
+		err := b.DecodeMessage(msg)
+		m.Request = &SubmitRequest_Chunk{msg}
+		return true, err
+	case 4: // request.done
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Done)
+		err := b.DecodeMessage(msg)
+		m.Request = &SubmitRequest_Done{msg}
+		return true, err
+	default:
+		return false, nil
+	}
+}
+
+func _SubmitRequest_OneofSizer(msg proto.Message) (n int) {
+	m := msg.(*SubmitRequest)
+	// request
+	switch x := m.Request.(type) {
+	case *SubmitRequest_Header:
+		s := proto.Size(x.Header)
+		n += proto.SizeVarint(1<<3 | proto.WireBytes)
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *SubmitRequest_Progress:
+		s := proto.Size(x.Progress)
+		n += proto.SizeVarint(2<<3 | proto.WireBytes)
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *SubmitRequest_Chunk:
+		s := proto.Size(x.Chunk)
+		n += proto.SizeVarint(3<<3 | proto.WireBytes)
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *SubmitRequest_Done:
+		s := proto.Size(x.Done)
+		n += proto.SizeVarint(4<<3 | proto.WireBytes)
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case nil:
+	default:
+		panic(fmt.Sprintf("proto: unexpected type %T in oneof", x))
+	}
+	return n
+}
+
+// Header identifies the result a stream is for, and how it's stored.
+type Header struct {
+	Plugin string `protobuf:"bytes,1,opt,name=plugin" json:"plugin,omitempty"`
+	// node is empty for global results.
+	Node string `protobuf:"bytes,2,opt,name=node" json:"node,omitempty"`
+	// filename is what to store one of several files of a result as.
+	Filename string `protobuf:"bytes,3,opt,name=filename" json:"filename,omitempty"`
+	MimeType string `protobuf:"bytes,4,opt,name=mime_type,json=mimeType" json:"mime_type,omitempty"`
+	// partial is set on every file of a multi-file result except the last.
+	Partial bool `protobuf:"varint,5,opt,name=partial" json:"partial,omitempty"`
+	// timed_out reports that the plugin didn't finish in time, in place of
+	// its results.
+	TimedOut bool `protobuf:"varint,6,opt,name=timed_out,json=timedOut" json:"timed_out,omitempty"`
+	// incomplete marks what the plugin had written when the run was about to
+	// time out, sent because the master asked for it.
+	Incomplete bool `protobuf:"varint,7,opt,name=incomplete" json:"incomplete,omitempty"`
+}
+
+func (m *Header) Reset()                    { *m = Header{} }
+func (m *Header) String() string            { return proto.CompactTextString(m) }
+func (*Header) ProtoMessage()               {}
+func (*Header) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *Header) GetPlugin() string {
+	if m != nil {
+		return m.Plugin
+	}
+	return ""
+}
+
+func (m *Header) GetNode() string {
+	if m != nil {
+		return m.Node
+	}
+	return ""
+}
+
+func (m *Header) GetFilename() string {
+	if m != nil {
+		return m.Filename
+	}
+	return ""
+}
+
+func (m *Header) GetMimeType() string {
+	if m != nil {
+		return m.MimeType
+	}
+	return ""
+}
+
+func (m *Header) GetPartial() bool {
+	if m != nil {
+		return m.Partial
+	}
+	return false
+}
+
+func (m *Header) GetTimedOut() bool {
+	if m != nil {
+		return m.TimedOut
+	}
+	return false
+}
+
+func (m *Header) GetIncomplete() bool {
+	if m != nil {
+		return m.Incomplete
+	}
+	return false
+}
+
+// Progress is an incremental report of how far along the plugin is.
+type Progress struct {
+	Completed int32  `protobuf:"varint,1,opt,name=completed" json:"completed,omitempty"`
+	Total     int32  `protobuf:"varint,2,opt,name=total" json:"total,omitempty"`
+	Message   string `protobuf:"bytes,3,opt,name=message" json:"message,omitempty"`
+}
+
+func (m *Progress) Reset()                    { *m = Progress{} }
+func (m *Progress) String() string            { return proto.CompactTextString(m) }
+func (*Progress) ProtoMessage()               {}
+func (*Progress) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *Progress) GetCompleted() int32 {
+	if m != nil {
+		return m.Completed
+	}
+	return 0
+}
+
+func (m *Progress) GetTotal() int32 {
+	if m != nil {
+		return m.Total
+	}
+	return 0
+}
+
+func (m *Progress) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+// Chunk is the next part of the result.
+type Chunk struct {
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *Chunk) Reset()                    { *m = Chunk{} }
+func (m *Chunk) String() string            { return proto.CompactTextString(m) }
+func (*Chunk) ProtoMessage()               {}
+func (*Chunk) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *Chunk) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+// Done ends the result.
+type Done struct {
+	// sha256 is the hex-encoded SHA256 of the result, if the worker has it.
+	Sha256 string `protobuf:"bytes,1,opt,name=sha256" json:"sha256,omitempty"`
+}
+
+func (m *Done) Reset()                    { *m = Done{} }
+func (m *Done) String() string            { return proto.CompactTextString(m) }
+func (*Done) ProtoMessage()               {}
+func (*Done) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *Done) GetSha256() string {
+	if m != nil {
+		return m.Sha256
+	}
+	return ""
+}
+
+type SubmitResponse struct {
+	// stored is set once the result has been stored.
+	Stored bool `protobuf:"varint,1,opt,name=stored" json:"stored,omitempty"`
+}
+
+func (m *SubmitResponse) Reset()                    { *m = SubmitResponse{} }
+func (m *SubmitResponse) String() string            { return proto.CompactTextString(m) }
+func (*SubmitResponse) ProtoMessage()               {}
+func (*SubmitResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *SubmitResponse) GetStored() bool {
+	if m != nil {
+		return m.Stored
+	}
+	return false
+}
+
+func init() {
+	proto.RegisterType((*SubmitRequest)(nil), "sonobuoy.results.v1.SubmitRequest")
+	proto.RegisterType((*Header)(nil), "sonobuoy.results.v1.Header")
+	proto.RegisterType((*Progress)(nil), "sonobuoy.results.v1.Progress")
+	proto.RegisterType((*Chunk)(nil), "sonobuoy.results.v1.Chunk")
+	proto.RegisterType((*Done)(nil), "sonobuoy.results.v1.Done")
+	proto.RegisterType((*SubmitResponse)(nil), "sonobuoy.results.v1.SubmitResponse")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for Results service
+
+type ResultsClient interface {
+	// Submit streams a plugin's progress and results to the aggregator. The
+	// first request must be a header saying which result the stream is for.
+	// Progress updates can follow at any time. A result is sent as chunks
+	// ending with done, which the aggregator answers once it has stored the
+	// result; a stream that only relays progress is closed without any chunks.
+	// Failures end the stream with a status whose code says whether the
+	// submission is worth retrying.
+	Submit(ctx context.Context, opts ...grpc.CallOption) (Results_SubmitClient, error)
+}
+
+type resultsClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewResultsClient(cc *grpc.ClientConn) ResultsClient {
+	return &resultsClient{cc}
+}
+
+func (c *resultsClient) Submit(ctx context.Context, opts ...grpc.CallOption) (Results_SubmitClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Results_serviceDesc.Streams[0], c.cc, "/sonobuoy.results.v1.Results/Submit", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &resultsSubmitClient{stream}
+	return x, nil
+}
+
+type Results_SubmitClient interface {
+	Send(*SubmitRequest) error
+	Recv() (*SubmitResponse, error)
+	grpc.ClientStream
+}
+
+type resultsSubmitClient struct {
+	grpc.ClientStream
+}
+
+func (x *resultsSubmitClient) Send(m *SubmitRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *resultsSubmitClient) Recv() (*SubmitResponse, error) {
+	m := new(SubmitResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for Results service
+
+type ResultsServer interface {
+	// Submit streams a plugin's progress and results to the aggregator. The
+	// first request must be a header saying which result the stream is for.
+	// Progress updates can follow at any time. A result is sent as chunks
+	// ending with done, which the aggregator answers once it has stored the
+	// result; a stream that only relays progress is closed without any chunks.
+	// Failures end the stream with a status whose code says whether the
+	// submission is worth retrying.
+	Submit(Results_SubmitServer) error
+}
+
+func RegisterResultsServer(s *grpc.Server, srv ResultsServer) {
+	s.RegisterService(&_Results_serviceDesc, srv)
+}
+
+func _Results_Submit_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ResultsServer).Submit(&resultsSubmitServer{stream})
+}
+
+type Results_SubmitServer interface {
+	Send(*SubmitResponse) error
+	Recv() (*SubmitRequest, error)
+	grpc.ServerStream
+}
+
+type resultsSubmitServer struct {
+	grpc.ServerStream
+}
+
+func (x *resultsSubmitServer) Send(m *SubmitResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *resultsSubmitServer) Recv() (*SubmitRequest, error) {
+	m := new(SubmitRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _Results_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "sonobuoy.results.v1.Results",
+	HandlerType: (*ResultsServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Submit",
+			Handler:       _Results_Submit_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "results.proto",
+}
+
+func init() { proto.RegisterFile("results.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 427 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x53, 0xc1, 0x8e, 0xd3, 0x30,
+	0x14, 0x6c, 0xa0, 0x49, 0x93, 0xb7, 0x2c, 0x87, 0x07, 0x42, 0xa1, 0x85, 0xd5, 0x2a, 0x5c, 0x7a,
+	0x2a, 0x50, 0xb4, 0x5c, 0xb8, 0x2d, 0x1c, 0x72, 0x03, 0x19, 0x90, 0x10, 0x97, 0xc5, 0xdd, 0x3c,
+	0xda, 0x88, 0xc4, 0x36, 0xb1, 0x83, 0xd4, 0xff, 0xe3, 0x8f, 0xf8, 0x01, 0x94, 0xe7, 0x78, 0x01,
+	0x29, 0xe2, 0xe6, 0x19, 0xcf, 0x24, 0x6f, 0xc6, 0x36, 0x9c, 0x76, 0x64, 0xfb, 0xc6, 0xd9, 0x8d,
+	0xe9, 0xb4, 0xd3, 0x78, 0xcf, 0x6a, 0xa5, 0x77, 0xbd, 0x3e, 0x6e, 0x02, 0xff, 0xe3, 0x79, 0xf1,
+	0x2b, 0x82, 0xd3, 0xf7, 0xfd, 0xae, 0xad, 0x9d, 0xa0, 0xef, 0x3d, 0x59, 0x87, 0x17, 0x90, 0x1c,
+	0x48, 0x56, 0xd4, 0xe5, 0xd1, 0x79, 0xb4, 0x3e, 0xd9, 0xae, 0x36, 0x13, 0xbe, 0x4d, 0xc9, 0x92,
+	0x72, 0x26, 0x46, 0x31, 0xbe, 0x82, 0xd4, 0x74, 0x7a, 0xdf, 0x91, 0xb5, 0xf9, 0x2d, 0x36, 0x3e,
+	0x9e, 0x34, 0xbe, 0x1b, 0x45, 0xe5, 0x4c, 0xdc, 0x18, 0x70, 0x0b, 0xf1, 0xf5, 0xa1, 0x57, 0xdf,
+	0xf2, 0xdb, 0xec, 0x5c, 0x4e, 0x3a, 0x5f, 0x0f, 0x8a, 0x72, 0x26, 0xbc, 0x14, 0x9f, 0xc2, 0xbc,
+	0xd2, 0x8a, 0xf2, 0x39, 0x5b, 0x1e, 0x4e, 0x5a, 0xde, 0x68, 0x45, 0xe5, 0x4c, 0xb0, 0xf0, 0x32,
+	0x83, 0x45, 0xe7, 0x33, 0x16, 0x3f, 0x23, 0x48, 0x7c, 0x02, 0x7c, 0x00, 0x89, 0x69, 0xfa, 0x7d,
+	0xad, 0x38, 0x6e, 0x26, 0x46, 0x84, 0x08, 0x73, 0xa5, 0x2b, 0xe2, 0x2c, 0x99, 0xe0, 0x35, 0x2e,
+	0x21, 0xfd, 0x5a, 0x37, 0xa4, 0x64, 0x4b, 0x3c, 0x69, 0x26, 0x6e, 0x30, 0xae, 0x20, 0x6b, 0xeb,
+	0x96, 0xae, 0xdc, 0xd1, 0xf8, 0x99, 0x32, 0x91, 0x0e, 0xc4, 0x87, 0xa3, 0x21, 0xcc, 0x61, 0x61,
+	0x64, 0xe7, 0x6a, 0xd9, 0xe4, 0xf1, 0x79, 0xb4, 0x4e, 0x45, 0x80, 0x83, 0xcd, 0xd5, 0x2d, 0x55,
+	0x57, 0xba, 0x77, 0x79, 0xc2, 0x7b, 0x29, 0x13, 0x6f, 0x7b, 0x87, 0x67, 0x00, 0xb5, 0xba, 0xd6,
+	0xad, 0x69, 0xc8, 0x51, 0xbe, 0xe0, 0xdd, 0xbf, 0x98, 0xe2, 0x13, 0xa4, 0xa1, 0x4e, 0x7c, 0x04,
+	0x59, 0xe0, 0x2b, 0x8e, 0x12, 0x8b, 0x3f, 0x04, 0xde, 0x87, 0xd8, 0x69, 0x27, 0x1b, 0x8e, 0x13,
+	0x0b, 0x0f, 0x86, 0xb1, 0x5a, 0xb2, 0x56, 0xee, 0x43, 0x9c, 0x00, 0x8b, 0x15, 0xc4, 0x5c, 0xf7,
+	0x50, 0x43, 0x25, 0x9d, 0xe4, 0x2f, 0xde, 0x11, 0xbc, 0x2e, 0xce, 0x60, 0x3e, 0x14, 0x3b, 0x54,
+	0x67, 0x0f, 0x72, 0x7b, 0xf1, 0x32, 0x54, 0xe7, 0x51, 0xb1, 0x86, 0xbb, 0xe1, 0x4a, 0x59, 0xa3,
+	0x95, 0xf5, 0x4a, 0xa7, 0xbb, 0x71, 0xb2, 0x54, 0x8c, 0x68, 0xfb, 0x05, 0x16, 0xc2, 0x9f, 0x16,
+	0x7e, 0x84, 0xc4, 0x9b, 0xb0, 0x98, 0x3c, 0xca, 0x7f, 0x2e, 0xe9, 0xf2, 0xc9, 0x7f, 0x35, 0xfe,
+	0xaf, 0xeb, 0xe8, 0x59, 0x74, 0x79, 0xf2, 0x39, 0x1b, 0x05, 0x66, 0xb7, 0x4b, 0xf8, 0x21, 0xbc,
+	0xf8, 0x3d, 0x00, 0x50, 0x24, 0xd3, 0x31, 0x19, 0x03, 0x00, 0x00,
+}
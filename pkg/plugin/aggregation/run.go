@@ -17,17 +17,25 @@ limitations under the License.
 package aggregation
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/heptio/sonobuoy/pkg/backplane/ca"
+	"github.com/heptio/sonobuoy/pkg/errlog"
 	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/tracing"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 var annotationUpdateFreq = 5 * time.Second
@@ -40,23 +48,46 @@ var annotationUpdateFreq = 5 * time.Second
 // 1. Create the aggregator object (`aggr`) to keep track of results
 // 2. Launch the HTTP server with the aggr's HandleHTTPResult function as the
 //    callback
-// 3. Run all the aggregation plugins, monitoring each one in a goroutine,
-//    configuring them to send failure results through a shared channel
+// 3. Run all the aggregation plugins, monitoring each one (and its timeout, if
+//    it has one) in a goroutine, configuring them to send failure results
+//    through a shared channel. Plugins that depend on others wait for them to
+//    succeed first.
 // 4. Hook the shared monitoring channel up to aggr's IngestResults() function
 // 5. Block until aggr shows all results accounted for (results come in through
 //    the HTTP callback), stopping the HTTP server on completion
-func Run(client kubernetes.Interface, plugins []plugin.Interface, cfg plugin.AggregationConfig, namespace, outdir string) error {
+//
+// If the run is traced, launching each plugin, waiting for its results and
+// handling them are traced within the given span.
+func Run(client kubernetes.Interface, restConfig *rest.Config, plugins []plugin.Interface, cfg plugin.AggregationConfig, namespace, outdir string, trace *tracing.Span) (err error) {
 	// Construct a list of things we'll need to dispatch
 	if len(plugins) == 0 {
 		logrus.Info("Skipping host data gathering: no plugins defined")
 		return nil
 	}
 
+	span := trace.Child("aggregation", nil)
+	defer func() { span.End(err) }()
+
+	resultProcessors, err := pluginResultProcessors(plugins)
+	if err != nil {
+		return err
+	}
+	resultFormats, err := pluginResultFormats(plugins)
+	if err != nil {
+		return err
+	}
+
 	// Get a list of nodes so the plugins can properly estimate what
 	// results they'll give.
 	// TODO: there are other places that iterate through the CoreV1.Nodes API
 	// call, we should only do this in one place and cache it.
+	// Namespace-scoped runs may not be allowed to list nodes, but they only
+	// launch plugins that don't need them.
 	nodes, err := client.CoreV1().Nodes().List(metav1.ListOptions{})
+	if apierrors.IsForbidden(err) {
+		logrus.Warning("Not allowed to list nodes, continuing without them")
+		nodes, err = &v1.NodeList{}, nil
+	}
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -72,10 +103,53 @@ func Run(client kubernetes.Interface, plugins []plugin.Interface, cfg plugin.Agg
 		return errors.Wrap(err, "couldn't make new certificate authority for plugin aggregator")
 	}
 
+	// A resumable run picks up where a previous aggregator for the same run
+	// left off, with the same expected results and certificate authority,
+	// so the plugins it launched can still submit their results.
+	var store *runStateStore
+	started := time.Now()
+	if cfg.Resumable {
+		store, err = loadRunState(client, namespace, outdir, expectedResults, auth)
+		if err != nil {
+			return errors.Wrap(err, "couldn't load run state")
+		}
+		store.labels, store.annotations = cfg.Labels, cfg.Annotations
+		defer func() {
+			if err := store.delete(); err != nil {
+				errlog.LogError(err)
+			}
+		}()
+		if store.resumed {
+			logrus.WithField("launched", store.state.Launched).Info("Resuming run")
+		}
+		expectedResults, auth, started = store.state.Expected, store.auth, store.state.Started
+		if err := store.save(); err != nil {
+			return err
+		}
+	}
+
+	var issuedTokens map[string]string
+	if store != nil {
+		issuedTokens = store.state.Tokens
+	}
+	tokens := newPluginTokens(issuedTokens)
+
 	logrus.Infof("Starting server Expected Results: %v", expectedResults)
 
 	// 1. Await results from each plugin
 	aggr := NewAggregator(outdir+"/plugins", expectedResults)
+	if store != nil && store.resumed {
+		aggr.restore(store.state.Received)
+	}
+	aggr.MaxPluginBytes = cfg.MaxResultBytes
+	aggr.MaxTotalBytes = cfg.MaxTotalResultBytes
+	aggr.MinFreeBytes = cfg.MinFreeBytes
+	aggr.AllowMixedVersions = cfg.AllowMixedVersions
+	aggr.Trace = span
+	aggr.Processors = resultProcessors
+	aggr.Formats = resultFormats
+	// Duplicates of results whose uploads never finished aren't kept.
+	defer aggr.discardDuplicates()
 	doneAggr := make(chan bool, 1)
 	monitorCh := make(chan *plugin.Result, len(expectedResults))
 	stopWaitCh := make(chan bool, 1)
@@ -91,15 +165,41 @@ func Run(client kubernetes.Interface, plugins []plugin.Interface, cfg plugin.Agg
 		advertiseAddress = host
 	}
 
-	tlsCfg, err := auth.MakeServerConfig(advertiseAddress)
+	var tlsCfg *tls.Config
+	if cfg.TLSCertDir != "" {
+		tlsCfg, err = makeServerConfigFromDir(cfg.TLSCertDir, auth.CACertPool())
+	} else {
+		tlsCfg, err = auth.MakeServerConfig(advertiseAddress)
+	}
 	if err != nil {
 		return errors.Wrap(err, "couldn't get a server certificate")
 	}
 
-	// 2. Launch the aggregation servers
+	// Reading results as they come in is only a convenience, so the run
+	// carries on if readers can't be given a certificate.
+	caPEM, err := serverCAPEM(cfg.TLSCertDir, auth.CACert())
+	if err == nil {
+		err = saveResultsReader(client, namespace, auth, caPEM, cfg.Labels, cfg.Annotations)
+	}
+	if err != nil {
+		errlog.LogError(err)
+	}
+
+	// 2. Launch the aggregation servers, only accepting results from the
+	// plugin they're for
+	handler := NewHandler(aggr.HandleHTTPResult, aggr.HandleHTTPProgress, aggr.HandleHTTPHeartbeat)
+	// Workers download their plugin's files, if it has any, before it starts.
+	handler.HandleFunc(payloadPath, payloadHandler(pluginPayloads(plugins))).Methods("GET")
+	// Tools can read results as they come in, rather than waiting for the
+	// results tarball.
+	handler.HandleResults(aggr)
+	handler.Use(RequirePluginCert)
+	handler.Use(tokens.requireToken)
+	// Workers may also submit over gRPC, on the same port.
+	grpcServer := NewGRPCServer(handler, tokens)
 	srv := &http.Server{
-		Addr:      fmt.Sprintf("%s:%d", cfg.BindAddress, cfg.BindPort),
-		Handler:   NewHandler(aggr.HandleHTTPResult),
+		Addr:      net.JoinHostPort(cfg.BindAddress, strconv.Itoa(cfg.BindPort)),
+		Handler:   WithGRPC(grpcServer, handler),
 		TLSConfig: tlsCfg,
 	}
 
@@ -112,48 +212,242 @@ func Run(client kubernetes.Interface, plugins []plugin.Interface, cfg plugin.Agg
 		doneServ <- srv.ListenAndServeTLS("", "")
 	}()
 
+	// Metrics are only informational, so the run carries on without them if
+	// their server can't start.
+	if cfg.MetricsPort != 0 {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", aggr.MetricsHandler())
+		// Dashboards and CI can follow the run's events, rather than
+		// polling its status.
+		metricsMux.Handle(EventsPath, aggr.EventsHandler())
+		metricsSrv := &http.Server{
+			Addr:    net.JoinHostPort(cfg.BindAddress, strconv.Itoa(cfg.MetricsPort)),
+			Handler: metricsMux,
+		}
+		// Give event streams a chance to send the end of the run before
+		// they're closed.
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), eventsShutdownTimeout)
+			defer cancel()
+			if err := metricsSrv.Shutdown(ctx); err != nil {
+				metricsSrv.Close()
+			}
+		}()
+
+		go func() {
+			logrus.WithFields(logrus.Fields{
+				"address": cfg.BindAddress,
+				"port":    cfg.MetricsPort,
+			}).Info("starting metrics server")
+			if err := metricsSrv.ListenAndServe(); err != http.ErrServerClosed {
+				logrus.WithError(err).Warning("metrics server stopped")
+			}
+		}()
+	}
+
 	updater := newUpdater(expectedResults, namespace, client)
 	ticker := time.NewTicker(annotationUpdateFreq)
 
+	// However the run ends, index what results it got for tools reading the
+	// results tarball.
+	defer func() {
+		updater.ReceiveAll(aggr.Results)
+		updater.ReceiveErrors(aggr.LatestErrors())
+		if err := writeResultsIndex(outdir, plugins, updater); err != nil {
+			errlog.LogError(err)
+		}
+		aggr.RunComplete(updater.RunStatus())
+	}()
+
+	// The dashboard is only informational too.
+	if cfg.UIPort != 0 {
+		uiSrv := &http.Server{
+			Addr:    fmt.Sprintf("127.0.0.1:%d", cfg.UIPort),
+			Handler: uiHandler(updater, aggr.OutputDir),
+		}
+		defer uiSrv.Close()
+
+		go func() {
+			logrus.WithField("port", cfg.UIPort).Info("starting dashboard server")
+			if err := uiSrv.ListenAndServe(); err != http.ErrServerClosed {
+				logrus.WithError(err).Warning("dashboard server stopped")
+			}
+		}()
+	}
+
+	// Keep track of the plugins' pods and the events about them, to store
+	// with their results however the run ends.
+	recorder := newPodRecorder(client, namespace, plugins)
+	stopRecording := make(chan struct{})
+	recorded := make(chan struct{})
+	go func() {
+		recorder.run(stopRecording)
+		close(recorded)
+	}()
+	defer func() {
+		close(stopRecording)
+		<-recorded
+		if err := recorder.write(aggr.OutputDir); err != nil {
+			errlog.LogError(err)
+		}
+	}()
+
 	// 3. Regularly annotate the Aggregator pod with the current run status
 	go func() {
 		defer ticker.Stop()
 		for range ticker.C {
 			updater.ReceiveAll(aggr.Results)
+			updater.ReceiveProgress(aggr.LatestProgress())
+			updater.ReceiveChecksumMismatches(aggr.ChecksumMismatchCounts())
+			updater.ReceiveDuplicates(aggr.DuplicateCounts())
+			updater.ReceiveHeartbeats(aggr.LatestHeartbeats())
+			updater.ReceiveReportTimes(aggr.LatestReportTimes())
+			updater.ReceiveErrors(aggr.LatestErrors())
+			updater.ReceivePods(recorder.Pods())
+			if _, err := aggr.UpdateDiskUsage(); err != nil {
+				logrus.WithError(err).Debug("couldn't check the results volume's free space")
+			}
+			updater.ReceiveDiskUsage(aggr.LatestDiskUsage())
 			if err := updater.Annotate(); err != nil {
 				logrus.WithError(err).Info("couldn't annotate sonobuoy pod")
 			}
+			if store != nil {
+				store.received(aggr)
+				if err := store.save(); err != nil {
+					logrus.WithError(err).Info("couldn't save run state")
+				}
+			}
 			if aggr.isComplete() {
 				return
 			}
 		}
 	}()
 
-	// 4. Launch each plugin, to dispatch workers which submit the results back
-	for _, p := range plugins {
-		cert, err := auth.ClientKeyPair(p.GetName())
-		if err != nil {
-			return errors.Wrapf(err, "couldn't make certificate for plugin %v", p.GetName())
+	// Workers reaching the aggregator through a Service can't until it has
+	// an endpoint, so hold off launching them until then. Worker submissions
+	// retry, so they're launched anyway if it's slow to come up.
+	if cfg.AdvertiseService != "" {
+		if err := waitForService(client, namespace, cfg.AdvertiseService); err != nil {
+			logrus.WithError(err).Warning("launching plugins before the aggregator's service is ready")
 		}
-		logrus.WithField("plugin", p.GetName()).Info("Running plugin")
-		if err = p.Run(client, cfg.AdvertiseAddress, cert); err != nil {
-			return errors.Wrapf(err, "error running plugin %v", p.GetName())
+	}
+
+	// Plugins with their own timeout are given up on once it passes, and
+	// stored results are fetched, until the run ends
+	stopTimeouts := make(chan struct{})
+	defer close(stopTimeouts)
+
+	// 4. Launch each plugin, to dispatch workers which submit the results
+	// back. Plugins that depend on others are launched once those have all
+	// succeeded.
+	runPlugin := func(p plugin.Interface) error {
+		if store != nil && store.isLaunched(p.GetName()) {
+			// It's still running from before the aggregator restarted.
+			logrus.WithField("plugin", p.GetName()).Info("Resuming plugin")
+		} else {
+			// The certificate is for the result type, since that's what the
+			// plugin submits results as.
+			cert, err := auth.ClientKeyPair(p.GetResultType())
+			if err != nil {
+				return errors.Wrapf(err, "couldn't make certificate for plugin %v", p.GetName())
+			}
+			token, err := tokens.issue(p.GetResultType())
+			if err != nil {
+				return errors.Wrapf(err, "couldn't make results token for plugin %v", p.GetName())
+			}
+			if store != nil {
+				if err := store.issuedTokens(tokens); err != nil {
+					return err
+				}
+			}
+			logrus.WithField("plugin", p.GetName()).Info("Running plugin")
+			launch := span.Child("plugin.launch", pluginSpanAttrs(p))
+			err = p.Run(client, cfg.AdvertiseAddress, cert, token)
+			launch.End(err)
+			if err != nil {
+				return errors.Wrapf(err, "error running plugin %v", p.GetName())
+			}
+			if store != nil {
+				if err := store.launched(p.GetName()); err != nil {
+					errlog.LogError(err)
+				}
+			}
 		}
+		aggr.PluginLaunched(p.GetResultType())
+		go aggr.traceWait(span.Child("plugin.wait", pluginSpanAttrs(p)), p.ExpectedResults(nodes.Items), stopTimeouts)
 		// Have the plugin monitor for errors
 		go p.Monitor(client, nodes.Items, monitorCh)
+		if p.GetTimeoutSeconds() > 0 {
+			go timeoutPlugin(client, p, nodes.Items, aggr, monitorCh, stopTimeouts)
+		}
+		// Plugins whose workers can't reach the aggregator store their
+		// results for it to fetch instead.
+		if p.StoresResults() {
+			token, err := tokens.issue(p.GetResultType())
+			if err != nil {
+				return errors.Wrapf(err, "couldn't get results token for plugin %v", p.GetName())
+			}
+			fetcher := &localResultsFetcher{
+				client:    client,
+				exec:      newPodExecutor(restConfig, client),
+				plugin:    p,
+				namespace: namespace,
+				token:     LocalResultsToken(token),
+				aggr:      aggr,
+				pods:      map[string]*v1.Pod{},
+			}
+			go fetcher.fetchLocalResults(p.ExpectedResults(nodes.Items), stopTimeouts)
+		}
+		return nil
+	}
+
+	for _, p := range plugins {
+		if len(p.GetDependsOn()) == 0 {
+			if err := runPlugin(p); err != nil {
+				return err
+			}
+			continue
+		}
+
+		go func(p plugin.Interface) {
+			logrus.WithFields(logrus.Fields{
+				"plugin":    p.GetName(),
+				"dependsOn": p.GetDependsOn(),
+			}).Info("Waiting for dependencies before running plugin")
+			depSpan := span.Child("plugin.dependencies", pluginSpanAttrs(p))
+			err := waitForDependencies(p, plugins, nodes.Items, aggr, stopTimeouts)
+			depSpan.End(err)
+			if err == errStoppedWaiting {
+				return
+			}
+			if err == nil {
+				err = runPlugin(p)
+			}
+			if err != nil {
+				errlog.LogError(err)
+				failPlugin(p, nodes.Items, aggr, monitorCh, err)
+			}
+		}(p)
 	}
 	// 5. Have the aggregator plumb results from each plugins' monitor function
 	go aggr.IngestResults(monitorCh)
 
-	// Give the plugins a chance to cleanup before a hard timeout occurs
-	shutdownPlugins := time.After(time.Duration(cfg.TimeoutSeconds-plugin.GracefulShutdownPeriod) * time.Second)
+	// Give the plugins a chance to send what they have and cleanup before a
+	// hard timeout occurs. A resumed run only has what's left of its timeout.
+	elapsed := time.Since(started)
+	shutdownPlugins := time.After(time.Duration(cfg.TimeoutSeconds-plugin.GracefulShutdownPeriod)*time.Second - elapsed)
+	var cleanupPlugins <-chan time.Time
 	// Ensure we only wait for results for a certain time
-	timeout := time.After(time.Duration(cfg.TimeoutSeconds) * time.Second)
+	timeout := time.After(time.Duration(cfg.TimeoutSeconds)*time.Second - elapsed)
 
 	// 6. Wait for aggr to show that all results are accounted for
 	for {
 		select {
 		case <-shutdownPlugins:
+			aggr.RequestFlush()
+			logrus.Info("Asking plugins for partial results due to timeout.")
+			cleanupPlugins = time.After(flushPeriod)
+		case <-cleanupPlugins:
 			Cleanup(client, plugins)
 			logrus.Info("Gracefully shutting down plugins due to timeout.")
 		case <-timeout:
@@ -169,6 +463,16 @@ func Run(client kubernetes.Interface, plugins []plugin.Interface, cfg plugin.Agg
 	}
 }
 
+// flushPeriod is how long workers have to send partial results, once they're
+// asked for them, before the plugins are cleaned up. It's longer than the
+// interval between heartbeats, which is when workers are asked, and shorter
+// than plugin.GracefulShutdownPeriod.
+var flushPeriod = 45 * time.Second
+
+// eventsShutdownTimeout is how long streams of the run's events have to send
+// its last event once it's over.
+const eventsShutdownTimeout = 5 * time.Second
+
 // Cleanup calls cleanup on all plugins
 func Cleanup(client kubernetes.Interface, plugins []plugin.Interface) {
 	// Cleanup after each plugin
@@ -0,0 +1,72 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// servicePollInterval is how often the aggregator's Service is checked for a
+// ready endpoint, and serviceReadyTimeout how long plugins wait for one before
+// they're launched anyway.
+var (
+	servicePollInterval = 2 * time.Second
+	serviceReadyTimeout = 2 * time.Minute
+)
+
+// waitForService waits until the named Service has a ready endpoint, which it
+// only has once the aggregator's readiness probe passes, so that workers
+// reaching the aggregator through it aren't launched before it routes to the
+// aggregator. It gives up after serviceReadyTimeout.
+func waitForService(client kubernetes.Interface, namespace, name string) error {
+	timeout := time.After(serviceReadyTimeout)
+	ticker := time.NewTicker(servicePollInterval)
+	defer ticker.Stop()
+
+	for {
+		endpoints, err := client.CoreV1().Endpoints(namespace).Get(name, metav1.GetOptions{})
+		if err == nil && hasReadyAddress(endpoints) {
+			return nil
+		}
+		// The endpoints may not have been created yet.
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "couldn't get endpoints of service %v", name)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timeout:
+			return errors.Errorf("service %v has no ready endpoints after %v", name, serviceReadyTimeout)
+		}
+	}
+}
+
+// hasReadyAddress returns whether any subset of endpoints has a ready address.
+func hasReadyAddress(endpoints *v1.Endpoints) bool {
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) > 0 {
+			return true
+		}
+	}
+	return false
+}
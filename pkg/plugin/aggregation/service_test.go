@@ -0,0 +1,96 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestWaitForService(t *testing.T) {
+	defer func(interval, timeout time.Duration) {
+		servicePollInterval, serviceReadyTimeout = interval, timeout
+	}(servicePollInterval, serviceReadyTimeout)
+	servicePollInterval = time.Millisecond
+	serviceReadyTimeout = 100 * time.Millisecond
+
+	notFound := `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`
+	notReady := v1.Endpoints{Subsets: []v1.EndpointSubset{{
+		NotReadyAddresses: []v1.EndpointAddress{{IP: "10.0.0.5"}},
+	}}}
+	ready := v1.Endpoints{Subsets: []v1.EndpointSubset{{
+		Addresses: []v1.EndpointAddress{{IP: "10.0.0.5"}},
+	}}}
+
+	testCases := []struct {
+		name string
+		// responses are what each get of the endpoints returns in turn, the
+		// last one repeating.
+		responses []interface{}
+		expectErr bool
+	}{
+		{name: "ready", responses: []interface{}{ready}},
+		{name: "becomes ready", responses: []interface{}{notFound, notReady, ready}},
+		{name: "never ready", responses: []interface{}{notReady}, expectErr: true},
+		{name: "error", responses: []interface{}{`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"Forbidden","code":403}`}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gets := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v1/namespaces/heptio-sonobuoy/endpoints/sonobuoy-master" {
+					http.NotFound(w, r)
+					return
+				}
+				response := tc.responses[len(tc.responses)-1]
+				if gets < len(tc.responses) {
+					response = tc.responses[gets]
+				}
+				gets++
+
+				w.Header().Set("Content-Type", "application/json")
+				if status, ok := response.(string); ok {
+					var code struct{ Code int }
+					json.Unmarshal([]byte(status), &code)
+					w.WriteHeader(code.Code)
+					w.Write([]byte(status))
+					return
+				}
+				json.NewEncoder(w).Encode(response)
+			}))
+			defer srv.Close()
+
+			client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+			if err != nil {
+				t.Fatalf("couldn't create client: %v", err)
+			}
+
+			err = waitForService(client, "heptio-sonobuoy", "sonobuoy-master")
+			if tc.expectErr != (err != nil) {
+				t.Errorf("expected error: %v, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Files of a serving certificate directory, named as in a kubernetes.io/tls
+// Secret.
+const (
+	TLSCertFile = "tls.crt"
+	TLSKeyFile  = "tls.key"
+	TLSCAFile   = "ca.crt"
+)
+
+// certReloader serves the certificate in a directory, reloading it whenever it
+// changes, such as when cert-manager renews it.
+type certReloader struct {
+	dir string
+
+	mu      sync.Mutex
+	modTime time.Time
+	cert    *tls.Certificate
+}
+
+// GetCertificate is for tls.Config, returning the latest certificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certFile := filepath.Join(r.dir, TLSCertFile)
+	info, err := os.Stat(certFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't find serving certificate")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cert != nil && info.ModTime().Equal(r.modTime) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, filepath.Join(r.dir, TLSKeyFile))
+	if err != nil {
+		// The certificate and key may be caught mid-update, so keep
+		// serving the last one.
+		if r.cert != nil {
+			logrus.WithError(err).Warning("Couldn't reload serving certificate")
+			return r.cert, nil
+		}
+		return nil, errors.Wrap(err, "couldn't load serving certificate")
+	}
+	r.cert, r.modTime = &cert, info.ModTime()
+	return r.cert, nil
+}
+
+// makeServerConfigFromDir returns a TLS config that serves the certificate in
+// dir and verifies that peer certificates were issued by clientCAs.
+func makeServerConfigFromDir(dir string, clientCAs *x509.CertPool) (*tls.Config, error) {
+	r := &certReloader{dir: dir}
+	// Fail now, rather than on the first connection, if there's no
+	// certificate.
+	if _, err := r.GetCertificate(nil); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		GetCertificate: r.GetCertificate,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      clientCAs,
+	}, nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/backplane/ca"
+)
+
+// writeKeyPair writes a certificate for name to dir as a kubernetes.io/tls
+// Secret would be mounted, with the given modification time.
+func writeKeyPair(t *testing.T, auth *ca.Authority, dir, name string, modTime time.Time) {
+	cert, err := auth.ServerKeyPair(name)
+	if err != nil {
+		t.Fatalf("couldn't make server certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatalf("couldn't marshal private key: %v", err)
+	}
+	files := map[string][]byte{
+		TLSCertFile: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}),
+		TLSKeyFile:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+	for file, contents := range files {
+		path := filepath.Join(dir, file)
+		if err := ioutil.WriteFile(path, contents, 0600); err != nil {
+			t.Fatalf("couldn't write %v: %v", file, err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("couldn't set modification time of %v: %v", file, err)
+		}
+	}
+}
+
+func servedName(t *testing.T, cfg *tls.Config) string {
+	cert, err := cfg.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("couldn't get serving certificate: %v", err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("couldn't parse serving certificate: %v", err)
+	}
+	return parsed.DNSNames[0]
+}
+
+func TestMakeServerConfigFromDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-tls")
+	if err != nil {
+		t.Fatalf("couldn't make temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := makeServerConfigFromDir(dir, nil); err == nil {
+		t.Error("expected an error without a certificate, got none")
+	}
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make certificate authority: %v", err)
+	}
+	issued := time.Now().Add(-time.Hour)
+	writeKeyPair(t, auth, dir, "sonobuoy-master.heptio-sonobuoy.svc", issued)
+
+	cfg, err := makeServerConfigFromDir(dir, auth.CACertPool())
+	if err != nil {
+		t.Fatalf("couldn't make server config: %v", err)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert {
+		t.Errorf("expected client certificates to be required, got %v", cfg.ClientAuth)
+	}
+	if name := servedName(t, cfg); name != "sonobuoy-master.heptio-sonobuoy.svc" {
+		t.Errorf("expected certificate for sonobuoy-master.heptio-sonobuoy.svc, got %v", name)
+	}
+
+	// A renewed certificate is served once it changes.
+	writeKeyPair(t, auth, dir, "sonobuoy-master", issued.Add(time.Minute))
+	if name := servedName(t, cfg); name != "sonobuoy-master" {
+		t.Errorf("expected renewed certificate for sonobuoy-master, got %v", name)
+	}
+
+	// A certificate caught mid-update doesn't replace the last one.
+	if err := ioutil.WriteFile(filepath.Join(dir, TLSKeyFile), []byte("partial"), 0600); err != nil {
+		t.Fatalf("couldn't write key: %v", err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, TLSCertFile), issued.Add(2*time.Minute), issued.Add(2*time.Minute)); err != nil {
+		t.Fatalf("couldn't set modification time: %v", err)
+	}
+	if name := servedName(t, cfg); name != "sonobuoy-master" {
+		t.Errorf("expected the last certificate to be kept, got %v", name)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+// ResultTooLargeError is returned when a result would take a plugin, or the
+// run as a whole, over its size limit. It's sent to the worker as the JSON
+// body of a 413 response.
+type ResultTooLargeError struct {
+	Plugin string `json:"plugin"`
+	Node   string `json:"node,omitempty"`
+	// Scope is "plugin" if the plugin's own limit was hit, or "total" if the
+	// limit for all plugins together was.
+	Scope string `json:"scope"`
+	Limit int64  `json:"limit"`
+}
+
+func (e *ResultTooLargeError) Error() string {
+	return fmt.Sprintf("result for plugin %v exceeds the %v limit of %v bytes", e.Plugin, e.Scope, e.Limit)
+}
+
+// sizeLimitReader counts the bytes of a result as they're read through it,
+// and fails once they'd take its plugin or the run over their size limits.
+// Counting them as they're read means results being uploaded at the same time
+// can't go over the limits together.
+type sizeLimitReader struct {
+	reader    io.Reader
+	aggr      *Aggregator
+	result    *plugin.Result
+	duplicate bool
+	err       error
+	// read is how many bytes have been read through it.
+	read int64
+}
+
+func (s *sizeLimitReader) Read(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	// Read at most one byte past the limit, to find out if it was exceeded.
+	if remaining, limited := s.aggr.remainingBytes(s.result, s.duplicate); limited && int64(len(p)) > remaining+1 {
+		p = p[:remaining+1]
+	}
+	n, err := s.reader.Read(p)
+	counted, limitErr := s.aggr.takeBytes(s.result, s.duplicate, int64(n))
+	s.read += counted
+	if limitErr != nil {
+		s.err = limitErr
+		return int(counted), limitErr
+	}
+	return n, err
+}
+
+// limitResultSize wraps result's body so the bytes read from it are counted,
+// and reading it fails once the result goes over what's left of either the
+// plugin's or the total size limit. A duplicate is measured against what's
+// left once it replaces the earlier result.
+func (a *Aggregator) limitResultSize(result *plugin.Result, duplicate bool) *sizeLimitReader {
+	limited := &sizeLimitReader{reader: result.Body, aggr: a, result: result, duplicate: duplicate}
+	result.Body = limited
+	return limited
+}
+
+// remainingBytes returns how many more bytes of result fit within the size
+// limits, and whether there are any.
+func (a *Aggregator) remainingBytes(result *plugin.Result, duplicate bool) (int64, bool) {
+	a.bytesMutex.Lock()
+	defer a.bytesMutex.Unlock()
+	remaining, _ := a.remainingBytesLocked(result, duplicate)
+	return remaining, remaining >= 0
+}
+
+// remainingBytesLocked is remainingBytes, along with the error for going over
+// the limit that's left the least room, or -1 if there are no limits. It must
+// be called with bytesMutex held.
+func (a *Aggregator) remainingBytesLocked(result *plugin.Result, duplicate bool) (int64, error) {
+	// The earlier result's bytes are freed once a duplicate replaces it.
+	var replaced int64
+	if duplicate {
+		replaced = a.resultBytes[result.ExpectedResultID()]
+	}
+
+	remaining := int64(-1)
+	var err error
+	if a.MaxPluginBytes > 0 {
+		remaining = a.MaxPluginBytes - a.pluginBytes[result.ResultType] + replaced
+		err = &ResultTooLargeError{Plugin: result.ResultType, Node: result.NodeName, Scope: "plugin", Limit: a.MaxPluginBytes}
+	}
+	if a.MaxTotalBytes > 0 {
+		if total := a.MaxTotalBytes - a.totalBytes + replaced; remaining < 0 || total < remaining {
+			remaining = total
+			err = &ResultTooLargeError{Plugin: result.ResultType, Node: result.NodeName, Scope: "total", Limit: a.MaxTotalBytes}
+		}
+	}
+	if err != nil && remaining < 0 {
+		remaining = 0
+	}
+	return remaining, err
+}
+
+// takeBytes counts n more bytes of result, as far as they fit within the size
+// limits, returning how many were counted and, if that's fewer than n, the
+// error for going over the limit.
+func (a *Aggregator) takeBytes(result *plugin.Result, duplicate bool, n int64) (int64, error) {
+	a.bytesMutex.Lock()
+	defer a.bytesMutex.Unlock()
+
+	remaining, limitErr := a.remainingBytesLocked(result, duplicate)
+	if limitErr == nil || n <= remaining {
+		limitErr = nil
+	} else {
+		n = remaining
+	}
+	a.countBytesLocked(result, duplicate, n)
+	return n, limitErr
+}
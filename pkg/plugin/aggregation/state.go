@@ -0,0 +1,297 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/backplane/ca"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// RunStateName is the name of the Secret a resumable run's state is kept
+	// in. It's a Secret rather than a ConfigMap since it holds the private key
+	// of the certificate authority that issued the plugins' certificates.
+	RunStateName = "sonobuoy-run-state"
+
+	runStateKey = "state.json"
+	caCertKey   = "ca.crt"
+	caKeyKey    = "ca.key"
+)
+
+// runState is what a resumable run needs to pick up where it left off if the
+// aggregator is restarted.
+type runState struct {
+	// OutputDir identifies the run, since it includes the run's UUID.
+	OutputDir string                  `json:"outputDir"`
+	Started   time.Time               `json:"started"`
+	Expected  []plugin.ExpectedResult `json:"expected"`
+	// Launched lists the plugins that have been run, by name.
+	Launched []string         `json:"launched"`
+	Received []receivedResult `json:"received"`
+	// Tokens are the results tokens issued to the plugins, by result type.
+	Tokens map[string]string `json:"tokens,omitempty"`
+}
+
+// receivedResult is a result the aggregator had already received. The result
+// itself is in the output directory.
+type receivedResult struct {
+	NodeName   string    `json:"node,omitempty"`
+	ResultType string    `json:"plugin"`
+	Error      string    `json:"error,omitempty"`
+	TimedOut   bool      `json:"timedOut,omitempty"`
+	Incomplete bool      `json:"incomplete,omitempty"`
+	Reason     string    `json:"reason,omitempty"`
+	ReportedAt time.Time `json:"reportedAt"`
+}
+
+// runStateStore keeps a resumable run's state up to date in the run state
+// Secret.
+type runStateStore struct {
+	client    kubernetes.Interface
+	namespace string
+	auth      *ca.Authority
+	// labels and annotations are set on the run state Secret besides its
+	// own label.
+	labels      map[string]string
+	annotations map[string]string
+	// resumed is true if the state was loaded from a previous aggregator.
+	resumed bool
+
+	mutex sync.Mutex
+	state runState
+	// saved is the state as last saved, so it's only written when it changes.
+	saved []byte
+}
+
+// loadRunState returns the state of the run writing to outdir, resumed from
+// the run state Secret if a previous aggregator left one for that run.
+// Otherwise it starts a new state, using auth for the run.
+func loadRunState(client kubernetes.Interface, namespace, outdir string, expected []plugin.ExpectedResult, auth *ca.Authority) (*runStateStore, error) {
+	store := &runStateStore{
+		client:    client,
+		namespace: namespace,
+		auth:      auth,
+		state: runState{
+			OutputDir: outdir,
+			Started:   time.Now(),
+			Expected:  expected,
+			Launched:  []string{},
+		},
+	}
+
+	secret, err := client.CoreV1().Secrets(namespace).Get(RunStateName, metav1.GetOptions{})
+	if kubeerrors.IsNotFound(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't get run state")
+	}
+
+	state, stateAuth, err := decodeRunState(secret.Data)
+	if err != nil {
+		return nil, err
+	}
+	if state.OutputDir != outdir {
+		logrus.WithField("outputDir", state.OutputDir).Info("Ignoring the saved state of a different run")
+		return store, nil
+	}
+
+	store.state = *state
+	store.auth = stateAuth
+	store.resumed = true
+	store.saved = secret.Data[runStateKey]
+	return store, nil
+}
+
+// encodeRunState encodes a run's state and certificate authority as the data
+// of the run state Secret.
+func encodeRunState(state *runState, auth *ca.Authority) (map[string][]byte, error) {
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't encode run state")
+	}
+	certPEM, keyPEM, err := auth.EncodePEM()
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		runStateKey: stateJSON,
+		caCertKey:   certPEM,
+		caKeyKey:    keyPEM,
+	}, nil
+}
+
+// decodeRunState is the inverse of encodeRunState.
+func decodeRunState(data map[string][]byte) (*runState, *ca.Authority, error) {
+	state := &runState{}
+	if err := json.Unmarshal(data[runStateKey], state); err != nil {
+		return nil, nil, errors.Wrap(err, "couldn't decode run state")
+	}
+	auth, err := ca.LoadAuthority(data[caCertKey], data[caKeyKey])
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "couldn't load run certificate authority")
+	}
+	return state, auth, nil
+}
+
+// isLaunched returns whether the named plugin had already been run.
+func (s *runStateStore) isLaunched(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, launched := range s.state.Launched {
+		if launched == name {
+			return true
+		}
+	}
+	return false
+}
+
+// launched records that the named plugin has been run, saving the state
+// straight away so the plugin isn't run twice.
+func (s *runStateStore) launched(name string) error {
+	s.mutex.Lock()
+	s.state.Launched = append(s.state.Launched, name)
+	s.mutex.Unlock()
+	return s.save()
+}
+
+// issuedTokens records the results tokens issued so far, saving the state
+// straight away so plugins can still submit results if the aggregator restarts.
+func (s *runStateStore) issuedTokens(tokens *pluginTokens) error {
+	s.mutex.Lock()
+	s.state.Tokens = tokens.issued()
+	s.mutex.Unlock()
+	return s.save()
+}
+
+// received records the results the aggregator has received so far.
+func (s *runStateStore) received(aggr *Aggregator) {
+	results := aggr.receivedResults()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.state.Received = results
+}
+
+// save writes the state to the run state Secret if it has changed since it was
+// last saved.
+func (s *runStateStore) save() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := encodeRunState(&s.state, s.auth)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data[runStateKey], s.saved) {
+		return nil
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        RunStateName,
+			Namespace:   s.namespace,
+			Labels:      plugin.MergeMetadata(s.labels, map[string]string{"component": "sonobuoy"}),
+			Annotations: s.annotations,
+		},
+		Data: data,
+	}
+	secrets := s.client.CoreV1().Secrets(s.namespace)
+	_, err = secrets.Update(secret)
+	if kubeerrors.IsNotFound(err) {
+		_, err = secrets.Create(secret)
+	}
+	if err != nil {
+		return errors.Wrap(err, "couldn't save run state")
+	}
+	s.saved = data[runStateKey]
+	return nil
+}
+
+// delete removes the run state Secret once the run is over.
+func (s *runStateStore) delete() error {
+	err := s.client.CoreV1().Secrets(s.namespace).Delete(RunStateName, &metav1.DeleteOptions{})
+	if err != nil && !kubeerrors.IsNotFound(err) {
+		return errors.Wrap(err, "couldn't delete run state")
+	}
+	return nil
+}
+
+// receivedResults returns the results received so far, in a stable order.
+func (a *Aggregator) receivedResults() []receivedResult {
+	reportTimes := a.LatestReportTimes()
+
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	received := make([]receivedResult, 0, len(a.Results))
+	for _, result := range a.Results {
+		received = append(received, receivedResult{
+			NodeName:   result.NodeName,
+			ResultType: result.ResultType,
+			Error:      result.Error,
+			TimedOut:   result.TimedOut,
+			Incomplete: result.Incomplete,
+			Reason:     result.FailureReason,
+			ReportedAt: reportTimes[plugin.ExpectedResult{NodeName: result.NodeName, ResultType: result.ResultType}],
+		})
+	}
+	sort.Slice(received, func(i, j int) bool {
+		if received[i].ResultType != received[j].ResultType {
+			return received[i].ResultType < received[j].ResultType
+		}
+		return received[i].NodeName < received[j].NodeName
+	})
+	return received
+}
+
+// restore records results received by a previous aggregator for the same run,
+// whose files are already in the output directory.
+func (a *Aggregator) restore(received []receivedResult) {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+	a.statusMutex.Lock()
+	defer a.statusMutex.Unlock()
+
+	for _, r := range received {
+		result := &plugin.Result{
+			NodeName:      r.NodeName,
+			ResultType:    r.ResultType,
+			Error:         r.Error,
+			TimedOut:      r.TimedOut,
+			Incomplete:    r.Incomplete,
+			FailureReason: r.Reason,
+		}
+		expected := plugin.ExpectedResult{NodeName: r.NodeName, ResultType: r.ResultType}
+		a.Results[result.ExpectedResultID()] = result
+		a.ReportTimes[expected] = r.ReportedAt
+		if r.Error != "" {
+			a.LastErrors[expected] = r.Error
+		}
+	}
+}
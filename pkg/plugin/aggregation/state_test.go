@@ -0,0 +1,86 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/backplane/ca"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+func TestRunState(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		{NodeName: "node1", ResultType: "systemd_logs"},
+		{NodeName: "node2", ResultType: "systemd_logs"},
+		{ResultType: "e2e"},
+	}
+
+	// Receive some of the results, one of them failed.
+	aggr := NewAggregator("", expected)
+	aggr.recordReport(&plugin.Result{NodeName: "node1", ResultType: "systemd_logs"})
+	aggr.Results["systemd_logs/node1"] = &plugin.Result{NodeName: "node1", ResultType: "systemd_logs"}
+	aggr.recordReport(&plugin.Result{ResultType: "e2e", Error: "timeout", TimedOut: true})
+	aggr.Results["e2e"] = &plugin.Result{ResultType: "e2e", Error: "timeout", TimedOut: true}
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't create certificate authority: %v", err)
+	}
+	state := &runState{
+		OutputDir: "/tmp/sonobuoy/uuid",
+		Started:   time.Now().UTC().Truncate(time.Second),
+		Expected:  expected,
+		Launched:  []string{"systemd_logs", "e2e"},
+		Received:  aggr.receivedResults(),
+		Tokens:    map[string]string{"systemd_logs": "token1", "e2e": "token2"},
+	}
+
+	data, err := encodeRunState(state, auth)
+	if err != nil {
+		t.Fatalf("couldn't encode run state: %v", err)
+	}
+	decoded, decodedAuth, err := decodeRunState(data)
+	if err != nil {
+		t.Fatalf("couldn't decode run state: %v", err)
+	}
+	if !decodedAuth.CACert().Equal(auth.CACert()) {
+		t.Error("expected the certificate authority to be restored")
+	}
+	if !reflect.DeepEqual(decoded.Expected, state.Expected) || !reflect.DeepEqual(decoded.Launched, state.Launched) {
+		t.Errorf("expected state %+v, got %+v", state, decoded)
+	}
+	if tokens := newPluginTokens(decoded.Tokens); !tokens.valid("e2e", "token2") {
+		t.Errorf("expected the results tokens to be restored, got %v", decoded.Tokens)
+	}
+
+	// A new aggregator picks up where the first one left off.
+	resumed := NewAggregator("", decoded.Expected)
+	resumed.restore(decoded.Received)
+	missing := resumed.missingResults(decoded.Expected)
+	if len(missing) != 1 || missing[0] != expected[1] {
+		t.Errorf("expected only %v to be missing, got %v", expected[1], missing)
+	}
+	if result := resumed.Results["e2e"]; result == nil || !result.TimedOut {
+		t.Errorf("expected e2e to have timed out, got %+v", result)
+	}
+	if err := resumed.LatestErrors()[expected[2]]; err != "timeout" {
+		t.Errorf("expected e2e error to be restored, got %q", err)
+	}
+}
@@ -16,7 +16,10 @@ limitations under the License.
 
 package aggregation
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 const (
 	// RunningStatus means the sonobuoy run is still in progress.
@@ -25,6 +28,11 @@ const (
 	CompleteStatus string = "complete"
 	// FailedStatus means one or more plugins has failed and the run will not complete successfully.
 	FailedStatus string = "failed"
+	// TimedOutStatus means a plugin didn't finish within its timeout, so the run will not complete successfully.
+	TimedOutStatus string = "timed-out"
+	// TimedOutPartialStatus means the run timed out before a plugin finished,
+	// but the results it had so far were collected.
+	TimedOutPartialStatus string = "timed-out-partial"
 )
 
 // PluginStatus represents the current status of an individual plugin.
@@ -32,6 +40,66 @@ type PluginStatus struct {
 	Plugin string `json:"plugin"`
 	Node   string `json:"node"`
 	Status string `json:"status"`
+	// Progress is the latest progress reported by the plugin, if any.
+	Progress *ProgressUpdate `json:"progress,omitempty"`
+	// ChecksumMismatches is how many times the plugin's results were
+	// rejected because they were corrupted on the way to the aggregator.
+	ChecksumMismatches int `json:"checksumMismatches,omitempty"`
+	// Duplicates is how many times the plugin's results were uploaded again
+	// after being received, such as by a pod that was retried. The latest
+	// upload is the one kept.
+	Duplicates int `json:"duplicates,omitempty"`
+	// LastHeartbeat is when the plugin's worker was last heard from, if
+	// ever. A running plugin whose worker has gone quiet has likely died.
+	LastHeartbeat *time.Time `json:"lastHeartbeat,omitempty"`
+	// ReportedAt is when the plugin's result was received, if it has been.
+	ReportedAt *time.Time `json:"reportedAt,omitempty"`
+	// Error is the last error reported for the plugin's result. It's kept
+	// even if a later upload succeeded, since it may explain a slow node.
+	Error string `json:"error,omitempty"`
+	// Reason is why the plugin's result failed, if it's one of the
+	// plugin.Failure reasons, such as OOMKilled. Results without one failed
+	// because the plugin reported an error itself.
+	Reason string `json:"reason,omitempty"`
+	// Pod is the name of the newest pod running the plugin, once there is
+	// one, and PodNode the node it was scheduled on, which plugins that run
+	// once don't otherwise have.
+	Pod     string `json:"pod,omitempty"`
+	PodNode string `json:"podNode,omitempty"`
+	// StartTime is when the pod was started, if it has been.
+	StartTime *time.Time `json:"startTime,omitempty"`
+	// LastTransition is when the plugin's status last changed, or the run
+	// started if it hasn't.
+	LastTransition *time.Time `json:"lastTransition,omitempty"`
+}
+
+// ProgressUpdate is an incremental report from a running plugin of how far
+// along it is, e.g. 120 of 350 tests complete.
+type ProgressUpdate struct {
+	Plugin    string `json:"plugin,omitempty"`
+	Node      string `json:"node,omitempty"`
+	Completed int    `json:"completed"`
+	Total     int    `json:"total"`
+	Message   string `json:"message,omitempty"`
+}
+
+// Percent returns how complete the plugin is, from 0 to 100. Without a known
+// total, there is no way to tell and it returns 0.
+func (p *ProgressUpdate) Percent() int {
+	if p.Total <= 0 {
+		return 0
+	}
+	return p.Completed * 100 / p.Total
+}
+
+// ID returns the identifier of the result this update is for, matching
+// plugin.ExpectedResult.ID().
+func (p *ProgressUpdate) ID() string {
+	if p.Node == "" {
+		return p.Plugin
+	}
+
+	return p.Plugin + "/" + p.Node
 }
 
 // Status represents the current status of a Sonobuoy run.
@@ -39,6 +107,57 @@ type PluginStatus struct {
 type Status struct {
 	Plugins []PluginStatus `json:"plugins"`
 	Status  string         `json:"status"`
+	// Disk is how much space is left in the volume the aggregator stores
+	// results in, once it has been checked.
+	Disk *DiskUsage `json:"disk,omitempty"`
+}
+
+// PluginNodes is the status of a DaemonSet plugin broken down by node.
+type PluginNodes struct {
+	Plugin string `json:"plugin"`
+	// Reported and Pending list the nodes that have and haven't sent their
+	// results yet.
+	Reported []string `json:"reported"`
+	Pending  []string `json:"pending"`
+	// Errors is the last error reported for each node that has had one.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// NodeBreakdown groups the status of each plugin that runs on every node
+// (i.e. whose results are reported by node) by plugin, in the order the
+// plugins appear in the status.
+func (s *Status) NodeBreakdown() []PluginNodes {
+	var breakdown []PluginNodes
+	positions := map[string]int{}
+	for _, status := range s.Plugins {
+		if status.Node == "" {
+			continue
+		}
+		i, ok := positions[status.Plugin]
+		if !ok {
+			i = len(breakdown)
+			positions[status.Plugin] = i
+			breakdown = append(breakdown, PluginNodes{
+				Plugin:   status.Plugin,
+				Reported: []string{},
+				Pending:  []string{},
+			})
+		}
+
+		nodes := &breakdown[i]
+		if status.Status == RunningStatus {
+			nodes.Pending = append(nodes.Pending, status.Node)
+		} else {
+			nodes.Reported = append(nodes.Reported, status.Node)
+		}
+		if status.Error != "" {
+			if nodes.Errors == nil {
+				nodes.Errors = map[string]string{}
+			}
+			nodes.Errors[status.Node] = status.Error
+		}
+	}
+	return breakdown
 }
 
 func (s *Status) updateStatus() error {
@@ -47,7 +166,7 @@ func (s *Status) updateStatus() error {
 		switch plugin.Status {
 		case CompleteStatus:
 			continue
-		case FailedStatus:
+		case FailedStatus, TimedOutStatus, TimedOutPartialStatus:
 			status = FailedStatus
 		case RunningStatus:
 			if status != FailedStatus {
@@ -16,7 +16,10 @@ limitations under the License.
 
 package aggregation
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestUpdateStatus(t *testing.T) {
 	statusTests := []struct {
@@ -77,3 +80,26 @@ func TestUpdateInvalidStatus(t *testing.T) {
 		t.Error("expected err to be unknown status, got nil")
 	}
 }
+
+func TestNodeBreakdown(t *testing.T) {
+	status := &Status{
+		Plugins: []PluginStatus{
+			{Plugin: "e2e", Status: RunningStatus},
+			{Plugin: "systemd_logs", Node: "node1", Status: CompleteStatus},
+			{Plugin: "systemd_logs", Node: "node2", Status: RunningStatus, Error: "checksum mismatch"},
+			{Plugin: "systemd_logs", Node: "node3", Status: FailedStatus, Error: "timeout"},
+		},
+	}
+
+	expected := []PluginNodes{
+		{
+			Plugin:   "systemd_logs",
+			Reported: []string{"node1", "node3"},
+			Pending:  []string{"node2"},
+			Errors:   map[string]string{"node2": "checksum mismatch", "node3": "timeout"},
+		},
+	}
+	if breakdown := status.NodeBreakdown(); !reflect.DeepEqual(breakdown, expected) {
+		t.Errorf("expected breakdown %+v, got %+v", expected, breakdown)
+	}
+}
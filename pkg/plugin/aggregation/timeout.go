@@ -0,0 +1,94 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	pluginutils "github.com/heptio/sonobuoy/pkg/plugin/driver/utils"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const timedOutError = "plugin timed out"
+
+// incompleteError is reported for a plugin whose results were only partly
+// collected, because the run timed out before it finished.
+const incompleteError = "run timed out before the plugin finished, partial results were collected"
+
+// timeoutGracePeriod is how much longer than a plugin's timeout the
+// aggregator waits before timing it out itself. The plugin's workers time it
+// out first, so this leaves them time to report it and stop the plugin.
+var timeoutGracePeriod = time.Duration(plugin.GracefulShutdownPeriod) * time.Second
+
+// timeoutPlugin waits for the plugin's own timeout and timeoutGracePeriod,
+// unless stop is closed first. If any of its results are still missing by
+// then, or were reported as timed out by their workers, the plugin is cleaned
+// up, and a timed out error is sent through resultsCh for each missing one, so
+// the rest of the run doesn't have to wait for it.
+func timeoutPlugin(client kubernetes.Interface, p plugin.Interface, nodes []v1.Node, aggr *Aggregator, resultsCh chan<- *plugin.Result, stop <-chan struct{}) {
+	timeout := time.Duration(p.GetTimeoutSeconds()) * time.Second
+	select {
+	case <-time.After(timeout + timeoutGracePeriod):
+	case <-stop:
+		return
+	}
+
+	expected := p.ExpectedResults(nodes)
+	missing := aggr.missingResults(expected)
+	if len(missing) == 0 {
+		// Workers can't stop the pods of a DaemonSet for good, since
+		// they're recreated, so they're stopped here.
+		if aggr.anyTimedOut(expected) {
+			logrus.WithField("plugin", p.GetName()).Info("Plugin timed out, stopping it")
+			p.Cleanup(client)
+		}
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"plugin":  p.GetName(),
+		"timeout": timeout,
+	}).Warning("Plugin timed out, stopping it")
+	p.Cleanup(client)
+
+	for _, expected := range missing {
+		result := pluginutils.MakeErrorResult(expected.ResultType, map[string]interface{}{
+			"error":  fmt.Sprintf("%v after %v", timedOutError, timeout),
+			"reason": plugin.FailureTimeout,
+		}, expected.NodeName)
+		result.TimedOut = true
+		resultsCh <- result
+	}
+}
+
+// anyTimedOut returns whether any of the expected results was received as
+// timed out.
+func (a *Aggregator) anyTimedOut(expected []plugin.ExpectedResult) bool {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	for _, result := range expected {
+		if received, ok := a.Results[result.ID()]; ok && received.TimedOut {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// AuthorizationHeader carries a worker's results token, as a bearer token.
+	AuthorizationHeader = "authorization"
+
+	bearerPrefix = "Bearer "
+	tokenBytes   = 32
+)
+
+// pluginTokens are the bearer tokens issued to plugins when they're launched,
+// by result type. Only the pods Sonobuoy created for a plugin are given its
+// token, so only they can submit its results.
+type pluginTokens struct {
+	mutex  sync.Mutex
+	tokens map[string]string
+}
+
+// newPluginTokens returns the tokens for a run, starting with any issued by a
+// previous aggregator for it.
+func newPluginTokens(issued map[string]string) *pluginTokens {
+	tokens := map[string]string{}
+	for resultType, token := range issued {
+		tokens[resultType] = token
+	}
+	return &pluginTokens{tokens: tokens}
+}
+
+// issue returns the token for a result type, generating it if it hasn't been
+// issued yet.
+func (t *pluginTokens) issue(resultType string) (string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if token, ok := t.tokens[resultType]; ok {
+		return token, nil
+	}
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "couldn't generate results token")
+	}
+	token := hex.EncodeToString(b)
+	t.tokens[resultType] = token
+	return token, nil
+}
+
+// valid reports whether token was issued for the result type.
+func (t *pluginTokens) valid(resultType, token string) bool {
+	t.mutex.Lock()
+	expected, ok := t.tokens[resultType]
+	t.mutex.Unlock()
+	return ok && subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
+}
+
+// issued returns a copy of the tokens issued so far.
+func (t *pluginTokens) issued() map[string]string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	issued := make(map[string]string, len(t.tokens))
+	for resultType, token := range t.tokens {
+		issued[resultType] = token
+	}
+	return issued
+}
+
+// requireToken is middleware for a Handler that only lets through results
+// submitted with the bearer token issued for the plugin in the request path.
+// Progress updates and heartbeats are only informational, so they don't need
+// one.
+func (t *pluginTokens) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || !strings.HasPrefix(r.URL.Path, "/api/v1/results/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		pluginName := mux.Vars(r)["plugin"]
+		header := r.Header.Get(AuthorizationHeader)
+		if !strings.HasPrefix(header, bearerPrefix) || !t.valid(pluginName, strings.TrimPrefix(header, bearerPrefix)) {
+			logrus.WithField("plugin_name", pluginName).Warning("rejected results without a valid token for the plugin")
+			http.Error(
+				w,
+				fmt.Sprintf("Results token not valid for plugin %v", pluginName),
+				http.StatusUnauthorized,
+			)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// BearerToken is the value of the AuthorizationHeader for a results token.
+func BearerToken(token string) string {
+	return bearerPrefix + token
+}
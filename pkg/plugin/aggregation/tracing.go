@@ -0,0 +1,80 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/tracing"
+	"github.com/pkg/errors"
+)
+
+// traceWaitInterval is how often a plugin's wait span checks whether all of
+// its results are in.
+var traceWaitInterval = 5 * time.Second
+
+// pluginSpanAttrs are the attributes of a plugin's spans.
+func pluginSpanAttrs(p plugin.Interface) map[string]string {
+	return map[string]string{
+		"sonobuoy.plugin":      p.GetName(),
+		"sonobuoy.result_type": p.GetResultType(),
+	}
+}
+
+// startResultSpan starts the span handling a result is traced in, which is
+// part of the span the worker submitted it in, if it sent one.
+func (a *Aggregator) startResultSpan(result *plugin.Result) *tracing.Span {
+	attrs := map[string]string{"sonobuoy.result_type": result.ResultType}
+	if result.NodeName != "" {
+		attrs["sonobuoy.node"] = result.NodeName
+	}
+	if result.Filename != "" {
+		attrs["sonobuoy.filename"] = result.Filename
+	}
+	parent, err := tracing.ParseTraceparent(result.TraceParent)
+	if err != nil {
+		parent = a.Trace.Context()
+	}
+	return a.Trace.Tracer().Start("result.process", parent, attrs)
+}
+
+// traceWait ends span once all of the expected results are in, as failed if
+// any of them failed, or when stop is closed.
+func (a *Aggregator) traceWait(span *tracing.Span, expected []plugin.ExpectedResult, stop <-chan struct{}) {
+	if span == nil {
+		return
+	}
+	ticker := time.NewTicker(traceWaitInterval)
+	defer ticker.Stop()
+	for {
+		if done, succeeded := a.resultsOutcome(expected); done {
+			if succeeded {
+				span.End(nil)
+			} else {
+				span.End(errors.New("the plugin's results include failures"))
+			}
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			span.End(errors.New("the run ended before all of the plugin's results were in"))
+			return
+		}
+	}
+}
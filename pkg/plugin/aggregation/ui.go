@@ -0,0 +1,134 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/pkg/errors"
+)
+
+// uiRefreshSeconds is how often the dashboard reloads itself.
+const uiRefreshSeconds = 5
+
+// Status returns a copy of the current status of the run.
+func (u *updater) Status() Status {
+	u.RLock()
+	defer u.RUnlock()
+	status := Status{
+		Status:  u.status.Status,
+		Plugins: make([]PluginStatus, len(u.status.Plugins)),
+	}
+	copy(status.Plugins, u.status.Plugins)
+	return status
+}
+
+// uiHandler serves a dashboard of the run's progress, the status it's drawn
+// from as JSON at /api/status, and the results received so far from
+// resultsDir under /results/.
+func uiHandler(u *updater, resultsDir string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		status := u.Status()
+		data := struct {
+			Status         Status
+			Nodes          []PluginNodes
+			RefreshSeconds int
+			Now            time.Time
+		}{
+			Status:         status,
+			Nodes:          status.NodeBreakdown(),
+			RefreshSeconds: uiRefreshSeconds,
+			Now:            time.Now(),
+		}
+		w.Header().Set("content-type", "text/html; charset=utf-8")
+		if err := dashboardTemplate.Execute(w, data); err != nil {
+			errlog.LogError(errors.Wrap(err, "couldn't render dashboard"))
+		}
+	})
+	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		if err := json.NewEncoder(w).Encode(u.Status()); err != nil {
+			errlog.LogError(errors.Wrap(err, "couldn't encode status"))
+		}
+	})
+	mux.Handle("/results/", http.StripPrefix("/results/", http.FileServer(http.Dir(resultsDir))))
+	return mux
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"since": func(t *time.Time, now time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return now.Sub(*t).Round(time.Second).String() + " ago"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.RefreshSeconds}}">
+<title>Sonobuoy: {{.Status.Status}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: left; vertical-align: top; }
+.running { color: #1a5fb4; }
+.complete { color: #26a269; }
+.failed, .timed-out, .timed-out-partial { color: #c01c28; }
+</style>
+</head>
+<body>
+<h1>Sonobuoy run: <span class="{{.Status.Status}}">{{.Status.Status}}</span></h1>
+<p><a href="/results/">Browse results</a> &middot; <a href="/api/status">Status JSON</a></p>
+
+<h2>Plugins</h2>
+<table>
+<tr><th>Plugin</th><th>Node</th><th>Status</th><th>Progress</th><th>Last heartbeat</th><th>Reported</th><th>Error</th></tr>
+{{- range .Status.Plugins }}
+<tr>
+<td>{{.Plugin}}</td>
+<td>{{if .Node}}{{.Node}}{{else}}global{{end}}</td>
+<td class="{{.Status}}">{{.Status}}</td>
+<td>{{with .Progress}}{{if .Total}}{{.Completed}}/{{.Total}} ({{.Percent}}%){{end}}{{if .Message}} {{.Message}}{{end}}{{end}}</td>
+<td>{{since .LastHeartbeat $.Now}}</td>
+<td>{{since .ReportedAt $.Now}}</td>
+<td>{{.Error}}</td>
+</tr>
+{{- end }}
+</table>
+
+{{- if .Nodes }}
+<h2>Nodes</h2>
+<table>
+<tr><th>Plugin</th><th>Reported</th><th>Pending</th></tr>
+{{- range .Nodes }}
+<tr><td>{{.Plugin}}</td><td>{{len .Reported}}</td><td>{{range .Pending}}{{.}} {{end}}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+</body>
+</html>
+`))
@@ -0,0 +1,82 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+func TestUIHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-ui")
+	if err != nil {
+		t.Fatalf("couldn't make temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "e2e", "results"), 0755); err != nil {
+		t.Fatalf("couldn't make results dir: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "e2e", "results", "e2e.log"), []byte("all passed"), 0644); err != nil {
+		t.Fatalf("couldn't write result: %v", err)
+	}
+
+	u := newUpdater([]plugin.ExpectedResult{
+		{ResultType: "e2e"},
+		{ResultType: "systemd_logs", NodeName: "node1"},
+	}, "", nil)
+	u.ReceiveAll(map[string]*plugin.Result{"e2e": {ResultType: "e2e"}})
+	u.ReceiveProgress([]ProgressUpdate{{Plugin: "systemd_logs", Node: "node1", Completed: 1, Total: 4}})
+	handler := uiHandler(u, dir)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	page := rec.Body.String()
+	for _, expected := range []string{"Sonobuoy run: <span class=\"running\">running", "1/4 (25%)", "node1"} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("expected dashboard to contain %q, got:\n%v", expected, page)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/status", nil))
+	status := Status{}
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("couldn't decode status: %v", err)
+	}
+	if status.Status != RunningStatus || len(status.Plugins) != 2 || status.Plugins[0].Status != CompleteStatus {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/results/e2e/results/e2e.log", nil))
+	if body := rec.Body.String(); body != "all passed" {
+		t.Errorf("expected to download the result, got %q", body)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/missing", nil))
+	if rec.Code != 404 {
+		t.Errorf("expected a 404 for an unknown page, got %v", rec.Code)
+	}
+}
@@ -19,10 +19,13 @@ package aggregation
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 
@@ -32,6 +35,9 @@ import (
 const (
 	StatusAnnotationName = "sonobuoy.hept.io/status"
 	StatusPodName        = "sonobuoy"
+
+	// maxStatusErrorLength is how much of each error is kept in the status.
+	maxStatusErrorLength = 512
 )
 
 // node and name uniquely identify a single plugin result
@@ -60,11 +66,13 @@ func newUpdater(expected []plugin.ExpectedResult, namespace string, client kuber
 		client:    client,
 	}
 
+	started := time.Now()
 	for i, result := range expected {
 		u.status.Plugins[i] = PluginStatus{
-			Node:   result.NodeName,
-			Plugin: result.ResultType,
-			Status: RunningStatus,
+			Node:           result.NodeName,
+			Plugin:         result.ResultType,
+			Status:         RunningStatus,
+			LastTransition: &started,
 		}
 
 		u.positionLookup[expectedToKey(result)] = &u.status.Plugins[i]
@@ -87,10 +95,136 @@ func (u *updater) Receive(update *PluginStatus) error {
 		return fmt.Errorf("couldn't find key for %v", k)
 	}
 
+	if status.Status != update.Status {
+		now := time.Now()
+		status.LastTransition = &now
+	}
 	status.Status = update.Status
+	status.Reason = update.Reason
 	return u.status.updateStatus()
 }
 
+// ReceiveProgress records the latest progress of each plugin in the status.
+func (u *updater) ReceiveProgress(updates []ProgressUpdate) {
+	u.Lock()
+	defer u.Unlock()
+	for i := range updates {
+		update := updates[i]
+		status, ok := u.positionLookup[key{node: update.Node, name: update.Plugin}]
+		if !ok {
+			logrus.WithFields(
+				logrus.Fields{
+					"node":   update.Node,
+					"plugin": update.Plugin,
+				},
+			).Info("couldn't update plugin progress")
+			continue
+		}
+		status.Progress = &update
+	}
+}
+
+// ReceiveChecksumMismatches records how many uploads of each result have been
+// rejected as corrupted.
+func (u *updater) ReceiveChecksumMismatches(counts map[plugin.ExpectedResult]int) {
+	u.Lock()
+	defer u.Unlock()
+	for result, count := range counts {
+		if status, ok := u.positionLookup[expectedToKey(result)]; ok {
+			status.ChecksumMismatches = count
+		}
+	}
+}
+
+// ReceiveDuplicates records how many uploads of each result have been
+// received after it already had been.
+func (u *updater) ReceiveDuplicates(counts map[plugin.ExpectedResult]int) {
+	u.Lock()
+	defer u.Unlock()
+	for result, count := range counts {
+		if status, ok := u.positionLookup[expectedToKey(result)]; ok {
+			status.Duplicates = count
+		}
+	}
+}
+
+// ReceiveDiskUsage records how much space is left in the results volume.
+func (u *updater) ReceiveDiskUsage(usage *DiskUsage) {
+	u.Lock()
+	defer u.Unlock()
+	u.status.Disk = usage
+}
+
+// ReceiveHeartbeats records when each plugin's worker was last heard from.
+func (u *updater) ReceiveHeartbeats(heartbeats map[plugin.ExpectedResult]time.Time) {
+	u.Lock()
+	defer u.Unlock()
+	for result, t := range heartbeats {
+		if status, ok := u.positionLookup[expectedToKey(result)]; ok {
+			t := t
+			status.LastHeartbeat = &t
+		}
+	}
+}
+
+// ReceiveReportTimes records when each plugin's result was received.
+func (u *updater) ReceiveReportTimes(times map[plugin.ExpectedResult]time.Time) {
+	u.Lock()
+	defer u.Unlock()
+	for result, t := range times {
+		if status, ok := u.positionLookup[expectedToKey(result)]; ok {
+			t := t
+			status.ReportedAt = &t
+		}
+	}
+}
+
+// ReceivePods records the pod running each plugin, by the result type of the
+// plugin. Pods of plugins that run on every node are matched to the result of
+// the node they're on. If a plugin has had several pods, such as when a job's
+// pod is replaced, the newest is kept.
+func (u *updater) ReceivePods(pods map[string][]v1.Pod) {
+	u.Lock()
+	defer u.Unlock()
+	for resultType, list := range pods {
+		sorted := append([]v1.Pod(nil), list...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].CreationTimestamp.Before(&sorted[j].CreationTimestamp)
+		})
+		for _, pod := range sorted {
+			status, ok := u.positionLookup[key{node: pod.Spec.NodeName, name: resultType}]
+			if !ok {
+				if status, ok = u.positionLookup[key{name: resultType}]; !ok {
+					continue
+				}
+			}
+			status.Pod = pod.Name
+			status.PodNode = pod.Spec.NodeName
+			status.StartTime = nil
+			if pod.Status.StartTime != nil {
+				t := pod.Status.StartTime.Time
+				status.StartTime = &t
+			}
+		}
+	}
+}
+
+// ReceiveErrors records the last error reported for each plugin. Errors are
+// truncated to maxStatusErrorLength, since the status has to fit in an
+// annotation however many nodes there are.
+func (u *updater) ReceiveErrors(errs map[plugin.ExpectedResult]string) {
+	u.Lock()
+	defer u.Unlock()
+	for result, err := range errs {
+		if status, ok := u.positionLookup[expectedToKey(result)]; ok {
+			if len(err) > maxStatusErrorLength {
+				err = err[:maxStatusErrorLength] + "..."
+			}
+			status.Error = err
+		}
+	}
+}
+
 // Serialize json-encodes the status object.
 func (u *updater) Serialize() (string, error) {
 	u.RLock()
@@ -118,18 +252,30 @@ func (u *updater) Annotate() error {
 	return errors.Wrap(err, "couldn't patch pod annotation")
 }
 
+// RunStatus is the overall status of the run.
+func (u *updater) RunStatus() string {
+	u.RLock()
+	defer u.RUnlock()
+	return u.status.Status
+}
+
 // ReceiveAll takes a map of plugin.Result and calls Receive on all of them.
 func (u *updater) ReceiveAll(results map[string]*plugin.Result) {
 	// Could have race conditions, but will be eventually consistent
 	for _, result := range results {
-		state := "complete"
-		if result.Error != "" {
-			state = "failed"
+		state := CompleteStatus
+		if result.TimedOut {
+			state = TimedOutStatus
+		} else if result.Incomplete {
+			state = TimedOutPartialStatus
+		} else if result.Error != "" {
+			state = FailedStatus
 		}
 		update := PluginStatus{
 			Node:   result.NodeName,
 			Plugin: result.ResultType,
 			Status: state,
+			Reason: failureReason(result),
 		}
 
 		if err := u.Receive(&update); err != nil {
@@ -144,6 +290,16 @@ func (u *updater) ReceiveAll(results map[string]*plugin.Result) {
 	}
 }
 
+// failureReason is why result failed, if it's one of the plugin.Failure
+// reasons. Timed out results are always reported as timeouts, however the
+// timeout was reported.
+func failureReason(result *plugin.Result) string {
+	if result.FailureReason == "" && (result.TimedOut || result.Incomplete) {
+		return plugin.FailureTimeout
+	}
+	return result.FailureReason
+}
+
 func getPatch(annotation string) map[string]interface{} {
 	return map[string]interface{}{
 		"metadata": map[string]interface{}{
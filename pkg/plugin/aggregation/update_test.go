@@ -17,9 +17,13 @@ limitations under the License.
 package aggregation
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/heptio/sonobuoy/pkg/plugin"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestCreateUpdater(t *testing.T) {
@@ -47,3 +51,180 @@ func TestCreateUpdater(t *testing.T) {
 		t.Errorf("expected status to be failed, got %v", updater.status.Status)
 	}
 }
+
+func TestUpdaterReceiveProgress(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		{NodeName: "node1", ResultType: "systemd"},
+		{NodeName: "", ResultType: "e2e"},
+	}
+
+	updater := newUpdater(expected, "heptio-sonobuoy-test", nil)
+	updater.ReceiveProgress([]ProgressUpdate{
+		{Plugin: "e2e", Completed: 120, Total: 350},
+		{Plugin: "unknown", Completed: 1, Total: 2},
+	})
+
+	progress := updater.status.Plugins[1].Progress
+	if progress == nil || progress.Percent() != 34 {
+		t.Errorf("expected e2e to be 34%% complete, got %v", progress)
+	}
+	if updater.status.Plugins[0].Progress != nil {
+		t.Errorf("expected no progress for systemd, got %v", updater.status.Plugins[0].Progress)
+	}
+}
+
+func TestUpdaterReceiveAll_timedOut(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		{NodeName: "node1", ResultType: "systemd"},
+		{NodeName: "", ResultType: "e2e"},
+	}
+
+	updater := newUpdater(expected, "heptio-sonobuoy-test", nil)
+	updater.ReceiveAll(map[string]*plugin.Result{
+		"systemd/node1": {NodeName: "node1", ResultType: "systemd"},
+		"e2e":           {ResultType: "e2e", Error: timedOutError, TimedOut: true},
+	})
+
+	if status := updater.status.Plugins[1].Status; status != TimedOutStatus {
+		t.Errorf("expected e2e to be %v, got %v", TimedOutStatus, status)
+	}
+	if reason := updater.status.Plugins[1].Reason; reason != plugin.FailureTimeout {
+		t.Errorf("expected e2e to have failed with %v, got %q", plugin.FailureTimeout, reason)
+	}
+	if updater.status.Status != FailedStatus {
+		t.Errorf("expected the run to have failed, got %v", updater.status.Status)
+	}
+}
+
+func TestUpdaterReceiveAll_incomplete(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		{NodeName: "node1", ResultType: "systemd"},
+		{NodeName: "", ResultType: "e2e"},
+	}
+
+	updater := newUpdater(expected, "heptio-sonobuoy-test", nil)
+	updater.ReceiveAll(map[string]*plugin.Result{
+		"systemd/node1": {NodeName: "node1", ResultType: "systemd"},
+		"e2e":           {ResultType: "e2e", Incomplete: true},
+	})
+
+	if status := updater.status.Plugins[1].Status; status != TimedOutPartialStatus {
+		t.Errorf("expected e2e to be %v, got %v", TimedOutPartialStatus, status)
+	}
+	if updater.status.Status != FailedStatus {
+		t.Errorf("expected the run to have failed, got %v", updater.status.Status)
+	}
+}
+
+func TestUpdaterReceiveAll_reason(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		{NodeName: "node1", ResultType: "systemd"},
+		{NodeName: "node2", ResultType: "systemd"},
+	}
+
+	updater := newUpdater(expected, "heptio-sonobuoy-test", nil)
+	updater.ReceiveAll(map[string]*plugin.Result{
+		"systemd/node1": {NodeName: "node1", ResultType: "systemd", Error: "killed", FailureReason: plugin.FailureOOMKilled},
+		"systemd/node2": {NodeName: "node2", ResultType: "systemd", Error: "tests failed"},
+	})
+
+	if reason := updater.status.Plugins[0].Reason; reason != plugin.FailureOOMKilled {
+		t.Errorf("expected node1 to have failed with %v, got %q", plugin.FailureOOMKilled, reason)
+	}
+	if reason := updater.status.Plugins[1].Reason; reason != "" {
+		t.Errorf("expected node2 to have failed without a reason, got %q", reason)
+	}
+}
+
+func TestUpdaterReceiveErrors(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		{NodeName: "node1", ResultType: "systemd"},
+		{NodeName: "node2", ResultType: "systemd"},
+	}
+
+	updater := newUpdater(expected, "heptio-sonobuoy-test", nil)
+	reported := time.Now()
+	updater.ReceiveReportTimes(map[plugin.ExpectedResult]time.Time{expected[0]: reported})
+	updater.ReceiveErrors(map[plugin.ExpectedResult]string{
+		expected[0]: "checksum mismatch",
+		expected[1]: strings.Repeat("x", 2*maxStatusErrorLength),
+	})
+
+	node1, node2 := updater.status.Plugins[0], updater.status.Plugins[1]
+	if node1.ReportedAt == nil || !node1.ReportedAt.Equal(reported) {
+		t.Errorf("expected node1 to have reported at %v, got %v", reported, node1.ReportedAt)
+	}
+	if node2.ReportedAt != nil {
+		t.Errorf("expected node2 not to have reported, got %v", node2.ReportedAt)
+	}
+	if node1.Error != "checksum mismatch" {
+		t.Errorf("expected node1 error to be kept, got %q", node1.Error)
+	}
+	if len(node2.Error) != maxStatusErrorLength+len("...") {
+		t.Errorf("expected node2 error to be truncated, got %v characters", len(node2.Error))
+	}
+}
+
+func TestUpdaterReceivePods(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		{NodeName: "node1", ResultType: "systemd"},
+		{NodeName: "node2", ResultType: "systemd"},
+		{NodeName: "", ResultType: "e2e"},
+	}
+
+	updater := newUpdater(expected, "heptio-sonobuoy-test", nil)
+	created := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	started := metav1.NewTime(created.Add(time.Minute))
+	pod := func(name, node string, age time.Duration, startTime *metav1.Time) v1.Pod {
+		return v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created.Add(-age))},
+			Spec:       v1.PodSpec{NodeName: node},
+			Status:     v1.PodStatus{StartTime: startTime},
+		}
+	}
+	updater.ReceivePods(map[string][]v1.Pod{
+		"systemd": {pod("systemd-abc", "node1", 0, &started)},
+		// The job's pod was replaced, so only the newest is kept.
+		"e2e": {pod("e2e-new", "node3", 0, nil), pod("e2e-old", "node2", time.Hour, &started)},
+	})
+
+	node1, node2, e2e := updater.status.Plugins[0], updater.status.Plugins[1], updater.status.Plugins[2]
+	if node1.Pod != "systemd-abc" || node1.PodNode != "node1" || node1.StartTime == nil || !node1.StartTime.Equal(started.Time) {
+		t.Errorf("expected node1 to be run by systemd-abc on node1 since %v, got %+v", started, node1)
+	}
+	if node2.Pod != "" {
+		t.Errorf("expected node2 to have no pod yet, got %v", node2.Pod)
+	}
+	if e2e.Pod != "e2e-new" || e2e.PodNode != "node3" || e2e.StartTime != nil {
+		t.Errorf("expected e2e to be run by e2e-new on node3, not started yet, got %+v", e2e)
+	}
+}
+
+func TestUpdaterLastTransition(t *testing.T) {
+	expected := []plugin.ExpectedResult{
+		{NodeName: "", ResultType: "e2e"},
+	}
+
+	updater := newUpdater(expected, "heptio-sonobuoy-test", nil)
+	started := updater.status.Plugins[0].LastTransition
+	if started == nil {
+		t.Fatalf("expected the run's start to be the first transition")
+	}
+
+	time.Sleep(time.Millisecond)
+	update := &PluginStatus{Plugin: "e2e", Status: RunningStatus}
+	if err := updater.Receive(update); err != nil {
+		t.Fatalf("unexpected error receiving update %v", err)
+	}
+	if !updater.status.Plugins[0].LastTransition.Equal(*started) {
+		t.Errorf("expected no transition while still running, got %v", updater.status.Plugins[0].LastTransition)
+	}
+
+	update.Status = CompleteStatus
+	if err := updater.Receive(update); err != nil {
+		t.Fatalf("unexpected error receiving update %v", err)
+	}
+	if !updater.status.Plugins[0].LastTransition.After(*started) {
+		t.Errorf("expected a transition after %v when complete, got %v", started, updater.status.Plugins[0].LastTransition)
+	}
+}
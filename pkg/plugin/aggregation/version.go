@@ -0,0 +1,101 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package aggregation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/sirupsen/logrus"
+)
+
+// VersionMismatchError is returned when a worker built from a different
+// version of Sonobuoy than the aggregator submits a result, and mixed versions
+// aren't allowed. It's sent to the worker as the JSON body of a 409 response.
+type VersionMismatchError struct {
+	Plugin            string `json:"plugin"`
+	Node              string `json:"node,omitempty"`
+	AggregatorVersion string `json:"aggregatorVersion"`
+	WorkerVersion     string `json:"workerVersion"`
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("worker for plugin %v is version %v, but the aggregator is version %v", e.Plugin, e.WorkerVersion, e.AggregatorVersion)
+}
+
+// checkWorkerVersion returns a VersionMismatchError if result was submitted by
+// a worker built from a different version of Sonobuoy, unless mixed versions
+// are allowed. Workers from before versions were reported don't send theirs,
+// so their results are let through with a warning.
+func (a *Aggregator) checkWorkerVersion(result *plugin.Result) *VersionMismatchError {
+	if result.WorkerVersion == a.Version {
+		return nil
+	}
+	log := logrus.WithFields(logrus.Fields{
+		"plugin_name":        result.ResultType,
+		"node":               result.NodeName,
+		"aggregator_version": a.Version,
+	})
+	if result.WorkerVersion == "" {
+		log.Warning("worker didn't report its version")
+		return nil
+	}
+	if a.AllowMixedVersions {
+		log.WithField("worker_version", result.WorkerVersion).Warning("accepting a result from a worker of a different version")
+		return nil
+	}
+	return &VersionMismatchError{
+		Plugin:            result.ResultType,
+		Node:              result.NodeName,
+		AggregatorVersion: a.Version,
+		WorkerVersion:     result.WorkerVersion,
+	}
+}
+
+// refuseResult fails a result whose worker's version doesn't match the
+// aggregator's, storing the mismatch in place of what the worker sent so the
+// run doesn't wait for a result that will never be accepted.
+func (a *Aggregator) refuseResult(result *plugin.Result, mismatch *VersionMismatchError) error {
+	body, err := json.Marshal(map[string]string{"error": mismatch.Error()})
+	if err != nil {
+		return err
+	}
+	result.Body = strings.NewReader(string(body))
+	result.MimeType = "application/json"
+	result.Filename = ""
+	result.Partial = false
+	result.Verify = nil
+	result.Checksum = nil
+	result.Error = mismatch.Error()
+	result.FailureReason = plugin.FailureVersionMismatch
+
+	if a.isResultDuplicate(result) {
+		return a.handleDuplicate(result)
+	}
+	return a.handleResult(result)
+}
+
+// writeVersionMismatch tells a worker its result was refused because of its
+// version.
+func writeVersionMismatch(w http.ResponseWriter, mismatch *VersionMismatchError) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(mismatch)
+}
@@ -19,4 +19,69 @@ package plugin
 const (
 	// GracefulShutdownPeriod is how long plugins have to cleanly finish before they are terminated.
 	GracefulShutdownPeriod = 60
+
+	// ServiceAccountName is the service account that Sonobuoy, and the pods
+	// of plugins that don't declare the RBAC rules they need, run as.
+	ServiceAccountName = "sonobuoy-serviceaccount"
+
+	// GzipCompression is the results-compression setting that makes workers
+	// gzip results before uploading them.
+	GzipCompression = "gzip"
+
+	// GRPCProtocol is the results-protocol setting that makes workers submit
+	// results and progress over gRPC rather than plain HTTP.
+	GRPCProtocol = "grpc"
+
+	// LocalResultsVolume is the name of the volume that workers store results
+	// in when they can't submit them, and LocalResultsPath is where it's
+	// mounted, in both the plugin's pods and the pods that fetch results
+	// from it.
+	LocalResultsVolume = "local-results"
+	LocalResultsPath   = "/tmp/local-results"
+
+	// ServiceAccountTokenVolume is the name of the volume that workers keep
+	// a plugin's service account token and kubeconfig in, and
+	// ServiceAccountTokenPath is where it's mounted in the plugin's pod.
+	ServiceAccountTokenVolume = "sonobuoy-token"
+	ServiceAccountTokenPath   = "/tmp/sonobuoy-token"
+
+	// TokenFile and KubeconfigFile are the names of the service account
+	// token and the kubeconfig using it in the token volume.
+	TokenFile      = "token"
+	KubeconfigFile = "kubeconfig"
+
+	// PayloadVolume is the name of the volume that a plugin's files are
+	// downloaded to before it starts, and PayloadPath is where it's mounted
+	// in the plugin's container.
+	PayloadVolume = "sonobuoy-payload"
+	PayloadPath   = "/tmp/sonobuoy-payload"
+
+	// DefaultTokenExpirationSeconds is how long a plugin's service account
+	// tokens are valid for if it doesn't say, and MinTokenExpirationSeconds
+	// the least the API server allows.
+	DefaultTokenExpirationSeconds = 3600
+	MinTokenExpirationSeconds     = 600
+
+	// SecurityContextNone, SecurityContextRestricted and
+	// SecurityContextPrivileged are the security context modes. None leaves
+	// pods as they are. Restricted gives every pod the security contexts
+	// the restricted PodSecurity profile requires, so it can't run plugins
+	// that need the host. Privileged does the same except for those
+	// plugins, which are run privileged instead.
+	SecurityContextNone       = "none"
+	SecurityContextRestricted = "restricted"
+	SecurityContextPrivileged = "privileged"
+
+	// RestrictedUser is the user and group that pods with the restricted
+	// security context run as.
+	RestrictedUser = 1000
+
+	// IPv4Family and IPv6Family are the address families the aggregator can
+	// advertise itself to workers with, named like Kubernetes' IP families.
+	IPv4Family = "IPv4"
+	IPv6Family = "IPv6"
+
+	// AggregatorService is the name of the Service in front of the
+	// aggregator.
+	AggregatorService = "sonobuoy-master"
 )
@@ -20,9 +20,15 @@ import (
 	"crypto/ecdsa"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/ghodss/yaml"
 	"github.com/heptio/sonobuoy/pkg/plugin"
 	"github.com/heptio/sonobuoy/pkg/plugin/manifest"
 	"github.com/pkg/errors"
@@ -31,6 +37,9 @@ import (
 	kuberuntime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// ResultsTokenKey is the key of a plugin's results token in its secret.
+const ResultsTokenKey = "results-token"
+
 // Base is the  truct that stores state for plugin drivers and contains helper methods.
 type Base struct {
 	Definition      plugin.Definition
@@ -39,20 +48,100 @@ type Base struct {
 	SonobuoyImage   string
 	CleanedUp       bool
 	ImagePullPolicy string
+	// NodeLevel is set for plugins whose pods need the host, which the
+	// privileged security context mode runs privileged.
+	NodeLevel bool
+	// StopsOnTimeout is set for plugins whose workers stop their pod when
+	// the plugin times out. Pods that a controller recreates can't be
+	// stopped that way.
+	StopsOnTimeout bool
 }
 
 // TemplateData is all the fields available to plugin driver templates.
 type TemplateData struct {
-	PluginName        string
-	ResultType        string
-	SessionID         string
-	Namespace         string
-	SonobuoyImage     string
-	ImagePullPolicy   string
-	ProducerContainer string
-	MasterAddress     string
-	CACert            string
-	SecretName        string
+	PluginName         string
+	ResultType         string
+	SessionID          string
+	Namespace          string
+	SonobuoyImage      string
+	ImagePullPolicy    string
+	ProducerContainer  string
+	MasterAddress      string
+	CACert             string
+	SecretName         string
+	ResultsStream      string
+	ResultsCompression string
+	ResultsProtocol    string
+	TimeoutSeconds     int
+	Replicas           int
+	ImagePullSecrets   []string
+	// ExtraVolumes, Sidecars, NodeSelector, Tolerations and Affinity are
+	// YAML, to be indented into the pod spec. They're empty if the plugin
+	// doesn't set them.
+	ExtraVolumes string
+	Sidecars     string
+	NodeSelector string
+	Tolerations  string
+	Affinity     string
+	// LocalResultsVolume is YAML for the volume workers store results in
+	// when they can't submit them, or empty if they submit them.
+	LocalResultsVolume string
+	// WorkerResources is YAML for the resource requirements of the worker
+	// container, or empty if the Sonobuoy config doesn't set them.
+	WorkerResources   string
+	PriorityClassName string
+	// TracingEndpoint and TraceParent configure workers to export trace
+	// spans, or are empty if the run isn't traced.
+	TracingEndpoint string
+	TraceParent     string
+	// ServiceAccountToken is set if the worker keeps a service account
+	// token for the plugin, requested for TokenAudience to expire after
+	// TokenExpirationSeconds.
+	ServiceAccountToken    bool
+	TokenAudience          string
+	TokenExpirationSeconds int64
+	// HTTPProxy, HTTPSProxy and NoProxy set the worker's proxy, and CABundle
+	// is PEM for the certificates it trusts besides CACert, if any.
+	HTTPProxy  string
+	HTTPSProxy string
+	NoProxy    string
+	CABundle   string
+	// ServiceAccountName is the service account the plugin's pods run as,
+	// and OwnServiceAccount is set if it's the plugin's own.
+	ServiceAccountName string
+	OwnServiceAccount  bool
+	// Labels and Annotations are YAML for the custom labels and annotations
+	// of the plugin's objects and pods, or empty if there are none.
+	Labels      string
+	Annotations string
+	// PodSecurityContext and ContainerSecurityContext are YAML for the
+	// security contexts of the plugin's pods and of the containers Sonobuoy
+	// adds to them, or empty if they're left as they are. SeccompProfile is
+	// the pods' seccomp profile, if they're given one.
+	PodSecurityContext       string
+	ContainerSecurityContext string
+	SeccompProfile           string
+	// Payload is set if the plugin has files, which an init container
+	// downloads from the aggregator to the payload volume.
+	Payload bool
+	// ExternalResultsURL is where the worker also POSTs results, if
+	// anywhere, with the Authorization header from the
+	// ExternalResultsSecretKey key of ExternalResultsSecret if it's set.
+	ExternalResultsURL       string
+	ExternalResultsSecret    string
+	ExternalResultsSecretKey string
+	// ResultsTransport is the command the worker delivers results with
+	// instead of submitting them, as a JSON array quoted for YAML, or empty
+	// if it submits them.
+	ResultsTransport string
+	// RetryAttempts, RetryMaxElapsedTime and RetryJitter change how the
+	// worker retries submitting results, or are empty to keep its defaults.
+	RetryAttempts       int
+	RetryMaxElapsedTime string
+	RetryJitter         string
+	// StopOnTimeout is set if the worker stops its pod once it has
+	// reported that the plugin timed out.
+	StopOnTimeout bool
 }
 
 // GetSessionID returns the session id associated with the plugin.
@@ -75,32 +164,256 @@ func (b *Base) GetResultType() string {
 	return b.Definition.ResultType
 }
 
+// GetTimeoutSeconds returns how long this plugin has to submit its results (to adhere to plugin.Interface).
+func (b *Base) GetTimeoutSeconds() int {
+	return b.Definition.TimeoutSeconds
+}
+
+// stopsOnTimeout returns whether the plugin's workers stop their pod when it
+// times out.
+func (b *Base) stopsOnTimeout() bool {
+	return b.StopsOnTimeout && b.Definition.TimeoutSeconds > 0
+}
+
+// GetDependsOn returns the names of the plugins this one waits for (to adhere to plugin.Interface).
+func (b *Base) GetDependsOn() []string {
+	return b.Definition.DependsOn
+}
+
+// GetResultProcessors returns the names of the processors run on this plugin's results (to adhere to plugin.Interface).
+func (b *Base) GetResultProcessors() []string {
+	return b.Definition.ResultProcessors
+}
+
+// GetResultFormat returns the name of the format this plugin's results must be valid in (to adhere to plugin.Interface).
+func (b *Base) GetResultFormat() string {
+	return b.Definition.ResultFormat
+}
+
+// GetFiles returns the files the plugin's workers download before it starts.
+func (b *Base) GetFiles() map[string]string {
+	return b.Definition.Files
+}
+
 //GetTemplateData fills a TemplateData struct with the passed in and state variables.
 func (b *Base) GetTemplateData(masterAddress string, cert *tls.Certificate) (*TemplateData, error) {
 
-	container, err := kuberuntime.Encode(manifest.Encoder, &b.Definition.Spec)
+	securityContext := b.containerSecurityContext()
+	producer := b.producerContainer().DeepCopy()
+	if producer.SecurityContext == nil && securityContext != nil {
+		producer.SecurityContext = securityContext.DeepCopy()
+	}
+	container, err := kuberuntime.Encode(manifest.Encoder, producer)
 	if err != nil {
 		return nil, errors.Wrapf(err, "couldn't reserialize container for job %q", b.Definition.Name)
 	}
 
 	cacert := getCACertPEM(cert)
 
-	return &TemplateData{
-		PluginName:        b.Definition.Name,
-		ResultType:        b.Definition.ResultType,
-		SessionID:         b.SessionID,
-		Namespace:         b.Namespace,
-		SonobuoyImage:     b.SonobuoyImage,
-		ImagePullPolicy:   b.ImagePullPolicy,
-		ProducerContainer: string(container),
-		MasterAddress:     masterAddress,
-		CACert:            cacert,
-		SecretName:        b.GetSecretName(),
-	}, nil
+	var volumes, sidecars, nodeSelector, tolerations, affinity, localResults, workerResources, labels, annotations string
+	var podContext, containerContext, seccomp string
+	if len(b.Definition.ExtraVolumes) > 0 {
+		if volumes, err = toYAML(b.Definition.ExtraVolumes); err != nil {
+			return nil, errors.Wrapf(err, "couldn't serialize extra volumes for plugin %q", b.Definition.Name)
+		}
+	}
+	if len(b.Definition.Sidecars) > 0 {
+		withMounts := shareVolumeMounts(b.Definition.Spec.Container, b.Definition.Sidecars)
+		withSecurityContext(withMounts, securityContext)
+		if sidecars, err = toYAML(withMounts); err != nil {
+			return nil, errors.Wrapf(err, "couldn't serialize sidecars for plugin %q", b.Definition.Name)
+		}
+	}
+	if len(b.Definition.NodeSelector) > 0 {
+		if nodeSelector, err = toYAML(b.Definition.NodeSelector); err != nil {
+			return nil, errors.Wrapf(err, "couldn't serialize node selector for plugin %q", b.Definition.Name)
+		}
+	}
+	if len(b.Definition.Tolerations) > 0 {
+		if tolerations, err = toYAML(b.Definition.Tolerations); err != nil {
+			return nil, errors.Wrapf(err, "couldn't serialize tolerations for plugin %q", b.Definition.Name)
+		}
+	}
+	if b.Definition.Affinity != nil {
+		if affinity, err = toYAML(b.Definition.Affinity); err != nil {
+			return nil, errors.Wrapf(err, "couldn't serialize affinity for plugin %q", b.Definition.Name)
+		}
+	}
+	if volume := b.localResultsVolume(); volume != nil {
+		if localResults, err = toYAML(volume); err != nil {
+			return nil, errors.Wrapf(err, "couldn't serialize local results volume for plugin %q", b.Definition.Name)
+		}
+	}
+	if resources := b.Definition.WorkerResources; len(resources.Requests) > 0 || len(resources.Limits) > 0 {
+		if workerResources, err = toYAML(resources); err != nil {
+			return nil, errors.Wrapf(err, "couldn't serialize worker resources for plugin %q", b.Definition.Name)
+		}
+	}
+	if len(b.Definition.Labels) > 0 {
+		if labels, err = toYAML(b.Definition.Labels); err != nil {
+			return nil, errors.Wrapf(err, "couldn't serialize labels for plugin %q", b.Definition.Name)
+		}
+	}
+	if len(b.Definition.Annotations) > 0 {
+		if annotations, err = toYAML(b.Definition.Annotations); err != nil {
+			return nil, errors.Wrapf(err, "couldn't serialize annotations for plugin %q", b.Definition.Name)
+		}
+	}
+	if context := b.podSecurityContext(); context != nil {
+		if podContext, err = toYAML(context); err != nil {
+			return nil, errors.Wrapf(err, "couldn't serialize pod security context for plugin %q", b.Definition.Name)
+		}
+		seccomp = seccompProfile
+	}
+	if securityContext != nil {
+		if containerContext, err = toYAML(securityContext); err != nil {
+			return nil, errors.Wrapf(err, "couldn't serialize security context for plugin %q", b.Definition.Name)
+		}
+	}
+
+	data := &TemplateData{
+		PluginName:         b.Definition.Name,
+		ResultType:         b.Definition.ResultType,
+		SessionID:          b.SessionID,
+		Namespace:          b.Namespace,
+		SonobuoyImage:      b.SonobuoyImage,
+		ImagePullPolicy:    b.ImagePullPolicy,
+		ProducerContainer:  string(container),
+		MasterAddress:      masterAddress,
+		CACert:             cacert,
+		SecretName:         b.GetSecretName(),
+		ResultsStream:      b.Definition.ResultsStream,
+		ResultsCompression: b.Definition.ResultsCompression,
+		ResultsProtocol:    b.Definition.ResultsProtocol,
+		TimeoutSeconds:     b.Definition.TimeoutSeconds,
+		Replicas:           b.Definition.Replicas,
+		ImagePullSecrets:   b.Definition.ImagePullSecrets,
+		ExtraVolumes:       volumes,
+		Sidecars:           sidecars,
+		NodeSelector:       nodeSelector,
+		Tolerations:        tolerations,
+		Affinity:           affinity,
+		LocalResultsVolume: localResults,
+		WorkerResources:    workerResources,
+		PriorityClassName:  b.Definition.PriorityClassName,
+		TracingEndpoint:    b.Definition.TracingEndpoint,
+		TraceParent:        b.Definition.TraceParent,
+		HTTPProxy:          b.Definition.Proxy.HTTPProxy,
+		HTTPSProxy:         b.Definition.Proxy.HTTPSProxy,
+		NoProxy:            b.Definition.Proxy.NoProxy,
+		CABundle:           b.Definition.CABundle,
+		ServiceAccountName: b.ServiceAccountName(),
+		OwnServiceAccount:  b.Definition.RBAC != nil,
+		Labels:             labels,
+		Annotations:        annotations,
+
+		PodSecurityContext:       podContext,
+		ContainerSecurityContext: containerContext,
+		SeccompProfile:           seccomp,
+		Payload:                  len(b.Definition.Files) > 0,
+		StopOnTimeout:            b.stopsOnTimeout(),
+	}
+	if token := b.Definition.ServiceAccountToken; token != nil {
+		data.ServiceAccountToken = true
+		data.TokenAudience = token.Audience
+		data.TokenExpirationSeconds = token.ExpirationSeconds
+	}
+	if external := b.Definition.ExternalResults; external != nil {
+		data.ExternalResultsURL = external.URL
+		data.ExternalResultsSecret = external.AuthSecret
+		data.ExternalResultsSecretKey = external.AuthSecretKey
+		if data.ExternalResultsSecretKey == "" {
+			data.ExternalResultsSecretKey = manifest.DefaultExternalResultsAuthKey
+		}
+	}
+	if retry := b.Definition.SubmitRetry; retry != nil {
+		data.RetryAttempts = retry.Attempts
+		if retry.MaxElapsedSeconds > 0 {
+			data.RetryMaxElapsedTime = (time.Duration(retry.MaxElapsedSeconds) * time.Second).String()
+		}
+		if retry.Jitter > 0 {
+			data.RetryJitter = strconv.FormatFloat(retry.Jitter, 'g', -1, 64)
+		}
+	}
+	if transport := b.Definition.ResultsTransport; transport != nil {
+		if data.ResultsTransport, err = quotedJSON(transport.Command); err != nil {
+			return nil, errors.Wrapf(err, "couldn't serialize results transport for plugin %q", b.Definition.Name)
+		}
+	}
+	return data, nil
+}
+
+// producerContainer returns the plugin's container, which also mounts the
+// token directory and is pointed at the kubeconfig there if the worker keeps a
+// service account token for it, and mounts the payload volume if the plugin
+// has files.
+func (b *Base) producerContainer() *manifest.Container {
+	if b.Definition.ServiceAccountToken == nil && len(b.Definition.Files) == 0 {
+		return &b.Definition.Spec
+	}
+
+	container := b.Definition.Spec.DeepCopy()
+	if b.Definition.ServiceAccountToken != nil {
+		container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+			Name:      plugin.ServiceAccountTokenVolume,
+			MountPath: plugin.ServiceAccountTokenPath,
+			ReadOnly:  true,
+		})
+		container.Env = append(container.Env, v1.EnvVar{
+			Name:  "KUBECONFIG",
+			Value: path.Join(plugin.ServiceAccountTokenPath, plugin.KubeconfigFile),
+		})
+	}
+	if len(b.Definition.Files) > 0 {
+		container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+			Name:      plugin.PayloadVolume,
+			MountPath: plugin.PayloadPath,
+			ReadOnly:  true,
+		})
+	}
+	return container
+}
+
+// shareVolumeMounts returns copies of the sidecars that also mount each of the
+// plugin container's volumes, including its results, at the same path, unless
+// they mount that volume themselves.
+func shareVolumeMounts(plugin v1.Container, sidecars []v1.Container) []v1.Container {
+	shared := make([]v1.Container, len(sidecars))
+	for i, sidecar := range sidecars {
+		sidecar.DeepCopyInto(&shared[i])
+		mounted := map[string]bool{}
+		for _, mount := range sidecar.VolumeMounts {
+			mounted[mount.Name] = true
+		}
+		for _, mount := range plugin.VolumeMounts {
+			if !mounted[mount.Name] {
+				shared[i].VolumeMounts = append(shared[i].VolumeMounts, mount)
+			}
+		}
+	}
+	return shared
+}
+
+// toYAML serializes a field of a plugin's pod spec for a template.
+func toYAML(field interface{}) (string, error) {
+	b, err := yaml.Marshal(field)
+	return strings.TrimSpace(string(b)), errors.WithStack(err)
+}
+
+// quotedJSON encodes field as JSON, quoted so that it can be the value of an
+// environment variable in a template.
+func quotedJSON(field interface{}) (string, error) {
+	b, err := json.Marshal(field)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	quoted, err := json.Marshal(string(b))
+	return string(quoted), errors.WithStack(err)
 }
 
-// MakeTLSSecret makes a Kubernetes secret object for the given TLS certificate.
-func (b *Base) MakeTLSSecret(cert *tls.Certificate) (*v1.Secret, error) {
+// MakeTLSSecret makes a Kubernetes secret object for the given TLS certificate
+// and results token.
+func (b *Base) MakeTLSSecret(cert *tls.Certificate, token string) (*v1.Secret, error) {
 	rsaKey, ok := cert.PrivateKey.(*ecdsa.PrivateKey)
 	if !ok {
 		return nil, errors.New("private key not ECDSA")
@@ -123,12 +436,15 @@ func (b *Base) MakeTLSSecret(cert *tls.Certificate) (*v1.Secret, error) {
 
 	return &v1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      b.GetSecretName(),
-			Namespace: b.Namespace,
+			Name:        b.GetSecretName(),
+			Namespace:   b.Namespace,
+			Labels:      b.Definition.Labels,
+			Annotations: b.Definition.Annotations,
 		},
 		Data: map[string][]byte{
 			v1.TLSPrivateKeyKey: keyPEM,
 			v1.TLSCertKey:       certPEM,
+			ResultsTokenKey:     []byte(token),
 		},
 		Type: v1.SecretTypeTLS,
 	}, nil
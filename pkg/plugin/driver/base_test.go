@@ -21,10 +21,13 @@ import (
 	"crypto/sha1"
 	"crypto/x509"
 	"encoding/pem"
+	"reflect"
 	"testing"
 
 	"github.com/heptio/sonobuoy/pkg/backplane/ca"
 	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/manifest"
+	rbacv1 "k8s.io/api/rbac/v1"
 )
 
 func TestMakeTLSSecret(t *testing.T) {
@@ -49,7 +52,7 @@ func TestMakeTLSSecret(t *testing.T) {
 		SessionID: sessionID,
 	}
 
-	secret, err := driver.MakeTLSSecret(cert)
+	secret, err := driver.MakeTLSSecret(cert, "test-token")
 	if err != nil {
 		t.Fatalf("unexpected error %v making TLS Secret", err)
 	}
@@ -74,6 +77,10 @@ func TestMakeTLSSecret(t *testing.T) {
 		t.Error("key fingerprint didn't match")
 	}
 
+	if token := string(secret.Data[ResultsTokenKey]); token != "test-token" {
+		t.Errorf("expected results token test-token, got %q", token)
+	}
+
 	certPEM, _ := pem.Decode(secret.Data["tls.crt"])
 	if certPEM == nil {
 		t.Fatal("couldn't decode tls.crt")
@@ -83,3 +90,47 @@ func TestMakeTLSSecret(t *testing.T) {
 		t.Error("cert fingerprint didn't match")
 	}
 }
+
+func TestNamespaceRules(t *testing.T) {
+	testCases := []struct {
+		name     string
+		base     Base
+		expected []string
+	}{
+		{
+			name:     "declared rules",
+			base:     Base{Definition: plugin.Definition{RBAC: &manifest.RBAC{Rules: []rbacv1.PolicyRule{{Resources: []string{"configmaps"}}}}}},
+			expected: []string{"configmaps"},
+		},
+		{
+			name:     "token",
+			base:     Base{Definition: plugin.Definition{RBAC: &manifest.RBAC{}, ServiceAccountToken: &manifest.ServiceAccountToken{}}},
+			expected: []string{"serviceaccounts/token"},
+		},
+		{
+			name:     "stops on timeout",
+			base:     Base{StopsOnTimeout: true, Definition: plugin.Definition{RBAC: &manifest.RBAC{}, TimeoutSeconds: 60}},
+			expected: []string{"pods"},
+		},
+		{
+			name: "no timeout",
+			base: Base{StopsOnTimeout: true, Definition: plugin.Definition{RBAC: &manifest.RBAC{}}},
+		},
+		{
+			name: "can't stop on timeout",
+			base: Base{Definition: plugin.Definition{RBAC: &manifest.RBAC{}, TimeoutSeconds: 60}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var resources []string
+			for _, rule := range tc.base.namespaceRules() {
+				resources = append(resources, rule.Resources...)
+			}
+			if !reflect.DeepEqual(resources, tc.expected) {
+				t.Errorf("expected rules for %v, got %v", tc.expected, resources)
+			}
+		})
+	}
+}
@@ -20,12 +20,15 @@ import (
 	"bytes"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"time"
 
 	appsv1beta2 "k8s.io/api/apps/v1beta2"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kuberuntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 
@@ -34,6 +37,7 @@ import (
 	"github.com/heptio/sonobuoy/pkg/plugin/driver"
 	"github.com/heptio/sonobuoy/pkg/plugin/driver/utils"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 // Plugin is a plugin driver that dispatches containers to each node,
@@ -56,12 +60,15 @@ func NewPlugin(dfn plugin.Definition, namespace, sonobuoyImage, imagePullPolicy
 			SonobuoyImage:   sonobuoyImage,
 			ImagePullPolicy: imagePullPolicy,
 			CleanedUp:       false,
+			NodeLevel:       true,
 		},
 	}
 }
 
-// ExpectedResults returns the list of results expected for this daemonset.
+// ExpectedResults returns the list of results expected for this daemonset,
+// one from each node with an operating system the plugin runs on.
 func (p *Plugin) ExpectedResults(nodes []v1.Node) []plugin.ExpectedResult {
+	nodes = p.filterNodes(nodes)
 	ret := make([]plugin.ExpectedResult, 0, len(nodes))
 
 	for _, node := range nodes {
@@ -79,44 +86,69 @@ func getMasterAddress(hostname string) string {
 }
 
 //FillTemplate populates the internal Job YAML template with the values for this particular daemonset.
+// Plugins that run on several operating systems get a DaemonSet for each.
 func (p *Plugin) FillTemplate(hostname string, cert *tls.Certificate) ([]byte, error) {
 	var b bytes.Buffer
 
-	tmplData, err := p.GetTemplateData(getMasterAddress(hostname), cert)
-	if err != nil {
-		return nil, errors.Wrapf(err, "couldn't get template data for %q", p.Definition.Name)
-	}
+	for _, os := range p.operatingSystems() {
+		tmplData, err := p.getTemplateData(getMasterAddress(hostname), cert, os)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't get template data for %q", p.Definition.Name)
+		}
 
-	if err := daemonSetTemplate.Execute(&b, tmplData); err != nil {
-		return nil, errors.Wrapf(err, "couldn't fill template %q", p.Definition.Name)
+		if err := daemonSetTemplate.Execute(&b, tmplData); err != nil {
+			return nil, errors.Wrapf(err, "couldn't fill template %q", p.Definition.Name)
+		}
 	}
 	return b.Bytes(), nil
 }
 
 // Run dispatches worker pods according to the DaemonSet's configuration.
-func (p *Plugin) Run(kubeclient kubernetes.Interface, hostname string, cert *tls.Certificate) error {
-	var daemonSet appsv1beta2.DaemonSet
-
+func (p *Plugin) Run(kubeclient kubernetes.Interface, hostname string, cert *tls.Certificate, token string) error {
 	b, err := p.FillTemplate(hostname, cert)
 	if err != nil {
 		return errors.Wrap(err, "couldn't fill template")
 	}
-	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &daemonSet); err != nil {
-		return errors.Wrapf(err, "could not decode the executed template into a daemonset. Plugin name: ", p.GetName())
+
+	var daemonSets []appsv1beta2.DaemonSet
+	d := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(b), 4096)
+	for {
+		ext := kuberuntime.RawExtension{}
+		if err := d.Decode(&ext); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return errors.Wrapf(err, "could not decode the executed template. Plugin name: %v", p.GetName())
+		}
+		if len(bytes.TrimSpace(ext.Raw)) == 0 {
+			continue
+		}
+
+		var daemonSet appsv1beta2.DaemonSet
+		if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), ext.Raw, &daemonSet); err != nil {
+			return errors.Wrapf(err, "could not decode the executed template into a daemonset. Plugin name: %v", p.GetName())
+		}
+		daemonSets = append(daemonSets, daemonSet)
 	}
 
-	secret, err := p.MakeTLSSecret(cert)
+	secret, err := p.MakeTLSSecret(cert, token)
 	if err != nil {
 		return errors.Wrapf(err, "couldn't make secret for daemonset plugin %v", p.GetName())
 	}
 
+	if err := p.CreateRBAC(kubeclient); err != nil {
+		return err
+	}
+
 	if _, err := kubeclient.CoreV1().Secrets(p.Namespace).Create(secret); err != nil {
 		return errors.Wrapf(err, "couldn't create TLS secret for daemonset plugin %v", p.GetName())
 	}
 
-	// TODO(EKF): Move to v1 in 1.11
-	if _, err := kubeclient.AppsV1beta2().DaemonSets(p.Namespace).Create(&daemonSet); err != nil {
-		return errors.Wrapf(err, "could not create DaemonSet for daemonset plugin %v", p.GetName())
+	for i := range daemonSets {
+		// TODO(EKF): Move to v1 in 1.11
+		if _, err := kubeclient.AppsV1beta2().DaemonSets(p.Namespace).Create(&daemonSets[i]); err != nil {
+			return errors.Wrapf(err, "could not create DaemonSet for daemonset plugin %v", p.GetName())
+		}
 	}
 
 	return nil
@@ -143,6 +175,19 @@ func (p *Plugin) Cleanup(kubeclient kubernetes.Interface) {
 	if err != nil {
 		errlog.LogError(errors.Wrapf(err, "could not delete DaemonSet-%v for daemonset plugin %v", p.GetSessionID(), p.GetName()))
 	}
+
+	p.DeleteRBAC(kubeclient)
+}
+
+// retry deletes a failed pod so that the DaemonSet recreates it on the same
+// node.
+func (p *Plugin) retry(kubeclient kubernetes.Interface, pod *v1.Pod, attempt int, why string) {
+	logrus.Infof("Retrying plugin %v on node %v (attempt %v of %v): %v", p.GetName(), pod.Spec.NodeName, attempt, p.Definition.Retries, why)
+
+	err := kubeclient.CoreV1().Pods(p.Namespace).Delete(pod.Name, &metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		errlog.LogError(errors.Wrapf(err, "couldn't delete failed pod %v for DaemonSet plugin %v", pod.Name, p.GetName()))
+	}
 }
 
 func (p *Plugin) listOptions() metav1.ListOptions {
@@ -152,6 +197,8 @@ func (p *Plugin) listOptions() metav1.ListOptions {
 }
 
 // findDaemonSet gets the daemonset that we created, using a kubernetes label search.
+// Plugins that run on several operating systems create one for each, which are
+// all created together, so the first is returned.
 func (p *Plugin) findDaemonSet(kubeclient kubernetes.Interface) (*appsv1beta2.DaemonSet, error) {
 	// TODO(EKF): Move to v1 in 1.11
 	dsets, err := kubeclient.AppsV1beta2().DaemonSets(p.Namespace).List(p.listOptions())
@@ -159,8 +206,9 @@ func (p *Plugin) findDaemonSet(kubeclient kubernetes.Interface) (*appsv1beta2.Da
 		return nil, errors.WithStack(err)
 	}
 
-	if len(dsets.Items) != 1 {
-		return nil, errors.Errorf("expected plugin %v to create 1 daemonset, found %v", p.Definition.Name, len(dsets.Items))
+	expected := len(p.operatingSystems())
+	if len(dsets.Items) != expected {
+		return nil, errors.Errorf("expected plugin %v to create %v daemonset(s), found %v", p.Definition.Name, expected, len(dsets.Items))
 	}
 
 	return &dsets.Items[0], nil
@@ -169,8 +217,10 @@ func (p *Plugin) findDaemonSet(kubeclient kubernetes.Interface) (*appsv1beta2.Da
 // Monitor adheres to plugin.Interface by ensuring the DaemonSet is correctly
 // configured and that each pod is running normally.
 func (p *Plugin) Monitor(kubeclient kubernetes.Interface, availableNodes []v1.Node, resultsCh chan<- *plugin.Result) {
+	availableNodes = p.filterNodes(availableNodes)
 	podsReported := make(map[string]bool)
 	podsFound := make(map[string]bool, len(availableNodes))
+	podsRetried := make(map[string]int)
 	for _, node := range availableNodes {
 		podsFound[node.Name] = false
 		podsReported[node.Name] = false
@@ -211,13 +261,25 @@ func (p *Plugin) Monitor(kubeclient kubernetes.Interface, availableNodes []v1.No
 			}
 
 			podsFound[nodeName] = true
-			// Check if it's failing and submit the error result
-			if isFailing, reason := utils.IsPodFailing(&pod); isFailing {
+			// Pods we've deleted to retry are replaced by the DaemonSet
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+
+			// Check if it's failing and submit the error result, unless
+			// it can be deleted for the DaemonSet to try again
+			if reason, message := utils.PodFailure(&pod); reason != "" {
+				if utils.RetryablePodFailure(reason) && podsRetried[nodeName] < p.Definition.Retries {
+					podsRetried[nodeName]++
+					p.retry(kubeclient, &pod, podsRetried[nodeName], message)
+					continue
+				}
 				podsReported[nodeName] = true
 
 				resultsCh <- utils.MakeErrorResult(p.GetResultType(), map[string]interface{}{
-					"error": reason,
-					"pod":   pod,
+					"error":  message,
+					"reason": reason,
+					"pod":    pod,
 				}, nodeName)
 			}
 		}
@@ -237,6 +299,7 @@ func (p *Plugin) Monitor(kubeclient kubernetes.Interface, availableNodes []v1.No
 						time.Now().Sub(ds.CreationTimestamp.Time),
 						p.Definition.Name,
 					),
+					"reason": plugin.FailureUnschedulable,
 				}, node.Name)
 			}
 		}
@@ -17,9 +17,12 @@ limitations under the License.
 package daemonset
 
 import (
+	"bytes"
 	"crypto/sha1"
 	"encoding/pem"
 	"fmt"
+	"io"
+	"reflect"
 	"testing"
 
 	"github.com/heptio/sonobuoy/pkg/backplane/ca"
@@ -28,7 +31,9 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kuberuntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/client-go/kubernetes/scheme"
 )
 
@@ -122,3 +127,245 @@ func TestFillTemplate(t *testing.T) {
 		t.Errorf("CA_CERT fingerprint didn't match")
 	}
 }
+
+func TestFillTemplate_podSpec(t *testing.T) {
+	affinity := &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{
+						Key:      "kubernetes.io/hostname",
+						Operator: corev1.NodeSelectorOpNotIn,
+						Values:   []string{"node01"},
+					}},
+				}},
+			},
+		},
+	}
+	volume := corev1.Volume{
+		Name:         "config",
+		VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "plugin-config"}}},
+	}
+	toleration := corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "gpu", Effect: corev1.TaintEffectNoSchedule}
+
+	testDaemonSet := NewPlugin(plugin.Definition{
+		Name:       "test-plugin",
+		ResultType: "test-plugin-result",
+		Spec: manifest.Container{
+			Container: corev1.Container{
+				Name:         "producer-container",
+				Env:          []corev1.EnvVar{{Name: "FOO", Value: "bar"}},
+				VolumeMounts: []corev1.VolumeMount{{Name: "config", MountPath: "/etc/plugin"}},
+			},
+		},
+		ExtraVolumes: []corev1.Volume{volume},
+		NodeSelector: map[string]string{"accelerator": "gpu"},
+		Tolerations:  []corev1.Toleration{toleration},
+		Affinity:     affinity,
+		Labels:       map[string]string{"app.kubernetes.io/part-of": "conformance"},
+		Annotations:  map[string]string{"sidecar.istio.io/inject": "false"},
+	}, expectedNamespace, expectedImageName, "Always")
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	var daemonSet v1beta1.DaemonSet
+	b, err := testDaemonSet.FillTemplate("", clientCert)
+	if err != nil {
+		t.Fatalf("Failed to fill template: %v", err)
+	}
+	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &daemonSet); err != nil {
+		t.Fatalf("Failed to decode template to daemonSet: %v\n%s", err, b)
+	}
+
+	spec := daemonSet.Spec.Template.Spec
+	if len(spec.Volumes) != 3 || !reflect.DeepEqual(spec.Volumes[2], volume) {
+		t.Errorf("Expected the extra volume after Sonobuoy's, got %+v", spec.Volumes)
+	}
+	if !reflect.DeepEqual(spec.NodeSelector, map[string]string{"accelerator": "gpu", osLabel: LinuxOS}) {
+		t.Errorf("Expected node selector accelerator=gpu on linux, got %v", spec.NodeSelector)
+	}
+	if len(spec.Tolerations) != 3 || !reflect.DeepEqual(spec.Tolerations[2], toleration) {
+		t.Errorf("Expected the plugin's toleration after Sonobuoy's, got %+v", spec.Tolerations)
+	}
+	if !reflect.DeepEqual(spec.Affinity, affinity) {
+		t.Errorf("Expected affinity %+v, got %+v", affinity, spec.Affinity)
+	}
+	if env := spec.Containers[0].Env; len(env) != 1 || env[0].Value != "bar" {
+		t.Errorf("Expected producer env FOO=bar, got %+v", env)
+	}
+	for _, meta := range []metav1.ObjectMeta{daemonSet.ObjectMeta, daemonSet.Spec.Template.ObjectMeta} {
+		if meta.Labels["app.kubernetes.io/part-of"] != "conformance" || meta.Labels["component"] != "sonobuoy" {
+			t.Errorf("Expected the custom labels alongside Sonobuoy's, got %v", meta.Labels)
+		}
+		if meta.Annotations["sidecar.istio.io/inject"] != "false" {
+			t.Errorf("Expected the custom annotations, got %v", meta.Annotations)
+		}
+	}
+}
+
+func TestFillTemplate_windows(t *testing.T) {
+	testDaemonSet := NewPlugin(plugin.Definition{
+		Name:       "test-plugin",
+		ResultType: "test-plugin-result",
+		Spec: manifest.Container{
+			Container: corev1.Container{
+				Name:         "producer-container",
+				Image:        "example.com/plugin:v1",
+				Env:          []corev1.EnvVar{{Name: "RESULTS_DIR", Value: "/tmp/results"}},
+				VolumeMounts: []corev1.VolumeMount{{Name: "results", MountPath: "/tmp/results"}},
+			},
+		},
+		OperatingSystems: []string{LinuxOS, WindowsOS},
+		Images:           map[string]string{WindowsOS: "example.com/plugin:v1-windows"},
+	}, expectedNamespace, expectedImageName, "Always")
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	b, err := testDaemonSet.FillTemplate("", clientCert)
+	if err != nil {
+		t.Fatalf("Failed to fill template: %v", err)
+	}
+
+	var daemonSets []v1beta1.DaemonSet
+	d := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(b), 4096)
+	for {
+		ext := kuberuntime.RawExtension{}
+		if err := d.Decode(&ext); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Failed to split template: %v\n%s", err, b)
+		}
+		if len(bytes.TrimSpace(ext.Raw)) == 0 {
+			continue
+		}
+		var daemonSet v1beta1.DaemonSet
+		if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), ext.Raw, &daemonSet); err != nil {
+			t.Fatalf("Failed to decode template to daemonSet: %v\n%s", err, ext.Raw)
+		}
+		daemonSets = append(daemonSets, daemonSet)
+	}
+	if len(daemonSets) != 2 {
+		t.Fatalf("Expected a daemonSet for each OS, got %v", len(daemonSets))
+	}
+
+	linux, windows := daemonSets[0], daemonSets[1]
+	expectedName := fmt.Sprintf("sonobuoy-test-plugin-daemon-set-%v-windows", testDaemonSet.SessionID)
+	if windows.Name != expectedName {
+		t.Errorf("Expected daemonSet name %v, got %v", expectedName, windows.Name)
+	}
+	if os := windows.Spec.Template.Spec.NodeSelector[osLabel]; os != WindowsOS {
+		t.Errorf("Expected windows daemonSet on windows nodes, got %q", os)
+	}
+	if windows.Spec.Template.Spec.HostNetwork || windows.Spec.Template.Spec.HostPID {
+		t.Error("Expected windows daemonSet not to use host namespaces")
+	}
+
+	producer, worker := windows.Spec.Template.Spec.Containers[0], windows.Spec.Template.Spec.Containers[1]
+	if producer.Image != "example.com/plugin:v1-windows" {
+		t.Errorf("Expected the windows image, got %v", producer.Image)
+	}
+	if producer.VolumeMounts[0].MountPath != windowsResultsDir || producer.Env[0].Value != windowsResultsDir {
+		t.Errorf("Expected producer results in %v, got %+v %+v", windowsResultsDir, producer.VolumeMounts, producer.Env)
+	}
+	if worker.VolumeMounts[0].MountPath != windowsResultsDir {
+		t.Errorf("Expected worker results in %v, got %v", windowsResultsDir, worker.VolumeMounts[0].MountPath)
+	}
+	if worker.Command[0] != `C:\sonobuoy.exe` {
+		t.Errorf("Expected the windows worker command, got %v", worker.Command)
+	}
+
+	producer = linux.Spec.Template.Spec.Containers[0]
+	if producer.Image != "example.com/plugin:v1" || producer.VolumeMounts[0].MountPath != linuxResultsDir {
+		t.Errorf("Expected the linux daemonSet unchanged, got %+v", producer)
+	}
+	if testDaemonSet.Definition.Spec.Image != "example.com/plugin:v1" || testDaemonSet.Definition.Spec.Env[0].Value != "/tmp/results" {
+		t.Errorf("Expected the plugin definition unchanged, got %+v", testDaemonSet.Definition.Spec)
+	}
+}
+
+func TestExpectedResults_operatingSystems(t *testing.T) {
+	nodes := []corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "linux-node"}, Status: corev1.NodeStatus{NodeInfo: corev1.NodeSystemInfo{OperatingSystem: LinuxOS}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "windows-node", Labels: map[string]string{osLabel: WindowsOS}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "unlabeled-node"}},
+	}
+
+	testCases := []struct {
+		name     string
+		oses     []string
+		expected []string
+	}{
+		{name: "default", expected: []string{"linux-node", "unlabeled-node"}},
+		{name: "windows", oses: []string{WindowsOS}, expected: []string{"windows-node"}},
+		{name: "both", oses: []string{LinuxOS, WindowsOS}, expected: []string{"linux-node", "windows-node", "unlabeled-node"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := NewPlugin(plugin.Definition{Name: "test-plugin", OperatingSystems: tc.oses}, expectedNamespace, expectedImageName, "Always")
+			var got []string
+			for _, result := range p.ExpectedResults(nodes) {
+				got = append(got, result.NodeName)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Expected results from %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestFillTemplate_securityContext(t *testing.T) {
+	testDaemonSet := NewPlugin(plugin.Definition{
+		Name:                "test-plugin",
+		ResultType:          "test-plugin-result",
+		SecurityContextMode: plugin.SecurityContextPrivileged,
+		Spec: manifest.Container{
+			Container: corev1.Container{Name: "producer-container"},
+		},
+	}, expectedNamespace, expectedImageName, "Always")
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	var daemonSet v1beta1.DaemonSet
+	b, err := testDaemonSet.FillTemplate("", clientCert)
+	if err != nil {
+		t.Fatalf("Failed to fill template: %v", err)
+	}
+	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &daemonSet); err != nil {
+		t.Fatalf("Failed to decode template to daemonSet: %v\n%s", err, b)
+	}
+
+	spec := daemonSet.Spec.Template.Spec
+	if spec.SecurityContext != nil && spec.SecurityContext.RunAsNonRoot != nil {
+		t.Errorf("Expected no restricted pod security context, got %+v", spec.SecurityContext)
+	}
+	if _, ok := daemonSet.Spec.Template.Annotations[corev1.SeccompPodAnnotationKey]; ok {
+		t.Errorf("Expected no seccomp annotation, got %v", daemonSet.Spec.Template.Annotations)
+	}
+	for _, c := range spec.Containers {
+		if c.SecurityContext == nil || c.SecurityContext.Privileged == nil || !*c.SecurityContext.Privileged {
+			t.Errorf("Expected container %v to be privileged, got %+v", c.Name, c.SecurityContext)
+		}
+	}
+}
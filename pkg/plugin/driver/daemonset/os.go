@@ -0,0 +1,137 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"crypto/tls"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/driver"
+)
+
+const (
+	// LinuxOS and WindowsOS are the operating systems plugins can run on.
+	LinuxOS   = "linux"
+	WindowsOS = "windows"
+
+	// osLabel is the node label the kubelet sets to the node's operating
+	// system.
+	osLabel = "beta.kubernetes.io/os"
+
+	linuxResultsDir   = "/tmp/results"
+	windowsResultsDir = `C:\results`
+)
+
+// SupportedOS reports whether plugins can run on nodes with the given
+// operating system.
+func SupportedOS(os string) bool {
+	return os == LinuxOS || os == WindowsOS
+}
+
+// templateData adds the operating system specific values to those of the
+// driver.
+type templateData struct {
+	driver.TemplateData
+	OS         string
+	ResultsDir string
+}
+
+// operatingSystems returns the operating systems the plugin runs on, one
+// DaemonSet for each.
+func (p *Plugin) operatingSystems() []string {
+	if len(p.Definition.OperatingSystems) == 0 {
+		return []string{LinuxOS}
+	}
+	return p.Definition.OperatingSystems
+}
+
+// nodeOS returns the operating system of a node, assuming Linux for nodes
+// that don't say.
+func nodeOS(node v1.Node) string {
+	if os := node.Status.NodeInfo.OperatingSystem; os != "" {
+		return os
+	}
+	if os := node.Labels[osLabel]; os != "" {
+		return os
+	}
+	return LinuxOS
+}
+
+// filterNodes returns the nodes the plugin runs on.
+func (p *Plugin) filterNodes(nodes []v1.Node) []v1.Node {
+	runsOn := map[string]bool{}
+	for _, os := range p.operatingSystems() {
+		runsOn[os] = true
+	}
+
+	filtered := make([]v1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if runsOn[nodeOS(node)] {
+			filtered = append(filtered, node)
+		}
+	}
+	return filtered
+}
+
+// getTemplateData returns the template data for the plugin's DaemonSet on
+// nodes with the given operating system. Its pods are only scheduled on those
+// nodes, use any image the plugin has for it, and on Windows keep results
+// under a Windows path.
+func (p *Plugin) getTemplateData(masterAddress string, cert *tls.Certificate, os string) (*templateData, error) {
+	base := p.Base
+	base.Definition.Spec = *p.Definition.Spec.DeepCopy()
+	if image, ok := p.Definition.Images[os]; ok {
+		base.Definition.Spec.Image = image
+	}
+
+	base.Definition.NodeSelector = map[string]string{osLabel: os}
+	for k, v := range p.Definition.NodeSelector {
+		base.Definition.NodeSelector[k] = v
+	}
+
+	resultsDir := linuxResultsDir
+	if os == WindowsOS {
+		resultsDir = windowsResultsDir
+		useResultsDir(&base.Definition.Spec.Container, resultsDir)
+	}
+
+	data, err := base.GetTemplateData(masterAddress, cert)
+	if err != nil {
+		return nil, err
+	}
+	return &templateData{
+		TemplateData: *data,
+		OS:           os,
+		ResultsDir:   resultsDir,
+	}, nil
+}
+
+// useResultsDir moves the results volume of a plugin's container, and the
+// RESULTS_DIR it's told about, to dir.
+func useResultsDir(container *v1.Container, dir string) {
+	for i := range container.VolumeMounts {
+		if container.VolumeMounts[i].Name == "results" {
+			container.VolumeMounts[i].MountPath = dir
+		}
+	}
+	for i := range container.Env {
+		if container.Env[i].Name == "RESULTS_DIR" {
+			container.Env[i].Value = dir
+		}
+	}
+}
@@ -29,37 +29,131 @@ metadata:
     sonobuoy-driver: DaemonSet
     sonobuoy-plugin: {{.PluginName}}
     sonobuoy-result-type: {{.ResultType}}
+    {{- if .Annotations }}
+    {{.Annotations | indent 4}}
+    {{- end }}
   labels:
     component: sonobuoy
     sonobuoy-run: '{{.SessionID}}'
     tier: analysis
-  name: sonobuoy-{{.PluginName}}-daemon-set-{{.SessionID}}
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
+  name: sonobuoy-{{.PluginName}}-daemon-set-{{.SessionID}}{{ if eq .OS "windows" }}-windows{{ end }}
   namespace: '{{.Namespace}}'
 spec:
   selector:
     matchLabels:
       sonobuoy-run: '{{.SessionID}}'
+      sonobuoy-os: {{.OS}}
   template:
     metadata:
+      {{- if or .Annotations .SeccompProfile }}
+      annotations:
+        {{- if .SeccompProfile }}
+        seccomp.security.alpha.kubernetes.io/pod: {{.SeccompProfile}}
+        {{- end }}
+        {{- if .Annotations }}
+        {{.Annotations | indent 8}}
+        {{- end }}
+      {{- end }}
       labels:
         component: sonobuoy
         sonobuoy-run: '{{.SessionID}}'
+        sonobuoy-os: {{.OS}}
         tier: analysis
+        {{- if .Labels }}
+        {{.Labels | indent 8}}
+        {{- end }}
     spec:
       containers:
       - {{.ProducerContainer | indent 8}}
+      {{- if eq .OS "windows" }}
+      - command: ["C:\\sonobuoy.exe", "worker", "single-node", "-v", "5", "--logtostderr", "--sleep", "1h"]
+      {{- else }}
       - command: ["/run_single_node_worker.sh"]
+      {{- end }}
         env:
         - name: NODE_NAME
           valueFrom:
             fieldRef:
               fieldPath: spec.nodeName
         - name: RESULTS_DIR
-          value: /tmp/results
+          value: '{{.ResultsDir}}'
         - name: MASTER_URL
           value: '{{.MasterAddress}}'
         - name: RESULT_TYPE
           value: {{.ResultType}}
+        {{- if .ResultsStream }}
+        - name: RESULTS_STREAM
+          value: '{{.ResultsStream}}'
+        {{- end }}
+        {{- if .ResultsCompression }}
+        - name: RESULTS_COMPRESSION
+          value: '{{.ResultsCompression}}'
+        {{- end }}
+        {{- if .ResultsProtocol }}
+        - name: RESULTS_PROTOCOL
+          value: '{{.ResultsProtocol}}'
+        {{- end }}
+        {{- if .ResultsTransport }}
+        - name: RESULTS_TRANSPORT
+          value: {{.ResultsTransport}}
+        {{- end }}
+        {{- if .ExternalResultsURL }}
+        - name: EXTERNAL_RESULTS_URL
+          value: '{{.ExternalResultsURL}}'
+        {{- if .ExternalResultsSecret }}
+        - name: EXTERNAL_RESULTS_AUTHORIZATION
+          valueFrom:
+            secretKeyRef:
+              name: {{.ExternalResultsSecret}}
+              key: {{.ExternalResultsSecretKey}}
+        {{- end }}
+        {{- end }}
+        {{- if .TimeoutSeconds }}
+        - name: TIMEOUT_SECONDS
+          value: '{{.TimeoutSeconds}}'
+        {{- end }}
+        {{- if .LocalResultsVolume }}
+        - name: LOCAL_RESULTS_DIR
+          value: /tmp/local-results
+        {{- end }}
+        {{- if .RetryAttempts }}
+        - name: RETRY_ATTEMPTS
+          value: '{{.RetryAttempts}}'
+        {{- end }}
+        {{- if .RetryMaxElapsedTime }}
+        - name: RETRY_MAX_ELAPSED_TIME
+          value: '{{.RetryMaxElapsedTime}}'
+        {{- end }}
+        {{- if .RetryJitter }}
+        - name: RETRY_JITTER
+          value: '{{.RetryJitter}}'
+        {{- end }}
+        {{- if .TracingEndpoint }}
+        - name: OTEL_EXPORTER_OTLP_ENDPOINT
+          value: '{{.TracingEndpoint}}'
+        - name: TRACEPARENT
+          value: '{{.TraceParent}}'
+        {{- end }}
+        {{- if .HTTPProxy }}
+        - name: HTTP_PROXY
+          value: '{{.HTTPProxy}}'
+        {{- end }}
+        {{- if .HTTPSProxy }}
+        - name: HTTPS_PROXY
+          value: '{{.HTTPSProxy}}'
+        {{- end }}
+        {{- if .NoProxy }}
+        - name: NO_PROXY
+          value: '{{.NoProxy}}'
+        {{- end }}
+        {{- if .CABundle }}
+        - name: CA_BUNDLE
+          value: |
+            {{.CABundle | indent 12}}
+        {{- end }}
         - name: CA_CERT
           value: |
             {{.CACert | indent 12}}
@@ -74,27 +168,138 @@ spec:
             secretKeyRef:
               name: {{.SecretName}}
               key: tls.key
+        - name: RESULTS_TOKEN
+          valueFrom:
+            secretKeyRef:
+              name: {{.SecretName}}
+              key: results-token
         image: {{.SonobuoyImage}}
         imagePullPolicy: {{.ImagePullPolicy}}
         name: sonobuoy-worker
+        {{- if .ContainerSecurityContext }}
+        securityContext:
+          {{.ContainerSecurityContext | indent 10}}
+        {{- end }}
+        {{- if .WorkerResources }}
+        resources:
+          {{.WorkerResources | indent 10}}
+        {{- end }}
         volumeMounts:
-        - mountPath: /tmp/results
+        - mountPath: '{{.ResultsDir}}'
           name: results
           readOnly: false
+        {{- if .LocalResultsVolume }}
+        - mountPath: /tmp/local-results
+          name: local-results
+        {{- end }}
+      {{- if .Sidecars }}
+      {{.Sidecars | indent 6}}
+      {{- end }}
+      {{- if .Payload }}
+      initContainers:
+      - command: ["/sonobuoy"]
+        args: ["worker", "payload", "-v", "5", "--logtostderr"]
+        env:
+        - name: MASTER_URL
+          value: '{{.MasterAddress}}'
+        - name: RESULT_TYPE
+          value: {{.ResultType}}
+        - name: PAYLOAD_DIR
+          value: /tmp/sonobuoy-payload
+        {{- if .HTTPProxy }}
+        - name: HTTP_PROXY
+          value: '{{.HTTPProxy}}'
+        {{- end }}
+        {{- if .HTTPSProxy }}
+        - name: HTTPS_PROXY
+          value: '{{.HTTPSProxy}}'
+        {{- end }}
+        {{- if .NoProxy }}
+        - name: NO_PROXY
+          value: '{{.NoProxy}}'
+        {{- end }}
+        {{- if .CABundle }}
+        - name: CA_BUNDLE
+          value: |
+            {{.CABundle | indent 12}}
+        {{- end }}
+        - name: CA_CERT
+          value: |
+            {{.CACert | indent 12}}
+        - name: CLIENT_CERT
+          valueFrom:
+            secretKeyRef:
+              name: {{.SecretName}}
+              key: tls.crt
+        - name: CLIENT_KEY
+          valueFrom:
+            secretKeyRef:
+              name: {{.SecretName}}
+              key: tls.key
+        image: {{.SonobuoyImage}}
+        imagePullPolicy: {{.ImagePullPolicy}}
+        name: sonobuoy-payload
+        {{- if .ContainerSecurityContext }}
+        securityContext:
+          {{.ContainerSecurityContext | indent 10}}
+        {{- end }}
+        volumeMounts:
+        - mountPath: /tmp/sonobuoy-payload
+          name: sonobuoy-payload
+      {{- end }}
+      {{- if ne .OS "windows" }}
       dnsPolicy: ClusterFirstWithHostNet
       hostIPC: true
       hostNetwork: true
       hostPID: true
+      {{- end }}
+      {{- if .ImagePullSecrets }}
+      imagePullSecrets:
+      {{- range .ImagePullSecrets }}
+      - name: {{.}}
+      {{- end }}
+      {{- end }}
+      {{- if .PriorityClassName }}
+      priorityClassName: {{.PriorityClassName}}
+      {{- end }}
+      {{- if .PodSecurityContext }}
+      securityContext:
+        {{.PodSecurityContext | indent 8}}
+      {{- end }}
+      {{- if .OwnServiceAccount }}
+      serviceAccountName: {{.ServiceAccountName}}
+      {{- end }}
+      {{- if .NodeSelector }}
+      nodeSelector:
+        {{.NodeSelector | indent 8}}
+      {{- end }}
+      {{- if .Affinity }}
+      affinity:
+        {{.Affinity | indent 8}}
+      {{- end }}
       tolerations:
       - effect: NoSchedule
         key: node-role.kubernetes.io/master
         operator: Exists
       - key: CriticalAddonsOnly
         operator: Exists
+      {{- if .Tolerations }}
+      {{.Tolerations | indent 6}}
+      {{- end }}
       volumes:
       - emptyDir: {}
         name: results
       - hostPath:
-          path: /
+          path: {{ if eq .OS "windows" }}'C:\'{{ else }}/{{ end }}
         name: root
+      {{- if .ExtraVolumes }}
+      {{.ExtraVolumes | indent 6}}
+      {{- end }}
+      {{- if .LocalResultsVolume }}
+      - {{.LocalResultsVolume | indent 8}}
+      {{- end }}
+      {{- if .Payload }}
+      - emptyDir: {}
+        name: sonobuoy-payload
+      {{- end }}
 `)
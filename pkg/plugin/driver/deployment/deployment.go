@@ -0,0 +1,248 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	appsv1beta2 "k8s.io/api/apps/v1beta2"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kuberuntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/utils"
+)
+
+// SummaryFilename is the name of the file that completes a Deployment
+// plugin's result once its duration is up.
+const SummaryFilename = "summary.json"
+
+// Plugin is a plugin driver that keeps a number of replicas of a pod running
+// for a configured duration, for long-running probes such as continuous
+// network checks.
+//
+// Every replica reports to the same global result, each sending its files
+// named after itself. The driver completes the result with a summary once
+// the duration is up.
+type Plugin struct {
+	driver.Base
+	started time.Time
+}
+
+// Ensure Plugin implements plugin.Interface
+var _ plugin.Interface = &Plugin{}
+
+// NewPlugin creates a new Deployment plugin from the given Plugin Definition
+// and sonobuoy master address.
+func NewPlugin(dfn plugin.Definition, namespace, sonobuoyImage, imagePullPolicy string) *Plugin {
+	if dfn.Replicas <= 0 {
+		dfn.Replicas = 1
+	}
+	return &Plugin{
+		Base: driver.Base{
+			Definition:      dfn,
+			SessionID:       utils.GetSessionID(),
+			Namespace:       namespace,
+			SonobuoyImage:   sonobuoyImage,
+			ImagePullPolicy: imagePullPolicy,
+			CleanedUp:       false, // be explicit
+		},
+	}
+}
+
+// ExpectedResults returns the list of results expected for this plugin. All
+// the replicas share a single global result.
+func (p *Plugin) ExpectedResults(nodes []v1.Node) []plugin.ExpectedResult {
+	return []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: p.GetResultType()},
+	}
+}
+
+func getMasterAddress(hostname string) string {
+	return fmt.Sprintf("https://%s/api/v1/results/global", hostname)
+}
+
+// FillTemplate populates the internal Deployment YAML template with the values for this particular plugin.
+func (p *Plugin) FillTemplate(hostname string, cert *tls.Certificate) ([]byte, error) {
+	var b bytes.Buffer
+
+	tmplData, err := p.GetTemplateData(getMasterAddress(hostname), cert)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't get template data for %q", p.Definition.Name)
+	}
+
+	if err := deploymentTemplate.Execute(&b, tmplData); err != nil {
+		return nil, errors.Wrapf(err, "couldn't fill template %q", p.Definition.Name)
+	}
+
+	return b.Bytes(), nil
+}
+
+// Run creates the Deployment for this plugin.
+func (p *Plugin) Run(kubeclient kubernetes.Interface, hostname string, cert *tls.Certificate, token string) error {
+	var deployment appsv1beta2.Deployment
+
+	b, err := p.FillTemplate(hostname, cert)
+	if err != nil {
+		return errors.Wrap(err, "couldn't fill template")
+	}
+	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &deployment); err != nil {
+		return errors.Wrapf(err, "could not decode the executed template into a Deployment for plugin %v", p.GetName())
+	}
+
+	secret, err := p.MakeTLSSecret(cert, token)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't make secret for deployment plugin %v", p.GetName())
+	}
+
+	if err := p.CreateRBAC(kubeclient); err != nil {
+		return err
+	}
+
+	if _, err := kubeclient.CoreV1().Secrets(p.Namespace).Create(secret); err != nil {
+		return errors.Wrapf(err, "couldn't create TLS secret for deployment plugin %v", p.GetName())
+	}
+
+	// TODO(EKF): Move to v1 in 1.11
+	if _, err := kubeclient.AppsV1beta2().Deployments(p.Namespace).Create(&deployment); err != nil {
+		return errors.Wrapf(err, "could not create Deployment for deployment plugin %v", p.GetName())
+	}
+
+	p.started = time.Now()
+	return nil
+}
+
+// Monitor adheres to plugin.Interface by ensuring the replicas are running
+// normally, and completes the plugin's result once its duration is up.
+func (p *Plugin) Monitor(kubeclient kubernetes.Interface, _ []v1.Node, resultsCh chan<- *plugin.Result) {
+	duration := time.Duration(p.Definition.DurationSeconds) * time.Second
+
+	for {
+		// Sleep between each poll, which should give the Deployment
+		// enough time to create pods
+		time.Sleep(10 * time.Second)
+		// If we've cleaned up after ourselves, stop monitoring
+		if p.CleanedUp {
+			break
+		}
+
+		if !p.started.IsZero() && time.Since(p.started) >= duration {
+			resultsCh <- p.makeSummaryResult(kubeclient)
+			break
+		}
+
+		// If we can't query for pods, just retry next time.
+		pods, err := kubeclient.CoreV1().Pods(p.Namespace).List(p.listOptions())
+		if err != nil {
+			errlog.LogError(errors.Wrapf(err, "could not find pods created by plugin %v, will retry", p.GetName()))
+			continue
+		}
+
+		// The Deployment replaces pods that go away or are evicted, but a
+		// replica that can't start or keeps crashing fails the whole
+		// plugin.
+		for _, pod := range pods.Items {
+			if reason, message := utils.PodFailure(&pod); reason != "" && reason != plugin.FailureEvicted {
+				resultsCh <- utils.MakeErrorResult(p.GetResultType(), map[string]interface{}{
+					"error":  message,
+					"reason": reason,
+					"pod":    pod,
+				}, "")
+				return
+			}
+		}
+	}
+}
+
+// makeSummaryResult makes the result that completes this plugin, alongside
+// whatever the replicas sent.
+func (p *Plugin) makeSummaryResult(kubeclient kubernetes.Interface) *plugin.Result {
+	summary := map[string]interface{}{
+		"replicas":        p.Definition.Replicas,
+		"durationSeconds": p.Definition.DurationSeconds,
+	}
+	if deployment, err := p.findDeployment(kubeclient); err != nil {
+		errlog.LogError(errors.Wrapf(err, "could not find Deployment created by plugin %v", p.GetName()))
+	} else {
+		summary["readyReplicas"] = deployment.Status.ReadyReplicas
+	}
+
+	body, _ := json.Marshal(summary)
+	return &plugin.Result{
+		Body:       bytes.NewReader(body),
+		ResultType: p.GetResultType(),
+		MimeType:   "application/json",
+		Filename:   SummaryFilename,
+	}
+}
+
+// Cleanup cleans up the k8s Deployment created by this plugin instance.
+func (p *Plugin) Cleanup(kubeclient kubernetes.Interface) {
+	p.CleanedUp = true
+	gracePeriod := int64(plugin.GracefulShutdownPeriod)
+	deletionPolicy := metav1.DeletePropagationBackground
+
+	listOptions := p.listOptions()
+	deleteOptions := metav1.DeleteOptions{
+		GracePeriodSeconds: &gracePeriod,
+		PropagationPolicy:  &deletionPolicy,
+	}
+
+	// Deleting the Deployment in the background also deletes its
+	// ReplicaSet and pods.
+	// TODO(EKF): Move to v1 in 1.11
+	err := kubeclient.AppsV1beta2().Deployments(p.Namespace).DeleteCollection(
+		&deleteOptions,
+		listOptions,
+	)
+	if err != nil {
+		errlog.LogError(errors.Wrapf(err, "could not delete Deployment-%v for deployment plugin %v", p.GetSessionID(), p.GetName()))
+	}
+
+	p.DeleteRBAC(kubeclient)
+}
+
+func (p *Plugin) listOptions() metav1.ListOptions {
+	return metav1.ListOptions{
+		LabelSelector: "sonobuoy-run=" + p.GetSessionID(),
+	}
+}
+
+// findDeployment gets the deployment that we created, using a kubernetes label search.
+func (p *Plugin) findDeployment(kubeclient kubernetes.Interface) (*appsv1beta2.Deployment, error) {
+	// TODO(EKF): Move to v1 in 1.11
+	deployments, err := kubeclient.AppsV1beta2().Deployments(p.Namespace).List(p.listOptions())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(deployments.Items) != 1 {
+		return nil, errors.Errorf("expected plugin %v to create 1 deployment, found %v", p.Definition.Name, len(deployments.Items))
+	}
+
+	return &deployments.Items[0], nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/backplane/ca"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/manifest"
+
+	appsv1beta2 "k8s.io/api/apps/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	kuberuntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+const (
+	expectedImageName = "gcr.io/heptio-image/sonobuoy:master"
+	expectedNamespace = "test-namespace"
+)
+
+func TestFillTemplate(t *testing.T) {
+	testDeployment := NewPlugin(plugin.Definition{
+		Name:            "test-plugin",
+		ResultType:      "test-plugin-result",
+		Replicas:        3,
+		DurationSeconds: 600,
+		Spec: manifest.Container{
+			Container: corev1.Container{
+				Name: "producer-container",
+			},
+		},
+	}, expectedNamespace, expectedImageName, "Always")
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-plugin-result")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	var deployment appsv1beta2.Deployment
+	b, err := testDeployment.FillTemplate("", clientCert)
+	if err != nil {
+		t.Fatalf("Failed to fill template: %v", err)
+	}
+
+	t.Logf("%s", b)
+
+	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &deployment); err != nil {
+		t.Fatalf("Failed to decode template to deployment: %v", err)
+	}
+
+	expectedName := fmt.Sprintf("sonobuoy-test-plugin-deployment-%v", testDeployment.SessionID)
+	if deployment.Name != expectedName {
+		t.Errorf("Expected deployment name %v, got %v", expectedName, deployment.Name)
+	}
+
+	if deployment.Namespace != expectedNamespace {
+		t.Errorf("Expected deployment namespace %v, got %v", expectedNamespace, deployment.Namespace)
+	}
+
+	if deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != 3 {
+		t.Errorf("Expected 3 replicas, got %v", deployment.Spec.Replicas)
+	}
+
+	containers := deployment.Spec.Template.Spec.Containers
+
+	expectedContainers := 2
+	if len(containers) != expectedContainers {
+		t.Fatalf("Expected to have %v containers, got %v", expectedContainers, len(containers))
+	}
+	if containers[0].Name != "producer-container" {
+		t.Errorf("Expected producer pod to have name producer-container, got %v", containers[0].Name)
+	}
+	if containers[1].Image != expectedImageName {
+		t.Errorf("Expected consumer pod to have image %v, got %v", expectedImageName, containers[1].Image)
+	}
+
+	var replicaName *corev1.EnvVar
+	for i, envVar := range containers[1].Env {
+		if envVar.Name == "REPLICA_NAME" {
+			replicaName = &containers[1].Env[i]
+		}
+	}
+	if replicaName == nil || replicaName.ValueFrom == nil || replicaName.ValueFrom.FieldRef.FieldPath != "metadata.name" {
+		t.Errorf("Expected REPLICA_NAME to be the pod name, got %v", replicaName)
+	}
+}
+
+func TestNewPlugin_defaultReplicas(t *testing.T) {
+	p := NewPlugin(plugin.Definition{Name: "test-plugin", DurationSeconds: 60}, expectedNamespace, expectedImageName, "Always")
+	if p.Definition.Replicas != 1 {
+		t.Errorf("Expected 1 replica by default, got %v", p.Definition.Replicas)
+	}
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package deployment
+
+import (
+	"github.com/heptio/sonobuoy/pkg/templates"
+)
+
+var deploymentTemplate = templates.NewTemplate("deploymentTemplate", `
+---
+apiVersion: apps/v1beta2
+kind: Deployment
+metadata:
+  annotations:
+    sonobuoy-driver: Deployment
+    sonobuoy-plugin: {{.PluginName}}
+    sonobuoy-result-type: {{.ResultType}}
+    {{- if .Annotations }}
+    {{.Annotations | indent 4}}
+    {{- end }}
+  labels:
+    component: sonobuoy
+    sonobuoy-run: '{{.SessionID}}'
+    tier: analysis
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
+  name: sonobuoy-{{.PluginName}}-deployment-{{.SessionID}}
+  namespace: '{{.Namespace}}'
+spec:
+  replicas: {{.Replicas}}
+  selector:
+    matchLabels:
+      sonobuoy-run: '{{.SessionID}}'
+  template:
+    metadata:
+      {{- if or .Annotations .SeccompProfile }}
+      annotations:
+        {{- if .SeccompProfile }}
+        seccomp.security.alpha.kubernetes.io/pod: {{.SeccompProfile}}
+        {{- end }}
+        {{- if .Annotations }}
+        {{.Annotations | indent 8}}
+        {{- end }}
+      {{- end }}
+      labels:
+        component: sonobuoy
+        sonobuoy-run: '{{.SessionID}}'
+        tier: analysis
+        {{- if .Labels }}
+        {{.Labels | indent 8}}
+        {{- end }}
+    spec:
+      containers:
+      - {{.ProducerContainer | indent 8}}
+      - command: ["/sonobuoy"]
+        args: ["worker", "global", "-v", "5", "--logtostderr"]
+        env:
+        - name: NODE_NAME
+          valueFrom:
+            fieldRef:
+              fieldPath: spec.nodeName
+        - name: REPLICA_NAME
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.name
+        - name: RESULTS_DIR
+          value: /tmp/results
+        - name: MASTER_URL
+          value: '{{.MasterAddress}}'
+        - name: RESULT_TYPE
+          value: {{.ResultType}}
+        {{- if .ResultsCompression }}
+        - name: RESULTS_COMPRESSION
+          value: '{{.ResultsCompression}}'
+        {{- end }}
+        {{- if .ResultsProtocol }}
+        - name: RESULTS_PROTOCOL
+          value: '{{.ResultsProtocol}}'
+        {{- end }}
+        {{- if .ExternalResultsURL }}
+        - name: EXTERNAL_RESULTS_URL
+          value: '{{.ExternalResultsURL}}'
+        {{- if .ExternalResultsSecret }}
+        - name: EXTERNAL_RESULTS_AUTHORIZATION
+          valueFrom:
+            secretKeyRef:
+              name: {{.ExternalResultsSecret}}
+              key: {{.ExternalResultsSecretKey}}
+        {{- end }}
+        {{- end }}
+        {{- if .RetryAttempts }}
+        - name: RETRY_ATTEMPTS
+          value: '{{.RetryAttempts}}'
+        {{- end }}
+        {{- if .RetryMaxElapsedTime }}
+        - name: RETRY_MAX_ELAPSED_TIME
+          value: '{{.RetryMaxElapsedTime}}'
+        {{- end }}
+        {{- if .RetryJitter }}
+        - name: RETRY_JITTER
+          value: '{{.RetryJitter}}'
+        {{- end }}
+        {{- if .TracingEndpoint }}
+        - name: OTEL_EXPORTER_OTLP_ENDPOINT
+          value: '{{.TracingEndpoint}}'
+        - name: TRACEPARENT
+          value: '{{.TraceParent}}'
+        {{- end }}
+        {{- if .HTTPProxy }}
+        - name: HTTP_PROXY
+          value: '{{.HTTPProxy}}'
+        {{- end }}
+        {{- if .HTTPSProxy }}
+        - name: HTTPS_PROXY
+          value: '{{.HTTPSProxy}}'
+        {{- end }}
+        {{- if .NoProxy }}
+        - name: NO_PROXY
+          value: '{{.NoProxy}}'
+        {{- end }}
+        {{- if .CABundle }}
+        - name: CA_BUNDLE
+          value: |
+            {{.CABundle | indent 12}}
+        {{- end }}
+        - name: CA_CERT
+          value: |
+            {{.CACert | indent 12}}
+        - name: CLIENT_CERT
+          valueFrom:
+            secretKeyRef:
+              name: {{.SecretName}}
+              key: tls.crt
+        - name: CLIENT_KEY
+          valueFrom:
+            secretKeyRef:
+              name: {{.SecretName}}
+              key: tls.key
+        - name: RESULTS_TOKEN
+          valueFrom:
+            secretKeyRef:
+              name: {{.SecretName}}
+              key: results-token
+        image: {{.SonobuoyImage}}
+        imagePullPolicy: {{.ImagePullPolicy}}
+        name: sonobuoy-worker
+        {{- if .ContainerSecurityContext }}
+        securityContext:
+          {{.ContainerSecurityContext | indent 10}}
+        {{- end }}
+        {{- if .WorkerResources }}
+        resources:
+          {{.WorkerResources | indent 10}}
+        {{- end }}
+        volumeMounts:
+        - mountPath: /tmp/results
+          name: results
+          readOnly: false
+      {{- if .Sidecars }}
+      {{.Sidecars | indent 6}}
+      {{- end }}
+      {{- if .Payload }}
+      initContainers:
+      - command: ["/sonobuoy"]
+        args: ["worker", "payload", "-v", "5", "--logtostderr"]
+        env:
+        - name: MASTER_URL
+          value: '{{.MasterAddress}}'
+        - name: RESULT_TYPE
+          value: {{.ResultType}}
+        - name: PAYLOAD_DIR
+          value: /tmp/sonobuoy-payload
+        {{- if .HTTPProxy }}
+        - name: HTTP_PROXY
+          value: '{{.HTTPProxy}}'
+        {{- end }}
+        {{- if .HTTPSProxy }}
+        - name: HTTPS_PROXY
+          value: '{{.HTTPSProxy}}'
+        {{- end }}
+        {{- if .NoProxy }}
+        - name: NO_PROXY
+          value: '{{.NoProxy}}'
+        {{- end }}
+        {{- if .CABundle }}
+        - name: CA_BUNDLE
+          value: |
+            {{.CABundle | indent 12}}
+        {{- end }}
+        - name: CA_CERT
+          value: |
+            {{.CACert | indent 12}}
+        - name: CLIENT_CERT
+          valueFrom:
+            secretKeyRef:
+              name: {{.SecretName}}
+              key: tls.crt
+        - name: CLIENT_KEY
+          valueFrom:
+            secretKeyRef:
+              name: {{.SecretName}}
+              key: tls.key
+        image: {{.SonobuoyImage}}
+        imagePullPolicy: {{.ImagePullPolicy}}
+        name: sonobuoy-payload
+        {{- if .ContainerSecurityContext }}
+        securityContext:
+          {{.ContainerSecurityContext | indent 10}}
+        {{- end }}
+        volumeMounts:
+        - mountPath: /tmp/sonobuoy-payload
+          name: sonobuoy-payload
+      {{- end }}
+      {{- if .ImagePullSecrets }}
+      imagePullSecrets:
+      {{- range .ImagePullSecrets }}
+      - name: {{.}}
+      {{- end }}
+      {{- end }}
+      serviceAccountName: {{.ServiceAccountName}}
+      {{- if .PriorityClassName }}
+      priorityClassName: {{.PriorityClassName}}
+      {{- end }}
+      {{- if .PodSecurityContext }}
+      securityContext:
+        {{.PodSecurityContext | indent 8}}
+      {{- end }}
+      {{- if .NodeSelector }}
+      nodeSelector:
+        {{.NodeSelector | indent 8}}
+      {{- end }}
+      {{- if .Affinity }}
+      affinity:
+        {{.Affinity | indent 8}}
+      {{- end }}
+      tolerations:
+      - effect: NoSchedule
+        key: node-role.kubernetes.io/master
+        operator: Exists
+      - key: CriticalAddonsOnly
+        operator: Exists
+      {{- if .Tolerations }}
+      {{.Tolerations | indent 6}}
+      {{- end }}
+      volumes:
+      - emptyDir: {}
+        name: results
+      {{- if .ExtraVolumes }}
+      {{.ExtraVolumes | indent 6}}
+      {{- end }}
+      {{- if .Payload }}
+      - emptyDir: {}
+        name: sonobuoy-payload
+      {{- end }}
+`)
@@ -23,7 +23,9 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kuberuntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
@@ -39,6 +41,11 @@ import (
 // kubernetes cluster.
 type Plugin struct {
 	driver.Base
+
+	// pod is the pod created by Run, which is copied when it's retried.
+	pod *v1.Pod
+	// retries is how many times the pod has been recreated.
+	retries int
 }
 
 // Ensure Plugin implements plugin.Interface
@@ -48,13 +55,14 @@ var _ plugin.Interface = &Plugin{}
 // and sonobuoy master address.
 func NewPlugin(dfn plugin.Definition, namespace, sonobuoyImage, imagePullPolicy string) *Plugin {
 	return &Plugin{
-		driver.Base{
+		Base: driver.Base{
 			Definition:      dfn,
 			SessionID:       utils.GetSessionID(),
 			Namespace:       namespace,
 			SonobuoyImage:   sonobuoyImage,
 			ImagePullPolicy: imagePullPolicy,
 			CleanedUp:       false, // be explicit
+			StopsOnTimeout:  true,
 		},
 	}
 }
@@ -88,7 +96,7 @@ func (p *Plugin) FillTemplate(hostname string, cert *tls.Certificate) ([]byte, e
 }
 
 // Run dispatches worker pods according to the Job's configuration.
-func (p *Plugin) Run(kubeclient kubernetes.Interface, hostname string, cert *tls.Certificate) error {
+func (p *Plugin) Run(kubeclient kubernetes.Interface, hostname string, cert *tls.Certificate, token string) error {
 	var job v1.Pod
 
 	b, err := p.FillTemplate(hostname, cert)
@@ -101,11 +109,15 @@ func (p *Plugin) Run(kubeclient kubernetes.Interface, hostname string, cert *tls
 		return errors.Wrapf(err, "could not decode executed template into a Job for plugin %v", p.GetName())
 	}
 
-	secret, err := p.MakeTLSSecret(cert)
+	secret, err := p.MakeTLSSecret(cert, token)
 	if err != nil {
 		return errors.Wrapf(err, "couldn't make secret for Job plugin %v", p.GetName())
 	}
 
+	if err := p.CreateRBAC(kubeclient); err != nil {
+		return err
+	}
+
 	if _, err := kubeclient.CoreV1().Secrets(p.Namespace).Create(secret); err != nil {
 		return errors.Wrapf(err, "couldn't create TLS secret for job plugin %v", p.GetName())
 	}
@@ -113,6 +125,7 @@ func (p *Plugin) Run(kubeclient kubernetes.Interface, hostname string, cert *tls
 	if _, err := kubeclient.CoreV1().Pods(p.Namespace).Create(&job); err != nil {
 		return errors.Wrapf(err, "could not create Job resource for Job plugin %v", p.GetName())
 	}
+	p.pod = &job
 
 	return nil
 }
@@ -130,18 +143,28 @@ func (p *Plugin) Monitor(kubeclient kubernetes.Interface, _ []v1.Node, resultsCh
 			break
 		}
 
-		// Make sure there's a pod
+		// Make sure there's a pod, recreating it if it's gone away
 		pod, err := p.findPod(kubeclient)
 		if err != nil {
+			if p.canRetry() {
+				p.retry(kubeclient, nil, err.Error())
+				continue
+			}
 			resultsCh <- utils.MakeErrorResult(p.GetResultType(), map[string]interface{}{"error": err.Error()}, "")
 			break
 		}
 
-		// Make sure the pod isn't failing
-		if isFailing, reason := utils.IsPodFailing(pod); isFailing {
+		// Make sure the pod isn't failing, recreating it if it might
+		// succeed next time
+		if reason, message := utils.PodFailure(pod); reason != "" {
+			if utils.RetryablePodFailure(reason) && p.canRetry() {
+				p.retry(kubeclient, pod, message)
+				continue
+			}
 			resultsCh <- utils.MakeErrorResult(p.GetResultType(), map[string]interface{}{
-				"error": reason,
-				"pod":   pod,
+				"error":  message,
+				"reason": reason,
+				"pod":    pod,
 			}, "")
 			break
 		}
@@ -175,6 +198,42 @@ func (p *Plugin) Cleanup(kubeclient kubernetes.Interface) {
 	if err != nil {
 		errlog.LogError(errors.Wrapf(err, "error deleting pods for Job-%v", p.GetSessionID()))
 	}
+
+	p.DeleteRBAC(kubeclient)
+}
+
+// canRetry returns whether the plugin's pod can be recreated again.
+func (p *Plugin) canRetry() bool {
+	return p.pod != nil && p.retries < p.Definition.Retries
+}
+
+// retry deletes the failed pod, if there is one, and creates a copy of the
+// pod created by Run in its place.
+func (p *Plugin) retry(kubeclient kubernetes.Interface, failed *v1.Pod, why string) {
+	p.retries++
+	logrus.Infof("Retrying plugin %v (attempt %v of %v): %v", p.GetName(), p.retries, p.Definition.Retries, why)
+
+	if failed != nil {
+		err := kubeclient.CoreV1().Pods(p.Namespace).Delete(failed.Name, &metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errlog.LogError(errors.Wrapf(err, "couldn't delete failed pod %v for Job plugin %v", failed.Name, p.GetName()))
+		}
+	}
+
+	if _, err := kubeclient.CoreV1().Pods(p.Namespace).Create(retryPod(p.pod, p.retries)); err != nil {
+		errlog.LogError(errors.Wrapf(err, "couldn't recreate pod for Job plugin %v", p.GetName()))
+	}
+}
+
+// retryPod returns a copy of pod to create for the given retry attempt, named
+// so that it doesn't clash with the pod it replaces while that's deleted.
+func retryPod(pod *v1.Pod, attempt int) *v1.Pod {
+	retry := pod.DeepCopy()
+	retry.Name = fmt.Sprintf("%v-retry-%v", pod.Name, attempt)
+	retry.ResourceVersion = ""
+	retry.UID = ""
+	retry.Status = v1.PodStatus{}
+	return retry
 }
 
 func (p *Plugin) listOptions() metav1.ListOptions {
@@ -184,17 +243,24 @@ func (p *Plugin) listOptions() metav1.ListOptions {
 }
 
 // findPod finds the pod created by this plugin, using a kubernetes label
-// search.  If no pod is found, or if multiple pods are found, returns an
-// error.
+// search, ignoring pods that are being deleted after being retried.  If no
+// pod is found, or if multiple pods are found, returns an error.
 func (p *Plugin) findPod(kubeclient kubernetes.Interface) (*v1.Pod, error) {
 	pods, err := kubeclient.CoreV1().Pods(p.Namespace).List(p.listOptions())
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	if len(pods.Items) != 1 {
+	live := make([]v1.Pod, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil {
+			live = append(live, pod)
+		}
+	}
+
+	if len(live) != 1 {
 		return nil, errors.Errorf("no pods were created by plugin %v", p.Definition.Name)
 	}
 
-	return &pods.Items[0], nil
+	return &live[0], nil
 }
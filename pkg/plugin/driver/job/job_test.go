@@ -20,6 +20,7 @@ import (
 	"crypto/sha1"
 	"encoding/pem"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/heptio/sonobuoy/pkg/backplane/ca"
@@ -27,6 +28,8 @@ import (
 	"github.com/heptio/sonobuoy/pkg/plugin/manifest"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kuberuntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
 )
@@ -120,3 +123,734 @@ func TestFillTemplate(t *testing.T) {
 		t.Errorf("CA_CERT fingerprint didn't match")
 	}
 }
+
+func TestFillTemplate_imagePullSecrets(t *testing.T) {
+	testJob := NewPlugin(plugin.Definition{
+		Name:             "test-job",
+		ResultType:       "test-job-result",
+		ImagePullSecrets: []string{"regcred"},
+		Spec: manifest.Container{
+			Container: corev1.Container{
+				Name: "producer-container",
+			},
+		},
+	}, expectedNamespace, expectedImageName, "Always")
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	var pod corev1.Pod
+	b, err := testJob.FillTemplate("", clientCert)
+	if err != nil {
+		t.Fatalf("Failed to fill template: %v", err)
+	}
+	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &pod); err != nil {
+		t.Fatalf("Failed to decode template to pod: %v", err)
+	}
+
+	expected := []corev1.LocalObjectReference{{Name: "regcred"}}
+	if !reflect.DeepEqual(pod.Spec.ImagePullSecrets, expected) {
+		t.Errorf("Expected image pull secrets %v, got %v", expected, pod.Spec.ImagePullSecrets)
+	}
+}
+
+func TestFillTemplate_podConfig(t *testing.T) {
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m")},
+		Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+	}
+	testJob := NewPlugin(plugin.Definition{
+		Name:              "test-job",
+		ResultType:        "test-job-result",
+		WorkerResources:   resources,
+		PriorityClassName: "sonobuoy-critical",
+		Proxy: plugin.ProxyConfig{
+			HTTPSProxy: "http://proxy.example.com:3128",
+			NoProxy:    "10.0.0.0/8,.svc",
+		},
+		CABundle: "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n",
+		Spec: manifest.Container{
+			Container: corev1.Container{
+				Name: "producer-container",
+			},
+		},
+	}, expectedNamespace, expectedImageName, "Always")
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	var pod corev1.Pod
+	b, err := testJob.FillTemplate("", clientCert)
+	if err != nil {
+		t.Fatalf("Failed to fill template: %v", err)
+	}
+	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &pod); err != nil {
+		t.Fatalf("Failed to decode template to pod: %v", err)
+	}
+
+	if pod.Spec.PriorityClassName != "sonobuoy-critical" {
+		t.Errorf("Expected priority class sonobuoy-critical, got %q", pod.Spec.PriorityClassName)
+	}
+	if len(pod.Spec.Containers) != 2 {
+		t.Fatalf("Expected 2 containers, got %v", len(pod.Spec.Containers))
+	}
+	if got := pod.Spec.Containers[0].Resources; len(got.Requests) > 0 || len(got.Limits) > 0 {
+		t.Errorf("Expected the plugin container's resources to be left alone, got %v", got)
+	}
+	got := pod.Spec.Containers[1].Resources
+	if got.Requests.Cpu().Cmp(resource.MustParse("50m")) != 0 || got.Limits.Memory().Cmp(resource.MustParse("64Mi")) != 0 {
+		t.Errorf("Expected worker resources %v, got %v", resources, got)
+	}
+
+	env := map[string]string{}
+	for _, envVar := range pod.Spec.Containers[1].Env {
+		env[envVar.Name] = envVar.Value
+	}
+	expectedEnv := map[string]string{
+		"HTTPS_PROXY": "http://proxy.example.com:3128",
+		"NO_PROXY":    "10.0.0.0/8,.svc",
+		"CA_BUNDLE":   "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n",
+	}
+	for name, value := range expectedEnv {
+		if env[name] != value {
+			t.Errorf("Expected worker env %v to be %q, got %q", name, value, env[name])
+		}
+	}
+	if _, ok := env["HTTP_PROXY"]; ok {
+		t.Errorf("Expected no HTTP_PROXY for the worker, got %q", env["HTTP_PROXY"])
+	}
+}
+
+func TestFillTemplate_sidecars(t *testing.T) {
+	testJob := NewPlugin(plugin.Definition{
+		Name:       "test-job",
+		ResultType: "test-job-result",
+		Spec: manifest.Container{
+			Container: corev1.Container{
+				Name: "producer-container",
+				VolumeMounts: []corev1.VolumeMount{
+					{Name: "results", MountPath: "/tmp/results"},
+					{Name: "credentials", MountPath: "/var/run/credentials"},
+				},
+			},
+		},
+		ExtraVolumes: []corev1.Volume{{Name: "credentials", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+		Sidecars: []corev1.Container{{
+			Name:         "credential-helper",
+			Image:        "example.com/credential-helper:v1",
+			VolumeMounts: []corev1.VolumeMount{{Name: "credentials", MountPath: "/credentials"}},
+		}},
+	}, expectedNamespace, expectedImageName, "Always")
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	var pod corev1.Pod
+	b, err := testJob.FillTemplate("", clientCert)
+	if err != nil {
+		t.Fatalf("Failed to fill template: %v", err)
+	}
+	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &pod); err != nil {
+		t.Fatalf("Failed to decode template to pod: %v\n%s", err, b)
+	}
+
+	if len(pod.Spec.Containers) != 3 {
+		t.Fatalf("Expected the plugin, worker and sidecar containers, got %d containers", len(pod.Spec.Containers))
+	}
+	sidecar := pod.Spec.Containers[2]
+	if sidecar.Name != "credential-helper" || sidecar.Image != "example.com/credential-helper:v1" {
+		t.Errorf("Expected the credential-helper sidecar last, got %v (%v)", sidecar.Name, sidecar.Image)
+	}
+	expected := []corev1.VolumeMount{
+		{Name: "credentials", MountPath: "/credentials"},
+		{Name: "results", MountPath: "/tmp/results"},
+	}
+	if !reflect.DeepEqual(sidecar.VolumeMounts, expected) {
+		t.Errorf("Expected sidecar volume mounts %+v, got %+v", expected, sidecar.VolumeMounts)
+	}
+}
+
+func TestFillTemplate_localResults(t *testing.T) {
+	testJob := NewPlugin(plugin.Definition{
+		Name:             "test-job",
+		ResultType:       "test-job-result",
+		ResultsClaimName: "results-claim",
+	}, expectedNamespace, expectedImageName, "Always")
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	var pod corev1.Pod
+	b, err := testJob.FillTemplate("", clientCert)
+	if err != nil {
+		t.Fatalf("Failed to fill template: %v", err)
+	}
+	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &pod); err != nil {
+		t.Fatalf("Failed to decode template to pod: %v\n%s", err, b)
+	}
+
+	volume := pod.Spec.Volumes[len(pod.Spec.Volumes)-1]
+	if volume.Name != plugin.LocalResultsVolume || volume.PersistentVolumeClaim == nil || volume.PersistentVolumeClaim.ClaimName != "results-claim" {
+		t.Errorf("Expected the results claim to be the last volume, got %+v", volume)
+	}
+	worker := pod.Spec.Containers[1]
+	expectedMount := corev1.VolumeMount{Name: plugin.LocalResultsVolume, MountPath: plugin.LocalResultsPath}
+	if mounts := worker.VolumeMounts; mounts[len(mounts)-1] != expectedMount {
+		t.Errorf("Expected the worker to mount the results claim, got %+v", mounts)
+	}
+	found := false
+	for _, env := range worker.Env {
+		if env.Name == "LOCAL_RESULTS_DIR" && env.Value == plugin.LocalResultsPath {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected the worker to be told to store its results, got %+v", worker.Env)
+	}
+
+	// The fetch pod mounts the same claim.
+	fetchPod, err := testJob.FetchPod(nil, plugin.ExpectedResult{ResultType: "test-job-result"})
+	if err != nil {
+		t.Fatalf("unexpected error getting fetch pod: %v", err)
+	}
+	if !reflect.DeepEqual(fetchPod.Spec.Volumes, []corev1.Volume{volume}) {
+		t.Errorf("Expected the fetch pod to mount %+v, got %+v", volume, fetchPod.Spec.Volumes)
+	}
+}
+
+func TestFillTemplate_serviceAccountToken(t *testing.T) {
+	testJob := NewPlugin(plugin.Definition{
+		Name:                "test-job",
+		ResultType:          "test-job-result",
+		ServiceAccountToken: &manifest.ServiceAccountToken{Audience: "e2e", ExpirationSeconds: 7200},
+		Spec: manifest.Container{
+			Container: corev1.Container{Name: "producer-container"},
+		},
+	}, expectedNamespace, expectedImageName, "Always")
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	var pod corev1.Pod
+	b, err := testJob.FillTemplate("", clientCert)
+	if err != nil {
+		t.Fatalf("Failed to fill template: %v", err)
+	}
+	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &pod); err != nil {
+		t.Fatalf("Failed to decode template to pod: %v\n%s", err, b)
+	}
+
+	volume := pod.Spec.Volumes[len(pod.Spec.Volumes)-1]
+	if volume.Name != plugin.ServiceAccountTokenVolume || volume.EmptyDir == nil {
+		t.Errorf("Expected the token volume to be the last volume, got %+v", volume)
+	}
+
+	env := func(c corev1.Container) map[string]string {
+		vars := map[string]string{}
+		for _, env := range c.Env {
+			vars[env.Name] = env.Value
+		}
+		return vars
+	}
+
+	producer := pod.Spec.Containers[0]
+	if kubeconfig := env(producer)["KUBECONFIG"]; kubeconfig != plugin.ServiceAccountTokenPath+"/"+plugin.KubeconfigFile {
+		t.Errorf("Expected the plugin to be given the kubeconfig, got KUBECONFIG %q", kubeconfig)
+	}
+	expectedMount := corev1.VolumeMount{Name: plugin.ServiceAccountTokenVolume, MountPath: plugin.ServiceAccountTokenPath, ReadOnly: true}
+	if mounts := producer.VolumeMounts; len(mounts) != 1 || mounts[0] != expectedMount {
+		t.Errorf("Expected the plugin to mount the token volume, got %+v", mounts)
+	}
+
+	if len(pod.Spec.InitContainers) != 1 {
+		t.Fatalf("Expected an init container to write the first token, got %+v", pod.Spec.InitContainers)
+	}
+	for _, c := range []corev1.Container{pod.Spec.InitContainers[0], pod.Spec.Containers[1]} {
+		vars := env(c)
+		if vars["TOKEN_DIR"] != plugin.ServiceAccountTokenPath || vars["TOKEN_AUDIENCE"] != "e2e" || vars["TOKEN_EXPIRATION_SECONDS"] != "7200" {
+			t.Errorf("Expected container %v to be configured for the token, got %+v", c.Name, c.Env)
+		}
+		if vars["POD_NAMESPACE"] != expectedNamespace || vars["SERVICE_ACCOUNT_NAME"] != "sonobuoy-serviceaccount" {
+			t.Errorf("Expected container %v to be told its service account, got %+v", c.Name, c.Env)
+		}
+	}
+}
+
+func TestFillTemplate_externalResults(t *testing.T) {
+	testJob := NewPlugin(plugin.Definition{
+		Name:            "test-job",
+		ResultType:      "test-job-result",
+		ExternalResults: &manifest.ExternalResults{URL: "https://collector.example.com/results", AuthSecret: "collector"},
+		Spec: manifest.Container{
+			Container: corev1.Container{Name: "producer-container"},
+		},
+	}, expectedNamespace, expectedImageName, "Always")
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	var pod corev1.Pod
+	b, err := testJob.FillTemplate("", clientCert)
+	if err != nil {
+		t.Fatalf("Failed to fill template: %v", err)
+	}
+	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &pod); err != nil {
+		t.Fatalf("Failed to decode template to pod: %v\n%s", err, b)
+	}
+
+	var url string
+	var authorization *corev1.SecretKeySelector
+	for _, env := range pod.Spec.Containers[1].Env {
+		switch env.Name {
+		case "EXTERNAL_RESULTS_URL":
+			url = env.Value
+		case "EXTERNAL_RESULTS_AUTHORIZATION":
+			authorization = env.ValueFrom.SecretKeyRef
+		}
+	}
+	if url != "https://collector.example.com/results" {
+		t.Errorf("Expected the worker to be given the external results URL, got %q", url)
+	}
+	if authorization == nil || authorization.Name != "collector" || authorization.Key != manifest.DefaultExternalResultsAuthKey {
+		t.Errorf("Expected the Authorization header to come from the secret, got %+v", authorization)
+	}
+}
+
+func TestFillTemplate_resultsTransport(t *testing.T) {
+	testJob := NewPlugin(plugin.Definition{
+		Name:             "test-job",
+		ResultType:       "test-job-result",
+		ResultsTransport: &manifest.ResultsTransport{Command: []string{"/tmp/results/bin/send", "--topic='results'"}},
+		Spec: manifest.Container{
+			Container: corev1.Container{Name: "producer-container"},
+		},
+	}, expectedNamespace, expectedImageName, "Always")
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	var pod corev1.Pod
+	b, err := testJob.FillTemplate("", clientCert)
+	if err != nil {
+		t.Fatalf("Failed to fill template: %v", err)
+	}
+	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &pod); err != nil {
+		t.Fatalf("Failed to decode template to pod: %v\n%s", err, b)
+	}
+
+	var transport string
+	for _, env := range pod.Spec.Containers[1].Env {
+		if env.Name == "RESULTS_TRANSPORT" {
+			transport = env.Value
+		}
+	}
+	if expected := `["/tmp/results/bin/send","--topic='results'"]`; transport != expected {
+		t.Errorf("Expected the worker to be given the results transport %v, got %q", expected, transport)
+	}
+}
+
+func TestFillTemplate_submitRetry(t *testing.T) {
+	testJob := NewPlugin(plugin.Definition{
+		Name:        "test-job",
+		ResultType:  "test-job-result",
+		SubmitRetry: &manifest.SubmitRetry{Attempts: 10, MaxElapsedSeconds: 600, Jitter: 0.5},
+		Spec: manifest.Container{
+			Container: corev1.Container{Name: "producer-container"},
+		},
+	}, expectedNamespace, expectedImageName, "Always")
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	var pod corev1.Pod
+	b, err := testJob.FillTemplate("", clientCert)
+	if err != nil {
+		t.Fatalf("Failed to fill template: %v", err)
+	}
+	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &pod); err != nil {
+		t.Fatalf("Failed to decode template to pod: %v\n%s", err, b)
+	}
+
+	env := map[string]string{}
+	for _, e := range pod.Spec.Containers[1].Env {
+		env[e.Name] = e.Value
+	}
+	expected := map[string]string{
+		"RETRY_ATTEMPTS":         "10",
+		"RETRY_MAX_ELAPSED_TIME": "10m0s",
+		"RETRY_JITTER":           "0.5",
+	}
+	for name, value := range expected {
+		if env[name] != value {
+			t.Errorf("Expected the worker's %v to be %q, got %q", name, value, env[name])
+		}
+	}
+}
+
+func TestFillTemplate_payload(t *testing.T) {
+	testJob := NewPlugin(plugin.Definition{
+		Name:                "test-job",
+		ResultType:          "test-job-result",
+		ServiceAccountToken: &manifest.ServiceAccountToken{},
+		Files:               map[string]string{"skip.txt": "Flaky"},
+		Spec: manifest.Container{
+			Container: corev1.Container{Name: "producer-container"},
+		},
+	}, expectedNamespace, expectedImageName, "Always")
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	var pod corev1.Pod
+	b, err := testJob.FillTemplate("sonobuoy-master:8080", clientCert)
+	if err != nil {
+		t.Fatalf("Failed to fill template: %v", err)
+	}
+	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &pod); err != nil {
+		t.Fatalf("Failed to decode template to pod: %v\n%s", err, b)
+	}
+
+	volume := pod.Spec.Volumes[len(pod.Spec.Volumes)-1]
+	if volume.Name != plugin.PayloadVolume || volume.EmptyDir == nil {
+		t.Errorf("Expected the payload volume to be the last volume, got %+v", volume)
+	}
+
+	expectedMount := corev1.VolumeMount{Name: plugin.PayloadVolume, MountPath: plugin.PayloadPath, ReadOnly: true}
+	if mounts := pod.Spec.Containers[0].VolumeMounts; len(mounts) != 2 || mounts[1] != expectedMount {
+		t.Errorf("Expected the plugin to mount the payload volume, got %+v", mounts)
+	}
+
+	// The token's init container comes first.
+	if len(pod.Spec.InitContainers) != 2 {
+		t.Fatalf("Expected init containers for the token and the payload, got %+v", pod.Spec.InitContainers)
+	}
+	payload := pod.Spec.InitContainers[1]
+	if !reflect.DeepEqual(payload.Args, []string{"worker", "payload", "-v", "5", "--logtostderr"}) {
+		t.Errorf("Expected the payload to be downloaded by the worker, got %v", payload.Args)
+	}
+	vars := map[string]string{}
+	for _, env := range payload.Env {
+		vars[env.Name] = env.Value
+	}
+	if vars["PAYLOAD_DIR"] != plugin.PayloadPath || vars["MASTER_URL"] != "https://sonobuoy-master:8080/api/v1/results/global" || vars["RESULT_TYPE"] != "test-job-result" {
+		t.Errorf("Expected the payload container to be configured to download the files, got %+v", payload.Env)
+	}
+}
+
+func TestFillTemplate_rbac(t *testing.T) {
+	testCases := []struct {
+		name     string
+		rbac     *manifest.RBAC
+		expected string
+	}{
+		{name: "sonobuoy's service account", expected: plugin.ServiceAccountName},
+		{name: "own service account", rbac: &manifest.RBAC{}, expected: "sonobuoy-plugin-test-job"},
+	}
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testJob := NewPlugin(plugin.Definition{
+				Name:                "test-job",
+				ResultType:          "test-job-result",
+				ServiceAccountToken: &manifest.ServiceAccountToken{},
+				RBAC:                tc.rbac,
+				Spec: manifest.Container{
+					Container: corev1.Container{Name: "producer-container"},
+				},
+			}, expectedNamespace, expectedImageName, "Always")
+
+			var pod corev1.Pod
+			b, err := testJob.FillTemplate("", clientCert)
+			if err != nil {
+				t.Fatalf("Failed to fill template: %v", err)
+			}
+			if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &pod); err != nil {
+				t.Fatalf("Failed to decode template to pod: %v\n%s", err, b)
+			}
+
+			if pod.Spec.ServiceAccountName != tc.expected {
+				t.Errorf("Expected service account %v, got %v", tc.expected, pod.Spec.ServiceAccountName)
+			}
+			for _, env := range pod.Spec.Containers[1].Env {
+				if env.Name == "SERVICE_ACCOUNT_NAME" && env.Value != tc.expected {
+					t.Errorf("Expected the worker to be told service account %v, got %v", tc.expected, env.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestFillTemplate_timeout(t *testing.T) {
+	testCases := []struct {
+		name  string
+		token *manifest.ServiceAccountToken
+	}{
+		{name: "timeout"},
+		{name: "timeout and token", token: &manifest.ServiceAccountToken{}},
+	}
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			testJob := NewPlugin(plugin.Definition{
+				Name:                "test-job",
+				ResultType:          "test-job-result",
+				TimeoutSeconds:      60,
+				ServiceAccountToken: tc.token,
+				Spec: manifest.Container{
+					Container: corev1.Container{Name: "producer-container"},
+				},
+			}, expectedNamespace, expectedImageName, "Always")
+
+			var pod corev1.Pod
+			b, err := testJob.FillTemplate("", clientCert)
+			if err != nil {
+				t.Fatalf("Failed to fill template: %v", err)
+			}
+			if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &pod); err != nil {
+				t.Fatalf("Failed to decode template to pod: %v\n%s", err, b)
+			}
+
+			// The worker needs to know its pod to stop it.
+			counts := map[string]int{}
+			for _, env := range pod.Spec.Containers[1].Env {
+				counts[env.Name]++
+			}
+			for _, name := range []string{"TIMEOUT_SECONDS", "POD_NAME", "POD_NAMESPACE"} {
+				if counts[name] != 1 {
+					t.Errorf("Expected the worker to be given %v once, got %+v", name, pod.Spec.Containers[1].Env)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPod(t *testing.T) {
+	failed := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "sonobuoy-e2e-job-abc",
+			Namespace:       expectedNamespace,
+			Labels:          map[string]string{"sonobuoy-run": "abc"},
+			ResourceVersion: "12",
+			UID:             "1234",
+		},
+		Spec:   corev1.PodSpec{NodeName: "node1", Containers: []corev1.Container{{Name: "e2e"}}},
+		Status: corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"},
+	}
+
+	retry := retryPod(failed, 2)
+	if retry.Name != "sonobuoy-e2e-job-abc-retry-2" {
+		t.Errorf("expected retry to be named sonobuoy-e2e-job-abc-retry-2, got %v", retry.Name)
+	}
+	if retry.Labels["sonobuoy-run"] != "abc" {
+		t.Errorf("expected retry to keep the run label, got %v", retry.Labels)
+	}
+	if retry.ResourceVersion != "" || retry.UID != "" || retry.Status.Phase != "" {
+		t.Errorf("expected retry to be a new pod, got %+v", retry.ObjectMeta)
+	}
+	if failed.Name != "sonobuoy-e2e-job-abc" {
+		t.Errorf("expected the failed pod not to change, got %v", failed.Name)
+	}
+}
+
+func TestFillTemplate_metadata(t *testing.T) {
+	testJob := NewPlugin(plugin.Definition{
+		Name:        "test-job",
+		ResultType:  "test-job-result",
+		Labels:      map[string]string{"app.kubernetes.io/part-of": "conformance"},
+		Annotations: map[string]string{"sidecar.istio.io/inject": "false"},
+		Spec: manifest.Container{
+			Container: corev1.Container{Name: "producer-container"},
+		},
+	}, expectedNamespace, expectedImageName, "Always")
+
+	auth, err := ca.NewAuthority()
+	if err != nil {
+		t.Fatalf("couldn't make CA Authority %v", err)
+	}
+	clientCert, err := auth.ClientKeyPair("test-job")
+	if err != nil {
+		t.Fatalf("couldn't make client certificate %v", err)
+	}
+
+	var pod corev1.Pod
+	b, err := testJob.FillTemplate("", clientCert)
+	if err != nil {
+		t.Fatalf("Failed to fill template: %v", err)
+	}
+	if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &pod); err != nil {
+		t.Fatalf("Failed to decode template to pod: %v\n%s", err, b)
+	}
+
+	if pod.Labels["app.kubernetes.io/part-of"] != "conformance" || pod.Labels["sonobuoy-run"] != testJob.GetSessionID() {
+		t.Errorf("Expected the custom labels alongside Sonobuoy's, got %v", pod.Labels)
+	}
+	if pod.Annotations["sidecar.istio.io/inject"] != "false" || pod.Annotations["sonobuoy-plugin"] != "test-job" {
+		t.Errorf("Expected the custom annotations alongside Sonobuoy's, got %v", pod.Annotations)
+	}
+
+	secret, err := testJob.MakeTLSSecret(clientCert, "token")
+	if err != nil {
+		t.Fatalf("couldn't make TLS secret: %v", err)
+	}
+	if secret.Labels["app.kubernetes.io/part-of"] != "conformance" || secret.Annotations["sidecar.istio.io/inject"] != "false" {
+		t.Errorf("Expected the TLS secret to have the custom labels and annotations, got %v and %v", secret.Labels, secret.Annotations)
+	}
+}
+
+func TestFillTemplate_securityContext(t *testing.T) {
+	privileged := true
+	testCases := []struct {
+		mode       string
+		restricted bool
+	}{
+		{mode: ""},
+		{mode: plugin.SecurityContextNone},
+		{mode: plugin.SecurityContextRestricted, restricted: true},
+		// Jobs don't need the host, so they're restricted in the privileged mode too.
+		{mode: plugin.SecurityContextPrivileged, restricted: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.mode, func(t *testing.T) {
+			testJob := NewPlugin(plugin.Definition{
+				Name:                "test-job",
+				ResultType:          "test-job-result",
+				SecurityContextMode: tc.mode,
+				Spec: manifest.Container{
+					Container: corev1.Container{Name: "producer-container"},
+				},
+				Sidecars: []corev1.Container{{
+					Name:            "own-context",
+					SecurityContext: &corev1.SecurityContext{Privileged: &privileged},
+				}},
+			}, expectedNamespace, expectedImageName, "Always")
+
+			auth, err := ca.NewAuthority()
+			if err != nil {
+				t.Fatalf("couldn't make CA Authority %v", err)
+			}
+			clientCert, err := auth.ClientKeyPair("test-job")
+			if err != nil {
+				t.Fatalf("couldn't make client certificate %v", err)
+			}
+
+			var pod corev1.Pod
+			b, err := testJob.FillTemplate("", clientCert)
+			if err != nil {
+				t.Fatalf("Failed to fill template: %v", err)
+			}
+			if err := kuberuntime.DecodeInto(scheme.Codecs.UniversalDecoder(), b, &pod); err != nil {
+				t.Fatalf("Failed to decode template to pod: %v\n%s", err, b)
+			}
+
+			if !tc.restricted {
+				if pod.Spec.SecurityContext != nil && pod.Spec.SecurityContext.RunAsNonRoot != nil {
+					t.Errorf("Expected no pod security context, got %+v", pod.Spec.SecurityContext)
+				}
+				if _, ok := pod.Annotations[corev1.SeccompPodAnnotationKey]; ok {
+					t.Errorf("Expected no seccomp annotation, got %v", pod.Annotations)
+				}
+				for _, c := range pod.Spec.Containers {
+					if c.Name != "own-context" && c.SecurityContext != nil {
+						t.Errorf("Expected container %v to have no security context, got %+v", c.Name, c.SecurityContext)
+					}
+				}
+				return
+			}
+
+			context := pod.Spec.SecurityContext
+			if context == nil || context.RunAsNonRoot == nil || !*context.RunAsNonRoot ||
+				context.RunAsUser == nil || *context.RunAsUser != plugin.RestrictedUser {
+				t.Errorf("Expected the pod to run as user %v, got %+v", plugin.RestrictedUser, context)
+			}
+			if pod.Annotations[corev1.SeccompPodAnnotationKey] != "runtime/default" {
+				t.Errorf("Expected the runtime/default seccomp profile, got %v", pod.Annotations)
+			}
+			for _, c := range pod.Spec.Containers {
+				if c.Name == "own-context" {
+					if c.SecurityContext == nil || c.SecurityContext.Privileged == nil || !*c.SecurityContext.Privileged {
+						t.Errorf("Expected the sidecar to keep its own security context, got %+v", c.SecurityContext)
+					}
+					continue
+				}
+				sc := c.SecurityContext
+				if sc == nil || sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation ||
+					sc.Capabilities == nil || !reflect.DeepEqual(sc.Capabilities.Drop, []corev1.Capability{"ALL"}) {
+					t.Errorf("Expected container %v to drop all capabilities without privilege escalation, got %+v", c.Name, sc)
+				}
+			}
+		})
+	}
+}
@@ -29,10 +29,19 @@ metadata:
     sonobuoy-driver: Job
     sonobuoy-plugin: {{.PluginName}}
     sonobuoy-result-type: {{.ResultType}}
+    {{- if .SeccompProfile }}
+    seccomp.security.alpha.kubernetes.io/pod: {{.SeccompProfile}}
+    {{- end }}
+    {{- if .Annotations }}
+    {{.Annotations | indent 4}}
+    {{- end }}
   labels:
     component: sonobuoy
     sonobuoy-run: '{{.SessionID}}'
     tier: analysis
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
   name: sonobuoy-{{.PluginName}}-job-{{.SessionID}}
   namespace: '{{.Namespace}}'
 spec:
@@ -51,6 +60,102 @@ spec:
       value: '{{.MasterAddress}}'
     - name: RESULT_TYPE
       value: {{.ResultType}}
+    {{- if .ResultsStream }}
+    - name: RESULTS_STREAM
+      value: '{{.ResultsStream}}'
+    {{- end }}
+    {{- if .ResultsCompression }}
+    - name: RESULTS_COMPRESSION
+      value: '{{.ResultsCompression}}'
+    {{- end }}
+    {{- if .ResultsProtocol }}
+    - name: RESULTS_PROTOCOL
+      value: '{{.ResultsProtocol}}'
+    {{- end }}
+    {{- if .ResultsTransport }}
+    - name: RESULTS_TRANSPORT
+      value: {{.ResultsTransport}}
+    {{- end }}
+    {{- if .ExternalResultsURL }}
+    - name: EXTERNAL_RESULTS_URL
+      value: '{{.ExternalResultsURL}}'
+    {{- if .ExternalResultsSecret }}
+    - name: EXTERNAL_RESULTS_AUTHORIZATION
+      valueFrom:
+        secretKeyRef:
+          name: {{.ExternalResultsSecret}}
+          key: {{.ExternalResultsSecretKey}}
+    {{- end }}
+    {{- end }}
+    {{- if .TimeoutSeconds }}
+    - name: TIMEOUT_SECONDS
+      value: '{{.TimeoutSeconds}}'
+    {{- end }}
+    {{- if .LocalResultsVolume }}
+    - name: LOCAL_RESULTS_DIR
+      value: /tmp/local-results
+    {{- end }}
+    {{- if .RetryAttempts }}
+    - name: RETRY_ATTEMPTS
+      value: '{{.RetryAttempts}}'
+    {{- end }}
+    {{- if .RetryMaxElapsedTime }}
+    - name: RETRY_MAX_ELAPSED_TIME
+      value: '{{.RetryMaxElapsedTime}}'
+    {{- end }}
+    {{- if .RetryJitter }}
+    - name: RETRY_JITTER
+      value: '{{.RetryJitter}}'
+    {{- end }}
+    {{- if .TracingEndpoint }}
+    - name: OTEL_EXPORTER_OTLP_ENDPOINT
+      value: '{{.TracingEndpoint}}'
+    - name: TRACEPARENT
+      value: '{{.TraceParent}}'
+    {{- end }}
+    {{- if .ServiceAccountToken }}
+    - name: TOKEN_DIR
+      value: /tmp/sonobuoy-token
+    {{- if .TokenAudience }}
+    - name: TOKEN_AUDIENCE
+      value: '{{.TokenAudience}}'
+    {{- end }}
+    {{- if .TokenExpirationSeconds }}
+    - name: TOKEN_EXPIRATION_SECONDS
+      value: '{{.TokenExpirationSeconds}}'
+    {{- end }}
+    {{- end }}
+    {{- if or .ServiceAccountToken .StopOnTimeout }}
+    - name: POD_NAME
+      valueFrom:
+        fieldRef:
+          fieldPath: metadata.name
+    - name: POD_UID
+      valueFrom:
+        fieldRef:
+          fieldPath: metadata.uid
+    - name: POD_NAMESPACE
+      value: '{{.Namespace}}'
+    - name: SERVICE_ACCOUNT_NAME
+      value: {{.ServiceAccountName}}
+    {{- end }}
+    {{- if .HTTPProxy }}
+    - name: HTTP_PROXY
+      value: '{{.HTTPProxy}}'
+    {{- end }}
+    {{- if .HTTPSProxy }}
+    - name: HTTPS_PROXY
+      value: '{{.HTTPSProxy}}'
+    {{- end }}
+    {{- if .NoProxy }}
+    - name: NO_PROXY
+      value: '{{.NoProxy}}'
+    {{- end }}
+    {{- if .CABundle }}
+    - name: CA_BUNDLE
+      value: |
+        {{.CABundle | indent 8}}
+    {{- end }}
     - name: CA_CERT
       value: |
         {{.CACert | indent 8}}
@@ -64,22 +169,175 @@ spec:
         secretKeyRef:
           name: {{.SecretName}}
           key: tls.key
+    - name: RESULTS_TOKEN
+      valueFrom:
+        secretKeyRef:
+          name: {{.SecretName}}
+          key: results-token
     image: {{.SonobuoyImage}}
     imagePullPolicy: {{.ImagePullPolicy}}
     name: sonobuoy-worker
+    {{- if .ContainerSecurityContext }}
+    securityContext:
+      {{.ContainerSecurityContext | indent 6}}
+    {{- end }}
+    {{- if .WorkerResources }}
+    resources:
+      {{.WorkerResources | indent 6}}
+    {{- end }}
     volumeMounts:
     - mountPath: /tmp/results
       name: results
       readOnly: false
+    {{- if .LocalResultsVolume }}
+    - mountPath: /tmp/local-results
+      name: local-results
+    {{- end }}
+    {{- if .ServiceAccountToken }}
+    - mountPath: /tmp/sonobuoy-token
+      name: sonobuoy-token
+    {{- end }}
+  {{- if .Sidecars }}
+  {{.Sidecars | indent 2}}
+  {{- end }}
+  {{- if or .ServiceAccountToken .Payload }}
+  initContainers:
+  {{- end }}
+  {{- if .ServiceAccountToken }}
+  - command: ["/sonobuoy"]
+    args: ["worker", "token", "-v", "5", "--logtostderr"]
+    env:
+    - name: TOKEN_DIR
+      value: /tmp/sonobuoy-token
+    {{- if .TokenAudience }}
+    - name: TOKEN_AUDIENCE
+      value: '{{.TokenAudience}}'
+    {{- end }}
+    {{- if .TokenExpirationSeconds }}
+    - name: TOKEN_EXPIRATION_SECONDS
+      value: '{{.TokenExpirationSeconds}}'
+    {{- end }}
+    - name: POD_NAME
+      valueFrom:
+        fieldRef:
+          fieldPath: metadata.name
+    - name: POD_UID
+      valueFrom:
+        fieldRef:
+          fieldPath: metadata.uid
+    - name: POD_NAMESPACE
+      value: '{{.Namespace}}'
+    - name: SERVICE_ACCOUNT_NAME
+      value: {{.ServiceAccountName}}
+    image: {{.SonobuoyImage}}
+    imagePullPolicy: {{.ImagePullPolicy}}
+    name: sonobuoy-token
+    {{- if .ContainerSecurityContext }}
+    securityContext:
+      {{.ContainerSecurityContext | indent 6}}
+    {{- end }}
+    volumeMounts:
+    - mountPath: /tmp/sonobuoy-token
+      name: sonobuoy-token
+  {{- end }}
+  {{- if .Payload }}
+  - command: ["/sonobuoy"]
+    args: ["worker", "payload", "-v", "5", "--logtostderr"]
+    env:
+    - name: MASTER_URL
+      value: '{{.MasterAddress}}'
+    - name: RESULT_TYPE
+      value: {{.ResultType}}
+    - name: PAYLOAD_DIR
+      value: /tmp/sonobuoy-payload
+    {{- if .HTTPProxy }}
+    - name: HTTP_PROXY
+      value: '{{.HTTPProxy}}'
+    {{- end }}
+    {{- if .HTTPSProxy }}
+    - name: HTTPS_PROXY
+      value: '{{.HTTPSProxy}}'
+    {{- end }}
+    {{- if .NoProxy }}
+    - name: NO_PROXY
+      value: '{{.NoProxy}}'
+    {{- end }}
+    {{- if .CABundle }}
+    - name: CA_BUNDLE
+      value: |
+        {{.CABundle | indent 8}}
+    {{- end }}
+    - name: CA_CERT
+      value: |
+        {{.CACert | indent 8}}
+    - name: CLIENT_CERT
+      valueFrom:
+        secretKeyRef:
+          name: {{.SecretName}}
+          key: tls.crt
+    - name: CLIENT_KEY
+      valueFrom:
+        secretKeyRef:
+          name: {{.SecretName}}
+          key: tls.key
+    image: {{.SonobuoyImage}}
+    imagePullPolicy: {{.ImagePullPolicy}}
+    name: sonobuoy-payload
+    {{- if .ContainerSecurityContext }}
+    securityContext:
+      {{.ContainerSecurityContext | indent 6}}
+    {{- end }}
+    volumeMounts:
+    - mountPath: /tmp/sonobuoy-payload
+      name: sonobuoy-payload
+  {{- end }}
+  {{- if .ImagePullSecrets }}
+  imagePullSecrets:
+  {{- range .ImagePullSecrets }}
+  - name: {{.}}
+  {{- end }}
+  {{- end }}
   restartPolicy: Never
-  serviceAccountName: sonobuoy-serviceaccount
+  serviceAccountName: {{.ServiceAccountName}}
+  {{- if .PodSecurityContext }}
+  securityContext:
+    {{.PodSecurityContext | indent 4}}
+  {{- end }}
+  {{- if .PriorityClassName }}
+  priorityClassName: {{.PriorityClassName}}
+  {{- end }}
+  {{- if .NodeSelector }}
+  nodeSelector:
+    {{.NodeSelector | indent 4}}
+  {{- end }}
+  {{- if .Affinity }}
+  affinity:
+    {{.Affinity | indent 4}}
+  {{- end }}
   tolerations:
   - effect: NoSchedule
     key: node-role.kubernetes.io/master
     operator: Exists
   - key: CriticalAddonsOnly
     operator: Exists
+  {{- if .Tolerations }}
+  {{.Tolerations | indent 2}}
+  {{- end }}
   volumes:
   - emptyDir: {}
     name: results
+  {{- if .ExtraVolumes }}
+  {{.ExtraVolumes | indent 2}}
+  {{- end }}
+  {{- if .LocalResultsVolume }}
+  - {{.LocalResultsVolume | indent 4}}
+  {{- end }}
+  {{- if .ServiceAccountToken }}
+  - emptyDir: {}
+    name: sonobuoy-token
+  {{- end }}
+  {{- if .Payload }}
+  - emptyDir: {}
+    name: sonobuoy-payload
+  {{- end }}
 `)
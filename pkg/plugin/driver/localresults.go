@@ -0,0 +1,145 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"path"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// localResultsVolume returns the volume the plugin's workers store their
+// results in when they can't submit them, or nil if they submit them. Host
+// paths are split up by namespace, so runs in different namespaces don't see
+// each other's results.
+func (b *Base) localResultsVolume() *v1.Volume {
+	switch {
+	case b.Definition.ResultsHostPath != "":
+		hostPathType := v1.HostPathDirectoryOrCreate
+		return &v1.Volume{
+			Name: plugin.LocalResultsVolume,
+			VolumeSource: v1.VolumeSource{
+				HostPath: &v1.HostPathVolumeSource{
+					Path: path.Join(b.Definition.ResultsHostPath, b.Namespace),
+					Type: &hostPathType,
+				},
+			},
+		}
+	case b.Definition.ResultsClaimName != "":
+		return &v1.Volume{
+			Name: plugin.LocalResultsVolume,
+			VolumeSource: v1.VolumeSource{
+				PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{
+					ClaimName: b.Definition.ResultsClaimName,
+				},
+			},
+		}
+	default:
+		return nil
+	}
+}
+
+// StoresResults returns whether the plugin's workers store their results for
+// the aggregator to fetch (to adhere to plugin.Interface).
+func (b *Base) StoresResults() bool {
+	return b.localResultsVolume() != nil
+}
+
+// FetchPod returns a pod that mounts the volume the plugin's workers store
+// their results in (to adhere to plugin.Interface). Results stored on a host path are only on the node the
+// worker ran on, so the pod is pinned to that node: the result's own node for
+// DaemonSet plugins, otherwise the node of the plugin's pod.
+func (b *Base) FetchPod(kubeClient kubernetes.Interface, result plugin.ExpectedResult) (*v1.Pod, error) {
+	volume := b.localResultsVolume()
+	if volume == nil {
+		return nil, errors.Errorf("plugin %v doesn't store its results", b.GetName())
+	}
+
+	nodeName := ""
+	if volume.HostPath != nil {
+		nodeName = result.NodeName
+		if nodeName == "" {
+			pods, err := kubeClient.CoreV1().Pods(b.Namespace).List(metav1.ListOptions{
+				LabelSelector: "sonobuoy-run=" + b.GetSessionID(),
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "couldn't list pods for plugin %v", b.GetName())
+			}
+			for _, pod := range pods.Items {
+				if pod.Spec.NodeName != "" {
+					nodeName = pod.Spec.NodeName
+					break
+				}
+			}
+			if nodeName == "" {
+				return nil, errors.Errorf("plugin %v hasn't been scheduled to a node yet", b.GetName())
+			}
+		}
+	}
+
+	var pullSecrets []v1.LocalObjectReference
+	for _, secret := range b.Definition.ImagePullSecrets {
+		pullSecrets = append(pullSecrets, v1.LocalObjectReference{Name: secret})
+	}
+
+	var podContext *v1.PodSecurityContext
+	var containerContext *v1.SecurityContext
+	annotations := b.Definition.Annotations
+	if b.securityProfile() == plugin.SecurityContextRestricted {
+		podContext, containerContext = b.podSecurityContext(), b.containerSecurityContext()
+		annotations = plugin.MergeMetadata(annotations, map[string]string{v1.SeccompPodAnnotationKey: seccompProfile})
+	}
+
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "sonobuoy-" + b.GetName() + "-fetch-",
+			Namespace:    b.Namespace,
+			Labels: plugin.MergeMetadata(b.Definition.Labels, map[string]string{
+				"component":      "sonobuoy",
+				"sonobuoy-fetch": b.GetSessionID(),
+			}),
+			Annotations: annotations,
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:            "fetch",
+				Image:           b.SonobuoyImage,
+				ImagePullPolicy: v1.PullPolicy(b.ImagePullPolicy),
+				// The aggregator execs into the pod to fetch the results.
+				Command:         []string{"/bin/sh", "-c", "while true; do sleep 3600; done"},
+				Resources:       b.Definition.WorkerResources,
+				SecurityContext: containerContext,
+				VolumeMounts: []v1.VolumeMount{{
+					Name:      plugin.LocalResultsVolume,
+					MountPath: plugin.LocalResultsPath,
+				}},
+			}},
+			NodeName:          nodeName,
+			ImagePullSecrets:  pullSecrets,
+			RestartPolicy:     v1.RestartPolicyNever,
+			PriorityClassName: b.Definition.PriorityClassName,
+			SecurityContext:   podContext,
+			// It has to stay on the node whatever its taints.
+			Tolerations: []v1.Toleration{{Operator: v1.TolerationOpExists}},
+			Volumes:     []v1.Volume{*volume},
+		},
+	}, nil
+}
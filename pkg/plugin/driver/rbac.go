@@ -0,0 +1,168 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/manifest"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// GetRBAC returns the rules this plugin's service account is granted, or nil if
+// it runs as Sonobuoy's.
+func (b *Base) GetRBAC() *manifest.RBAC {
+	return b.Definition.RBAC
+}
+
+// ServiceAccountName returns the service account the plugin's pods run as: one
+// of its own if it declares the RBAC rules it needs, or else Sonobuoy's.
+func (b *Base) ServiceAccountName() string {
+	if b.Definition.RBAC == nil {
+		return plugin.ServiceAccountName
+	}
+	return "sonobuoy-plugin-" + b.GetName()
+}
+
+// clusterRBACName returns the name of the plugin's ClusterRole and
+// ClusterRoleBinding, which includes the namespace since they aren't
+// namespaced themselves.
+func (b *Base) clusterRBACName() string {
+	return fmt.Sprintf("sonobuoy-plugin-%s-%s", b.GetName(), b.Namespace)
+}
+
+// namespaceRules returns the rules granted to the plugin's service account in
+// Sonobuoy's namespace, which include requesting its own tokens if the worker
+// keeps one for it, and stopping its pods if the worker stops them when the
+// plugin times out.
+func (b *Base) namespaceRules() []rbacv1.PolicyRule {
+	rules := append([]rbacv1.PolicyRule{}, b.Definition.RBAC.Rules...)
+	if b.Definition.ServiceAccountToken != nil {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups:     []string{""},
+			Resources:     []string{"serviceaccounts/token"},
+			ResourceNames: []string{b.ServiceAccountName()},
+			Verbs:         []string{"create"},
+		})
+	}
+	if b.stopsOnTimeout() {
+		rules = append(rules, rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Resources: []string{"pods"},
+			Verbs:     []string{"patch"},
+		})
+	}
+	return rules
+}
+
+// CreateRBAC creates the plugin's service account and the Role and ClusterRole
+// granting it the rules it declares, along with their bindings. It does
+// nothing for plugins that run as Sonobuoy's service account. Objects left
+// over from an earlier run are reused, with their rules updated.
+func (b *Base) CreateRBAC(kubeclient kubernetes.Interface) error {
+	if b.Definition.RBAC == nil {
+		return nil
+	}
+
+	name := b.ServiceAccountName()
+	labels := plugin.MergeMetadata(b.Definition.Labels, map[string]string{
+		"component":    "sonobuoy",
+		"sonobuoy-run": b.GetSessionID(),
+	})
+	annotations := b.Definition.Annotations
+	meta := metav1.ObjectMeta{Name: name, Namespace: b.Namespace, Labels: labels, Annotations: annotations}
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: name, Namespace: b.Namespace}}
+
+	_, err := kubeclient.CoreV1().ServiceAccounts(b.Namespace).Create(&v1.ServiceAccount{ObjectMeta: meta})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrapf(err, "couldn't create service account for plugin %v", b.GetName())
+	}
+
+	if rules := b.namespaceRules(); len(rules) > 0 {
+		roles := kubeclient.RbacV1().Roles(b.Namespace)
+		role := &rbacv1.Role{ObjectMeta: meta, Rules: rules}
+		if _, err := roles.Create(role); apierrors.IsAlreadyExists(err) {
+			_, err = roles.Update(role)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "couldn't create role for plugin %v", b.GetName())
+		}
+
+		_, err = kubeclient.RbacV1().RoleBindings(b.Namespace).Create(&rbacv1.RoleBinding{
+			ObjectMeta: meta,
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+			Subjects:   subjects,
+		})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return errors.Wrapf(err, "couldn't create role binding for plugin %v", b.GetName())
+		}
+	}
+
+	if rules := b.Definition.RBAC.ClusterRules; len(rules) > 0 {
+		clusterMeta := metav1.ObjectMeta{Name: b.clusterRBACName(), Labels: labels, Annotations: annotations}
+		clusterRoles := kubeclient.RbacV1().ClusterRoles()
+		clusterRole := &rbacv1.ClusterRole{ObjectMeta: clusterMeta, Rules: rules}
+		if _, err := clusterRoles.Create(clusterRole); apierrors.IsAlreadyExists(err) {
+			_, err = clusterRoles.Update(clusterRole)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "couldn't create cluster role for plugin %v", b.GetName())
+		}
+
+		_, err = kubeclient.RbacV1().ClusterRoleBindings().Create(&rbacv1.ClusterRoleBinding{
+			ObjectMeta: clusterMeta,
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: clusterMeta.Name},
+			Subjects:   subjects,
+		})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return errors.Wrapf(err, "couldn't create cluster role binding for plugin %v", b.GetName())
+		}
+	}
+
+	return nil
+}
+
+// DeleteRBAC deletes whatever CreateRBAC created, logging any errors.
+func (b *Base) DeleteRBAC(kubeclient kubernetes.Interface) {
+	if b.Definition.RBAC == nil {
+		return
+	}
+
+	name, clusterName := b.ServiceAccountName(), b.clusterRBACName()
+	deletes := []struct {
+		kind   string
+		delete func() error
+	}{
+		{"cluster role binding", func() error { return kubeclient.RbacV1().ClusterRoleBindings().Delete(clusterName, nil) }},
+		{"cluster role", func() error { return kubeclient.RbacV1().ClusterRoles().Delete(clusterName, nil) }},
+		{"role binding", func() error { return kubeclient.RbacV1().RoleBindings(b.Namespace).Delete(name, nil) }},
+		{"role", func() error { return kubeclient.RbacV1().Roles(b.Namespace).Delete(name, nil) }},
+		{"service account", func() error { return kubeclient.CoreV1().ServiceAccounts(b.Namespace).Delete(name, nil) }},
+	}
+	for _, d := range deletes {
+		if err := d.delete(); err != nil && !apierrors.IsNotFound(err) {
+			errlog.LogError(errors.Wrapf(err, "error deleting %v for plugin %v", d.kind, b.GetName()))
+		}
+	}
+}
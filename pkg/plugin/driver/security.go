@@ -0,0 +1,89 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"k8s.io/api/core/v1"
+)
+
+// seccompProfile is the seccomp profile of pods given the restricted security
+// context, set with the v1.SeccompPodAnnotationKey annotation, which the API
+// server copies to their seccompProfile.
+const seccompProfile = "runtime/default"
+
+// securityProfile returns which security context the plugin's pods are given:
+// the restricted one, the privileged one for plugins that need the host in the
+// privileged mode, or none.
+func (b *Base) securityProfile() string {
+	switch b.Definition.SecurityContextMode {
+	case plugin.SecurityContextRestricted:
+		return plugin.SecurityContextRestricted
+	case plugin.SecurityContextPrivileged:
+		if b.NodeLevel {
+			return plugin.SecurityContextPrivileged
+		}
+		return plugin.SecurityContextRestricted
+	}
+	return plugin.SecurityContextNone
+}
+
+// podSecurityContext returns the security context of the plugin's pods, or
+// nil if they're left as they are.
+func (b *Base) podSecurityContext() *v1.PodSecurityContext {
+	if b.securityProfile() != plugin.SecurityContextRestricted {
+		return nil
+	}
+	nonRoot := true
+	user := int64(plugin.RestrictedUser)
+	return &v1.PodSecurityContext{
+		RunAsNonRoot: &nonRoot,
+		RunAsUser:    &user,
+		FSGroup:      &user,
+	}
+}
+
+// containerSecurityContext returns the security context of the containers in
+// the plugin's pods that don't set their own, or nil if they're left as they
+// are.
+func (b *Base) containerSecurityContext() *v1.SecurityContext {
+	switch b.securityProfile() {
+	case plugin.SecurityContextRestricted:
+		escalation := false
+		return &v1.SecurityContext{
+			AllowPrivilegeEscalation: &escalation,
+			Capabilities:             &v1.Capabilities{Drop: []v1.Capability{"ALL"}},
+		}
+	case plugin.SecurityContextPrivileged:
+		privileged := true
+		return &v1.SecurityContext{Privileged: &privileged}
+	}
+	return nil
+}
+
+// withSecurityContext sets the security context of each container that doesn't
+// set its own, if there is one to set.
+func withSecurityContext(containers []v1.Container, context *v1.SecurityContext) {
+	if context == nil {
+		return
+	}
+	for i := range containers {
+		if containers[i].SecurityContext == nil {
+			containers[i].SecurityContext = context.DeepCopy()
+		}
+	}
+}
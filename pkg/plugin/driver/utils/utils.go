@@ -37,42 +37,90 @@ func GetSessionID() string {
 	return string(ret)
 }
 
+// workerContainerName is the name of the container Sonobuoy adds to plugin
+// pods to submit their results.
+const workerContainerName = "sonobuoy-worker"
+
 // IsPodFailing returns whether a plugin's pod is failing and isn't likely to
 // succeed.
+func IsPodFailing(pod *v1.Pod) (bool, string) {
+	reason, message := PodFailure(pod)
+	return reason != "", message
+}
+
+// PodFailure returns why a plugin's pod is failing and isn't likely to
+// succeed, as one of the plugin.Failure reasons, along with a message
+// describing it. The reason is empty if the pod isn't failing.
 // TODO: this may require more revisions as we get more experience with
 // various types of failures that can occur.
-func IsPodFailing(pod *v1.Pod) (bool, string) {
+func PodFailure(pod *v1.Pod) (reason, message string) {
+	// Check if the pod was evicted from its node
+	if pod.Status.Phase == v1.PodFailed && pod.Status.Reason == "Evicted" {
+		return plugin.FailureEvicted, fmt.Sprintf("Pod was evicted: %v", pod.Status.Message)
+	}
+
+	// Check if the worker stopped the pod because the plugin timed out,
+	// before its containers' exit codes are mistaken for other failures
+	if pod.Status.Phase == v1.PodFailed && pod.Status.Reason == "DeadlineExceeded" {
+		return plugin.FailureTimeout, fmt.Sprintf("Pod was stopped after the plugin timed out: %v", pod.Status.Message)
+	}
+
 	// Check if the pod is unschedulable
 	for _, cond := range pod.Status.Conditions {
 		if cond.Reason == "Unschedulable" {
-			return true, fmt.Sprintf("Can't schedule pod: %v", cond.Message)
+			return plugin.FailureUnschedulable, fmt.Sprintf("Can't schedule pod: %v", cond.Message)
 		}
 	}
 
 	for _, cstatus := range pod.Status.ContainerStatuses {
+		// Check if a container ran out of memory, whether or not it's
+		// been restarted since
+		for _, terminated := range []*v1.ContainerStateTerminated{cstatus.State.Terminated, cstatus.LastTerminationState.Terminated} {
+			if terminated != nil && terminated.Reason == "OOMKilled" {
+				return plugin.FailureOOMKilled, fmt.Sprintf("Container %v was killed for running out of memory", cstatus.Name)
+			}
+		}
+
+		// Check if the worker gave up submitting the results
+		if terminated := cstatus.State.Terminated; cstatus.Name == workerContainerName && terminated != nil && terminated.ExitCode != 0 {
+			return plugin.FailureUploadFailed, fmt.Sprintf("Container %v exited with code %v before submitting the results", cstatus.Name, terminated.ExitCode)
+		}
+
 		// Check if a container in the pod is restarting multiple times
 		if cstatus.RestartCount > 2 {
 			errstr := fmt.Sprintf("Container %v has restarted unsuccessfully %v times", cstatus.Name, cstatus.RestartCount)
-			return true, errstr
+			return plugin.FailureCrashLoop, errstr
 		}
 
 		// Check if it can't fetch its image
 		if waiting := cstatus.State.Waiting; waiting != nil {
 			if waiting.Reason == "ImagePullBackOff" || waiting.Reason == "ErrImagePull" {
 				errstr := fmt.Sprintf("Container %v is in state %v", cstatus.Name, waiting.Reason)
-				return true, errstr
+				return plugin.FailureImagePullBackOff, errstr
 			}
 		}
 	}
 
-	return false, ""
+	return "", ""
+}
+
+// RetryablePodFailure returns whether a pod failing for the given reason, as
+// returned by PodFailure, might succeed if it's recreated. Failures to pull
+// images or schedule the pod won't go away by trying again.
+func RetryablePodFailure(reason string) bool {
+	switch reason {
+	case plugin.FailureEvicted, plugin.FailureOOMKilled, plugin.FailureCrashLoop, plugin.FailureUploadFailed:
+		return true
+	}
+	return false
 }
 
 // MakeErrorResult constructs a plugin.Result given an error message and error
 // data.  errdata is a map that will be placed in the sonobuoy results tarball
 // for this plugin as a JSON file, so it's what users will see for why the
 // plugin failed.  If errdata["error"] is not set, it will be filled in with an
-// "Unknown error" string.
+// "Unknown error" string. errdata["reason"], if set, is the result's
+// FailureReason.
 func MakeErrorResult(resultType string, errdata map[string]interface{}, nodeName string) *plugin.Result {
 	errJSON, _ := json.Marshal(errdata)
 
@@ -81,11 +129,14 @@ func MakeErrorResult(resultType string, errdata map[string]interface{}, nodeName
 		errstr = e.(string)
 	}
 
+	reason, _ := errdata["reason"].(string)
+
 	return &plugin.Result{
-		Body:       bytes.NewReader(errJSON),
-		Error:      errstr,
-		ResultType: resultType,
-		NodeName:   nodeName,
-		MimeType:   "application/json",
+		Body:          bytes.NewReader(errJSON),
+		Error:         errstr,
+		FailureReason: reason,
+		ResultType:    resultType,
+		NodeName:      nodeName,
+		MimeType:      "application/json",
 	}
 }
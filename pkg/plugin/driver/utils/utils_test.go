@@ -0,0 +1,131 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestPodFailure(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		status   v1.PodStatus
+		expected string
+	}{
+		{
+			desc: "running",
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "e2e", State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+			}},
+		}, {
+			desc: "unschedulable",
+			status: v1.PodStatus{Conditions: []v1.PodCondition{
+				{Type: v1.PodScheduled, Reason: "Unschedulable", Message: "0/3 nodes are available"},
+			}},
+			expected: plugin.FailureUnschedulable,
+		}, {
+			desc: "image pull",
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "e2e", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ErrImagePull"}}},
+			}},
+			expected: plugin.FailureImagePullBackOff,
+		}, {
+			desc: "out of memory",
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "e2e", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}}},
+			}},
+			expected: plugin.FailureOOMKilled,
+		}, {
+			desc: "restarted after running out of memory",
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{
+					Name:                 "e2e",
+					RestartCount:         3,
+					State:                v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+					LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}},
+				},
+			}},
+			expected: plugin.FailureOOMKilled,
+		}, {
+			desc: "crash loop",
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "e2e", RestartCount: 3, State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+			}},
+			expected: plugin.FailureCrashLoop,
+		}, {
+			desc: "worker failed",
+			status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "sonobuoy-worker", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 1}}},
+			}},
+			expected: plugin.FailureUploadFailed,
+		}, {
+			desc:     "evicted",
+			status:   v1.PodStatus{Phase: v1.PodFailed, Reason: "Evicted", Message: "The node was low on resource: memory."},
+			expected: plugin.FailureEvicted,
+		}, {
+			desc: "timed out",
+			status: v1.PodStatus{Phase: v1.PodFailed, Reason: "DeadlineExceeded", Message: "Pod was active on the node longer than the specified deadline", ContainerStatuses: []v1.ContainerStatus{
+				{Name: "sonobuoy-worker", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 143}}},
+			}},
+			expected: plugin.FailureTimeout,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			reason, message := PodFailure(&v1.Pod{Status: tc.status})
+			if reason != tc.expected {
+				t.Errorf("expected reason %q, got %q (%v)", tc.expected, reason, message)
+			}
+			if (reason == "") != (message == "") {
+				t.Errorf("expected a message with a reason, got %q for %q", message, reason)
+			}
+		})
+	}
+}
+
+func TestRetryablePodFailure(t *testing.T) {
+	testCases := map[string]bool{
+		plugin.FailureEvicted:          true,
+		plugin.FailureOOMKilled:        true,
+		plugin.FailureCrashLoop:        true,
+		plugin.FailureUploadFailed:     true,
+		plugin.FailureImagePullBackOff: false,
+		plugin.FailureUnschedulable:    false,
+		plugin.FailureTimeout:          false,
+		"":                             false,
+	}
+
+	for reason, expected := range testCases {
+		if got := RetryablePodFailure(reason); got != expected {
+			t.Errorf("expected RetryablePodFailure(%q) to be %v, got %v", reason, expected, got)
+		}
+	}
+}
+
+func TestMakeErrorResult_reason(t *testing.T) {
+	result := MakeErrorResult("e2e", map[string]interface{}{
+		"error":  "Container e2e was killed for running out of memory",
+		"reason": plugin.FailureOOMKilled,
+	}, "")
+	if result.FailureReason != plugin.FailureOOMKilled {
+		t.Errorf("expected reason %v, got %q", plugin.FailureOOMKilled, result.FailureReason)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"crypto/tls"
 	"io"
 	"path"
+	"time"
 
 	"github.com/heptio/sonobuoy/pkg/plugin/manifest"
 	v1 "k8s.io/api/core/v1"
@@ -31,7 +32,8 @@ import (
 type Interface interface {
 	// Run runs a plugin, declaring all resources it needs, and then
 	// returns.  It does not block and wait until the plugin has finished.
-	Run(kubeClient kubernetes.Interface, hostname string, cert *tls.Certificate) error
+	// The plugin's workers must submit results with the given token.
+	Run(kubeClient kubernetes.Interface, hostname string, cert *tls.Certificate, token string) error
 	// Cleanup cleans up all resources created by the plugin
 	Cleanup(kubeClient kubernetes.Interface)
 	// Monitor continually checks for problems in the resources created by a
@@ -49,14 +51,128 @@ type Interface interface {
 	GetResultType() string
 	// GetName returns the name of this plugin
 	GetName() string
+	// GetSessionID returns the ID of this run of the plugin, which every
+	// resource it creates is labelled with as sonobuoy-run.
+	GetSessionID() string
+	// GetTimeoutSeconds returns how long this plugin has to submit its
+	// results, or zero if it has no timeout of its own.
+	GetTimeoutSeconds() int
+	// GetDependsOn returns the names of the plugins that must succeed
+	// before this one is run.
+	GetDependsOn() []string
+	// GetResultProcessors returns the names of the processors run on each
+	// of this plugin's results once they've arrived.
+	GetResultProcessors() []string
+	// GetResultFormat returns the name of the format this plugin's results
+	// must be valid in, if any.
+	GetResultFormat() string
+	// StoresResults returns whether the plugin's workers store their
+	// results in a volume for the aggregator to fetch, because they can't
+	// submit them to it.
+	StoresResults() bool
+	// FetchPod returns a pod that mounts the volume the plugin's workers
+	// store their results in, for the aggregator to fetch the given result
+	// from. It's only used for plugins that store their results.
+	FetchPod(kubeClient kubernetes.Interface, result ExpectedResult) (*v1.Pod, error)
+	// GetFiles returns the files the plugin's workers download before it
+	// starts, keyed by name.
+	GetFiles() map[string]string
 }
 
 // Definition defines a plugin's features, method of launch, and other
 // metadata about it.
 type Definition struct {
-	Name       string
-	ResultType string
-	Spec       manifest.Container
+	Name               string
+	ResultType         string
+	ResultsStream      string
+	ResultsCompression string
+	ResultsProtocol    string
+	TimeoutSeconds     int
+	Retries            int
+	Replicas           int
+	DurationSeconds    int
+	DependsOn          []string
+	ImagePullSecrets   []string
+	Spec               manifest.Container
+	ExtraVolumes       []v1.Volume
+	Sidecars           []v1.Container
+	NodeSelector       map[string]string
+	Tolerations        []v1.Toleration
+	Affinity           *v1.Affinity
+	OperatingSystems   []string
+	Images             map[string]string
+	ResultsHostPath    string
+	ResultsClaimName   string
+	ResultProcessors   []string
+	ResultFormat       string
+	// ServiceAccountToken is set if the plugin's worker keeps a service
+	// account token and kubeconfig for it.
+	ServiceAccountToken *manifest.ServiceAccountToken
+	// RBAC is set if the plugin's pods run as a service account of their
+	// own, granted only these rules.
+	RBAC              *manifest.RBAC
+	WorkerResources   v1.ResourceRequirements
+	PriorityClassName string
+	TracingEndpoint   string
+	TraceParent       string
+	Proxy             ProxyConfig
+	CABundle          string
+	// Labels and Annotations are set on every object created for the
+	// plugin, merging those of the Sonobuoy config and the plugin's own.
+	Labels      map[string]string
+	Annotations map[string]string
+	// SecurityContextMode is which security contexts the plugin's pods are
+	// given, one of the SecurityContext modes. Empty means none.
+	SecurityContextMode string
+	// Files are downloaded from the aggregator to PayloadPath in the
+	// plugin's container before it starts, keyed by name.
+	Files map[string]string
+	// ExternalResults is set if the plugin's workers also POST their
+	// results to an external endpoint.
+	ExternalResults *manifest.ExternalResults
+	// ResultsTransport is set if the plugin's workers deliver their
+	// results with a command of their own instead of submitting them.
+	ResultsTransport *manifest.ResultsTransport
+	// SubmitRetry is set if the plugin's workers retry submitting results
+	// other than by default.
+	SubmitRetry *manifest.SubmitRetry
+}
+
+// ProxyConfig is the HTTP(S) proxy workers reach the aggregator and other
+// endpoints through, set in their environment as HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY.
+type ProxyConfig struct {
+	HTTPProxy  string `json:"HTTPProxy,omitempty" mapstructure:"HTTPProxy"`
+	HTTPSProxy string `json:"HTTPSProxy,omitempty" mapstructure:"HTTPSProxy"`
+	// NoProxy lists the hosts, domains and CIDRs that are reached directly,
+	// which usually needs to include the aggregator's.
+	NoProxy string `json:"NoProxy,omitempty" mapstructure:"NoProxy"`
+}
+
+// PodConfig is set on the pods of every plugin by the Sonobuoy config, rather
+// than by each plugin's definition.
+type PodConfig struct {
+	// WorkerResources are the resource requests and limits of the worker
+	// container Sonobuoy adds to plugin pods.
+	WorkerResources v1.ResourceRequirements
+	// PriorityClassName is the priority class of plugin pods.
+	PriorityClassName string
+	// TracingEndpoint is where workers export their trace spans, and
+	// TraceParent is the traceparent of the run's span they're part of.
+	// Workers aren't traced if TracingEndpoint is empty.
+	TracingEndpoint string
+	TraceParent     string
+	// Proxy is the proxy workers send results and traces through, and
+	// CABundle PEM encoded certificates they trust besides the aggregator's,
+	// such as those of a TLS-intercepting proxy.
+	Proxy    ProxyConfig
+	CABundle string
+	// Labels and Annotations are set on every object created for plugins,
+	// along with those of each plugin.
+	Labels      map[string]string
+	Annotations map[string]string
+	// SecurityContextMode is which security contexts plugin pods are given.
+	SecurityContextMode string
 }
 
 // ExpectedResult is an expected result that a plugin will submit.  This is so
@@ -75,19 +191,79 @@ type Result struct {
 	MimeType   string
 	Body       io.Reader
 	Error      string
+	// Filename is set when a result is made up of several files, and is
+	// the name the file is stored under within the result's directory.
+	Filename string
+	// Partial marks a file of a multi-file result other than the last one,
+	// so it doesn't complete the result on its own.
+	Partial bool
+	// Verify, if set, checks the integrity of Body. It must only be called
+	// once Body has been handled.
+	Verify func() error
+	// Checksum, if set, returns the hex-encoded SHA256 of Body. Like Verify,
+	// it must only be called once Body has been handled.
+	Checksum func() string
+	// TimedOut marks an error result for a plugin that didn't finish in
+	// time.
+	TimedOut bool
+	// TraceParent is the traceparent of the span the result was submitted
+	// in, if the worker was traced.
+	TraceParent string
+	// Incomplete marks whatever results a plugin had when the run was about
+	// to time out, which the master asked its worker for. They're stored
+	// like any others, but the plugin didn't finish.
+	Incomplete bool
+	// FailureReason is why the result failed, if it's known to be one of
+	// the Failure reasons rather than the plugin reporting an error itself.
+	FailureReason string
+	// WorkerVersion is the version of Sonobuoy the worker that submitted
+	// the result was built from, if it said.
+	WorkerVersion string
 }
 
+// Reasons a result can fail for other than the plugin reporting an error, so
+// that problems with the cluster or Sonobuoy can be told apart from failed
+// tests.
+const (
+	// FailureImagePullBackOff means an image of the plugin's pod couldn't be
+	// pulled.
+	FailureImagePullBackOff = "ImagePullBackOff"
+	// FailureOOMKilled means a container of the plugin's pod ran out of
+	// memory.
+	FailureOOMKilled = "OOMKilled"
+	// FailureCrashLoop means a container of the plugin's pod kept
+	// restarting.
+	FailureCrashLoop = "CrashLoop"
+	// FailureEvicted means the plugin's pod was evicted from its node.
+	FailureEvicted = "Evicted"
+	// FailureUnschedulable means the plugin's pod couldn't be scheduled.
+	FailureUnschedulable = "Unschedulable"
+	// FailureTimeout means the plugin didn't finish in time.
+	FailureTimeout = "Timeout"
+	// FailureUploadFailed means the plugin's results couldn't be submitted
+	// or stored.
+	FailureUploadFailed = "UploadFailed"
+	// FailureInvalidResult means the plugin's results weren't valid in the
+	// format it declared, so they were rejected.
+	FailureInvalidResult = "InvalidResult"
+	// FailureVersionMismatch means the plugin's worker was built from a
+	// different version of Sonobuoy than the aggregator, so its results were
+	// refused.
+	FailureVersionMismatch = "VersionMismatch"
+)
+
 // IsSuccess returns whether the Result represents a successful plugin result,
 // versus one that was unsuccessful (for instance, from a dispatched plugin not
-// being able to launch.)
+// being able to launch, or not finishing before the run timed out.)
 func (r *Result) IsSuccess() bool {
-	return r.Error == ""
+	return r.Error == "" && !r.Incomplete
 }
 
 // Path is the path within the "plugins" section of the results tarball where
-// this Result should be stored, not including a file extension.
+// this Result should be stored, not including a file extension. Incomplete
+// results are stored with the results, since they aren't errors.
 func (r *Result) Path() string {
-	if !r.IsSuccess() {
+	if r.Error != "" {
 		return path.Join(r.ResultType, "errors", r.NodeName)
 	}
 
@@ -101,10 +277,62 @@ type Selection struct {
 
 // AggregationConfig are the config settings for the server that aggregates plugin results
 type AggregationConfig struct {
-	BindAddress      string `json:"bindaddress"`
-	BindPort         int    `json:"bindport"`
+	BindAddress string `json:"bindaddress"`
+	BindPort    int    `json:"bindport"`
+	// AdvertiseAddress is the host or IP, and port, workers reach the
+	// aggregator at. IPv6 literals are bracketed, as in [fd00::1]:8080.
+	// Empty means the IP of the aggregator's pod.
 	AdvertiseAddress string `json:"advertiseaddress"`
-	TimeoutSeconds   int    `json:"timeoutseconds"`
+	// AdvertiseService is the name of a Service in the aggregator's
+	// namespace that workers reach it through, by its DNS name, if
+	// AdvertiseAddress isn't set. Plugins aren't launched until it has a
+	// ready endpoint.
+	AdvertiseService string `json:"advertiseservice,omitempty"`
+	// AddressFamily is which of a dual-stack pod's IPs is advertised, and
+	// which wildcard address is bound if BindAddress is 0.0.0.0: IPv4 or
+	// IPv6. Empty means the pod's primary IP.
+	AddressFamily  string `json:"addressfamily,omitempty"`
+	TimeoutSeconds int    `json:"timeoutseconds"`
+	// MaxResultBytes limits how much each plugin can upload in total, across
+	// all of its results. Zero means there is no limit.
+	MaxResultBytes int64 `json:"maxresultbytes,omitempty"`
+	// MaxTotalResultBytes limits how much all plugins together can upload.
+	// Zero means there is no limit.
+	MaxTotalResultBytes int64 `json:"maxtotalresultbytes,omitempty"`
+	// MinFreeBytes is how much space must be left in the aggregator's results
+	// volume for it to accept results. While there's less, workers are told
+	// to send their results again later, rather than the volume filling up
+	// partway through one. Zero means results are accepted until it's full.
+	MinFreeBytes int64 `json:"minfreebytes,omitempty"`
+	// AllowMixedVersions accepts results from workers built from a
+	// different version of Sonobuoy than the aggregator. They fail by
+	// default, since the two may not agree on how results are submitted.
+	AllowMixedVersions bool `json:"allowmixedversions,omitempty"`
+	// MetricsPort is the port Prometheus metrics are served on at /metrics,
+	// and the run's events at /api/v1/events. They're served over plain
+	// HTTP, since scrapers don't have the client certificates plugins use.
+	// Zero means neither is served.
+	MetricsPort int `json:"metricsport,omitempty"`
+	// UIPort is the port a web dashboard of the run is served on. It only
+	// listens on the pod's loopback interface, so it can only be reached with
+	// kubectl port-forward, by those the cluster allows to. Zero means the
+	// dashboard isn't served.
+	UIPort int `json:"uiport,omitempty"`
+	// Resumable keeps the state of the run in a Secret, so that if the
+	// aggregator is restarted it carries on waiting for the outstanding
+	// results instead of starting over.
+	Resumable bool `json:"resumable,omitempty"`
+	// TLSCertDir is a directory holding the aggregator's serving
+	// certificate and key as tls.crt and tls.key, such as a mounted
+	// cert-manager Secret, which are reloaded when they change. Workers
+	// also trust its ca.crt, if it has one. Empty means the aggregator
+	// issues its own serving certificate.
+	TLSCertDir string `json:"tlscertdir,omitempty"`
+	// Labels and Annotations are set on the objects the aggregator creates
+	// for itself. They're set from those of the Sonobuoy config when it's
+	// loaded.
+	Labels      map[string]string `json:"-" mapstructure:"-"`
+	Annotations map[string]string `json:"-" mapstructure:"-"`
 }
 
 // WorkerConfig is the file given to the sonobuoy worker to configure it to phone home.
@@ -118,9 +346,71 @@ type WorkerConfig struct {
 	// ResultType is the type of result (to be put in the HTTP URL's path) to be
 	// sent back to sonobuoy.
 	ResultType string `json:"resulttype,omitempty" mapstructure:"resulttype"`
-	CACert     string `json:"cacert,omitempty" mapstructure:"cacert"`
-	ClientCert string `json:"clientcert,omitempty" mapstructure:"clientcert"`
-	ClientKey  string `json:"clientkey,omitempty" mapstructure:"clientkey"`
+	// ResultsStream is an optional file or directory that should be streamed
+	// to the master while it is still being written, rather than waiting for
+	// the done file.
+	ResultsStream string `json:"resultsstream,omitempty" mapstructure:"resultsstream"`
+	// ResultsCompression is how results should be compressed before they are
+	// sent to the master, if at all.
+	ResultsCompression string `json:"resultscompression,omitempty" mapstructure:"resultscompression"`
+	// ResultsProtocol is how results and progress are submitted to the
+	// master: over gRPC, or plain HTTP if empty.
+	ResultsProtocol string `json:"resultsprotocol,omitempty" mapstructure:"resultsprotocol"`
+	// TimeoutSeconds is how long the plugin has to write the done file before
+	// the worker gives up on it and reports a timeout instead.
+	TimeoutSeconds int `json:"timeoutseconds,omitempty" mapstructure:"timeoutseconds"`
+	// ReplicaName is set for plugins run by the Deployment driver, whose
+	// replicas all report to the same global result under their own names.
+	ReplicaName string `json:"replicaname,omitempty" mapstructure:"replicaname"`
+	// LocalResultsDir is set for plugins whose workers can't reach the
+	// master. Results are stored under it, for the master to fetch,
+	// instead of being submitted.
+	LocalResultsDir string `json:"localresultsdir,omitempty" mapstructure:"localresultsdir"`
+	// ResultsToken is the token the master issued to the plugin, which
+	// results must be submitted with.
+	ResultsToken string `json:"resultstoken,omitempty" mapstructure:"resultstoken"`
+	// ExternalResultsURL is an endpoint results are POSTed to as well as
+	// submitted to the master, with ExternalResultsAuthorization as their
+	// Authorization header if it's set.
+	ExternalResultsURL           string `json:"externalresultsurl,omitempty" mapstructure:"externalresultsurl"`
+	ExternalResultsAuthorization string `json:"externalresultsauthorization,omitempty" mapstructure:"externalresultsauthorization"`
+	// ResultsTransport is a JSON array of the command results are delivered
+	// with in place of submitting them to the master, if they are.
+	ResultsTransport string `json:"resultstransport,omitempty" mapstructure:"resultstransport"`
+	// RetryAttempts is how many times submitting results is attempted before
+	// giving up.
+	RetryAttempts int `json:"retryattempts,omitempty" mapstructure:"retryattempts"`
+	// RetryMaxElapsedTime bounds the total time spent retrying submissions.
+	RetryMaxElapsedTime time.Duration `json:"retrymaxelapsedtime,omitempty" mapstructure:"retrymaxelapsedtime"`
+	// RetryJitter is the fraction by which each wait between retries is
+	// randomized.
+	RetryJitter float64 `json:"retryjitter,omitempty" mapstructure:"retryjitter"`
+	CACert      string  `json:"cacert,omitempty" mapstructure:"cacert"`
+	ClientCert  string  `json:"clientcert,omitempty" mapstructure:"clientcert"`
+	ClientKey   string  `json:"clientkey,omitempty" mapstructure:"clientkey"`
+	// CABundle is PEM encoded certificates the worker trusts besides CACert
+	// and the system's, such as those of a TLS-intercepting proxy.
+	CABundle string `json:"cabundle,omitempty" mapstructure:"cabundle"`
+	// TracingEndpoint is the OTLP/HTTP collector the worker exports trace
+	// spans to, if any, and TraceParent the span of the run they're part of.
+	TracingEndpoint string `json:"tracingendpoint,omitempty" mapstructure:"tracingendpoint"`
+	TraceParent     string `json:"traceparent,omitempty" mapstructure:"traceparent"`
+	// TokenDir is set for plugins the worker keeps a service account token
+	// for. The token and a kubeconfig using it are written there, and the
+	// token is requested for TokenAudience, to expire after
+	// TokenExpirationSeconds, bound to the pod named PodName with PodUID.
+	TokenDir               string `json:"tokendir,omitempty" mapstructure:"tokendir"`
+	TokenAudience          string `json:"tokenaudience,omitempty" mapstructure:"tokenaudience"`
+	TokenExpirationSeconds int64  `json:"tokenexpirationseconds,omitempty" mapstructure:"tokenexpirationseconds"`
+	PodName                string `json:"podname,omitempty" mapstructure:"podname"`
+	PodUID                 string `json:"poduid,omitempty" mapstructure:"poduid"`
+	// Namespace and ServiceAccountName are the namespace and service account
+	// of the worker's pod.
+	Namespace          string `json:"namespace,omitempty" mapstructure:"namespace"`
+	ServiceAccountName string `json:"serviceaccountname,omitempty" mapstructure:"serviceaccountname"`
+	// PayloadDir is set for plugins with files, which the worker downloads
+	// there from the master before the plugin starts.
+	PayloadDir string `json:"payloaddir,omitempty" mapstructure:"payloaddir"`
 }
 
 // ID returns a unique identifier for this expected result to distinguish it
@@ -19,16 +19,21 @@ package loader
 import (
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/heptio/sonobuoy/pkg/plugin"
 	"github.com/heptio/sonobuoy/pkg/plugin/driver/daemonset"
+	"github.com/heptio/sonobuoy/pkg/plugin/driver/deployment"
 	"github.com/heptio/sonobuoy/pkg/plugin/driver/job"
 	"github.com/heptio/sonobuoy/pkg/plugin/manifest"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	rbacv1 "k8s.io/api/rbac/v1"
 	kuberuntime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -36,7 +41,7 @@ import (
 // directory, taking a user's plugin selections, and a sonobuoy phone home
 // address (host:port) and returning all of the active, configured plugins for
 // this sonobuoy run.
-func LoadAllPlugins(namespace, sonobuoyImage, imagePullPolicy string, searchPath []string, selections []plugin.Selection) (ret []plugin.Interface, err error) {
+func LoadAllPlugins(namespace, sonobuoyImage, imagePullPolicy string, imagePullSecrets, searchPath []string, selections []plugin.Selection, podCfg plugin.PodConfig) (ret []plugin.Interface, err error) {
 	pluginDefinitionFiles := []string{}
 	for _, dir := range searchPath {
 		wd, _ := os.Getwd()
@@ -62,7 +67,7 @@ func LoadAllPlugins(namespace, sonobuoyImage, imagePullPolicy string, searchPath
 		if err != nil {
 			return []plugin.Interface{}, errors.Wrapf(err, "couldn't load plugin definition file %v", file)
 		}
-		pluginDefinition, err := loadDefinition(definitionFile)
+		pluginDefinition, err := LoadDefinition(definitionFile)
 		if err != nil {
 			return []plugin.Interface{}, errors.Wrapf(err, "couldn't load plugin definition for file %v", file)
 		}
@@ -74,16 +79,118 @@ func LoadAllPlugins(namespace, sonobuoyImage, imagePullPolicy string, searchPath
 
 	plugins := []plugin.Interface{}
 	for _, def := range pluginDefinitions {
-		loadedPlugin, err := loadPlugin(def, namespace, sonobuoyImage, imagePullPolicy)
+		loadedPlugin, err := loadPlugin(def, namespace, sonobuoyImage, imagePullPolicy, imagePullSecrets, podCfg)
 		if err != nil {
 			return nil, errors.Wrapf(err, "couldn't load plugin %v", def.SonobuoyConfig.PluginName)
 		}
 		plugins = append(plugins, loadedPlugin)
 	}
 
+	if err := validateDependencies(plugins); err != nil {
+		return nil, err
+	}
+
 	return plugins, nil
 }
 
+// needsClusterRules returns whether the plugin declares rules it needs granted
+// cluster-wide.
+func needsClusterRules(p plugin.Interface) bool {
+	b, ok := p.(interface{ GetRBAC() *manifest.RBAC })
+	return ok && b.GetRBAC() != nil && len(b.GetRBAC().ClusterRules) > 0
+}
+
+// NamespaceScopedPlugins returns the plugins that can be run without
+// cluster-wide permissions. DaemonSet plugins need to run on every node, so
+// they're skipped, along with plugins that need rules granted cluster-wide and
+// any plugins that depend on a skipped plugin.
+func NamespaceScopedPlugins(plugins []plugin.Interface) []plugin.Interface {
+	skipped := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, p := range plugins {
+			if skipped[p.GetName()] {
+				continue
+			}
+			reason := ""
+			if _, ok := p.(*daemonset.Plugin); ok {
+				reason = "DaemonSet plugins can't be run in a namespace-scoped run"
+			}
+			if needsClusterRules(p) {
+				reason = "it needs cluster-wide permissions"
+			}
+			for _, dep := range p.GetDependsOn() {
+				if skipped[dep] {
+					reason = fmt.Sprintf("it depends on plugin %v, which isn't being run", dep)
+				}
+			}
+			if reason != "" {
+				logrus.WithField("plugin", p.GetName()).Warningf("Skipping plugin: %v", reason)
+				skipped[p.GetName()] = true
+				changed = true
+			}
+		}
+	}
+
+	ret := []plugin.Interface{}
+	for _, p := range plugins {
+		if !skipped[p.GetName()] {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
+
+// validateDependencies makes sure every plugin that's depended on is being
+// run, and that no plugins depend on each other in a cycle, either of which
+// would leave plugins waiting forever.
+func validateDependencies(plugins []plugin.Interface) error {
+	byName := make(map[string]plugin.Interface, len(plugins))
+	for _, p := range plugins {
+		byName[p.GetName()] = p
+	}
+
+	for _, p := range plugins {
+		for _, dep := range p.GetDependsOn() {
+			if _, ok := byName[dep]; !ok {
+				return fmt.Errorf("plugin %v depends on plugin %v, which isn't being run", p.GetName(), dep)
+			}
+		}
+	}
+
+	// Depth-first search, where a plugin that's seen again while it's still
+	// being visited is part of a cycle.
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(plugins))
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("plugins depend on each other in a cycle: %v", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, dep := range byName[name].GetDependsOn() {
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+
+	for _, p := range plugins {
+		if err := visit(p.GetName(), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func findPlugins(dir string) ([]string, error) {
 	candidates, err := ioutil.ReadDir(dir)
 	if err != nil {
@@ -108,17 +215,178 @@ func loadDefinitionFromFile(file string) ([]byte, error) {
 	return bytes, errors.Wrapf(err, "couldn't open plugin definition %v", file)
 }
 
-func loadDefinition(bytes []byte) (*manifest.Manifest, error) {
+// LoadDefinition decodes a plugin definition.
+func LoadDefinition(bytes []byte) (*manifest.Manifest, error) {
 	var def manifest.Manifest
 	err := kuberuntime.DecodeInto(manifest.Decoder, bytes, &def)
 	return &def, errors.Wrap(err, "couldn't decode yaml for plugin definition")
 }
 
-func loadPlugin(def *manifest.Manifest, namespace, sonobuoyImage, imagePullPolicy string) (plugin.Interface, error) {
+func loadPlugin(def *manifest.Manifest, namespace, sonobuoyImage, imagePullPolicy string, imagePullSecrets []string, podCfg plugin.PodConfig) (plugin.Interface, error) {
 	pluginDef := plugin.Definition{
-		Name:       def.SonobuoyConfig.PluginName,
-		ResultType: def.SonobuoyConfig.ResultType,
-		Spec:       def.Spec,
+		Name:                def.SonobuoyConfig.PluginName,
+		ResultType:          def.SonobuoyConfig.ResultType,
+		ResultsStream:       def.SonobuoyConfig.ResultsStream,
+		ResultsCompression:  def.SonobuoyConfig.ResultsCompression,
+		ResultsProtocol:     def.SonobuoyConfig.ResultsProtocol,
+		TimeoutSeconds:      def.SonobuoyConfig.TimeoutSeconds,
+		Retries:             def.SonobuoyConfig.Retries,
+		Replicas:            def.SonobuoyConfig.Replicas,
+		DurationSeconds:     def.SonobuoyConfig.DurationSeconds,
+		DependsOn:           def.SonobuoyConfig.DependsOn,
+		ImagePullSecrets:    mergeImagePullSecrets(def.SonobuoyConfig.ImagePullSecrets, imagePullSecrets),
+		Spec:                def.Spec,
+		ExtraVolumes:        def.ExtraVolumes,
+		Sidecars:            def.Sidecars,
+		NodeSelector:        def.NodeSelector,
+		Tolerations:         def.Tolerations,
+		Affinity:            def.Affinity,
+		OperatingSystems:    def.SonobuoyConfig.OperatingSystems,
+		Images:              def.SonobuoyConfig.Images,
+		ResultsHostPath:     def.SonobuoyConfig.ResultsHostPath,
+		ResultsClaimName:    def.SonobuoyConfig.ResultsClaimName,
+		ResultProcessors:    def.SonobuoyConfig.ResultProcessors,
+		ResultFormat:        def.SonobuoyConfig.ResultFormat,
+		ServiceAccountToken: def.SonobuoyConfig.ServiceAccountToken,
+		RBAC:                def.SonobuoyConfig.RBAC,
+		WorkerResources:     podCfg.WorkerResources,
+		PriorityClassName:   podCfg.PriorityClassName,
+		TracingEndpoint:     podCfg.TracingEndpoint,
+		TraceParent:         podCfg.TraceParent,
+		Proxy:               podCfg.Proxy,
+		CABundle:            podCfg.CABundle,
+		Labels:              plugin.MergeMetadata(podCfg.Labels, def.Labels),
+		Annotations:         plugin.MergeMetadata(podCfg.Annotations, def.Annotations),
+		SecurityContextMode: podCfg.SecurityContextMode,
+		Files:               def.Files,
+		ExternalResults:     def.SonobuoyConfig.ExternalResults,
+		ResultsTransport:    def.SonobuoyConfig.ResultsTransport,
+		SubmitRetry:         def.SonobuoyConfig.SubmitRetry,
+	}
+
+	if err := plugin.ValidateMetadata(def.Labels, def.Annotations); err != nil {
+		return nil, fmt.Errorf("plugin %v has invalid labels or annotations: %v", def.SonobuoyConfig.PluginName, err)
+	}
+
+	if def.SonobuoyConfig.Retries < 0 {
+		return nil, fmt.Errorf("plugin %v has negative retries", def.SonobuoyConfig.PluginName)
+	}
+	if def.SonobuoyConfig.Retries > 0 && def.SonobuoyConfig.Driver == "Deployment" {
+		return nil, fmt.Errorf("plugin %v sets retries, which the Deployment driver doesn't support",
+			def.SonobuoyConfig.PluginName)
+	}
+
+	if len(def.SonobuoyConfig.OperatingSystems) > 0 && def.SonobuoyConfig.Driver != "DaemonSet" {
+		return nil, fmt.Errorf("plugin %v sets operating-systems, which only the DaemonSet driver supports",
+			def.SonobuoyConfig.PluginName)
+	}
+	for _, nodeOS := range def.SonobuoyConfig.OperatingSystems {
+		if !daemonset.SupportedOS(nodeOS) {
+			return nil, fmt.Errorf("plugin %v has unsupported operating system %q", def.SonobuoyConfig.PluginName, nodeOS)
+		}
+	}
+
+	for _, volume := range def.ExtraVolumes {
+		if reservedVolumes[volume.Name] {
+			return nil, fmt.Errorf("plugin %v has an extra volume named %v, which is reserved for Sonobuoy",
+				def.SonobuoyConfig.PluginName, volume.Name)
+		}
+	}
+
+	for name := range def.Files {
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return nil, fmt.Errorf("plugin %v has a file named %q, which isn't a file name",
+				def.SonobuoyConfig.PluginName, name)
+		}
+	}
+	for _, nodeOS := range def.SonobuoyConfig.OperatingSystems {
+		if len(def.Files) > 0 && nodeOS == daemonset.WindowsOS {
+			return nil, fmt.Errorf("plugin %v has files, which can't be downloaded on Windows nodes",
+				def.SonobuoyConfig.PluginName)
+		}
+	}
+
+	containers := map[string]bool{def.Spec.Name: true, workerContainerName: true}
+	for _, sidecar := range def.Sidecars {
+		if sidecar.Name == "" || containers[sidecar.Name] {
+			return nil, fmt.Errorf("plugin %v has a sidecar with a missing or duplicate name %q",
+				def.SonobuoyConfig.PluginName, sidecar.Name)
+		}
+		containers[sidecar.Name] = true
+	}
+
+	if err := validateLocalResults(def); err != nil {
+		return nil, err
+	}
+
+	// Restricted pods can't use the host's namespaces, as the DaemonSet
+	// driver does, or mount its directories.
+	if podCfg.SecurityContextMode == plugin.SecurityContextRestricted {
+		if def.SonobuoyConfig.Driver == "DaemonSet" {
+			return nil, fmt.Errorf("plugin %v uses the DaemonSet driver, which needs the host and can't run with the restricted security context",
+				def.SonobuoyConfig.PluginName)
+		}
+		if def.SonobuoyConfig.ResultsHostPath != "" {
+			return nil, fmt.Errorf("plugin %v sets results-host-path, which can't be mounted with the restricted security context",
+				def.SonobuoyConfig.PluginName)
+		}
+	}
+
+	if retry := def.SonobuoyConfig.SubmitRetry; retry != nil {
+		if retry.Attempts < 0 || retry.MaxElapsedSeconds < 0 {
+			return nil, fmt.Errorf("plugin %v has a negative submit-retry attempts or max-elapsed-seconds",
+				def.SonobuoyConfig.PluginName)
+		}
+		if retry.Jitter < 0 || retry.Jitter >= 1 {
+			return nil, fmt.Errorf("plugin %v has a submit-retry jitter of %v, which must be at least 0 and less than 1",
+				def.SonobuoyConfig.PluginName, retry.Jitter)
+		}
+	}
+
+	if token := def.SonobuoyConfig.ServiceAccountToken; token != nil {
+		if def.SonobuoyConfig.Driver != "Job" {
+			return nil, fmt.Errorf("plugin %v sets service-account-token, which only the Job driver supports",
+				def.SonobuoyConfig.PluginName)
+		}
+		if token.ExpirationSeconds != 0 && token.ExpirationSeconds < plugin.MinTokenExpirationSeconds {
+			return nil, fmt.Errorf("plugin %v has a service-account-token expiration-seconds of %v, less than the minimum of %v",
+				def.SonobuoyConfig.PluginName, token.ExpirationSeconds, plugin.MinTokenExpirationSeconds)
+		}
+	}
+
+	if rbac := def.SonobuoyConfig.RBAC; rbac != nil {
+		for _, rule := range append(append([]rbacv1.PolicyRule{}, rbac.Rules...), rbac.ClusterRules...) {
+			if len(rule.Verbs) == 0 {
+				return nil, fmt.Errorf("plugin %v has an rbac rule without any verbs", def.SonobuoyConfig.PluginName)
+			}
+		}
+		for _, rule := range rbac.Rules {
+			if len(rule.NonResourceURLs) > 0 {
+				return nil, fmt.Errorf("plugin %v has an rbac rule with nonResourceURLs, which are only allowed in cluster-rules",
+					def.SonobuoyConfig.PluginName)
+			}
+		}
+	}
+
+	switch def.SonobuoyConfig.ResultsCompression {
+	case "", plugin.GzipCompression:
+	default:
+		return nil, fmt.Errorf("unknown results-compression %q for plugin %v",
+			def.SonobuoyConfig.ResultsCompression, def.SonobuoyConfig.PluginName)
+	}
+
+	switch def.SonobuoyConfig.ResultsProtocol {
+	case "", plugin.GRPCProtocol:
+	default:
+		return nil, fmt.Errorf("unknown results-protocol %q for plugin %v",
+			def.SonobuoyConfig.ResultsProtocol, def.SonobuoyConfig.PluginName)
+	}
+
+	if err := validateExternalResults(def); err != nil {
+		return nil, err
+	}
+	if err := validateResultsTransport(def); err != nil {
+		return nil, err
 	}
 
 	switch def.SonobuoyConfig.Driver {
@@ -126,12 +394,122 @@ func loadPlugin(def *manifest.Manifest, namespace, sonobuoyImage, imagePullPolic
 		return job.NewPlugin(pluginDef, namespace, sonobuoyImage, imagePullPolicy), nil
 	case "DaemonSet":
 		return daemonset.NewPlugin(pluginDef, namespace, sonobuoyImage, imagePullPolicy), nil
+	case "Deployment":
+		if pluginDef.DurationSeconds <= 0 {
+			return nil, fmt.Errorf("plugin %v uses the Deployment driver but has no duration-seconds",
+				def.SonobuoyConfig.PluginName)
+		}
+		return deployment.NewPlugin(pluginDef, namespace, sonobuoyImage, imagePullPolicy), nil
 	default:
 		return nil, fmt.Errorf("unknown driver %q for plugin %v",
 			def.SonobuoyConfig.Driver, def.SonobuoyConfig.PluginName)
 	}
 }
 
+// validateLocalResults checks that a plugin whose workers store their results
+// for the aggregator to fetch can have them fetched.
+func validateLocalResults(def *manifest.Manifest) error {
+	cfg := def.SonobuoyConfig
+	if cfg.ResultsHostPath == "" && cfg.ResultsClaimName == "" {
+		return nil
+	}
+
+	switch {
+	case cfg.ResultsHostPath != "" && cfg.ResultsClaimName != "":
+		return fmt.Errorf("plugin %v sets both results-host-path and results-claim-name", cfg.PluginName)
+	case cfg.ResultsHostPath != "" && !path.IsAbs(cfg.ResultsHostPath):
+		return fmt.Errorf("plugin %v has a results-host-path that isn't absolute: %v", cfg.PluginName, cfg.ResultsHostPath)
+	case cfg.Driver == "Deployment":
+		return fmt.Errorf("plugin %v uses the Deployment driver, whose results can't be stored for fetching", cfg.PluginName)
+	case cfg.ResultsStream != "":
+		return fmt.Errorf("plugin %v can't stream results that are stored for fetching", cfg.PluginName)
+	}
+	for _, nodeOS := range cfg.OperatingSystems {
+		if nodeOS != daemonset.LinuxOS {
+			return fmt.Errorf("plugin %v stores results for fetching, which is only supported on Linux nodes", cfg.PluginName)
+		}
+	}
+	return nil
+}
+
+// validateExternalResults checks that a plugin whose workers also send their
+// results to an external endpoint can.
+func validateExternalResults(def *manifest.Manifest) error {
+	cfg := def.SonobuoyConfig
+	if cfg.ExternalResults == nil {
+		return nil
+	}
+
+	u, err := url.Parse(cfg.ExternalResults.URL)
+	switch {
+	case err != nil || u.Host == "":
+		return fmt.Errorf("plugin %v has an invalid external-results url: %q", cfg.PluginName, cfg.ExternalResults.URL)
+	case u.Scheme != "https":
+		return fmt.Errorf("plugin %v has an external-results url that isn't HTTPS: %v", cfg.PluginName, cfg.ExternalResults.URL)
+	case cfg.ExternalResults.AuthSecretKey != "" && cfg.ExternalResults.AuthSecret == "":
+		return fmt.Errorf("plugin %v sets an external-results auth-secret-key without an auth-secret", cfg.PluginName)
+	case cfg.ResultsHostPath != "" || cfg.ResultsClaimName != "":
+		return fmt.Errorf("plugin %v stores results for fetching, so they can't be sent to external-results", cfg.PluginName)
+	}
+	return nil
+}
+
+// validateResultsTransport checks that a plugin whose workers deliver their
+// results with a command of their own can, and that the aggregator only
+// expects a receipt of them.
+func validateResultsTransport(def *manifest.Manifest) error {
+	cfg := def.SonobuoyConfig
+	if cfg.ResultsTransport == nil {
+		return nil
+	}
+
+	command := cfg.ResultsTransport.Command
+	switch {
+	case len(command) == 0:
+		return fmt.Errorf("plugin %v has a results-transport without a command", cfg.PluginName)
+	case !path.IsAbs(command[0]):
+		return fmt.Errorf("plugin %v has a results-transport command that isn't an absolute path: %v", cfg.PluginName, command[0])
+	case cfg.Driver == "Deployment":
+		return fmt.Errorf("plugin %v uses the Deployment driver, whose results can't be delivered by a results-transport", cfg.PluginName)
+	case cfg.ResultsStream != "":
+		return fmt.Errorf("plugin %v can't stream results that are delivered by a results-transport", cfg.PluginName)
+	case cfg.ResultsHostPath != "" || cfg.ResultsClaimName != "":
+		return fmt.Errorf("plugin %v stores results for fetching, so they can't be delivered by a results-transport", cfg.PluginName)
+	case cfg.ExternalResults != nil:
+		return fmt.Errorf("plugin %v delivers results by a results-transport, so they can't be sent to external-results", cfg.PluginName)
+	case cfg.ResultFormat != "" || len(cfg.ResultProcessors) > 0:
+		return fmt.Errorf("plugin %v delivers results by a results-transport, so the aggregator can't check or process them", cfg.PluginName)
+	}
+	return nil
+}
+
+// reservedVolumes are the names of the volumes the drivers add to plugin pods.
+var reservedVolumes = map[string]bool{
+	"results":                        true,
+	"root":                           true,
+	plugin.LocalResultsVolume:        true,
+	plugin.ServiceAccountTokenVolume: true,
+	plugin.PayloadVolume:             true,
+}
+
+// workerContainerName is the name of the container the drivers add to plugin
+// pods to submit results.
+const workerContainerName = "sonobuoy-worker"
+
+// mergeImagePullSecrets combines a plugin's own image pull secrets with those
+// for every plugin, without repeating any.
+func mergeImagePullSecrets(pluginSecrets, globalSecrets []string) []string {
+	var merged []string
+	seen := map[string]bool{}
+	for _, secret := range append(append([]string(nil), pluginSecrets...), globalSecrets...) {
+		if !seen[secret] {
+			seen[secret] = true
+			merged = append(merged, secret)
+		}
+	}
+	return merged
+}
+
 func filterPluginDef(defs []*manifest.Manifest, selections []plugin.Selection) []*manifest.Manifest {
 	m := make(map[string]bool)
 	for _, selection := range selections {
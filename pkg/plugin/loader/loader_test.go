@@ -28,6 +28,7 @@ import (
 	"github.com/heptio/sonobuoy/pkg/plugin/manifest"
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 )
 
 func TestFindPlugins(t *testing.T) {
@@ -63,7 +64,7 @@ func TestLoadValidPlugin(t *testing.T) {
 		t.Fatalf("Unexpected error reading job plugin: %v", err)
 	}
 
-	jobDef, err := loadDefinition(jobDefFile)
+	jobDef, err := LoadDefinition(jobDefFile)
 	if err != nil {
 		t.Fatalf("Unexpected error loading job plugin: %v", err)
 	}
@@ -84,7 +85,7 @@ func TestLoadValidPlugin(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Unexpected error creating daemonset plugin: %v", err)
 	}
-	daemonDef, err := loadDefinition(daemonDefFile)
+	daemonDef, err := LoadDefinition(daemonDefFile)
 	if err != nil {
 		t.Fatalf("Unexpected error loading daemonset plugin: %v", err)
 	}
@@ -115,7 +116,7 @@ func TestLoadJobPlugin(t *testing.T) {
 		},
 	}
 
-	pluginIface, err := loadPlugin(jobDef, namespace, image, "Always")
+	pluginIface, err := loadPlugin(jobDef, namespace, image, "Always", nil, plugin.PodConfig{})
 	if err != nil {
 		t.Fatalf("unexpected error loading plugin: %v", err)
 	}
@@ -153,7 +154,7 @@ func TestLoadDaemonSet(t *testing.T) {
 		},
 	}
 
-	pluginIface, err := loadPlugin(daemonDef, namespace, image, "Always")
+	pluginIface, err := loadPlugin(daemonDef, namespace, image, "Always", nil, plugin.PodConfig{})
 	if err != nil {
 		t.Fatalf("unexpected error loading plugin: %v", err)
 	}
@@ -192,3 +193,549 @@ func TestFilterList(t *testing.T) {
 		t.Errorf("expected %+#v, got %+#v", expected, filtered)
 	}
 }
+
+func TestValidateDependencies(t *testing.T) {
+	newPlugin := func(name string, dependsOn ...string) plugin.Interface {
+		return job.NewPlugin(plugin.Definition{Name: name, DependsOn: dependsOn}, "loader_test", "", "Always")
+	}
+
+	testCases := []struct {
+		name      string
+		plugins   []plugin.Interface
+		expectErr bool
+	}{
+		{
+			name:    "no dependencies",
+			plugins: []plugin.Interface{newPlugin("a"), newPlugin("b")},
+		},
+		{
+			name:    "chain",
+			plugins: []plugin.Interface{newPlugin("c", "b"), newPlugin("b", "a"), newPlugin("a")},
+		},
+		{
+			name:      "missing dependency",
+			plugins:   []plugin.Interface{newPlugin("b", "a")},
+			expectErr: true,
+		},
+		{
+			name:      "cycle",
+			plugins:   []plugin.Interface{newPlugin("a", "c"), newPlugin("b", "a"), newPlugin("c", "b")},
+			expectErr: true,
+		},
+		{
+			name:      "self",
+			plugins:   []plugin.Interface{newPlugin("a", "a")},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateDependencies(tc.plugins)
+			if tc.expectErr && err == nil {
+				t.Error("expected an error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestNamespaceScopedPlugins(t *testing.T) {
+	plugins := []plugin.Interface{
+		job.NewPlugin(plugin.Definition{Name: "after-logs", DependsOn: []string{"logs"}}, "loader_test", "", "Always"),
+		daemonset.NewPlugin(plugin.Definition{Name: "logs"}, "loader_test", "", "Always"),
+		job.NewPlugin(plugin.Definition{Name: "e2e"}, "loader_test", "", "Always"),
+		job.NewPlugin(plugin.Definition{Name: "after-e2e", DependsOn: []string{"e2e"}}, "loader_test", "", "Always"),
+		job.NewPlugin(plugin.Definition{Name: "namespaced", RBAC: &manifest.RBAC{Rules: []rbacv1.PolicyRule{{Verbs: []string{"get"}}}}}, "loader_test", "", "Always"),
+		job.NewPlugin(plugin.Definition{Name: "cluster", RBAC: &manifest.RBAC{ClusterRules: []rbacv1.PolicyRule{{Verbs: []string{"get"}}}}}, "loader_test", "", "Always"),
+	}
+
+	names := []string{}
+	for _, p := range NamespaceScopedPlugins(plugins) {
+		names = append(names, p.GetName())
+	}
+
+	expected := []string{"e2e", "after-e2e", "namespaced"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected plugins %v, got %v", expected, names)
+	}
+}
+
+func TestMergeImagePullSecrets(t *testing.T) {
+	testCases := []struct {
+		name     string
+		plugin   []string
+		global   []string
+		expected []string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:     "plugin only",
+			plugin:   []string{"a"},
+			expected: []string{"a"},
+		},
+		{
+			name:     "global only",
+			global:   []string{"b"},
+			expected: []string{"b"},
+		},
+		{
+			name:     "duplicates",
+			plugin:   []string{"a", "b"},
+			global:   []string{"b", "c"},
+			expected: []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			merged := mergeImagePullSecrets(tc.plugin, tc.global)
+			if !reflect.DeepEqual(merged, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, merged)
+			}
+		})
+	}
+}
+
+func TestLoadPlugin_reservedVolume(t *testing.T) {
+	def := &manifest.Manifest{
+		SonobuoyConfig: manifest.SonobuoyConfig{
+			Driver:     "Job",
+			PluginName: "test-job-plugin",
+		},
+		ExtraVolumes: []corev1.Volume{{Name: "results"}},
+	}
+
+	if _, err := loadPlugin(def, "loader_test", "", "Always", nil, plugin.PodConfig{}); err == nil {
+		t.Error("expected an error for an extra volume named results")
+	}
+}
+
+func TestLoadPlugin_sidecarNames(t *testing.T) {
+	testCases := []struct {
+		name      string
+		sidecar   string
+		expectErr bool
+	}{
+		{name: "unique", sidecar: "proxy"},
+		{name: "missing", sidecar: "", expectErr: true},
+		{name: "plugin container", sidecar: "plugin", expectErr: true},
+		{name: "worker container", sidecar: "sonobuoy-worker", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			def := &manifest.Manifest{
+				SonobuoyConfig: manifest.SonobuoyConfig{Driver: "Job", PluginName: "test"},
+				Spec:           manifest.Container{Container: corev1.Container{Name: "plugin"}},
+				Sidecars:       []corev1.Container{{Name: tc.sidecar}},
+			}
+			_, err := loadPlugin(def, "loader_test", "", "Always", nil, plugin.PodConfig{})
+			if tc.expectErr && err == nil {
+				t.Error("expected an error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadPlugin_localResults(t *testing.T) {
+	testCases := []struct {
+		name      string
+		cfg       manifest.SonobuoyConfig
+		expectErr bool
+	}{
+		{name: "host path", cfg: manifest.SonobuoyConfig{Driver: "DaemonSet", ResultsHostPath: "/var/lib/sonobuoy"}},
+		{name: "claim", cfg: manifest.SonobuoyConfig{Driver: "Job", ResultsClaimName: "results"}},
+		{name: "both", cfg: manifest.SonobuoyConfig{Driver: "Job", ResultsHostPath: "/var/lib/sonobuoy", ResultsClaimName: "results"}, expectErr: true},
+		{name: "relative host path", cfg: manifest.SonobuoyConfig{Driver: "Job", ResultsHostPath: "sonobuoy"}, expectErr: true},
+		{name: "deployment", cfg: manifest.SonobuoyConfig{Driver: "Deployment", DurationSeconds: 60, ResultsClaimName: "results"}, expectErr: true},
+		{name: "stream", cfg: manifest.SonobuoyConfig{Driver: "Job", ResultsStream: "/tmp/results/e2e.log", ResultsClaimName: "results"}, expectErr: true},
+		{name: "windows", cfg: manifest.SonobuoyConfig{Driver: "DaemonSet", OperatingSystems: []string{"windows"}, ResultsHostPath: "/var/lib/sonobuoy"}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.PluginName = "test"
+			def := &manifest.Manifest{SonobuoyConfig: tc.cfg}
+			p, err := loadPlugin(def, "loader_test", "", "Always", nil, plugin.PodConfig{})
+			if tc.expectErr && err == nil {
+				t.Error("expected an error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if err == nil && !p.StoresResults() {
+				t.Error("expected the plugin to store its results")
+			}
+		})
+	}
+}
+
+func TestLoadPlugin_serviceAccountToken(t *testing.T) {
+	testCases := []struct {
+		name      string
+		cfg       manifest.SonobuoyConfig
+		expectErr bool
+	}{
+		{name: "defaults", cfg: manifest.SonobuoyConfig{Driver: "Job", ServiceAccountToken: &manifest.ServiceAccountToken{}}},
+		{name: "expiration", cfg: manifest.SonobuoyConfig{Driver: "Job", ServiceAccountToken: &manifest.ServiceAccountToken{ExpirationSeconds: 7200}}},
+		{name: "short expiration", cfg: manifest.SonobuoyConfig{Driver: "Job", ServiceAccountToken: &manifest.ServiceAccountToken{ExpirationSeconds: 60}}, expectErr: true},
+		{name: "daemonset", cfg: manifest.SonobuoyConfig{Driver: "DaemonSet", ServiceAccountToken: &manifest.ServiceAccountToken{}}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.PluginName = "test"
+			def := &manifest.Manifest{SonobuoyConfig: tc.cfg}
+			_, err := loadPlugin(def, "loader_test", "", "Always", nil, plugin.PodConfig{})
+			if tc.expectErr && err == nil {
+				t.Error("expected an error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadPlugin_externalResults(t *testing.T) {
+	testCases := []struct {
+		name      string
+		cfg       manifest.SonobuoyConfig
+		expectErr bool
+	}{
+		{name: "url", cfg: manifest.SonobuoyConfig{Driver: "Job", ExternalResults: &manifest.ExternalResults{URL: "https://collector.example.com"}}},
+		{name: "secret", cfg: manifest.SonobuoyConfig{Driver: "DaemonSet", ExternalResults: &manifest.ExternalResults{URL: "https://collector.example.com", AuthSecret: "collector", AuthSecretKey: "token"}}},
+		{name: "http", cfg: manifest.SonobuoyConfig{Driver: "Job", ExternalResults: &manifest.ExternalResults{URL: "http://collector.example.com"}}, expectErr: true},
+		{name: "no url", cfg: manifest.SonobuoyConfig{Driver: "Job", ExternalResults: &manifest.ExternalResults{}}, expectErr: true},
+		{name: "key without secret", cfg: manifest.SonobuoyConfig{Driver: "Job", ExternalResults: &manifest.ExternalResults{URL: "https://collector.example.com", AuthSecretKey: "token"}}, expectErr: true},
+		{name: "stored results", cfg: manifest.SonobuoyConfig{Driver: "Job", ResultsClaimName: "results", ExternalResults: &manifest.ExternalResults{URL: "https://collector.example.com"}}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.PluginName = "test"
+			def := &manifest.Manifest{SonobuoyConfig: tc.cfg}
+			_, err := loadPlugin(def, "loader_test", "", "Always", nil, plugin.PodConfig{})
+			if tc.expectErr && err == nil {
+				t.Error("expected an error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadPlugin_resultsTransport(t *testing.T) {
+	transport := &manifest.ResultsTransport{Command: []string{"/tmp/results/bin/send", "--topic=results"}}
+	testCases := []struct {
+		name      string
+		cfg       manifest.SonobuoyConfig
+		expectErr bool
+	}{
+		{name: "job", cfg: manifest.SonobuoyConfig{Driver: "Job", ResultsTransport: transport}},
+		{name: "daemonset", cfg: manifest.SonobuoyConfig{Driver: "DaemonSet", ResultsTransport: transport}},
+		{name: "no command", cfg: manifest.SonobuoyConfig{Driver: "Job", ResultsTransport: &manifest.ResultsTransport{}}, expectErr: true},
+		{name: "relative command", cfg: manifest.SonobuoyConfig{Driver: "Job", ResultsTransport: &manifest.ResultsTransport{Command: []string{"send"}}}, expectErr: true},
+		{name: "deployment", cfg: manifest.SonobuoyConfig{Driver: "Deployment", ResultsTransport: transport}, expectErr: true},
+		{name: "stream", cfg: manifest.SonobuoyConfig{Driver: "Job", ResultsStream: "/tmp/results/e2e.log", ResultsTransport: transport}, expectErr: true},
+		{name: "stored results", cfg: manifest.SonobuoyConfig{Driver: "Job", ResultsClaimName: "results", ResultsTransport: transport}, expectErr: true},
+		{name: "external results", cfg: manifest.SonobuoyConfig{Driver: "Job", ExternalResults: &manifest.ExternalResults{URL: "https://collector.example.com"}, ResultsTransport: transport}, expectErr: true},
+		{name: "result format", cfg: manifest.SonobuoyConfig{Driver: "Job", ResultFormat: "junit", ResultsTransport: transport}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.PluginName = "test"
+			def := &manifest.Manifest{SonobuoyConfig: tc.cfg}
+			_, err := loadPlugin(def, "loader_test", "", "Always", nil, plugin.PodConfig{})
+			if tc.expectErr && err == nil {
+				t.Error("expected an error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadPlugin_submitRetry(t *testing.T) {
+	testCases := []struct {
+		name      string
+		retry     manifest.SubmitRetry
+		expectErr bool
+	}{
+		{name: "defaults"},
+		{name: "all set", retry: manifest.SubmitRetry{Attempts: 10, MaxElapsedSeconds: 600, Jitter: 0.5}},
+		{name: "negative attempts", retry: manifest.SubmitRetry{Attempts: -1}, expectErr: true},
+		{name: "negative max elapsed", retry: manifest.SubmitRetry{MaxElapsedSeconds: -1}, expectErr: true},
+		{name: "negative jitter", retry: manifest.SubmitRetry{Jitter: -0.1}, expectErr: true},
+		{name: "jitter of one", retry: manifest.SubmitRetry{Jitter: 1}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			retry := tc.retry
+			def := &manifest.Manifest{SonobuoyConfig: manifest.SonobuoyConfig{Driver: "Job", PluginName: "test", SubmitRetry: &retry}}
+			_, err := loadPlugin(def, "loader_test", "", "Always", nil, plugin.PodConfig{})
+			if tc.expectErr && err == nil {
+				t.Error("expected an error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadPlugin_files(t *testing.T) {
+	testCases := []struct {
+		name      string
+		files     map[string]string
+		oses      []string
+		expectErr bool
+	}{
+		{name: "files", files: map[string]string{"skip.txt": "Flaky", "focus.txt": "Conformance"}},
+		{name: "path", files: map[string]string{"../skip.txt": "Flaky"}, expectErr: true},
+		{name: "directory", files: map[string]string{"..": "Flaky"}, expectErr: true},
+		{name: "empty name", files: map[string]string{"": "Flaky"}, expectErr: true},
+		{name: "linux", files: map[string]string{"skip.txt": "Flaky"}, oses: []string{"linux"}},
+		{name: "windows", files: map[string]string{"skip.txt": "Flaky"}, oses: []string{"linux", "windows"}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			def := &manifest.Manifest{
+				SonobuoyConfig: manifest.SonobuoyConfig{Driver: "DaemonSet", PluginName: "test", OperatingSystems: tc.oses},
+				Files:          tc.files,
+			}
+			p, err := loadPlugin(def, "loader_test", "", "Always", nil, plugin.PodConfig{})
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if err == nil && !reflect.DeepEqual(p.GetFiles(), tc.files) {
+				t.Errorf("expected files %v, got %v", tc.files, p.GetFiles())
+			}
+		})
+	}
+}
+
+func TestLoadPlugin_retries(t *testing.T) {
+	testCases := []struct {
+		name      string
+		cfg       manifest.SonobuoyConfig
+		expectErr bool
+	}{
+		{name: "job", cfg: manifest.SonobuoyConfig{Driver: "Job", Retries: 2}},
+		{name: "daemonset", cfg: manifest.SonobuoyConfig{Driver: "DaemonSet", Retries: 2}},
+		{name: "negative", cfg: manifest.SonobuoyConfig{Driver: "Job", Retries: -1}, expectErr: true},
+		{name: "deployment", cfg: manifest.SonobuoyConfig{Driver: "Deployment", DurationSeconds: 60, Retries: 2}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.PluginName = "test"
+			def := &manifest.Manifest{SonobuoyConfig: tc.cfg}
+			p, err := loadPlugin(def, "loader_test", "", "Always", nil, plugin.PodConfig{})
+			if tc.expectErr && err == nil {
+				t.Error("expected an error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if j, ok := p.(*job.Plugin); ok && j.Definition.Retries != tc.cfg.Retries {
+				t.Errorf("expected %v retries, got %v", tc.cfg.Retries, j.Definition.Retries)
+			}
+		})
+	}
+}
+
+func TestLoadPlugin_metadata(t *testing.T) {
+	podCfg := plugin.PodConfig{
+		Labels:      map[string]string{"cost-center": "1234", "team": "platform"},
+		Annotations: map[string]string{"sidecar.istio.io/inject": "false"},
+	}
+	def := &manifest.Manifest{
+		SonobuoyConfig: manifest.SonobuoyConfig{Driver: "Job", PluginName: "test"},
+		Labels:         map[string]string{"team": "qa"},
+		Annotations:    map[string]string{"owner": "QA"},
+	}
+
+	p, err := loadPlugin(def, "loader_test", "", "Always", nil, podCfg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dfn := p.(*job.Plugin).Definition
+	expectedLabels := map[string]string{"cost-center": "1234", "team": "qa"}
+	if !reflect.DeepEqual(dfn.Labels, expectedLabels) {
+		t.Errorf("expected labels %v, got %v", expectedLabels, dfn.Labels)
+	}
+	expectedAnnotations := map[string]string{"sidecar.istio.io/inject": "false", "owner": "QA"}
+	if !reflect.DeepEqual(dfn.Annotations, expectedAnnotations) {
+		t.Errorf("expected annotations %v, got %v", expectedAnnotations, dfn.Annotations)
+	}
+
+	def.Labels = map[string]string{"sonobuoy-run": "mine"}
+	if _, err := loadPlugin(def, "loader_test", "", "Always", nil, podCfg); err == nil {
+		t.Error("expected an error for a reserved label, got none")
+	}
+}
+
+func TestLoadPlugin_securityContext(t *testing.T) {
+	testCases := []struct {
+		name      string
+		mode      string
+		cfg       manifest.SonobuoyConfig
+		expectErr bool
+	}{
+		{name: "restricted job", mode: plugin.SecurityContextRestricted, cfg: manifest.SonobuoyConfig{Driver: "Job"}},
+		{name: "restricted daemonset", mode: plugin.SecurityContextRestricted, cfg: manifest.SonobuoyConfig{Driver: "DaemonSet"}, expectErr: true},
+		{name: "privileged daemonset", mode: plugin.SecurityContextPrivileged, cfg: manifest.SonobuoyConfig{Driver: "DaemonSet"}},
+		{
+			name:      "restricted results host path",
+			mode:      plugin.SecurityContextRestricted,
+			cfg:       manifest.SonobuoyConfig{Driver: "Job", ResultsHostPath: "/var/lib/results"},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.PluginName = "test"
+			def := &manifest.Manifest{SonobuoyConfig: tc.cfg}
+			_, err := loadPlugin(def, "loader_test", "", "Always", nil, plugin.PodConfig{SecurityContextMode: tc.mode})
+			if tc.expectErr && err == nil {
+				t.Error("expected an error, got none")
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadPlugin_rbac(t *testing.T) {
+	get := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}
+	metrics := rbacv1.PolicyRule{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}
+	testCases := []struct {
+		name      string
+		rbac      *manifest.RBAC
+		expectErr bool
+	}{
+		{name: "rules", rbac: &manifest.RBAC{Rules: []rbacv1.PolicyRule{get}, ClusterRules: []rbacv1.PolicyRule{get, metrics}}},
+		{name: "no rules", rbac: &manifest.RBAC{}},
+		{name: "no verbs", rbac: &manifest.RBAC{ClusterRules: []rbacv1.PolicyRule{{Resources: []string{"pods"}}}}, expectErr: true},
+		{name: "namespaced non-resource URLs", rbac: &manifest.RBAC{Rules: []rbacv1.PolicyRule{metrics}}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			def := &manifest.Manifest{SonobuoyConfig: manifest.SonobuoyConfig{Driver: "Job", PluginName: "test", RBAC: tc.rbac}}
+			p, err := loadPlugin(def, "loader_test", "", "Always", nil, plugin.PodConfig{})
+			if tc.expectErr {
+				if err == nil {
+					t.Error("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rbac := p.(*job.Plugin).Definition.RBAC; !reflect.DeepEqual(rbac, tc.rbac) {
+				t.Errorf("expected rbac %+v, got %+v", tc.rbac, rbac)
+			}
+		})
+	}
+}
+
+func TestLoadDefinition_podSpec(t *testing.T) {
+	def, err := LoadDefinition([]byte(`
+sonobuoy-config:
+  driver: DaemonSet
+  plugin-name: gpu-checks
+  result-type: gpu-checks
+spec:
+  image: example.com/gpu-checks:v1
+  name: gpu-checks
+  volumeMounts:
+  - mountPath: /etc/gpu-checks
+    name: config
+extra-volumes:
+- name: config
+  configMap:
+    name: gpu-checks-config
+node-selector:
+  accelerator: gpu
+tolerations:
+- key: dedicated
+  operator: Equal
+  value: gpu
+  effect: NoSchedule
+affinity:
+  nodeAffinity:
+    requiredDuringSchedulingIgnoredDuringExecution:
+      nodeSelectorTerms:
+      - matchExpressions:
+        - key: kubernetes.io/hostname
+          operator: NotIn
+          values: [node01]
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p, err := loadPlugin(def, "loader_test", "", "Always", nil, plugin.PodConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error loading plugin: %v", err)
+	}
+	dfn := p.(*daemonset.Plugin).Definition
+	if len(dfn.ExtraVolumes) != 1 || dfn.ExtraVolumes[0].ConfigMap == nil || dfn.ExtraVolumes[0].ConfigMap.Name != "gpu-checks-config" {
+		t.Errorf("expected a configmap extra volume, got %+v", dfn.ExtraVolumes)
+	}
+	if dfn.NodeSelector["accelerator"] != "gpu" {
+		t.Errorf("expected node selector accelerator=gpu, got %v", dfn.NodeSelector)
+	}
+	if len(dfn.Tolerations) != 1 || dfn.Tolerations[0].Value != "gpu" {
+		t.Errorf("expected a toleration for gpu, got %+v", dfn.Tolerations)
+	}
+	if dfn.Affinity == nil || dfn.Affinity.NodeAffinity == nil {
+		t.Errorf("expected a node affinity, got %+v", dfn.Affinity)
+	}
+}
+
+func TestLoadPlugin_operatingSystems(t *testing.T) {
+	testCases := []struct {
+		name      string
+		driver    string
+		oses      []string
+		expectErr bool
+	}{
+		{name: "daemonset on windows", driver: "DaemonSet", oses: []string{"linux", "windows"}},
+		{name: "unsupported os", driver: "DaemonSet", oses: []string{"plan9"}, expectErr: true},
+		{name: "job", driver: "Job", oses: []string{"windows"}, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			def := &manifest.Manifest{
+				SonobuoyConfig: manifest.SonobuoyConfig{
+					Driver:           tc.driver,
+					PluginName:       "test-plugin",
+					OperatingSystems: tc.oses,
+				},
+			}
+			_, err := loadPlugin(def, "loader_test", "", "Always", nil, plugin.PodConfig{})
+			if tc.expectErr != (err != nil) {
+				t.Errorf("expected error %v, got %v", tc.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// Values parameterize plugin definitions written as Go templates, which read
+// them as .Values, such as {{ .Values.image.tag }}.
+type Values map[string]interface{}
+
+// LoadValues reads values from YAML files. Those in later files override
+// those in earlier ones, merging maps key by key.
+func LoadValues(files []string) (Values, error) {
+	values := Values{}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't read plugin values %v", file)
+		}
+		fileValues, err := parseValues(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid plugin values %v", file)
+		}
+		mergeValues(values, fileValues)
+	}
+	return values, nil
+}
+
+// parseValues decodes YAML values, keeping numbers as they're written rather
+// than converting them to floats.
+func parseValues(b []byte) (Values, error) {
+	j, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't decode yaml")
+	}
+	values := Values{}
+	if bytes.Equal(bytes.TrimSpace(j), []byte("null")) {
+		return values, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(j))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, errors.Wrap(err, "values must be a map")
+	}
+	return values, nil
+}
+
+// mergeValues sets each of src in dst, merging maps in both.
+func mergeValues(dst, src map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcOK := v.(map[string]interface{})
+		dstMap, dstOK := dst[k].(map[string]interface{})
+		if srcOK && dstOK {
+			mergeValues(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// templateFuncs are the functions plugin definition templates can use besides
+// text/template's own.
+var templateFuncs = template.FuncMap{
+	// default is value, or def if value is missing or empty, as in
+	// {{ .Values.focus | default "Conformance" }}.
+	"default": func(def, value interface{}) interface{} {
+		if isEmpty(value) {
+			return def
+		}
+		return value
+	},
+	// required fails rendering with message if value is missing or empty.
+	"required": func(message string, value interface{}) (interface{}, error) {
+		if isEmpty(value) {
+			return nil, errors.New(message)
+		}
+		return value, nil
+	},
+	// quote quotes value as a YAML (and JSON) string. A value that isn't set
+	// is an error, as it is when it's used unquoted.
+	"quote": func(value interface{}) (string, error) {
+		if value == nil {
+			return "", errors.New("quoted a value that isn't set")
+		}
+		b, err := json.Marshal(fmt.Sprint(value))
+		return string(b), err
+	},
+	// toYaml encodes value as YAML, such as a map of resources.
+	"toYaml": func(value interface{}) (string, error) {
+		b, err := yaml.Marshal(value)
+		return strings.TrimSuffix(string(b), "\n"), err
+	},
+	// indent indents each line of s by n spaces, to nest toYaml's output.
+	"indent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+	},
+}
+
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// missingValue is what text/template renders a value that isn't set as.
+const missingValue = "<no value>"
+
+// RenderDefinition executes a plugin definition as a Go template with values.
+// Using a value that isn't set is an error, rather than silently rendering
+// nothing, unless it's given a default.
+func RenderDefinition(definition []byte, values Values) ([]byte, error) {
+	tmpl, err := template.New("plugin").Funcs(templateFuncs).Parse(string(definition))
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't parse plugin definition template")
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, map[string]interface{}{"Values": values}); err != nil {
+		return nil, errors.Wrap(err, "couldn't render plugin definition template")
+	}
+	// A missing key can't be an error while rendering, since default
+	// couldn't be given one then.
+	if line := missingValueLine(b.Bytes()); line != "" {
+		return nil, errors.Errorf("plugin definition template uses a value that isn't set: %q", line)
+	}
+	return b.Bytes(), nil
+}
+
+// missingValueLine returns the first line of a rendered definition with a
+// value that wasn't set, if any.
+func missingValueLine(rendered []byte) string {
+	for _, line := range strings.Split(string(rendered), "\n") {
+		if strings.Contains(line, missingValue) {
+			return strings.TrimSpace(line)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package loader
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestRenderDefinition(t *testing.T) {
+	dir := path.Join("testdata", "templated")
+	definition, err := ioutil.ReadFile(path.Join(dir, "plugin.yaml"))
+	if err != nil {
+		t.Fatalf("couldn't read plugin definition: %v", err)
+	}
+
+	values, err := LoadValues([]string{path.Join(dir, "values.yaml"), path.Join(dir, "staging.yaml")})
+	if err != nil {
+		t.Fatalf("couldn't load values: %v", err)
+	}
+	rendered, err := RenderDefinition(definition, values)
+	if err != nil {
+		t.Fatalf("couldn't render plugin definition: %v", err)
+	}
+	def, err := LoadDefinition(rendered)
+	if err != nil {
+		t.Fatalf("couldn't load rendered plugin definition: %v\n%s", err, rendered)
+	}
+
+	if def.SonobuoyConfig.PluginName != "templated-plugin" {
+		t.Errorf("expected the default plugin name, got %q", def.SonobuoyConfig.PluginName)
+	}
+	if def.Spec.Image != "gcr.io/heptio-images/heptio-e2e:v0.11.0" {
+		t.Errorf("expected the later values' image tag to be used, got %q", def.Spec.Image)
+	}
+	if len(def.Spec.Env) != 1 || def.Spec.Env[0].Value != "[Conformance]" {
+		t.Errorf("expected the focus to be set, got %+v", def.Spec.Env)
+	}
+	expected := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m"), corev1.ResourceMemory: resource.MustParse("64Mi")},
+		Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+	}
+	for name, list := range map[string][2]corev1.ResourceList{
+		"requests": {expected.Requests, def.Spec.Resources.Requests},
+		"limits":   {expected.Limits, def.Spec.Resources.Limits},
+	} {
+		if len(list[0]) != len(list[1]) {
+			t.Errorf("expected %v %v, got %v", name, list[0], list[1])
+			continue
+		}
+		for resourceName, quantity := range list[0] {
+			if got := list[1][resourceName]; got.Cmp(quantity) != 0 {
+				t.Errorf("expected %v %v of %v, got %v", name, resourceName, quantity.String(), got.String())
+			}
+		}
+	}
+}
+
+func TestRenderDefinition_missingValues(t *testing.T) {
+	tests := []struct {
+		desc       string
+		definition string
+		values     Values
+		expected   string
+	}{
+		{
+			desc:       "missing value",
+			definition: "image: repo:{{ .Values.tag }}",
+			values:     Values{},
+			expected:   `uses a value that isn't set: "image: repo:<no value>"`,
+		},
+		{
+			desc:       "missing quoted value",
+			definition: "focus: {{ .Values.focus | quote }}",
+			values:     Values{},
+			expected:   "quoted a value that isn't set",
+		},
+		{
+			desc:       "null quoted value",
+			definition: "focus: {{ quote .Values.focus }}",
+			values:     Values{"focus": nil},
+			expected:   "quoted a value that isn't set",
+		},
+		{
+			desc:       "required value",
+			definition: `image: {{ required "image is required" .Values.image }}`,
+			values:     Values{"image": ""},
+			expected:   "image is required",
+		},
+		{
+			desc:       "invalid template",
+			definition: "image: {{ .Values.image",
+			values:     Values{},
+			expected:   "couldn't parse",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := RenderDefinition([]byte(test.definition), test.values)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected an error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestLoadValues_numbers(t *testing.T) {
+	values, err := parseValues([]byte("replicas: 3\nmemory: 1000000000\n"))
+	if err != nil {
+		t.Fatalf("couldn't parse values: %v", err)
+	}
+	rendered, err := RenderDefinition([]byte("{{ .Values.replicas }} {{ .Values.memory }}"), values)
+	if err != nil {
+		t.Fatalf("couldn't render: %v", err)
+	}
+	if string(rendered) != "3 1000000000" {
+		t.Errorf("expected numbers to be rendered as they're written, got %q", rendered)
+	}
+
+	if _, err := parseValues([]byte("- not a map")); err == nil {
+		t.Error("expected values that aren't a map to be rejected")
+	}
+}
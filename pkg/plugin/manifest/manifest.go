@@ -18,42 +18,292 @@ package manifest
 
 import (
 	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	kuberuntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 // SonobuoyConfig is the Sonobuoy metadata that plugins all supply
 type SonobuoyConfig struct {
-	Driver     string `json:"driver"`
-	PluginName string `json:"plugin-name"`
-	ResultType string `json:"result-type"`
+	Driver        string `json:"driver"`
+	PluginName    string `json:"plugin-name"`
+	ResultType    string `json:"result-type"`
+	ResultsStream string `json:"results-stream,omitempty"`
+	// ResultsCompression is how the worker should compress results before
+	// uploading them. Only "gzip" is supported; empty means no compression.
+	ResultsCompression string `json:"results-compression,omitempty"`
+	// ResultsProtocol is how the worker should submit results. Only "grpc"
+	// is supported; empty means plain HTTP.
+	ResultsProtocol string `json:"results-protocol,omitempty"`
+	// TimeoutSeconds is how long the plugin has to submit its results before
+	// it's stopped and marked as timed out. Zero means only the run's timeout
+	// applies.
+	TimeoutSeconds int `json:"timeout-seconds,omitempty"`
+	// Retries is how many times the plugin's pod is recreated when it fails
+	// for a reason other than its tests, such as being evicted, before the
+	// plugin is marked as failed.
+	Retries int `json:"retries,omitempty"`
+	// Replicas is how many pods the Deployment driver keeps running. Zero
+	// means one.
+	Replicas int `json:"replicas,omitempty"`
+	// DurationSeconds is how long the Deployment driver keeps the plugin
+	// running before its result is completed.
+	DurationSeconds int `json:"duration-seconds,omitempty"`
+	// DependsOn names the plugins that must succeed before this one is
+	// started.
+	DependsOn []string `json:"depends-on,omitempty"`
+	// ImagePullSecrets names the secrets used to pull the plugin's images,
+	// in addition to any set in the Sonobuoy config.
+	ImagePullSecrets []string `json:"image-pull-secrets,omitempty"`
+	// OperatingSystems are the operating systems of the nodes the DaemonSet
+	// driver runs the plugin on. Empty means only Linux nodes.
+	OperatingSystems []string `json:"operating-systems,omitempty"`
+	// Images overrides the image of the plugin's container on nodes with
+	// the given operating systems.
+	Images map[string]string `json:"images,omitempty"`
+	// ResultsHostPath is a directory on each node that the plugin's workers
+	// store their results in, for the aggregator to fetch, instead of
+	// submitting them to it.
+	ResultsHostPath string `json:"results-host-path,omitempty"`
+	// ResultsClaimName is a PersistentVolumeClaim that the plugin's workers
+	// store their results in, for the aggregator to fetch, instead of
+	// submitting them to it.
+	ResultsClaimName string `json:"results-claim-name,omitempty"`
+	// ResultProcessors names the processors the aggregator runs on each of
+	// the plugin's results once they've arrived, such as "junit-summary".
+	ResultProcessors []string `json:"result-processors,omitempty"`
+	// ResultFormat is the format the plugin's results are in, such as
+	// "junit", which the aggregator rejects results that aren't valid in.
+	ResultFormat string `json:"result-format,omitempty"`
+	// ServiceAccountToken, if set, has the plugin's worker keep a bound
+	// service account token and a kubeconfig using it for the plugin,
+	// refreshing the token before it expires.
+	ServiceAccountToken *ServiceAccountToken `json:"service-account-token,omitempty"`
+	// RBAC, if set, runs the plugin's pods as a service account of their
+	// own, granted only the rules it declares, rather than as Sonobuoy's.
+	RBAC *RBAC `json:"rbac,omitempty"`
+	// ExternalResults, if set, has the plugin's workers POST their results
+	// to an external endpoint as well as submitting them to the aggregator.
+	ExternalResults *ExternalResults `json:"external-results,omitempty"`
+	// ResultsTransport, if set, has the plugin's workers deliver their
+	// results with a command of their own, such as to Kafka or over SFTP,
+	// rather than submitting them to the aggregator, which is only sent a
+	// receipt of what was delivered.
+	ResultsTransport *ResultsTransport `json:"results-transport,omitempty"`
+	// SubmitRetry, if set, changes how the plugin's workers retry submitting
+	// results when the aggregator can't be reached.
+	SubmitRetry *SubmitRetry `json:"submit-retry,omitempty"`
 	objectKind
 }
 
+// ResultsTransport is a command a plugin's workers deliver their results
+// with. It's run once for each result file, given the file on stdin and what
+// it is as flags.
+type ResultsTransport struct {
+	// Command is the executable, by its absolute path in the worker's
+	// container, and its arguments. It's usually installed in the results
+	// volume, by the plugin or a sidecar that mounts it.
+	Command []string `json:"command"`
+}
+
+// SubmitRetry is how a plugin's workers retry submitting results. Fields left
+// at zero keep the worker's defaults: retrying for up to 5 minutes, however
+// many attempts that takes, with 20% jitter.
+type SubmitRetry struct {
+	// Attempts bounds how many times each submission is attempted.
+	Attempts int `json:"attempts,omitempty"`
+	// MaxElapsedSeconds bounds how long each submission is retried for.
+	MaxElapsedSeconds int `json:"max-elapsed-seconds,omitempty"`
+	// Jitter randomizes each wait between attempts by up to this fraction
+	// of it.
+	Jitter float64 `json:"jitter,omitempty"`
+}
+
+// ExternalResults is an HTTPS endpoint a plugin's workers POST their results
+// to as they submit them.
+type ExternalResults struct {
+	// URL is the endpoint. Each result is POSTed to it with the path it's
+	// submitted to the aggregator on appended, such as
+	// /api/v1/results/by-node/<node>/<plugin>.
+	URL string `json:"url"`
+	// AuthSecret names a secret in Sonobuoy's namespace whose AuthSecretKey
+	// key is sent as the Authorization header. AuthSecretKey defaults to
+	// DefaultExternalResultsAuthKey.
+	AuthSecret    string `json:"auth-secret,omitempty"`
+	AuthSecretKey string `json:"auth-secret-key,omitempty"`
+}
+
+// DefaultExternalResultsAuthKey is the key of the secret the Authorization
+// header for external results is read from, unless another's given.
+const DefaultExternalResultsAuthKey = "authorization"
+
+// RBAC is the permissions a plugin needs.
+type RBAC struct {
+	// Rules are granted in Sonobuoy's namespace.
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+	// ClusterRules are granted cluster-wide, so plugins that set them
+	// can't be run in a namespace-scoped run.
+	ClusterRules []rbacv1.PolicyRule `json:"cluster-rules,omitempty"`
+}
+
+// ServiceAccountToken configures the service account token a plugin's worker
+// keeps for it.
+type ServiceAccountToken struct {
+	// Audience is who the token is intended for. Empty means the API
+	// server's own audience.
+	Audience string `json:"audience,omitempty"`
+	// ExpirationSeconds is how long each token is valid for. Zero means an
+	// hour.
+	ExpirationSeconds int64 `json:"expiration-seconds,omitempty"`
+}
+
 // DeepCopy makes a deep copy (needed by DeepCopyObject)
 func (s *SonobuoyConfig) DeepCopy() *SonobuoyConfig {
 	return &SonobuoyConfig{
-		Driver:     s.Driver,
-		PluginName: s.PluginName,
-		ResultType: s.ResultType,
-		objectKind: objectKind{s.objectKind.gvk},
+		Driver:              s.Driver,
+		PluginName:          s.PluginName,
+		ResultType:          s.ResultType,
+		ResultsStream:       s.ResultsStream,
+		ResultsCompression:  s.ResultsCompression,
+		ResultsProtocol:     s.ResultsProtocol,
+		TimeoutSeconds:      s.TimeoutSeconds,
+		Retries:             s.Retries,
+		Replicas:            s.Replicas,
+		DurationSeconds:     s.DurationSeconds,
+		DependsOn:           append([]string(nil), s.DependsOn...),
+		ImagePullSecrets:    append([]string(nil), s.ImagePullSecrets...),
+		OperatingSystems:    append([]string(nil), s.OperatingSystems...),
+		Images:              copyMap(s.Images),
+		ResultsHostPath:     s.ResultsHostPath,
+		ResultsClaimName:    s.ResultsClaimName,
+		ResultProcessors:    append([]string(nil), s.ResultProcessors...),
+		ResultFormat:        s.ResultFormat,
+		ServiceAccountToken: s.ServiceAccountToken.DeepCopy(),
+		RBAC:                s.RBAC.DeepCopy(),
+		ExternalResults:     s.ExternalResults.DeepCopy(),
+		ResultsTransport:    s.ResultsTransport.DeepCopy(),
+		SubmitRetry:         s.SubmitRetry.DeepCopy(),
+		objectKind:          objectKind{s.objectKind.gvk},
+	}
+}
+
+// DeepCopy makes a deep copy of the external results endpoint, or nil if
+// there isn't one.
+func (e *ExternalResults) DeepCopy() *ExternalResults {
+	if e == nil {
+		return nil
 	}
+	copied := *e
+	return &copied
+}
+
+// DeepCopy makes a deep copy of the results transport, or nil if there isn't
+// one.
+func (t *ResultsTransport) DeepCopy() *ResultsTransport {
+	if t == nil {
+		return nil
+	}
+	return &ResultsTransport{Command: append([]string(nil), t.Command...)}
+}
+
+// DeepCopy makes a deep copy of the retry configuration, or nil if there
+// isn't any.
+func (r *SubmitRetry) DeepCopy() *SubmitRetry {
+	if r == nil {
+		return nil
+	}
+	copy := *r
+	return &copy
+}
+
+// DeepCopy makes a deep copy of the token configuration, or nil if there
+// isn't any.
+func (t *ServiceAccountToken) DeepCopy() *ServiceAccountToken {
+	if t == nil {
+		return nil
+	}
+	copy := *t
+	return &copy
+}
+
+// DeepCopy makes a deep copy of the RBAC rules, or nil if there aren't any.
+func (r *RBAC) DeepCopy() *RBAC {
+	if r == nil {
+		return nil
+	}
+	copy := &RBAC{}
+	for _, rule := range r.Rules {
+		copy.Rules = append(copy.Rules, *rule.DeepCopy())
+	}
+	for _, rule := range r.ClusterRules {
+		copy.ClusterRules = append(copy.ClusterRules, *rule.DeepCopy())
+	}
+	return copy
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	copy := make(map[string]string, len(m))
+	for k, v := range m {
+		copy[k] = v
+	}
+	return copy
 }
 
 // Manifest is the high-level manifest for a plugin
 type Manifest struct {
 	SonobuoyConfig SonobuoyConfig `json:"sonobuoy-config"`
 	Spec           Container      `json:"spec"`
+	// ExtraVolumes are added to the plugin's pods, to be mounted by the
+	// volumeMounts of Spec.
+	ExtraVolumes []v1.Volume `json:"extra-volumes,omitempty"`
+	// Sidecars are containers run alongside the plugin's container and the
+	// Sonobuoy worker, such as a proxy or credential helper. They share the
+	// volumes the plugin's container mounts.
+	Sidecars []v1.Container `json:"sidecars,omitempty"`
+	// NodeSelector, Tolerations and Affinity control which nodes the
+	// plugin's pods are scheduled on. Tolerations are added to those
+	// Sonobuoy always sets.
+	NodeSelector map[string]string `json:"node-selector,omitempty"`
+	Tolerations  []v1.Toleration   `json:"tolerations,omitempty"`
+	Affinity     *v1.Affinity      `json:"affinity,omitempty"`
+	// Labels and Annotations are set on every object created for the
+	// plugin, along with those of the Sonobuoy config.
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Files are written to the payload directory of the plugin's container,
+	// keyed by name, before it starts. They're downloaded from the
+	// aggregator rather than set in the pod, so they can be bigger than an
+	// environment variable or a ConfigMap allows, such as lists of tests to
+	// skip.
+	Files map[string]string `json:"files,omitempty"`
 	objectKind
 }
 
 // DeepCopyObject is required by runtime.Object
 func (m *Manifest) DeepCopyObject() kuberuntime.Object {
-	return &Manifest{
+	copy := &Manifest{
 		SonobuoyConfig: *m.SonobuoyConfig.DeepCopy(),
 		Spec:           *m.Spec.DeepCopy(),
+		NodeSelector:   copyMap(m.NodeSelector),
+		Affinity:       m.Affinity.DeepCopy(),
+		Labels:         copyMap(m.Labels),
+		Annotations:    copyMap(m.Annotations),
+		Files:          copyMap(m.Files),
 		objectKind:     objectKind{m.gvk},
 	}
+	for _, volume := range m.ExtraVolumes {
+		copy.ExtraVolumes = append(copy.ExtraVolumes, *volume.DeepCopy())
+	}
+	for _, sidecar := range m.Sidecars {
+		copy.Sidecars = append(copy.Sidecars, *sidecar.DeepCopy())
+	}
+	for _, toleration := range m.Tolerations {
+		copy.Tolerations = append(copy.Tolerations, *toleration.DeepCopy())
+	}
+	return copy
 }
 
 // GetObjectKind is required by runtime.Object
@@ -0,0 +1,78 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// reservedLabels are the labels Sonobuoy sets on the objects it creates to
+// find them again, which custom labels can't replace. Labels and annotations
+// starting with "sonobuoy-" are reserved too.
+var reservedLabels = map[string]bool{"component": true, "run": true, "tier": true}
+
+// reservedAnnotationPrefix is the prefix of the annotations Sonobuoy sets on
+// the aggregator's pod for Prometheus.
+const reservedAnnotationPrefix = "prometheus.io/"
+
+// ValidateMetadata returns an error if labels or annotations can't be set on
+// Kubernetes objects, or would replace those Sonobuoy sets itself.
+func ValidateMetadata(labels, annotations map[string]string) error {
+	for key, value := range labels {
+		if reservedLabels[key] || strings.HasPrefix(key, "sonobuoy-") {
+			return fmt.Errorf("label %v is reserved for Sonobuoy", key)
+		}
+		if msgs := validation.IsQualifiedName(key); len(msgs) > 0 {
+			return fmt.Errorf("invalid label key %q: %v", key, strings.Join(msgs, ", "))
+		}
+		if msgs := validation.IsValidLabelValue(value); len(msgs) > 0 {
+			return fmt.Errorf("invalid value %q for label %v: %v", value, key, strings.Join(msgs, ", "))
+		}
+	}
+
+	for key := range annotations {
+		if strings.HasPrefix(key, "sonobuoy-") || strings.HasPrefix(key, reservedAnnotationPrefix) {
+			return fmt.Errorf("annotation %v is reserved for Sonobuoy", key)
+		}
+		if msgs := validation.IsQualifiedName(key); len(msgs) > 0 {
+			return fmt.Errorf("invalid annotation key %q: %v", key, strings.Join(msgs, ", "))
+		}
+	}
+
+	return nil
+}
+
+// MergeMetadata returns the labels or annotations in both base and overrides,
+// with the values in overrides taking precedence. It returns nil if there are
+// none.
+func MergeMetadata(base, overrides map[string]string) map[string]string {
+	if len(base) == 0 && len(overrides) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]string, len(base)+len(overrides))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
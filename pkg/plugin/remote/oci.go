@@ -0,0 +1,205 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// manifestMediaTypes are the media types of image manifests that plugin
+// definitions are found in.
+const manifestMediaTypes = "application/vnd.oci.image.manifest.v1+json, application/vnd.docker.distribution.manifest.v2+json"
+
+// titleAnnotation is the annotation of an OCI layer with its file name, as
+// set by tools like oras.
+const titleAnnotation = "org.opencontainers.image.title"
+
+// ociManifest is the part of an image manifest needed to find a plugin
+// definition in it.
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// challengeParam matches a parameter of a WWW-Authenticate challenge.
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// fetchOCI fetches the plugin definition in the artifact ref, which is
+// registry/repository followed by a :tag or @digest. It's the artifact's only
+// layer, or else the first titled *.yaml or *.yml.
+func (f *Fetcher) fetchOCI(ref string) ([]byte, error) {
+	registry, repository, reference, err := parseOCIReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	r := &registryClient{
+		fetcher:    f,
+		base:       fmt.Sprintf("https://%v/v2/%v", registry, repository),
+		repository: repository,
+	}
+
+	b, err := r.get("/manifests/"+reference, manifestMediaTypes)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(reference, "sha256:") {
+		if err := verifyDigest(b, reference); err != nil {
+			return nil, errors.Wrap(err, "manifest")
+		}
+	}
+
+	var m ociManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, errors.Wrap(err, "couldn't decode manifest")
+	}
+	layer, err := m.definitionLayer()
+	if err != nil {
+		return nil, err
+	}
+
+	if b, err = r.get("/blobs/"+layer.Digest, ""); err != nil {
+		return nil, err
+	}
+	return b, errors.Wrap(verifyDigest(b, layer.Digest), "plugin definition")
+}
+
+// definitionLayer returns the layer with the plugin definition.
+func (m ociManifest) definitionLayer() (ociDescriptor, error) {
+	for _, layer := range m.Layers {
+		if title := layer.Annotations[titleAnnotation]; strings.HasSuffix(title, ".yaml") || strings.HasSuffix(title, ".yml") {
+			return layer, nil
+		}
+	}
+	if len(m.Layers) == 1 {
+		return m.Layers[0], nil
+	}
+	return ociDescriptor{}, fmt.Errorf("artifact has %v layers, none titled *.yaml", len(m.Layers))
+}
+
+// parseOCIReference splits ref into its registry, repository and tag or
+// digest, which defaults to the latest tag.
+func parseOCIReference(ref string) (registry, repository, reference string, err error) {
+	slash := strings.Index(ref, "/")
+	if slash <= 0 {
+		return "", "", "", fmt.Errorf("OCI reference %q has no registry", ref)
+	}
+	registry, repository, reference = ref[:slash], ref[slash+1:], "latest"
+	if i := strings.Index(repository, "@"); i >= 0 {
+		repository, reference = repository[:i], repository[i+1:]
+	} else if i := strings.LastIndex(repository, ":"); i >= 0 {
+		repository, reference = repository[:i], repository[i+1:]
+	}
+	if repository == "" || reference == "" {
+		return "", "", "", fmt.Errorf("invalid OCI reference %q", ref)
+	}
+	return registry, repository, reference, nil
+}
+
+// verifyDigest returns an error if b doesn't have the given sha256 digest.
+func verifyDigest(b []byte, digest string) error {
+	if !strings.HasPrefix(digest, "sha256:") {
+		return fmt.Errorf("unsupported digest %q", digest)
+	}
+	if actual := "sha256:" + sum(string(b)); actual != digest {
+		return fmt.Errorf("has digest %v, not %v", actual, digest)
+	}
+	return nil
+}
+
+// registryClient gets from a repository of a registry, getting an anonymous
+// bearer token to pull from it if the registry asks for one.
+type registryClient struct {
+	fetcher    *Fetcher
+	base       string
+	repository string
+	token      string
+}
+
+func (r *registryClient) get(path, accept string) ([]byte, error) {
+	target := r.base + path
+	for {
+		authorization := ""
+		if r.token != "" {
+			authorization = "Bearer " + r.token
+		}
+		resp, err := r.fetcher.do(target, accept, authorization)
+		if err != nil {
+			return nil, err
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		if resp.StatusCode != http.StatusUnauthorized || r.token != "" || !strings.HasPrefix(challenge, "Bearer ") {
+			defer resp.Body.Close()
+			return readBody(resp)
+		}
+		resp.Body.Close()
+
+		if r.token, err = r.getToken(challenge); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// getToken gets an anonymous token to pull from the repository, as asked for
+// by a registry's Bearer challenge.
+func (r *registryClient) getToken(challenge string) (string, error) {
+	params := map[string]string{}
+	for _, match := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("registry challenge %q has no realm", challenge)
+	}
+	if params["scope"] == "" {
+		params["scope"] = fmt.Sprintf("repository:%v:pull", r.repository)
+	}
+
+	query := url.Values{"scope": {params["scope"]}}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	b, err := r.fetcher.get(params["realm"]+"?"+query.Encode(), "", "")
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't get registry token")
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(b, &token); err != nil {
+		return "", errors.Wrap(err, "couldn't decode registry token")
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", errors.New("registry gave no token")
+	}
+	return token.Token, nil
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package remote fetches plugin definitions from HTTPS URLs and OCI
+// registries, keeping a copy of each in a local cache.
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	httpsScheme = "https://"
+	ociScheme   = "oci://"
+
+	// checksumFragment pins the SHA-256 checksum of a definition, at the end
+	// of its reference.
+	checksumFragment = "#sha256="
+
+	// maxSize is the most that's read of a definition or an OCI manifest.
+	maxSize = 1 << 20
+)
+
+// IsRemote returns whether ref refers to a remote plugin definition, rather
+// than a plugin by name.
+func IsRemote(ref string) bool {
+	return strings.HasPrefix(ref, httpsScheme) || strings.HasPrefix(ref, ociScheme)
+}
+
+// Fetcher fetches remote plugin definitions.
+type Fetcher struct {
+	// CacheDir is where a copy of each definition is kept. Nothing is
+	// cached if it's empty.
+	CacheDir string
+	Client   *http.Client
+}
+
+// NewFetcher returns a Fetcher that caches definitions in cacheDir.
+func NewFetcher(cacheDir string) *Fetcher {
+	return &Fetcher{
+		CacheDir: cacheDir,
+		Client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Fetch returns the plugin definition ref refers to, which is an https:// URL
+// or an oci:// artifact reference (oci://registry/repository:tag or
+// oci://registry/repository@sha256:digest). Either can end in
+// #sha256=<checksum> to pin the checksum of the definition. Pinned
+// definitions, and those referenced by OCI digest, are read from the cache if
+// they're in it; anything else is fetched every time, refreshing the cache.
+func (f *Fetcher) Fetch(ref string) ([]byte, error) {
+	location, checksum := ref, ""
+	if i := strings.Index(ref, checksumFragment); i >= 0 {
+		location, checksum = ref[:i], strings.ToLower(ref[i+len(checksumFragment):])
+		if b, err := hex.DecodeString(checksum); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("invalid checksum %q for plugin %v", checksum, location)
+		}
+	}
+	if !IsRemote(location) {
+		return nil, fmt.Errorf("plugin %v isn't an %v or %v reference", location, httpsScheme, ociScheme)
+	}
+
+	cached := ""
+	if f.CacheDir != "" {
+		cached = filepath.Join(f.CacheDir, sum(location)+".yaml")
+	}
+	pinned := checksum != "" || (strings.HasPrefix(location, ociScheme) && strings.Contains(location, "@sha256:"))
+	if pinned && cached != "" {
+		if b, err := ioutil.ReadFile(cached); err == nil && verify(b, checksum) == nil {
+			return b, nil
+		}
+	}
+
+	var b []byte
+	var err error
+	if strings.HasPrefix(location, httpsScheme) {
+		b, err = f.get(location, "", "")
+	} else {
+		b, err = f.fetchOCI(strings.TrimPrefix(location, ociScheme))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't fetch plugin %v", location)
+	}
+	if err := verify(b, checksum); err != nil {
+		return nil, errors.Wrapf(err, "plugin %v", location)
+	}
+
+	if cached != "" {
+		if err := os.MkdirAll(f.CacheDir, 0755); err == nil {
+			err = ioutil.WriteFile(cached, b, 0644)
+		}
+		if err != nil {
+			logrus.Warningf("Couldn't cache plugin %v: %v", location, err)
+		}
+	}
+	return b, nil
+}
+
+// get fetches url, with the given Accept and Authorization headers if they're
+// set.
+func (f *Fetcher) get(url, accept, authorization string) ([]byte, error) {
+	resp, err := f.do(url, accept, authorization)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return readBody(resp)
+}
+
+// do requests url, leaving the response for the caller to check.
+func (f *Fetcher) do(url, accept, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := f.Client.Do(req)
+	return resp, errors.Wrapf(err, "couldn't get %v", url)
+}
+
+// readBody reads a successful response's body, up to maxSize.
+func readBody(resp *http.Response) ([]byte, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting %v: %v", resp.Request.URL, resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't read %v", resp.Request.URL)
+	}
+	if len(b) > maxSize {
+		return nil, fmt.Errorf("%v is larger than %v bytes", resp.Request.URL, maxSize)
+	}
+	return b, nil
+}
+
+// verify returns an error if checksum is set and isn't the SHA-256 checksum
+// of b.
+func verify(b []byte, checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+	if actual := sum(string(b)); actual != checksum {
+		return fmt.Errorf("has checksum %v, not the pinned %v", actual, checksum)
+	}
+	return nil
+}
+
+// sum returns the hex encoded SHA-256 checksum of s.
+func sum(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
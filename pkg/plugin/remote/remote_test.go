@@ -0,0 +1,178 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const definition = `sonobuoy-config:
+  driver: Job
+  plugin-name: kube-bench
+  result-type: kube-bench
+spec:
+  image: aquasec/kube-bench:latest
+  name: plugin
+`
+
+func newTestFetcher(t *testing.T, server *httptest.Server) *Fetcher {
+	dir, err := ioutil.TempDir("", "sonobuoy-plugin-cache")
+	if err != nil {
+		t.Fatalf("couldn't make cache dir: %v", err)
+	}
+	return &Fetcher{CacheDir: dir, Client: server.Client()}
+}
+
+func TestFetchHTTPS(t *testing.T) {
+	body := definition
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+	f := newTestFetcher(t, server)
+	defer os.RemoveAll(f.CacheDir)
+
+	ref := server.URL + "/kube-bench.yaml"
+	pinned := ref + checksumFragment + sum(definition)
+
+	for _, r := range []string{ref, pinned} {
+		b, err := f.Fetch(r)
+		if err != nil {
+			t.Fatalf("couldn't fetch %v: %v", r, err)
+		}
+		if string(b) != definition {
+			t.Errorf("expected the definition from %v, got %q", r, b)
+		}
+	}
+
+	if _, err := f.Fetch(ref + checksumFragment + sum("something else")); err == nil {
+		t.Error("expected an error for a mismatched checksum, got none")
+	}
+
+	// Pinned definitions come from the cache, while others are refetched.
+	body = "changed"
+	if b, err := f.Fetch(pinned); err != nil || string(b) != definition {
+		t.Errorf("expected the cached definition, got %q, %v", b, err)
+	}
+	if b, err := f.Fetch(ref); err != nil || string(b) != "changed" {
+		t.Errorf("expected the changed definition, got %q, %v", b, err)
+	}
+}
+
+func TestFetch_invalid(t *testing.T) {
+	f := NewFetcher("")
+	for _, ref := range []string{
+		"http://example.com/plugin.yaml",
+		"https://example.com/plugin.yaml#sha256=abc",
+		"oci://plugin",
+	} {
+		if _, err := f.Fetch(ref); err == nil {
+			t.Errorf("expected an error fetching %v, got none", ref)
+		}
+	}
+}
+
+func TestFetchOCI(t *testing.T) {
+	layerDigest := "sha256:" + sum(definition)
+	manifest, _ := json.Marshal(ociManifest{Layers: []ociDescriptor{
+		{MediaType: "application/vnd.oci.image.config.v1+json", Digest: "sha256:" + sum("{}")},
+		{MediaType: "application/yaml", Digest: layerDigest, Annotations: map[string]string{titleAnnotation: "kube-bench.yaml"}},
+	}})
+	manifestDigest := "sha256:" + sum(string(manifest))
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if r.URL.Query().Get("scope") != "repository:plugins/kube-bench:pull" {
+				t.Errorf("unexpected token scope %q", r.URL.Query().Get("scope"))
+			}
+			fmt.Fprint(w, `{"token":"secret"}`)
+		case r.Header.Get("Authorization") != "Bearer secret":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%v/token",service="registry"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/v2/plugins/kube-bench/manifests/v1", r.URL.Path == "/v2/plugins/kube-bench/manifests/"+manifestDigest:
+			w.Write(manifest)
+		case r.URL.Path == "/v2/plugins/kube-bench/blobs/"+layerDigest:
+			fmt.Fprint(w, definition)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	f := newTestFetcher(t, server)
+	defer os.RemoveAll(f.CacheDir)
+
+	registry := strings.TrimPrefix(server.URL, "https://")
+	for _, ref := range []string{
+		ociScheme + registry + "/plugins/kube-bench:v1",
+		ociScheme + registry + "/plugins/kube-bench@" + manifestDigest,
+	} {
+		b, err := f.Fetch(ref)
+		if err != nil {
+			t.Fatalf("couldn't fetch %v: %v", ref, err)
+		}
+		if string(b) != definition {
+			t.Errorf("expected the definition from %v, got %q", ref, b)
+		}
+	}
+
+	if _, err := f.Fetch(ociScheme + registry + "/plugins/kube-bench@sha256:" + sum("other")); err == nil {
+		t.Error("expected an error for a missing digest, got none")
+	}
+}
+
+func TestParseOCIReference(t *testing.T) {
+	testCases := []struct {
+		ref        string
+		registry   string
+		repository string
+		reference  string
+		expectErr  bool
+	}{
+		{ref: "ghcr.io/org/plugin", registry: "ghcr.io", repository: "org/plugin", reference: "latest"},
+		{ref: "localhost:5000/plugin:v1", registry: "localhost:5000", repository: "plugin", reference: "v1"},
+		{ref: "ghcr.io/org/plugin@sha256:abc", registry: "ghcr.io", repository: "org/plugin", reference: "sha256:abc"},
+		{ref: "plugin", expectErr: true},
+		{ref: "ghcr.io/", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ref, func(t *testing.T) {
+			registry, repository, reference, err := parseOCIReference(tc.ref)
+			if tc.expectErr {
+				if err == nil {
+					t.Error("expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if registry != tc.registry || repository != tc.repository || reference != tc.reference {
+				t.Errorf("expected %v %v %v, got %v %v %v", tc.registry, tc.repository, tc.reference, registry, repository, reference)
+			}
+		})
+	}
+}
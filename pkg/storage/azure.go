@@ -0,0 +1,233 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const azureAPIVersion = "2018-03-28"
+
+// azureBackend stores results in Azure Blob Storage. The account is read from
+// AZURE_STORAGE_ACCOUNT, and is authorized with either its shared key from
+// AZURE_STORAGE_KEY or a SAS token from AZURE_STORAGE_SAS_TOKEN.
+type azureBackend struct {
+	container string
+	account   string
+	key       []byte
+	sasToken  string
+	endpoint  string
+	client    *http.Client
+}
+
+func newAzure(c Config) (*azureBackend, error) {
+	b := &azureBackend{
+		container: c.Bucket,
+		account:   os.Getenv("AZURE_STORAGE_ACCOUNT"),
+		sasToken:  strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?"),
+		client:    http.DefaultClient,
+	}
+	if b.account == "" {
+		return nil, errors.New("AZURE_STORAGE_ACCOUNT must be set to store results in Azure")
+	}
+	if key := os.Getenv("AZURE_STORAGE_KEY"); key != "" {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't decode AZURE_STORAGE_KEY")
+		}
+		b.key = decoded
+	}
+	if b.key == nil && b.sasToken == "" {
+		return nil, errors.New("AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN must be set to store results in Azure")
+	}
+
+	b.endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", b.account)
+	if c.Endpoint != "" {
+		b.endpoint = strings.TrimSuffix(c.Endpoint, "/")
+	}
+	return b, nil
+}
+
+func (b *azureBackend) Location(name string) string {
+	return fmt.Sprintf("%s/%s/%s", b.endpoint, b.container, name)
+}
+
+func (b *azureBackend) Store(name string, r io.Reader, size int64) error {
+	blobURL := b.endpoint + "/" + awsEscape(b.container) + "/" + awsEscapePath(name)
+	if b.sasToken != "" {
+		blobURL += "?" + b.sasToken
+	}
+	req, err := http.NewRequest(http.MethodPut, blobURL, r)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't make request to store %v", b.Location(name))
+	}
+	req.ContentLength = size
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	if b.key != nil {
+		signSharedKey(req, b.account, b.key)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't store %v", b.Location(name))
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp, "storing "+b.Location(name))
+}
+
+// azureBlobs is a page of the response to a List Blobs request.
+type azureBlobs struct {
+	Blobs []struct {
+		Name          string `xml:"Name"`
+		LastModified  string `xml:"Properties>Last-Modified"`
+		ContentLength int64  `xml:"Properties>Content-Length"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+func (b *azureBackend) List(prefix string) ([]Object, error) {
+	var objects []Object
+	marker := ""
+	for {
+		query := url.Values{"restype": {"container"}, "comp": {"list"}, "prefix": {prefix}}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		var page azureBlobs
+		listURL := b.endpoint + "/" + awsEscape(b.container) + "?" + query.Encode()
+		if err := b.do(http.MethodGet, listURL, "listing "+b.Location(prefix), &page); err != nil {
+			return nil, err
+		}
+		for _, blob := range page.Blobs {
+			modified, err := time.Parse(http.TimeFormat, blob.LastModified)
+			if err != nil {
+				return nil, errors.Wrapf(err, "couldn't parse last modified time of %v", b.Location(blob.Name))
+			}
+			objects = append(objects, Object{Name: blob.Name, Size: blob.ContentLength, Modified: modified})
+		}
+		if page.NextMarker == "" {
+			return objects, nil
+		}
+		marker = page.NextMarker
+	}
+}
+
+func (b *azureBackend) Delete(name string) error {
+	blobURL := b.endpoint + "/" + awsEscape(b.container) + "/" + awsEscapePath(name)
+	return b.do(http.MethodDelete, blobURL, "deleting "+b.Location(name), nil)
+}
+
+// do makes an authorized request without a body, decoding the XML response
+// into out if it's given.
+func (b *azureBackend) do(method, requestURL, action string, out interface{}) error {
+	if b.sasToken != "" {
+		if strings.Contains(requestURL, "?") {
+			requestURL += "&" + b.sasToken
+		} else {
+			requestURL += "?" + b.sasToken
+		}
+	}
+	req, err := http.NewRequest(method, requestURL, nil)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't make request %v", action)
+	}
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	if b.key != nil {
+		signSharedKey(req, b.account, b.key)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "error %v", action)
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, action); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return errors.Wrapf(xml.NewDecoder(resp.Body).Decode(out), "couldn't decode response %v", action)
+}
+
+// signSharedKey authorizes req with the storage account's shared key.
+func signSharedKey(req *http.Request, account string, key []byte) {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	var msHeaders []string
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-ms-") {
+			msHeaders = append(msHeaders, name+":"+strings.TrimSpace(strings.Join(values, ",")))
+		}
+	}
+	sort.Strings(msHeaders)
+
+	resource := "/" + account + req.URL.EscapedPath()
+	query := req.URL.Query()
+	var params []string
+	for name, values := range query {
+		sort.Strings(values)
+		params = append(params, strings.ToLower(name)+":"+strings.Join(values, ","))
+	}
+	sort.Strings(params)
+	for _, param := range params {
+		resource += "\n" + param
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("content-encoding"),
+		req.Header.Get("content-language"),
+		contentLength,
+		req.Header.Get("content-md5"),
+		req.Header.Get("content-type"),
+		"", // Date, since x-ms-date is set instead
+		req.Header.Get("if-modified-since"),
+		req.Header.Get("if-match"),
+		req.Header.Get("if-none-match"),
+		req.Header.Get("if-unmodified-since"),
+		req.Header.Get("range"),
+		strings.Join(msHeaders, "\n"),
+		resource,
+	}, "\n")
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", account, signature))
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	gcsDefaultEndpoint = "https://storage.googleapis.com"
+	gcsScope           = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+// gcsBackend stores results in Google Cloud Storage, using the application
+// default credentials (such as GOOGLE_APPLICATION_CREDENTIALS, or the node's
+// service account).
+type gcsBackend struct {
+	bucket   string
+	endpoint string
+	client   *http.Client
+}
+
+func newGCS(c Config) (*gcsBackend, error) {
+	client, err := google.DefaultClient(context.Background(), gcsScope)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't find Google Cloud credentials to store results in GCS")
+	}
+
+	endpoint := gcsDefaultEndpoint
+	if c.Endpoint != "" {
+		endpoint = strings.TrimSuffix(c.Endpoint, "/")
+	}
+	return &gcsBackend{
+		bucket:   c.Bucket,
+		endpoint: endpoint,
+		client:   client,
+	}, nil
+}
+
+func (b *gcsBackend) Location(name string) string {
+	return fmt.Sprintf("gs://%s/%s", b.bucket, name)
+}
+
+func (b *gcsBackend) Store(name string, r io.Reader, size int64) error {
+	uploadURL := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		b.endpoint, url.PathEscape(b.bucket), url.QueryEscape(name))
+	req, err := http.NewRequest(http.MethodPost, uploadURL, r)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't make request to store %v", b.Location(name))
+	}
+	req.ContentLength = size
+	req.Header.Set("content-type", "application/gzip")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't store %v", b.Location(name))
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp, "storing "+b.Location(name))
+}
+
+// gcsObjects is a page of the response to an objects list request.
+type gcsObjects struct {
+	Items []struct {
+		Name    string    `json:"name"`
+		Size    string    `json:"size"`
+		Updated time.Time `json:"updated"`
+	} `json:"items"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+func (b *gcsBackend) List(prefix string) ([]Object, error) {
+	var objects []Object
+	pageToken := ""
+	for {
+		query := url.Values{"prefix": {prefix}}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		listURL := fmt.Sprintf("%s/storage/v1/b/%s/o?%s", b.endpoint, url.PathEscape(b.bucket), query.Encode())
+		var page gcsObjects
+		if err := b.do(http.MethodGet, listURL, "listing "+b.Location(prefix), &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			size, err := strconv.ParseInt(item.Size, 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "couldn't parse size of %v", b.Location(item.Name))
+			}
+			objects = append(objects, Object{Name: item.Name, Size: size, Modified: item.Updated})
+		}
+		if page.NextPageToken == "" {
+			return objects, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+func (b *gcsBackend) Delete(name string) error {
+	objectURL := fmt.Sprintf("%s/storage/v1/b/%s/o/%s", b.endpoint, url.PathEscape(b.bucket), url.PathEscape(name))
+	return b.do(http.MethodDelete, objectURL, "deleting "+b.Location(name), nil)
+}
+
+// do makes a request without a body, decoding the JSON response into out if
+// it's given.
+func (b *gcsBackend) do(method, requestURL, action string, out interface{}) error {
+	req, err := http.NewRequest(method, requestURL, nil)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't make request %v", action)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "error %v", action)
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, action); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(out), "couldn't decode response %v", action)
+}
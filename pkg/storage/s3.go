@@ -0,0 +1,282 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	s3Service       = "s3"
+	s3DefaultRegion = "us-east-1"
+	// s3UnsignedPayload lets an upload be signed without hashing it first,
+	// which would mean reading the whole tarball twice.
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat     = "20060102T150405Z"
+)
+
+// s3Backend stores results in S3, reading credentials from the standard
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment
+// variables.
+type s3Backend struct {
+	bucket       string
+	region       string
+	endpoint     string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+func newS3(c Config) (*s3Backend, error) {
+	b := &s3Backend{
+		bucket:       c.Bucket,
+		region:       c.Region,
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       http.DefaultClient,
+	}
+	if b.accessKey == "" || b.secretKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set to store results in S3")
+	}
+	if b.region == "" {
+		b.region = s3DefaultRegion
+	}
+
+	// A custom endpoint (such as for an S3 compatible service) is addressed
+	// with the bucket in the path, AWS itself with the bucket in the host.
+	if c.Endpoint != "" {
+		b.endpoint = strings.TrimSuffix(c.Endpoint, "/") + "/" + awsEscape(c.Bucket)
+	} else {
+		b.endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", c.Bucket, b.region)
+	}
+	return b, nil
+}
+
+func (b *s3Backend) Location(name string) string {
+	return fmt.Sprintf("s3://%s/%s", b.bucket, name)
+}
+
+func (b *s3Backend) Store(name string, r io.Reader, size int64) error {
+	req, err := http.NewRequest(http.MethodPut, b.endpoint+"/"+awsEscapePath(name), r)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't make request to store %v", b.Location(name))
+	}
+	req.ContentLength = size
+	req.Header.Set("x-amz-content-sha256", s3UnsignedPayload)
+	if b.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", b.sessionToken)
+	}
+	signV4(req, b.accessKey, b.secretKey, b.region, s3Service, time.Now())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't store %v", b.Location(name))
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp, "storing "+b.Location(name))
+}
+
+// s3ListResult is the response to a ListObjectsV2 request.
+type s3ListResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (b *s3Backend) List(prefix string) ([]Object, error) {
+	var objects []Object
+	continuation := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if continuation != "" {
+			query.Set("continuation-token", continuation)
+		}
+		var result s3ListResult
+		if err := b.do(http.MethodGet, "?"+query.Encode(), "listing "+b.Location(prefix), &result); err != nil {
+			return nil, err
+		}
+		for _, c := range result.Contents {
+			objects = append(objects, Object{Name: c.Key, Size: c.Size, Modified: c.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		continuation = result.NextContinuationToken
+	}
+}
+
+func (b *s3Backend) Delete(name string) error {
+	return b.do(http.MethodDelete, "/"+awsEscapePath(name), "deleting "+b.Location(name), nil)
+}
+
+// do makes a signed request without a body for the path under the bucket,
+// decoding the XML response into out if it's given.
+func (b *s3Backend) do(method, path, action string, out interface{}) error {
+	req, err := http.NewRequest(method, b.endpoint+path, nil)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't make request %v", action)
+	}
+	if req.URL.Path == "" {
+		req.URL.Path = "/"
+	}
+	req.Header.Set("x-amz-content-sha256", hexSHA256(nil))
+	if b.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", b.sessionToken)
+	}
+	signV4(req, b.accessKey, b.secretKey, b.region, s3Service, time.Now())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "error %v", action)
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp, action); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return errors.Wrapf(xml.NewDecoder(resp.Body).Decode(out), "couldn't decode response %v", action)
+}
+
+// signV4 signs req with AWS Signature Version 4, covering the host and every
+// header already set on req. The payload hash is taken from the
+// x-amz-content-sha256 header.
+func signV4(req *http.Request, accessKey, secretKey, region, service string, t time.Time) {
+	t = t.UTC()
+	req.Header.Set("x-amz-date", t.Format(amzDateFormat))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("x-amz-content-sha256"),
+	}, "\n")
+
+	date := t.Format("20060102")
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format(amzDateFormat),
+		scope,
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func canonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var params []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// awsEscape percent-encodes everything but the characters AWS leaves
+// unreserved.
+func awsEscape(s string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// awsEscapePath escapes each segment of an object key.
+func awsEscapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i := range segments {
+		segments[i] = awsEscape(segments[i])
+	}
+	return strings.Join(segments, "/")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
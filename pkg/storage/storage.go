@@ -0,0 +1,146 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package storage uploads results tarballs to object storage, so they can be
+// collected from there instead of being copied out of the aggregator pod.
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// S3Backend stores results in an Amazon S3 (or S3 compatible) bucket.
+	S3Backend = "s3"
+	// GCSBackend stores results in a Google Cloud Storage bucket.
+	GCSBackend = "gcs"
+	// AzureBackend stores results in an Azure Blob Storage container.
+	AzureBackend = "azure"
+)
+
+// Config is where results are stored, besides the aggregator's filesystem.
+// Credentials aren't part of the config; each backend reads them from the
+// environment.
+type Config struct {
+	// Backend is one of S3Backend, GCSBackend or AzureBackend. Empty means
+	// results are only kept on the aggregator's filesystem.
+	Backend string `json:"Backend" mapstructure:"Backend"`
+	// Bucket is the bucket, or for Azure the container, to store results in.
+	Bucket string `json:"Bucket" mapstructure:"Bucket"`
+	// Prefix is prepended to the name of each results tarball.
+	Prefix string `json:"Prefix,omitempty" mapstructure:"Prefix"`
+	// Region is the S3 region of the bucket.
+	Region string `json:"Region,omitempty" mapstructure:"Region"`
+	// Endpoint overrides the URL of the storage service, such as for an S3
+	// compatible service or an Azure account's blob endpoint.
+	Endpoint string `json:"Endpoint,omitempty" mapstructure:"Endpoint"`
+}
+
+// Validate returns an error if results can't be stored with the config.
+func (c Config) Validate() error {
+	switch c.Backend {
+	case "":
+		return nil
+	case S3Backend, GCSBackend, AzureBackend:
+	default:
+		return errors.Errorf("unknown storage backend %q", c.Backend)
+	}
+
+	if c.Bucket == "" {
+		return errors.Errorf("storage backend %v needs a bucket", c.Backend)
+	}
+	return nil
+}
+
+// Backend is somewhere results can be stored.
+type Backend interface {
+	// Store uploads size bytes read from r as name.
+	Store(name string, r io.Reader, size int64) error
+	// Location describes where name is stored, for users to find it.
+	Location(name string) string
+	// List returns the stored objects whose names start with prefix.
+	List(prefix string) ([]Object, error)
+	// Delete removes name.
+	Delete(name string) error
+}
+
+// Object is something stored in a backend.
+type Object struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+}
+
+// New returns the Backend for the config, or nil if it has none.
+func New(c Config) (Backend, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch c.Backend {
+	case S3Backend:
+		return newS3(c)
+	case GCSBackend:
+		return newGCS(c)
+	case AzureBackend:
+		return newAzure(c)
+	}
+	return nil, nil
+}
+
+// StoreFile uploads the file at filePath to the backend, named after the file
+// with the config's prefix, and returns where it was stored.
+func StoreFile(backend Backend, c Config, filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	name := StoredName(c, filePath)
+	if err := backend.Store(name, f, info.Size()); err != nil {
+		return "", errors.Wrapf(err, "couldn't store %v", filePath)
+	}
+	return backend.Location(name), nil
+}
+
+// StoredName is the name the file at filePath is stored as, with the config's
+// prefix.
+func StoredName(c Config, filePath string) string {
+	return path.Join(c.Prefix, path.Base(filePath))
+}
+
+// checkResponse returns an error describing resp if it isn't a success. The
+// action is what the request was doing, such as "storing s3://results/x".
+func checkResponse(resp *http.Response, action string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return errors.Errorf("got a %v response %v: %s", resp.StatusCode, action, body)
+}
@@ -22,6 +22,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"path/filepath"
 
 	"github.com/pkg/errors"
 )
@@ -83,3 +84,94 @@ func DecodeTarball(reader io.Reader, baseDir string) error {
 
 	return nil
 }
+
+// EncodeTarball writes a gzipped tarball of the contents of baseDir to writer.
+// Paths in the archive are relative to baseDir. Like DecodeTarball, only
+// directories, regular files and symlinks are supported; anything else is skipped.
+func EncodeTarball(writer io.Writer, baseDir string) error {
+	names, err := ListFiles(baseDir)
+	if err != nil {
+		return err
+	}
+	return EncodeFiles(writer, baseDir, names)
+}
+
+// ListFiles returns the paths, relative to baseDir, of everything
+// EncodeTarball would archive from baseDir, in the order it would archive them.
+func ListFiles(baseDir string) ([]string, error) {
+	names := []string{}
+	err := filepath.Walk(baseDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(baseDir, filePath)
+		if err != nil {
+			return err
+		}
+		if name != "." {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names, errors.Wrapf(err, "couldn't list files in %v", baseDir)
+}
+
+// EncodeFiles writes a gzipped tarball of the given paths, relative to
+// baseDir, to writer. Paths that no longer exist are skipped, so a list taken
+// from ListFiles can be archived after the directory has changed.
+func EncodeFiles(writer io.Writer, baseDir string, names []string) error {
+	gzStream := gzip.NewWriter(writer)
+	tarchive := tar.NewWriter(gzStream)
+
+	for _, name := range names {
+		if err := encodeFile(tarchive, baseDir, name); err != nil {
+			return errors.Wrapf(err, "couldn't encode tarball for %v", baseDir)
+		}
+	}
+
+	if err := tarchive.Close(); err != nil {
+		return errors.Wrap(err, "couldn't close tarball")
+	}
+	return errors.Wrap(gzStream.Close(), "couldn't close gzip stream")
+}
+
+// encodeFile adds a single path, relative to baseDir, to the archive.
+func encodeFile(tarchive *tar.Writer, baseDir, name string) error {
+	filePath := filepath.Join(baseDir, name)
+	info, err := os.Lstat(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(filePath); err != nil {
+			return err
+		}
+	} else if !info.IsDir() && !info.Mode().IsRegular() {
+		return nil
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(name)
+	if err := tarchive.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.CopyN(tarchive, file, header.Size)
+	return err
+}
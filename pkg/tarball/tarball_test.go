@@ -149,3 +149,44 @@ func TestDecodeTarball(t *testing.T) {
 		})
 	}
 }
+
+func TestEncodeFiles_removed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy-tarball")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"kept", "removed"} {
+		if err := ioutil.WriteFile(path.Join(dir, name), []byte(stoppingByTheWoods), 0644); err != nil {
+			t.Fatalf("couldn't write %v: %v", name, err)
+		}
+	}
+	names, err := ListFiles(dir)
+	if err != nil {
+		t.Fatalf("couldn't list files: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"kept", "removed"}) {
+		t.Fatalf("expected kept and removed to be listed, got %v", names)
+	}
+	if err := os.Remove(path.Join(dir, "removed")); err != nil {
+		t.Fatalf("couldn't remove file: %v", err)
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := EncodeFiles(buffer, dir, names); err != nil {
+		t.Fatalf("couldn't encode files: %v", err)
+	}
+
+	out, err := ioutil.TempDir("", "sonobuoy-tarball")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(out)
+	if err := DecodeTarball(buffer, out); err != nil {
+		t.Fatalf("couldn't decode tarball: %v", err)
+	}
+	if got, err := ListFiles(out); err != nil || !reflect.DeepEqual(got, []string{"kept"}) {
+		t.Errorf("expected only kept in the tarball, got %v (%v)", got, err)
+	}
+}
@@ -18,26 +18,100 @@ package templates
 
 // Manifest is the template found in examples
 var Manifest = NewTemplate("manifest", `
+{{- if not .NamespaceScoped }}
 ---
 apiVersion: v1
 kind: Namespace
 metadata:
+  {{- if .Annotations }}
+  annotations:
+    {{.Annotations | indent 4}}
+  {{- end }}
+  labels:
+    component: sonobuoy
+    {{- if .PrivilegedNamespace }}
+    pod-security.kubernetes.io/enforce: privileged
+    {{- end }}
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
   name: {{.Namespace}}
+{{- end }}
 ---
 apiVersion: v1
 kind: ServiceAccount
 metadata:
+  {{- if .Annotations }}
+  annotations:
+    {{.Annotations | indent 4}}
+  {{- end }}
+  labels:
+    component: sonobuoy
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
+  name: sonobuoy-serviceaccount
+  namespace: {{.Namespace}}
+{{- if and .EnableRBAC .NamespaceScoped }}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  {{- if .Annotations }}
+  annotations:
+    {{.Annotations | indent 4}}
+  {{- end }}
+  labels:
+    component: sonobuoy
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
+  name: sonobuoy-serviceaccount
+  namespace: {{.Namespace}}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: sonobuoy-serviceaccount
+subjects:
+- kind: ServiceAccount
+  name: sonobuoy-serviceaccount
+  namespace: {{.Namespace}}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  {{- if .Annotations }}
+  annotations:
+    {{.Annotations | indent 4}}
+  {{- end }}
   labels:
     component: sonobuoy
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
   name: sonobuoy-serviceaccount
   namespace: {{.Namespace}}
-{{- if .EnableRBAC }}
+rules:
+- apiGroups:
+  - '*'
+  resources:
+  - '*'
+  verbs:
+  - '*'
+{{- else if .EnableRBAC }}
 ---
 apiVersion: rbac.authorization.k8s.io/v1
 kind: ClusterRoleBinding
 metadata:
+  {{- if .Annotations }}
+  annotations:
+    {{.Annotations | indent 4}}
+  {{- end }}
   labels:
     component: sonobuoy
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
   name: sonobuoy-serviceaccount-{{.Namespace}}
 roleRef:
   apiGroup: rbac.authorization.k8s.io
@@ -51,8 +125,15 @@ subjects:
 apiVersion: rbac.authorization.k8s.io/v1
 kind: ClusterRole
 metadata:
+  {{- if .Annotations }}
+  annotations:
+    {{.Annotations | indent 4}}
+  {{- end }}
   labels:
     component: sonobuoy
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
   name: sonobuoy-serviceaccount
 rules:
 - apiGroups:
@@ -69,10 +150,37 @@ data:
     {{.SonobuoyConfig}}
 kind: ConfigMap
 metadata:
+  {{- if .Annotations }}
+  annotations:
+    {{.Annotations | indent 4}}
+  {{- end }}
   labels:
     component: sonobuoy
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
   name: sonobuoy-config-cm
   namespace: {{.Namespace}}
+{{- if .E2ERepoList }}
+---
+apiVersion: v1
+data:
+  repo-list.yaml: |
+    {{.E2ERepoList | indent 4}}
+kind: ConfigMap
+metadata:
+  {{- if .Annotations }}
+  annotations:
+    {{.Annotations | indent 4}}
+  {{- end }}
+  labels:
+    component: sonobuoy
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
+  name: sonobuoy-e2e-repo-list
+  namespace: {{.Namespace}}
+{{- end }}
 ---
 apiVersion: v1
 data:
@@ -81,12 +189,25 @@ data:
       driver: Job
       plugin-name: e2e
       result-type: e2e
+      result-processors:
+      - junit-summary
+      - junit-failures
+      result-format: junit
+      service-account-token: {}
     spec:
       env:
       - name: E2E_FOCUS
         value: "{{.E2EFocus}}"
       - name: E2E_SKIP
         value: "{{.E2ESkip}}"
+      {{- if .E2EParallel }}
+      - name: E2E_PARALLEL
+        value: "{{.E2EParallel}}"
+      {{- end }}
+      {{- if .E2ERepoList }}
+      - name: KUBE_TEST_REPO_LIST
+        value: /etc/sonobuoy-e2e/repo-list.yaml
+      {{- end }}
       command: ["/run_e2e.sh"]
       image: gcr.io/heptio-images/kube-conformance:latest
       imagePullPolicy: {{.ImagePullPolicy}}
@@ -95,6 +216,17 @@ data:
       - mountPath: /tmp/results
         name: results
         readOnly: false
+      {{- if .E2ERepoList }}
+      - mountPath: /etc/sonobuoy-e2e
+        name: e2e-repo-list
+        readOnly: true
+      {{- end }}
+    {{- if .E2ERepoList }}
+    extra-volumes:
+    - configMap:
+        name: sonobuoy-e2e-repo-list
+      name: e2e-repo-list
+    {{- end }}
   systemd-logs.yaml: |
     sonobuoy-config:
       driver: DaemonSet
@@ -123,20 +255,360 @@ data:
       - mountPath: /node
         name: root
         readOnly: false
+  node-diagnostics.yaml: |
+    sonobuoy-config:
+      driver: DaemonSet
+      plugin-name: node-diagnostics
+      result-type: node_diagnostics
+    spec:
+      command: ["/bin/sh", "-c", "/get_node_diagnostics.sh && sleep 3600"]
+      env:
+      - name: NODE_NAME
+        valueFrom:
+          fieldRef:
+            fieldPath: spec.nodeName
+      - name: RESULTS_DIR
+        value: /tmp/results
+      - name: CHROOT_DIR
+        value: /node
+      image: gcr.io/heptio-images/sonobuoy-plugin-node-diagnostics:latest
+      imagePullPolicy: {{.ImagePullPolicy}}
+      name: sonobuoy-node-diagnostics-config
+      securityContext:
+        privileged: true
+      volumeMounts:
+      - mountPath: /tmp/results
+        name: results
+        readOnly: false
+      - mountPath: /node
+        name: root
+        readOnly: true
+  kube-bench.yaml: |
+    sonobuoy-config:
+      driver: DaemonSet
+      plugin-name: kube-bench
+      result-type: kube-bench
+      result-processors:
+      - kube-bench-summary
+    spec:
+      command: ["/bin/sh", "-c", "/run_kube_bench.sh && sleep 3600"]
+      env:
+      - name: RESULTS_DIR
+        value: /tmp/results
+      image: gcr.io/heptio-images/sonobuoy-plugin-kube-bench:latest
+      imagePullPolicy: {{.ImagePullPolicy}}
+      name: sonobuoy-kube-bench
+      volumeMounts:
+      - mountPath: /tmp/results
+        name: results
+        readOnly: false
+      - mountPath: /etc/kubernetes
+        name: etc-kubernetes
+        readOnly: true
+      - mountPath: /etc/systemd
+        name: etc-systemd
+        readOnly: true
+      - mountPath: /var/lib/etcd
+        name: var-lib-etcd
+        readOnly: true
+      - mountPath: /var/lib/kubelet
+        name: var-lib-kubelet
+        readOnly: true
+      - mountPath: /usr/local/mount-from-host/bin
+        name: usr-bin
+        readOnly: true
+    extra-volumes:
+    - hostPath:
+        path: /etc/kubernetes
+      name: etc-kubernetes
+    - hostPath:
+        path: /etc/systemd
+      name: etc-systemd
+    - hostPath:
+        path: /var/lib/etcd
+      name: var-lib-etcd
+    - hostPath:
+        path: /var/lib/kubelet
+      name: var-lib-kubelet
+    - hostPath:
+        path: /usr/bin
+      name: usr-bin
+  network-connectivity.yaml: |
+    sonobuoy-config:
+      driver: DaemonSet
+      plugin-name: network-connectivity
+      result-type: network_connectivity
+      rbac:
+        rules:
+        - apiGroups: ["apps"]
+          resources: ["daemonsets"]
+          verbs: ["get", "create"]
+        - apiGroups: [""]
+          resources: ["services"]
+          verbs: ["get", "create"]
+        - apiGroups: [""]
+          resources: ["pods"]
+          verbs: ["list"]
+    spec:
+      command: ["/bin/sh", "-c", "/sonobuoy network-check && sleep 3600"]
+      env:
+      - name: NODE_NAME
+        valueFrom:
+          fieldRef:
+            fieldPath: spec.nodeName
+      - name: NAMESPACE
+        valueFrom:
+          fieldRef:
+            fieldPath: metadata.namespace
+      - name: SONOBUOY_IMAGE
+        value: {{.SonobuoyImage}}
+      - name: IMAGE_PULL_POLICY
+        value: {{.ImagePullPolicy}}
+      - name: RESULTS_DIR
+        value: /tmp/results
+      image: {{.SonobuoyImage}}
+      imagePullPolicy: {{.ImagePullPolicy}}
+      name: sonobuoy-network-connectivity
+      volumeMounts:
+      - mountPath: /tmp/results
+        name: results
+        readOnly: false
+  {{- range .CustomPlugins }}
+  {{.Name}}.yaml: |
+    {{.Definition | indent 4}}
+  {{- end }}
 kind: ConfigMap
 metadata:
+  {{- if .Annotations }}
+  annotations:
+    {{.Annotations | indent 4}}
+  {{- end }}
   labels:
     component: sonobuoy
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
   name: sonobuoy-plugins-cm
   namespace: {{.Namespace}}
+{{- if .CertManagerIssuer }}
+---
+apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  {{- if .Annotations }}
+  annotations:
+    {{.Annotations | indent 4}}
+  {{- end }}
+  labels:
+    component: sonobuoy
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
+  name: sonobuoy-aggregator
+  namespace: {{.Namespace}}
+spec:
+  secretName: sonobuoy-aggregator-tls
+  dnsNames:
+  - sonobuoy-master
+  - sonobuoy-master.{{.Namespace}}
+  - sonobuoy-master.{{.Namespace}}.svc
+  - sonobuoy-master.{{.Namespace}}.svc.cluster.local
+  usages:
+  - server auth
+  - digital signature
+  - key encipherment
+  issuerRef:
+    group: cert-manager.io
+    kind: {{.CertManagerIssuer.Kind}}
+    name: {{.CertManagerIssuer.Name}}
+{{- end }}
+{{- if .Schedule }}
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  {{- if .Annotations }}
+  annotations:
+    {{.Annotations | indent 4}}
+  {{- end }}
+  labels:
+    component: sonobuoy
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
+  name: sonobuoy-results
+  namespace: {{.Namespace}}
+spec:
+  accessModes:
+  - ReadWriteOnce
+  resources:
+    requests:
+      storage: {{.ResultsVolumeSize}}
+---
+apiVersion: batch/v1beta1
+kind: CronJob
+metadata:
+  {{- if .Annotations }}
+  annotations:
+    {{.Annotations | indent 4}}
+  {{- end }}
+  labels:
+    component: sonobuoy
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
+  name: sonobuoy
+  namespace: {{.Namespace}}
+spec:
+  schedule: '{{.Schedule}}'
+  concurrencyPolicy: Forbid
+  jobTemplate:
+    spec:
+      backoffLimit: 0
+      template:
+        metadata:
+          {{- if or .MetricsPort .Annotations .RestrictedUser }}
+          annotations:
+            {{- if .MetricsPort }}
+            prometheus.io/scrape: "true"
+            prometheus.io/port: "{{.MetricsPort}}"
+            {{- end }}
+            {{- if .RestrictedUser }}
+            seccomp.security.alpha.kubernetes.io/pod: runtime/default
+            {{- end }}
+            {{- if .Annotations }}
+            {{.Annotations | indent 12}}
+            {{- end }}
+          {{- end }}
+          labels:
+            component: sonobuoy
+            run: sonobuoy-master
+            tier: analysis
+            {{- if .Labels }}
+            {{.Labels | indent 12}}
+            {{- end }}
+        spec:
+          containers:
+          - command:
+            - /bin/bash
+            - -c
+            - /sonobuoy master -v 3 --logtostderr
+            env:
+            - name: SONOBUOY_ADVERTISE_IP
+              valueFrom:
+                fieldRef:
+                  fieldPath: status.podIP
+            {{- if .PodIPs }}
+            - name: SONOBUOY_ADVERTISE_IPS
+              valueFrom:
+                fieldRef:
+                  fieldPath: status.podIPs
+            {{- end }}
+            {{- if .StorageSecret }}
+            envFrom:
+            - secretRef:
+                name: {{.StorageSecret}}
+            {{- end }}
+            image: {{.SonobuoyImage}}
+            imagePullPolicy: {{.ImagePullPolicy}}
+            name: kube-sonobuoy
+            readinessProbe:
+              tcpSocket:
+                port: {{.AggregatorPort}}
+            {{- if .RestrictedUser }}
+            securityContext:
+              allowPrivilegeEscalation: false
+              capabilities:
+                drop:
+                - ALL
+            {{- end }}
+            {{- if or .AggregatorResources.Requests .AggregatorResources.Limits }}
+            resources:
+              {{- if .AggregatorResources.Limits }}
+              limits:
+                {{- range $name, $quantity := .AggregatorResources.Limits }}
+                {{$name}}: "{{$quantity}}"
+                {{- end }}
+              {{- end }}
+              {{- if .AggregatorResources.Requests }}
+              requests:
+                {{- range $name, $quantity := .AggregatorResources.Requests }}
+                {{$name}}: "{{$quantity}}"
+                {{- end }}
+              {{- end }}
+            {{- end }}
+            volumeMounts:
+            - mountPath: /etc/sonobuoy
+              name: sonobuoy-config-volume
+            - mountPath: /plugins.d
+              name: sonobuoy-plugins-volume
+            - mountPath: /tmp/sonobuoy
+              name: output-volume
+            {{- if .CertManagerIssuer }}
+            - mountPath: /etc/sonobuoy-tls
+              name: sonobuoy-tls-volume
+              readOnly: true
+            {{- end }}
+          {{- if .ImagePullSecrets }}
+          imagePullSecrets:
+          {{- range .ImagePullSecrets }}
+          - name: {{.}}
+          {{- end }}
+          {{- end }}
+          restartPolicy: Never
+          serviceAccountName: sonobuoy-serviceaccount
+          {{- if .RestrictedUser }}
+          securityContext:
+            fsGroup: {{.RestrictedUser}}
+            runAsNonRoot: true
+            runAsUser: {{.RestrictedUser}}
+          {{- end }}
+          {{- if .PriorityClassName }}
+          priorityClassName: {{.PriorityClassName}}
+          {{- end }}
+          {{- if .RuntimeClassName }}
+          runtimeClassName: {{.RuntimeClassName}}
+          {{- end }}
+          volumes:
+          - configMap:
+              name: sonobuoy-config-cm
+            name: sonobuoy-config-volume
+          - configMap:
+              name: sonobuoy-plugins-cm
+            name: sonobuoy-plugins-volume
+          - persistentVolumeClaim:
+              claimName: sonobuoy-results
+            name: output-volume
+          {{- if .CertManagerIssuer }}
+          - name: sonobuoy-tls-volume
+            secret:
+              secretName: sonobuoy-aggregator-tls
+          {{- end }}
+{{- else }}
 ---
 apiVersion: v1
 kind: Pod
 metadata:
+  {{- if or .MetricsPort .Annotations .RestrictedUser }}
+  annotations:
+    {{- if .MetricsPort }}
+    prometheus.io/scrape: "true"
+    prometheus.io/port: "{{.MetricsPort}}"
+    {{- end }}
+    {{- if .RestrictedUser }}
+    seccomp.security.alpha.kubernetes.io/pod: runtime/default
+    {{- end }}
+    {{- if .Annotations }}
+    {{.Annotations | indent 4}}
+    {{- end }}
+  {{- end }}
   labels:
     component: sonobuoy
     run: sonobuoy-master
     tier: analysis
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
   name: sonobuoy
   namespace: {{.Namespace}}
 spec:
@@ -150,9 +622,45 @@ spec:
       valueFrom:
         fieldRef:
           fieldPath: status.podIP
+    {{- if .PodIPs }}
+    - name: SONOBUOY_ADVERTISE_IPS
+      valueFrom:
+        fieldRef:
+          fieldPath: status.podIPs
+    {{- end }}
+    {{- if .StorageSecret }}
+    envFrom:
+    - secretRef:
+        name: {{.StorageSecret}}
+    {{- end }}
     image: {{.SonobuoyImage}}
     imagePullPolicy: {{.ImagePullPolicy}}
     name: kube-sonobuoy
+    readinessProbe:
+      tcpSocket:
+        port: {{.AggregatorPort}}
+    {{- if .RestrictedUser }}
+    securityContext:
+      allowPrivilegeEscalation: false
+      capabilities:
+        drop:
+        - ALL
+    {{- end }}
+    {{- if or .AggregatorResources.Requests .AggregatorResources.Limits }}
+    resources:
+      {{- if .AggregatorResources.Limits }}
+      limits:
+        {{- range $name, $quantity := .AggregatorResources.Limits }}
+        {{$name}}: "{{$quantity}}"
+        {{- end }}
+      {{- end }}
+      {{- if .AggregatorResources.Requests }}
+      requests:
+        {{- range $name, $quantity := .AggregatorResources.Requests }}
+        {{$name}}: "{{$quantity}}"
+        {{- end }}
+      {{- end }}
+    {{- end }}
     volumeMounts:
     - mountPath: /etc/sonobuoy
       name: sonobuoy-config-volume
@@ -160,31 +668,104 @@ spec:
       name: sonobuoy-plugins-volume
     - mountPath: /tmp/sonobuoy
       name: output-volume
+    {{- if .CertManagerIssuer }}
+    - mountPath: /etc/sonobuoy-tls
+      name: sonobuoy-tls-volume
+      readOnly: true
+    {{- end }}
+  {{- if .ShipPlugins }}
+  initContainers:
+  - command:
+    - /bin/sh
+    - -c
+    - cp /plugins-cm/* /plugins.d/ && i=0 && until [ -f /plugins.d/.shipped ]; do i=$((i+1)); [ $i -le 600 ] || exit 1; sleep 1; done && rm /plugins.d/.shipped
+    image: {{.SonobuoyImage}}
+    imagePullPolicy: {{.ImagePullPolicy}}
+    name: sonobuoy-plugins
+    {{- if .RestrictedUser }}
+    securityContext:
+      allowPrivilegeEscalation: false
+      capabilities:
+        drop:
+        - ALL
+    {{- end }}
+    volumeMounts:
+    - mountPath: /plugins-cm
+      name: sonobuoy-plugins-cm-volume
+    - mountPath: /plugins.d
+      name: sonobuoy-plugins-volume
+  {{- end }}
+  {{- if .ImagePullSecrets }}
+  imagePullSecrets:
+  {{- range .ImagePullSecrets }}
+  - name: {{.}}
+  {{- end }}
+  {{- end }}
   restartPolicy: Never
   serviceAccountName: sonobuoy-serviceaccount
+  {{- if .RestrictedUser }}
+  securityContext:
+    fsGroup: {{.RestrictedUser}}
+    runAsNonRoot: true
+    runAsUser: {{.RestrictedUser}}
+  {{- end }}
+  {{- if .PriorityClassName }}
+  priorityClassName: {{.PriorityClassName}}
+  {{- end }}
+  {{- if .RuntimeClassName }}
+  runtimeClassName: {{.RuntimeClassName}}
+  {{- end }}
   volumes:
   - configMap:
       name: sonobuoy-config-cm
     name: sonobuoy-config-volume
+  {{- if .ShipPlugins }}
   - configMap:
       name: sonobuoy-plugins-cm
+    name: sonobuoy-plugins-cm-volume
+  - emptyDir: {}
     name: sonobuoy-plugins-volume
+  {{- else }}
+  - configMap:
+      name: sonobuoy-plugins-cm
+    name: sonobuoy-plugins-volume
+  {{- end }}
   - emptyDir: {}
     name: output-volume
+  {{- if .CertManagerIssuer }}
+  - name: sonobuoy-tls-volume
+    secret:
+      secretName: sonobuoy-aggregator-tls
+  {{- end }}
+{{- end }}
 ---
 apiVersion: v1
 kind: Service
 metadata:
+  {{- if .Annotations }}
+  annotations:
+    {{.Annotations | indent 4}}
+  {{- end }}
   labels:
     component: sonobuoy
     run: sonobuoy-master
+    {{- if .Labels }}
+    {{.Labels | indent 4}}
+    {{- end }}
   name: sonobuoy-master
   namespace: {{.Namespace}}
 spec:
   ports:
-  - port: 8080
+  - name: aggregator
+    port: {{.AggregatorPort}}
+    protocol: TCP
+    targetPort: {{.AggregatorPort}}
+  {{- if .MetricsPort }}
+  - name: metrics
+    port: {{.MetricsPort}}
     protocol: TCP
-    targetPort: 8080
+    targetPort: {{.MetricsPort}}
+  {{- end }}
   selector:
     run: sonobuoy-master
   type: ClusterIP
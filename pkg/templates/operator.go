@@ -0,0 +1,105 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package templates
+
+// Operator is the template for the SonobuoyRun custom resource definition and
+// the deployment of the operator that runs them, generated by
+// `sonobuoy operator manifest`. The operator is labelled apart from runs, so
+// `sonobuoy delete --all` leaves it alone.
+var Operator = NewTemplate("operator", `---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  labels:
+    component: sonobuoy-operator
+  name: {{.Plural}}.{{.Group}}
+spec:
+  group: {{.Group}}
+  version: {{.Version}}
+  scope: Namespaced
+  names:
+    kind: {{.Kind}}
+    listKind: {{.Kind}}List
+    plural: {{.Plural}}
+    singular: {{.Singular}}
+  additionalPrinterColumns:
+  - name: Phase
+    type: string
+    JSONPath: .status.phase
+  - name: Age
+    type: date
+    JSONPath: .metadata.creationTimestamp
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  labels:
+    component: sonobuoy-operator
+  name: {{.Namespace}}
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  labels:
+    component: sonobuoy-operator
+  name: sonobuoy-operator
+  namespace: {{.Namespace}}
+---
+# Sonobuoy runs need cluster-wide permissions, which the operator can only
+# grant them if it has them itself.
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  labels:
+    component: sonobuoy-operator
+  name: sonobuoy-operator-{{.Namespace}}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-admin
+subjects:
+- kind: ServiceAccount
+  name: sonobuoy-operator
+  namespace: {{.Namespace}}
+---
+apiVersion: apps/v1beta2
+kind: Deployment
+metadata:
+  labels:
+    component: sonobuoy-operator
+  name: sonobuoy-operator
+  namespace: {{.Namespace}}
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      component: sonobuoy-operator
+  template:
+    metadata:
+      labels:
+        component: sonobuoy-operator
+    spec:
+      serviceAccountName: sonobuoy-operator
+      containers:
+      - name: sonobuoy-operator
+        command:
+        - /sonobuoy
+        - operator
+        - --interval={{.Interval}}
+        image: {{.Image}}
+        imagePullPolicy: {{.ImagePullPolicy}}
+`)
@@ -0,0 +1,108 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package templates
+
+// PluginDefinition is the template for the definition of a new plugin,
+// scaffolded by `sonobuoy gen plugin`.
+var PluginDefinition = NewTemplate("pluginDefinition", `---
+sonobuoy-config:
+  driver: {{.Driver}}
+  plugin-name: {{.Name}}
+  result-type: {{.Name}}
+  {{- if eq .Driver "Deployment" }}
+  # The Deployment driver keeps the plugin running for this long.
+  duration-seconds: 600
+  {{- end }}
+spec:
+  command:
+  - /run.sh
+  env:
+  - name: RESULTS_DIR
+    value: /tmp/results
+  {{- if ne .Driver "Job" }}
+  - name: NODE_NAME
+    valueFrom:
+      fieldRef:
+        fieldPath: spec.nodeName
+  {{- end }}
+  image: {{.Image}}
+  imagePullPolicy: Always
+  name: {{.Name}}
+  volumeMounts:
+  - mountPath: /tmp/results
+    name: results
+    readOnly: false
+`)
+
+// PluginEntrypoint is the template for an example entrypoint of a new
+// plugin's container, which follows the contract with the Sonobuoy worker.
+var PluginEntrypoint = NewTemplate("pluginEntrypoint", `#!/bin/sh
+# Entrypoint for the {{.Name}} Sonobuoy plugin. Copy it into the plugin's
+# image as /run.sh, then replace run_tests with whatever the plugin does.
+#
+# The contract with Sonobuoy is simple: write results into RESULTS_DIR, then
+# write the path of the results (a file, a directory, or a list of files) to
+# RESULTS_DIR/done. The Sonobuoy worker waits for the done file and sends the
+# results it names to the aggregator.
+
+set -e
+
+RESULTS_DIR="${RESULTS_DIR:-/tmp/results}"
+mkdir -p "${RESULTS_DIR}"
+
+run_tests() {
+    # Results can be in any format. JUnit XML files (ending in .xml) are
+    # understood by "sonobuoy results".
+    cat > "${RESULTS_DIR}/junit.xml" <<EOT
+<testsuite name="{{.Name}}" tests="1" failures="0">
+  <testcase name="example test" classname="{{.Name}}"></testcase>
+</testsuite>
+EOT
+}
+
+report() {
+    echo -n "${RESULTS_DIR}/junit.xml" > "${RESULTS_DIR}/done"
+}
+{{- if eq .Driver "Deployment" }}
+
+# Deployment plugins report every time the done file is written, and the
+# worker removes it once the results are sent, so report periodically until
+# the plugin's duration-seconds are up.
+while true; do
+    run_tests || true
+    report
+    while [ -f "${RESULTS_DIR}/done" ]; do
+        sleep 5
+    done
+    sleep 60
+done
+{{- else }}
+
+# Always write the done file, even if the tests fail, so that the results
+# and the failure are reported instead of the plugin timing out.
+trap report EXIT
+run_tests
+{{- if eq .Driver "DaemonSet" }}
+
+# DaemonSet plugins report once per node (${NODE_NAME}). Their pods must keep
+# running after reporting, or Kubernetes restarts them and they report again.
+report
+trap - EXIT
+exec sleep 3600
+{{- end }}
+{{- end }}
+`)
@@ -0,0 +1,284 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/buildinfo"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// exportInterval is how often finished spans are sent to the collector.
+	exportInterval = 5 * time.Second
+	// exportTimeout limits how long an export, and flushing the last spans
+	// on shutdown, can take.
+	exportTimeout = 10 * time.Second
+)
+
+// maxQueuedSpans limits how many finished spans are held on to while the
+// collector can't be reached. Any more are dropped.
+const maxQueuedSpans = 2048
+
+// Tracer records spans and periodically exports the finished ones. A nil
+// *Tracer records nothing, so tracing can be left unconfigured.
+type Tracer struct {
+	url      string
+	resource map[string]string
+	client   *http.Client
+
+	mutex   sync.Mutex
+	spans   []*Span
+	dropped int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewTracer returns a tracer exporting spans to the OTLP/HTTP collector at
+// endpoint, as the given service, with the attributes of the process
+// producing them. It returns nil, which traces nothing, if endpoint is empty.
+func NewTracer(endpoint, service string, attrs map[string]string) *Tracer {
+	return NewTracerWithTransport(endpoint, service, attrs, nil)
+}
+
+// NewTracerWithTransport is NewTracer, but exports spans through transport if
+// it isn't nil. Otherwise the tracer has a transport of its own, taking
+// proxies from the environment, rather than sharing the default one.
+func NewTracerWithTransport(endpoint, service string, attrs map[string]string, transport http.RoundTripper) *Tracer {
+	if endpoint == "" {
+		return nil
+	}
+	if transport == nil {
+		transport = &http.Transport{Proxy: http.ProxyFromEnvironment}
+	}
+
+	resource := map[string]string{
+		"service.name":    service,
+		"service.version": buildinfo.Version,
+	}
+	for key, value := range attrs {
+		resource[key] = value
+	}
+
+	t := &Tracer{
+		url:      strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		resource: resource,
+		client:   &http.Client{Transport: transport, Timeout: exportTimeout},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.exportLoop()
+	return t
+}
+
+// Shutdown exports any spans that have finished but haven't been exported
+// yet, and stops exporting.
+func (t *Tracer) Shutdown() {
+	if t == nil {
+		return
+	}
+	close(t.stop)
+	select {
+	case <-t.done:
+	case <-time.After(exportTimeout):
+		logrus.Warning("Timed out exporting the last trace spans")
+	}
+}
+
+func (t *Tracer) queue(span *Span) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.spans) >= maxQueuedSpans {
+		t.dropped++
+		return
+	}
+	t.spans = append(t.spans, span)
+}
+
+func (t *Tracer) exportLoop() {
+	defer close(t.done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.export()
+		case <-t.stop:
+			t.export()
+			return
+		}
+	}
+}
+
+// export sends the finished spans to the collector. Tracing is only
+// informational, so spans that can't be sent are dropped with a warning
+// rather than failing the run.
+func (t *Tracer) export() {
+	t.mutex.Lock()
+	spans, dropped := t.spans, t.dropped
+	t.spans, t.dropped = nil, 0
+	t.mutex.Unlock()
+
+	if dropped > 0 {
+		logrus.WithField("spans", dropped).Warning("Dropped trace spans the collector couldn't take in time")
+	}
+	if len(spans) == 0 {
+		return
+	}
+	if err := t.send(spans); err != nil {
+		logrus.WithError(err).WithField("spans", len(spans)).Warning("Couldn't export trace spans")
+	}
+}
+
+func (t *Tracer) send(spans []*Span) error {
+	body, err := json.Marshal(t.exportRequest(spans))
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode trace spans")
+	}
+	resp, err := t.client.Post(t.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "couldn't send trace spans to %v", t.url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("got a %v response sending trace spans to %v", resp.StatusCode, t.url)
+	}
+	return nil
+}
+
+// The types below are the parts of the OTLP JSON encoding Sonobuoy uses. See
+// https://github.com/open-telemetry/opentelemetry-proto.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []spanJSON `json:"spans"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type spanJSON struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	spanKindInternal = 1
+	statusCodeOK     = 1
+	statusCodeError  = 2
+)
+
+func (t *Tracer) exportRequest(spans []*Span) exportRequest {
+	encoded := make([]spanJSON, len(spans))
+	for i, span := range spans {
+		encoded[i] = span.encode()
+	}
+	return exportRequest{
+		ResourceSpans: []resourceSpans{{
+			Resource: resource{Attributes: keyValues(t.resource)},
+			ScopeSpans: []scopeSpans{{
+				Scope: scope{Name: "github.com/heptio/sonobuoy", Version: buildinfo.Version},
+				Spans: encoded,
+			}},
+		}},
+	}
+}
+
+func (s *Span) encode() spanJSON {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	encoded := spanJSON{
+		TraceID:           hex.EncodeToString(s.context.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.context.SpanID[:]),
+		Name:              s.name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		Attributes:        keyValues(s.attrs),
+		Status:            status{Code: statusCodeOK},
+	}
+	if s.parent != [8]byte{} {
+		encoded.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	if s.failed {
+		encoded.Status = status{Code: statusCodeError, Message: s.status}
+	}
+	return encoded
+}
+
+// keyValues returns attrs sorted by key, so exports are stable.
+func keyValues(attrs map[string]string) []keyValue {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]keyValue, len(keys))
+	for i, key := range keys {
+		kvs[i] = keyValue{Key: key, Value: anyValue{StringValue: attrs[key]}}
+	}
+	return kvs
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing records OpenTelemetry spans of a Sonobuoy run, so long runs
+// can be profiled and stuck phases found. Spans are exported to an
+// OpenTelemetry collector with OTLP over HTTP, using its JSON encoding.
+package tracing
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// TraceparentHeader is the W3C Trace Context header that carries the
+	// span a request was made in.
+	TraceparentHeader = "traceparent"
+	// TraceparentEnv and EndpointEnv are the environment variables workers
+	// are given the span of their run, and where to export spans, in.
+	TraceparentEnv = "TRACEPARENT"
+	EndpointEnv    = "OTEL_EXPORTER_OTLP_ENDPOINT"
+)
+
+// Config is where the spans of a run are exported.
+type Config struct {
+	// Endpoint is the base URL of an OTLP/HTTP collector, such as
+	// "http://otel-collector.monitoring:4318". Spans are sent to its
+	// /v1/traces path. Empty means the run isn't traced.
+	Endpoint string `json:"Endpoint,omitempty" mapstructure:"Endpoint"`
+}
+
+// SpanContext identifies a span, and the trace it's part of.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+// IsValid returns whether c identifies a span.
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != [16]byte{} && c.SpanID != [8]byte{}
+}
+
+// Traceparent formats c as a W3C Trace Context traceparent, or returns an
+// empty string if c isn't valid.
+func (c SpanContext) Traceparent() string {
+	if !c.IsValid() {
+		return ""
+	}
+	return "00-" + hex.EncodeToString(c.TraceID[:]) + "-" + hex.EncodeToString(c.SpanID[:]) + "-01"
+}
+
+// ParseTraceparent parses a W3C Trace Context traceparent.
+func ParseTraceparent(traceparent string) (SpanContext, error) {
+	var c SpanContext
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return c, errors.Errorf("invalid traceparent %q", traceparent)
+	}
+	if _, err := hex.Decode(c.TraceID[:], []byte(parts[1])); err != nil || len(parts[1]) != 32 {
+		return c, errors.Errorf("invalid trace ID in traceparent %q", traceparent)
+	}
+	if _, err := hex.Decode(c.SpanID[:], []byte(parts[2])); err != nil || len(parts[2]) != 16 {
+		return c, errors.Errorf("invalid span ID in traceparent %q", traceparent)
+	}
+	if !c.IsValid() {
+		return c, errors.Errorf("invalid traceparent %q", traceparent)
+	}
+	return c, nil
+}
+
+// RunSpanContext returns the context of the span covering a whole run, which
+// is derived from the run's ID so that the aggregator and the plugins it
+// launches agree on it without having to pass it around, and so that an
+// aggregator resuming a run carries on with the same trace.
+func RunSpanContext(runID string) SpanContext {
+	sum := sha256.Sum256([]byte(runID))
+	var c SpanContext
+	copy(c.TraceID[:], sum[:16])
+	copy(c.SpanID[:], sum[16:24])
+	return c
+}
+
+// Span is an operation within a trace. A nil *Span does nothing, so code
+// doesn't need to check whether it's being traced.
+type Span struct {
+	tracer  *Tracer
+	name    string
+	context SpanContext
+	parent  [8]byte
+	start   time.Time
+	end     time.Time
+	status  string
+	failed  bool
+
+	mutex sync.Mutex
+	attrs map[string]string
+	ended bool
+}
+
+// Context returns the span's context, to start spans in it elsewhere.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// Tracer returns the tracer that recorded s, to start spans in other contexts.
+func (s *Span) Tracer() *Tracer {
+	if s == nil {
+		return nil
+	}
+	return s.tracer
+}
+
+// Child starts a span within s.
+func (s *Span) Child(name string, attrs map[string]string) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.Start(name, s.context, attrs)
+}
+
+// SetAttribute records something about the span, overwriting any previous
+// value of the attribute.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attrs[key] = value
+}
+
+// End marks the span as finished, and as failed if err isn't nil. Only the
+// first call has any effect.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	if err != nil {
+		s.failed = true
+		s.status = err.Error()
+	}
+	s.mutex.Unlock()
+
+	s.tracer.queue(s)
+}
+
+// Start starts a span within parent, or a new trace if parent isn't valid.
+func (t *Tracer) Start(name string, parent SpanContext, attrs map[string]string) *Span {
+	if t == nil {
+		return nil
+	}
+	var context SpanContext
+	if parent.IsValid() {
+		context.TraceID = parent.TraceID
+	} else {
+		randomID(context.TraceID[:])
+	}
+	randomID(context.SpanID[:])
+
+	span := t.newSpan(name, context, attrs)
+	if parent.IsValid() {
+		span.parent = parent.SpanID
+	}
+	return span
+}
+
+// StartRoot starts a span with no parent, using the given context rather than
+// a random one, such as the one from RunSpanContext.
+func (t *Tracer) StartRoot(name string, context SpanContext, attrs map[string]string) *Span {
+	if t == nil {
+		return nil
+	}
+	return t.newSpan(name, context, attrs)
+}
+
+func (t *Tracer) newSpan(name string, context SpanContext, attrs map[string]string) *Span {
+	span := &Span{
+		tracer:  t,
+		name:    name,
+		context: context,
+		start:   time.Now(),
+		attrs:   make(map[string]string, len(attrs)),
+	}
+	for key, value := range attrs {
+		span.attrs[key] = value
+	}
+	return span
+}
+
+// randomID fills id with random bytes, making sure they aren't all zero.
+func randomID(id []byte) {
+	for {
+		rand.Read(id)
+		for _, b := range id {
+			if b != 0 {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	c := RunSpanContext("4ae6a6a0-3ae8-4b43-9e4c-d4c9f7b1c2a0")
+	if !c.IsValid() {
+		t.Fatalf("expected a valid run span context")
+	}
+	if c != RunSpanContext("4ae6a6a0-3ae8-4b43-9e4c-d4c9f7b1c2a0") {
+		t.Errorf("expected the same run to have the same span context")
+	}
+
+	parsed, err := ParseTraceparent(c.Traceparent())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed != c {
+		t.Errorf("expected %v, got %v", c, parsed)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b71692033-01",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319x-b7ad6b7169203331-01",
+	} {
+		if _, err := ParseTraceparent(invalid); err == nil {
+			t.Errorf("expected an error parsing %q", invalid)
+		}
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	tracer := NewTracer("", "sonobuoy-aggregator", nil)
+	if tracer != nil {
+		t.Fatalf("expected no tracer without an endpoint")
+	}
+
+	span := tracer.Start("run", SpanContext{}, nil)
+	child := span.Child("child", nil)
+	child.SetAttribute("key", "value")
+	child.End(nil)
+	span.End(nil)
+	tracer.Shutdown()
+
+	if span.Context().IsValid() {
+		t.Errorf("expected an untraced span to have no context")
+	}
+}
+
+func TestTracerExport(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []exportRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("expected spans to be sent to /v1/traces, got %v", r.URL.Path)
+		}
+		var req exportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("couldn't decode export request: %v", err)
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests = append(requests, req)
+	}))
+	defer srv.Close()
+
+	tracer := NewTracer(srv.URL+"/", "sonobuoy-aggregator", map[string]string{"sonobuoy.run": "run"})
+	root := tracer.StartRoot("sonobuoy.run", RunSpanContext("run"), nil)
+	child := root.Child("plugin.launch", map[string]string{"sonobuoy.plugin": "e2e"})
+	child.End(errors.New("couldn't create pod"))
+	child.End(nil)
+	root.End(nil)
+	tracer.Shutdown()
+
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 export request, got %v", len(requests))
+	}
+	rs := requests[0].ResourceSpans[0]
+	expectedResource := []keyValue{
+		{Key: "service.name", Value: anyValue{StringValue: "sonobuoy-aggregator"}},
+		{Key: "service.version", Value: anyValue{StringValue: rs.Resource.Attributes[1].Value.StringValue}},
+		{Key: "sonobuoy.run", Value: anyValue{StringValue: "run"}},
+	}
+	if !reflect.DeepEqual(rs.Resource.Attributes, expectedResource) {
+		t.Errorf("expected resource attributes %v, got %v", expectedResource, rs.Resource.Attributes)
+	}
+
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %v", len(spans))
+	}
+	launch, run := spans[0], spans[1]
+	if run.ParentSpanID != "" || run.Status.Code != statusCodeOK {
+		t.Errorf("expected a successful root span, got %+v", run)
+	}
+	if launch.TraceID != run.TraceID || launch.ParentSpanID != run.SpanID {
+		t.Errorf("expected the launch span to be a child of the run span, got %+v", launch)
+	}
+	if launch.Status.Code != statusCodeError || launch.Status.Message != "couldn't create pod" {
+		t.Errorf("expected the launch span to have failed, got status %+v", launch.Status)
+	}
+	expectedAttrs := []keyValue{{Key: "sonobuoy.plugin", Value: anyValue{StringValue: "e2e"}}}
+	if !reflect.DeepEqual(launch.Attributes, expectedAttrs) {
+		t.Errorf("expected attributes %v, got %v", expectedAttrs, launch.Attributes)
+	}
+}
@@ -20,12 +20,13 @@ import (
 	"os"
 
 	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/tracing"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
 
 func setConfigDefaults(ac *plugin.WorkerConfig) {
-	ac.ResultsDir = "/tmp/results"
+	ac.ResultsDir = defaultResultsDir
 }
 
 // LoadConfig loads the configuration for the sonobuoy worker from environment
@@ -48,10 +49,34 @@ func LoadConfig() (*plugin.WorkerConfig, error) {
 	viper.BindEnv("nodename", "NODE_NAME")
 	viper.BindEnv("resultsdir", "RESULTS_DIR")
 	viper.BindEnv("resulttype", "RESULT_TYPE")
+	viper.BindEnv("resultsstream", "RESULTS_STREAM")
+	viper.BindEnv("resultscompression", "RESULTS_COMPRESSION")
+	viper.BindEnv("resultsprotocol", "RESULTS_PROTOCOL")
+	viper.BindEnv("timeoutseconds", "TIMEOUT_SECONDS")
+	viper.BindEnv("replicaname", "REPLICA_NAME")
+	viper.BindEnv("localresultsdir", "LOCAL_RESULTS_DIR")
+	viper.BindEnv("resultstoken", "RESULTS_TOKEN")
+	viper.BindEnv("externalresultsurl", "EXTERNAL_RESULTS_URL")
+	viper.BindEnv("externalresultsauthorization", "EXTERNAL_RESULTS_AUTHORIZATION")
+	viper.BindEnv("resultstransport", "RESULTS_TRANSPORT")
+	viper.BindEnv("retryattempts", "RETRY_ATTEMPTS")
+	viper.BindEnv("retrymaxelapsedtime", "RETRY_MAX_ELAPSED_TIME")
+	viper.BindEnv("retryjitter", "RETRY_JITTER")
+	viper.BindEnv("tracingendpoint", tracing.EndpointEnv)
+	viper.BindEnv("traceparent", tracing.TraceparentEnv)
+	viper.BindEnv("tokendir", "TOKEN_DIR")
+	viper.BindEnv("tokenaudience", "TOKEN_AUDIENCE")
+	viper.BindEnv("tokenexpirationseconds", "TOKEN_EXPIRATION_SECONDS")
+	viper.BindEnv("podname", "POD_NAME")
+	viper.BindEnv("poduid", "POD_UID")
+	viper.BindEnv("namespace", "POD_NAMESPACE")
+	viper.BindEnv("serviceaccountname", "SERVICE_ACCOUNT_NAME")
+	viper.BindEnv("payloaddir", "PAYLOAD_DIR")
 
 	viper.BindEnv("cacert", "CA_CERT")
 	viper.BindEnv("clientcert", "CLIENT_CERT")
 	viper.BindEnv("clientkey", "CLIENT_KEY")
+	viper.BindEnv("cabundle", "CA_BUNDLE")
 
 	setConfigDefaults(config)
 
@@ -0,0 +1,146 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// externalResultsURL is where results are POSTed besides the master, if
+// anywhere, and externalAuthorization is the Authorization header they're
+// POSTed with.
+var (
+	externalResultsURL    string
+	externalAuthorization string
+)
+
+// externalClient sends results to the external endpoint. Unless
+// SetExternalTransport says otherwise, it uses the default transport, which
+// trusts the system's certificates and takes proxies from the environment.
+var externalClient = &http.Client{}
+
+// SetExternalTransport has results POSTed to the external endpoint through
+// transport, such as one that trusts a CA bundle as well as the system's
+// certificates. A nil transport uses the default one.
+func SetExternalTransport(transport http.RoundTripper) {
+	externalClient = &http.Client{Transport: transport}
+}
+
+// SetExternalResults has results POSTed to resultsURL, with the given
+// Authorization header if it isn't empty, as well as submitted to the master.
+// An empty resultsURL turns this off.
+func SetExternalResults(resultsURL, authorization string) error {
+	if resultsURL != "" {
+		if _, err := url.Parse(resultsURL); err != nil {
+			return errors.Wrapf(err, "invalid external results URL %q", resultsURL)
+		}
+	}
+	externalResultsURL, externalAuthorization = resultsURL, authorization
+	return nil
+}
+
+// externalURL is where a submission to the master at masterURL is POSTed
+// externally: the external URL with the submission's path appended, such as
+// /api/v1/results/by-node/<node>/<plugin>, so the collector can tell results
+// apart.
+func externalURL(masterURL string) (string, error) {
+	master, err := url.Parse(masterURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid master URL %q", masterURL)
+	}
+	external, err := url.Parse(externalResultsURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid external results URL %q", externalResultsURL)
+	}
+	external.Path = strings.TrimSuffix(external.Path, "/") + master.Path
+	external.RawPath = ""
+	return external.String(), nil
+}
+
+// sendExternalResults POSTs a submission to the external results endpoint
+// too, if there is one, calling callback again for the results. Failures are
+// only logged, since it's the master's copy that the run depends on.
+func sendExternalResults(masterURL string, headers http.Header, callback func() (io.Reader, string, error)) {
+	if externalResultsURL == "" {
+		return
+	}
+	target, err := externalURL(masterURL)
+	if err != nil {
+		errlog.LogError(err)
+		return
+	}
+
+	logrus.WithField("url", target).Info("Sending results to the external endpoint")
+	span := traceSpan.Child("worker.upload.external", map[string]string{"http.url": target})
+	err = retryPolicy.retry(func() (bool, error) {
+		input, mimeType, err := callback()
+		if err != nil {
+			return false, errors.Wrap(err, "couldn't gather results")
+		}
+		if closer, ok := input.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		compress := compression == plugin.GzipCompression && mimeType != gzipMimeType
+		var compressed *io.PipeReader
+		if compress {
+			compressed = gzipStream(input)
+			input = compressed
+		}
+		req, err := http.NewRequest(http.MethodPost, target, input)
+		if err != nil {
+			stopCompressing(compressed, err)
+			return false, errors.Wrapf(err, "error constructing request to %v", target)
+		}
+		for key, values := range headers {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+		req.Header.Set("content-type", mimeType)
+		if externalAuthorization != "" {
+			req.Header.Set("Authorization", externalAuthorization)
+		}
+		if compress {
+			req.Header.Set(aggregation.ContentEncodingHeader, plugin.GzipCompression)
+		}
+
+		resp, err := externalClient.Do(req)
+		if err != nil {
+			stopCompressing(compressed, err)
+			return true, errors.Wrapf(err, "error dialing %v", target)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return retryableStatus(resp.StatusCode), errors.Errorf("got a %v response from %v", resp.StatusCode, target)
+		}
+		return false, nil
+	})
+	span.End(err)
+	if err != nil {
+		errlog.LogError(errors.Wrap(err, "couldn't send results to the external endpoint"))
+	}
+}
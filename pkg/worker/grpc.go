@@ -0,0 +1,254 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/heptio/sonobuoy/pkg/buildinfo"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation/resultspb"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcChunkSize is how much of a result is sent in each message. gRPC's flow
+// control keeps the worker from sending faster than the master can store it.
+const grpcChunkSize = 64 * 1024
+
+// submitGRPC submits a result over gRPC, to the master at the given results
+// URL, using the client's TLS configuration. It returns whether a failed
+// submission is worth retrying.
+func submitGRPC(resultURL string, client *http.Client, headers http.Header, input *checksumReader, mimeType string, compress bool) (bool, error) {
+	header, err := grpcHeader(resultURL)
+	if err != nil {
+		return false, err
+	}
+	header.MimeType = mimeType
+	if _, params, err := mime.ParseMediaType(headers.Get(aggregation.ContentDispositionHeader)); err == nil {
+		header.Filename = params["filename"]
+	}
+	header.Partial = headers.Get(aggregation.PartialResultHeader) == "true"
+	header.TimedOut = headers.Get(aggregation.TimedOutHeader) == "true"
+	header.Incomplete = headers.Get(aggregation.IncompleteResultHeader) == "true"
+
+	var opts []grpc.CallOption
+	if compress {
+		opts = append(opts, grpc.UseCompressor(gzip.Name))
+	}
+	err = withResultsStream(resultURL, client, opts, func(stream resultspb.Results_SubmitClient) error {
+		if err := stream.Send(&resultspb.SubmitRequest{Request: &resultspb.SubmitRequest_Header{Header: header}}); err != nil {
+			return err
+		}
+
+		buf := make([]byte, grpcChunkSize)
+		for {
+			n, err := input.Read(buf)
+			if n > 0 {
+				chunk := &resultspb.Chunk{Data: buf[:n]}
+				if err := stream.Send(&resultspb.SubmitRequest{Request: &resultspb.SubmitRequest_Chunk{Chunk: chunk}}); err != nil {
+					return err
+				}
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				// Let the master know the result is incomplete before giving up.
+				stream.CloseSend()
+				return errors.Wrap(err, "couldn't read results")
+			}
+		}
+
+		done := &resultspb.Done{Sha256: hex.EncodeToString(input.hash.Sum(nil))}
+		if err := stream.Send(&resultspb.SubmitRequest{Request: &resultspb.SubmitRequest_Done{Done: done}}); err != nil {
+			return err
+		}
+		if err := stream.CloseSend(); err != nil {
+			return err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if !resp.Stored {
+			return status.Error(codes.Internal, "master didn't store the result")
+		}
+		return nil
+	})
+	if err == nil {
+		return false, nil
+	}
+
+	st, ok := status.FromError(errors.Cause(err))
+	if !ok {
+		return false, err
+	}
+	if st.Code() == codes.FailedPrecondition {
+		tooLarge := &aggregation.ResultTooLargeError{}
+		if err := json.Unmarshal([]byte(st.Message()), tooLarge); err == nil {
+			return false, errors.WithStack(tooLarge)
+		}
+	}
+	if st.Code() == codes.ResourceExhausted {
+		insufficient := &aggregation.InsufficientStorageError{}
+		if err := json.Unmarshal([]byte(st.Message()), insufficient); err == nil && insufficient.RetryAfterSeconds > 0 {
+			return true, errors.WithStack(insufficient)
+		}
+	}
+	if st.Code() == codes.AlreadyExists {
+		mismatch := &aggregation.VersionMismatchError{}
+		if err := json.Unmarshal([]byte(st.Message()), mismatch); err == nil && mismatch.AggregatorVersion != "" {
+			return false, errors.WithStack(mismatch)
+		}
+	}
+	if st.Code() == codes.InvalidArgument {
+		invalid := &aggregation.InvalidResultError{}
+		if err := json.Unmarshal([]byte(st.Message()), invalid); err == nil && invalid.Format != "" {
+			return false, errors.WithStack(invalid)
+		}
+	}
+	return retryableCode(st.Code()), errors.Wrapf(err, "error submitting results to master at %v over gRPC", resultURL)
+}
+
+// sendProgressGRPC sends a progress update over gRPC, to the master at the
+// given progress URL.
+func sendProgressGRPC(update aggregation.ProgressUpdate, progressURL string, client *http.Client) error {
+	header, err := grpcHeader(progressURL)
+	if err != nil {
+		return err
+	}
+	progress := &resultspb.Progress{
+		Completed: int32(update.Completed),
+		Total:     int32(update.Total),
+		Message:   update.Message,
+	}
+	err = withResultsStream(progressURL, client, nil, func(stream resultspb.Results_SubmitClient) error {
+		if err := stream.Send(&resultspb.SubmitRequest{Request: &resultspb.SubmitRequest_Header{Header: header}}); err != nil {
+			return err
+		}
+		if err := stream.Send(&resultspb.SubmitRequest{Request: &resultspb.SubmitRequest_Progress{Progress: progress}}); err != nil {
+			return err
+		}
+		if err := stream.CloseSend(); err != nil {
+			return err
+		}
+		// The master ends the stream once it has handled the update.
+		if _, err := stream.Recv(); err != io.EOF {
+			return err
+		}
+		return nil
+	})
+	return errors.Wrapf(err, "error sending progress to master at %v over gRPC", progressURL)
+}
+
+// withResultsStream connects to the master at the given URL and calls f with
+// a new Submit stream, authenticated with the results token if there is one.
+func withResultsStream(masterURL string, client *http.Client, opts []grpc.CallOption, f func(resultspb.Results_SubmitClient) error) error {
+	target, err := grpcTarget(masterURL)
+	if err != nil {
+		return err
+	}
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(credentials.NewTLS(clientTLSConfig(client))))
+	if err != nil {
+		return errors.Wrapf(err, "couldn't connect to master at %v", target)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if resultsToken != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, aggregation.AuthorizationHeader, aggregation.BearerToken(resultsToken))
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, aggregation.WorkerVersionHeader, buildinfo.Version)
+	stream, err := resultspb.NewResultsClient(conn).Submit(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	err = f(stream)
+	if err == io.EOF {
+		// The master ended the stream early; find out why.
+		_, err = stream.Recv()
+	}
+	return err
+}
+
+// grpcHeader returns the header for a Submit stream for the given results or
+// progress URL, which names the plugin and, if it's node-specific, the node.
+func grpcHeader(masterURL string) (*resultspb.Header, error) {
+	u, err := url.Parse(masterURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't parse master URL %v", masterURL)
+	}
+	parts := strings.Split(strings.TrimPrefix(u.Path, "/api/v1/"), "/")
+	switch {
+	case len(parts) == 4 && parts[1] == "by-node":
+		return &resultspb.Header{Node: parts[2], Plugin: parts[3]}, nil
+	case len(parts) == 3 && parts[1] == "global":
+		return &resultspb.Header{Plugin: parts[2]}, nil
+	default:
+		return nil, errors.Errorf("master URL %v doesn't identify a result", masterURL)
+	}
+}
+
+// grpcTarget returns the host and port of the master at the given URL.
+func grpcTarget(masterURL string) (string, error) {
+	u, err := url.Parse(masterURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "couldn't parse master URL %v", masterURL)
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	return net.JoinHostPort(u.Hostname(), "443"), nil
+}
+
+// clientTLSConfig returns a copy of the TLS configuration, including the
+// client certificate, that the client makes HTTP requests with.
+func clientTLSConfig(client *http.Client) *tls.Config {
+	if transport, ok := client.Transport.(*http.Transport); ok && transport.TLSClientConfig != nil {
+		return transport.TLSClientConfig.Clone()
+	}
+	return &tls.Config{}
+}
+
+// retryableCode reports whether a gRPC submission that failed with the given
+// code is worth retrying. These are the codes the master uses where it would
+// send one of the retryable HTTP statuses, as well as those for connection
+// problems.
+func retryableCode(code codes.Code) bool {
+	switch code {
+	case codes.ResourceExhausted, codes.DataLoss, codes.Internal, codes.Unavailable, codes.Unknown, codes.Aborted, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
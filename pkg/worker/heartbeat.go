@@ -0,0 +1,76 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// heartbeatInterval is how often the master is told the worker is still alive.
+var heartbeatInterval = 15 * time.Second
+
+var (
+	// flushRequested is closed once the master asks, in response to a
+	// heartbeat, for whatever results there are so far.
+	flushRequested = make(chan struct{})
+	flushOnce      sync.Once
+)
+
+func requestFlush() {
+	flushOnce.Do(func() { close(flushRequested) })
+}
+
+// SendHeartbeats lets the master know the worker is still alive by POSTing to
+// url straight away and then regularly until stop is closed. Like progress,
+// heartbeats are best effort, so failures are only logged.
+func SendHeartbeats(url string, client *http.Client, stop <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := sendHeartbeat(url, client); err != nil {
+			logrus.WithError(err).Warning("couldn't send heartbeat")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func sendHeartbeat(url string, client *http.Client) error {
+	resp, err := client.Post(url, "", nil)
+	if err != nil {
+		return errors.Wrapf(err, "error encountered dialing master at %v", url)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("got a %v response when sending heartbeat to %v", resp.StatusCode, url)
+	}
+	if resp.Header.Get(aggregation.FlushResultsHeader) == "true" {
+		requestFlush()
+	}
+	return nil
+}
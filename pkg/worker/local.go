@@ -0,0 +1,126 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/heptio/sonobuoy/pkg/tarball"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// StoreLocalResults is GatherResults for workers that can't reach the master.
+// Once the plugin writes the done file, its results are copied to localDir,
+// for the master to fetch, followed by a done file of their own describing
+// them. Directories are stored as gzipped tarballs, as they'd be sent.
+//
+// If the plugin has a timeout and the done file doesn't appear in time, a
+// timeout is stored in place of the results. If ctx is done first, nothing is
+// stored and a *StoppedError is returned.
+func StoreLocalResults(ctx context.Context, waitfile, localDir string) error {
+	// Anything already there is from an earlier run.
+	if err := os.RemoveAll(localDir); err != nil {
+		return errors.Wrapf(err, "couldn't clear local results directory %v", localDir)
+	}
+
+	return waitForResults(ctx, waitfile, func(contents []byte) error {
+		logrus.WithFields(logrus.Fields{
+			"resultFile": string(contents),
+			"localDir":   localDir,
+		}).Info("Detected done file, storing result files")
+
+		resultFiles, err := parseWaitFile(contents)
+		if err != nil {
+			return err
+		}
+		stored := aggregation.LocalResults{}
+		for _, resultFile := range resultFiles {
+			file, err := storeLocalResultFile(resultFile, localDir)
+			if err != nil {
+				return err
+			}
+			stored.Files = append(stored.Files, file)
+		}
+		return writeLocalResults(localDir, stored)
+	}, func() error {
+		logrus.WithField("timeout", pluginTimeout).Warning("Plugin timed out, storing it instead of results")
+		return writeLocalResults(localDir, aggregation.LocalResults{
+			Error:    fmt.Sprintf("plugin timed out after %v", pluginTimeout),
+			TimedOut: true,
+		})
+	}, nil)
+}
+
+// storeLocalResultFile copies a result file, or a gzipped tarball of a result
+// directory, into localDir.
+func storeLocalResultFile(resultFile, localDir string) (aggregation.LocalResultFile, error) {
+	stored := aggregation.LocalResultFile{
+		Name:     filepath.Base(resultFile),
+		MimeType: mime.TypeByExtension(filepath.Ext(resultFile)),
+	}
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return stored, errors.Wrapf(err, "couldn't create local results directory %v", localDir)
+	}
+
+	out, err := os.Create(filepath.Join(localDir, stored.Name))
+	if err != nil {
+		return stored, errors.Wrapf(err, "couldn't create local result file for %v", resultFile)
+	}
+	defer out.Close()
+
+	if info, err := os.Stat(resultFile); err == nil && info.IsDir() {
+		stored.MimeType = gzipMimeType
+		return stored, errors.Wrapf(tarball.EncodeTarball(out, resultFile), "couldn't store result directory %v", resultFile)
+	}
+
+	in, err := os.Open(resultFile)
+	if err != nil {
+		return stored, errors.Wrapf(err, "couldn't open result file %v", resultFile)
+	}
+	defer in.Close()
+
+	_, err = io.Copy(out, in)
+	return stored, errors.Wrapf(err, "couldn't store result file %v", resultFile)
+}
+
+// writeLocalResults writes the done file describing the stored results, which
+// is renamed into place so the master never reads half of it.
+func writeLocalResults(localDir string, stored aggregation.LocalResults) error {
+	stored.Token = aggregation.LocalResultsToken(resultsToken)
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return errors.Wrapf(err, "couldn't create local results directory %v", localDir)
+	}
+	contents, err := json.Marshal(stored)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	done := filepath.Join(localDir, aggregation.LocalResultsDoneFile)
+	if err := ioutil.WriteFile(done+".tmp", contents, 0644); err != nil {
+		return errors.Wrap(err, "couldn't write local results done file")
+	}
+	return errors.Wrap(os.Rename(done+".tmp", done), "couldn't write local results done file")
+}
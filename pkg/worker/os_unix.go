@@ -1,5 +1,7 @@
+//go:build !windows
+
 /*
-Copyright 2018 The Kubernetes Authors.
+Copyright 2018 Heptio Inc.
 
 Licensed under the Apache License, Version 2.0 (the "License");
 you may not use this file except in compliance with the License.
@@ -14,6 +16,16 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package v1beta1
+package worker
+
+import (
+	"os"
+	"syscall"
+)
+
+// defaultResultsDir is where plugins write their results unless told
+// otherwise.
+const defaultResultsDir = "/tmp/results"
 
-type CustomResourceDefinitionExpansion interface{}
+// shutdownSignals are the signals that tell the worker to stop.
+var shutdownSignals = []os.Signal{syscall.SIGTERM, os.Interrupt}
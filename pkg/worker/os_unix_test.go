@@ -0,0 +1,49 @@
+//go:build !windows
+
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+)
+
+func TestWithShutdownSignals(t *testing.T) {
+	shutdownGracePeriod = 10 * time.Millisecond
+	defer func() { shutdownGracePeriod = time.Duration(plugin.GracefulShutdownPeriod) * time.Second / 2 }()
+
+	ctx, cancel := WithShutdownSignals(context.Background())
+	defer cancel()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("couldn't signal the test: %v", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		if ctx.Err() != context.Canceled {
+			t.Errorf("expected the context to be cancelled, got %v", ctx.Err())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the context to be cancelled after the signal")
+	}
+}
@@ -1,5 +1,5 @@
 /*
-Copyright 2018 The Kubernetes Authors.
+Copyright 2018 Heptio Inc.
 
 Licensed under the Apache License, Version 2.0 (the "License");
 you may not use this file except in compliance with the License.
@@ -14,5 +14,16 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-// This package contains the scheme of the automatically generated clientset.
-package scheme
+package worker
+
+import (
+	"os"
+)
+
+// defaultResultsDir is where plugins write their results unless told
+// otherwise. Windows containers have no /tmp.
+const defaultResultsDir = `C:\results`
+
+// shutdownSignals are the signals that tell the worker to stop. Windows only
+// delivers os.Interrupt, which is what the kubelet's stop request becomes.
+var shutdownSignals = []os.Signal{os.Interrupt}
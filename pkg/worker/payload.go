@@ -0,0 +1,63 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DownloadPayload downloads the plugin's files from the master at url, writing
+// them to dir for the plugin to read once it starts.
+func DownloadPayload(url string, client *http.Client, dir string) error {
+	var files map[string]string
+	err := retryPolicy.retry(func() (bool, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return true, errors.Wrapf(err, "error encountered dialing master at %v", url)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return retryableStatus(resp.StatusCode), errors.Errorf("got a %v response when dialing master to %v", resp.StatusCode, url)
+		}
+		return true, errors.Wrap(json.NewDecoder(resp.Body).Decode(&files), "couldn't decode plugin files")
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "couldn't create payload directory %v", dir)
+	}
+	for name, contents := range files {
+		// The master only serves files with plain names, but a file must
+		// never be written outside of the directory.
+		if name != filepath.Base(name) || name == "." || name == ".." {
+			return errors.Errorf("plugin file %q isn't a file name", name)
+		}
+		if err := writeFileAtomically(filepath.Join(dir, name), []byte(contents)); err != nil {
+			return err
+		}
+		logrus.WithField("file", name).Info("Downloaded plugin file")
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// progressPollInterval is how often the progress file is checked for changes.
+var progressPollInterval = 1 * time.Second
+
+// RelayProgress watches progressFile, which the plugin may rewrite at any time
+// with a JSON object such as {"completed": 120, "total": 350}, and sends each
+// new version to the master at url until stop is closed. Progress is only
+// informational, so failures to read or send it are logged and otherwise
+// ignored; a version that couldn't be sent isn't tried again, so the warning
+// is only logged once for each.
+func RelayProgress(progressFile, url string, client *http.Client, stop <-chan struct{}) {
+	ticker := time.NewTicker(progressPollInterval)
+	defer ticker.Stop()
+
+	var last []byte
+	for {
+		select {
+		case <-ticker.C:
+			contents, err := ioutil.ReadFile(progressFile)
+			if err != nil || bytes.Equal(contents, last) {
+				continue
+			}
+			last = contents
+			if err := sendProgress(contents, url, client); err != nil {
+				logrus.WithError(err).Warning("couldn't send plugin progress")
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func sendProgress(contents []byte, url string, client *http.Client) error {
+	update := aggregation.ProgressUpdate{}
+	if err := json.Unmarshal(contents, &update); err != nil {
+		return errors.Wrap(err, "couldn't decode progress file")
+	}
+	if protocol == plugin.GRPCProtocol {
+		return sendProgressGRPC(update, url, client)
+	}
+
+	body, err := json.Marshal(update)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "error constructing progress request to %v", url)
+	}
+	req.Header.Add("content-type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "error encountered dialing master at %v", url)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("got a %v response when sending progress to %v", resp.StatusCode, url)
+	}
+	return nil
+}
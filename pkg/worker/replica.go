@@ -0,0 +1,114 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// replicaPollInterval is how often a replica checks for the done file.
+var replicaPollInterval = 1 * time.Second
+
+// ReportReplicaResults is the consumer for plugins run by the Deployment
+// driver, where every replica reports to the same global result. Each time the
+// done file appears, the files it lists are sent as partial results named
+// after the replica, then the done file is removed so that a plugin which
+// keeps running can report again, replacing what it sent before. The driver
+// completes the result once the plugin's duration is up, so this only returns
+// on error or once ctx is done, after flushing the replica's results so far.
+// The master asking for the results so far flushes them too, once.
+func ReportReplicaResults(ctx context.Context, waitfile, replica, url string, client *http.Client) error {
+	logrus.WithFields(logrus.Fields{
+		"waitfile": waitfile,
+		"replica":  replica,
+	}).Info("Waiting for waitfile")
+
+	flush := func() error {
+		return flushReplicaResults(waitfile, replica, url, client)
+	}
+	flushCh := flushRequested
+	for {
+		if contents, err := ioutil.ReadFile(waitfile); err == nil {
+			logrus.WithField("resultFile", string(contents)).Info("Detected done file, transmitting replica results")
+			if err := sendReplicaResults(contents, replica, url, client); err != nil {
+				return err
+			}
+			if err := os.Remove(waitfile); err != nil {
+				return errors.Wrapf(err, "couldn't remove done file %v", waitfile)
+			}
+		}
+
+		select {
+		case <-flushCh:
+			flushCh = nil
+			if err := flush(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return stopWorker(ctx, flush)
+		case <-time.After(replicaPollInterval):
+		}
+	}
+}
+
+// flushReplicaResults sends the files in the done file if the plugin has
+// written one, and otherwise everything in the results directory as a single
+// partial result named after the replica.
+func flushReplicaResults(waitfile, replica, url string, client *http.Client) error {
+	if contents, err := ioutil.ReadFile(waitfile); err == nil {
+		return sendReplicaResults(contents, replica, url, client)
+	}
+
+	resultsDir := filepath.Dir(waitfile)
+	logrus.WithField("resultsDir", resultsDir).Warning("Transmitting replica results so far")
+	headers := http.Header{}
+	headers.Set(aggregation.ContentDispositionHeader, mime.FormatMediaType("attachment", map[string]string{
+		"filename": replica,
+	}))
+	headers.Set(aggregation.PartialResultHeader, "true")
+	return sendResultDir(resultsDir, url, client, headers)
+}
+
+func sendReplicaResults(contents []byte, replica, url string, client *http.Client) error {
+	resultFiles, err := parseWaitFile(contents)
+	if err != nil {
+		return err
+	}
+
+	for _, resultFile := range resultFiles {
+		headers := http.Header{}
+		headers.Set(aggregation.ContentDispositionHeader, mime.FormatMediaType("attachment", map[string]string{
+			"filename": replica + "-" + filepath.Base(resultFile),
+		}))
+		headers.Set(aggregation.PartialResultHeader, "true")
+
+		if err := sendResultFile(resultFile, url, client, headers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -18,63 +18,260 @@ package worker
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"hash"
 	"io"
 	"net/http"
+	"strconv"
 
+	"github.com/heptio/sonobuoy/pkg/buildinfo"
 	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
 	"github.com/pkg/errors"
 	"github.com/sethgrid/pester"
 )
 
+// compression is how results are compressed before they are sent, if at all.
+var compression string
+
+// SetCompression sets how results are compressed before they are sent to the
+// master. plugin.GzipCompression is the only compression supported; an empty
+// string turns compression off.
+func SetCompression(c string) error {
+	switch c {
+	case "", plugin.GzipCompression:
+		compression = c
+		return nil
+	default:
+		return errors.Errorf("unsupported results compression %q", c)
+	}
+}
+
+// protocol is how results and progress are sent to the master.
+var protocol string
+
+// SetProtocol sets how results and progress are sent to the master.
+// plugin.GRPCProtocol is the only alternative supported; an empty string
+// means plain HTTP.
+func SetProtocol(p string) error {
+	switch p {
+	case "", plugin.GRPCProtocol:
+		protocol = p
+		return nil
+	default:
+		return errors.Errorf("unsupported results protocol %q", p)
+	}
+}
+
+// resultsToken is the token results are submitted with, if any.
+var resultsToken string
+
+// SetResultsToken sets the token the master issued to the plugin, which it
+// requires results to be submitted with.
+func SetResultsToken(token string) {
+	resultsToken = token
+}
+
+// addResultsToken adds the results token, if there is one, to a results
+// submission, along with the worker's version, which the master checks
+// against its own.
+func addResultsToken(req *http.Request) {
+	if resultsToken != "" {
+		req.Header.Set(aggregation.AuthorizationHeader, aggregation.BearerToken(resultsToken))
+	}
+	req.Header.Set(aggregation.WorkerVersionHeader, buildinfo.Version)
+}
+
 // DoRequest calls the given callback which returns an io.Reader, and submits
 // the results, with error handling, and falls back on uploading JSON with the
 // error message if the callback fails. (This way, problems gathering data
 // don't result in the server waiting forever for results that will never
-// come.)
+// come.) Submissions that fail because the master couldn't be reached, or
+// reported a transient error, are retried according to the retry policy; the
+// callback is called again for each attempt, and once more if results are
+// also sent to an external endpoint.
 func DoRequest(url string, client *http.Client, callback func() (io.Reader, string, error)) error {
-	input, mimeType, err := callback()
-	pesterClient := pester.NewExtendedClient(client)
-	if err != nil {
-		errlog.LogError(errors.Wrap(err, "error gathering host data"))
+	return doRequestWithHeaders(url, client, http.Header{}, callback)
+}
 
-		// If the callback couldn't get the data, we should send the reason why to
-		// the server.
-		errobj := map[string]string{
-			"error": err.Error(),
+// doRequestWithHeaders is DoRequest, but adds the given headers to the
+// request that submits the results.
+func doRequestWithHeaders(url string, client *http.Client, headers http.Header, callback func() (io.Reader, string, error)) error {
+	span := traceSpan.Child("worker.upload", map[string]string{"http.url": url})
+	headers = withTraceparent(headers, span)
+	err := retryPolicy.retry(func() (bool, error) {
+		input, mimeType, err := callback()
+		if err != nil {
+			return false, sendCallbackError(url, client, mimeType, err)
 		}
-		errbody, err := json.Marshal(errobj)
+
+		// The checksum is of the results as the master will store them, so
+		// it's taken before compression.
+		checksum := &checksumReader{reader: input, hash: sha256.New()}
+		input = checksum
+
+		// Archives are already compressed, so there's no point doing it twice.
+		compress := compression == plugin.GzipCompression && mimeType != gzipMimeType
+		if protocol == plugin.GRPCProtocol {
+			return submitGRPC(url, client, headers, checksum, mimeType, compress)
+		}
+		var compressed *io.PipeReader
+		if compress {
+			compressed = gzipStream(input)
+			input = compressed
+		}
+
+		req, err := http.NewRequest(http.MethodPut, url, input)
 		if err != nil {
-			return errors.WithStack(err)
+			stopCompressing(compressed, err)
+			return false, errors.Wrapf(err, "error constructing master request to %v", url)
+		}
+		for key, values := range headers {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
 		}
-		req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(errbody))
 		req.Header.Add("content-type", mimeType)
+		addResultsToken(req)
+		if compress {
+			req.Header.Add(aggregation.ContentEncodingHeader, plugin.GzipCompression)
+		}
+		// The checksum isn't known until the results have been read, so it's
+		// sent as a trailer, which requires a chunked request.
+		req.ContentLength = -1
+		req.Trailer = http.Header{}
+		req.Trailer.Set(aggregation.ChecksumHeader, "")
+		checksum.trailer = req.Trailer
+
+		resp, err := client.Do(req)
 		if err != nil {
-			return errors.WithStack(err)
+			stopCompressing(compressed, err)
+			return true, errors.Wrapf(err, "error encountered dialing master at %v", url)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusRequestEntityTooLarge {
+			tooLarge := &aggregation.ResultTooLargeError{}
+			if err := json.NewDecoder(resp.Body).Decode(tooLarge); err == nil {
+				return false, errors.WithStack(tooLarge)
+			}
+		}
+		if resp.StatusCode == http.StatusInsufficientStorage {
+			return true, errors.WithStack(insufficientStorage(resp))
+		}
+		if resp.StatusCode == http.StatusConflict {
+			mismatch := &aggregation.VersionMismatchError{}
+			if err := json.NewDecoder(resp.Body).Decode(mismatch); err == nil && mismatch.AggregatorVersion != "" {
+				return false, errors.WithStack(mismatch)
+			}
+		}
+		if resp.StatusCode == http.StatusBadRequest {
+			invalid := &aggregation.InvalidResultError{}
+			if err := json.NewDecoder(resp.Body).Decode(invalid); err == nil && invalid.Format != "" {
+				return false, errors.WithStack(invalid)
+			}
 		}
+		if resp.StatusCode != http.StatusOK {
+			return retryableStatus(resp.StatusCode), errors.Errorf("got a %v response when dialing master to %v", resp.StatusCode, url)
+		}
+		return false, nil
+	})
+	span.End(err)
 
-		// And if we can't even do that, log it.
-		resp, err := pesterClient.Do(req)
-		if err != nil || resp.StatusCode != http.StatusOK {
-			errlog.LogError(errors.Wrapf(err, "could not send error message to master URL (%v)", url))
+	// The external endpoint gets a copy whether or not the master does.
+	sendExternalResults(url, headers, callback)
+	return err
+}
+
+// insufficientStorage returns the error the master sent when it didn't have
+// room for the results, waiting as long as its Retry-After header says.
+func insufficientStorage(resp *http.Response) *aggregation.InsufficientStorageError {
+	insufficient := &aggregation.InsufficientStorageError{}
+	json.NewDecoder(resp.Body).Decode(insufficient)
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		insufficient.RetryAfterSeconds = seconds
+	}
+	return insufficient
+}
+
+// checksumReader hashes everything read through it, setting the checksum as a
+// trailer once it reaches the end.
+type checksumReader struct {
+	reader  io.Reader
+	hash    hash.Hash
+	trailer http.Header
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.hash.Write(p[:n])
+	if err == io.EOF && c.trailer != nil {
+		c.trailer.Set(aggregation.ChecksumHeader, hex.EncodeToString(c.hash.Sum(nil)))
+	}
+	return n, err
+}
+
+// gzipStream returns a reader of the gzipped contents of input, compressing
+// it as it's read. If it isn't read to the end, it must be closed with
+// stopCompressing.
+func gzipStream(input io.Reader) *io.PipeReader {
+	reader, writer := io.Pipe()
+	go func() {
+		gzipWriter := gzip.NewWriter(writer)
+		if _, err := io.Copy(gzipWriter, input); err != nil {
+			writer.CloseWithError(err)
+			return
 		}
+		writer.CloseWithError(gzipWriter.Close())
+	}()
+	return reader
+}
 
-		return errors.WithStack(err)
+// stopCompressing ends the compression of a gzipStream, if there is one, that
+// won't be read any further because its request failed, so it doesn't wait
+// forever to be read.
+func stopCompressing(compressed *io.PipeReader, err error) {
+	if compressed != nil {
+		compressed.CloseWithError(err)
 	}
+}
+
+// sendCallbackError logs an error returned by a DoRequest callback and tells
+// the master about it.
+func sendCallbackError(url string, client *http.Client, mimeType string, callbackErr error) error {
+	errlog.LogError(errors.Wrap(callbackErr, "error gathering host data"))
 
-	req, err := http.NewRequest(http.MethodPut, url, input)
+	// If the callback couldn't get the data, we should send the reason why to
+	// the server.
+	errobj := map[string]string{
+		"error": callbackErr.Error(),
+	}
+	errbody, err := json.Marshal(errobj)
 	if err != nil {
-		return errors.Wrapf(err, "error constructing master request to %v", url)
+		return errors.WithStack(err)
 	}
-	req.Header.Add("content-type", mimeType)
-
-	resp, err := client.Do(req)
+	if protocol == plugin.GRPCProtocol {
+		_, err := submitGRPC(url, client, http.Header{}, &checksumReader{reader: bytes.NewReader(errbody), hash: sha256.New()}, mimeType, false)
+		if err != nil {
+			errlog.LogError(errors.Wrapf(err, "could not send error message to master URL (%v)", url))
+		}
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(errbody))
 	if err != nil {
-		return errors.Wrapf(err, "error encountered dialing master at %v", url)
+		return errors.WithStack(err)
 	}
-	if resp.StatusCode != http.StatusOK {
-		// TODO: retry logic for something like a 429 or otherwise
-		return errors.Errorf("got a %v response when dialing master to %v", resp.StatusCode, url)
+	req.Header.Add("content-type", mimeType)
+	addResultsToken(req)
+
+	// And if we can't even do that, log it.
+	resp, err := pester.NewExtendedClient(client).Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		errlog.LogError(errors.Wrapf(err, "could not send error message to master URL (%v)", url))
 	}
-	return nil
+
+	return errors.WithStack(err)
 }
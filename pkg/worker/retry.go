@@ -0,0 +1,161 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// RetryPolicy controls how results submissions to the master are retried
+// when the master can't be reached or reports a transient failure.
+type RetryPolicy struct {
+	// Attempts is the maximum number of times a submission is attempted. Zero
+	// or less means there is no bound other than MaxElapsedTime, or, without
+	// that either, that only the first attempt is made.
+	Attempts int
+	// MaxElapsedTime bounds the total time spent retrying a submission. Zero
+	// means there is no bound other than Attempts.
+	MaxElapsedTime time.Duration
+	// Jitter randomizes each wait by up to this fraction of it (0.2 means
+	// +/-20%), so that many workers don't retry in lockstep.
+	Jitter float64
+	// InitialInterval is the wait before the first retry; it doubles after
+	// each failed attempt up to MaxInterval.
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// MaxBackpressureTime bounds the total time spent waiting for the master
+	// to have room for a submission, as long as it asks each time. That
+	// waiting doesn't count against Attempts or MaxElapsedTime. Zero means
+	// it's retried like any other failure.
+	MaxBackpressureTime time.Duration
+}
+
+// DefaultRetryPolicy is used for submissions unless SetRetryPolicy is called.
+// It keeps retrying for up to 5 minutes, however many attempts that takes, so
+// results outlast a master that's restarting.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxElapsedTime:  5 * time.Minute,
+	Jitter:          0.2,
+	InitialInterval: 1 * time.Second,
+	MaxInterval:     30 * time.Second,
+
+	MaxBackpressureTime: 30 * time.Minute,
+}
+
+var retryPolicy = DefaultRetryPolicy
+
+// SetRetryPolicy changes how results submissions are retried.
+func SetRetryPolicy(policy RetryPolicy) {
+	retryPolicy = policy
+}
+
+// RetryPolicyFromConfig returns DefaultRetryPolicy with any retry settings
+// from the worker config applied on top.
+func RetryPolicyFromConfig(cfg *plugin.WorkerConfig) RetryPolicy {
+	policy := DefaultRetryPolicy
+	if cfg.RetryAttempts != 0 {
+		policy.Attempts = cfg.RetryAttempts
+	}
+	if cfg.RetryMaxElapsedTime != 0 {
+		policy.MaxElapsedTime = cfg.RetryMaxElapsedTime
+	}
+	if cfg.RetryJitter != 0 {
+		policy.Jitter = cfg.RetryJitter
+	}
+	return policy
+}
+
+// backoff returns how long to wait after the given (zero-indexed) failed
+// attempt.
+func (r RetryPolicy) backoff(attempt int) time.Duration {
+	interval := r.InitialInterval
+	for i := 0; i < attempt && (r.MaxInterval == 0 || interval < r.MaxInterval); i++ {
+		interval *= 2
+	}
+	if r.MaxInterval != 0 && interval > r.MaxInterval {
+		interval = r.MaxInterval
+	}
+	if r.Jitter > 0 {
+		delta := r.Jitter * float64(interval)
+		interval = time.Duration(float64(interval) - delta + rand.Float64()*2*delta)
+	}
+	return interval
+}
+
+// retry calls fn until it succeeds, it returns a non-retryable error, or the
+// policy is exhausted, returning the last error.
+func (r RetryPolicy) retry(fn func() (retryable bool, err error)) error {
+	start := time.Now()
+	var backpressure time.Duration
+	for attempt := 0; ; attempt++ {
+		retryable, err := fn()
+		if err == nil || !retryable {
+			return err
+		}
+
+		// The master is out of space for now, and says when to try again.
+		if insufficient, ok := errors.Cause(err).(*aggregation.InsufficientStorageError); ok && r.MaxBackpressureTime > 0 {
+			wait := insufficient.RetryAfter()
+			if wait <= 0 {
+				wait = r.backoff(0)
+			}
+			if backpressure+wait <= r.MaxBackpressureTime {
+				logrus.WithField("wait", wait).Warningf("Master is out of space, waiting to send results again: %v", err)
+				time.Sleep(wait)
+				backpressure += wait
+				start = start.Add(wait)
+				attempt--
+				continue
+			}
+		}
+
+		if r.Attempts > 0 && attempt+1 >= r.Attempts {
+			return err
+		}
+		if r.Attempts <= 0 && r.MaxElapsedTime == 0 {
+			return err
+		}
+
+		wait := r.backoff(attempt)
+		if r.MaxElapsedTime != 0 && time.Since(start)+wait > r.MaxElapsedTime {
+			return err
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"attempt": attempt + 1,
+			"wait":    wait,
+		}).Warningf("Retrying request to master: %v", err)
+		time.Sleep(wait)
+	}
+}
+
+// retryableStatus reports whether a response with the given status code is
+// worth retrying: the master may be restarting or overloaded, or have received
+// a corrupted copy of the results, but any other client error would fail again
+// the same way.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests ||
+		code == http.StatusUnprocessableEntity ||
+		code >= http.StatusInternalServerError
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// stopPatch lowers a pod's active deadline to a second, which has long
+// passed, so the kubelet stops all of its containers. Unlike deleting the pod,
+// it's left for the master to see why it stopped, and isn't recreated.
+var stopPatch = []byte(`{"spec":{"activeDeadlineSeconds":1}}`)
+
+// pluginPodNamespace and pluginPodName are the pod the worker and its plugin
+// run in, which is stopped if the plugin times out. The pod isn't stopped if
+// they aren't set.
+var pluginPodNamespace, pluginPodName string
+
+// SetPluginPod sets the pod the worker and its plugin run in, to be stopped
+// once the worker has reported that the plugin timed out.
+func SetPluginPod(namespace, name string) {
+	pluginPodNamespace, pluginPodName = namespace, name
+}
+
+// stopPlugin stops the plugin's container, along with the worker's own, by
+// stopping their pod.
+func stopPlugin() error {
+	if pluginPodName == "" {
+		return nil
+	}
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return errors.Wrap(err, "couldn't get in-cluster config")
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return errors.Wrap(err, "couldn't create kubernetes client")
+	}
+	return stopPod(client, pluginPodNamespace, pluginPodName)
+}
+
+func stopPod(client kubernetes.Interface, namespace, name string) error {
+	logrus.WithField("pod", name).Info("Stopping the plugin's pod")
+	_, err := client.CoreV1().Pods(namespace).Patch(name, types.StrategicMergePatchType, stopPatch)
+	return errors.Wrapf(err, "couldn't stop pod %v", name)
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/tarball"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// streamPollInterval is how often a streaming upload checks for new data or
+// for the done file.
+var streamPollInterval = 1 * time.Second
+
+// StreamResults is an alternative to GatherResults for plugins with very large
+// output. Instead of waiting for the done file before transmitting anything,
+// it starts a chunked upload to the master as soon as resultPath exists:
+//
+// 1. If resultPath is a file, it is tailed and sent as it grows. The upload
+//    finishes once the done file appears and the file has been drained.
+// 2. If resultPath is a directory, a gzipped tarball of it is generated on the
+//    fly once the done file appears, without ever being written to disk.
+//
+// If the done file appears before resultPath does, the done file is handled
+// exactly as GatherResults would, as are a timeout, the master asking for the
+// results so far, and ctx being done, until the upload has started. A file
+// that's being streamed is ended with what has been written to it so far in
+// the last two cases.
+func StreamResults(ctx context.Context, waitfile, resultPath, url string, client *http.Client) error {
+	logrus.WithFields(logrus.Fields{
+		"waitfile":   waitfile,
+		"resultPath": resultPath,
+	}).Info("Waiting for results to stream")
+
+	timeout := pluginTimeoutCh()
+	flush := func() error {
+		return sendPartialResults(filepath.Dir(waitfile), url, client)
+	}
+	for {
+		if info, err := os.Stat(resultPath); err == nil {
+			if info.IsDir() {
+				return streamDirectory(ctx, timeout, waitfile, resultPath, url, client)
+			}
+			return streamFile(ctx, timeout, waitfile, resultPath, url, client)
+		}
+
+		if resultFile, err := ioutil.ReadFile(waitfile); err == nil {
+			logrus.WithField("resultFile", string(resultFile)).Info("Detected done file before stream, transmitting result file")
+			return handleWaitFile(resultFile, url, client)
+		}
+
+		select {
+		case <-timeout:
+			return reportTimeout(url, client)
+		case <-flushRequested:
+			return flush()
+		case <-ctx.Done():
+			return stopWorker(ctx, flush)
+		case <-time.After(streamPollInterval):
+		}
+	}
+}
+
+func streamFile(ctx context.Context, timeout <-chan time.Time, waitfile, resultFile, url string, client *http.Client) error {
+	var outfile *os.File
+	var err error
+
+	defer func() {
+		if outfile != nil {
+			outfile.Close()
+		}
+	}()
+
+	logrus.WithField("resultFile", resultFile).Info("Streaming result file")
+	mimeType := mime.TypeByExtension(filepath.Ext(resultFile))
+
+	tail := &tailReader{waitfile: waitfile, ctx: ctx, timeout: timeout}
+	err = DoRequest(url, client, func() (io.Reader, string, error) {
+		// A retried upload starts again from the beginning of the file.
+		if outfile != nil {
+			outfile.Close()
+		}
+		outfile, err = os.Open(resultFile)
+		if err != nil {
+			return nil, mimeType, errors.WithStack(err)
+		}
+		// Once the plugin has timed out, a retry only sends what's there.
+		tail.file, tail.done = outfile, tail.timedOut
+		return tail, mimeType, nil
+	})
+	if tail.timedOut {
+		// The plugin timed out while it was being streamed, so it's
+		// reported as such in place of what was sent of it.
+		return reportTimeout(url, client)
+	}
+	if ctx.Err() != nil {
+		// The stream was ended early, which flushed it.
+		return &StoppedError{Err: ctx.Err(), FlushErr: err}
+	}
+	return err
+}
+
+func streamDirectory(ctx context.Context, timeout <-chan time.Time, waitfile, resultDir, url string, client *http.Client) error {
+	// A directory can't be tailed meaningfully, but we can still avoid
+	// building the tarball on disk by generating it as the request is sent.
+	flush := func() error {
+		return sendPartialResults(filepath.Dir(waitfile), url, client)
+	}
+	for !fileExists(waitfile) {
+		select {
+		case <-timeout:
+			return reportTimeout(url, client)
+		case <-flushRequested:
+			return flush()
+		case <-ctx.Done():
+			return stopWorker(ctx, flush)
+		case <-time.After(streamPollInterval):
+		}
+	}
+
+	logrus.WithField("resultDir", resultDir).Info("Streaming result directory")
+	return sendResultDir(resultDir, url, client, http.Header{})
+}
+
+// sendResultDir sends a directory to the master as a gzipped tarball,
+// generating it as the request is sent rather than writing it to disk.
+func sendResultDir(resultDir, url string, client *http.Client, headers http.Header) error {
+	return doRequestWithHeaders(url, client, headers, func() (io.Reader, string, error) {
+		reader, writer := io.Pipe()
+		go func() {
+			writer.CloseWithError(tarball.EncodeTarball(writer, resultDir))
+		}()
+		return reader, gzipMimeType, nil
+	})
+}
+
+// tailReader reads from a file that is still being written, blocking at the
+// end of the file until more data arrives. It only returns io.EOF once the
+// waitfile exists, ctx is done, the plugin times out or the master asks for
+// the results so far, and everything written before then has been read.
+type tailReader struct {
+	file     *os.File
+	waitfile string
+	ctx      context.Context
+	timeout  <-chan time.Time
+	done     bool
+	timedOut bool
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for {
+		n, err := t.file.Read(p)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, errors.WithStack(err)
+		}
+		if t.done {
+			return 0, io.EOF
+		}
+		// Check for the done file, then go around once more to drain
+		// anything written between our last read and the done file.
+		if fileExists(t.waitfile) {
+			t.done = true
+			continue
+		}
+		select {
+		case <-t.ctx.Done():
+			t.done = true
+		case <-flushRequested:
+			t.done = true
+		case <-t.timeout:
+			t.done, t.timedOut = true, true
+		case <-time.After(streamPollInterval):
+		}
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
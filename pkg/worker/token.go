@@ -0,0 +1,228 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/errlog"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// tokenRetryInterval is how long the worker waits before trying again when it
+// couldn't get a bound token, or couldn't write it.
+var tokenRetryInterval = time.Minute
+
+// mountedTokenFile is the service account token Kubernetes mounts in every
+// container, which plugins are given if a bound token can't be requested.
+var mountedTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// tokenRequest is a TokenRequest of the authentication.k8s.io/v1 API, which the
+// vendored client-go predates.
+type tokenRequest struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Spec       tokenRequestSpec   `json:"spec"`
+	Status     tokenRequestStatus `json:"status,omitempty"`
+}
+
+type tokenRequestSpec struct {
+	Audiences         []string              `json:"audiences"`
+	ExpirationSeconds int64                 `json:"expirationSeconds,omitempty"`
+	BoundObjectRef    *boundObjectReference `json:"boundObjectRef,omitempty"`
+}
+
+type boundObjectReference struct {
+	Kind       string    `json:"kind"`
+	APIVersion string    `json:"apiVersion"`
+	Name       string    `json:"name"`
+	UID        types.UID `json:"uid,omitempty"`
+}
+
+type tokenRequestStatus struct {
+	Token               string      `json:"token"`
+	ExpirationTimestamp metav1.Time `json:"expirationTimestamp"`
+}
+
+// WriteServiceAccountToken writes a new service account token for the plugin,
+// and a kubeconfig for the cluster that uses it, to the worker's token
+// directory. It returns when the token should be refreshed.
+func WriteServiceAccountToken(cfg *plugin.WorkerConfig) (time.Time, error) {
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "couldn't get in-cluster config")
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "couldn't create kubernetes client")
+	}
+	return writeServiceAccountToken(client.CoreV1().RESTClient(), restConfig, cfg)
+}
+
+// KeepServiceAccountToken refreshes the plugin's service account token
+// straight away, and then whenever it's due to be, until stop is closed.
+func KeepServiceAccountToken(cfg *plugin.WorkerConfig, stop <-chan struct{}) {
+	refresh := time.Now()
+	for {
+		select {
+		case <-time.After(time.Until(refresh)):
+		case <-stop:
+			return
+		}
+
+		var err error
+		if refresh, err = WriteServiceAccountToken(cfg); err != nil {
+			errlog.LogError(errors.Wrap(err, "couldn't refresh service account token, will retry"))
+			refresh = time.Now().Add(tokenRetryInterval)
+		}
+	}
+}
+
+// writeServiceAccountToken requests a token bound to the worker's pod, falling
+// back to the token mounted in the pod for clusters that can't issue bound
+// tokens, and writes it and a kubeconfig using it.
+func writeServiceAccountToken(client rest.Interface, restConfig *rest.Config, cfg *plugin.WorkerConfig) (time.Time, error) {
+	token, refresh, err := requestToken(client, cfg)
+	if err != nil {
+		logrus.WithError(err).Warning("Couldn't request a bound service account token, using the mounted token instead")
+		blob, readErr := ioutil.ReadFile(mountedTokenFile)
+		if readErr != nil {
+			return time.Time{}, errors.Wrap(readErr, "couldn't read mounted service account token")
+		}
+		token, refresh = strings.TrimSpace(string(blob)), time.Now().Add(tokenRetryInterval)
+	}
+
+	tokenFile := filepath.Join(cfg.TokenDir, plugin.TokenFile)
+	if err := writeFileAtomically(tokenFile, []byte(token)); err != nil {
+		return time.Time{}, err
+	}
+
+	kubeconfig := clientcmdapi.NewConfig()
+	kubeconfig.Clusters["sonobuoy"] = &clientcmdapi.Cluster{
+		Server:               restConfig.Host,
+		CertificateAuthority: restConfig.TLSClientConfig.CAFile,
+	}
+	kubeconfig.AuthInfos["sonobuoy"] = &clientcmdapi.AuthInfo{TokenFile: tokenFile}
+	kubeconfig.Contexts["sonobuoy"] = &clientcmdapi.Context{Cluster: "sonobuoy", AuthInfo: "sonobuoy"}
+	kubeconfig.CurrentContext = "sonobuoy"
+	blob, err := clientcmd.Write(*kubeconfig)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "couldn't encode kubeconfig")
+	}
+	if err := writeFileAtomically(filepath.Join(cfg.TokenDir, plugin.KubeconfigFile), blob); err != nil {
+		return time.Time{}, err
+	}
+
+	return refresh, nil
+}
+
+// requestToken asks the API server for a token for the worker's service
+// account, bound to its pod, and returns it with when it's due to be
+// refreshed, once most of its lifetime has passed.
+func requestToken(client rest.Interface, cfg *plugin.WorkerConfig) (string, time.Time, error) {
+	expiration := cfg.TokenExpirationSeconds
+	if expiration == 0 {
+		expiration = plugin.DefaultTokenExpirationSeconds
+	}
+	req := tokenRequest{
+		APIVersion: "authentication.k8s.io/v1",
+		Kind:       "TokenRequest",
+		Spec: tokenRequestSpec{
+			Audiences:         []string{},
+			ExpirationSeconds: expiration,
+		},
+	}
+	if cfg.TokenAudience != "" {
+		req.Spec.Audiences = []string{cfg.TokenAudience}
+	}
+	if cfg.PodName != "" {
+		req.Spec.BoundObjectRef = &boundObjectReference{
+			Kind:       "Pod",
+			APIVersion: "v1",
+			Name:       cfg.PodName,
+			UID:        types.UID(cfg.PodUID),
+		}
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", time.Time{}, errors.Wrap(err, "couldn't encode token request")
+	}
+	requested := time.Now()
+	raw, err := client.Post().
+		Namespace(cfg.Namespace).
+		Resource("serviceaccounts").
+		Name(cfg.ServiceAccountName).
+		SubResource("token").
+		SetHeader("Content-Type", "application/json").
+		Body(body).
+		Do().
+		Raw()
+	if err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "couldn't request token for service account %v", cfg.ServiceAccountName)
+	}
+
+	var resp tokenRequest
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "couldn't decode token request")
+	}
+	if resp.Status.Token == "" {
+		return "", time.Time{}, errors.New("token request returned no token")
+	}
+
+	expires := resp.Status.ExpirationTimestamp.Time
+	if expires.IsZero() {
+		expires = requested.Add(time.Duration(expiration) * time.Second)
+	}
+	return resp.Status.Token, requested.Add(expires.Sub(requested) * 4 / 5), nil
+}
+
+// writeFileAtomically replaces file with data, so that the plugin never reads
+// a partly written token or kubeconfig.
+func writeFileAtomically(file string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file))
+	if err != nil {
+		return errors.Wrapf(err, "couldn't create temporary file for %v", file)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "couldn't write %v", file)
+	}
+	// The plugin may run as a different user than the worker.
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return errors.Wrapf(err, "couldn't set permissions of %v", file)
+	}
+	return errors.Wrapf(os.Rename(tmp.Name(), file), "couldn't write %v", file)
+}
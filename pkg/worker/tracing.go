@@ -0,0 +1,49 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"net/http"
+
+	"github.com/heptio/sonobuoy/pkg/tracing"
+)
+
+// traceSpan is the span the worker's own spans are started in, or nil if the
+// worker isn't traced.
+var traceSpan *tracing.Span
+
+// SetTraceSpan sets the span that the worker's waiting for and submitting
+// results are traced in.
+func SetTraceSpan(span *tracing.Span) {
+	traceSpan = span
+}
+
+// withTraceparent returns a copy of headers that also carries the span a
+// submission is made in, so the master can trace handling it as part of the
+// same operation.
+func withTraceparent(headers http.Header, span *tracing.Span) http.Header {
+	traceparent := span.Context().Traceparent()
+	if traceparent == "" {
+		return headers
+	}
+	withSpan := make(http.Header, len(headers)+1)
+	for key, values := range headers {
+		withSpan[key] = values
+	}
+	withSpan.Set(tracing.TraceparentHeader, traceparent)
+	return withSpan
+}
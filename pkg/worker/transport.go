@@ -0,0 +1,255 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/heptio/sonobuoy/pkg/tarball"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// TransportReceiptFile is what the receipt of results delivered by a
+	// results transport is stored as by the master, in place of them.
+	TransportReceiptFile = "transport-receipt.json"
+
+	// transportTempFail is the exit code a results transport exits with
+	// when it failed but delivering the result again may work, such as when
+	// its destination is unavailable (EX_TEMPFAIL).
+	transportTempFail = 75
+
+	// maxTransportOutput is how much of a results transport's output is
+	// kept as where it delivered a result.
+	maxTransportOutput = 4096
+)
+
+// transportCommand is the command results are delivered with in place of
+// submitting them to the master, if they are, and transportResult the result
+// they're for.
+var (
+	transportCommand []string
+	transportResult  plugin.ExpectedResult
+)
+
+// SetResultsTransport has results for result delivered by running command,
+// a JSON array of the executable and its arguments, rather than submitted to
+// the master, which is only sent a receipt of them. An empty command turns
+// this off.
+//
+// The command is run once for each result file, with the file (or a gzipped
+// tarball of a directory) on stdin and these flags after its arguments:
+//
+//   --result-type=<type> --node=<node> --filename=<name> --content-type=<type> [--incomplete]
+//
+// --node is left out for global results. Whatever it writes to stdout, such
+// as the URL it delivered the result to, is recorded in the receipt. If it
+// exits with 75 (EX_TEMPFAIL), or can't be started, it's run again according
+// to the retry policy; any other failure is final.
+func SetResultsTransport(command string, result plugin.ExpectedResult) error {
+	if command == "" {
+		transportCommand = nil
+		return nil
+	}
+	var parsed []string
+	if err := json.Unmarshal([]byte(command), &parsed); err != nil {
+		return errors.Wrapf(err, "invalid results transport %q", command)
+	}
+	if len(parsed) == 0 {
+		return errors.Errorf("results transport %q has no command", command)
+	}
+	transportCommand, transportResult = parsed, result
+	return nil
+}
+
+// transportReceipt is what the master is sent in place of the results a
+// results transport delivered.
+type transportReceipt struct {
+	// Transport is the executable that delivered the results. Its
+	// arguments are left out, in case they're secret.
+	Transport string          `json:"transport"`
+	Files     []deliveredFile `json:"files"`
+	// Incomplete is set if the results are whatever the plugin had when
+	// the run was about to time out.
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// deliveredFile is a result file a results transport delivered.
+type deliveredFile struct {
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	// Location is what the transport wrote to stdout, such as where it
+	// delivered the file to.
+	Location string `json:"location,omitempty"`
+}
+
+// deliverResults delivers each result file with the results transport, then
+// sends the master a receipt of them. Incomplete results are marked as such in
+// both.
+func deliverResults(resultFiles []string, url string, client *http.Client, incomplete bool) error {
+	receipt := transportReceipt{
+		Transport:  transportCommand[0],
+		Incomplete: incomplete,
+	}
+	for _, resultFile := range resultFiles {
+		delivered, err := deliverResultFile(resultFile, incomplete)
+		if err != nil {
+			return err
+		}
+		receipt.Files = append(receipt.Files, delivered)
+	}
+
+	body, err := json.Marshal(receipt)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	headers := http.Header{}
+	headers.Set(aggregation.ContentDispositionHeader, mime.FormatMediaType("attachment", map[string]string{
+		"filename": TransportReceiptFile,
+	}))
+	if incomplete {
+		headers.Set(aggregation.IncompleteResultHeader, "true")
+	}
+	logrus.WithField("files", len(receipt.Files)).Info("Sending the receipt of the delivered results to the master")
+	return doRequestWithHeaders(url, client, headers, func() (io.Reader, string, error) {
+		return bytes.NewReader(body), "application/json", nil
+	})
+}
+
+// deliverResultFile runs the results transport on a result file, or a gzipped
+// tarball of a result directory, retrying it if it fails temporarily.
+func deliverResultFile(resultFile string, incomplete bool) (deliveredFile, error) {
+	delivered := deliveredFile{Name: filepath.Base(resultFile)}
+	open := func() (io.ReadCloser, error) {
+		return os.Open(resultFile)
+	}
+	if info, err := os.Stat(resultFile); err == nil && info.IsDir() {
+		delivered.Name += ".tar.gz"
+		delivered.ContentType = gzipMimeType
+		open = func() (io.ReadCloser, error) {
+			reader, writer := io.Pipe()
+			go func() {
+				writer.CloseWithError(tarball.EncodeTarball(writer, resultFile))
+			}()
+			return reader, nil
+		}
+	} else if delivered.ContentType = mime.TypeByExtension(filepath.Ext(resultFile)); delivered.ContentType == "" {
+		delivered.ContentType = "application/octet-stream"
+	}
+
+	args := append(append([]string(nil), transportCommand[1:]...),
+		"--result-type="+transportResult.ResultType,
+		"--filename="+delivered.Name,
+		"--content-type="+delivered.ContentType,
+	)
+	if transportResult.NodeName != "" {
+		args = append(args, "--node="+transportResult.NodeName)
+	}
+	if incomplete {
+		args = append(args, "--incomplete")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"resultFile": resultFile,
+		"transport":  transportCommand[0],
+	}).Info("Delivering result file with the results transport")
+	span := traceSpan.Child("worker.transport", map[string]string{"sonobuoy.transport": transportCommand[0]})
+	err := retryPolicy.retry(func() (bool, error) {
+		input, err := open()
+		if err != nil {
+			return false, errors.Wrapf(err, "couldn't open result file %v", resultFile)
+		}
+		defer input.Close()
+
+		counted := &countingReader{reader: input, hash: sha256.New()}
+		output := &cappedBuffer{max: maxTransportOutput}
+		cmd := exec.Command(transportCommand[0], args...)
+		cmd.Stdin = counted
+		cmd.Stdout = output
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return transportRetryable(err), errors.Wrapf(err, "results transport %v failed to deliver %v", transportCommand[0], resultFile)
+		}
+
+		delivered.Size = counted.n
+		delivered.SHA256 = hex.EncodeToString(counted.hash.Sum(nil))
+		delivered.Location = strings.TrimSpace(output.String())
+		return false, nil
+	})
+	span.End(err)
+	return delivered, err
+}
+
+// transportRetryable reports whether a results transport that failed with err
+// is worth running again: it couldn't be started, such as because a sidecar
+// hasn't installed it yet, or it exited with transportTempFail.
+func transportRetryable(err error) bool {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return true
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && status.ExitStatus() == transportTempFail
+}
+
+// countingReader counts and hashes everything read through it.
+type countingReader struct {
+	reader io.Reader
+	hash   hash.Hash
+	n      int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.hash.Write(p[:n])
+	c.n += int64(n)
+	return n, err
+}
+
+// cappedBuffer keeps up to max bytes written to it, discarding the rest.
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if room := c.max - c.Len(); room > 0 {
+		if len(p) > room {
+			c.Buffer.Write(p[:room])
+		} else {
+			c.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
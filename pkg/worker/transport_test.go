@@ -0,0 +1,181 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heptio/sonobuoy/pkg/backplane/ca/authtest"
+	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+)
+
+// TestTransportHelperProcess isn't a real test. It's run as the results
+// transport by the tests below, storing each file it's given in
+// $TEST_TRANSPORT_DIR, after failing $TEST_TRANSPORT_FAILURES times with
+// $TEST_TRANSPORT_EXIT.
+func TestTransportHelperProcess(t *testing.T) {
+	dir := os.Getenv("TEST_TRANSPORT_DIR")
+	if dir == "" {
+		return
+	}
+
+	attempts, _ := filepath.Glob(filepath.Join(dir, ".attempt-*"))
+	ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf(".attempt-%d", len(attempts))), nil, 0644)
+	if failures, _ := strconv.Atoi(os.Getenv("TEST_TRANSPORT_FAILURES")); len(attempts) < failures {
+		code, _ := strconv.Atoi(os.Getenv("TEST_TRANSPORT_EXIT"))
+		os.Exit(code)
+	}
+
+	flags := map[string]string{}
+	for _, arg := range os.Args {
+		if parts := strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2); strings.HasPrefix(arg, "--") && len(parts) == 2 {
+			flags[parts[0]] = parts[1]
+		} else if arg == "--incomplete" {
+			flags["incomplete"] = "true"
+		}
+	}
+	b, _ := ioutil.ReadAll(os.Stdin)
+	name := flags["result-type"] + "-" + flags["filename"]
+	ioutil.WriteFile(filepath.Join(dir, name), b, 0644)
+	flagsJSON, _ := json.Marshal(flags)
+	ioutil.WriteFile(filepath.Join(dir, name+".flags"), flagsJSON, 0644)
+	fmt.Printf("file://%v\n", filepath.Join(dir, name))
+	os.Exit(0)
+}
+
+// withTransport has results delivered by TestTransportHelperProcess, storing
+// them in dir, until the test is over.
+func withTransport(t *testing.T, result plugin.ExpectedResult, dir string, failures, exitCode int) {
+	command, _ := json.Marshal([]string{os.Args[0], "-test.run=TestTransportHelperProcess", "--"})
+	if err := SetResultsTransport(string(command), result); err != nil {
+		t.Fatalf("couldn't set results transport: %v", err)
+	}
+	os.Setenv("TEST_TRANSPORT_DIR", dir)
+	os.Setenv("TEST_TRANSPORT_FAILURES", strconv.Itoa(failures))
+	os.Setenv("TEST_TRANSPORT_EXIT", strconv.Itoa(exitCode))
+	SetRetryPolicy(RetryPolicy{Attempts: 3, InitialInterval: time.Millisecond})
+}
+
+func resetTransport() {
+	SetResultsTransport("", plugin.ExpectedResult{})
+	os.Unsetenv("TEST_TRANSPORT_DIR")
+	SetRetryPolicy(DefaultRetryPolicy)
+}
+
+func TestRunGlobal_transport(t *testing.T) {
+	defer resetTransport()
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		url, err := aggregation.GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+
+		withTempDir(t, func(tmpdir string) {
+			delivered := filepath.Join(tmpdir, "delivered")
+			os.MkdirAll(delivered, 0755)
+			// The transport fails temporarily once, so it's run again.
+			withTransport(t, expectedResults[0], delivered, 1, transportTempFail)
+
+			os.MkdirAll(tmpdir+"/logs", 0755)
+			ioutil.WriteFile(tmpdir+"/logs/e2e.log", []byte("log"), 0755)
+			ioutil.WriteFile(tmpdir+"/junit.xml", []byte("<xml/>"), 0755)
+			ioutil.WriteFile(tmpdir+"/done", []byte(tmpdir+"/junit.xml\n"+tmpdir+"/logs\n"), 0755)
+			if err := GatherResults(context.Background(), tmpdir+"/done", url, srv.Client()); err != nil {
+				t.Fatalf("Got error running agent: %v", err)
+			}
+
+			if attempts, _ := filepath.Glob(filepath.Join(delivered, ".attempt-*")); len(attempts) != 3 {
+				t.Errorf("expected the transport to be run again after failing temporarily, got %v runs", len(attempts))
+			}
+			if b, err := ioutil.ReadFile(filepath.Join(delivered, "e2e-junit.xml")); err != nil || string(b) != "<xml/>" {
+				t.Errorf("expected the transport to deliver junit.xml, got %q: %v", b, err)
+			}
+			flags := map[string]string{}
+			b, _ := ioutil.ReadFile(filepath.Join(delivered, "e2e-logs.tar.gz.flags"))
+			json.Unmarshal(b, &flags)
+			if flags["content-type"] != gzipMimeType || flags["node"] != "" || flags["incomplete"] != "" {
+				t.Errorf("expected the directory to be delivered as a tarball of a global result, got flags %v", flags)
+			}
+
+			// The master only gets the receipt.
+			if _, err := os.Stat(path.Join(aggr.OutputDir, "e2e", "results", "junit.xml")); !os.IsNotExist(err) {
+				t.Errorf("expected the results not to be submitted to the master, got %v", err)
+			}
+			b, err := ioutil.ReadFile(path.Join(aggr.OutputDir, "e2e", "results", TransportReceiptFile))
+			if err != nil {
+				t.Fatalf("expected the master to get a receipt: %v", err)
+			}
+			receipt := transportReceipt{}
+			if err := json.Unmarshal(b, &receipt); err != nil {
+				t.Fatalf("couldn't decode receipt %s: %v", b, err)
+			}
+			if len(receipt.Files) != 2 || receipt.Transport != os.Args[0] || receipt.Incomplete {
+				t.Fatalf("unexpected receipt %s", b)
+			}
+			junit := receipt.Files[0]
+			if junit.Name != "junit.xml" || junit.Size != 6 || junit.SHA256 == "" || junit.Location != "file://"+filepath.Join(delivered, "e2e-junit.xml") {
+				t.Errorf("unexpected receipt for junit.xml %+v", junit)
+			}
+			if _, ok := aggr.Results["e2e"]; !ok {
+				t.Errorf("expected the receipt to complete the result, got %v", aggr.Results)
+			}
+		})
+	})
+}
+
+func TestDeliverResultFile_failure(t *testing.T) {
+	defer resetTransport()
+	withTempDir(t, func(tmpdir string) {
+		ioutil.WriteFile(tmpdir+"/e2e.log", []byte("log"), 0755)
+
+		// Any failure besides a temporary one isn't retried.
+		withTransport(t, plugin.ExpectedResult{ResultType: "e2e", NodeName: "node1"}, tmpdir, 3, 1)
+		if _, err := deliverResultFile(tmpdir+"/e2e.log", true); err == nil {
+			t.Fatal("expected the transport to fail")
+		}
+		if attempts, _ := filepath.Glob(filepath.Join(tmpdir, ".attempt-*")); len(attempts) != 1 {
+			t.Errorf("expected the transport to be run once, got %v", len(attempts))
+		}
+	})
+}
+
+func TestSetResultsTransport(t *testing.T) {
+	defer resetTransport()
+	for _, command := range []string{"/bin/send", `[]`} {
+		if err := SetResultsTransport(command, plugin.ExpectedResult{}); err == nil {
+			t.Errorf("expected %q to be rejected", command)
+		}
+	}
+	if err := SetResultsTransport(`["/bin/send", "--topic=results"]`, plugin.ExpectedResult{ResultType: "e2e"}); err != nil || len(transportCommand) != 2 {
+		t.Errorf("expected the transport to be set, got %v: %v", transportCommand, err)
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// watchedPollInterval is how often a watched file is checked anyway, in case
+// its filesystem doesn't deliver events for it.
+var watchedPollInterval = 30 * time.Second
+
+// watchFile returns a channel that's sent to straight away, then whenever the
+// file may have changed, until stop is closed. The file's directory is watched
+// with inotify, or the OS's equivalent, so the worker hears of the file as soon
+// as it's written without polling for it every second, which adds up on
+// DaemonSet runs with thousands of workers. Where the directory can't be
+// watched, the file is polled for every waitfilePollInterval instead.
+func watchFile(path string, stop <-chan struct{}) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	interval := waitfilePollInterval
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = watcher.Add(filepath.Dir(path)); err != nil {
+			watcher.Close()
+		}
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("file", path).Info("Couldn't watch for file, polling for it instead")
+	} else {
+		events, errs = watcher.Events, watcher.Errors
+		interval = watchedPollInterval
+	}
+
+	go func() {
+		if events != nil {
+			defer watcher.Close()
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// The file may already be there.
+		notify()
+		for {
+			select {
+			case event := <-events:
+				if filepath.Clean(event.Name) == filepath.Clean(path) {
+					notify()
+				}
+			case err := <-errs:
+				logrus.WithError(err).WithField("file", path).Info("Error watching for file")
+			case <-ticker.C:
+				notify()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return changes
+}
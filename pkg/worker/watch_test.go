@@ -0,0 +1,126 @@
+/*
+Copyright 2018 Heptio Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// expectChange fails the test unless changes is sent to within a few seconds.
+func expectChange(t *testing.T, changes <-chan struct{}, desc string) {
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected to be told %v", desc)
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	// Polling would take far too long, so only a watch can notice the file.
+	waitfilePollInterval, watchedPollInterval = time.Hour, time.Hour
+	defer func() { waitfilePollInterval, watchedPollInterval = 1*time.Second, 30*time.Second }()
+
+	withTempDir(t, func(tmpdir string) {
+		stop := make(chan struct{})
+		defer close(stop)
+		waitfile := filepath.Join(tmpdir, "done")
+		changes := watchFile(waitfile, stop)
+		expectChange(t, changes, "to check for the file straight away")
+
+		// Other files in the directory are ignored.
+		ioutil.WriteFile(filepath.Join(tmpdir, "e2e.log"), []byte("log"), 0644)
+		select {
+		case <-changes:
+			t.Fatalf("expected changes to other files to be ignored")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		ioutil.WriteFile(waitfile, []byte(tmpdir+"/e2e.log"), 0644)
+		expectChange(t, changes, "of the done file")
+	})
+}
+
+func TestWatchFile_polling(t *testing.T) {
+	waitfilePollInterval = 10 * time.Millisecond
+	defer func() { waitfilePollInterval = 1 * time.Second }()
+
+	withTempDir(t, func(tmpdir string) {
+		stop := make(chan struct{})
+		defer close(stop)
+		// A directory that doesn't exist can't be watched.
+		changes := watchFile(filepath.Join(tmpdir, "missing", "done"), stop)
+		expectChange(t, changes, "to check for the file straight away")
+		expectChange(t, changes, "to poll for the file")
+	})
+}
+
+func TestWaitForResults_emptyDoneFile(t *testing.T) {
+	waitfilePollInterval, watchedPollInterval = time.Hour, time.Hour
+	defer func() { waitfilePollInterval, watchedPollInterval = 1*time.Second, 30*time.Second }()
+
+	withTempDir(t, func(tmpdir string) {
+		// The done file is created before the plugin writes to it.
+		waitfile := filepath.Join(tmpdir, "done")
+		ioutil.WriteFile(waitfile, nil, 0644)
+		time.AfterFunc(50*time.Millisecond, func() {
+			ioutil.WriteFile(waitfile, []byte(tmpdir+"/e2e.log"), 0644)
+		})
+
+		var handled string
+		err := waitForResults(context.Background(), waitfile, func(contents []byte) error {
+			handled = string(contents)
+			return nil
+		}, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if handled != tmpdir+"/e2e.log" {
+			t.Errorf("expected the done file to be handled once it was written, got %q", handled)
+		}
+	})
+}
+
+func TestWaitForResults_staysEmpty(t *testing.T) {
+	waitfilePollInterval, watchedPollInterval, emptyDoneFileDelay = time.Hour, time.Hour, 10*time.Millisecond
+	defer func() {
+		waitfilePollInterval, watchedPollInterval, emptyDoneFileDelay = 1*time.Second, 30*time.Second, 1*time.Second
+	}()
+
+	withTempDir(t, func(tmpdir string) {
+		waitfile := filepath.Join(tmpdir, "done")
+		ioutil.WriteFile(waitfile, nil, 0644)
+
+		handled := false
+		err := waitForResults(context.Background(), waitfile, func(contents []byte) error {
+			handled = true
+			if len(contents) != 0 {
+				t.Errorf("expected an empty done file, got %q", contents)
+			}
+			return nil
+		}, nil, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !handled {
+			t.Error("expected the empty done file to be handled")
+		}
+	})
+}
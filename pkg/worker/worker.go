@@ -17,6 +17,10 @@ limitations under the License.
 package worker
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"mime"
@@ -24,52 +28,275 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
-	"syscall"
+	"strings"
 	"time"
 
+	"github.com/heptio/sonobuoy/pkg/errlog"
 	"github.com/heptio/sonobuoy/pkg/plugin"
+	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+const gzipMimeType = "application/gzip"
+
 func init() {
-	mime.AddExtensionType(".gz", "application/gzip")
+	mime.AddExtensionType(".gz", gzipMimeType)
 }
 
+// waitfilePollInterval is how often the worker checks for the done file when
+// it can't watch for it.
+var waitfilePollInterval = 1 * time.Second
+
+// emptyDoneFileDelay is how long an empty done file has to stay empty before
+// it's handled, since the plugin may not have written to it yet.
+var emptyDoneFileDelay = 1 * time.Second
+
 // GatherResults is the consumer of a co-scheduled container that agrees on the following
 // contract:
 //
 // 1. Output data will be placed into an agreed upon results directory.
 // 2. The Job will wait for a done file
-// 3. The done file contains a single string of the results to be sent to the master
-func GatherResults(waitfile string, url string, client *http.Client) error {
+// 3. The done file contains the path of the results to be sent to the master.
+//    Several results files can be given, either one per line or as a JSON
+//    array of paths. A directory is sent as a gzipped tarball, generated on
+//    the fly.
+//
+// If the plugin has a timeout and the done file doesn't appear in time, a
+// timeout is reported to the master in place of the results. If the master
+// asks for results because the run is about to time out, whatever is in the
+// results directory is sent, marked as incomplete.
+//
+// If ctx is done first, because the worker is shutting down or its deadline
+// has passed, whatever is in the results directory is sent the same way and a
+// *StoppedError is returned.
+//
+// With a results transport, results are delivered by it instead, and the
+// master is sent a receipt of them; see SetResultsTransport.
+func GatherResults(ctx context.Context, waitfile string, url string, client *http.Client) error {
+	return waitForResults(ctx, waitfile, func(resultFile []byte) error {
+		logrus.WithField("resultFile", string(resultFile)).Info("Detected done file, transmitting result file")
+		return handleWaitFile(resultFile, url, client)
+	}, func() error {
+		return reportTimeout(url, client)
+	}, func() error {
+		return sendPartialResults(filepath.Dir(waitfile), url, client)
+	})
+}
+
+// StoppedError is returned when the worker stops before the plugin writes its
+// done file, once whatever results there were have been flushed.
+type StoppedError struct {
+	// Err is why the worker stopped: the error of its context, which is
+	// context.Canceled when it was shut down, such as by a signal, or
+	// context.DeadlineExceeded.
+	Err error
+	// FlushErr is why the results so far couldn't be flushed, if they
+	// couldn't.
+	FlushErr error
+}
+
+func (e *StoppedError) Error() string {
+	msg := fmt.Sprintf("worker stopped before the plugin finished: %v", e.Err)
+	if e.FlushErr != nil {
+		msg += fmt.Sprintf(", and couldn't flush partial results: %v", e.FlushErr)
+	}
+	return msg
+}
+
+// waitForResults waits for the done file, then handles its contents, unless
+// the plugin times out first, in which case that's handled instead. If
+// handleFlush is given, it's called instead if the master asks for whatever
+// results there are so far, or if ctx is done first.
+func waitForResults(ctx context.Context, waitfile string, handle func(contents []byte) error, handleTimeout func() error, handleFlush func() error) error {
 	logrus.WithField("waitfile", waitfile).Info("Waiting for waitfile")
-	signals := sigHandler()
-	ticker := time.Tick(1 * time.Second)
-	stop := make(chan struct{}, 1)
-	// TODO(chuckha) evaluate wait.Until [https://github.com/kubernetes/apimachinery/blob/e9ff529c66f83aeac6dff90f11ea0c5b7c4d626a/pkg/util/wait/wait.go]
+	span := traceSpan.Child("worker.wait", map[string]string{"sonobuoy.waitfile": waitfile})
+	stopWatching := make(chan struct{})
+	defer close(stopWatching)
+	changes := watchFile(waitfile, stopWatching)
+	timeout := pluginTimeoutCh()
+	var flush <-chan struct{}
+	if handleFlush != nil {
+		flush = flushRequested
+	}
+
+	// A done file that's only just been created may not have been written
+	// yet, so an empty one is only handled once it's stayed empty for a
+	// while.
+	var settled <-chan time.Time
 	for {
 		select {
-		case <-ticker:
-			if resultFile, err := ioutil.ReadFile(waitfile); err == nil {
-				logrus.WithField("resultFile", string(resultFile)).Info("Detected done file, transmitting result file")
-				return handleWaitFile(string(resultFile), url, client)
+		case <-changes:
+			contents, err := ioutil.ReadFile(waitfile)
+			if err != nil {
+				continue
+			}
+			if len(bytes.TrimSpace(contents)) == 0 {
+				if settled == nil {
+					settled = time.After(emptyDoneFileDelay)
+				}
+				continue
+			}
+			span.End(nil)
+			return handle(contents)
+		case <-settled:
+			settled = nil
+			contents, err := ioutil.ReadFile(waitfile)
+			if err != nil {
+				continue
+			}
+			span.End(nil)
+			return handle(contents)
+		case <-timeout:
+			span.End(errors.Errorf("plugin timed out after %v", pluginTimeout))
+			return handleTimeout()
+		case <-flush:
+			span.End(errors.New("run timed out before the plugin finished"))
+			return handleFlush()
+		case <-ctx.Done():
+			// The plugin may have finished while the worker was shutting
+			// down.
+			if contents, err := ioutil.ReadFile(waitfile); err == nil {
+				span.End(nil)
+				return handle(contents)
+			}
+			span.End(&StoppedError{Err: ctx.Err()})
+			return stopWorker(ctx, handleFlush)
+		}
+	}
+}
+
+// stopWorker flushes whatever results there are with flush, if it's given,
+// once ctx is done before the plugin has finished, and returns the
+// *StoppedError saying so.
+func stopWorker(ctx context.Context, flush func() error) error {
+	logrus.WithError(ctx.Err()).Warning("Did not receive plugin results in time. Shutting down worker.")
+	stopped := &StoppedError{Err: ctx.Err()}
+	if flush != nil {
+		stopped.FlushErr = flush()
+	}
+	return stopped
+}
+
+// shutdownGracePeriod is how long the plugin has to write its done file once
+// the worker is told to shut down. It's half of the plugin pod's grace period,
+// leaving the rest for flushing the results so far if it doesn't.
+var shutdownGracePeriod = time.Duration(plugin.GracefulShutdownPeriod) * time.Second / 2
+
+// WithShutdownSignals returns a context that's cancelled shutdownGracePeriod
+// after the worker is sent a shutdown signal, which signals those are depending
+// on the OS, giving the plugin that long to finish. The returned cancel func
+// must be called to stop handling signals.
+func WithShutdownSignals(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, shutdownSignals...)
+	go func() {
+		defer signal.Stop(sigc)
+		select {
+		case sig := <-sigc:
+			logrus.WithField("signal", sig).Infof("Got a signal, giving the plugin %v to finish before shutting down", shutdownGracePeriod)
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case <-time.After(shutdownGracePeriod):
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// sendPartialResults sends everything in the results directory, marked as
+// incomplete, for a plugin that hasn't finished when the run is about to time
+// out.
+func sendPartialResults(resultsDir, url string, client *http.Client) error {
+	logrus.WithField("resultsDir", resultsDir).Warning("Run is about to time out, transmitting partial results")
+	if transportCommand != nil {
+		return deliverResults([]string{resultsDir}, url, client, true)
+	}
+	headers := http.Header{}
+	headers.Set(aggregation.IncompleteResultHeader, "true")
+	return sendResultDir(resultsDir, url, client, headers)
+}
+
+func handleWaitFile(contents []byte, url string, client *http.Client) error {
+	resultFiles, err := parseWaitFile(contents)
+	if err != nil {
+		return err
+	}
+
+	// A results transport delivers them instead, and the master only gets
+	// a receipt.
+	if transportCommand != nil {
+		return deliverResults(resultFiles, url, client, false)
+	}
+
+	// A single file is sent on its own, as it always has been.
+	if len(resultFiles) == 1 {
+		return sendResultFile(resultFiles[0], url, client, http.Header{})
+	}
+
+	for i, resultFile := range resultFiles {
+		headers := http.Header{}
+		headers.Set(aggregation.ContentDispositionHeader, mime.FormatMediaType("attachment", map[string]string{
+			"filename": filepath.Base(resultFile),
+		}))
+		// The last file completes the result
+		if i < len(resultFiles)-1 {
+			headers.Set(aggregation.PartialResultHeader, "true")
+		}
+
+		logrus.WithField("resultFile", resultFile).Info("Transmitting result file")
+		if err := sendResultFile(resultFile, url, client, headers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseWaitFile gets the list of result files from the contents of a done
+// file. The contents are either a JSON array of paths, or paths separated by
+// newlines.
+func parseWaitFile(contents []byte) ([]string, error) {
+	trimmed := bytes.TrimSpace(contents)
+	var resultFiles []string
+
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(trimmed, &resultFiles); err != nil {
+			return nil, errors.Wrap(err, "couldn't decode done file")
+		}
+	} else {
+		for _, line := range strings.Split(string(trimmed), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				resultFiles = append(resultFiles, line)
 			}
-		case <-signals:
-			// Run a goroutine here so we can keep checking the done file before cleaning up.
-			go func() {
-				time.Sleep(plugin.GracefulShutdownPeriod)
-				stop <- struct{}{}
-			}()
-		case <-stop:
-			logrus.Info("Did not receive plugin results in time. Shutting down worker.")
-			close(stop)
-			return nil
 		}
 	}
+
+	if len(resultFiles) == 0 {
+		return nil, errors.New("done file doesn't list any result files")
+	}
+
+	// Each file is stored under its base name, so two with the same one
+	// would overwrite each other.
+	names := map[string]string{}
+	for _, resultFile := range resultFiles {
+		name := filepath.Base(resultFile)
+		if other, ok := names[name]; ok {
+			return nil, errors.Errorf("done file lists both %v and %v, which would be stored under the same name %v", other, resultFile, name)
+		}
+		names[name] = resultFile
+	}
+	return resultFiles, nil
 }
 
-func handleWaitFile(resultFile, url string, client *http.Client) error {
+func sendResultFile(resultFile, url string, client *http.Client, headers http.Header) error {
+	if info, err := os.Stat(resultFile); err == nil && info.IsDir() {
+		return sendResultDir(resultFile, url, client, headers)
+	}
+
 	var outfile *os.File
 	var err error
 
@@ -83,21 +310,60 @@ func handleWaitFile(resultFile, url string, client *http.Client) error {
 		}
 	}()
 
-	// transmit back the results file.
-	return DoRequest(url, client, func() (io.Reader, string, error) {
+	// transmit back the results file. Each attempt, including sending it to
+	// the external endpoint, reads it from the beginning again.
+	return doRequestWithHeaders(url, client, headers, func() (io.Reader, string, error) {
+		if outfile != nil {
+			outfile.Close()
+		}
 		outfile, err = os.Open(resultFile)
-		return outfile, mimeType, errors.WithStack(err)
+		if err != nil {
+			return nil, mimeType, errors.WithStack(err)
+		}
+		return outfile, mimeType, nil
 	})
 }
 
-// sigHandler is used to manage graceful cleanups when a TERM signal is received.
-func sigHandler() <-chan struct{} {
-	stop := make(chan struct{})
-	go func() {
-		sigc := make(chan os.Signal, 1)
-		signal.Notify(sigc, syscall.SIGTERM)
-		sig := <-sigc
-		logrus.WithField("signal", sig).Info("got a signal, waiting then sending the real shutdown signal")
-	}()
-	return stop
+// pluginTimeout is how long the plugin has to write the done file; zero means
+// there's no limit.
+var pluginTimeout time.Duration
+
+// SetPluginTimeout sets how long the plugin has to write the done file before
+// a timeout is reported instead of its results.
+func SetPluginTimeout(timeout time.Duration) {
+	pluginTimeout = timeout
+}
+
+// pluginTimeoutCh returns a channel that fires when the plugin times out, or
+// never if it has no timeout.
+func pluginTimeoutCh() <-chan time.Time {
+	if pluginTimeout <= 0 {
+		return nil
+	}
+	return time.After(pluginTimeout)
+}
+
+// reportTimeout tells the master the plugin timed out, in place of its
+// results, then stops the plugin.
+func reportTimeout(url string, client *http.Client) error {
+	logrus.WithField("timeout", pluginTimeout).Warning("Plugin timed out, reporting it instead of results")
+
+	errbody, err := json.Marshal(map[string]string{
+		"error": fmt.Sprintf("plugin timed out after %v", pluginTimeout),
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	headers := http.Header{}
+	headers.Set(aggregation.TimedOutHeader, "true")
+	err = doRequestWithHeaders(url, client, headers, func() (io.Reader, string, error) {
+		return bytes.NewReader(errbody), "application/json", nil
+	})
+	// The plugin is stopped even if the timeout couldn't be reported, since
+	// the master times it out anyway.
+	if stopErr := stopPlugin(); stopErr != nil {
+		errlog.LogError(errors.Wrap(stopErr, "couldn't stop the plugin after it timed out"))
+	}
+	return err
 }
@@ -17,16 +17,34 @@ limitations under the License.
 package worker
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/heptio/sonobuoy/pkg/backplane/ca/authtest"
+	"github.com/heptio/sonobuoy/pkg/buildinfo"
 	"github.com/heptio/sonobuoy/pkg/plugin"
 	"github.com/heptio/sonobuoy/pkg/plugin/aggregation"
+	"github.com/heptio/sonobuoy/pkg/tracing"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 func TestRun(t *testing.T) {
@@ -51,7 +69,7 @@ func TestRun(t *testing.T) {
 			withTempDir(t, func(tmpdir string) {
 				ioutil.WriteFile(tmpdir+"/systemd_logs", []byte("{}"), 0755)
 				ioutil.WriteFile(tmpdir+"/done", []byte(tmpdir+"/systemd_logs"), 0755)
-				err := GatherResults(tmpdir+"/done", URL, srv.Client())
+				err := GatherResults(context.Background(), tmpdir+"/done", URL, srv.Client())
 				if err != nil {
 					t.Fatalf("Got error running agent: %v", err)
 				}
@@ -78,7 +96,7 @@ func TestRunGlobal(t *testing.T) {
 		withTempDir(t, func(tmpdir string) {
 			ioutil.WriteFile(tmpdir+"/systemd_logs.json", []byte("{}"), 0755)
 			ioutil.WriteFile(tmpdir+"/done", []byte(tmpdir+"/systemd_logs.json"), 0755)
-			err := GatherResults(tmpdir+"/done", url, srv.Client())
+			err := GatherResults(context.Background(), tmpdir+"/done", url, srv.Client())
 			if err != nil {
 				t.Fatalf("Got error running agent: %v", err)
 			}
@@ -103,7 +121,7 @@ func TestRunGlobal_noExtension(t *testing.T) {
 		withTempDir(t, func(tmpdir string) {
 			ioutil.WriteFile(tmpdir+"/systemd_logs", []byte("{}"), 0755)
 			ioutil.WriteFile(tmpdir+"/done", []byte(tmpdir+"/systemd_logs"), 0755)
-			err := GatherResults(tmpdir+"/done", url, srv.Client())
+			err := GatherResults(context.Background(), tmpdir+"/done", url, srv.Client())
 			if err != nil {
 				t.Fatalf("Got error running agent: %v", err)
 			}
@@ -140,10 +158,1395 @@ func withAggregator(t *testing.T, expectedResults []plugin.ExpectedResult, callb
 
 		// Configure the aggregator
 		aggr := aggregation.NewAggregator(tmpdir, expectedResults)
-		handler := aggregation.NewHandler(aggr.HandleHTTPResult)
+		handler := aggregation.NewHandler(aggr.HandleHTTPResult, aggr.HandleHTTPProgress, aggr.HandleHTTPHeartbeat)
 		srv := authtest.NewTLSServer(handler, t)
 		defer srv.Close()
 
 		callback(aggr, srv)
 	})
 }
+
+func TestStreamResults(t *testing.T) {
+	streamPollInterval = 10 * time.Millisecond
+
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "systemd_logs"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		url, err := aggregation.GlobalResultURL(srv.URL, "systemd_logs")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+
+		withTempDir(t, func(tmpdir string) {
+			resultFile := tmpdir + "/systemd_logs"
+			ioutil.WriteFile(resultFile, []byte("first "), 0755)
+
+			errc := make(chan error, 1)
+			go func() {
+				errc <- StreamResults(context.Background(), tmpdir+"/done", resultFile, url, srv.Client())
+			}()
+
+			// Keep writing after the upload has started
+			time.Sleep(50 * time.Millisecond)
+			f, err := os.OpenFile(resultFile, os.O_APPEND|os.O_WRONLY, 0755)
+			if err != nil {
+				t.Fatalf("couldn't open result file: %v", err)
+			}
+			f.WriteString("second")
+			f.Close()
+			ioutil.WriteFile(tmpdir+"/done", []byte(resultFile), 0755)
+
+			if err := <-errc; err != nil {
+				t.Fatalf("Got error streaming results: %v", err)
+			}
+
+			contents, err := ioutil.ReadFile(path.Join(aggr.OutputDir, "systemd_logs", "results"))
+			if err != nil {
+				t.Fatalf("couldn't read streamed results: %v", err)
+			}
+			if string(contents) != "first second" {
+				t.Errorf("expected streamed results %q, got %q", "first second", string(contents))
+			}
+		})
+	})
+}
+
+func TestStreamResults_timeout(t *testing.T) {
+	streamPollInterval = 10 * time.Millisecond
+	SetPluginTimeout(50 * time.Millisecond)
+	defer SetPluginTimeout(0)
+
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "systemd_logs"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		url, err := aggregation.GlobalResultURL(srv.URL, "systemd_logs")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+
+		withTempDir(t, func(tmpdir string) {
+			resultFile := tmpdir + "/systemd_logs"
+			ioutil.WriteFile(resultFile, []byte("so far"), 0755)
+
+			// No done file is ever written
+			if err := StreamResults(context.Background(), tmpdir+"/done", resultFile, url, srv.Client()); err != nil {
+				t.Fatalf("Got error reporting timeout: %v", err)
+			}
+
+			result, ok := aggr.Results["systemd_logs"]
+			if !ok {
+				t.Fatalf("expected a timeout to be reported, got %v", aggr.Results)
+			}
+			if !result.TimedOut || result.IsSuccess() {
+				t.Errorf("expected a timed out error result, got %+v", result)
+			}
+		})
+	})
+}
+
+func TestStreamResults_stopped(t *testing.T) {
+	streamPollInterval = 10 * time.Millisecond
+
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "systemd_logs"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		url, err := aggregation.GlobalResultURL(srv.URL, "systemd_logs")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+
+		withTempDir(t, func(tmpdir string) {
+			resultFile := tmpdir + "/systemd_logs"
+			ioutil.WriteFile(resultFile, []byte("so far"), 0755)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err := StreamResults(ctx, tmpdir+"/done", resultFile, url, srv.Client())
+			stopped, ok := err.(*StoppedError)
+			if !ok {
+				t.Fatalf("expected a *StoppedError, got %v", err)
+			}
+			if stopped.FlushErr != nil {
+				t.Fatalf("Got error flushing streamed results: %v", stopped.FlushErr)
+			}
+
+			contents, err := ioutil.ReadFile(path.Join(aggr.OutputDir, "systemd_logs", "results"))
+			if err != nil {
+				t.Fatalf("couldn't read streamed results: %v", err)
+			}
+			if string(contents) != "so far" {
+				t.Errorf("expected streamed results %q, got %q", "so far", string(contents))
+			}
+		})
+	})
+}
+
+func TestStreamResults_directory(t *testing.T) {
+	streamPollInterval = 10 * time.Millisecond
+
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		url, err := aggregation.GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+
+		withTempDir(t, func(tmpdir string) {
+			resultDir := tmpdir + "/results"
+			os.MkdirAll(resultDir, 0755)
+			ioutil.WriteFile(resultDir+"/junit.xml", []byte("<xml/>"), 0755)
+			ioutil.WriteFile(tmpdir+"/done", []byte(resultDir), 0755)
+
+			if err := StreamResults(context.Background(), tmpdir+"/done", resultDir, url, srv.Client()); err != nil {
+				t.Fatalf("Got error streaming results: %v", err)
+			}
+
+			ensureExists(t, path.Join(aggr.OutputDir, "e2e", "results", "junit.xml"))
+		})
+	})
+}
+
+func TestRunGlobal_multipleFiles(t *testing.T) {
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	doneFiles := map[string]func(tmpdir string) string{
+		"newlines": func(tmpdir string) string {
+			return tmpdir + "/junit.xml\n" + tmpdir + "/e2e.log\n"
+		},
+		"json": func(tmpdir string) string {
+			return `["` + tmpdir + `/junit.xml", "` + tmpdir + `/e2e.log"]`
+		},
+	}
+
+	for name, doneFile := range doneFiles {
+		t.Run(name, func(t *testing.T) {
+			withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+				url, err := aggregation.GlobalResultURL(srv.URL, "e2e")
+				if err != nil {
+					t.Fatalf("unexpected error getting global result url %v", err)
+				}
+
+				withTempDir(t, func(tmpdir string) {
+					ioutil.WriteFile(tmpdir+"/junit.xml", []byte("<xml/>"), 0755)
+					ioutil.WriteFile(tmpdir+"/e2e.log", []byte("log"), 0755)
+					ioutil.WriteFile(tmpdir+"/done", []byte(doneFile(tmpdir)), 0755)
+					err := GatherResults(context.Background(), tmpdir+"/done", url, srv.Client())
+					if err != nil {
+						t.Fatalf("Got error running agent: %v", err)
+					}
+
+					ensureExists(t, path.Join(aggr.OutputDir, "e2e", "results", "junit.xml"))
+					ensureExists(t, path.Join(aggr.OutputDir, "e2e", "results", "e2e.log"))
+					if _, ok := aggr.Results["e2e"]; !ok {
+						t.Errorf("expected the last file to complete the result, got %v", aggr.Results)
+					}
+				})
+			})
+		})
+	}
+}
+
+func TestParseWaitFile(t *testing.T) {
+	testCases := []struct {
+		name      string
+		contents  string
+		expected  []string
+		expectErr bool
+	}{
+		{name: "single file", contents: "/tmp/results/junit.xml\n", expected: []string{"/tmp/results/junit.xml"}},
+		{name: "newlines", contents: "/tmp/results/junit.xml\n\n/tmp/results/e2e.log\n", expected: []string{"/tmp/results/junit.xml", "/tmp/results/e2e.log"}},
+		{name: "json", contents: `["/tmp/results/junit.xml", "/tmp/results/e2e.log"]`, expected: []string{"/tmp/results/junit.xml", "/tmp/results/e2e.log"}},
+		{name: "empty", contents: "\n", expectErr: true},
+		{name: "same base name", contents: "/tmp/results/a/junit.xml\n/tmp/results/b/junit.xml\n", expectErr: true},
+		{name: "listed twice", contents: `["/tmp/results/junit.xml", "/tmp/results/junit.xml"]`, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resultFiles, err := parseWaitFile([]byte(tc.contents))
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", resultFiles)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(resultFiles, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, resultFiles)
+			}
+		})
+	}
+}
+
+func TestDoRequest_retry(t *testing.T) {
+	defer SetRetryPolicy(DefaultRetryPolicy)
+
+	testCases := []struct {
+		name             string
+		attempts         int
+		statuses         []int
+		expectErr        bool
+		expectedRequests int
+	}{
+		{name: "transient failures", attempts: 3, statuses: []int{503, 502, 200}, expectedRequests: 3},
+		{name: "too many requests", attempts: 3, statuses: []int{429, 200}, expectedRequests: 2},
+		{name: "attempts exhausted", attempts: 2, statuses: []int{503, 503, 200}, expectErr: true, expectedRequests: 2},
+		{name: "conflict not retried", attempts: 3, statuses: []int{409, 200}, expectErr: true, expectedRequests: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			SetRetryPolicy(RetryPolicy{
+				Attempts:        tc.attempts,
+				InitialInterval: time.Millisecond,
+				MaxInterval:     5 * time.Millisecond,
+				Jitter:          0.5,
+			})
+
+			requests := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				if string(body) != "results" {
+					t.Errorf("expected each attempt to send the full results, got %q", body)
+				}
+				w.WriteHeader(tc.statuses[requests])
+				requests++
+			}))
+			defer srv.Close()
+
+			err := DoRequest(srv.URL, srv.Client(), func() (io.Reader, string, error) {
+				return strings.NewReader("results"), "text/plain", nil
+			})
+			if tc.expectErr != (err != nil) {
+				t.Errorf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if requests != tc.expectedRequests {
+				t.Errorf("expected %v requests, got %v", tc.expectedRequests, requests)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_maxElapsedTime(t *testing.T) {
+	policy := RetryPolicy{
+		Attempts:        100,
+		MaxElapsedTime:  50 * time.Millisecond,
+		InitialInterval: 10 * time.Millisecond,
+	}
+
+	calls := 0
+	err := policy.retry(func() (bool, error) {
+		calls++
+		return true, errors.New("unavailable")
+	})
+	if err == nil {
+		t.Fatal("expected the last error once the retries ran out")
+	}
+	// Waits of 10ms, 20ms, then 40ms would exceed the 50ms budget.
+	if calls != 3 {
+		t.Errorf("expected 3 attempts within the time budget, got %v", calls)
+	}
+}
+
+func TestRetryPolicy_noAttemptLimit(t *testing.T) {
+	policy := RetryPolicy{
+		MaxElapsedTime:  50 * time.Millisecond,
+		InitialInterval: time.Millisecond,
+		MaxInterval:     time.Millisecond,
+	}
+
+	calls := 0
+	err := policy.retry(func() (bool, error) {
+		calls++
+		return true, errors.New("unavailable")
+	})
+	if err == nil {
+		t.Fatal("expected the last error once the retries ran out")
+	}
+	// Only the time budget limits the attempts.
+	if calls <= 5 {
+		t.Errorf("expected to keep retrying until the time budget ran out, got %v attempts", calls)
+	}
+}
+
+func TestRetryPolicyFromConfig(t *testing.T) {
+	// These are what the plugin drivers set from a plugin's submit-retry.
+	env := map[string]string{
+		"RETRY_ATTEMPTS":         "10",
+		"RETRY_MAX_ELAPSED_TIME": "10m0s",
+		"RETRY_JITTER":           "0.5",
+	}
+	for name, value := range env {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("couldn't load config: %v", err)
+	}
+	policy := RetryPolicyFromConfig(cfg)
+	if policy.Attempts != 10 || policy.MaxElapsedTime != 10*time.Minute || policy.Jitter != 0.5 {
+		t.Errorf("expected 10 attempts over 10m with 0.5 jitter, got %v attempts over %v with %v jitter",
+			policy.Attempts, policy.MaxElapsedTime, policy.Jitter)
+	}
+	if policy.InitialInterval != DefaultRetryPolicy.InitialInterval {
+		t.Errorf("expected the default initial interval %v, got %v", DefaultRetryPolicy.InitialInterval, policy.InitialInterval)
+	}
+}
+
+func TestDoRequest_backpressure(t *testing.T) {
+	defer SetRetryPolicy(DefaultRetryPolicy)
+
+	testCases := []struct {
+		name                string
+		maxBackpressureTime time.Duration
+		retryAfter          string
+		expectErr           bool
+		expectedRequests    int
+	}{
+		{name: "waits for space", maxBackpressureTime: time.Minute, retryAfter: "0", expectedRequests: 3},
+		{name: "gives up waiting", maxBackpressureTime: 100 * time.Millisecond, retryAfter: "1", expectErr: true, expectedRequests: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Waiting for space doesn't use up the single attempt.
+			SetRetryPolicy(RetryPolicy{
+				Attempts:            1,
+				InitialInterval:     time.Millisecond,
+				MaxBackpressureTime: tc.maxBackpressureTime,
+			})
+
+			requests := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ioutil.ReadAll(r.Body)
+				requests++
+				if requests < 3 {
+					w.Header().Set("Retry-After", tc.retryAfter)
+					w.WriteHeader(http.StatusInsufficientStorage)
+					fmt.Fprint(w, `{"plugin": "e2e", "freeBytes": 10, "minFreeBytes": 100, "retryAfterSeconds": 60}`)
+				}
+			}))
+			defer srv.Close()
+
+			err := DoRequest(srv.URL, srv.Client(), func() (io.Reader, string, error) {
+				return strings.NewReader("results"), "text/plain", nil
+			})
+			if tc.expectErr {
+				if _, ok := errors.Cause(err).(*aggregation.InsufficientStorageError); !ok {
+					t.Errorf("expected an insufficient storage error, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if requests != tc.expectedRequests {
+				t.Errorf("expected %v requests, got %v", tc.expectedRequests, requests)
+			}
+		})
+	}
+}
+
+func TestRelayProgress(t *testing.T) {
+	progressPollInterval = 10 * time.Millisecond
+
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		url, err := aggregation.GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+
+		withTempDir(t, func(tmpdir string) {
+			stop := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				RelayProgress(tmpdir+"/progress", aggregation.ProgressURL(url), srv.Client(), stop)
+				close(done)
+			}()
+
+			ioutil.WriteFile(tmpdir+"/progress", []byte(`{"completed": 120, "total": 350}`), 0755)
+			for i := 0; i < 100 && len(aggr.LatestProgress()) == 0; i++ {
+				time.Sleep(progressPollInterval)
+			}
+			close(stop)
+			<-done
+
+			progress := aggr.LatestProgress()
+			if len(progress) != 1 || progress[0].Completed != 120 || progress[0].Total != 350 {
+				t.Errorf("expected progress of 120/350 to be relayed, got %v", progress)
+			}
+		})
+	})
+}
+
+func TestRelayProgress_failures(t *testing.T) {
+	progressPollInterval = 10 * time.Millisecond
+
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	sent := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+
+	withTempDir(t, func(tmpdir string) {
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			RelayProgress(tmpdir+"/progress", srv.URL, srv.Client(), stop)
+			close(done)
+		}()
+		defer func() {
+			close(stop)
+			<-done
+		}()
+
+		// Neither a version that can't be decoded nor one the master
+		// refuses is tried again until it changes.
+		ioutil.WriteFile(tmpdir+"/progress", []byte(`{"completed": 1`), 0755)
+		time.Sleep(10 * progressPollInterval)
+		if n := sent(); n != 0 {
+			t.Fatalf("expected undecodable progress not to be sent, got %v requests", n)
+		}
+
+		ioutil.WriteFile(tmpdir+"/progress", []byte(`{"completed": 1, "total": 2}`), 0755)
+		for i := 0; i < 100 && sent() == 0; i++ {
+			time.Sleep(progressPollInterval)
+		}
+		time.Sleep(10 * progressPollInterval)
+		if n := sent(); n != 1 {
+			t.Errorf("expected refused progress to be sent once, got %v requests", n)
+		}
+	})
+}
+
+func TestRunGlobal_compressed(t *testing.T) {
+	if err := SetCompression(plugin.GzipCompression); err != nil {
+		t.Fatalf("unexpected error setting compression: %v", err)
+	}
+	defer SetCompression("")
+
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "systemd_logs"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		url, err := aggregation.GlobalResultURL(srv.URL, "systemd_logs")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+
+		withTempDir(t, func(tmpdir string) {
+			contents := strings.Repeat(`{"unit": "kubelet"}`, 1000)
+			ioutil.WriteFile(tmpdir+"/systemd_logs.json", []byte(contents), 0755)
+			ioutil.WriteFile(tmpdir+"/done", []byte(tmpdir+"/systemd_logs.json"), 0755)
+			err := GatherResults(context.Background(), tmpdir+"/done", url, srv.Client())
+			if err != nil {
+				t.Fatalf("Got error running agent: %v", err)
+			}
+
+			stored, err := ioutil.ReadFile(path.Join(aggr.OutputDir, "systemd_logs", "results"))
+			if err != nil {
+				t.Fatalf("couldn't read stored result: %v", err)
+			}
+			if string(stored) != contents {
+				t.Errorf("expected the result to be stored uncompressed, got %d bytes", len(stored))
+			}
+		})
+	})
+}
+
+func TestDoRequest_checksum(t *testing.T) {
+	expected := fmt.Sprintf("%x", sha256.Sum256([]byte("results")))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		if checksum := r.Trailer.Get(aggregation.ChecksumHeader); checksum != expected {
+			t.Errorf("expected checksum trailer %v, got %q", expected, checksum)
+		}
+	}))
+	defer srv.Close()
+
+	err := DoRequest(srv.URL, srv.Client(), func() (io.Reader, string, error) {
+		return strings.NewReader("results"), "text/plain", nil
+	})
+	if err != nil {
+		t.Errorf("unexpected error sending results: %v", err)
+	}
+}
+
+func TestDoRequest_resultsToken(t *testing.T) {
+	SetResultsToken("secret-token")
+	defer SetResultsToken("")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		if auth := r.Header.Get(aggregation.AuthorizationHeader); auth != "Bearer secret-token" {
+			t.Errorf("expected the results token, got %q", auth)
+		}
+	}))
+	defer srv.Close()
+
+	err := DoRequest(srv.URL, srv.Client(), func() (io.Reader, string, error) {
+		return strings.NewReader("results"), "text/plain", nil
+	})
+	if err != nil {
+		t.Errorf("unexpected error sending results: %v", err)
+	}
+}
+
+func TestDoRequest_externalResults(t *testing.T) {
+	defer SetRetryPolicy(DefaultRetryPolicy)
+	SetRetryPolicy(RetryPolicy{Attempts: 2, InitialInterval: time.Millisecond, MaxInterval: time.Millisecond})
+	defer SetExternalResults("", "")
+	defer func(client *http.Client) { externalClient = client }(externalClient)
+
+	testCases := []struct {
+		name           string
+		masterStatus   int
+		externalStatus int
+		expectErr      bool
+	}{
+		{name: "both succeed", masterStatus: http.StatusOK, externalStatus: http.StatusAccepted},
+		{name: "master fails", masterStatus: http.StatusConflict, externalStatus: http.StatusOK, expectErr: true},
+		{name: "external fails", masterStatus: http.StatusOK, externalStatus: http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			master := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ioutil.ReadAll(r.Body)
+				w.WriteHeader(tc.masterStatus)
+			}))
+			defer master.Close()
+
+			var received []string
+			external := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				received = append(received, string(body))
+				if r.Method != http.MethodPost {
+					t.Errorf("expected a POST, got %v", r.Method)
+				}
+				if r.URL.Path != "/collector/api/v1/results/global/e2e" {
+					t.Errorf("expected the submission's path to be appended, got %v", r.URL.Path)
+				}
+				if auth := r.Header.Get("Authorization"); auth != "Bearer external" {
+					t.Errorf("expected the external Authorization header, got %q", auth)
+				}
+				if timedOut := r.Header.Get(aggregation.TimedOutHeader); timedOut != "true" {
+					t.Errorf("expected the submission's headers, got %q", timedOut)
+				}
+				w.WriteHeader(tc.externalStatus)
+			}))
+			defer external.Close()
+			externalClient = external.Client()
+			if err := SetExternalResults(external.URL+"/collector/", "Bearer external"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			headers := http.Header{}
+			headers.Set(aggregation.TimedOutHeader, "true")
+			err := doRequestWithHeaders(master.URL+"/api/v1/results/global/e2e", master.Client(), headers, func() (io.Reader, string, error) {
+				return strings.NewReader("results"), "text/plain", nil
+			})
+			if tc.expectErr != (err != nil) {
+				t.Errorf("expected error %v, got %v", tc.expectErr, err)
+			}
+			if len(received) == 0 || received[0] != "results" {
+				t.Errorf("expected the external endpoint to get the results, got %q", received)
+			}
+		})
+	}
+}
+
+func TestDoRequest_traceparent(t *testing.T) {
+	// Nothing's listening at the endpoint, so exporting the spans only logs
+	// a warning.
+	tracer := tracing.NewTracer("http://127.0.0.1:1", "sonobuoy-worker", nil)
+	defer tracer.Shutdown()
+	parent := tracing.RunSpanContext("run")
+	SetTraceSpan(tracer.Start("worker", parent, nil))
+	defer SetTraceSpan(nil)
+
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		traceparent = r.Header.Get(tracing.TraceparentHeader)
+	}))
+	defer srv.Close()
+
+	err := DoRequest(srv.URL, srv.Client(), func() (io.Reader, string, error) {
+		return strings.NewReader("results"), "text/plain", nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error sending results: %v", err)
+	}
+
+	upload, err := tracing.ParseTraceparent(traceparent)
+	if err != nil {
+		t.Fatalf("expected the upload's span to be sent, got %q: %v", traceparent, err)
+	}
+	if upload.TraceID != parent.TraceID {
+		t.Errorf("expected the upload to be traced as part of the run, got trace %x", upload.TraceID)
+	}
+	if upload.SpanID == parent.SpanID {
+		t.Error("expected the upload to be traced in a span of its own")
+	}
+}
+
+func TestRunGlobal_grpc(t *testing.T) {
+	if err := SetProtocol(plugin.GRPCProtocol); err != nil {
+		t.Fatalf("unexpected error setting protocol: %v", err)
+	}
+	defer SetProtocol("")
+	if err := SetCompression(plugin.GzipCompression); err != nil {
+		t.Fatalf("unexpected error setting compression: %v", err)
+	}
+	defer SetCompression("")
+
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "systemd_logs"},
+	}
+
+	withTempDir(t, func(tmpdir string) {
+		aggr := aggregation.NewAggregator(tmpdir, expectedResults)
+		handler := aggregation.NewHandler(aggr.HandleHTTPResult, aggr.HandleHTTPProgress, aggr.HandleHTTPHeartbeat)
+		srv := authtest.NewTLSServer(aggregation.WithGRPC(aggregation.NewGRPCServer(handler, nil), handler), t)
+		defer srv.Close()
+		client := srv.ClientWithName("systemd_logs")
+
+		url, err := aggregation.GlobalResultURL(srv.URL, "systemd_logs")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+
+		if err := sendProgress([]byte(`{"completed": 1, "total": 2}`), aggregation.ProgressURL(url), client); err != nil {
+			t.Fatalf("unexpected error sending progress: %v", err)
+		}
+		if progress := aggr.LatestProgress(); len(progress) != 1 || progress[0].Completed != 1 {
+			t.Errorf("expected progress to be relayed, got %v", progress)
+		}
+
+		withTempDir(t, func(resultsDir string) {
+			// Big enough to need several chunks.
+			contents := strings.Repeat(`{"unit": "kubelet"}`, 10000)
+			ioutil.WriteFile(resultsDir+"/systemd_logs.json", []byte(contents), 0755)
+			ioutil.WriteFile(resultsDir+"/done", []byte(resultsDir+"/systemd_logs.json"), 0755)
+			if err := GatherResults(context.Background(), resultsDir+"/done", url, client); err != nil {
+				t.Fatalf("Got error running agent: %v", err)
+			}
+
+			stored, err := ioutil.ReadFile(path.Join(aggr.OutputDir, "systemd_logs", "results"))
+			if err != nil {
+				t.Fatalf("couldn't read stored result: %v", err)
+			}
+			if string(stored) != contents {
+				t.Errorf("expected the result to be stored uncompressed, got %d bytes", len(stored))
+			}
+
+			// Duplicates, such as from a retried pod, replace the result.
+			err = DoRequest(url, client, func() (io.Reader, string, error) {
+				return strings.NewReader("again"), "text/plain", nil
+			})
+			if err != nil {
+				t.Errorf("expected the duplicate to be stored, got %v", err)
+			}
+			stored, err = ioutil.ReadFile(path.Join(aggr.OutputDir, "systemd_logs", "results"))
+			if string(stored) != "again" {
+				t.Errorf("expected the duplicate to replace the result, got %q (%v)", string(stored), err)
+			}
+		})
+	})
+}
+
+func TestRunGlobal_timeout(t *testing.T) {
+	SetPluginTimeout(10 * time.Millisecond)
+	defer SetPluginTimeout(0)
+
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		url, err := aggregation.GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+
+		withTempDir(t, func(tmpdir string) {
+			// No done file is ever written
+			if err := GatherResults(context.Background(), tmpdir+"/done", url, srv.Client()); err != nil {
+				t.Fatalf("Got error reporting timeout: %v", err)
+			}
+
+			result, ok := aggr.Results["e2e"]
+			if !ok {
+				t.Fatalf("expected a timeout to be reported, got %v", aggr.Results)
+			}
+			if !result.TimedOut || result.IsSuccess() {
+				t.Errorf("expected a timed out error result, got %+v", result)
+			}
+			ensureExists(t, path.Join(aggr.OutputDir, "e2e", "errors"))
+		})
+	})
+}
+
+func TestSendHeartbeats(t *testing.T) {
+	heartbeatInterval = 10 * time.Millisecond
+
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{NodeName: "node1", ResultType: "systemd_logs"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		url, err := aggregation.NodeResultURL(srv.URL, "node1", "systemd_logs")
+		if err != nil {
+			t.Fatalf("unexpected error getting node result url %v", err)
+		}
+
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			SendHeartbeats(aggregation.HeartbeatURL(url), srv.Client(), stop)
+			close(done)
+		}()
+
+		for i := 0; i < 100 && len(aggr.LatestHeartbeats()) == 0; i++ {
+			time.Sleep(heartbeatInterval)
+		}
+		close(stop)
+		<-done
+
+		if _, ok := aggr.LatestHeartbeats()[expectedResults[0]]; !ok {
+			t.Errorf("expected a heartbeat for node1, got %v", aggr.LatestHeartbeats())
+		}
+	})
+}
+
+func TestRunGlobal_flush(t *testing.T) {
+	heartbeatInterval = 10 * time.Millisecond
+	defer func() {
+		flushRequested = make(chan struct{})
+		flushOnce = sync.Once{}
+	}()
+
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		url, err := aggregation.GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+		aggr.RequestFlush()
+
+		// The same client is used for heartbeats and results, and the
+		// heartbeats have to stop before the flush state is reset.
+		client := srv.Client()
+		stop, stopped := make(chan struct{}), make(chan struct{})
+		defer func() {
+			close(stop)
+			<-stopped
+		}()
+		go func() {
+			SendHeartbeats(aggregation.HeartbeatURL(url), client, stop)
+			close(stopped)
+		}()
+
+		withTempDir(t, func(tmpdir string) {
+			// The plugin has only got part of the way, and never writes the
+			// done file.
+			ioutil.WriteFile(tmpdir+"/e2e.log", []byte("log"), 0755)
+			if err := GatherResults(context.Background(), tmpdir+"/done", url, client); err != nil {
+				t.Fatalf("Got error sending partial results: %v", err)
+			}
+
+			result, ok := aggr.Results["e2e"]
+			if !ok {
+				t.Fatalf("expected partial results to be sent, got %v", aggr.Results)
+			}
+			if !result.Incomplete || result.IsSuccess() {
+				t.Errorf("expected an incomplete result, got %+v", result)
+			}
+			ensureExists(t, path.Join(aggr.OutputDir, "e2e", "results", "e2e.log"))
+		})
+	})
+}
+
+func TestRunGlobal_stopped(t *testing.T) {
+	waitfilePollInterval = 10 * time.Millisecond
+	defer func() { waitfilePollInterval = 1 * time.Second }()
+
+	testCases := []struct {
+		desc     string
+		ctx      func() (context.Context, context.CancelFunc)
+		expected error
+	}{
+		{
+			desc: "shut down",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(50*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			expected: context.Canceled,
+		}, {
+			desc: "deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 50*time.Millisecond)
+			},
+			expected: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			expectedResults := []plugin.ExpectedResult{
+				plugin.ExpectedResult{ResultType: "e2e"},
+			}
+
+			withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+				url, err := aggregation.GlobalResultURL(srv.URL, "e2e")
+				if err != nil {
+					t.Fatalf("unexpected error getting global result url %v", err)
+				}
+
+				withTempDir(t, func(tmpdir string) {
+					// The plugin never writes the done file.
+					ioutil.WriteFile(tmpdir+"/e2e.log", []byte("log"), 0755)
+					ctx, cancel := tc.ctx()
+					defer cancel()
+
+					err := GatherResults(ctx, tmpdir+"/done", url, srv.Client())
+					stopped, ok := errors.Cause(err).(*StoppedError)
+					if !ok {
+						t.Fatalf("expected a stopped error, got %v", err)
+					}
+					if stopped.Err != tc.expected || stopped.FlushErr != nil {
+						t.Errorf("expected to stop with %v and flush, got %v", tc.expected, stopped)
+					}
+
+					result, ok := aggr.Results["e2e"]
+					if !ok {
+						t.Fatalf("expected partial results to be flushed, got %v", aggr.Results)
+					}
+					if !result.Incomplete {
+						t.Errorf("expected an incomplete result, got %+v", result)
+					}
+					ensureExists(t, path.Join(aggr.OutputDir, "e2e", "results", "e2e.log"))
+				})
+			})
+		})
+	}
+}
+
+func TestRunGlobal_stoppedAfterDone(t *testing.T) {
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		url, err := aggregation.GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+
+		withTempDir(t, func(tmpdir string) {
+			// The plugin finished as the worker was shutting down.
+			ioutil.WriteFile(tmpdir+"/e2e.log", []byte("log"), 0755)
+			ioutil.WriteFile(tmpdir+"/done", []byte(tmpdir+"/e2e.log"), 0755)
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			if err := GatherResults(ctx, tmpdir+"/done", url, srv.Client()); err != nil {
+				t.Fatalf("Got error running agent: %v", err)
+			}
+			if result, ok := aggr.Results["e2e"]; !ok || result.Incomplete {
+				t.Errorf("expected complete results, got %+v", aggr.Results)
+			}
+		})
+	})
+}
+
+func TestRunGlobal_directory(t *testing.T) {
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		url, err := aggregation.GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+
+		withTempDir(t, func(tmpdir string) {
+			resultDir := tmpdir + "/results"
+			os.MkdirAll(resultDir+"/logs", 0755)
+			ioutil.WriteFile(resultDir+"/junit.xml", []byte("<xml/>"), 0755)
+			ioutil.WriteFile(resultDir+"/logs/e2e.log", []byte("log"), 0755)
+			ioutil.WriteFile(tmpdir+"/done", []byte(resultDir), 0755)
+
+			if err := GatherResults(context.Background(), tmpdir+"/done", url, srv.Client()); err != nil {
+				t.Fatalf("Got error running agent: %v", err)
+			}
+
+			ensureExists(t, path.Join(aggr.OutputDir, "e2e", "results", "junit.xml"))
+			ensureExists(t, path.Join(aggr.OutputDir, "e2e", "results", "logs", "e2e.log"))
+		})
+	})
+}
+
+func TestRunGlobal_directoryAndFiles(t *testing.T) {
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		url, err := aggregation.GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+
+		withTempDir(t, func(tmpdir string) {
+			os.MkdirAll(tmpdir+"/logs", 0755)
+			ioutil.WriteFile(tmpdir+"/logs/e2e.log", []byte("log"), 0755)
+			ioutil.WriteFile(tmpdir+"/junit.xml", []byte("<xml/>"), 0755)
+			ioutil.WriteFile(tmpdir+"/done", []byte(tmpdir+"/logs\n"+tmpdir+"/junit.xml\n"), 0755)
+
+			if err := GatherResults(context.Background(), tmpdir+"/done", url, srv.Client()); err != nil {
+				t.Fatalf("Got error running agent: %v", err)
+			}
+
+			ensureExists(t, path.Join(aggr.OutputDir, "e2e", "results", "junit.xml"))
+			ensureExists(t, path.Join(aggr.OutputDir, "e2e", "results", "logs", "e2e.log"))
+		})
+	})
+}
+
+func TestRunGlobal_tooLarge(t *testing.T) {
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		aggr.MaxPluginBytes = 1024
+
+		url, err := aggregation.GlobalResultURL(srv.URL, "e2e")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+
+		withTempDir(t, func(tmpdir string) {
+			ioutil.WriteFile(tmpdir+"/e2e.log", bytes.Repeat([]byte("x"), 1024*1024), 0755)
+			ioutil.WriteFile(tmpdir+"/done", []byte(tmpdir+"/e2e.log"), 0755)
+
+			err := GatherResults(context.Background(), tmpdir+"/done", url, srv.Client())
+			if _, ok := errors.Cause(err).(*aggregation.ResultTooLargeError); !ok {
+				t.Errorf("expected a result too large error, got %v", err)
+			}
+		})
+	})
+}
+
+// rejectingFormat is a result format no result is valid in.
+type rejectingFormat struct{}
+
+func (rejectingFormat) Name() string { return "rejecting" }
+
+func (rejectingFormat) Validate(*plugin.Result, string) ([]string, error) {
+	return []string{"nothing is valid"}, nil
+}
+
+func TestRunGlobal_invalid(t *testing.T) {
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	for _, protocol := range []string{"", plugin.GRPCProtocol} {
+		t.Run("protocol "+protocol, func(t *testing.T) {
+			if err := SetProtocol(protocol); err != nil {
+				t.Fatalf("unexpected error setting protocol: %v", err)
+			}
+			defer SetProtocol("")
+
+			withTempDir(t, func(tmpdir string) {
+				aggr := aggregation.NewAggregator(tmpdir, expectedResults)
+				aggr.Formats = map[string]aggregation.ResultFormat{"e2e": rejectingFormat{}}
+				handler := aggregation.NewHandler(aggr.HandleHTTPResult, aggr.HandleHTTPProgress, aggr.HandleHTTPHeartbeat)
+				srv := authtest.NewTLSServer(aggregation.WithGRPC(aggregation.NewGRPCServer(handler, nil), handler), t)
+				defer srv.Close()
+
+				url, err := aggregation.GlobalResultURL(srv.URL, "e2e")
+				if err != nil {
+					t.Fatalf("unexpected error getting global result url %v", err)
+				}
+
+				withTempDir(t, func(resultsDir string) {
+					ioutil.WriteFile(resultsDir+"/e2e.log", []byte("log"), 0755)
+					ioutil.WriteFile(resultsDir+"/done", []byte(resultsDir+"/e2e.log"), 0755)
+
+					// The error explains what's wrong, and isn't retried.
+					err := GatherResults(context.Background(), resultsDir+"/done", url, srv.ClientWithName("e2e"))
+					invalid, ok := errors.Cause(err).(*aggregation.InvalidResultError)
+					if !ok || !reflect.DeepEqual(invalid.Problems, []string{"nothing is valid"}) {
+						t.Errorf("expected an invalid result error, got %v", err)
+					}
+				})
+			})
+		})
+	}
+}
+
+func TestRunGlobal_versionMismatch(t *testing.T) {
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "e2e"},
+	}
+
+	for _, protocol := range []string{"", plugin.GRPCProtocol} {
+		t.Run("protocol "+protocol, func(t *testing.T) {
+			if err := SetProtocol(protocol); err != nil {
+				t.Fatalf("unexpected error setting protocol: %v", err)
+			}
+			defer SetProtocol("")
+
+			withTempDir(t, func(tmpdir string) {
+				aggr := aggregation.NewAggregator(tmpdir, expectedResults)
+				aggr.Version = "v0.0.1"
+				handler := aggregation.NewHandler(aggr.HandleHTTPResult, aggr.HandleHTTPProgress, aggr.HandleHTTPHeartbeat)
+				srv := authtest.NewTLSServer(aggregation.WithGRPC(aggregation.NewGRPCServer(handler, nil), handler), t)
+				defer srv.Close()
+
+				url, err := aggregation.GlobalResultURL(srv.URL, "e2e")
+				if err != nil {
+					t.Fatalf("unexpected error getting global result url %v", err)
+				}
+
+				withTempDir(t, func(resultsDir string) {
+					ioutil.WriteFile(resultsDir+"/e2e.log", []byte("log"), 0755)
+					ioutil.WriteFile(resultsDir+"/done", []byte(resultsDir+"/e2e.log"), 0755)
+
+					// The worker says which version it is, and isn't retried
+					// once it's refused for it.
+					err := GatherResults(context.Background(), resultsDir+"/done", url, srv.ClientWithName("e2e"))
+					mismatch, ok := errors.Cause(err).(*aggregation.VersionMismatchError)
+					if !ok || mismatch.WorkerVersion != buildinfo.Version || mismatch.AggregatorVersion != "v0.0.1" {
+						t.Errorf("expected a version mismatch error, got %v", err)
+					}
+					if result, ok := aggr.Results["e2e"]; !ok || result.FailureReason != plugin.FailureVersionMismatch {
+						t.Errorf("expected the result to fail with a version mismatch, got %+v", result)
+					}
+				})
+			})
+		})
+	}
+}
+
+func TestSendReplicaResults(t *testing.T) {
+	expectedResults := []plugin.ExpectedResult{
+		plugin.ExpectedResult{ResultType: "netcheck"},
+	}
+
+	withAggregator(t, expectedResults, func(aggr *aggregation.Aggregator, srv *authtest.Server) {
+		url, err := aggregation.GlobalResultURL(srv.URL, "netcheck")
+		if err != nil {
+			t.Fatalf("unexpected error getting global result url %v", err)
+		}
+
+		withTempDir(t, func(tmpdir string) {
+			ioutil.WriteFile(tmpdir+"/latency.json", []byte("{}"), 0755)
+
+			// Replicas can report repeatedly, replacing what they sent before.
+			for _, replica := range []string{"netcheck-a", "netcheck-b", "netcheck-a"} {
+				if err := sendReplicaResults([]byte(tmpdir+"/latency.json"), replica, url, srv.Client()); err != nil {
+					t.Fatalf("Got error sending results for %v: %v", replica, err)
+				}
+			}
+
+			ensureExists(t, path.Join(aggr.OutputDir, "netcheck", "results", "netcheck-a-latency.json"))
+			ensureExists(t, path.Join(aggr.OutputDir, "netcheck", "results", "netcheck-b-latency.json"))
+			if _, ok := aggr.Results["netcheck"]; ok {
+				t.Error("expected replicas not to complete the result")
+			}
+		})
+	})
+}
+
+func TestStoreLocalResults(t *testing.T) {
+	SetResultsToken("token")
+	defer SetResultsToken("")
+
+	withTempDir(t, func(tmpdir string) {
+		localDir := tmpdir + "/local/e2e"
+		os.MkdirAll(localDir, 0755)
+		ioutil.WriteFile(localDir+"/stale.txt", []byte("old"), 0755)
+
+		os.MkdirAll(tmpdir+"/logs", 0755)
+		ioutil.WriteFile(tmpdir+"/logs/e2e.log", []byte("log"), 0755)
+		ioutil.WriteFile(tmpdir+"/junit.xml", []byte("<xml/>"), 0755)
+		ioutil.WriteFile(tmpdir+"/done", []byte(tmpdir+"/logs\n"+tmpdir+"/junit.xml\n"), 0755)
+
+		if err := StoreLocalResults(context.Background(), tmpdir+"/done", localDir); err != nil {
+			t.Fatalf("Got error storing results: %v", err)
+		}
+
+		contents, err := ioutil.ReadFile(path.Join(localDir, aggregation.LocalResultsDoneFile))
+		if err != nil {
+			t.Fatalf("couldn't read done file: %v", err)
+		}
+		var stored aggregation.LocalResults
+		if err := json.Unmarshal(contents, &stored); err != nil {
+			t.Fatalf("couldn't decode done file: %v", err)
+		}
+		expected := aggregation.LocalResults{
+			Token: aggregation.LocalResultsToken("token"),
+			Files: []aggregation.LocalResultFile{
+				{Name: "logs", MimeType: gzipMimeType},
+				{Name: "junit.xml", MimeType: mime.TypeByExtension(".xml")},
+			},
+		}
+		if !reflect.DeepEqual(stored, expected) {
+			t.Errorf("expected done file %+v, got %+v", expected, stored)
+		}
+
+		if b, err := ioutil.ReadFile(localDir + "/junit.xml"); err != nil || string(b) != "<xml/>" {
+			t.Errorf("expected junit.xml to be stored, got %q (%v)", b, err)
+		}
+		ensureExists(t, localDir+"/logs")
+		if _, err := os.Stat(localDir + "/stale.txt"); !os.IsNotExist(err) {
+			t.Errorf("expected results from an earlier run to be removed, got %v", err)
+		}
+	})
+}
+
+func TestStoreLocalResults_timeout(t *testing.T) {
+	SetPluginTimeout(10 * time.Millisecond)
+	defer SetPluginTimeout(0)
+
+	withTempDir(t, func(tmpdir string) {
+		// No done file is ever written
+		if err := StoreLocalResults(context.Background(), tmpdir+"/done", tmpdir+"/local"); err != nil {
+			t.Fatalf("Got error storing timeout: %v", err)
+		}
+
+		contents, err := ioutil.ReadFile(path.Join(tmpdir, "local", aggregation.LocalResultsDoneFile))
+		if err != nil {
+			t.Fatalf("couldn't read done file: %v", err)
+		}
+		var stored aggregation.LocalResults
+		if err := json.Unmarshal(contents, &stored); err != nil {
+			t.Fatalf("couldn't decode done file: %v", err)
+		}
+		if !stored.TimedOut || stored.Error == "" || len(stored.Files) != 0 {
+			t.Errorf("expected a timeout to be stored, got %+v", stored)
+		}
+	})
+}
+
+func TestWriteServiceAccountToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sonobuoy_token")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	mounted := path.Join(dir, "mounted-token")
+	if err := ioutil.WriteFile(mounted, []byte("mounted\n"), 0644); err != nil {
+		t.Fatalf("couldn't write mounted token: %v", err)
+	}
+	defer func(orig string) { mountedTokenFile = orig }(mountedTokenFile)
+	mountedTokenFile = mounted
+
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+	var supported bool
+	var got tokenRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !supported {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/namespaces/sonobuoy/serviceaccounts/sonobuoy-serviceaccount/token" {
+			t.Errorf("unexpected request %v %v", r.Method, r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("couldn't decode token request: %v", err)
+		}
+		got.Status.Token = "bound"
+		got.Status.ExpirationTimestamp.Time = expires
+		json.NewEncoder(w).Encode(got)
+	}))
+	defer srv.Close()
+
+	restConfig := &rest.Config{Host: srv.URL}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		t.Fatalf("couldn't create client: %v", err)
+	}
+	// The kubeconfig refers to the CA of the in-cluster config.
+	restConfig.TLSClientConfig.CAFile = "/ca.crt"
+	cfg := &plugin.WorkerConfig{
+		TokenDir:           dir,
+		TokenAudience:      "e2e",
+		PodName:            "sonobuoy-e2e-job",
+		PodUID:             "1234",
+		Namespace:          "sonobuoy",
+		ServiceAccountName: "sonobuoy-serviceaccount",
+	}
+
+	tests := []struct {
+		name      string
+		supported bool
+		token     string
+		refresh   time.Time
+	}{
+		// Clusters that can't issue bound tokens get the mounted one,
+		// which is checked for again soon.
+		{name: "unsupported", supported: false, token: "mounted", refresh: time.Now().Add(tokenRetryInterval)},
+		{name: "bound", supported: true, token: "bound", refresh: time.Now().Add(48 * time.Minute)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			supported = test.supported
+			refresh, err := writeServiceAccountToken(client.CoreV1().RESTClient(), restConfig, cfg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if d := refresh.Sub(test.refresh); d < -time.Minute || d > time.Minute {
+				t.Errorf("expected refresh at about %v, got %v", test.refresh, refresh)
+			}
+
+			token, err := ioutil.ReadFile(path.Join(dir, plugin.TokenFile))
+			if err != nil {
+				t.Fatalf("couldn't read token: %v", err)
+			}
+			if string(token) != test.token {
+				t.Errorf("expected token %q, got %q", test.token, token)
+			}
+
+			kubeconfig, err := clientcmd.LoadFromFile(path.Join(dir, plugin.KubeconfigFile))
+			if err != nil {
+				t.Fatalf("couldn't load kubeconfig: %v", err)
+			}
+			context := kubeconfig.Contexts[kubeconfig.CurrentContext]
+			if context == nil {
+				t.Fatalf("expected the kubeconfig's current context to exist, got %+v", kubeconfig)
+			}
+			cluster, user := kubeconfig.Clusters[context.Cluster], kubeconfig.AuthInfos[context.AuthInfo]
+			if cluster == nil || cluster.Server != srv.URL || cluster.CertificateAuthority != "/ca.crt" {
+				t.Errorf("expected the kubeconfig to be for %v, got cluster %+v", srv.URL, cluster)
+			}
+			if user == nil || user.TokenFile != path.Join(dir, plugin.TokenFile) {
+				t.Errorf("expected the kubeconfig to use the token file, got user %+v", user)
+			}
+		})
+	}
+
+	spec := got.Spec
+	if !reflect.DeepEqual(spec.Audiences, []string{"e2e"}) || spec.ExpirationSeconds != plugin.DefaultTokenExpirationSeconds {
+		t.Errorf("expected a token for e2e valid for an hour, got %+v", spec)
+	}
+	if ref := spec.BoundObjectRef; ref == nil || ref.Kind != "Pod" || ref.Name != "sonobuoy-e2e-job" || ref.UID != "1234" {
+		t.Errorf("expected the token to be bound to the pod, got %+v", ref)
+	}
+}
+
+func TestStopPod(t *testing.T) {
+	var method, contentType string
+	var patch map[string]map[string]int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/sonobuoy/pods/sonobuoy-e2e-job" {
+			t.Errorf("unexpected request %v %v", r.Method, r.URL.Path)
+		}
+		method, contentType = r.Method, r.Header.Get("Content-Type")
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			t.Errorf("couldn't decode patch: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"kind": "Pod", "apiVersion": "v1"})
+	}))
+	defer srv.Close()
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatalf("couldn't create client: %v", err)
+	}
+	if err := stopPod(client, "sonobuoy", "sonobuoy-e2e-job"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if method != http.MethodPatch || contentType != "application/strategic-merge-patch+json" {
+		t.Errorf("expected a strategic merge patch, got %v %v", method, contentType)
+	}
+	if deadline := patch["spec"]["activeDeadlineSeconds"]; deadline != 1 {
+		t.Errorf("expected the pod's deadline to be lowered to 1 second, got %v", patch)
+	}
+}
+
+func TestDownloadPayload(t *testing.T) {
+	defer SetRetryPolicy(DefaultRetryPolicy)
+	SetRetryPolicy(RetryPolicy{Attempts: 3, InitialInterval: time.Millisecond})
+
+	files := map[string]string{"skip.txt": "Flaky", "focus.txt": "Conformance"}
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// The master may still be starting.
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(files)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "sonobuoy_payload_test")
+	if err != nil {
+		t.Fatalf("couldn't create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := DownloadPayload(srv.URL, srv.Client(), path.Join(dir, "payload")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for name, contents := range files {
+		b, err := ioutil.ReadFile(path.Join(dir, "payload", name))
+		if err != nil || string(b) != contents {
+			t.Errorf("expected %v to contain %q, got %q (%v)", name, contents, b, err)
+		}
+	}
+
+	escaping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"../escaped": "oops"})
+	}))
+	defer escaping.Close()
+	if err := DownloadPayload(escaping.URL, escaping.Client(), path.Join(dir, "payload")); err == nil {
+		t.Error("expected an error for a file outside of the payload directory")
+	}
+	if _, err := os.Stat(path.Join(dir, "escaped")); err == nil {
+		t.Error("expected the file outside of the payload directory not to be written")
+	}
+}
@@ -0,0 +1,53 @@
+#!/bin/sh
+
+# Copyright 2018 Heptio Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Runs kube-bench's CIS benchmark checks on the node this runs on, as JSON.
+# Nodes running the API server are checked as masters as well as nodes. The
+# node's Kubernetes configuration is mounted at the same paths as on the
+# node, and its binaries under /usr/local/mount-from-host/bin, where
+# kube-bench looks for them.
+
+set -u
+
+RESULTS_DIR="${RESULTS_DIR:-/tmp/results}"
+# KUBE_BENCH_VERSION is the version of Kubernetes whose benchmark is run.
+# Unset lets kube-bench detect it.
+KUBE_BENCH_VERSION="${KUBE_BENCH_VERSION:-}"
+# API_SERVER_MANIFEST is found on the nodes that run the API server.
+API_SERVER_MANIFEST="${API_SERVER_MANIFEST:-/etc/kubernetes/manifests/kube-apiserver.yaml}"
+
+outdir="${RESULTS_DIR}/kube-bench"
+mkdir -p "${outdir}"
+
+version=""
+if [ -n "${KUBE_BENCH_VERSION}" ]; then
+    version="--version=${KUBE_BENCH_VERSION}"
+fi
+
+targets="node"
+if [ -f "${API_SERVER_MANIFEST}" ] || pgrep kube-apiserver > /dev/null 2>&1; then
+    targets="master node"
+fi
+
+# kube-bench exits with an error when checks fail, which is what's being
+# reported rather than a reason to stop.
+for target in ${targets}; do
+    kube-bench "${target}" --json ${version} > "${outdir}/${target}.json" 2> "${outdir}/${target}.log" \
+        || echo "kube-bench ${target} exited with status $?" >> "${outdir}/${target}.log"
+done
+
+# Tell the Sonobuoy worker the results are ready.
+echo -n "${outdir}" > "${RESULTS_DIR}/done"
@@ -0,0 +1,61 @@
+#!/bin/sh
+
+# Copyright 2018 Heptio Inc.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Gathers diagnostics from the node this runs on: its OS, the journald logs of
+# the kubelet and container runtime, its sysctl values and its disk and inode
+# usage. The node's root filesystem is mounted at CHROOT_DIR, so every command
+# runs on the node itself rather than in this container.
+
+set -u
+
+RESULTS_DIR="${RESULTS_DIR:-/tmp/results}"
+CHROOT_DIR="${CHROOT_DIR:-/node}"
+# LOG_MINUTES limits the journald logs to the last so many minutes. Unset
+# collects all of them.
+LOG_MINUTES="${LOG_MINUTES:-}"
+# LOG_UNITS are the systemd units whose logs are collected. Units a node
+# doesn't have just log that there are no entries.
+LOG_UNITS="${LOG_UNITS:-kubelet containerd docker}"
+
+outdir="${RESULTS_DIR}/node-diagnostics"
+mkdir -p "${outdir}"
+
+# collect runs a command on the node, writing its output to a file in outdir.
+# Failures are noted in the file rather than stopping the others.
+collect() {
+    file="$1"
+    shift
+    chroot "${CHROOT_DIR}" "$@" > "${outdir}/${file}" 2>&1 || echo "'$*' exited with status $?" >> "${outdir}/${file}"
+}
+
+collect os-release.txt cat /etc/os-release
+collect uname.txt uname -a
+collect uptime.txt uptime
+
+since=""
+if [ -n "${LOG_MINUTES}" ]; then
+    since="--since=-${LOG_MINUTES}min"
+fi
+for unit in ${LOG_UNITS}; do
+    collect "journal-${unit}.txt" journalctl --no-pager --unit="${unit}" ${since}
+done
+
+collect sysctl.txt sysctl -a
+collect df.txt df -h
+collect df-inodes.txt df -i
+
+# Tell the Sonobuoy worker the results are ready.
+echo -n "${outdir}" > "${RESULTS_DIR}/done"